@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Kinds of roster activity shown in the dispatcher feed
+const (
+	ActivityCreated      = "created"
+	ActivityUpdated      = "updated"
+	ActivitySubstitution = "substitution" // a different staff member took over the slot
+	ActivityCancelled    = "cancelled"
+	ActivityCompleted    = "completed"
+	ActivityReactivated  = "reactivated"
+)
+
+const (
+	defaultActivityLimit = 50
+	maxActivityLimit     = 200
+)
+
+// ActivityFilter narrows the activity feed. A nil BusIDs matches every bus.
+type ActivityFilter struct {
+	BusIDs    []int
+	Since     time.Time
+	Limit     int
+	Clearance *Clearance // the caller's; entries for assignments it can't see are left out
+}
+
+// ActivityItem is one human-readable entry in the activity feed
+type ActivityItem struct {
+	ID           int64     `json:"id"`
+	Type         string    `json:"type"`
+	AssignmentID string    `json:"assignment_id"` // public ID
+	BusID        int       `json:"bus_id"`
+	StaffID      int       `json:"staff_id"`
+	Depot        string    `json:"depot,omitempty"`
+	Actor        string    `json:"actor"`
+	OccurredAt   time.Time `json:"occurred_at"`
+	Summary      string    `json:"summary"`
+}
+
+// staffLabel names a staff member from the directory, falling back to their ID
+func staffLabel(staffID int) string {
+	if staff := lookupStaff(staffID); staff != nil {
+		return staff["name"]
+	}
+	return fmt.Sprintf("staff %d", staffID)
+}
+
+// busLabel names a bus by plate number, falling back to its ID
+func busLabel(busID int) string {
+	if bus := lookupBus(busID); bus != nil {
+		return "bus " + bus["plate_number"]
+	}
+	return fmt.Sprintf("bus %d", busID)
+}
+
+// depotBuses lists the buses at a depot in ID order
+func depotBuses(depot string) []int {
+	ids := []int{}
+	for id, bus := range mockBuses {
+		if bus["depot"] == depot {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// decodeSnapshot reads an audit snapshot, returning nil for an empty one
+func decodeSnapshot(data json.RawMessage) (*Assignment, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	assignment := &Assignment{}
+	if err := json.Unmarshal(data, assignment); err != nil {
+		return nil, err
+	}
+	return assignment, nil
+}
+
+// newActivityItem classifies an audit entry and describes it for the feed
+func newActivityItem(entry AuditEntry) (ActivityItem, error) {
+	before, err := decodeSnapshot(entry.Before)
+	if err != nil {
+		return ActivityItem{}, err
+	}
+	after, err := decodeSnapshot(entry.After)
+	if err != nil {
+		return ActivityItem{}, err
+	}
+
+	current := after
+	if current == nil {
+		current = before
+	}
+	if current == nil {
+		return ActivityItem{}, fmt.Errorf("audit entry %d has no snapshot", entry.ID)
+	}
+
+	item := ActivityItem{
+		ID:           entry.ID,
+		AssignmentID: entry.PublicID,
+		BusID:        current.BusID,
+		StaffID:      current.StaffID,
+		Depot:        busDepot(current.BusID),
+		Actor:        entry.Actor,
+		OccurredAt:   entry.ChangedAt,
+	}
+	slot := fmt.Sprintf("%s on %s", current.Role, busLabel(current.BusID))
+
+	switch {
+	case entry.Action == AuditActionCreate:
+		item.Type = ActivityCreated
+		item.Summary = fmt.Sprintf("%s assigned as %s from %s",
+			staffLabel(current.StaffID), slot, current.StartDate.Format("2006-01-02"))
+	case entry.Action == AuditActionRestore:
+		item.Type = ActivityReactivated
+		item.Summary = fmt.Sprintf("%s's deleted assignment as %s restored", staffLabel(current.StaffID), slot)
+	case entry.Action == AuditActionDelete || current.Status == "cancelled":
+		item.Type = ActivityCancelled
+		item.Summary = fmt.Sprintf("%s's assignment as %s cancelled", staffLabel(current.StaffID), slot)
+	case entry.Action == AuditActionStatusChange && current.Status == "completed":
+		item.Type = ActivityCompleted
+		item.Summary = fmt.Sprintf("%s's assignment as %s completed", staffLabel(current.StaffID), slot)
+	case entry.Action == AuditActionStatusChange:
+		item.Type = ActivityReactivated
+		item.Summary = fmt.Sprintf("%s's assignment as %s reactivated", staffLabel(current.StaffID), slot)
+	case before != nil && before.StaffID != current.StaffID:
+		item.Type = ActivitySubstitution
+		item.Summary = fmt.Sprintf("%s replaces %s as %s",
+			staffLabel(current.StaffID), staffLabel(before.StaffID), slot)
+	default:
+		item.Type = ActivityUpdated
+		item.Summary = fmt.Sprintf("%s's assignment as %s updated", staffLabel(current.StaffID), slot)
+	}
+
+	return item, nil
+}
+
+func (h *AssignmentHandler) handleGetActivity(c *gin.Context) {
+	h = h.forRequest(c)
+	filter := ActivityFilter{
+		Since:     time.Now().Add(-24 * time.Hour),
+		Limit:     defaultActivityLimit,
+		Clearance: callerClearance(c),
+	}
+
+	if sinceStr := c.Query("since"); sinceStr != "" {
+		since, err := time.Parse(time.RFC3339, sinceStr)
+		if err != nil {
+			respondInvalidField(c, "since", "Invalid since format. Use RFC 3339, e.g. 2025-10-01T18:00:00Z")
+			return
+		}
+		filter.Since = since
+	}
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxActivityLimit {
+			respondInvalidField(c, "limit", fmt.Sprintf("limit must be between 1 and %d", maxActivityLimit))
+			return
+		}
+		filter.Limit = limit
+	}
+
+	depot := c.Query("depot")
+	if depot != "" {
+		filter.BusIDs = depotBuses(depot)
+	}
+
+	entries, err := h.repo.Activity(filter)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve activity")
+		return
+	}
+
+	items := make([]ActivityItem, 0, len(entries))
+	for _, entry := range entries {
+		item, err := newActivityItem(entry)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to read activity")
+			return
+		}
+		items = append(items, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"since":    filter.Since,
+		"depot":    depot,
+		"activity": items,
+		"count":    len(items),
+	})
+}
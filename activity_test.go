@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGetActivity(t *testing.T) {
+	router, repo := newTestRouter(t)
+	north := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+	south := mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-01-01")})
+
+	north.StaffID = 3
+	if err := repo.Update(&north, "dispatcher-1"); err != nil {
+		t.Fatal(err)
+	}
+	south.Status = "cancelled"
+	if err := repo.Update(&south, "dispatcher-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := doRequest(router, http.MethodGet, "/api/activity", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	body := decode[struct{ Activity []ActivityItem }](t, rec)
+	wantTypes := []string{ActivityCancelled, ActivitySubstitution, ActivityCreated, ActivityCreated}
+	if len(body.Activity) != len(wantTypes) {
+		t.Fatalf("got %d items, want %d: %+v", len(body.Activity), len(wantTypes), body.Activity)
+	}
+	for i, want := range wantTypes {
+		if body.Activity[i].Type != want {
+			t.Errorf("item %d type = %q, want %q", i, body.Activity[i].Type, want)
+		}
+	}
+	if got, want := body.Activity[1].Summary, "Sam Relief replaces John Driver as driver on bus ABC-1234"; got != want {
+		t.Errorf("summary = %q, want %q", got, want)
+	}
+	if body.Activity[1].Actor != "dispatcher-1" {
+		t.Errorf("actor = %q, want dispatcher-1", body.Activity[1].Actor)
+	}
+}
+
+func TestGetActivityFilters(t *testing.T) {
+	router, repo := newTestRouter(t)
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+	mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-01-01")})
+	mustCreate(t, repo, Assignment{BusID: 2, StaffID: 2, Role: "conductor", StartDate: date("2025-01-01")})
+
+	tests := []struct {
+		query     string
+		wantCode  int
+		wantCount int
+	}{
+		{"?depot=north", http.StatusOK, 2},
+		{"?depot=south", http.StatusOK, 1},
+		{"?depot=east", http.StatusOK, 0},
+		{"?limit=1", http.StatusOK, 1},
+		{"?since=2999-01-01T00:00:00Z", http.StatusOK, 0},
+		{"?limit=0", http.StatusBadRequest, 0},
+		{"?since=yesterday", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		rec := doRequest(router, http.MethodGet, "/api/activity"+tt.query, nil)
+		if rec.Code != tt.wantCode {
+			t.Errorf("%q: status = %d, want %d", tt.query, rec.Code, tt.wantCode)
+			continue
+		}
+		if tt.wantCode != http.StatusOK {
+			continue
+		}
+		if body := decode[struct{ Count int }](t, rec); body.Count != tt.wantCount {
+			t.Errorf("%q: count = %d, want %d", tt.query, body.Count, tt.wantCount)
+		}
+	}
+}
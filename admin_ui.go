@@ -0,0 +1,40 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed ui
+var uiFiles embed.FS
+
+// adminUIEnabled reports whether ADMIN_UI_ENABLED asks for the embedded admin
+// UI, for deployments without the dispatcher frontend
+func adminUIEnabled() bool {
+	return os.Getenv("ADMIN_UI_ENABLED") == "true"
+}
+
+// serveAdminUI serves the embedded admin UI under /ui/. The assets hold no
+// data: the UI only signs in once the caller's token passes an admin-only
+// endpoint, and sends it with every API call, so the API's own checks protect
+// everything it shows.
+func serveAdminUI(router *gin.Engine) {
+	assets, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err) // the directory is embedded at build time
+	}
+
+	ui := router.Group("/ui", func(c *gin.Context) {
+		// Scripts and styles only from the UI itself, and never framed
+		c.Header("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Referrer-Policy", "no-referrer")
+		c.Header("Cache-Control", "no-cache")
+		c.Next()
+	})
+	ui.StaticFS("/", http.FS(assets))
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAdminUI(t *testing.T) {
+	t.Setenv("ADMIN_UI_ENABLED", "true")
+	router, _ := newTestRouter(t)
+
+	rec := doRequest(router, http.MethodGet, "/ui/", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /ui/: status %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `<script src="app.js"`) {
+		t.Errorf("GET /ui/ did not return the UI page: %s", rec.Body.String())
+	}
+	if csp := rec.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "default-src 'self'") {
+		t.Errorf("Content-Security-Policy = %q, want scripts limited to the UI", csp)
+	}
+
+	rec = doRequest(router, http.MethodGet, "/ui/app.js", nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/javascript") {
+		t.Errorf("GET /ui/app.js: status %d, content type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if rec := doRequest(router, http.MethodGet, "/ui", nil); rec.Code != http.StatusMovedPermanently {
+		t.Errorf("GET /ui: status %d, want a redirect to /ui/", rec.Code)
+	}
+}
+
+func TestAdminUIDisabledByDefault(t *testing.T) {
+	t.Setenv("ADMIN_UI_ENABLED", "")
+	router, _ := newTestRouter(t)
+
+	if rec := doRequest(router, http.MethodGet, "/ui/", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /ui/ with the UI disabled: status %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// anonymizationKey keys the pseudonyms and date shift of anonymized exports;
+// main reads it from ANONYMIZATION_KEY. Without one every export gets a
+// random key, so exports can't be linked to each other.
+var anonymizationKey []byte
+
+// maxDateShiftWeeks bounds the date shift either way
+const maxDateShiftWeeks = 104
+
+// anonymizedColumns describe the anonymized dataset, in order
+var anonymizedColumns = []ManifestColumn{
+	{"record", "Row number, assigned in start date order"},
+	{"staff", "Pseudonym of the staff member"},
+	{"bus", "Pseudonym of the bus"},
+	{"depot", "Pseudonym of the bus's depot"},
+	{"role", "driver or conductor"},
+	{"start_date", "First day of the assignment, shifted"},
+	{"end_date", "Last day of the assignment, shifted; empty when open-ended"},
+	{"working_days", "Weekdays worked, ;-separated; empty means every day"},
+	{"shift_start", "Shift start, HH:MM; empty for a whole-day assignment"},
+	{"shift_end", "Shift end, HH:MM"},
+	{"dual_role_allowed", "Whether the staff member may hold the other role on the bus at the same time"},
+	{"status", "active, completed or cancelled"},
+}
+
+// ManifestColumn documents one column of an anonymized dataset
+type ManifestColumn struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// AnonymizedManifest ships with an anonymized dataset and records how it was
+// anonymized, so the recipients know what they can rely on
+type AnonymizedManifest struct {
+	Dataset       string            `json:"dataset"`
+	GeneratedAt   time.Time         `json:"generated_at"` // when the snapshot the rows come from was taken
+	Rows          int               `json:"rows"`
+	Filters       map[string]string `json:"filters"`
+	Columns       []ManifestColumn  `json:"columns"`
+	Anonymization AnonymizationNote `json:"anonymization"`
+}
+
+// AnonymizationNote describes the transformations applied to the dataset
+type AnonymizationNote struct {
+	Identifiers string   `json:"identifiers"`
+	Pseudonyms  string   `json:"pseudonyms"`
+	Dates       string   `json:"dates"`
+	Removed     []string `json:"removed"`
+	Excluded    []string `json:"excluded"`
+}
+
+// anonymizer pseudonymizes identifiers and shifts dates under one key
+type anonymizer struct {
+	key   []byte
+	shift int // days, a whole number of weeks so weekdays are kept
+}
+
+// newAnonymizer uses the configured key, or a random one when none is set
+func newAnonymizer(key []byte) (*anonymizer, error) {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	a := &anonymizer{key: key}
+
+	// Derived from the key, so a stable key shifts every export alike
+	sum := a.mac("date-shift")
+	weeks := 1 + int(binary.BigEndian.Uint16(sum[:2]))%maxDateShiftWeeks
+	if sum[2]&1 == 1 {
+		weeks = -weeks
+	}
+	a.shift = weeks * 7
+	return a, nil
+}
+
+func (a *anonymizer) mac(value string) []byte {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// pseudonym replaces an identifier with a keyed hash, e.g. S-3f9a0c12d4e5b6a7
+func (a *anonymizer) pseudonym(prefix, kind, id string) string {
+	if id == "" {
+		return ""
+	}
+	return prefix + "-" + hex.EncodeToString(a.mac(kind + ":" + id)[:8])
+}
+
+func (a *anonymizer) date(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.AddDate(0, 0, a.shift).Format("2006-01-02")
+}
+
+// row anonymizes one assignment, without its record number
+func (a *anonymizer) row(assignment *Assignment) []string {
+	return []string{
+		a.pseudonym("S", "staff", strconv.Itoa(assignment.StaffID)),
+		a.pseudonym("B", "bus", strconv.Itoa(assignment.BusID)),
+		a.pseudonym("D", "depot", busDepot(assignment.BusID)),
+		assignment.Role,
+		a.date(&assignment.StartDate),
+		a.date(assignment.EndDate),
+		formatWorkingDays(assignment.WorkingDays),
+		formatTimeOfDay(assignment.ShiftStart),
+		formatTimeOfDay(assignment.ShiftEnd),
+		strconv.FormatBool(assignment.DualRoleAllowed),
+		assignment.Status,
+	}
+}
+
+// anonymizedRecords anonymizes the assignments that may be shared, ordered by
+// start date so the row order says nothing about when they were entered
+func (a *anonymizer) anonymizedRecords(assignments []Assignment) [][]string {
+	var records [][]string
+	for i := range assignments {
+		if assignments[i].ClearanceLabel != "" {
+			continue // restricted duties never leave the service
+		}
+		records = append(records, a.row(&assignments[i]))
+	}
+	// start_date first, then the remaining columns so ties can't leak the
+	// original order either
+	sort.Slice(records, func(i, j int) bool {
+		if records[i][4] != records[j][4] {
+			return records[i][4] < records[j][4]
+		}
+		return strings.Join(records[i], ",") < strings.Join(records[j], ",")
+	})
+	for i := range records {
+		records[i] = append([]string{strconv.Itoa(i + 1)}, records[i]...)
+	}
+	return records
+}
+
+// manifest documents a dataset of the given size
+func (a *anonymizer) manifest(rows int, filter AssignmentFilter, stable bool, now time.Time) AnonymizedManifest {
+	filters := map[string]string{}
+	for name, value := range map[string]string{"status": filter.Status, "role": filter.Role, "depot": filter.Depot} {
+		if value != "" {
+			filters[name] = value
+		}
+	}
+	pseudonyms := "Keyed with a random key for this export only, so pseudonyms don't match those in any other export"
+	if stable {
+		pseudonyms = "Keyed with the service's anonymization key, so the same staff member, bus or depot has the same " +
+			"pseudonym, and dates the same shift, in every export"
+	}
+	return AnonymizedManifest{
+		Dataset:     "bus-staff-assignments",
+		GeneratedAt: now.UTC().Truncate(time.Second),
+		Rows:        rows,
+		Filters:     filters,
+		Columns:     anonymizedColumns,
+		Anonymization: AnonymizationNote{
+			Identifiers: "Staff, bus and depot identifiers are replaced with the first 64 bits of an HMAC-SHA256 " +
+				"of the identifier, which can't be reversed without the key",
+			Pseudonyms: pseudonyms,
+			Dates: "Every date is shifted by the same undisclosed whole number of weeks, up to two years either way, " +
+				"so weekdays, durations and gaps between assignments are preserved but calendar dates are not",
+			Removed: []string{"assignment IDs, references and external references", "staff names and bus details",
+				"creation, update and deletion timestamps", "pay classification and public holidays",
+				"audit trail, actors and all free text"},
+			Excluded: []string{"assignments restricted by a clearance label", "deleted assignments"},
+		},
+	}
+}
+
+// anonymizedFilterError explains why a filter can't be used for an anonymized
+// export, or returns "" when it can
+func anonymizedFilterError(filter AssignmentFilter) string {
+	if filter.BusID != 0 || filter.StaffID != 0 || filter.Ref != "" || filter.IncludeDeleted {
+		return "Anonymized exports can't be narrowed to a bus, staff member or reference, or include deleted assignments"
+	}
+	return ""
+}
+
+// writeAnonymizedExport writes a zip of assignments.csv and manifest.json,
+// anonymized for sharing with researchers. Nothing is written when the
+// anonymization can't be prepared.
+func writeAnonymizedExport(w io.Writer, assignments []Assignment, filter AssignmentFilter, now time.Time) (int, error) {
+	anon, err := newAnonymizer(anonymizationKey)
+	if err != nil {
+		return 0, err
+	}
+	records := anon.anonymizedRecords(assignments)
+	manifest, err := json.MarshalIndent(anon.manifest(len(records), filter, len(anonymizationKey) > 0, now), "", "  ")
+	if err != nil {
+		return 0, err
+	}
+
+	archive := zip.NewWriter(w)
+	file, err := archive.Create("assignments.csv")
+	if err != nil {
+		return 0, err
+	}
+	header := make([]string, len(anonymizedColumns))
+	for i, column := range anonymizedColumns {
+		header[i] = column.Name
+	}
+	writer := csv.NewWriter(file)
+	writer.Write(header)
+	writer.WriteAll(records)
+	if err := writer.Error(); err != nil {
+		return 0, err
+	}
+	if file, err = archive.Create("manifest.json"); err != nil {
+		return 0, err
+	}
+	if _, err := file.Write(manifest); err != nil {
+		return 0, err
+	}
+	return len(records), archive.Close()
+}
+
+// exportAnonymized sends the assignments matching the filter as an anonymized
+// dataset
+func (h *AssignmentHandler) exportAnonymized(c *gin.Context, filter AssignmentFilter) {
+	if msg := anonymizedFilterError(filter); msg != "" {
+		respondError(c, http.StatusBadRequest, msg)
+		return
+	}
+
+	asOf, assignments, err := snapshotAssignments(h.repo, filter)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve assignments")
+		return
+	}
+	var archive bytes.Buffer
+	if _, err := writeAnonymizedExport(&archive, assignments, filter, asOf); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to prepare the anonymized dataset")
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="assignments-anonymized.zip"`)
+	c.Header(snapshotHeader, asOf.UTC().Format(time.RFC3339Nano))
+	c.Data(http.StatusOK, "application/zip", archive.Bytes())
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readAnonymizedExport unpacks the records and manifest of an anonymized export
+func readAnonymizedExport(t *testing.T, body []byte) ([][]string, AnonymizedManifest) {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records [][]string
+	var manifest AnonymizedManifest
+	for _, file := range archive.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(f)
+		f.Close()
+		switch file.Name {
+		case "assignments.csv":
+			if records, err = csv.NewReader(bytes.NewReader(data)).ReadAll(); err != nil {
+				t.Fatal(err)
+			}
+		case "manifest.json":
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				t.Fatal(err)
+			}
+		default:
+			t.Errorf("unexpected file %s", file.Name)
+		}
+	}
+	return records, manifest
+}
+
+func TestAnonymizedExport(t *testing.T) {
+	router, repo := newTestRouter(t)
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-05"),
+		ExternalRef: "PAY-1", WorkingDays: DayMask(1 << time.Wednesday)})
+	mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-03-03")})
+	mustCreate(t, repo, Assignment{BusID: 2, StaffID: 2, Role: "conductor", StartDate: date("2025-03-03"),
+		ClearanceLabel: "vip-charter"})
+
+	anonymizationKey = []byte("research-key")
+	defer func() { anonymizationKey = nil }()
+	export := func() ([][]string, AnonymizedManifest) {
+		rec := doRequest(router, http.MethodGet, "/api/assignments/export?format=anonymized", nil)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+			t.Fatalf("status = %d %s: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+		}
+		return readAnonymizedExport(t, rec.Body.Bytes())
+	}
+
+	records, manifest := export()
+	if len(records) != 3 || manifest.Rows != 2 || len(manifest.Columns) != len(records[0]) {
+		t.Fatalf("records = %v, manifest rows = %d, want the restricted assignment left out", records, manifest.Rows)
+	}
+	for _, record := range records[1:] {
+		line := strings.Join(record, ",")
+		if strings.Contains(line, "PAY-1") || strings.Contains(line, "2025-03-0") || record[1] == "1" || record[1] == "3" {
+			t.Errorf("record %q leaks identifiers or dates", line)
+		}
+		if !strings.HasPrefix(record[1], "S-") || !strings.HasPrefix(record[2], "B-") || !strings.HasPrefix(record[3], "D-") {
+			t.Errorf("record %q isn't pseudonymized", line)
+		}
+	}
+
+	// One shift for every date, a whole number of weeks, so weekdays hold
+	first, _ := time.Parse("2006-01-02", records[1][5])
+	second, _ := time.Parse("2006-01-02", records[2][5])
+	if second.Sub(first) != 48*time.Hour || first.Weekday() != time.Monday || records[2][7] != "wed" {
+		t.Errorf("shifted dates %s and %s don't keep their weekdays and gap", records[1][5], records[2][5])
+	}
+
+	again, _ := export()
+	if again[1][1] != records[1][1] || again[1][5] != records[1][5] {
+		t.Error("pseudonyms and dates changed between exports under the same key")
+	}
+	anonymizationKey = nil
+	if unkeyed, _ := export(); unkeyed[1][1] == records[1][1] {
+		t.Error("an unkeyed export reused the configured pseudonyms")
+	}
+
+	if rec := doRequest(router, http.MethodGet, "/api/assignments/export?format=anonymized&staff_id=1", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("narrowed export status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,158 @@
+// Package apierror is the error envelope of the bus staff assignment API,
+// shared by the server, which writes it, and Go clients, which read it back
+// with FromResponse and branch on it instead of matching messages:
+//
+//	err := apierror.FromResponse(resp)
+//	if errors.Is(err, apierror.ErrNotFound) {
+//		// gone already
+//	}
+//	var apiErr *apierror.Error
+//	if errors.As(err, &apiErr) && apiErr.Rule == apierror.RuleStaffAvailability {
+//		// offer someone else
+//	}
+package apierror
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Codes carried in the envelope. Clients branch on the code; the message is
+// for people and may change.
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeValidationFailed     = "validation_failed" // a 400 naming the fields at fault
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodeRuleViolation        = "rule_violation" // a business rule refused the change; see Rule
+	CodePreconditionFailed   = "precondition_failed"
+	CodeRequestTooLarge      = "request_too_large"
+	CodeUnprocessable        = "unprocessable"
+	CodePreconditionRequired = "precondition_required"
+	CodeInternal             = "internal_error"
+	CodeBadGateway           = "bad_gateway"
+	CodeUnavailable          = "unavailable"
+)
+
+// Rules a rule_violation names, each with the detail sent beside the envelope
+const (
+	RuleStaffAvailability  = "staff_availability"  // "unavailable": the periods the staff member is away
+	RuleStaffQualification = "staff_qualification" // "qualification": the license class missing or expired
+	RuleSchedulingHorizon  = "scheduling_horizon"  // "latest_start_date": the latest start allowed
+)
+
+// Sentinels to compare with errors.Is; an Error matches the one with its code
+var (
+	ErrInvalidRequest       = &Error{Code: CodeInvalidRequest}
+	ErrValidation           = &Error{Code: CodeValidationFailed}
+	ErrUnauthorized         = &Error{Code: CodeUnauthorized}
+	ErrForbidden            = &Error{Code: CodeForbidden}
+	ErrNotFound             = &Error{Code: CodeNotFound}
+	ErrConflict             = &Error{Code: CodeConflict}
+	ErrRuleViolation        = &Error{Code: CodeRuleViolation}
+	ErrStaleVersion         = &Error{Code: CodePreconditionFailed}
+	ErrPreconditionRequired = &Error{Code: CodePreconditionRequired}
+	ErrUnavailable          = &Error{Code: CodeUnavailable}
+)
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeInvalidRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusConflict:              CodeConflict,
+	http.StatusPreconditionFailed:    CodePreconditionFailed,
+	http.StatusRequestEntityTooLarge: CodeRequestTooLarge,
+	http.StatusUnprocessableEntity:   CodeUnprocessable,
+	http.StatusPreconditionRequired:  CodePreconditionRequired,
+	http.StatusInternalServerError:   CodeInternal,
+	http.StatusBadGateway:            CodeBadGateway,
+	http.StatusServiceUnavailable:    CodeUnavailable,
+}
+
+// CodeFor is the code an error response with the status carries when nothing
+// more specific applies
+func CodeFor(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+// FieldError is one request field that failed validation, named as the
+// client sent it: a JSON key, or a query parameter
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is the "error" member of every error response. Anything else about
+// the failure, such as the conflicting assignments, sits beside it; clients
+// find it in Details.
+type Error struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Rule    string       `json:"rule,omitempty"` // for rule_violation
+	Fields  []FieldError `json:"fields,omitempty"`
+
+	Status  int                        `json:"-"` // set by FromResponse
+	Details map[string]json.RawMessage `json:"-"` // the other members of the response, set by FromResponse
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Code
+	}
+	return e.Message
+}
+
+// Is matches the sentinel with the same code
+func (e *Error) Is(target error) bool {
+	sentinel, ok := target.(*Error)
+	return ok && sentinel.Code == e.Code
+}
+
+// Detail decodes the member of the response named key into v, such as the
+// "conflicts" of a conflict. It reports whether the response had one.
+func (e *Error) Detail(key string, v any) (bool, error) {
+	raw, ok := e.Details[key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// FromResponse reads an error response into an *Error, or returns nil for a
+// 2xx. The body is consumed but not closed. A body without the envelope, as
+// from a proxy in front of the API, still gives an Error with the status's
+// code.
+func FromResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	apiErr := &Error{Code: CodeFor(resp.StatusCode), Message: resp.Status, Status: resp.StatusCode}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("reading %s response: %w", resp.Status, err)
+	}
+	var members map[string]json.RawMessage
+	if json.Unmarshal(body, &members) != nil {
+		return apiErr
+	}
+	if raw, ok := members["error"]; ok {
+		var envelope Error
+		if json.Unmarshal(raw, &envelope) == nil && envelope.Code != "" {
+			envelope.Status = resp.StatusCode
+			apiErr = &envelope
+		}
+		delete(members, "error")
+	}
+	apiErr.Details = members
+	return apiErr
+}
@@ -0,0 +1,49 @@
+package apierror
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func response(status int, body string) *http.Response {
+	return &http.Response{StatusCode: status, Status: http.StatusText(status), Body: io.NopCloser(strings.NewReader(body))}
+}
+
+func TestFromResponse(t *testing.T) {
+	if err := FromResponse(response(http.StatusCreated, `{"id":"x"}`)); err != nil {
+		t.Errorf("2xx error = %v, want nil", err)
+	}
+
+	err := FromResponse(response(http.StatusConflict, `{"error":{"code":"rule_violation","message":"Staff member is away",`+
+		`"rule":"staff_availability"},"unavailable":[{"type":"leave"}]}`))
+	if !errors.Is(err, ErrRuleViolation) || errors.Is(err, ErrConflict) {
+		t.Errorf("error = %v, want a rule violation only", err)
+	}
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Rule != RuleStaffAvailability || apiErr.Status != http.StatusConflict {
+		t.Fatalf("error = %+v, want the staff availability rule on a 409", apiErr)
+	}
+	var unavailable []struct{ Type string }
+	if ok, err := apiErr.Detail("unavailable", &unavailable); !ok || err != nil || len(unavailable) != 1 || unavailable[0].Type != "leave" {
+		t.Errorf("unavailable detail = %v %v %+v, want the leave period", ok, err, unavailable)
+	}
+	if ok, _ := apiErr.Detail("error", new(any)); ok {
+		t.Error("details repeat the envelope")
+	}
+}
+
+func TestFromResponseWithoutEnvelope(t *testing.T) {
+	err := FromResponse(response(http.StatusBadGateway, "<html>upstream down</html>"))
+	if !errors.Is(err, &Error{Code: CodeBadGateway}) || err.Error() != "Bad Gateway" {
+		t.Errorf("error = %v, want bad_gateway from the status", err)
+	}
+
+	err = FromResponse(response(http.StatusNotFound, `{"message":"no route"}`))
+	var apiErr *Error
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &apiErr) || string(apiErr.Details["message"]) != `"no route"` {
+		t.Errorf("error = %+v, want not_found keeping the body's members", apiErr)
+	}
+}
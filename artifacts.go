@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+)
+
+// ArtifactStore keeps the files finished export jobs produce
+type ArtifactStore interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Delete(ctx context.Context, key string) error
+	// DownloadURL links to the artifact without needing a token, until the
+	// link expires
+	DownloadURL(key string, expires time.Time) (string, error)
+}
+
+// exportArtifacts stores export job artifacts; main sets it from
+// LoadArtifactStore
+var exportArtifacts ArtifactStore
+
+// LoadArtifactStore builds the store selected by EXPORT_STORAGE: s3 for an S3
+// compatible bucket, or local (the default) for a directory on this instance
+func LoadArtifactStore() (ArtifactStore, error) {
+	switch driver := strings.ToLower(os.Getenv("EXPORT_STORAGE")); driver {
+	case "", "local":
+		dir := os.Getenv("EXPORT_STORAGE_DIR")
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "bus-staff-exports")
+		}
+		return newLocalArtifactStore(dir, []byte(os.Getenv("EXPORT_URL_SIGNING_KEY")), os.Getenv("EXPORT_PUBLIC_URL"))
+	case "s3":
+		return newS3ArtifactStore("EXPORT")
+	default:
+		return nil, fmt.Errorf("unsupported EXPORT_STORAGE %q (use local or s3)", driver)
+	}
+}
+
+// artifactContentTypes are the extensions export artifacts are stored with
+var artifactContentTypes = map[string]string{
+	".csv": "text/csv; charset=utf-8",
+	".zip": "application/zip",
+}
+
+// validArtifactKey checks a key is what export jobs name their artifacts, the
+// job ID and an extension, so a link can't reach any other file
+func validArtifactKey(key string) bool {
+	name, ext := strings.TrimSuffix(key, filepath.Ext(key)), filepath.Ext(key)
+	normalized, ok := normalizeULID(name)
+	return ok && normalized == name && artifactContentTypes[ext] != ""
+}
+
+// localArtifactStore keeps artifacts in a directory and serves them itself
+// through links signed with an HMAC. It suits a single instance; with more,
+// the instance serving the link may not hold the file, so use s3.
+type localArtifactStore struct {
+	dir     string
+	key     []byte
+	baseURL string // prefixed to download links, e.g. https://assignments.example.com
+}
+
+// newLocalArtifactStore stores artifacts in the directory. Without a signing
+// key a random one is used, so links stop working when the process restarts.
+func newLocalArtifactStore(dir string, key []byte, baseURL string) (*localArtifactStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return &localArtifactStore{dir: dir, key: key, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+func (s *localArtifactStore) Put(_ context.Context, key, _ string, data []byte) error {
+	if !validArtifactKey(key) {
+		return fmt.Errorf("invalid artifact key %q", key)
+	}
+	return writeFileAtomic(s.dir, key, data)
+}
+
+// writeFileAtomic writes the file aside and renames it into place, so a
+// download never sees a partial file
+func writeFileAtomic(dir, name string, data []byte) error {
+	temp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), filepath.Join(dir, name))
+}
+
+func (s *localArtifactStore) Delete(_ context.Context, key string) error {
+	if !validArtifactKey(key) {
+		return fmt.Errorf("invalid artifact key %q", key)
+	}
+	if err := os.Remove(filepath.Join(s.dir, key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *localArtifactStore) signature(key string, expires int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "%s\n%d", key, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *localArtifactStore) DownloadURL(key string, expires time.Time) (string, error) {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", s.signature(key, expires.Unix()))
+	return s.baseURL + "/api/v1/export-artifacts/" + key + "?" + query.Encode(), nil
+}
+
+// handleDownloadArtifact serves an artifact to anyone holding an unexpired
+// link to it, without a token
+func (s *localArtifactStore) handleDownloadArtifact(c *gin.Context) {
+	key := c.Param("key")
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || !validArtifactKey(key) ||
+		!hmac.Equal([]byte(c.Query("signature")), []byte(s.signature(key, expires))) {
+		respondError(c, http.StatusForbidden, "Invalid download link")
+		return
+	}
+	if time.Now().Unix() >= expires {
+		respondError(c, http.StatusForbidden, "Download link has expired; fetch the export job for a new one")
+		return
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		respondError(c, http.StatusNotFound, "Export has expired")
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read export")
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="assignments-`+key+`"`)
+	c.Data(http.StatusOK, artifactContentTypes[filepath.Ext(key)], data)
+}
+
+// s3ArtifactStore keeps artifacts in an S3 compatible bucket. Download links
+// are presigned GETs, so the bucket can stay private. Attachments are kept
+// the same way, in a bucket of their own.
+type s3ArtifactStore struct {
+	client  *s3.Client
+	presign *s3.PresignClient
+	bucket  string
+}
+
+// maxPresignExpiry is the longest a presigned link may last
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+// newS3ArtifactStore reads the bucket and region from <prefix>_S3_BUCKET and
+// <prefix>_S3_REGION, e.g. EXPORT_S3_BUCKET, plus <prefix>_S3_ENDPOINT for
+// another S3 compatible service, which is addressed path-style. Credentials
+// come from the AWS SDK's default chain: AWS_ACCESS_KEY_ID and
+// AWS_SECRET_ACCESS_KEY, a shared profile, or the role of the instance or
+// pod the service runs as.
+func newS3ArtifactStore(prefix string) (*s3ArtifactStore, error) {
+	bucket, region := os.Getenv(prefix+"_S3_BUCKET"), os.Getenv(prefix+"_S3_REGION")
+	if bucket == "" || region == "" {
+		return nil, fmt.Errorf("%s_S3_BUCKET and %s_S3_REGION must be set", prefix, prefix)
+	}
+	endpoint := os.Getenv(prefix + "_S3_ENDPOINT")
+	if endpoint != "" {
+		if parsed, err := url.Parse(endpoint); err != nil || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid %s_S3_ENDPOINT %q", prefix, endpoint)
+		}
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region),
+		config.WithHTTPClient(awshttp.NewBuildableClient().WithTimeout(time.Minute)))
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS configuration for s3 %s storage: %w", strings.ToLower(prefix), err)
+	}
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+			// Not every S3 compatible service accepts the checksums the SDK
+			// adds by default
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+			o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+		}
+	})
+	return &s3ArtifactStore{client: client, presign: s3.NewPresignClient(client), bucket: bucket}, nil
+}
+
+func (s *s3ArtifactStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+	input := &s3.PutObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key), Body: bytes.NewReader(data)}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	if _, err := s.client.PutObject(ctx, input); err != nil {
+		return fmt.Errorf("s3: putting %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get reads an object, failing with os.ErrNotExist when there is none
+func (s *s3ArtifactStore) Get(ctx context.Context, key string) ([]byte, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	var status interface{ HTTPStatusCode() int }
+	if errors.As(err, &status) && status.HTTPStatusCode() == http.StatusNotFound {
+		return nil, fmt.Errorf("s3: %s: %w", key, os.ErrNotExist)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("s3: getting %s: %w", key, err)
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+func (s *s3ArtifactStore) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	if err != nil {
+		return fmt.Errorf("s3: deleting %s: %w", key, err)
+	}
+	return nil
+}
+
+func (s *s3ArtifactStore) DownloadURL(key string, expires time.Time) (string, error) {
+	expiry := time.Until(expires).Truncate(time.Second)
+	expiry = min(max(expiry, time.Second), maxPresignExpiry)
+	signed, err := s.presign.PresignGetObject(context.Background(),
+		&s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", fmt.Errorf("s3: presigning %s: %w", key, err)
+	}
+	return signed.URL, nil
+}
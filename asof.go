@@ -0,0 +1,51 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseAsOf reads the optional as_of query parameter: a date, meaning the end
+// of that day, or an RFC 3339 time. It returns the zero time when as_of isn't
+// set, and false once an error response has been written.
+func parseAsOf(c *gin.Context) (time.Time, bool) {
+	value := c.Query("as_of")
+	if value == "" {
+		return time.Time{}, true
+	}
+	if day, err := time.Parse("2006-01-02", value); err == nil {
+		return day.AddDate(0, 0, 1).Add(-time.Nanosecond), true
+	}
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		respondInvalidField(c, "as_of", "Invalid as_of. Use YYYY-MM-DD or an RFC 3339 time")
+		return time.Time{}, false
+	}
+	return at, true
+}
+
+// listAsOf lists the assignments matching the filter as they stood at the
+// time, rebuilt from the audit trail, in the order List would return them.
+// With from and to, only the ones overlapping those dates are rebuilt.
+func listAsOf(repo AssignmentRepository, filter AssignmentFilter, from, to *time.Time, at time.Time) ([]Assignment, error) {
+	column, descending := filter.sortColumn()
+	revisions, err := repo.ListAsOf(at, AsOfFilter{BusID: filter.BusID, StaffID: filter.StaffID, Depot: filter.Depot,
+		From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+
+	var assignments []Assignment
+	for _, assignment := range revisions {
+		// Snapshots taken before depots were recorded lack one
+		if assignment.DepotID == "" {
+			assignment.DepotID = busDepot(assignment.BusID)
+		}
+		if filter.Matches(&assignment) {
+			assignments = append(assignments, assignment)
+		}
+	}
+	sortAssignments(assignments, column, descending)
+	return assignments, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestAssignmentsAsOf(t *testing.T) {
+	router, repo := newTestRouter(t)
+	moved := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03")})
+	beforeMove := time.Now()
+
+	moved.BusID = 2
+	if err := repo.Update(&moved, "test"); err != nil {
+		t.Fatal(err)
+	}
+	added := mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-03-03")})
+	beforeDelete := time.Now()
+	if err := repo.Delete(moved.ID, moved.Version, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(asOf time.Time) []Assignment {
+		t.Helper()
+		rec := doRequest(router, http.MethodGet, "/api/assignments?as_of="+url.QueryEscape(asOf.Format(time.RFC3339Nano)), nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("list status = %d: %s", rec.Code, rec.Body.String())
+		}
+		return decode[struct{ Assignments []Assignment }](t, rec).Assignments
+	}
+
+	if got := list(beforeMove); len(got) != 1 || got[0].PublicID != moved.PublicID || got[0].BusID != 1 {
+		t.Errorf("before the move lists %+v, want the assignment on bus 1", got)
+	}
+	if got := list(beforeDelete); len(got) != 2 || got[0].PublicID != added.PublicID || got[1].BusID != 2 {
+		t.Errorf("before the delete lists %+v, want both, newest first, the moved one on bus 2", got)
+	}
+
+	// The roster for bus 1 on the day still shows who dispatch had on it
+	path := "/api/roster?from=2025-03-03&to=2025-03-03&bus_id=1&as_of=" + url.QueryEscape(beforeMove.Format(time.RFC3339Nano))
+	rec := doRequest(router, http.MethodGet, path, nil)
+	days := decode[struct{ Days []RosterDay }](t, rec).Days
+	if len(days) != 1 || len(days[0].Buses) != 1 || days[0].Buses[0].Crew[0].PublicID != moved.PublicID {
+		t.Errorf("roster as of before the move = %+v, want the moved assignment on bus 1", days)
+	}
+	rec = doRequest(router, http.MethodGet, "/api/roster?from=2025-03-03&to=2025-03-03&bus_id=1", nil)
+	if days := decode[struct{ Days []RosterDay }](t, rec).Days; len(days[0].Buses) != 0 {
+		t.Errorf("current roster for bus 1 = %+v, want it empty", days)
+	}
+
+	rec = doRequest(router, http.MethodGet, "/api/assignments?as_of=2000-01-01", nil)
+	if got := decode[struct{ Count int }](t, rec); got.Count != 0 {
+		t.Errorf("as of 2000-01-01 lists %d assignments, want none", got.Count)
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/assignments?as_of=yesterday", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid as_of status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
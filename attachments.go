@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAttachmentSize caps uploaded files; attachments are for documents like
+// a signed duty sheet, not bulk storage
+const maxAttachmentSize = 5 << 20
+
+// maxAttachmentFilenameLength matches the assignment_attachments.filename column
+const maxAttachmentFilenameLength = 255
+
+// Attachment is a small file kept with an assignment, such as a signed duty
+// sheet. Its content is in the attachment store under its ID.
+type Attachment struct {
+	ID           string    `json:"id"` // ULID
+	AssignmentID int       `json:"-"`
+	Filename     string    `json:"filename"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"` // bytes
+	UploadedBy   string    `json:"uploaded_by"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// AttachmentRepository stores what is known about each attachment; the files
+// themselves are in an AttachmentStore
+type AttachmentRepository interface {
+	Create(attachment *Attachment) error
+	Get(assignmentID int, id string) (*Attachment, error) // nil when the assignment has no such attachment
+	List(assignmentID int) ([]Attachment, error)          // oldest first
+
+	WithContext(ctx context.Context) AttachmentRepository
+}
+
+// AttachmentStore keeps the content of attachments, by attachment ID
+type AttachmentStore interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	// Get fails with os.ErrNotExist when there is no such file
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// attachmentFiles stores attachment content; main sets it from
+// LoadAttachmentStore
+var attachmentFiles AttachmentStore
+
+// LoadAttachmentStore builds the store selected by ATTACHMENT_STORAGE: s3 for
+// an S3 compatible bucket, or local (the default) for a directory, which
+// every instance must share
+func LoadAttachmentStore() (AttachmentStore, error) {
+	switch driver := strings.ToLower(os.Getenv("ATTACHMENT_STORAGE")); driver {
+	case "", "local":
+		dir := os.Getenv("ATTACHMENT_STORAGE_DIR")
+		if dir == "" {
+			dir = "attachments"
+		}
+		return newLocalAttachmentStore(dir)
+	case "s3":
+		return newS3ArtifactStore("ATTACHMENT")
+	default:
+		return nil, fmt.Errorf("unsupported ATTACHMENT_STORAGE %q (use local or s3)", driver)
+	}
+}
+
+// localAttachmentStore keeps attachments as files in a directory
+type localAttachmentStore struct {
+	dir string
+}
+
+func newLocalAttachmentStore(dir string) (*localAttachmentStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &localAttachmentStore{dir: dir}, nil
+}
+
+// validAttachmentKey checks a key is an attachment ID, so it can't name any
+// other file
+func validAttachmentKey(key string) bool {
+	normalized, ok := normalizeULID(key)
+	return ok && normalized == key
+}
+
+func (s *localAttachmentStore) Put(_ context.Context, key, _ string, data []byte) error {
+	if !validAttachmentKey(key) {
+		return fmt.Errorf("invalid attachment key %q", key)
+	}
+	return writeFileAtomic(s.dir, key, data)
+}
+
+func (s *localAttachmentStore) Get(_ context.Context, key string) ([]byte, error) {
+	if !validAttachmentKey(key) {
+		return nil, fmt.Errorf("invalid attachment key %q", key)
+	}
+	return os.ReadFile(filepath.Join(s.dir, key))
+}
+
+func (s *localAttachmentStore) Delete(_ context.Context, key string) error {
+	if !validAttachmentKey(key) {
+		return fmt.Errorf("invalid attachment key %q", key)
+	}
+	if err := os.Remove(filepath.Join(s.dir, key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// attachmentFilename reduces an uploaded file's name to its base name,
+// without control characters, within the column's length
+func attachmentFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	for utf8.RuneCountInString(name) > maxAttachmentFilenameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
+
+// attachmentFromParam loads the assignment's attachment named in the URL,
+// writing a 404 when there is none. It returns false once a response has been
+// written.
+func (h *AssignmentHandler) attachmentFromParam(c *gin.Context, assignment *Assignment) (*Attachment, bool) {
+	id, valid := normalizeULID(c.Param("attachmentId"))
+	if !valid {
+		respondError(c, http.StatusBadRequest, "Invalid attachment ID")
+		return nil, false
+	}
+	attachment, err := h.attachments.Get(assignment.ID, id)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to fetch attachment")
+		return nil, false
+	}
+	if attachment == nil {
+		respondError(c, http.StatusNotFound, "Attachment not found")
+		return nil, false
+	}
+	return attachment, true
+}
+
+func (h *AssignmentHandler) handleUploadAttachment(c *gin.Context) {
+	h = h.forRequest(c)
+	assignment, ok := h.assignmentFromParam(c, false)
+	if !ok {
+		return
+	}
+
+	// Leave room for the multipart framing around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAttachmentSize+64<<10)
+	header, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || (err == nil && header.Size > maxAttachmentSize) {
+		respondError(c, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("Attachments cannot be larger than %d MiB", maxAttachmentSize>>20))
+		return
+	}
+	if err != nil {
+		respondInvalidField(c, "file", "Expected a file upload in the 'file' form field")
+		return
+	}
+	if header.Size == 0 {
+		respondInvalidField(c, "file", "The uploaded file is empty")
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read upload")
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to read upload")
+		return
+	}
+
+	// Clients often send octet-stream for anything, so sniff those
+	contentType := header.Header.Get("Content-Type")
+	if _, _, err := mime.ParseMediaType(contentType); err != nil || contentType == "application/octet-stream" {
+		contentType = http.DetectContentType(data)
+	}
+
+	id, err := newULID(time.Now())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to store attachment")
+		return
+	}
+	attachment := Attachment{
+		ID:           id,
+		AssignmentID: assignment.ID,
+		Filename:     attachmentFilename(header.Filename),
+		ContentType:  contentType,
+		Size:         int64(len(data)),
+		UploadedBy:   actorFromContext(c),
+	}
+
+	// The file is stored first, so a listed attachment can always be downloaded
+	ctx := c.Request.Context()
+	if err := attachmentFiles.Put(ctx, attachment.ID, attachment.ContentType, data); err != nil {
+		log.Printf("attachments: storing %s failed: %v", attachment.ID, err)
+		respondError(c, http.StatusInternalServerError, "Failed to store attachment")
+		return
+	}
+	if err := h.attachments.Create(&attachment); err != nil {
+		if err := attachmentFiles.Delete(context.WithoutCancel(ctx), attachment.ID); err != nil {
+			log.Printf("attachments: removing orphaned %s failed: %v", attachment.ID, err)
+		}
+		respondError(c, http.StatusInternalServerError, "Failed to store attachment")
+		return
+	}
+
+	c.Header("Location", c.Request.URL.Path+"/"+attachment.ID)
+	c.JSON(http.StatusCreated, attachment)
+}
+
+func (h *AssignmentHandler) handleGetAttachments(c *gin.Context) {
+	h = h.forRequest(c)
+	assignment, ok := h.assignmentFromParam(c, false)
+	if !ok {
+		return
+	}
+
+	attachments, err := h.attachments.List(assignment.ID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to fetch attachments")
+		return
+	}
+	if attachments == nil {
+		attachments = []Attachment{}
+	}
+	c.JSON(http.StatusOK, gin.H{"attachments": attachments, "count": len(attachments)})
+}
+
+func (h *AssignmentHandler) handleDownloadAttachment(c *gin.Context) {
+	h = h.forRequest(c)
+	assignment, ok := h.assignmentFromParam(c, false)
+	if !ok {
+		return
+	}
+	attachment, ok := h.attachmentFromParam(c, assignment)
+	if !ok {
+		return
+	}
+
+	data, err := attachmentFiles.Get(c.Request.Context(), attachment.ID)
+	if errors.Is(err, os.ErrNotExist) {
+		respondError(c, http.StatusNotFound, "Attachment file is missing from storage")
+		return
+	}
+	if err != nil {
+		log.Printf("attachments: reading %s failed: %v", attachment.ID, err)
+		respondError(c, http.StatusInternalServerError, "Failed to read attachment")
+		return
+	}
+
+	// Always a download, so an uploaded HTML file can't run in the API's origin
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, attachment.ContentType, data)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useTestAttachmentStore keeps attachments in a temporary directory for the test
+func useTestAttachmentStore(t *testing.T) {
+	t.Helper()
+	files, err := newLocalAttachmentStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := attachmentFiles
+	attachmentFiles = files
+	t.Cleanup(func() { attachmentFiles = saved })
+}
+
+// uploadFile posts the data as the "file" field of a multipart form
+func uploadFile(router *gin.Engine, path, filename, contentType string, data []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(filename)
+	header.Set("Content-Disposition", `form-data; name="file"; filename="`+escaped+`"`)
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	part, _ := form.CreatePart(header)
+	part.Write(data)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, path, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAssignmentNotes(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	rec := doRequest(router, http.MethodPost, "/api/assignments", gin.H{"bus_id": 1, "staff_id": 1, "role": "driver",
+		"start_date": "2025-03-03", "notes": "  Covering route 12 due to breakdown "})
+	created := decode[Assignment](t, rec)
+	if rec.Code != http.StatusCreated || created.Notes != "Covering route 12 due to breakdown" {
+		t.Fatalf("create = %d %q, want the trimmed notes", rec.Code, created.Notes)
+	}
+
+	rec = doRequest(router, http.MethodPut, "/api/assignments/"+created.PublicID, gin.H{"bus_id": 1, "staff_id": 1,
+		"role": "driver", "start_date": "2025-03-03", "version": created.Version})
+	replaced := decode[Assignment](t, rec)
+	if rec.Code != http.StatusOK || replaced.Notes != created.Notes {
+		t.Errorf("PUT without notes = %d %q, want them kept", rec.Code, replaced.Notes)
+	}
+
+	rec = doRequest(router, http.MethodPatch, "/api/assignments/"+created.PublicID,
+		gin.H{"notes": strings.Repeat("n", maxNotesLength+1), "version": replaced.Version})
+	if got := errorOf(t, rec); rec.Code != http.StatusBadRequest || len(got.Fields) != 1 || got.Fields[0].Field != "notes" {
+		t.Errorf("long notes = %d %+v, want notes rejected", rec.Code, got)
+	}
+
+	rec = doRequest(router, http.MethodPatch, "/api/assignments/"+created.PublicID,
+		gin.H{"notes": "", "version": replaced.Version})
+	if patched := decode[Assignment](t, rec); rec.Code != http.StatusOK || patched.Notes != "" {
+		t.Errorf("PATCH empty notes = %d %q, want them removed", rec.Code, patched.Notes)
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	useTestAttachmentStore(t)
+	router, repo := newTestRouter(t)
+	assignment := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03")})
+	other := mustCreate(t, repo, Assignment{BusID: 2, StaffID: 2, Role: "conductor", StartDate: date("2025-03-03")})
+	path := "/api/v1/assignments/" + assignment.PublicID + "/attachments"
+
+	rec := uploadFile(router, path, `../scans/duty "sheet".txt`, "application/octet-stream", []byte("Signed: J. Driver"))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("upload status = %d: %s", rec.Code, rec.Body.String())
+	}
+	uploaded := decode[Attachment](t, rec)
+	if uploaded.Filename != "duty sheet.txt" || uploaded.Size != 17 || !strings.HasPrefix(uploaded.ContentType, "text/plain") {
+		t.Errorf("uploaded = %+v, want the base name, size and a sniffed content type", uploaded)
+	}
+	if location := rec.Header().Get("Location"); location != path+"/"+uploaded.ID {
+		t.Errorf("Location = %q", location)
+	}
+
+	list := decode[struct {
+		Attachments []Attachment
+		Count       int
+	}](t, doRequest(router, http.MethodGet, path, nil))
+	if list.Count != 1 || list.Attachments[0].ID != uploaded.ID {
+		t.Errorf("list = %+v, want the upload", list)
+	}
+
+	rec = doRequest(router, http.MethodGet, path+"/"+uploaded.ID, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "Signed: J. Driver" {
+		t.Fatalf("download = %d %q", rec.Code, rec.Body.String())
+	}
+	if disposition := rec.Header().Get("Content-Disposition"); disposition != `attachment; filename="duty sheet.txt"` {
+		t.Errorf("Content-Disposition = %q", disposition)
+	}
+
+	otherPath := "/api/v1/assignments/" + other.PublicID + "/attachments/" + uploaded.ID
+	if rec := doRequest(router, http.MethodGet, otherPath, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("download through another assignment = %d, want 404", rec.Code)
+	}
+}
+
+func TestAttachmentUploadLimits(t *testing.T) {
+	useTestAttachmentStore(t)
+	router, repo := newTestRouter(t)
+	assignment := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03")})
+	path := "/api/v1/assignments/" + assignment.PublicID + "/attachments"
+
+	if rec := uploadFile(router, path, "big.pdf", "application/pdf", make([]byte, maxAttachmentSize+1)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized upload = %d, want 413", rec.Code)
+	}
+	if rec := uploadFile(router, path, "empty.pdf", "application/pdf", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("empty upload = %d, want 400", rec.Code)
+	}
+	rec := doRequest(router, http.MethodPost, path, gin.H{"file": "not a form"})
+	if got := errorOf(t, rec); rec.Code != http.StatusBadRequest || len(got.Fields) != 1 || got.Fields[0].Field != "file" {
+		t.Errorf("JSON upload = %d %+v, want the file field named", rec.Code, got)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// Audit actions recorded for assignment mutations
+const (
+	AuditActionCreate       = "create"
+	AuditActionUpdate       = "update"
+	AuditActionDelete       = "delete"
+	AuditActionStatusChange = "status_change"
+	AuditActionRestore      = "restore"
+)
+
+// AuditEntry is one recorded change to an assignment
+type AuditEntry struct {
+	ID           int64           `json:"id"`
+	AssignmentID int             `json:"-"`
+	PublicID     string          `json:"assignment_id"` // the assignment's public ID
+	Action       string          `json:"action"`
+	Actor        string          `json:"actor"`
+	ChangedAt    time.Time       `json:"changed_at"`
+	Before       json.RawMessage `json:"before,omitempty"`
+	After        json.RawMessage `json:"after,omitempty"`
+	ClientIP     string          `json:"client_ip,omitempty"` // the caller's address, when known
+}
+
+// recordAudit writes an audit entry inside the transaction performing the
+// change, with the address of the caller behind ctx's request
+func recordAudit(ctx context.Context, tx pgx.Tx, assignmentID int, action, actor string,
+	before, after *Assignment) error {
+	publicID := snapshotPublicID(before, after)
+	beforeJSON, err := auditSnapshot(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := auditSnapshot(after)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO assignment_audit (assignment_id, assignment_public_id, action, actor, before, after, client_ip)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, '')::inet)
+	`
+	_, err = tx.Exec(ctx, query, assignmentID, publicID, action, actor, beforeJSON, afterJSON,
+		clientIPFromContext(ctx))
+	return err
+}
+
+// snapshotPublicID returns the public ID of whichever snapshot is present
+func snapshotPublicID(before, after *Assignment) string {
+	if after != nil {
+		return after.PublicID
+	}
+	return before.PublicID
+}
+
+// auditSnapshot encodes an assignment for a JSONB column, using NULL for nil
+func auditSnapshot(assignment *Assignment) (any, error) {
+	if assignment == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(assignment)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// auditRevision decodes an audit snapshot of the assignment with the given
+// internal ID, which snapshots leave out
+func auditRevision(id int, snapshot []byte) (Assignment, error) {
+	var assignment Assignment
+	if err := json.Unmarshal(snapshot, &assignment); err != nil {
+		return Assignment{}, fmt.Errorf("assignment %d audit snapshot: %w", id, err)
+	}
+	assignment.ID = id
+	return assignment, nil
+}
+
+// auditColumns are the columns scanned by queryAuditEntries
+const auditColumns = `id, assignment_id, assignment_public_id, action, actor, changed_at, before, after,
+	COALESCE(host(client_ip), '')`
+
+// auditHistory retrieves the audit trail for an assignment visible with the
+// clearance, oldest first
+func auditHistory(ctx context.Context, q querier, publicID string, clearance *Clearance) ([]AuditEntry, error) {
+	query := `
+		SELECT ` + auditColumns + `
+		FROM assignment_audit
+		WHERE assignment_public_id = $1 AND ` + auditClearanceCondition(2) + `
+		ORDER BY changed_at, id
+	`
+	return queryAuditEntries(ctx, q, query, append([]any{publicID}, clearance.sqlArgs()...)...)
+}
+
+// queryAuditEntries runs a query selecting full audit rows and collects them
+func queryAuditEntries(ctx context.Context, q querier, query string, args ...any) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry AuditEntry
+		var before, after []byte
+		if err := rows.Scan(&entry.ID, &entry.AssignmentID, &entry.PublicID, &entry.Action, &entry.Actor,
+			&entry.ChangedAt, &before, &after, &entry.ClientIP); err != nil {
+			return nil, err
+		}
+		entry.Before = before
+		entry.After = after
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// actorFromContext identifies the caller for audit purposes
+func actorFromContext(c *gin.Context) string {
+	if principal := currentPrincipal(c); principal != nil && principal.Subject != "" {
+		return principal.Subject
+	}
+	return "unknown"
+}
+
+func (h *AssignmentHandler) handleGetAssignmentHistory(c *gin.Context) {
+	h = h.forRequest(c)
+	// Deleted assignments keep their history, so this doesn't look the assignment up
+	publicID, valid := normalizeULID(c.Param("id"))
+	if !valid {
+		respondError(c, http.StatusBadRequest, "Invalid assignment ID")
+		return
+	}
+
+	entries, err := h.repo.History(publicID, callerClearance(c))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve assignment history")
+		return
+	}
+	if len(entries) == 0 {
+		respondError(c, http.StatusNotFound, "No history found for assignment")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"assignment_id": publicID,
+		"history":       entries,
+		"count":         len(entries),
+	})
+}
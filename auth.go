@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Roles recognised in the token's role claim, from least to most privileged
+const (
+	RoleReporting  = "reporting" // BI tools: analytics, exports and roster reads only
+	RoleViewer     = "viewer"
+	RoleDispatcher = "dispatcher"
+	RoleAdmin      = "admin"
+)
+
+var roleRank = map[string]int{
+	RoleReporting:  1,
+	RoleViewer:     2,
+	RoleDispatcher: 3,
+	RoleAdmin:      4,
+}
+
+// ScopePIIRead lets a token see staff names and contact details unmasked
+const ScopePIIRead = "pii:read"
+
+// roleScopes are granted with a role on top of any in the token. Dispatchers
+// and admins roster people by name, so they always see it.
+var roleScopes = map[string][]string{
+	RoleDispatcher: {ScopePIIRead},
+	RoleAdmin:      {ScopePIIRead},
+}
+
+// Claims are the JWT claims this service relies on
+type Claims struct {
+	Role       string   `json:"role"`
+	Scope      string   `json:"scope,omitempty"`      // space-separated, e.g. "pii:read"
+	StaffID    int      `json:"staff_id,omitempty"`   // set when the caller is a staff member
+	Clearances []string `json:"clearances,omitempty"` // clearance labels held, e.g. ["vip-charter"]
+	DepotID    string   `json:"depot_id,omitempty"`   // the depot the caller works at, e.g. "north"
+	jwt.RegisteredClaims
+}
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Subject    string   `json:"subject"`
+	Role       string   `json:"role"`
+	Scopes     []string `json:"scopes,omitempty"`
+	StaffID    int      `json:"staff_id,omitempty"`
+	Clearances []string `json:"clearances,omitempty"`
+	DepotID    string   `json:"depot_id,omitempty"` // the depot the caller is working in; "" for every depot
+}
+
+// HasScope reports whether the caller's token or role grants the scope
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(roleScopes[p.Role], scope)
+}
+
+const principalKey = "principal"
+
+// AuthConfig controls how bearer tokens are verified
+type AuthConfig struct {
+	Secret   []byte
+	Disabled bool
+}
+
+// LoadAuthConfig reads JWT_SECRET and AUTH_DISABLED from the environment.
+// Authorization can only be turned off explicitly, for local development.
+func LoadAuthConfig() AuthConfig {
+	cfg := AuthConfig{
+		Secret:   []byte(os.Getenv("JWT_SECRET")),
+		Disabled: os.Getenv("AUTH_DISABLED") == "true",
+	}
+	if cfg.Disabled {
+		log.Println("WARNING: AUTH_DISABLED=true, all requests are treated as admin")
+	} else if len(cfg.Secret) == 0 {
+		log.Fatal("JWT_SECRET environment variable is required (or set AUTH_DISABLED=true for local development)")
+	}
+	return cfg
+}
+
+// authenticate verifies the bearer token and stores the caller's principal
+func authenticate(cfg AuthConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.Disabled {
+			c.Set(principalKey, &Principal{Subject: "anonymous", Role: RoleAdmin})
+			c.Next()
+			return
+		}
+
+		header := c.GetHeader("Authorization")
+		tokenString, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || tokenString == "" {
+			abortWithError(c, http.StatusUnauthorized, "Missing bearer token")
+			return
+		}
+
+		claims, err := parseToken(cfg.Secret, tokenString)
+		if err != nil {
+			abortWithError(c, http.StatusUnauthorized, "Invalid token")
+			return
+		}
+		if _, known := roleRank[claims.Role]; !known {
+			abortWithError(c, http.StatusForbidden, "Unknown role in token")
+			return
+		}
+
+		c.Set(principalKey, &Principal{Subject: claims.Subject, Role: claims.Role, Scopes: strings.Fields(claims.Scope),
+			StaffID: claims.StaffID, Clearances: claims.Clearances, DepotID: claims.DepotID})
+		c.Next()
+	}
+}
+
+func parseToken(secret []byte, tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (any, error) {
+		return secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("token is not valid")
+	}
+	return claims, nil
+}
+
+// requireRole rejects callers whose role ranks below the given minimum
+func requireRole(minimum string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := currentPrincipal(c)
+		if principal == nil || roleRank[principal.Role] < roleRank[minimum] {
+			abortWithError(c, http.StatusForbidden, "Insufficient permissions")
+			return
+		}
+		c.Next()
+	}
+}
+
+// currentPrincipal returns the authenticated caller, or nil outside authenticated routes
+func currentPrincipal(c *gin.Context) *Principal {
+	if value, exists := c.Get(principalKey); exists {
+		if principal, ok := value.(*Principal); ok {
+			return principal
+		}
+	}
+	return nil
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Availability types
+const (
+	AvailabilityLeave = "leave"
+	AvailabilitySick  = "sick"
+	AvailabilityRest  = "rest"
+)
+
+// AvailabilityPeriod is a run of days on which a staff member cannot work
+type AvailabilityPeriod struct {
+	ID        int       `json:"id"`
+	StaffID   int       `json:"staff_id"`
+	Type      string    `json:"type"` // leave, sick, rest
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"` // inclusive
+	Note      string    `json:"note,omitempty"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Affects reports whether the assignment is worked on any day of the period
+func (p *AvailabilityPeriod) Affects(assignment *Assignment) bool {
+	period := Assignment{StartDate: p.StartDate, EndDate: &p.EndDate}
+	return period.SharesWorkingDay(assignment)
+}
+
+// AvailabilityFilter narrows availability listings; zero values match everything
+type AvailabilityFilter struct {
+	StaffID int
+	Type    string
+	From    *time.Time // periods ending on or after this date
+	To      *time.Time // periods starting on or before this date
+}
+
+// Matches reports whether a period passes the filter
+func (f AvailabilityFilter) Matches(period *AvailabilityPeriod) bool {
+	return (f.StaffID == 0 || period.StaffID == f.StaffID) &&
+		(f.Type == "" || period.Type == f.Type) &&
+		(f.From == nil || !period.EndDate.Before(*f.From)) &&
+		(f.To == nil || !period.StartDate.After(*f.To))
+}
+
+// AvailabilityRepository stores availability periods
+type AvailabilityRepository interface {
+	Create(period *AvailabilityPeriod) error
+	Get(id int) (*AvailabilityPeriod, error) // nil, nil when not found
+	Update(period *AvailabilityPeriod) error
+	Delete(id int) (bool, error)
+	List(filter AvailabilityFilter) ([]AvailabilityPeriod, error) // ordered by start date
+	WithContext(ctx context.Context) AvailabilityRepository       // see AssignmentRepository.WithContext
+}
+
+// unavailableFor returns the periods during which the assignment's staff
+// member is unavailable on a day the assignment is worked
+func unavailableFor(repo AvailabilityRepository, assignment *Assignment) ([]AvailabilityPeriod, error) {
+	from := assignment.StartDate
+	periods, err := repo.List(AvailabilityFilter{StaffID: assignment.StaffID, From: &from, To: assignment.EndDate})
+	if err != nil {
+		return nil, err
+	}
+
+	var affected []AvailabilityPeriod
+	for _, period := range periods {
+		if period.Affects(assignment) {
+			affected = append(affected, period)
+		}
+	}
+	return affected, nil
+}
+
+// unavailableMessage says when the staff member is away, naming the first of
+// the periods unavailableFor returned
+func unavailableMessage(staffID int, unavailable []AvailabilityPeriod) string {
+	period := unavailable[0]
+	return fmt.Sprintf("Staff member %d is on %s from %s to %s", staffID, period.Type,
+		period.StartDate.Format("2006-01-02"), period.EndDate.Format("2006-01-02"))
+}
+
+// UnavailableError refuses a staff member work on days they are unavailable
+type UnavailableError struct {
+	StaffID     int
+	Unavailable []AvailabilityPeriod
+}
+
+func (e *UnavailableError) Error() string {
+	return unavailableMessage(e.StaffID, e.Unavailable)
+}
+
+func validAvailabilityType(kind string) bool {
+	return kind == AvailabilityLeave || kind == AvailabilitySick || kind == AvailabilityRest
+}
+
+// AvailabilityRequest records or replaces an availability period
+type AvailabilityRequest struct {
+	StaffID   int    `json:"staff_id" binding:"required"`
+	Type      string `json:"type" binding:"required"`
+	StartDate string `json:"start_date" binding:"required"` // YYYY-MM-DD format
+	EndDate   string `json:"end_date" binding:"required"`   // YYYY-MM-DD format, inclusive
+	Note      string `json:"note,omitempty"`
+}
+
+// apply validates the request and copies it onto the given period. It
+// returns the field at fault, or nil when the request is valid.
+func (req AvailabilityRequest) apply(period *AvailabilityPeriod) *FieldError {
+	if !validAvailabilityType(req.Type) {
+		return &FieldError{Field: "type", Message: "Type must be 'leave', 'sick' or 'rest'"}
+	}
+	startDate, err := time.Parse("2006-01-02", req.StartDate)
+	if err != nil {
+		return &FieldError{Field: "start_date", Message: "Invalid start_date format. Use YYYY-MM-DD"}
+	}
+	endDate, err := time.Parse("2006-01-02", req.EndDate)
+	if err != nil {
+		return &FieldError{Field: "end_date", Message: "Invalid end_date format. Use YYYY-MM-DD"}
+	}
+	if endDate.Before(startDate) {
+		return &FieldError{Field: "end_date", Message: "end_date must not be before start_date"}
+	}
+
+	period.StaffID = req.StaffID
+	period.Type = req.Type
+	period.StartDate = startDate
+	period.EndDate = endDate
+	period.Note = req.Note
+	return nil
+}
+
+// AvailabilityHandler serves the staff availability endpoints
+type AvailabilityHandler struct {
+	repo        AvailabilityRepository
+	assignments AssignmentRepository
+}
+
+// NewAvailabilityHandler creates a handler storing periods in the given
+// repository and checking them against the given assignments
+func NewAvailabilityHandler(repo AvailabilityRepository, assignments AssignmentRepository) *AvailabilityHandler {
+	return &AvailabilityHandler{repo: repo, assignments: assignments}
+}
+
+// forRequest returns the handler with its repositories bound to the request's context
+func (h *AvailabilityHandler) forRequest(c *gin.Context) *AvailabilityHandler {
+	ctx := c.Request.Context()
+	return &AvailabilityHandler{repo: h.repo.WithContext(ctx), assignments: h.assignments.WithContext(ctx)}
+}
+
+// affectedAssignments lists the staff member's active assignments worked
+// during the period and visible with the clearance, so recording leave warns
+// about shifts that need cover
+func (h *AvailabilityHandler) affectedAssignments(period *AvailabilityPeriod, clearance *Clearance) ([]AssignmentWithDetails, error) {
+	assignments, err := h.assignments.ListByStaff(period.StaffID, clearance)
+	if err != nil {
+		return nil, err
+	}
+
+	var affected []Assignment
+	for _, assignment := range assignments {
+		if assignment.Status == "active" && period.Affects(&assignment) {
+			affected = append(affected, assignment)
+		}
+	}
+	return withDetails(affected), nil
+}
+
+// periodFromParam loads the period named by the :id path parameter. It
+// returns nil once an error response has been written.
+func (h *AvailabilityHandler) periodFromParam(c *gin.Context) *AvailabilityPeriod {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid availability ID")
+		return nil
+	}
+
+	period, err := h.repo.Get(id)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Database error")
+		return nil
+	}
+	if period == nil {
+		respondError(c, http.StatusNotFound, "Availability period not found")
+		return nil
+	}
+	return period
+}
+
+func (h *AvailabilityHandler) handleGetAvailability(c *gin.Context) {
+	h = h.forRequest(c)
+	filter := AvailabilityFilter{Type: c.Query("type")}
+	if filter.Type != "" && !validAvailabilityType(filter.Type) {
+		respondInvalidField(c, "type", "Type must be 'leave', 'sick' or 'rest'")
+		return
+	}
+
+	if staffIDStr := c.Query("staff_id"); staffIDStr != "" {
+		staffID, err := strconv.Atoi(staffIDStr)
+		if err != nil {
+			respondInvalidField(c, "staff_id", "Invalid staff ID")
+			return
+		}
+		filter.StaffID = staffID
+	}
+	if fromStr := c.Query("from"); fromStr != "" {
+		from, err := time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			respondInvalidField(c, "from", "Invalid from date. Use YYYY-MM-DD")
+			return
+		}
+		filter.From = &from
+	}
+	if toStr := c.Query("to"); toStr != "" {
+		to, err := time.Parse("2006-01-02", toStr)
+		if err != nil {
+			respondInvalidField(c, "to", "Invalid to date. Use YYYY-MM-DD")
+			return
+		}
+		filter.To = &to
+	}
+
+	periods, err := h.repo.List(filter)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve availability")
+		return
+	}
+	if periods == nil {
+		periods = []AvailabilityPeriod{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"availability": periods, "count": len(periods)})
+}
+
+func (h *AvailabilityHandler) handleGetAvailabilityPeriod(c *gin.Context) {
+	h = h.forRequest(c)
+	if period := h.periodFromParam(c); period != nil {
+		c.JSON(http.StatusOK, period)
+	}
+}
+
+func (h *AvailabilityHandler) handleCreateAvailability(c *gin.Context) {
+	h = h.forRequest(c)
+	var req AvailabilityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, &req, err)
+		return
+	}
+
+	period := AvailabilityPeriod{CreatedBy: actorFromContext(c)}
+	if fieldErr := req.apply(&period); fieldErr != nil {
+		respondInvalid(c, *fieldErr)
+		return
+	}
+
+	if err := h.repo.Create(&period); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to create availability period")
+		return
+	}
+
+	h.respondWithAffected(c, http.StatusCreated, &period)
+}
+
+func (h *AvailabilityHandler) handleUpdateAvailability(c *gin.Context) {
+	h = h.forRequest(c)
+	period := h.periodFromParam(c)
+	if period == nil {
+		return
+	}
+
+	var req AvailabilityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, &req, err)
+		return
+	}
+	if fieldErr := req.apply(period); fieldErr != nil {
+		respondInvalid(c, *fieldErr)
+		return
+	}
+
+	if err := h.repo.Update(period); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to update availability period")
+		return
+	}
+
+	h.respondWithAffected(c, http.StatusOK, period)
+}
+
+// respondWithAffected writes a saved period together with the assignments it
+// leaves without their staff member
+func (h *AvailabilityHandler) respondWithAffected(c *gin.Context, status int, period *AvailabilityPeriod) {
+	affected, err := h.affectedAssignments(period, callerClearance(c))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve affected assignments")
+		return
+	}
+
+	c.JSON(status, gin.H{"availability": period, "affected_assignments": affected})
+}
+
+func (h *AvailabilityHandler) handleDeleteAvailability(c *gin.Context) {
+	h = h.forRequest(c)
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid availability ID")
+		return
+	}
+
+	deleted, err := h.repo.Delete(id)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to delete availability period")
+		return
+	}
+	if !deleted {
+		respondError(c, http.StatusNotFound, "Availability period not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Availability period deleted successfully"})
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAvailabilityLifecycle(t *testing.T) {
+	router, repo := newTestRouter(t)
+	affected := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+	mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-01-01")})
+
+	rec := doRequest(router, http.MethodPost, "/api/availability", gin.H{
+		"staff_id": 1, "type": "leave", "start_date": "2025-02-03", "end_date": "2025-02-07", "note": "Annual leave",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	created := decode[struct {
+		Availability        AvailabilityPeriod
+		AffectedAssignments []AssignmentWithDetails `json:"affected_assignments"`
+	}](t, rec)
+	if len(created.AffectedAssignments) != 1 || created.AffectedAssignments[0].PublicID != affected.PublicID {
+		t.Errorf("affected assignments = %+v, want assignment %s", created.AffectedAssignments, affected.PublicID)
+	}
+	path := fmt.Sprintf("/api/availability/%d", created.Availability.ID)
+
+	rec = doRequest(router, http.MethodGet, "/api/availability?staff_id=1&from=2025-02-07", nil)
+	if body := decode[struct{ Count int }](t, rec); body.Count != 1 {
+		t.Errorf("listed %d periods, want 1", body.Count)
+	}
+	rec = doRequest(router, http.MethodGet, "/api/availability?from=2025-02-08", nil)
+	if body := decode[struct{ Count int }](t, rec); body.Count != 0 {
+		t.Errorf("listed %d periods after the leave, want 0", body.Count)
+	}
+
+	rec = doRequest(router, http.MethodPut, path, gin.H{
+		"staff_id": 1, "type": "sick", "start_date": "2025-02-03", "end_date": "2025-02-04",
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if got := decode[struct{ Availability AvailabilityPeriod }](t, rec).Availability; got.Type != AvailabilitySick {
+		t.Errorf("type = %q, want %q", got.Type, AvailabilitySick)
+	}
+
+	if rec := doRequest(router, http.MethodDelete, path, nil); rec.Code != http.StatusOK {
+		t.Fatalf("delete status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := doRequest(router, http.MethodGet, path, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("get after delete status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestAvailabilityValidation(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	tests := []struct {
+		name string
+		body gin.H
+	}{
+		{"missing end date", gin.H{"staff_id": 1, "type": "leave", "start_date": "2025-02-03"}},
+		{"unknown type", gin.H{"staff_id": 1, "type": "holiday", "start_date": "2025-02-03", "end_date": "2025-02-07"}},
+		{"end before start", gin.H{"staff_id": 1, "type": "leave", "start_date": "2025-02-07", "end_date": "2025-02-03"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(router, http.MethodPost, "/api/availability", tt.body)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestCreateAssignmentWhileUnavailable(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	// Tuesday 4th to Thursday 6th
+	rec := doRequest(router, http.MethodPost, "/api/availability", gin.H{
+		"staff_id": 1, "type": "leave", "start_date": "2025-02-04", "end_date": "2025-02-06",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create availability status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	tests := []struct {
+		name     string
+		body     gin.H
+		wantCode int
+	}{
+		{"during leave", gin.H{"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": "2025-02-01"}, http.StatusConflict},
+		{"before leave", gin.H{"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": "2025-01-01", "end_date": "2025-02-03"}, http.StatusCreated},
+		{"working days outside leave", gin.H{"bus_id": 2, "staff_id": 1, "role": "driver", "start_date": "2025-02-04",
+			"working_days": []string{"mon", "fri"}}, http.StatusCreated},
+		{"other staff", gin.H{"bus_id": 3, "staff_id": 3, "role": "driver", "start_date": "2025-02-01"}, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(router, http.MethodPost, "/api/assignments", tt.body)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			if tt.wantCode == http.StatusConflict {
+				body := decode[struct{ Unavailable []AvailabilityPeriod }](t, rec)
+				if len(body.Unavailable) != 1 || body.Unavailable[0].Type != AvailabilityLeave {
+					t.Errorf("unavailable = %+v, want the leave period", body.Unavailable)
+				}
+			}
+		})
+	}
+}
+
+func TestAvailabilityPeriodAffects(t *testing.T) {
+	period := AvailabilityPeriod{StartDate: date("2025-02-04"), EndDate: date("2025-02-04")} // a Tuesday
+	end := date("2025-02-03")
+
+	tests := []struct {
+		name       string
+		assignment Assignment
+		want       bool
+	}{
+		{"open ended", Assignment{StartDate: date("2025-01-01")}, true},
+		{"ends the day before", Assignment{StartDate: date("2025-01-01"), EndDate: &end}, false},
+		{"works tuesdays", Assignment{StartDate: date("2025-01-01"), WorkingDays: DayMask(1 << time.Tuesday)}, true},
+		{"never works tuesdays", Assignment{StartDate: date("2025-01-01"), WorkingDays: DayMask(1<<time.Monday | 1<<time.Wednesday)}, false},
+	}
+
+	for _, tt := range tests {
+		if got := period.Affects(&tt.assignment); got != tt.want {
+			t.Errorf("%s: Affects = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"sort"
+	"time"
+)
+
+// shiftAwardActor is recorded in the audit trail for assignments created by awarding
+const shiftAwardActor = "shift-bidding"
+
+// fairnessWindow is how far back the fairness policy counts previous awards
+const fairnessWindow = 90 * 24 * time.Hour
+
+// ShiftAwarder closes bidding on shifts whose window has passed and awards
+// each to the best-ranked eligible bidder per the shift's policy
+type ShiftAwarder struct {
+	shifts         ShiftRepository
+	availability   AvailabilityRepository
+	qualifications QualificationRepository
+	interval       time.Duration
+}
+
+// NewShiftAwarder creates an awarder of the repository's shifts checking
+// every SHIFT_AWARD_INTERVAL (default 30s), passing over bidders who are
+// unavailable during the shift or not qualified for it
+func NewShiftAwarder(shifts ShiftRepository, availability AvailabilityRepository,
+	qualifications QualificationRepository) *ShiftAwarder {
+	interval := 30 * time.Second
+	if value := os.Getenv("SHIFT_AWARD_INTERVAL"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			interval = parsed
+		} else {
+			log.Printf("Invalid SHIFT_AWARD_INTERVAL %q, using %s", value, interval)
+		}
+	}
+	return &ShiftAwarder{shifts: shifts, availability: availability, qualifications: qualifications,
+		interval: interval}
+}
+
+// Run awards due shifts until the context is cancelled
+func (a *ShiftAwarder) Run(ctx context.Context) {
+	monitor := backgroundWorkers.Register("shift_awarder", tickerStallAfter(a.interval),
+		countDueQueue(`SELECT count(*) FROM open_shifts WHERE status = 'open' AND bidding_closes_at <= $1`))
+	defer backgroundWorkers.Unregister("shift_awarder")
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := a.awardDueShifts(ctx)
+			monitor.Record(err)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Shift award error: %v", err)
+			}
+		}
+	}
+}
+
+// awardDueShifts awards each shift whose bidding has closed on its own, so
+// one failing shift doesn't hold up the rest
+func (a *ShiftAwarder) awardDueShifts(ctx context.Context) error {
+	shifts := a.shifts.WithContext(ctx)
+	ids, err := shifts.DueForAward(clock.Now())
+	if err != nil {
+		return err
+	}
+
+	check := shiftRules(ctx, a.availability.WithContext(ctx), a.qualifications.WithContext(ctx), shiftAwardActor)
+	for _, id := range ids {
+		if _, err := shifts.Award(id, check); err != nil {
+			log.Printf("Failed to award shift %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// pendingBids keeps the bids still in the running
+func pendingBids(bids []ShiftBid) []ShiftBid {
+	var pending []ShiftBid
+	for _, bid := range bids {
+		if bid.Status == "pending" {
+			pending = append(pending, bid)
+		}
+	}
+	return pending
+}
+
+// awardToBidder awards the shift to the first of the ranked bidders who is
+// still eligible, free and passes the check, or marks it unfilled when nobody
+// is
+func awardToBidder(tx assignmentTx, shift *OpenShift, ranked []ShiftBid, check takeUpCheck) (*Assignment, error) {
+	for _, bid := range ranked {
+		if !staffEligibleForRole(bid.StaffID, shift.Role) {
+			continue
+		}
+
+		candidate := shift.assignment(bid.StaffID)
+		if err := checkTakeUp(tx, &candidate, check); refusedTakeUp(err) {
+			log.Printf("Passed over staff %d for shift %d: %v", bid.StaffID, shift.ID, err)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		assignment, err := awardShiftTo(tx, shift, bid.StaffID, shiftAwardActor)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Awarded shift %d to staff %d (%s policy), assignment %d",
+			shift.ID, bid.StaffID, shift.AwardPolicy, assignment.ID)
+		return assignment, nil
+	}
+
+	log.Printf("Shift %d closed with no eligible bidder", shift.ID)
+	shift.Status = "unfilled"
+	return nil, nil
+}
+
+// rankBids orders bids best first under the given policy, given how many
+// shifts each bidder was awarded within the fairness window. Ties keep bid
+// order, so earlier bidders win among otherwise equal staff.
+func rankBids(policy string, bids []ShiftBid, recentAwards map[int]int) []ShiftBid {
+	ranked := append([]ShiftBid(nil), bids...)
+
+	switch policy {
+	case AwardPolicyFairness:
+		sort.SliceStable(ranked, func(i, j int) bool {
+			return recentAwards[ranked[i].StaffID] < recentAwards[ranked[j].StaffID]
+		})
+
+	default: // seniority
+		// Staff without a known hire date rank after everyone who has one
+		hireDate := func(staffID int) string {
+			if staff, exists := mockStaff[staffID]; exists && staff["hire_date"] != "" {
+				return staff["hire_date"]
+			}
+			return "9999-12-31"
+		}
+		sort.SliceStable(ranked, func(i, j int) bool {
+			return hireDate(ranked[i].StaffID) < hireDate(ranked[j].StaffID)
+		})
+	}
+
+	return ranked
+}
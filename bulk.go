@@ -0,0 +1,182 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bulkConfirmThreshold is the most assignments a bulk operation may change
+// before it must be confirmed; main reads it from BULK_CONFIRM_THRESHOLD, and
+// 0 turns the guardrail off
+var bulkConfirmThreshold = 50
+
+// LoadBulkConfirmThreshold reads BULK_CONFIRM_THRESHOLD, defaulting to 50
+func LoadBulkConfirmThreshold() int {
+	threshold := 50
+	if value := os.Getenv("BULK_CONFIRM_THRESHOLD"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed >= 0 {
+			threshold = parsed
+		} else {
+			log.Printf("Invalid BULK_CONFIRM_THRESHOLD %q, using %d", value, threshold)
+		}
+	}
+	return threshold
+}
+
+// BulkImpact summarises the assignments a bulk operation would change. The
+// token identifies exactly those assignments at their current versions, so a
+// confirmation can't be replayed once the impact has changed.
+type BulkImpact struct {
+	Operation   string `json:"operation"`
+	Assignments int    `json:"assignments"` // assignments changed
+	Cancelled   int    `json:"cancelled"`   // of which cancelled or deleted
+	Buses       []int  `json:"buses"`
+	Staff       []int  `json:"staff"`
+	From        string `json:"from"`         // earliest start, YYYY-MM-DD
+	To          string `json:"to,omitempty"` // latest end; omitted when any is open-ended
+	Token       string `json:"impact_token"`
+}
+
+// newBulkImpact summarises the assignments an operation changes, counting
+// those it cancels or deletes separately
+func newBulkImpact(operation string, changed, cancelled []Assignment) *BulkImpact {
+	impact := &BulkImpact{Operation: operation, Buses: []int{}, Staff: []int{}}
+	buses, staff := map[int]bool{}, map[int]bool{}
+	var from, to time.Time
+	openEnded := false
+	keys := make([]string, 0, len(changed)+len(cancelled))
+
+	add := func(assignment *Assignment, key string) {
+		keys = append(keys, key)
+		if !buses[assignment.BusID] {
+			buses[assignment.BusID] = true
+			impact.Buses = append(impact.Buses, assignment.BusID)
+		}
+		if !staff[assignment.StaffID] {
+			staff[assignment.StaffID] = true
+			impact.Staff = append(impact.Staff, assignment.StaffID)
+		}
+		if from.IsZero() || assignment.StartDate.Before(from) {
+			from = assignment.StartDate
+		}
+		if assignment.EndDate == nil {
+			openEnded = true
+		} else if assignment.EndDate.After(to) {
+			to = *assignment.EndDate
+		}
+	}
+	for i := range changed {
+		add(&changed[i], assignmentKey(&changed[i]))
+	}
+	for i := range cancelled {
+		add(&cancelled[i], "cancel "+assignmentKey(&cancelled[i]))
+	}
+
+	impact.Assignments = len(changed) + len(cancelled)
+	impact.Cancelled = len(cancelled)
+	sort.Ints(impact.Buses)
+	sort.Ints(impact.Staff)
+	if !from.IsZero() {
+		impact.From = from.Format("2006-01-02")
+	}
+	if !openEnded && !to.IsZero() {
+		impact.To = to.Format("2006-01-02")
+	}
+
+	sort.Strings(keys)
+	hash := sha256.New()
+	fmt.Fprintln(hash, operation)
+	for _, key := range keys {
+		fmt.Fprintln(hash, key)
+	}
+	impact.Token = hex.EncodeToString(hash.Sum(nil)[:16])
+	return impact
+}
+
+// assignmentKey identifies an assignment and the version being changed. New
+// assignments, which have no ID yet, are identified by their fields.
+func assignmentKey(a *Assignment) string {
+	end := ""
+	if a.EndDate != nil {
+		end = a.EndDate.Format("2006-01-02")
+	}
+	return fmt.Sprintf("%s@%d %d/%d/%s %s-%s %s", a.PublicID, a.Version, a.BusID, a.StaffID, a.Role,
+		a.StartDate.Format("2006-01-02"), end, a.Status)
+}
+
+// BulkConfirmationError refuses a bulk operation over the threshold until the
+// caller confirms its impact
+type BulkConfirmationError struct {
+	Impact BulkImpact
+	Stale  bool // confirmed, but for a different impact
+}
+
+func (e *BulkConfirmationError) Error() string {
+	return fmt.Sprintf("%s would change %d assignments and needs confirmation", e.Impact.Operation, e.Impact.Assignments)
+}
+
+// bulkGuard carries a request's confirmation of a bulk operation from the
+// confirm and impact_token query parameters
+type bulkGuard struct {
+	actor     string
+	confirmed bool
+	token     string
+	impact    *BulkImpact // set once a confirmed operation over the threshold passes
+}
+
+func newBulkGuard(c *gin.Context) *bulkGuard {
+	return &bulkGuard{actor: actorFromContext(c), confirmed: c.Query("confirm") == "true", token: c.Query("impact_token")}
+}
+
+// check returns a BulkConfirmationError when the impact is over the threshold
+// and the caller hasn't confirmed this exact impact
+func (g *bulkGuard) check(impact *BulkImpact) error {
+	if bulkConfirmThreshold == 0 || impact.Assignments <= bulkConfirmThreshold {
+		return nil
+	}
+	if !g.confirmed || g.token != impact.Token {
+		return &BulkConfirmationError{Impact: *impact, Stale: g.confirmed}
+	}
+	g.impact = impact
+	return nil
+}
+
+// report logs a confirmed bulk operation once it has been carried out, so
+// large changes can be alerted on
+func (g *bulkGuard) report() {
+	if g.impact == nil {
+		return
+	}
+	log.Printf("Bulk %s by %s changed %d assignments (%d cancelled) on buses %v for staff %v from %s",
+		g.impact.Operation, g.actor, g.impact.Assignments, g.impact.Cancelled, g.impact.Buses, g.impact.Staff,
+		g.impact.From)
+}
+
+// respondBulkConfirmation writes a 428 with the impact summary when err is a
+// BulkConfirmationError. It returns true if err was something else, so the
+// caller still has to respond.
+func respondBulkConfirmation(c *gin.Context, err error) bool {
+	var confirmation *BulkConfirmationError
+	if !errors.As(err, &confirmation) {
+		return true
+	}
+	message := fmt.Sprintf("This changes %d assignments; repeat the request with confirm=true and the impact_token to go ahead",
+		confirmation.Impact.Assignments)
+	if confirmation.Stale {
+		message = "The impact has changed since it was summarised; review it and confirm again"
+	}
+	log.Printf("Bulk %s by %s held for confirmation: %d assignments", confirmation.Impact.Operation,
+		actorFromContext(c), confirmation.Impact.Assignments)
+	c.JSON(http.StatusPreconditionRequired, gin.H{"error": newAPIError(http.StatusPreconditionRequired, message), "impact": confirmation.Impact})
+	return false
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBulkGuardRequiresConfirmedImpact(t *testing.T) {
+	previous := bulkConfirmThreshold
+	bulkConfirmThreshold = 1
+	t.Cleanup(func() { bulkConfirmThreshold = previous })
+
+	end := date("2025-03-31")
+	affected := []Assignment{
+		{PublicID: "A", Version: 1, BusID: 2, StaffID: 1, Role: "driver", StartDate: date("2025-03-01"), EndDate: &end},
+		{PublicID: "B", Version: 3, BusID: 1, StaffID: 2, Role: "conductor", StartDate: date("2025-02-01"), EndDate: &end},
+	}
+	impact := newBulkImpact("transfer_staff", affected[:1], affected[1:])
+	if impact.Assignments != 2 || impact.Cancelled != 1 || impact.From != "2025-02-01" || impact.To != "2025-03-31" ||
+		len(impact.Buses) != 2 || impact.Buses[0] != 1 {
+		t.Errorf("impact = %+v, want both assignments summarised", impact)
+	}
+
+	var confirmation *BulkConfirmationError
+	if err := (&bulkGuard{}).check(impact); !errors.As(err, &confirmation) || confirmation.Stale {
+		t.Errorf("unconfirmed check = %v, want a confirmation request", err)
+	}
+	if err := (&bulkGuard{confirmed: true, token: "stale"}).check(impact); !errors.As(err, &confirmation) || !confirmation.Stale {
+		t.Errorf("check with another impact's token = %v, want a stale confirmation", err)
+	}
+	guard := &bulkGuard{confirmed: true, token: impact.Token}
+	if err := guard.check(impact); err != nil || guard.impact == nil {
+		t.Errorf("confirmed check = %v, want it allowed and recorded for reporting", err)
+	}
+
+	// The token follows the assignments' versions, so a changed impact must be confirmed again
+	affected[0].Version = 2
+	if changed := newBulkImpact("transfer_staff", affected[:1], affected[1:]); changed.Token == impact.Token {
+		t.Error("token unchanged after an affected assignment changed")
+	}
+	if err := (&bulkGuard{}).check(newBulkImpact("transfer_staff", affected[:1], nil)); err != nil {
+		t.Errorf("check at the threshold = %v, want it allowed", err)
+	}
+}
+
+func TestScenarioApplyOverThresholdNeedsConfirmation(t *testing.T) {
+	previous := bulkConfirmThreshold
+	bulkConfirmThreshold = 1
+	t.Cleanup(func() { bulkConfirmThreshold = previous })
+
+	router, repo := newTestRouter(t)
+	scenario := createScenario(t, router, "2025-03-03", "2025-03-09")
+	path := "/api/scenarios/" + scenario.ID
+	edits := gin.H{"edits": []gin.H{
+		{"op": "add", "assignment": gin.H{"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": "2025-03-03"}},
+		{"op": "add", "assignment": gin.H{"bus_id": 1, "staff_id": 2, "role": "conductor", "start_date": "2025-03-03"}},
+	}}
+	if rec := doRequest(router, http.MethodPost, path+"/edits", edits); rec.Code != http.StatusOK {
+		t.Fatalf("edit status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	rec := doRequest(router, http.MethodPost, path+"/apply", nil)
+	if rec.Code != http.StatusPreconditionRequired {
+		t.Fatalf("unconfirmed apply status = %d, want %d: %s", rec.Code, http.StatusPreconditionRequired, rec.Body.String())
+	}
+	impact := decode[struct{ Impact BulkImpact }](t, rec).Impact
+	if impact.Assignments != 2 || impact.Token == "" {
+		t.Errorf("impact = %+v, want the 2 added assignments", impact)
+	}
+	if live, _ := repo.List(AssignmentFilter{}); len(live) != 0 {
+		t.Errorf("live assignments = %d, want nothing applied before confirmation", len(live))
+	}
+
+	if rec := doRequest(router, http.MethodPost, path+"/apply?confirm=true&impact_token=wrong", nil); rec.Code != http.StatusPreconditionRequired {
+		t.Errorf("apply with a wrong token status = %d, want %d", rec.Code, http.StatusPreconditionRequired)
+	}
+	rec = doRequest(router, http.MethodPost, path+"/apply?confirm=true&impact_token="+impact.Token, nil)
+	if rec.Code != http.StatusOK {
+		t.Errorf("confirmed apply status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Service levels a depot runs on a day
+const (
+	ServiceFull    = "full"    // buses run all day
+	ServiceReduced = "reduced" // buses only run between from and to, e.g. no night service
+	ServiceNone    = "none"    // the depot runs no service
+)
+
+// ServiceDay is the service a depot runs on one day
+type ServiceDay struct {
+	Level string     `json:"level"`
+	From  *TimeOfDay `json:"from,omitempty"` // reduced service only
+	To    *TimeOfDay `json:"to,omitempty"`
+}
+
+// fullService is what a depot without a calendar runs every day
+var fullService = ServiceDay{Level: ServiceFull}
+
+// Hours returns the part of the day buses run, which is empty with no service
+func (s ServiceDay) Hours() (TimeOfDay, TimeOfDay) {
+	switch s.Level {
+	case ServiceReduced:
+		return *s.From, *s.To
+	case ServiceNone:
+		return 0, 0
+	}
+	return 0, endOfDay
+}
+
+func (s ServiceDay) validate() error {
+	switch s.Level {
+	case ServiceFull, ServiceNone:
+		if s.From != nil || s.To != nil {
+			return fmt.Errorf("only reduced service takes from and to")
+		}
+	case ServiceReduced:
+		if s.From == nil || s.To == nil {
+			return fmt.Errorf("reduced service needs from and to")
+		}
+		if *s.From >= *s.To {
+			return fmt.Errorf("from must be before to")
+		}
+	default:
+		return fmt.Errorf("level must be %s, %s or %s", ServiceFull, ServiceReduced, ServiceNone)
+	}
+	return nil
+}
+
+// DepotCalendar is a depot's weekly operating pattern. Days left out of it
+// run full service, so a depot only lists the days that differ.
+type DepotCalendar struct {
+	Depot     string                `json:"depot"`
+	Days      map[string]ServiceDay `json:"days"`               // keyed by weekday name: mon, tue, ...
+	Holidays  *ServiceDay           `json:"holidays,omitempty"` // public holidays; unset follows the weekday
+	UpdatedAt time.Time             `json:"updated_at"`
+}
+
+// normalize checks the calendar and keys its days by short weekday name, so
+// "Sunday" and "sun" are the same day
+func (cal *DepotCalendar) normalize() error {
+	days := make(map[string]ServiceDay, len(cal.Days))
+	for name, service := range cal.Days {
+		mask, err := ParseDayMask([]string{name})
+		if err != nil || mask == 0 {
+			return fmt.Errorf("invalid day %q", name)
+		}
+		day := mask.Days()[0]
+		if _, duplicate := days[day]; duplicate {
+			return fmt.Errorf("%s is listed twice", day)
+		}
+		if err := service.validate(); err != nil {
+			return fmt.Errorf("%s: %w", day, err)
+		}
+		days[day] = service
+	}
+	if cal.Holidays != nil {
+		if err := cal.Holidays.validate(); err != nil {
+			return fmt.Errorf("holidays: %w", err)
+		}
+	}
+	cal.Days = days
+	return nil
+}
+
+// ServiceOn returns the service run on the date. A nil calendar runs full
+// service every day.
+func (cal *DepotCalendar) ServiceOn(date time.Time) ServiceDay {
+	if cal == nil {
+		return fullService
+	}
+	if _, holiday := publicHolidays[date.Format("2006-01-02")]; holiday && cal.Holidays != nil {
+		return *cal.Holidays
+	}
+	if service, listed := cal.Days[weekdayNames[date.Weekday()]]; listed {
+		return service
+	}
+	return fullService
+}
+
+// DepotCalendarRepository stores depot operating calendars
+type DepotCalendarRepository interface {
+	Get(depot string) (*DepotCalendar, error) // nil, nil when the depot has none
+	List() ([]DepotCalendar, error)
+	Put(cal *DepotCalendar) (created, changed bool, err error) // creates or replaces the depot's calendar
+	Delete(depot string) (bool, error)
+
+	WithContext(ctx context.Context) DepotCalendarRepository
+}
+
+// depotCalendars loads every calendar keyed by depot, for checking many buses at once
+func depotCalendars(repo DepotCalendarRepository) (map[string]*DepotCalendar, error) {
+	calendars, err := repo.List()
+	if err != nil {
+		return nil, err
+	}
+	byDepot := make(map[string]*DepotCalendar, len(calendars))
+	for i := range calendars {
+		byDepot[calendars[i].Depot] = &calendars[i]
+	}
+	return byDepot, nil
+}
+
+// DepotCalendarHandler serves the depot calendar endpoints
+type DepotCalendarHandler struct {
+	calendars DepotCalendarRepository
+}
+
+// NewDepotCalendarHandler creates a handler storing calendars in the given repository
+func NewDepotCalendarHandler(calendars DepotCalendarRepository) *DepotCalendarHandler {
+	return &DepotCalendarHandler{calendars: calendars}
+}
+
+// forRequest returns the handler with its repositories bound to the request's context
+func (h *DepotCalendarHandler) forRequest(c *gin.Context) *DepotCalendarHandler {
+	ctx := c.Request.Context()
+	return &DepotCalendarHandler{calendars: h.calendars.WithContext(ctx)}
+}
+
+func (h *DepotCalendarHandler) handleGetDepotCalendars(c *gin.Context) {
+	h = h.forRequest(c)
+	calendars, err := h.calendars.List()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve depot calendars")
+		return
+	}
+	if calendars == nil {
+		calendars = []DepotCalendar{}
+	}
+	c.JSON(http.StatusOK, gin.H{"calendars": calendars, "count": len(calendars)})
+}
+
+func (h *DepotCalendarHandler) handleGetDepotCalendar(c *gin.Context) {
+	h = h.forRequest(c)
+	depot, ok := configNameFromParam(c)
+	if !ok {
+		return
+	}
+
+	cal, err := h.calendars.Get(depot)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if cal == nil {
+		respondError(c, http.StatusNotFound, "Depot "+depot+" has no calendar, so it runs full service every day")
+		return
+	}
+	c.JSON(http.StatusOK, cal)
+}
+
+// handlePutDepotCalendar replaces a depot's calendar: 201 when it creates it,
+// 200 when it updates it or the calendar already matches
+func (h *DepotCalendarHandler) handlePutDepotCalendar(c *gin.Context) {
+	h = h.forRequest(c)
+	depot, ok := configNameFromParam(c)
+	if !ok {
+		return
+	}
+	var cal DepotCalendar
+	if err := c.ShouldBindJSON(&cal); err != nil {
+		respondBindError(c, &cal, err)
+		return
+	}
+	if err := cal.normalize(); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	cal.Depot = depot
+
+	created, changed, err := h.calendars.Put(&cal)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to save depot calendar")
+		return
+	}
+
+	c.Header("X-Config-Changed", strconv.FormatBool(changed))
+	if created {
+		c.JSON(http.StatusCreated, cal)
+		return
+	}
+	c.JSON(http.StatusOK, cal)
+}
+
+// handleDeleteDepotCalendar returns the depot to full service every day.
+// Deleting a calendar that doesn't exist succeeds, so a repeated delete is harmless.
+func (h *DepotCalendarHandler) handleDeleteDepotCalendar(c *gin.Context) {
+	h = h.forRequest(c)
+	depot, ok := configNameFromParam(c)
+	if !ok {
+		return
+	}
+	if _, err := h.calendars.Delete(depot); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to delete depot calendar")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDepotCalendarServiceOn(t *testing.T) {
+	saved := publicHolidays
+	t.Cleanup(func() { publicHolidays = saved })
+	publicHolidays = HolidayCalendar{"2025-03-03": "Founders Day"}
+
+	from, to := TimeOfDay(8*60), TimeOfDay(20*60)
+	cal := &DepotCalendar{
+		Days:     map[string]ServiceDay{"Sunday": {Level: ServiceReduced, From: &from, To: &to}, "sat": {Level: ServiceNone}},
+		Holidays: &ServiceDay{Level: ServiceNone},
+	}
+	if err := cal.normalize(); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+
+	for day, want := range map[string]string{
+		"2025-03-01": ServiceNone,    // Saturday
+		"2025-03-02": ServiceReduced, // Sunday, listed by its full name
+		"2025-03-03": ServiceNone,    // holiday Monday
+		"2025-03-04": ServiceFull,    // Tuesday, not listed
+	} {
+		if got := cal.ServiceOn(date(day)).Level; got != want {
+			t.Errorf("ServiceOn(%s) = %s, want %s", day, got, want)
+		}
+	}
+	if got := (*DepotCalendar)(nil).ServiceOn(date("2025-03-01")); got.Level != ServiceFull {
+		t.Errorf("nil calendar ServiceOn = %+v, want full service", got)
+	}
+}
+
+func TestDepotCalendarValidation(t *testing.T) {
+	from, to := TimeOfDay(8*60), TimeOfDay(20*60)
+	invalid := map[string]DepotCalendar{
+		"unknown day":         {Days: map[string]ServiceDay{"someday": {Level: ServiceFull}}},
+		"unknown level":       {Days: map[string]ServiceDay{"sun": {Level: "half"}}},
+		"reduced, no hours":   {Days: map[string]ServiceDay{"sun": {Level: ServiceReduced}}},
+		"reduced, backwards":  {Days: map[string]ServiceDay{"sun": {Level: ServiceReduced, From: &to, To: &from}}},
+		"hours on full":       {Days: map[string]ServiceDay{"sun": {Level: ServiceFull, From: &from, To: &to}}},
+		"day listed twice":    {Days: map[string]ServiceDay{"sun": {Level: ServiceNone}, "Sunday": {Level: ServiceNone}}},
+		"bad holiday service": {Holidays: &ServiceDay{Level: ServiceReduced}},
+	}
+	for name, cal := range invalid {
+		if err := cal.normalize(); err == nil {
+			t.Errorf("%s: normalize accepted %+v", name, cal)
+		}
+	}
+}
+
+func TestPutDepotCalendar(t *testing.T) {
+	router, _ := newTestRouter(t)
+	body := map[string]any{"days": map[string]any{"sun": map[string]any{"level": "reduced", "from": "08:00", "to": "20:00"}}}
+
+	rec := doRequest(router, http.MethodPut, "/api/config/depot-calendars/north", body)
+	if rec.Code != http.StatusCreated || rec.Header().Get("X-Config-Changed") != "true" {
+		t.Fatalf("first PUT: status %d, changed %q: %s", rec.Code, rec.Header().Get("X-Config-Changed"), rec.Body.String())
+	}
+	rec = doRequest(router, http.MethodPut, "/api/config/depot-calendars/north", body)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Config-Changed") != "false" {
+		t.Errorf("repeated PUT: status %d, changed %q", rec.Code, rec.Header().Get("X-Config-Changed"))
+	}
+
+	rec = doRequest(router, http.MethodGet, "/api/config/depot-calendars/north", nil)
+	if got := decode[DepotCalendar](t, rec); got.Depot != "north" || got.Days["sun"].Level != ServiceReduced {
+		t.Errorf("GET returned %+v", got)
+	}
+
+	bad := map[string]any{"days": map[string]any{"sun": map[string]any{"level": "reduced"}}}
+	if rec := doRequest(router, http.MethodPut, "/api/config/depot-calendars/north", bad); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid calendar: status %d, want 400", rec.Code)
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := doRequest(router, http.MethodDelete, "/api/config/depot-calendars/north", nil); rec.Code != http.StatusNoContent {
+			t.Errorf("DELETE %d: status %d, want 204", i+1, rec.Code)
+		}
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/config/depot-calendars/north", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET after DELETE: status %d, want 404", rec.Code)
+	}
+}
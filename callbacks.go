@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers a counterpart system signs its callbacks with
+const (
+	callbackKeyHeader       = "X-Callback-Key" // ID of the key the request is signed with
+	callbackTimestampHeader = "X-Callback-Timestamp"
+	callbackNonceHeader     = "X-Callback-Nonce"
+	callbackSignatureHeader = "X-Callback-Signature" // "sha256=" and the hex HMAC of callbackSigningString
+)
+
+// callbackTolerance is how far a callback's timestamp may be from the time it
+// arrives; main reads it from CALLBACK_TIMESTAMP_TOLERANCE. Nonces are kept
+// this long past their timestamp, after which the timestamp alone rejects a
+// replay.
+var callbackTolerance = 5 * time.Minute
+
+// Nonces must be long enough to be random and fit the nonce column
+const (
+	minCallbackNonceLength = 16
+	maxCallbackNonceLength = 255
+)
+
+// CallbackKey is a shared secret a counterpart system, such as a shift swap
+// app or an external approval workflow, signs its callbacks with. Each system
+// gets its own key, and rotates it by creating a new one and revoking the old
+// one once it has switched over.
+type CallbackKey struct {
+	ID         string     `json:"id"` // ULID, sent as X-Callback-Key
+	Name       string     `json:"name"`
+	Secret     string     `json:"-"` // only ever returned when the key is created
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreateCallbackKeyRequest names the system a new key is for
+type CreateCallbackKeyRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// CallbackKeyRepository stores callback keys and the nonces of callbacks
+// already accepted
+type CallbackKeyRepository interface {
+	Create(key *CallbackKey) error
+	Get(id string) (*CallbackKey, error)
+	List() ([]CallbackKey, error)
+	// Revoke stops a key verifying callbacks, reporting whether it exists.
+	// A key already revoked keeps the time it was first revoked.
+	Revoke(id string, at time.Time) (bool, error)
+	// Use records a verified callback: its nonce is kept until expiresAt and
+	// the key is marked used. It reports false, changing nothing, when the
+	// key has already accepted the nonce.
+	Use(keyID, nonce string, expiresAt, now time.Time) (bool, error)
+
+	WithContext(ctx context.Context) CallbackKeyRepository
+}
+
+// newCallbackSecret returns a random secret for a new key
+func newCallbackSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// callbackSigningString is what a callback's signature covers: the timestamp,
+// nonce, method and request URI on a line each, then the body as sent
+func callbackSigningString(timestamp, nonce, method, uri string, body []byte) []byte {
+	return append([]byte(timestamp+"\n"+nonce+"\n"+method+"\n"+uri+"\n"), body...)
+}
+
+// callbackSignature signs a callback with the key's secret, as it goes in
+// X-Callback-Signature
+func callbackSignature(secret, timestamp, nonce, method, uri string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(callbackSigningString(timestamp, nonce, method, uri, body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyCallback admits callbacks signed with an unrevoked key, sent within
+// callbackTolerance and carrying a nonce the key hasn't accepted before, in
+// place of a bearer token. The signature is checked before the nonce is
+// recorded, so forged requests can't use up nonces. Verified callbacks act
+// as a dispatcher named after the key's system.
+func verifyCallback(keys CallbackKeyRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keyID := c.GetHeader(callbackKeyHeader)
+		nonce := c.GetHeader(callbackNonceHeader)
+		signature := c.GetHeader(callbackSignatureHeader)
+		timestamp := c.GetHeader(callbackTimestampHeader)
+		if keyID == "" || nonce == "" || signature == "" || timestamp == "" {
+			abortWithError(c, http.StatusUnauthorized, "Callbacks must be signed with "+strings.Join([]string{
+				callbackKeyHeader, callbackTimestampHeader, callbackNonceHeader, callbackSignatureHeader}, ", "))
+			return
+		}
+		if len(nonce) < minCallbackNonceLength || len(nonce) > maxCallbackNonceLength {
+			abortWithError(c, http.StatusUnauthorized, fmt.Sprintf("%s must be %d to %d characters",
+				callbackNonceHeader, minCallbackNonceLength, maxCallbackNonceLength))
+			return
+		}
+
+		now := time.Now()
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		sentAt := time.Unix(seconds, 0)
+		if err != nil || sentAt.Before(now.Add(-callbackTolerance)) || sentAt.After(now.Add(callbackTolerance)) {
+			abortWithError(c, http.StatusUnauthorized, fmt.Sprintf(
+				"%s must be the Unix time the callback was sent, within %s", callbackTimestampHeader, callbackTolerance))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize))
+		if err != nil {
+			abortWithError(c, http.StatusRequestEntityTooLarge, "Request body is too large")
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		keys := keys.WithContext(c.Request.Context())
+		key, err := keys.Get(keyID)
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, "Failed to verify callback")
+			return
+		}
+		// Unknown and revoked keys get the same answer as a bad signature
+		if key == nil || key.RevokedAt != nil || !hmac.Equal([]byte(signature),
+			[]byte(callbackSignature(key.Secret, timestamp, nonce, c.Request.Method, c.Request.URL.RequestURI(), body))) {
+			abortWithError(c, http.StatusUnauthorized, "Invalid callback signature")
+			return
+		}
+
+		fresh, err := keys.Use(key.ID, nonce, sentAt.Add(callbackTolerance), now)
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, "Failed to verify callback")
+			return
+		}
+		if !fresh {
+			abortWithError(c, http.StatusConflict, "Callback was already received; sign each attempt with a new nonce")
+			return
+		}
+
+		c.Set(principalKey, &Principal{Subject: "callback:" + key.Name, Role: RoleDispatcher})
+		c.Next()
+	}
+}
+
+// CallbackKeyHandler serves the callback key management endpoints
+type CallbackKeyHandler struct {
+	keys CallbackKeyRepository
+}
+
+// NewCallbackKeyHandler creates a handler storing keys in the given repository
+func NewCallbackKeyHandler(keys CallbackKeyRepository) *CallbackKeyHandler {
+	return &CallbackKeyHandler{keys: keys}
+}
+
+// forRequest returns the handler with its repository bound to the request's context
+func (h *CallbackKeyHandler) forRequest(c *gin.Context) *CallbackKeyHandler {
+	return &CallbackKeyHandler{keys: h.keys.WithContext(c.Request.Context())}
+}
+
+func (h *CallbackKeyHandler) handleGetCallbackKeys(c *gin.Context) {
+	h = h.forRequest(c)
+	keys, err := h.keys.List()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve callback keys")
+		return
+	}
+	if keys == nil {
+		keys = []CallbackKey{}
+	}
+	c.JSON(http.StatusOK, gin.H{"callback_keys": keys, "count": len(keys)})
+}
+
+// handleCreateCallbackKey issues a key for a counterpart system. The secret
+// is in this response only, and can't be read back.
+func (h *CallbackKeyHandler) handleCreateCallbackKey(c *gin.Context) {
+	h = h.forRequest(c)
+	var req CreateCallbackKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, &req, err)
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 255 {
+		respondInvalidField(c, "name", "Name must be 1 to 255 characters")
+		return
+	}
+
+	id, err := newULID(time.Now())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to create callback key")
+		return
+	}
+	secret, err := newCallbackSecret()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to create callback key")
+		return
+	}
+	key := CallbackKey{ID: id, Name: name, Secret: secret, CreatedBy: actorFromContext(c)}
+	if err := h.keys.Create(&key); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to create callback key")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"callback_key": key, "secret": key.Secret})
+}
+
+// handleRevokeCallbackKey stops a key verifying callbacks. The key is kept,
+// revoked, so its name still explains past actions in assignment history.
+func (h *CallbackKeyHandler) handleRevokeCallbackKey(c *gin.Context) {
+	h = h.forRequest(c)
+	id, valid := normalizeULID(c.Param("id"))
+	if !valid {
+		respondError(c, http.StatusBadRequest, "Invalid callback key ID")
+		return
+	}
+
+	revoked, err := h.keys.Revoke(id, time.Now())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to revoke callback key")
+		return
+	}
+	if !revoked {
+		respondError(c, http.StatusNotFound, "Callback key not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Callback key revoked successfully"})
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sendCallback posts body to path signed as a counterpart system would,
+// with the given timestamp and nonce
+func sendCallback(router *gin.Engine, path, keyID, secret string, sentAt time.Time, nonce, body string) *httptest.ResponseRecorder {
+	timestamp := strconv.FormatInt(sentAt.Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set(callbackKeyHeader, keyID)
+	req.Header.Set(callbackTimestampHeader, timestamp)
+	req.Header.Set(callbackNonceHeader, nonce)
+	req.Header.Set(callbackSignatureHeader,
+		callbackSignature(secret, timestamp, nonce, http.MethodPost, path, []byte(body)))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestVerifyCallback(t *testing.T) {
+	keys := NewMemoryCallbackKeyRepository()
+	key := &CallbackKey{ID: "01JNB3S7Z8K4Q2M9X6T5V0W1YC", Name: "swap-app", Secret: "s3cret"}
+	if err := keys.Create(key); err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.POST("/callbacks/echo", verifyCallback(keys), func(c *gin.Context) {
+		body := new(bytes.Buffer)
+		body.ReadFrom(c.Request.Body)
+		c.String(http.StatusOK, actorFromContext(c)+" "+body.String())
+	})
+
+	now := time.Now()
+	rec := sendCallback(router, "/callbacks/echo", key.ID, "s3cret", now, "nonce-0000000001", `{"approved":true}`)
+	if rec.Code != http.StatusOK || rec.Body.String() != `callback:swap-app {"approved":true}` {
+		t.Fatalf("signed callback = %d %s, want it admitted as the key's system with its body", rec.Code,
+			rec.Body.String())
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		sentAt time.Time
+		nonce  string
+		want   int
+	}{
+		{"replayed", "s3cret", now, "nonce-0000000001", http.StatusConflict},
+		{"wrong secret", "guess", now, "nonce-0000000002", http.StatusUnauthorized},
+		{"stale", "s3cret", now.Add(-callbackTolerance - time.Minute), "nonce-0000000003", http.StatusUnauthorized},
+		{"from the future", "s3cret", now.Add(callbackTolerance + time.Minute), "nonce-0000000004",
+			http.StatusUnauthorized},
+		{"short nonce", "s3cret", now, "1", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := sendCallback(router, "/callbacks/echo", key.ID, tt.secret, tt.sentAt, tt.nonce, `{"approved":true}`)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	// A forged request mustn't use up the nonce of the genuine one
+	if rec := sendCallback(router, "/callbacks/echo", key.ID, "guess", now, "nonce-0000000005", "{}"); rec.Code !=
+		http.StatusUnauthorized {
+		t.Fatalf("forged callback = %d, want 401", rec.Code)
+	}
+	if rec := sendCallback(router, "/callbacks/echo", key.ID, "s3cret", now, "nonce-0000000005", "{}"); rec.Code !=
+		http.StatusOK {
+		t.Errorf("genuine callback after a forged one = %d, want 200", rec.Code)
+	}
+
+	// A body changed in transit no longer matches the signature
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/callbacks/echo", strings.NewReader(`{"approved":false}`))
+	req.Header.Set(callbackKeyHeader, key.ID)
+	req.Header.Set(callbackTimestampHeader, timestamp)
+	req.Header.Set(callbackNonceHeader, "nonce-0000000006")
+	req.Header.Set(callbackSignatureHeader, callbackSignature("s3cret", timestamp, "nonce-0000000006",
+		http.MethodPost, "/callbacks/echo", []byte(`{"approved":true}`)))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("tampered callback = %d, want 401", rec.Code)
+	}
+
+	if _, err := keys.Revoke(key.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if rec := sendCallback(router, "/callbacks/echo", key.ID, "s3cret", now, "nonce-0000000007", "{}"); rec.Code !=
+		http.StatusUnauthorized {
+		t.Errorf("callback with a revoked key = %d, want 401", rec.Code)
+	}
+}
+
+func TestCallbackKeyEndpoints(t *testing.T) {
+	router := gin.New()
+	setupRoutes(router, AuthConfig{Disabled: true}, NewMemoryStorage())
+
+	if rec := doRequest(router, http.MethodPost, "/api/v1/admin/callback-keys", map[string]string{"name": " "}); rec.Code !=
+		http.StatusBadRequest {
+		t.Errorf("blank name = %d, want 400", rec.Code)
+	}
+
+	rec := doRequest(router, http.MethodPost, "/api/v1/admin/callback-keys", map[string]string{"name": "swap-app"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", rec.Code, rec.Body.String())
+	}
+	created := decode[struct {
+		CallbackKey CallbackKey `json:"callback_key"`
+		Secret      string      `json:"secret"`
+	}](t, rec)
+	if len(created.Secret) != 64 || created.CallbackKey.Name != "swap-app" || created.CallbackKey.CreatedBy != "anonymous" {
+		t.Fatalf("created = %+v, want a named key with its secret", created)
+	}
+
+	rec = doRequest(router, http.MethodGet, "/api/v1/admin/callback-keys", nil)
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), created.Secret) {
+		t.Errorf("list = %d %s, want the key without its secret", rec.Code, rec.Body.String())
+	}
+
+	// Signed callbacks reach the routes without a token; this one is only
+	// refused for lack of a nonce
+	rec = sendCallback(router, "/api/v1/callbacks/shifts/1/claim/reject", created.CallbackKey.ID, created.Secret,
+		time.Now(), "", "")
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(errorOf(t, rec).Message, callbackNonceHeader) {
+		t.Errorf("unsigned callback = %d %s, want 401 naming the missing header", rec.Code, rec.Body.String())
+	}
+
+	path := "/api/v1/admin/callback-keys/" + strings.ToLower(created.CallbackKey.ID)
+	if rec := doRequest(router, http.MethodDelete, path, nil); rec.Code != http.StatusOK {
+		t.Errorf("revoke = %d %s", rec.Code, rec.Body.String())
+	}
+	listed := decode[struct {
+		CallbackKeys []CallbackKey `json:"callback_keys"`
+	}](t, doRequest(router, http.MethodGet, "/api/v1/admin/callback-keys", nil))
+	if len(listed.CallbackKeys) != 1 || listed.CallbackKeys[0].RevokedAt == nil {
+		t.Errorf("keys after revoking = %+v, want the key kept, revoked", listed.CallbackKeys)
+	}
+	if rec := doRequest(router, http.MethodDelete, "/api/v1/admin/callback-keys/01JNB3S7Z8K4Q2M9X6T5V0W1YC", nil); rec.Code !=
+		http.StatusNotFound {
+		t.Errorf("revoke unknown = %d, want 404", rec.Code)
+	}
+}
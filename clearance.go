@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clearanceLabelPattern is the form of a clearance label, e.g. vip-charter
+var clearanceLabelPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// Clearance is what a caller may see of assignments: those restricted by a
+// clearance label, such as VIP charter duties, and those at other depots.
+// Unlabelled assignments are visible to everyone, labelled ones only to
+// holders of the label, and a caller scoped to a depot sees only that depot's.
+// A nil *Clearance sees everything, as unscoped admins and internal checks
+// such as conflict detection must.
+type Clearance struct {
+	Labels    []string
+	AllLabels bool   // admins hold every label, even when scoped to a depot
+	Depot     string // "" for every depot
+}
+
+// AllowsLabel reports whether assignments with the label are visible
+func (cl *Clearance) AllowsLabel(label string) bool {
+	return cl == nil || cl.AllLabels || label == "" || slices.Contains(cl.Labels, label)
+}
+
+// AllowsDepot reports whether assignments at the depot are visible
+func (cl *Clearance) AllowsDepot(depot string) bool {
+	return cl == nil || cl.Depot == "" || depot == cl.Depot
+}
+
+// Allows reports whether the assignment is visible
+func (cl *Clearance) Allows(assignment *Assignment) bool {
+	return cl.AllowsLabel(assignment.ClearanceLabel) && cl.AllowsDepot(assignment.DepotID)
+}
+
+// sqlLabels passes the labels as a text[] query argument: NULL to see every
+// label, otherwise the labels held, which may be none
+func (cl *Clearance) sqlLabels() []string {
+	if cl == nil || cl.AllLabels {
+		return nil
+	}
+	return append([]string{}, cl.Labels...)
+}
+
+// sqlArgs are the two query arguments clearanceCondition expects: the labels
+// and the depot, NULL for every depot
+func (cl *Clearance) sqlArgs() []any {
+	var depot *string
+	if cl != nil && cl.Depot != "" {
+		depot = &cl.Depot
+	}
+	return []any{cl.sqlLabels(), depot}
+}
+
+// clearanceCondition limits assignments to those visible with the clearance
+// in query parameters n and n+1, as given by sqlArgs
+func clearanceCondition(n int) string {
+	return fmt.Sprintf("(($%d::text[] IS NULL OR clearance_label IS NULL OR clearance_label = ANY($%d)) "+
+		"AND ($%d::text IS NULL OR depot_id = $%d))", n, n, n+1, n+1)
+}
+
+// auditClearanceCondition limits audit entries to assignments visible with the
+// clearance in query parameters n and n+1, going by each assignment's current
+// label and depot
+func auditClearanceCondition(n int) string {
+	return fmt.Sprintf(`NOT EXISTS (
+			SELECT 1 FROM assignments a
+			WHERE a.id = assignment_audit.assignment_id
+			  AND (($%d::text[] IS NOT NULL AND a.clearance_label IS NOT NULL AND a.clearance_label <> ALL($%d))
+			    OR ($%d::text IS NOT NULL AND a.depot_id IS DISTINCT FROM $%d)))`, n, n, n+1, n+1)
+}
+
+// callerClearance is the clearance of the request's caller. Admins see every
+// assignment, or every one at the depot they've picked; everyone else sees
+// the labels in their token, at their depot.
+func callerClearance(c *gin.Context) *Clearance {
+	principal := currentPrincipal(c)
+	if principal == nil {
+		return &Clearance{}
+	}
+	if principal.Role == RoleAdmin {
+		if principal.DepotID == "" {
+			return nil
+		}
+		return &Clearance{AllLabels: true, Depot: principal.DepotID}
+	}
+	return &Clearance{Labels: principal.Clearances, Depot: principal.DepotID}
+}
+
+// checkClearance rejects with 403 an assignment the caller couldn't then see,
+// one labelled with a clearance they don't hold or on a bus at another
+// depot, so nobody can restrict or move work out of their own reach. It
+// returns false once a response has been written.
+func checkClearance(c *gin.Context, assignment *Assignment) bool {
+	if !callerClearance(c).AllowsLabel(assignment.ClearanceLabel) {
+		respondError(c, http.StatusForbidden, fmt.Sprintf("Labelling an assignment %s requires that clearance",
+			assignment.ClearanceLabel))
+		return false
+	}
+	return checkBusDepots(c, assignment.BusID)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// clearedToken signs an Authorization header value for a caller holding the
+// clearance labels
+func clearedToken(t *testing.T, secret []byte, role string, clearances ...string) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		Role:             role,
+		Clearances:       clearances,
+		DepotID:          "north",
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "user-" + role},
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + signed
+}
+
+func newClearanceRouter(t *testing.T) (*gin.Engine, AssignmentRepository, []byte) {
+	t.Helper()
+	secret := []byte("test-secret")
+	store := NewMemoryStorage()
+	repo := store.Assignments
+	router := gin.New()
+	setupRoutes(router, AuthConfig{Secret: secret}, store)
+	return router, repo, secret
+}
+
+func TestClearanceLabelHidesAssignments(t *testing.T) {
+	router, repo, secret := newClearanceRouter(t)
+	charter := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03"),
+		ClearanceLabel: "vip-charter"})
+	mustCreate(t, repo, Assignment{BusID: 2, StaffID: 2, Role: "conductor", StartDate: date("2025-03-03")})
+
+	count := func(token, path string) int {
+		rec := doRequest(router, http.MethodGet, path, nil, "Authorization", token)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s status = %d: %s", path, rec.Code, rec.Body.String())
+		}
+		return len(decode[struct{ Assignments []Assignment }](t, rec).Assignments)
+	}
+
+	viewer := clearedToken(t, secret, RoleViewer)
+	if n := count(viewer, "/api/assignments"); n != 1 {
+		t.Errorf("viewer lists %d assignments, want the charter hidden", n)
+	}
+	if n := count(viewer, "/api/assignments/bus/1"); n != 0 {
+		t.Errorf("viewer lists %d assignments on bus 1", n)
+	}
+	for _, path := range []string{"/api/assignments/" + charter.PublicID, "/api/assignments/" + charter.PublicID + "/history"} {
+		if rec := doRequest(router, http.MethodGet, path, nil, "Authorization", viewer); rec.Code != http.StatusNotFound {
+			t.Errorf("%s status = %d, want %d", path, rec.Code, http.StatusNotFound)
+		}
+	}
+	rec := doRequest(router, http.MethodGet, "/api/activity?since=2000-01-01T00:00:00Z", nil, "Authorization", viewer)
+	if items := decode[struct{ Activity []ActivityItem }](t, rec).Activity; len(items) != 1 {
+		t.Errorf("viewer activity = %+v, want only the unrestricted assignment", items)
+	}
+
+	if n := count(clearedToken(t, secret, RoleViewer, "vip-charter"), "/api/assignments"); n != 2 {
+		t.Errorf("cleared viewer lists %d assignments, want both", n)
+	}
+	if n := count(clearedToken(t, secret, RoleAdmin), "/api/assignments"); n != 2 {
+		t.Errorf("admin lists %d assignments, want both", n)
+	}
+
+	cleared := &Clearance{Labels: []string{"vip-charter"}}
+	if !cleared.AllowsLabel("vip-charter") || (&Clearance{}).AllowsLabel("vip-charter") || !(*Clearance)(nil).AllowsLabel("vip-charter") {
+		t.Error("AllowsLabel doesn't match the held labels")
+	}
+}
+
+func TestClearanceLabelWrites(t *testing.T) {
+	router, repo, secret := newClearanceRouter(t)
+	dispatcher := clearedToken(t, secret, RoleDispatcher)
+	body := gin.H{"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": date("2025-03-03").Format("2006-01-02"),
+		"clearance_label": "vip-charter"}
+
+	if rec := doRequest(router, http.MethodPost, "/api/assignments", body, "Authorization", dispatcher); rec.Code != http.StatusForbidden {
+		t.Errorf("uncleared create status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	body["clearance_label"] = "VIP charter"
+	if rec := doRequest(router, http.MethodPost, "/api/assignments", body, "Authorization", clearedToken(t, secret, RoleAdmin)); rec.Code != http.StatusBadRequest {
+		t.Errorf("malformed label status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	// A restricted assignment still conflicts, without being shown
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03"),
+		ClearanceLabel: "vip-charter"})
+	delete(body, "clearance_label")
+	rec := doRequest(router, http.MethodPost, "/api/assignments", body, "Authorization", dispatcher)
+	conflict := decode[struct {
+		Conflicts       []Assignment
+		HiddenConflicts int `json:"hidden_conflicts"`
+	}](t, rec)
+	if rec.Code != http.StatusConflict || len(conflict.Conflicts) != 0 || conflict.HiddenConflicts != 1 {
+		t.Errorf("conflict = %d %s, want one hidden conflict", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Clock is where business dates come from: what today is for expiry, crew
+// status, reassignments, deletion checks, bidding deadlines and the
+// scheduling horizon. Timeouts, signatures, caches, worker health and audit
+// timestamps keep reading the system clock, since they measure real time.
+//
+// Timestamps are compared on the clock that wrote them: deadlines the service
+// sets are passed into queries rather than compared with the database's
+// CURRENT_TIMESTAMP, and ones the database sets stay in SQL, so skew between
+// the two clocks can't make a deadline pass early or late.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock reads the system clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// clock is the service's clock; main swaps in a TravelClock in staging
+var clock Clock = systemClock{}
+
+// today is the clock's current date
+func today() time.Time {
+	return truncateDate(clock.Now())
+}
+
+// TravelClock runs from a chosen instant, or stands still at it, so staging
+// can rehearse month-end, year-end and DST changes. Setting it only affects
+// this instance.
+type TravelClock struct {
+	mu     sync.RWMutex
+	offset time.Duration // from the system clock while running
+	frozen *time.Time    // the instant it stands still at, if frozen
+	setBy  string
+}
+
+// ClockStatus reports what the service thinks the time is
+type ClockStatus struct {
+	Now        time.Time `json:"now"`
+	Travelling bool      `json:"travelling"`
+	Offset     string    `json:"offset,omitempty"` // from the system clock, while running
+	Frozen     bool      `json:"frozen,omitempty"`
+	SetBy      string    `json:"set_by,omitempty"` // the admin who last set it, or env
+}
+
+// SetClockRequest moves a travelling clock. Omitting now returns it to the
+// system clock.
+type SetClockRequest struct {
+	Now    string `json:"now,omitempty"`    // RFC 3339 instant
+	Frozen bool   `json:"frozen,omitempty"` // stand still at now instead of running from it
+}
+
+// Now returns the travelled time
+func (t *TravelClock) Now() time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.frozen != nil {
+		return *t.frozen
+	}
+	return time.Now().Add(t.offset)
+}
+
+// Set moves the clock to now, running from there or frozen at it
+func (t *TravelClock) Set(now time.Time, frozen bool, actor string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.offset, t.frozen, t.setBy = 0, nil, actor
+	if frozen {
+		t.frozen = &now
+		return
+	}
+	t.offset = time.Until(now)
+}
+
+// Reset returns the clock to the system clock
+func (t *TravelClock) Reset(actor string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.offset, t.frozen, t.setBy = 0, nil, actor
+}
+
+// Status reports the clock's time and how it got there
+func (t *TravelClock) Status() ClockStatus {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.frozen != nil {
+		return ClockStatus{Now: *t.frozen, Travelling: true, Frozen: true, SetBy: t.setBy}
+	}
+	status := ClockStatus{Now: time.Now().Add(t.offset), Travelling: t.offset != 0, SetBy: t.setBy}
+	if status.Travelling {
+		status.Offset = t.offset.Round(time.Second).String()
+	}
+	return status
+}
+
+// LoadClock reads TIME_TRAVEL (default false), which lets admins move the
+// clock through the API, and the optional TIME_TRAVEL_TO, an RFC 3339
+// instant to start from. Leave both unset outside staging.
+func LoadClock() Clock {
+	if os.Getenv("TIME_TRAVEL") != "true" {
+		if os.Getenv("TIME_TRAVEL_TO") != "" {
+			log.Println("TIME_TRAVEL_TO is ignored unless TIME_TRAVEL=true")
+		}
+		return systemClock{}
+	}
+
+	travel := &TravelClock{}
+	if value := os.Getenv("TIME_TRAVEL_TO"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			log.Printf("Invalid TIME_TRAVEL_TO %q, using the system clock", value)
+			return travel
+		}
+		travel.Set(to, false, "env")
+	}
+	log.Printf("Time travel enabled, the clock reads %s", travel.Now().Format(time.RFC3339))
+	return travel
+}
+
+func handleGetClock(c *gin.Context) {
+	if travel, ok := clock.(*TravelClock); ok {
+		c.JSON(http.StatusOK, travel.Status())
+		return
+	}
+	c.JSON(http.StatusOK, ClockStatus{Now: clock.Now()})
+}
+
+// handleSetClock moves the clock when time travel is enabled
+func handleSetClock(c *gin.Context) {
+	travel, ok := clock.(*TravelClock)
+	if !ok {
+		respondError(c, http.StatusConflict, "Time travel is disabled; set TIME_TRAVEL=true to move the clock")
+		return
+	}
+	var req SetClockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, &req, err)
+		return
+	}
+
+	actor := actorFromContext(c)
+	if req.Now == "" {
+		travel.Reset(actor)
+		log.Printf("Clock returned to the system clock by %s", actor)
+		c.JSON(http.StatusOK, travel.Status())
+		return
+	}
+	now, err := time.Parse(time.RFC3339, req.Now)
+	if err != nil {
+		respondInvalidField(c, "now", "Invalid now. Use an RFC 3339 time, e.g. 2025-03-30T00:59:00Z")
+		return
+	}
+	travel.Set(now, req.Frozen, actor)
+	log.Printf("Clock set to %s (frozen %v) by %s", now.Format(time.RFC3339), req.Frozen, actor)
+	c.JSON(http.StatusOK, travel.Status())
+}
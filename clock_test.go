@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useTravelClock installs a time-travel clock for one test
+func useTravelClock(t *testing.T) *TravelClock {
+	t.Helper()
+	saved := clock
+	travel := &TravelClock{}
+	clock = travel
+	t.Cleanup(func() { clock = saved })
+	return travel
+}
+
+func TestTravelClock(t *testing.T) {
+	travel := &TravelClock{}
+	at := time.Date(2025, 3, 30, 0, 59, 0, 0, time.UTC)
+
+	travel.Set(at, true, "test")
+	if got := travel.Now(); !got.Equal(at) {
+		t.Errorf("frozen Now = %s, want %s", got, at)
+	}
+	if status := travel.Status(); !status.Frozen || !status.Travelling {
+		t.Errorf("frozen status = %+v, want frozen and travelling", status)
+	}
+
+	travel.Set(at, false, "test")
+	if got := travel.Now(); got.Before(at) || got.Sub(at) > time.Minute {
+		t.Errorf("running Now = %s, want just after %s", got, at)
+	}
+
+	travel.Reset("test")
+	if got := time.Since(travel.Now()); got < -time.Second || got > time.Second {
+		t.Errorf("reset clock is %s off the system clock", got)
+	}
+	if status := travel.Status(); status.Travelling {
+		t.Errorf("reset status = %+v, want not travelling", status)
+	}
+}
+
+func TestCrewStatusDefaultsToClockDate(t *testing.T) {
+	travel := useTravelClock(t)
+	router, repo := newTestRouter(t)
+	end := date("2025-01-31")
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01"), EndDate: &end})
+
+	crewStatus := func(at string) CrewStatus {
+		t.Helper()
+		now, _ := time.Parse(time.RFC3339, at)
+		travel.Set(now, true, "test")
+		rec := doRequest(router, http.MethodGet, "/api/buses/1/crew-status", nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+		}
+		return decode[CrewStatus](t, rec)
+	}
+
+	// The last minute of the month still has its driver; the first of the next doesn't
+	if got := crewStatus("2025-01-31T23:59:00Z"); got.Status != CrewIncomplete {
+		t.Errorf("month-end status = %q, want %q", got.Status, CrewIncomplete)
+	}
+	if got := crewStatus("2025-02-01T00:00:00Z"); got.Status != CrewUnstaffed {
+		t.Errorf("next month status = %q, want %q", got.Status, CrewUnstaffed)
+	}
+}
+
+func TestSetClock(t *testing.T) {
+	router, _ := newTestRouter(t)
+	body := gin.H{"now": "2025-10-26T00:30:00Z", "frozen": true}
+
+	if rec := doRequest(router, http.MethodPut, "/api/admin/clock", body); rec.Code != http.StatusConflict {
+		t.Errorf("set without time travel status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	useTravelClock(t)
+	rec := doRequest(router, http.MethodPut, "/api/admin/clock", body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("set status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if got := today(); !got.Equal(date("2025-10-26")) {
+		t.Errorf("today = %s, want 2025-10-26", got.Format("2006-01-02"))
+	}
+	rec = doRequest(router, http.MethodGet, "/api/admin/clock", nil)
+	if got := decode[ClockStatus](t, rec); !got.Frozen || got.SetBy != "anonymous" {
+		t.Errorf("clock = %+v, want frozen by anonymous", got)
+	}
+
+	if rec := doRequest(router, http.MethodPut, "/api/admin/clock", gin.H{"now": "26/10/2025"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid now status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	rec = doRequest(router, http.MethodPut, "/api/admin/clock", gin.H{})
+	if got := decode[ClockStatus](t, rec); got.Travelling {
+		t.Errorf("reset clock = %+v, want not travelling", got)
+	}
+}
+
+func TestLoadClock(t *testing.T) {
+	t.Setenv("TIME_TRAVEL_TO", "2025-12-31T23:00:00Z")
+	if _, ok := LoadClock().(systemClock); !ok {
+		t.Error("TIME_TRAVEL_TO without TIME_TRAVEL should keep the system clock")
+	}
+
+	t.Setenv("TIME_TRAVEL", "true")
+	travel, ok := LoadClock().(*TravelClock)
+	if !ok {
+		t.Fatal("TIME_TRAVEL=true should load a travel clock")
+	}
+	if got := travel.Now(); got.Year() != 2025 || got.Month() != time.December {
+		t.Errorf("Now = %s, want just after 2025-12-31T23:00:00Z", got)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// configLockShifts is the advisory lock class serialising declarative writes
+// to one shift name
+const configLockShifts = 80820004
+
+// configNamePattern is what a declared resource may be called: stable,
+// URL-safe and short enough to use as a Terraform resource ID
+var configNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,99}$`)
+
+// errShiftSpecLocked is returned when a declared shift must change but staff
+// have already bid on, claimed or been awarded it
+var errShiftSpecLocked = errors.New("shift can no longer be changed")
+
+// errBiddingClosed is returned when a new or changed shift would already be
+// closed for bidding
+var errBiddingClosed = errors.New("bidding_closes_at must be in the future")
+
+// configNameFromParam validates the :name path parameter. It returns false
+// once an error response has been written.
+func configNameFromParam(c *gin.Context) (string, bool) {
+	name := c.Param("name")
+	if !configNamePattern.MatchString(name) {
+		respondError(c, http.StatusBadRequest, "Names must be 1-100 lowercase letters, digits, '.', '_' or '-', starting with a letter or digit")
+		return "", false
+	}
+	return name, true
+}
+
+// sameShiftSpec reports whether two shifts describe the same slot and offer,
+// ignoring state the service manages itself such as status and awards
+func sameShiftSpec(a, b *OpenShift) bool {
+	sameEnd := (a.EndDate == nil && b.EndDate == nil) ||
+		(a.EndDate != nil && b.EndDate != nil && a.EndDate.Equal(*b.EndDate))
+	return a.BusID == b.BusID && a.Role == b.Role && a.StartDate.Equal(b.StartDate) && sameEnd &&
+		a.WorkingDays == b.WorkingDays && a.Mode == b.Mode && a.RequiresConfirmation == b.RequiresConfirmation &&
+		a.AwardPolicy == b.AwardPolicy && a.BiddingClosesAt.Equal(b.BiddingClosesAt)
+}
+
+// Declarative configuration handlers
+
+func (h *ShiftHandler) handleGetDeclaredShifts(c *gin.Context) {
+	h = h.forRequest(c)
+	shifts, err := h.shifts.ListDeclared()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve shifts")
+		return
+	}
+	if shifts == nil {
+		shifts = []OpenShift{}
+	}
+	c.JSON(http.StatusOK, gin.H{"shifts": shifts, "count": len(shifts)})
+}
+
+func (h *ShiftHandler) handleGetDeclaredShift(c *gin.Context) {
+	h = h.forRequest(c)
+	name, ok := configNameFromParam(c)
+	if !ok {
+		return
+	}
+
+	shift, err := h.shifts.GetDeclared(name)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if shift == nil {
+		respondError(c, http.StatusNotFound, "No shift is declared under this name")
+		return
+	}
+	c.JSON(http.StatusOK, shift)
+}
+
+// handlePutDeclaredShift applies a shift definition: 201 when it creates the
+// shift, 200 when it updates it or the definition already matches
+func (h *ShiftHandler) handlePutDeclaredShift(c *gin.Context) {
+	h = h.forRequest(c)
+	name, ok := configNameFromParam(c)
+	if !ok {
+		return
+	}
+	var req CreateShiftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, &req, err)
+		return
+	}
+	shift := parseShiftRequest(c, req)
+	if shift == nil {
+		return
+	}
+
+	created, changed, err := h.shifts.PutDeclared(name, shift, clock.Now())
+	switch {
+	case errors.Is(err, errBiddingClosed):
+		respondInvalidField(c, "bidding_closes_at", err.Error())
+		return
+	case errors.Is(err, errShiftSpecLocked):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": newAPIError(http.StatusConflict, "Shift "+name+" has bids or has been taken up, so its definition can no longer change"),
+			"shift": shift,
+		})
+		return
+	case err != nil:
+		respondError(c, http.StatusInternalServerError, "Failed to apply shift")
+		return
+	}
+
+	c.Header("X-Config-Changed", strconv.FormatBool(changed))
+	if created {
+		c.JSON(http.StatusCreated, shift)
+		return
+	}
+	c.JSON(http.StatusOK, shift)
+}
+
+// handleDeleteDeclaredShift withdraws a declared shift. Deleting a name with
+// nothing declared succeeds, so a repeated delete is harmless.
+func (h *ShiftHandler) handleDeleteDeclaredShift(c *gin.Context) {
+	h = h.forRequest(c)
+	name, ok := configNameFromParam(c)
+	if !ok {
+		return
+	}
+
+	shift, err := h.shifts.DeleteDeclared(name)
+	switch {
+	case errors.Is(err, errShiftSpecLocked):
+		respondError(c, http.StatusConflict, "Shift "+name+" has been claimed or awarded and can't be withdrawn")
+		return
+	case err != nil:
+		respondError(c, http.StatusInternalServerError, "Failed to delete shift")
+		return
+	}
+	if shift != nil {
+		c.JSON(http.StatusOK, shift)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
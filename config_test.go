@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfigNamePattern(t *testing.T) {
+	for name, want := range map[string]bool{
+		"north-depot.weekday-early": true,
+		"route_12":                  true,
+		"9am":                       true,
+		"":                          false,
+		"-leading-dash":             false,
+		"Upper":                     false,
+		"has space":                 false,
+		"slash/name":                false,
+	} {
+		if got := configNamePattern.MatchString(name); got != want {
+			t.Errorf("configNamePattern.MatchString(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestSameShiftSpec(t *testing.T) {
+	end := date("2030-01-31")
+	declared := OpenShift{BusID: 1, Role: "driver", StartDate: date("2030-01-01"), EndDate: &end,
+		Mode: ShiftModeBid, AwardPolicy: AwardPolicySeniority, BiddingClosesAt: date("2029-12-20")}
+
+	// State the service manages doesn't count as a change
+	stored := declared
+	stored.ID, stored.Status, stored.CreatedBy = 7, "awarded", "someone-else"
+	sameEnd := end.Add(0)
+	stored.EndDate = &sameEnd
+	if !sameShiftSpec(&declared, &stored) {
+		t.Error("shifts differing only in managed state should match")
+	}
+
+	changes := map[string]func(*OpenShift){
+		"bus":      func(s *OpenShift) { s.BusID = 2 },
+		"end date": func(s *OpenShift) { s.EndDate = nil },
+		"closing":  func(s *OpenShift) { s.BiddingClosesAt = s.BiddingClosesAt.Add(time.Hour) },
+		"policy":   func(s *OpenShift) { s.AwardPolicy = AwardPolicyFairness },
+	}
+	for name, change := range changes {
+		changed := declared
+		change(&changed)
+		if sameShiftSpec(&declared, &changed) {
+			t.Errorf("changing the %s should not match", name)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Defaults for the headers browsers may send and read, covering the bearer
+// token, optimistic locking and trace propagation
+const (
+	defaultCORSHeaders        = "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Accept, Origin, Cache-Control, X-Requested-With, If-Match, X-Depot-ID, traceparent, tracestate"
+	defaultCORSMethods        = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	defaultCORSExposedHeaders = "ETag"
+)
+
+// CORSConfig controls which browser origins may call the API
+type CORSConfig struct {
+	Origins          []string // exact origins, https://*.example.com patterns, or * for any
+	Headers          string
+	Methods          string
+	ExposedHeaders   string
+	MaxAge           time.Duration // how long browsers may cache a preflight
+	AllowCredentials bool
+}
+
+// LoadCORSConfig reads CORS_ALLOWED_ORIGINS (comma-separated; unset refuses
+// every cross-origin request), CORS_ALLOWED_HEADERS, CORS_ALLOWED_METHODS,
+// CORS_EXPOSED_HEADERS, CORS_MAX_AGE (default 10m) and
+// CORS_ALLOW_CREDENTIALS (default false). Credentials are never allowed
+// together with the * origin, since browsers reject that combination.
+func LoadCORSConfig() CORSConfig {
+	cfg := CORSConfig{
+		Headers:          envOrDefault("CORS_ALLOWED_HEADERS", defaultCORSHeaders),
+		Methods:          envOrDefault("CORS_ALLOWED_METHODS", defaultCORSMethods),
+		ExposedHeaders:   envOrDefault("CORS_EXPOSED_HEADERS", defaultCORSExposedHeaders),
+		MaxAge:           durationFromEnv("CORS_MAX_AGE", 10*time.Minute),
+		AllowCredentials: os.Getenv("CORS_ALLOW_CREDENTIALS") == "true",
+	}
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSuffix(strings.TrimSpace(origin), "/"); origin != "" {
+			cfg.Origins = append(cfg.Origins, origin)
+		}
+	}
+
+	if cfg.AllowCredentials && cfg.allowsAnyOrigin() {
+		log.Println("CORS_ALLOW_CREDENTIALS=true cannot be combined with the * origin; credentials are not allowed")
+		cfg.AllowCredentials = false
+	}
+	return cfg
+}
+
+// envOrDefault returns the variable, or the fallback when it is unset or blank
+func envOrDefault(key, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func (cfg CORSConfig) allowsAnyOrigin() bool {
+	for _, origin := range cfg.Origins {
+		if origin == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// allows reports whether the origin matches an exact entry or a wildcard
+// subdomain pattern. https://*.example.com matches https://a.example.com and
+// https://a.b.example.com but not https://example.com or another scheme or port.
+func (cfg CORSConfig) allows(origin string) bool {
+	for _, allowed := range cfg.Origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		prefix, suffix, found := strings.Cut(allowed, "*.")
+		if !found || len(origin) <= len(prefix)+len(suffix)+1 {
+			continue
+		}
+		lower := strings.ToLower(origin)
+		if !strings.HasPrefix(lower, strings.ToLower(prefix)) || !strings.HasSuffix(lower, "."+strings.ToLower(suffix)) {
+			continue
+		}
+		subdomain := lower[len(prefix) : len(lower)-len(suffix)-1]
+		if subdomain != "" && !strings.ContainsAny(subdomain, "/:@?#") {
+			return true
+		}
+	}
+	return false
+}
+
+// cors answers preflight requests and adds CORS headers for allowed origins.
+// Requests from other origins get no CORS headers, so browsers refuse to
+// hand them the response, and their preflights are rejected.
+func cors(cfg CORSConfig) gin.HandlerFunc {
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Origin")
+		if !cfg.allows(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if cfg.allowsAnyOrigin() && !cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+		c.Header("Access-Control-Expose-Headers", cfg.ExposedHeaders)
+
+		if preflight {
+			c.Header("Access-Control-Allow-Methods", cfg.Methods)
+			c.Header("Access-Control-Allow-Headers", cfg.Headers)
+			c.Header("Access-Control-Max-Age", maxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCORSOriginMatching(t *testing.T) {
+	cfg := CORSConfig{Origins: []string{"https://dispatch.example.com", "https://*.depots.example.com"}}
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://dispatch.example.com", true},
+		{"https://DISPATCH.example.com", true},
+		{"https://north.depots.example.com", true},
+		{"https://a.north.depots.example.com", true},
+		{"https://depots.example.com", false},
+		{"https://.depots.example.com", false},
+		{"http://north.depots.example.com", false},
+		{"https://north.depots.example.com:8443", false},
+		{"https://evil.com/.depots.example.com", false},
+		{"https://north.depots.example.com.evil.com", false},
+		{"https://other.example.com", false},
+	}
+	for _, tt := range tests {
+		if got := cfg.allows(tt.origin); got != tt.want {
+			t.Errorf("allows(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestCORSHeaders(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://dispatch.example.com, https://*.depots.example.com")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	t.Setenv("CORS_MAX_AGE", "1h")
+	router, _ := newTestRouter(t)
+
+	rec := doRequest(router, http.MethodOptions, "/api/assignments", nil,
+		"Origin", "https://north.depots.example.com", "Access-Control-Request-Method", "POST")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("preflight status = %d, want 204", rec.Code)
+	}
+	headers := rec.Header()
+	if got := headers.Get("Access-Control-Allow-Origin"); got != "https://north.depots.example.com" {
+		t.Errorf("Allow-Origin = %q, want the caller's origin", got)
+	}
+	if headers.Get("Access-Control-Allow-Credentials") != "true" || headers.Get("Access-Control-Max-Age") != "3600" {
+		t.Errorf("preflight headers = %v, want credentials and a one-hour max age", headers)
+	}
+	if headers.Get("Vary") != "Origin" {
+		t.Errorf("Vary = %q, want Origin", headers.Get("Vary"))
+	}
+
+	rec = doRequest(router, http.MethodGet, "/api/assignments", nil, "Origin", "https://dispatch.example.com")
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://dispatch.example.com" ||
+		rec.Header().Get("Access-Control-Expose-Headers") != "ETag" {
+		t.Errorf("simple request headers = %v", rec.Header())
+	}
+
+	rec = doRequest(router, http.MethodOptions, "/api/assignments", nil,
+		"Origin", "https://evil.example.org", "Access-Control-Request-Method", "DELETE")
+	if rec.Code != http.StatusForbidden || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("disallowed preflight = %d %v, want 403 without CORS headers", rec.Code, rec.Header())
+	}
+	rec = doRequest(router, http.MethodGet, "/api/assignments", nil, "Origin", "https://evil.example.org")
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("disallowed request = %d %v, want no CORS headers", rec.Code, rec.Header())
+	}
+}
+
+func TestCORSWildcardNeverAllowsCredentials(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "*")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	router, _ := newTestRouter(t)
+
+	rec := doRequest(router, http.MethodGet, "/api/assignments", nil, "Origin", "https://anywhere.example")
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Allow-Origin = %q, want *", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Allow-Credentials = %q with the * origin, want unset", got)
+	}
+}
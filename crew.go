@@ -0,0 +1,246 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Crew statuses
+const (
+	CrewComplete   = "complete"
+	CrewIncomplete = "incomplete"
+	CrewUnstaffed  = "unstaffed"  // no active assignments, so the bus is not in service
+	CrewNoService  = "no_service" // the depot's calendar runs no service that day
+)
+
+// requiredCrewRoles are the roles a bus needs whenever anyone is working it
+var requiredCrewRoles = []string{"driver", "conductor"}
+
+// CrewGap is a stretch of the day during which a crewed bus lacks a role
+type CrewGap struct {
+	Role string    `json:"role"`
+	From TimeOfDay `json:"from"`
+	To   TimeOfDay `json:"to"`
+}
+
+// CrewStatus reports whether a bus has a full crew on a date
+type CrewStatus struct {
+	BusID          int                     `json:"bus_id"`
+	BusPlateNumber string                  `json:"bus_plate_number,omitempty"`
+	Date           string                  `json:"date"` // YYYY-MM-DD
+	Status         string                  `json:"status"`
+	Service        ServiceDay              `json:"service"` // from the depot's calendar
+	Missing        []string                `json:"missing"`
+	Gaps           []CrewGap               `json:"gaps,omitempty"`
+	Crew           []AssignmentWithDetails `json:"crew"`
+}
+
+// shiftInterval returns the part of the day an assignment is worked
+func shiftInterval(assignment *Assignment) (TimeOfDay, TimeOfDay) {
+	if assignment.ShiftStart == nil {
+		return 0, endOfDay
+	}
+	return *assignment.ShiftStart, *assignment.ShiftEnd
+}
+
+// crewGaps finds the times at which someone is working the bus but a
+// required role is not covered. A bus with a morning driver and an evening
+// conductor has a gap for each role.
+func crewGaps(crew []Assignment) []CrewGap {
+	var breakpoints []TimeOfDay
+	for i := range crew {
+		start, end := shiftInterval(&crew[i])
+		breakpoints = append(breakpoints, start, end)
+	}
+	sort.Slice(breakpoints, func(i, j int) bool { return breakpoints[i] < breakpoints[j] })
+
+	var gaps []CrewGap
+	for i := 0; i+1 < len(breakpoints); i++ {
+		from, to := breakpoints[i], breakpoints[i+1]
+		if from == to {
+			continue
+		}
+
+		covered := map[string]bool{}
+		for j := range crew {
+			if start, end := shiftInterval(&crew[j]); start <= from && end >= to {
+				covered[crew[j].Role] = true
+			}
+		}
+		if len(covered) == 0 {
+			continue // nobody is working the bus
+		}
+
+		for _, role := range requiredCrewRoles {
+			if covered[role] {
+				continue
+			}
+			if n := len(gaps); n > 0 && gaps[n-1].Role == role && gaps[n-1].To == from {
+				gaps[n-1].To = to
+				continue
+			}
+			gaps = append(gaps, CrewGap{Role: role, From: from, To: to})
+		}
+	}
+	return gaps
+}
+
+// serviceGaps keeps the parts of the gaps that fall within service hours
+func serviceGaps(gaps []CrewGap, service ServiceDay) []CrewGap {
+	start, end := service.Hours()
+	var kept []CrewGap
+	for _, gap := range gaps {
+		gap.From, gap.To = max(gap.From, start), min(gap.To, end)
+		if gap.From < gap.To {
+			kept = append(kept, gap)
+		}
+	}
+	return kept
+}
+
+// newCrewStatus checks the crew one bus has on a roster day, given the
+// service its depot runs. Nothing is missing on a day without service, and
+// gaps only count during service hours.
+func newCrewStatus(bus RosterBus, date string, service ServiceDay) CrewStatus {
+	status := CrewStatus{
+		BusID:          bus.BusID,
+		BusPlateNumber: bus.BusPlateNumber,
+		Date:           date,
+		Status:         CrewComplete,
+		Service:        service,
+		Missing:        []string{},
+		Crew:           bus.Crew,
+	}
+	if status.Crew == nil {
+		status.Crew = []AssignmentWithDetails{}
+	}
+	if service.Level == ServiceNone {
+		status.Status = CrewNoService
+		return status
+	}
+	if len(bus.Crew) == 0 {
+		status.Status = CrewUnstaffed
+		status.Missing = append(status.Missing, requiredCrewRoles...)
+		return status
+	}
+
+	crew := make([]Assignment, len(bus.Crew))
+	for i, member := range bus.Crew {
+		crew[i] = member.Assignment
+	}
+	status.Gaps = serviceGaps(crewGaps(crew), service)
+	for _, role := range requiredCrewRoles {
+		for _, gap := range status.Gaps {
+			if gap.Role == role {
+				status.Missing = append(status.Missing, role)
+				break
+			}
+		}
+	}
+	if len(status.Missing) > 0 {
+		status.Status = CrewIncomplete
+	}
+	return status
+}
+
+// crewDate reads the optional date query parameter, defaulting to today. It
+// returns false once an error response has been written.
+func crewDate(c *gin.Context) (time.Time, bool) {
+	dateStr := c.Query("date")
+	if dateStr == "" {
+		return today(), true
+	}
+	date, err := time.Parse("2006-01-02", dateStr)
+	if err != nil {
+		respondInvalidField(c, "date", "Invalid date. Use YYYY-MM-DD")
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+func (h *AssignmentHandler) handleGetBusCrewStatus(c *gin.Context) {
+	h = h.forRequest(c)
+	busID, err := strconv.Atoi(c.Param("busId"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid bus ID")
+		return
+	}
+	date, ok := crewDate(c)
+	if !ok {
+		return
+	}
+
+	assignments, err := h.repo.ListInRange(date, date, busID, callerClearance(c))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve crew")
+		return
+	}
+	calendar, err := h.calendars.Get(busDepot(busID))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve depot calendar")
+		return
+	}
+
+	bus := RosterBus{BusID: busID}
+	if details := lookupBus(busID); details != nil {
+		bus.BusPlateNumber = details["plate_number"]
+	}
+	if buses := buildRoster(assignments, date, date)[0].Buses; len(buses) > 0 {
+		bus = buses[0]
+	}
+
+	c.JSON(http.StatusOK, newCrewStatus(bus, date.Format("2006-01-02"), calendar.ServiceOn(date)))
+}
+
+// handleGetCrewStatus validates every bus crewed on the date, optionally
+// limited to a depot or to the incomplete ones
+func (h *AssignmentHandler) handleGetCrewStatus(c *gin.Context) {
+	h = h.forRequest(c)
+	date, ok := crewDate(c)
+	if !ok {
+		return
+	}
+	depot, ok := depotQuery(c)
+	if !ok {
+		return
+	}
+	incompleteOnly := c.Query("incomplete") == "true"
+
+	assignments, err := h.repo.ListInRange(date, date, 0, callerClearance(c))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve crew")
+		return
+	}
+	calendars, err := depotCalendars(h.calendars)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve depot calendars")
+		return
+	}
+
+	day := buildRoster(assignments, date, date)[0]
+	statuses := []CrewStatus{}
+	incomplete := 0
+	for _, bus := range day.Buses {
+		if depot != "" && busDepot(bus.BusID) != depot {
+			continue
+		}
+		status := newCrewStatus(bus, day.Date, calendars[busDepot(bus.BusID)].ServiceOn(date))
+		if status.Status == CrewIncomplete {
+			incomplete++
+		} else if incompleteOnly {
+			continue
+		}
+		statuses = append(statuses, status)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"date":       day.Date,
+		"buses":      statuses,
+		"count":      len(statuses),
+		"incomplete": incomplete,
+	})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGetBusCrewStatus(t *testing.T) {
+	router, repo := newTestRouter(t)
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 2, Role: "conductor", StartDate: date("2025-01-01")})
+	end := date("2024-12-31")
+	mustCreate(t, repo, Assignment{BusID: 2, StaffID: 2, Role: "conductor", StartDate: date("2024-01-01"), EndDate: &end})
+
+	tests := []struct {
+		path        string
+		wantStatus  string
+		wantMissing []string
+	}{
+		{"/api/buses/1/crew-status?date=2025-03-01", CrewComplete, nil},
+		{"/api/buses/2/crew-status?date=2024-06-01", CrewIncomplete, []string{"driver"}},
+		{"/api/buses/2/crew-status?date=2025-03-01", CrewUnstaffed, []string{"driver", "conductor"}},
+	}
+
+	for _, tt := range tests {
+		rec := doRequest(router, http.MethodGet, tt.path, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d: %s", tt.path, rec.Code, http.StatusOK, rec.Body.String())
+		}
+		got := decode[CrewStatus](t, rec)
+		if got.Status != tt.wantStatus {
+			t.Errorf("%s: status = %q, want %q", tt.path, got.Status, tt.wantStatus)
+		}
+		if len(got.Missing) != len(tt.wantMissing) {
+			t.Errorf("%s: missing = %v, want %v", tt.path, got.Missing, tt.wantMissing)
+			continue
+		}
+		for i, role := range tt.wantMissing {
+			if got.Missing[i] != role {
+				t.Errorf("%s: missing = %v, want %v", tt.path, got.Missing, tt.wantMissing)
+			}
+		}
+	}
+
+	if rec := doRequest(router, http.MethodGet, "/api/buses/1/crew-status?date=tomorrow", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid date status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCrewGapsFollowShiftTimes(t *testing.T) {
+	morning, noon, evening := TimeOfDay(6*60), TimeOfDay(12*60), TimeOfDay(18*60)
+	crew := []Assignment{
+		{Role: "driver", ShiftStart: &morning, ShiftEnd: &evening},
+		{Role: "conductor", ShiftStart: &noon, ShiftEnd: &evening},
+	}
+
+	gaps := crewGaps(crew)
+	if len(gaps) != 1 {
+		t.Fatalf("gaps = %+v, want one", gaps)
+	}
+	if gap := gaps[0]; gap.Role != "conductor" || gap.From != morning || gap.To != noon {
+		t.Errorf("gap = %+v, want conductor from 06:00 to 12:00", gap)
+	}
+}
+
+func TestGetCrewStatus(t *testing.T) {
+	router, repo := newTestRouter(t)
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 2, Role: "conductor", StartDate: date("2025-01-01")})
+	mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-01-01")})
+
+	tests := []struct {
+		query          string
+		wantCount      int
+		wantIncomplete int
+	}{
+		{"?date=2025-03-01", 2, 1},
+		{"?date=2025-03-01&incomplete=true", 1, 1},
+		{"?date=2025-03-01&depot=north", 1, 0},
+	}
+
+	for _, tt := range tests {
+		rec := doRequest(router, http.MethodGet, "/api/crew-status"+tt.query, nil)
+		body := decode[struct {
+			Buses      []CrewStatus
+			Count      int
+			Incomplete int
+		}](t, rec)
+		if body.Count != tt.wantCount || body.Incomplete != tt.wantIncomplete {
+			t.Errorf("%q: count = %d, incomplete = %d, want %d and %d",
+				tt.query, body.Count, body.Incomplete, tt.wantCount, tt.wantIncomplete)
+		}
+	}
+}
+
+func TestCrewStatusFollowsDepotCalendar(t *testing.T) {
+	router, repo := newTestRouter(t)
+	midnight, evening, late := TimeOfDay(0), TimeOfDay(18*60), TimeOfDay(24*60)
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 2, Role: "conductor", StartDate: date("2025-01-01"),
+		ShiftStart: &midnight, ShiftEnd: &evening})
+	mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-01-01"),
+		ShiftStart: &evening, ShiftEnd: &late})
+
+	// North runs until 18:00 on Sundays and not at all on Saturdays
+	calendar := map[string]any{"days": map[string]any{
+		"sun": map[string]any{"level": "reduced", "from": "06:00", "to": "18:00"},
+		"sat": map[string]any{"level": "none"},
+	}}
+	if rec := doRequest(router, http.MethodPut, "/api/config/depot-calendars/north", calendar); rec.Code != http.StatusCreated {
+		t.Fatalf("PUT calendar: status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	tests := []struct {
+		path       string
+		wantStatus string
+	}{
+		{"/api/buses/1/crew-status?date=2025-03-03", CrewIncomplete}, // Monday: no conductor after 18:00
+		{"/api/buses/1/crew-status?date=2025-03-02", CrewComplete},   // Sunday: service ends at 18:00
+		{"/api/buses/1/crew-status?date=2025-03-01", CrewNoService},  // Saturday
+		{"/api/buses/3/crew-status?date=2025-03-01", CrewIncomplete}, // south has no calendar
+	}
+	for _, tt := range tests {
+		rec := doRequest(router, http.MethodGet, tt.path, nil)
+		if got := decode[CrewStatus](t, rec); got.Status != tt.wantStatus {
+			t.Errorf("%s: status = %q, want %q (gaps %+v)", tt.path, got.Status, tt.wantStatus, got.Gaps)
+		}
+	}
+
+	rec := doRequest(router, http.MethodGet, "/api/crew-status?date=2025-03-01&incomplete=true", nil)
+	body := decode[struct {
+		Buses      []CrewStatus
+		Incomplete int
+	}](t, rec)
+	if body.Incomplete != 1 || len(body.Buses) != 1 || body.Buses[0].BusID != 3 {
+		t.Errorf("Saturday incomplete buses = %+v, want only bus 3", body.Buses)
+	}
+}
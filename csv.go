@@ -0,0 +1,487 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"bus-staff-assignment/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportSize caps CSV uploads to keep a single import transaction reasonable
+const maxImportSize = 5 << 20
+
+var csvExportHeader = []string{
+	"id", "reference", "external_ref", "bus_id", "staff_id", "role", "start_date", "end_date",
+	"working_days", "shift_start", "shift_end", "status", "pay_class", "holiday_dates", "created_at", "updated_at",
+	"deleted_at",
+}
+
+// ImportRow is a parsed CSV row awaiting creation
+type ImportRow struct {
+	Row        int
+	Assignment Assignment
+}
+
+// ImportRowError lists everything wrong with one CSV row. Row numbers count
+// the header as row 1, matching what spreadsheets show.
+type ImportRowError struct {
+	Row    int      `json:"row"`
+	Errors []string `json:"errors"`
+}
+
+// importRejectedError aborts the import transaction when any row conflicts
+type importRejectedError struct {
+	rows []ImportRowError
+}
+
+func (e *importRejectedError) Error() string {
+	return fmt.Sprintf("%d row(s) rejected", len(e.rows))
+}
+
+// formatTimeOfDay writes a shift time as HH:MM, or an empty cell for a whole-day assignment
+func formatTimeOfDay(t *TimeOfDay) string {
+	if t == nil {
+		return ""
+	}
+	return t.String()
+}
+
+// formatWorkingDays writes a day mask as "mon;wed;fri" so it fits in one CSV cell
+func formatWorkingDays(mask DayMask) string {
+	return strings.Join(mask.Days(), ";")
+}
+
+func (h *AssignmentHandler) handleExportAssignments(c *gin.Context) {
+	h = h.forRequest(c)
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "anonymized" {
+		respondInvalidField(c, "format", "Unsupported export format. Use csv or anonymized")
+		return
+	}
+
+	filter, ok := parseAssignmentFilter(c)
+	if !ok {
+		return
+	}
+	if format == "anonymized" {
+		h.exportAnonymized(c, filter)
+		return
+	}
+
+	started := func(asOf time.Time) {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="assignments.csv"`)
+		c.Header(snapshotHeader, asOf.UTC().Format(time.RFC3339Nano))
+		c.Status(http.StatusOK)
+	}
+	_, rows, err := exportAssignmentsCSV(c.Writer, h.repo, filter, started)
+	if err != nil && !c.Writer.Written() {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve assignments")
+		return
+	}
+	if err != nil {
+		// Too late for an error response; the client gets a truncated file
+		log.Printf("Export failed after %d rows: %v", rows, err)
+	}
+}
+
+// snapshotHeader carries the time an export's snapshot was taken; the export
+// has every change committed before it and none after
+const snapshotHeader = "X-Snapshot-At"
+
+// exportAssignmentsCSV writes one snapshot of the assignments matching the
+// filter in the payroll export's columns, a page at a time. started, if
+// given, gets the snapshot's time before anything is written.
+func exportAssignmentsCSV(w io.Writer, repo AssignmentRepository, filter AssignmentFilter,
+	started func(asOf time.Time)) (time.Time, int, error) {
+	writer := csv.NewWriter(w)
+	var snapshot time.Time
+	rows := 0
+	err := repo.ExportSnapshot(filter, func(asOf time.Time, page []Assignment) error {
+		if snapshot.IsZero() {
+			snapshot = asOf
+			if started != nil {
+				started(asOf)
+			}
+			writer.Write(csvExportHeader)
+		}
+		writeAssignmentRows(writer, page)
+		rows += len(page)
+		writer.Flush()
+		return writer.Error()
+	})
+	return snapshot, rows, err
+}
+
+// snapshotAssignments collects one snapshot of the assignments matching the
+// filter, for exports that need every row before writing any
+func snapshotAssignments(repo AssignmentRepository, filter AssignmentFilter) (time.Time, []Assignment, error) {
+	var snapshot time.Time
+	var assignments []Assignment
+	err := repo.ExportSnapshot(filter, func(asOf time.Time, page []Assignment) error {
+		snapshot = asOf
+		assignments = append(assignments, page...)
+		return nil
+	})
+	return snapshot, assignments, err
+}
+
+// writeAssignmentRows writes the assignments in the payroll export's columns
+func writeAssignmentRows(writer *csv.Writer, assignments []Assignment) {
+	for _, assignment := range assignments {
+		endDate := ""
+		if assignment.EndDate != nil {
+			endDate = assignment.EndDate.Format("2006-01-02")
+		}
+		deletedAt := "" // only set in exports passing include_deleted
+		if assignment.DeletedAt != nil {
+			deletedAt = assignment.DeletedAt.Format(time.RFC3339)
+		}
+		payClass, holidayDates := publicHolidays.PayClass(&assignment)
+		writer.Write([]string{
+			assignment.PublicID,
+			assignment.Reference,
+			assignment.ExternalRef,
+			strconv.Itoa(assignment.BusID),
+			strconv.Itoa(assignment.StaffID),
+			assignment.Role,
+			assignment.StartDate.Format("2006-01-02"),
+			endDate,
+			formatWorkingDays(assignment.WorkingDays),
+			formatTimeOfDay(assignment.ShiftStart),
+			formatTimeOfDay(assignment.ShiftEnd),
+			assignment.Status,
+			payClass,
+			strings.Join(holidayDates, ";"),
+			assignment.CreatedAt.Format(time.RFC3339),
+			assignment.UpdatedAt.Format(time.RFC3339),
+			deletedAt,
+		})
+	}
+}
+
+// parseImportCSV reads and validates every row, collecting all row errors
+// rather than stopping at the first so users can fix the sheet in one pass
+func parseImportCSV(r io.Reader) ([]ImportRow, []ImportRowError, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil, errors.New("CSV file is empty")
+		}
+		return nil, nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"bus_id", "staff_id", "role", "start_date"} {
+		if _, exists := columns[required]; !exists {
+			return nil, nil, fmt.Errorf("CSV header is missing required column %q", required)
+		}
+	}
+
+	var rows []ImportRow
+	var rowErrors []ImportRowError
+	externalRefRows := map[string]int{}
+	for rowNumber := 2; ; rowNumber++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		field := func(name string) string {
+			if i, exists := columns[name]; exists && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		var problems []string
+		assignment := Assignment{Role: field("role"), Status: "active"}
+
+		if assignment.BusID, err = strconv.Atoi(field("bus_id")); err != nil || assignment.BusID <= 0 {
+			problems = append(problems, "bus_id must be a positive integer")
+		}
+		if assignment.StaffID, err = strconv.Atoi(field("staff_id")); err != nil || assignment.StaffID <= 0 {
+			problems = append(problems, "staff_id must be a positive integer")
+		}
+		if assignment.StartDate, err = time.Parse("2006-01-02", field("start_date")); err != nil {
+			problems = append(problems, "Invalid start_date format. Use YYYY-MM-DD")
+		}
+		if value := field("end_date"); value != "" {
+			endDate, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				problems = append(problems, "Invalid end_date format. Use YYYY-MM-DD")
+			} else {
+				assignment.EndDate = &endDate
+			}
+		}
+		if value := field("working_days"); value != "" {
+			if assignment.WorkingDays, err = ParseDayMask(strings.Split(value, ";")); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+		parseShiftTime := func(column string) *TimeOfDay {
+			value := field(column)
+			if value == "" {
+				return nil
+			}
+			parsed, err := ParseTimeOfDay(value)
+			if err != nil {
+				problems = append(problems, column+": "+err.Error())
+				return nil
+			}
+			return &parsed
+		}
+		assignment.ShiftStart = parseShiftTime("shift_start")
+		assignment.ShiftEnd = parseShiftTime("shift_end")
+		if assignment.ExternalRef = field("external_ref"); assignment.ExternalRef != "" {
+			if earlier, exists := externalRefRows[assignment.ExternalRef]; exists {
+				problems = append(problems, fmt.Sprintf("external_ref is repeated from row %d", earlier))
+			} else {
+				externalRefRows[assignment.ExternalRef] = rowNumber
+			}
+		}
+		if len(problems) == 0 {
+			if fieldErr := validateAssignment(&assignment); fieldErr != nil {
+				problems = append(problems, fieldErr.Message)
+			}
+		}
+
+		if len(problems) > 0 {
+			rowErrors = append(rowErrors, ImportRowError{Row: rowNumber, Errors: problems})
+			continue
+		}
+		rows = append(rows, ImportRow{Row: rowNumber, Assignment: assignment})
+	}
+
+	return rows, rowErrors, nil
+}
+
+// importCheck returns why a row can't be imported for reasons the repository
+// doesn't check itself, such as staff availability, or "" when it can
+type importCheck func(assignment *Assignment) (string, error)
+
+// importAssignments creates every row. Each row is conflict-checked against
+// the stored assignments including rows created earlier in the same import,
+// and against deletion holds, existing external references and the check; if
+// any row is refused it returns an importRejectedError so the repository
+// creates nothing.
+func importAssignments(tx assignmentTx, rows []ImportRow, actor string, check importCheck) ([]Assignment, error) {
+	created := make([]Assignment, 0, len(rows))
+	var rowErrors []ImportRowError
+	for _, row := range rows {
+		assignment := row.Assignment
+
+		if assignment.ExternalRef != "" {
+			existing, err := tx.byRef(assignment.ExternalRef)
+			if err != nil {
+				return nil, err
+			}
+			if len(existing) > 0 {
+				rowErrors = append(rowErrors, ImportRowError{
+					Row:    row.Row,
+					Errors: []string{"external_ref is already used by assignment " + existing[0].Reference},
+				})
+				continue
+			}
+		}
+
+		conflicts, err := tx.conflicts(&assignment)
+		if err != nil {
+			return nil, err
+		}
+		if len(conflicts) > 0 {
+			ids := make([]string, len(conflicts))
+			for i, conflict := range conflicts {
+				ids[i] = conflict.PublicID
+			}
+			rowErrors = append(rowErrors, ImportRowError{
+				Row:    row.Row,
+				Errors: []string{"conflicts with active assignment(s) " + strings.Join(ids, ", ")},
+			})
+			continue
+		}
+
+		hold, err := tx.deletionHeld(&assignment)
+		if err != nil {
+			return nil, err
+		}
+		if hold != nil {
+			rowErrors = append(rowErrors, ImportRowError{
+				Row:    row.Row,
+				Errors: []string{(&DeletionHoldError{Hold: *hold}).Error()},
+			})
+			continue
+		}
+
+		problem, err := check(&assignment)
+		if err != nil {
+			return nil, err
+		}
+		if problem != "" {
+			rowErrors = append(rowErrors, ImportRowError{Row: row.Row, Errors: []string{problem}})
+			continue
+		}
+
+		if err := tx.create(&assignment, actor); err != nil {
+			return nil, err
+		}
+		created = append(created, assignment)
+	}
+
+	if len(rowErrors) > 0 {
+		return nil, &importRejectedError{rows: rowErrors}
+	}
+	return created, nil
+}
+
+// importOutcome separates the rows an import refused from its failures
+func importOutcome(created []Assignment, err error) ([]Assignment, []ImportRowError, error) {
+	var rejected *importRejectedError
+	if errors.As(err, &rejected) {
+		return nil, rejected.rows, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return created, nil, nil
+}
+
+// importRules checks imported rows against staff availability and
+// qualifications, as creating each assignment on its own would
+func (h *AssignmentHandler) importRules(c *gin.Context) importCheck {
+	return func(assignment *Assignment) (string, error) {
+		unavailable, err := unavailableFor(h.availability, assignment)
+		if err != nil {
+			return "", err
+		}
+		if len(unavailable) > 0 && enforceRule(c, apierror.RuleStaffAvailability,
+			unavailableMessage(assignment.StaffID, unavailable)) {
+			return "staff member is unavailable (" + unavailable[0].Type + ") during the assignment", nil
+		}
+
+		if qualificationPolicy.Mode == QualificationOff {
+			return "", nil
+		}
+		problem, err := qualificationProblem(h.qualifications, assignment)
+		if err != nil || problem == nil {
+			return "", err
+		}
+		if qualificationPolicy.Mode == QualificationFlag {
+			log.Printf("Unqualified assignment imported by %s: %s", actorFromContext(c), problem.message())
+			return "", nil
+		}
+		if enforceRule(c, apierror.RuleStaffQualification, problem.message()) {
+			return problem.message(), nil
+		}
+		return "", nil
+	}
+}
+
+func (h *AssignmentHandler) handleImportAssignments(c *gin.Context) {
+	h = h.forRequest(c)
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+
+	// Accept either a multipart upload in the "file" field or a raw text/csv body
+	var source io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, _, err := c.Request.FormFile("file")
+		if err != nil {
+			respondInvalidField(c, "file", "Expected a CSV upload in the 'file' form field")
+			return
+		}
+		defer file.Close()
+		source = file
+	}
+
+	rows, rowErrors, err := parseImportCSV(source)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(rowErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": newAPIError(http.StatusUnprocessableEntity, "CSV contains invalid rows, nothing was imported"), "rows": rowErrors})
+		return
+	}
+	if len(rows) == 0 {
+		respondError(c, http.StatusBadRequest, "CSV contains no assignment rows")
+		return
+	}
+
+	clearance := callerClearance(c)
+	for _, row := range rows {
+		if depot := busDepot(row.Assignment.BusID); !clearance.AllowsDepot(depot) {
+			rowErrors = append(rowErrors, ImportRowError{Row: row.Row,
+				Errors: []string{fmt.Sprintf("bus %d is at depot %s, outside yours", row.Assignment.BusID, depot)}})
+		}
+	}
+	if len(rowErrors) > 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": newAPIError(http.StatusForbidden, "CSV contains rows at other depots, nothing was imported"), "rows": rowErrors})
+		return
+	}
+
+	now := clock.Now()
+	for _, row := range rows {
+		if !schedulingHorizon.Allows(row.Assignment.StartDate, now) {
+			rowErrors = append(rowErrors, ImportRowError{Row: row.Row, Errors: []string{schedulingHorizon.message()}})
+		}
+	}
+	if len(rowErrors) > 0 {
+		override, ok := horizonOverride(c)
+		if !ok {
+			return
+		}
+		if !override {
+			// Rows are only refused while the rule is enforced
+			enforced := rowErrors[:0]
+			for _, rowErr := range rowErrors {
+				if enforceRule(c, apierror.RuleSchedulingHorizon, fmt.Sprintf("row %d: %s", rowErr.Row, rowErr.Errors[0])) {
+					enforced = append(enforced, rowErr)
+				}
+			}
+			if len(enforced) > 0 {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": newAPIError(http.StatusUnprocessableEntity, "CSV contains invalid rows, nothing was imported"), "rows": enforced})
+				return
+			}
+		}
+	}
+
+	imported := make([]Assignment, len(rows))
+	for i, row := range rows {
+		imported[i] = row.Assignment
+	}
+	guard := newBulkGuard(c)
+	if err := guard.check(newBulkImpact("import", imported, nil)); err != nil {
+		respondBulkConfirmation(c, err)
+		return
+	}
+
+	created, rowErrors, err := h.repo.Import(rows, actorFromContext(c), h.importRules(c))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to import assignments")
+		return
+	}
+	if len(rowErrors) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": newAPIError(http.StatusUnprocessableEntity, "CSV contains conflicting rows, nothing was imported"), "rows": rowErrors})
+		return
+	}
+
+	guard.report()
+	c.JSON(http.StatusCreated, gin.H{"assignments": created, "count": len(created)})
+}
@@ -2,18 +2,109 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var db *pgxpool.Pool
 
-// InitDB initializes the database connection pool
+// querier is satisfied by both the pool and a transaction, so read helpers
+// can run either standalone or as part of a larger unit of work
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// DBConfig holds the connection pool's settings and how long startup waits
+// for the database
+type DBConfig struct {
+	MaxConns        int32         // 0 keeps DATABASE_URL's pool_max_conns or pgx's default
+	MinConns        int32         // connections kept open even when idle
+	MaxConnLifetime time.Duration // connections are replaced after this long, 0 keeps the default hour
+	MaxConnIdleTime time.Duration // idle connections above MinConns are closed after this long
+	ConnectTimeout  time.Duration // each attempt to open a connection, 0 keeps DATABASE_URL's connect_timeout or 5s
+	StartupTimeout  time.Duration // how long startup retries before giving up
+}
+
+// LoadDBConfig reads DB_MAX_CONNS, DB_MIN_CONNS, DB_MAX_CONN_LIFETIME,
+// DB_MAX_CONN_IDLE_TIME, DB_CONNECT_TIMEOUT and DB_STARTUP_TIMEOUT (default
+// 60s). Settings left unset keep what DATABASE_URL or pgx gives them.
+func LoadDBConfig() DBConfig {
+	config := DBConfig{
+		MaxConns:        poolSizeFromEnv("DB_MAX_CONNS", 1),
+		MinConns:        poolSizeFromEnv("DB_MIN_CONNS", 0),
+		MaxConnLifetime: durationFromEnv("DB_MAX_CONN_LIFETIME", 0),
+		MaxConnIdleTime: durationFromEnv("DB_MAX_CONN_IDLE_TIME", 0),
+		ConnectTimeout:  durationFromEnv("DB_CONNECT_TIMEOUT", 0),
+		StartupTimeout:  durationFromEnv("DB_STARTUP_TIMEOUT", time.Minute),
+	}
+	if config.MaxConns > 0 && config.MinConns > config.MaxConns {
+		log.Printf("DB_MIN_CONNS %d is above DB_MAX_CONNS %d, using %d", config.MinConns, config.MaxConns, config.MaxConns)
+		config.MinConns = config.MaxConns
+	}
+	return config
+}
+
+// poolSizeFromEnv parses a connection count of at least min, returning 0 when
+// the variable is unset or invalid so the pool's own setting stands
+func poolSizeFromEnv(key string, min int32) int32 {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0
+	}
+	parsed, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || int32(parsed) < min {
+		log.Printf("Invalid %s %q, ignoring it", key, value)
+		return 0
+	}
+	return int32(parsed)
+}
+
+// apply sets the configured settings on a pool configuration parsed from
+// DATABASE_URL
+func (c DBConfig) apply(config *pgxpool.Config) {
+	if c.MaxConns > 0 {
+		config.MaxConns = c.MaxConns
+	}
+	if c.MinConns > 0 {
+		config.MinConns = min(c.MinConns, config.MaxConns)
+	}
+	if c.MaxConnLifetime > 0 {
+		config.MaxConnLifetime = c.MaxConnLifetime
+	}
+	if c.MaxConnIdleTime > 0 {
+		config.MaxConnIdleTime = c.MaxConnIdleTime
+	}
+	if c.ConnectTimeout > 0 {
+		config.ConnConfig.ConnectTimeout = c.ConnectTimeout
+	} else if config.ConnConfig.ConnectTimeout == 0 {
+		// Without one a connection to an unreachable host hangs until the OS gives up
+		config.ConnConfig.ConnectTimeout = 5 * time.Second
+	}
+}
+
+// connectBackoff is how long to wait before another connection attempt after
+// the given number of failures: 250ms, doubling up to 8s
+func connectBackoff(attempts int) time.Duration {
+	delay := 250 * time.Millisecond
+	for i := 1; i < attempts && delay < 8*time.Second; i++ {
+		delay *= 2
+	}
+	return min(delay, 8*time.Second)
+}
+
+// InitDB initializes the database connection pool. Postgres may still be
+// starting alongside the service, so the first connection is retried with
+// backoff until the startup timeout.
 func InitDB() error {
-	var err error
 	databaseURL := os.Getenv("DATABASE_URL")
 	if databaseURL == "" {
 		log.Printf("DATABASE_URL environment variable not found, this is required for database connection")
@@ -22,29 +113,54 @@ func InitDB() error {
 	}
 
 	log.Printf("Connecting to database...")
-	// Create connection pool
-	db, err = pgxpool.New(context.Background(), databaseURL)
+	config, err := pgxpool.ParseConfig(databaseURL)
 	if err != nil {
-		log.Printf("Failed to create database connection pool: %v", err)
+		log.Printf("Invalid DATABASE_URL: %v", err)
 		return err
 	}
+	dbConfig := LoadDBConfig()
+	dbConfig.apply(config)
+	config.ConnConfig.Tracer = newQueryTracer()
 
-	// Test the connection
-	if err := db.Ping(context.Background()); err != nil {
-		log.Printf("Failed to ping database: %v", err)
+	// Create connection pool; connections are opened lazily
+	db, err = pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		log.Printf("Failed to create database connection pool: %v", err)
 		return err
 	}
 
-	log.Printf("Database connection established successfully")
-
-	// Create tables if they don't exist
-	if err := createTables(); err != nil {
+	// Wait for the database to answer
+	ctx, cancel := context.WithTimeout(context.Background(), dbConfig.StartupTimeout)
+	defer cancel()
+	if err := waitForDB(ctx, db); err != nil {
+		log.Printf("Failed to reach database within %s: %v", dbConfig.StartupTimeout, err)
+		db.Close()
 		return err
 	}
 
+	log.Printf("Database connection established successfully (pool of %d to %d connections)", config.MinConns,
+		config.MaxConns)
 	return nil
 }
 
+// waitForDB pings the database until it answers or ctx is done, backing off
+// between attempts, and returns the last ping's error
+func waitForDB(ctx context.Context, pinger interface{ Ping(context.Context) error }) error {
+	for attempts := 1; ; attempts++ {
+		err := pinger.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		delay := connectBackoff(attempts)
+		log.Printf("Database not ready (attempt %d), retrying in %s: %v", attempts, delay, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
 // CloseDB closes the database connection pool
 func CloseDB() {
 	if db != nil {
@@ -52,188 +168,272 @@ func CloseDB() {
 	}
 }
 
-// createTables creates the assignments table if it doesn't exist
-func createTables() error {
-	query := `
-	CREATE TABLE IF NOT EXISTS assignments (
-		id SERIAL PRIMARY KEY,
-		bus_id INTEGER NOT NULL,
-		staff_id INTEGER NOT NULL,
-		role VARCHAR(20) NOT NULL CHECK (role IN ('driver', 'conductor')),
-		start_date DATE NOT NULL,
-		end_date DATE,
-		status VARCHAR(20) DEFAULT 'active' CHECK (status IN ('active', 'completed', 'cancelled')),
-		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-		UNIQUE(bus_id, staff_id, role, start_date)
-	);
-
-	-- Create indexes for better performance
-	CREATE INDEX IF NOT EXISTS idx_assignments_bus_id ON assignments(bus_id);
-	CREATE INDEX IF NOT EXISTS idx_assignments_staff_id ON assignments(staff_id);
-	CREATE INDEX IF NOT EXISTS idx_assignments_status ON assignments(status);
-	CREATE INDEX IF NOT EXISTS idx_assignments_start_date ON assignments(start_date);
-	`
+// Assignment database operations
+
+// Missing references are scanned as empty strings
+const assignmentColumns = `id, public_id, COALESCE(reference, ''), COALESCE(external_ref, ''), bus_id, staff_id, role,
+	start_date, end_date, working_days, shift_start, shift_end, dual_role_allowed, COALESCE(clearance_label, ''), status,
+	version, created_at, updated_at, deleted_at, COALESCE(depot_id, ''), COALESCE(notes, '')`
+
+// scanAssignment scans a row selected with assignmentColumns
+func scanAssignment(row pgx.Row, assignment *Assignment) error {
+	return row.Scan(&assignment.ID, &assignment.PublicID, &assignment.Reference, &assignment.ExternalRef, &assignment.BusID,
+		&assignment.StaffID, &assignment.Role, &assignment.StartDate, &assignment.EndDate, &assignment.WorkingDays,
+		&assignment.ShiftStart, &assignment.ShiftEnd, &assignment.DualRoleAllowed, &assignment.ClearanceLabel,
+		&assignment.Status, &assignment.Version, &assignment.CreatedAt, &assignment.UpdatedAt, &assignment.DeletedAt,
+		&assignment.DepotID, &assignment.Notes)
+}
 
-	_, err := db.Exec(context.Background(), query)
+// queryAssignments runs a query selecting assignmentColumns and collects the rows
+func queryAssignments(ctx context.Context, q querier, query string, args ...any) ([]Assignment, error) {
+	var assignments []Assignment
+	rows, err := q.Query(ctx, query, args...)
 	if err != nil {
-		log.Printf("Error creating assignments table: %v", err)
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	log.Println("Assignments table created successfully")
-	return nil
+	for rows.Next() {
+		var assignment Assignment
+		if err := scanAssignment(rows, &assignment); err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, assignment)
+	}
+
+	return assignments, rows.Err()
 }
 
-// Assignment database operations
+// createAssignmentTx inserts an assignment and audits it within an existing
+// transaction, failing with a DeletionHoldError while its staff member or bus
+// is being deleted
+func createAssignmentTx(ctx context.Context, tx pgx.Tx, assignment *Assignment, actor string) error {
+	if err := checkDeletionHoldsTx(ctx, tx, nil, assignment); err != nil {
+		return err
+	}
+	publicID, err := newULID(time.Now())
+	if err != nil {
+		return err
+	}
 
-// CreateAssignment inserts a new assignment into the database
-func CreateAssignment(assignment *Assignment) error {
 	query := `
-		INSERT INTO assignments (bus_id, staff_id, role, start_date, end_date, status)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at, updated_at
+		INSERT INTO assignments (public_id, bus_id, staff_id, role, start_date, end_date, working_days, shift_start,
+			shift_end, dual_role_allowed, status, external_ref, clearance_label, depot_id, notes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, NULLIF($12, ''), NULLIF($13, ''), NULLIF($14, ''),
+			NULLIF($15, ''))
+		RETURNING id, version, created_at, updated_at
 	`
 
-	err := db.QueryRow(context.Background(), query, assignment.BusID, assignment.StaffID,
-		assignment.Role, assignment.StartDate, assignment.EndDate, assignment.Status).
-		Scan(&assignment.ID, &assignment.CreatedAt, &assignment.UpdatedAt)
+	assignment.DepotID = busDepot(assignment.BusID)
+	err = tx.QueryRow(ctx, query, publicID, assignment.BusID, assignment.StaffID, assignment.Role,
+		assignment.StartDate, assignment.EndDate, assignment.WorkingDays, assignment.ShiftStart, assignment.ShiftEnd,
+		assignment.DualRoleAllowed, assignment.Status, assignment.ExternalRef, assignment.ClearanceLabel,
+		assignment.DepotID, assignment.Notes).
+		Scan(&assignment.ID, &assignment.Version, &assignment.CreatedAt, &assignment.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	assignment.PublicID = publicID
+
+	// The reference is derived from the ID, so it can only be set once the row exists
+	assignment.Reference = assignmentReference(assignment.ID, assignment.CreatedAt)
+	if _, err := tx.Exec(ctx, `UPDATE assignments SET reference = $1 WHERE id = $2`,
+		assignment.Reference, assignment.ID); err != nil {
+		return err
+	}
 
-	return err
+	if err := recordAudit(ctx, tx, assignment.ID, AuditActionCreate, actor, nil, assignment); err != nil {
+		return err
+	}
+	return enqueueEvent(ctx, tx, EventAssignmentCreated, actor, assignment)
 }
 
-// GetAssignmentByID retrieves an assignment by ID
-func GetAssignmentByID(id int) (*Assignment, error) {
-	assignment := &Assignment{}
+// updateAssignmentTx updates an assignment within an existing transaction,
+// locking the current row so the audit entry captures an accurate snapshot.
+// It fails with errStaleVersion unless assignment.Version is the stored one,
+// and with a DeletionHoldError when it would newly assign a staff member or
+// bus that is being deleted.
+func updateAssignmentTx(ctx context.Context, tx pgx.Tx, assignment *Assignment, actor string) error {
+	before, err := lockAssignment(ctx, tx, assignment.ID)
+	if err != nil {
+		return err
+	}
+	if before.Version != assignment.Version {
+		return errStaleVersion
+	}
+	if err := checkDeletionHoldsTx(ctx, tx, before, assignment); err != nil {
+		return err
+	}
+
 	query := `
-		SELECT id, bus_id, staff_id, role, start_date, end_date, status, created_at, updated_at
-		FROM assignments
-		WHERE id = $1
+		UPDATE assignments
+		SET bus_id = $1, staff_id = $2, role = $3, start_date = $4, end_date = $5, working_days = $6,
+			shift_start = $7, shift_end = $8, dual_role_allowed = $9, status = $10, external_ref = NULLIF($11, ''),
+			clearance_label = NULLIF($12, ''), depot_id = NULLIF($14, ''), notes = NULLIF($15, ''),
+			version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $13
+		RETURNING version, updated_at
 	`
 
-	err := db.QueryRow(context.Background(), query, id).
-		Scan(&assignment.ID, &assignment.BusID, &assignment.StaffID, &assignment.Role,
-			&assignment.StartDate, &assignment.EndDate, &assignment.Status,
-			&assignment.CreatedAt, &assignment.UpdatedAt)
-
+	assignment.DepotID = busDepot(assignment.BusID)
+	err = tx.QueryRow(ctx, query, assignment.BusID, assignment.StaffID, assignment.Role,
+		assignment.StartDate, assignment.EndDate, assignment.WorkingDays, assignment.ShiftStart, assignment.ShiftEnd,
+		assignment.DualRoleAllowed, assignment.Status, assignment.ExternalRef, assignment.ClearanceLabel, assignment.ID,
+		assignment.DepotID, assignment.Notes).
+		Scan(&assignment.Version, &assignment.UpdatedAt)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return nil, nil // Assignment not found
-		}
-		return nil, err
+		return err
 	}
 
-	return assignment, nil
+	action := AuditActionUpdate
+	if before.Status != assignment.Status {
+		action = AuditActionStatusChange
+	}
+	if err := recordAudit(ctx, tx, assignment.ID, action, actor, before, assignment); err != nil {
+		return err
+	}
+	// Whoever the assignment was taken from is told it no longer applies to them
+	if before.StaffID != assignment.StaffID && before.Status == "active" {
+		if err := queueNotificationsTx(ctx, tx, EventAssignmentCancelled, before); err != nil {
+			return err
+		}
+	}
+	return enqueueEvent(ctx, tx, updateEventType(before, assignment), actor, assignment)
 }
 
-// GetAllAssignments retrieves all assignments from the database
-func GetAllAssignments() ([]Assignment, error) {
-	var assignments []Assignment
+// deleteAssignmentTx soft-deletes an assignment within an existing
+// transaction, failing with errStaleVersion unless version is the stored one.
+// The version is bumped so a restore can't race a concurrent edit.
+func deleteAssignmentTx(ctx context.Context, tx pgx.Tx, id, version int, actor string) error {
+	before, err := lockAssignment(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if before.Version != version || before.DeletedAt != nil {
+		return errStaleVersion
+	}
+
 	query := `
-		SELECT id, bus_id, staff_id, role, start_date, end_date, status, created_at, updated_at
-		FROM assignments
-		ORDER BY created_at DESC
+		UPDATE assignments
+		SET deleted_at = CURRENT_TIMESTAMP, version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
 	`
+	if _, err := tx.Exec(ctx, query, id); err != nil {
+		return err
+	}
 
-	rows, err := db.Query(context.Background(), query)
+	if err := recordAudit(ctx, tx, id, AuditActionDelete, actor, before, nil); err != nil {
+		return err
+	}
+	// Consumers only care that the crew slot is gone, so a delete is a cancellation
+	return enqueueEvent(ctx, tx, EventAssignmentCancelled, actor, before)
+}
+
+// restoreAssignmentTx clears an assignment's soft delete within an existing
+// transaction. It fails with errStaleVersion unless assignment.Version is the
+// stored one, and with a DeletionHoldError while its staff member or bus is
+// being deleted.
+func restoreAssignmentTx(ctx context.Context, tx pgx.Tx, assignment *Assignment, actor string) error {
+	before, err := lockAssignment(ctx, tx, assignment.ID)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if before.Version != assignment.Version || before.DeletedAt == nil {
+		return errStaleVersion
+	}
+	if err := checkDeletionHoldsTx(ctx, tx, nil, before); err != nil {
+		return err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var assignment Assignment
-		err := rows.Scan(&assignment.ID, &assignment.BusID, &assignment.StaffID, &assignment.Role,
-			&assignment.StartDate, &assignment.EndDate, &assignment.Status,
-			&assignment.CreatedAt, &assignment.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
-		assignments = append(assignments, assignment)
+	query := `
+		UPDATE assignments
+		SET deleted_at = NULL, version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING version, updated_at
+	`
+	*assignment = *before
+	assignment.DeletedAt = nil
+	if err := tx.QueryRow(ctx, query, assignment.ID).Scan(&assignment.Version, &assignment.UpdatedAt); err != nil {
+		return err
 	}
 
-	return assignments, nil
+	if err := recordAudit(ctx, tx, assignment.ID, AuditActionRestore, actor, before, assignment); err != nil {
+		return err
+	}
+	// The crew slot is back, which consumers handle as they would a new assignment
+	return enqueueEvent(ctx, tx, EventAssignmentCreated, actor, assignment)
 }
 
-// GetAssignmentsByBusID retrieves all assignments for a specific bus
-func GetAssignmentsByBusID(busID int) ([]Assignment, error) {
-	var assignments []Assignment
+// lockAssignment reads an assignment with a row lock for the rest of the transaction
+func lockAssignment(ctx context.Context, tx pgx.Tx, id int) (*Assignment, error) {
+	assignment := &Assignment{}
 	query := `
-		SELECT id, bus_id, staff_id, role, start_date, end_date, status, created_at, updated_at
+		SELECT ` + assignmentColumns + `
 		FROM assignments
-		WHERE bus_id = $1
-		ORDER BY created_at DESC
+		WHERE id = $1
+		FOR UPDATE
 	`
 
-	rows, err := db.Query(context.Background(), query, busID)
-	if err != nil {
+	if err := scanAssignment(tx.QueryRow(ctx, query, id), assignment); err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return assignment, nil
+}
 
-	for rows.Next() {
-		var assignment Assignment
-		err := rows.Scan(&assignment.ID, &assignment.BusID, &assignment.StaffID, &assignment.Role,
-			&assignment.StartDate, &assignment.EndDate, &assignment.Status,
-			&assignment.CreatedAt, &assignment.UpdatedAt)
-		if err != nil {
-			return nil, err
-		}
-		assignments = append(assignments, assignment)
-	}
+// assignmentsByRef returns the assignments whose reference or external_ref
+// matches, as the ref list filter does
+func assignmentsByRef(ctx context.Context, q querier, ref string) ([]Assignment, error) {
+	query := `
+		SELECT ` + assignmentColumns + `
+		FROM assignments
+		WHERE (reference = upper($1) OR external_ref = $1) AND deleted_at IS NULL
+	`
+	return queryAssignments(ctx, q, query, ref)
+}
 
-	return assignments, nil
+// ConflictError is returned by multi-step writes that would leave an
+// assignment clashing with an existing active one
+type ConflictError struct {
+	Assignment Assignment
+	Conflicts  []Assignment
 }
 
-// GetAssignmentsByStaffID retrieves all assignments for a specific staff member
-func GetAssignmentsByStaffID(staffID int) ([]Assignment, error) {
-	var assignments []Assignment
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("assignment for staff %d on bus %d conflicts with %d active assignment(s)",
+		e.Assignment.StaffID, e.Assignment.BusID, len(e.Conflicts))
+}
+
+// findConflicts returns active assignments that would clash with the given
+// one: another crew member in the same bus/role slot, the same staff member
+// active on a different bus, or the same staff member in another role on the
+// same bus unless either assignment allows dual roles. Date ranges are
+// overlapped in SQL and the working day masks and shift times are compared
+// afterwards.
+func findConflicts(ctx context.Context, q querier, assignment *Assignment) ([]Assignment, error) {
 	query := `
-		SELECT id, bus_id, staff_id, role, start_date, end_date, status, created_at, updated_at
+		SELECT ` + assignmentColumns + `
 		FROM assignments
-		WHERE staff_id = $1
-		ORDER BY created_at DESC
+		WHERE status = 'active'
+		  AND deleted_at IS NULL
+		  AND id <> $1
+		  AND ((bus_id = $2 AND role = $3)
+		       OR (staff_id = $4 AND (bus_id <> $2 OR NOT ($7 OR dual_role_allowed))))
+		  AND start_date <= COALESCE($6::date, 'infinity'::date)
+		  AND COALESCE(end_date, 'infinity'::date) >= $5::date
+		ORDER BY start_date
 	`
 
-	rows, err := db.Query(context.Background(), query, staffID)
+	candidates, err := queryAssignments(ctx, q, query, assignment.ID, assignment.BusID, assignment.Role,
+		assignment.StaffID, assignment.StartDate, assignment.EndDate, assignment.DualRoleAllowed)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var assignment Assignment
-		err := rows.Scan(&assignment.ID, &assignment.BusID, &assignment.StaffID, &assignment.Role,
-			&assignment.StartDate, &assignment.EndDate, &assignment.Status,
-			&assignment.CreatedAt, &assignment.UpdatedAt)
-		if err != nil {
-			return nil, err
+	var conflicts []Assignment
+	for _, candidate := range candidates {
+		if assignment.SharesWorkingDay(&candidate) && assignment.SharesShiftTime(&candidate) {
+			conflicts = append(conflicts, candidate)
 		}
-		assignments = append(assignments, assignment)
 	}
-
-	return assignments, nil
-}
-
-// UpdateAssignment updates an existing assignment
-func UpdateAssignment(assignment *Assignment) error {
-	query := `
-		UPDATE assignments
-		SET bus_id = $1, staff_id = $2, role = $3, start_date = $4, end_date = $5, status = $6, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $7
-		RETURNING updated_at
-	`
-
-	err := db.QueryRow(context.Background(), query, assignment.BusID, assignment.StaffID,
-		assignment.Role, assignment.StartDate, assignment.EndDate, assignment.Status, assignment.ID).
-		Scan(&assignment.UpdatedAt)
-
-	return err
-}
-
-// DeleteAssignment deletes an assignment by ID
-func DeleteAssignment(id int) error {
-	query := `DELETE FROM assignments WHERE id = $1`
-	_, err := db.Exec(context.Background(), query, id)
-	return err
+	return conflicts, nil
 }
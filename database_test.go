@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestLoadDBConfig(t *testing.T) {
+	t.Setenv("DB_MAX_CONNS", "20")
+	t.Setenv("DB_MIN_CONNS", "40")
+	t.Setenv("DB_MAX_CONN_LIFETIME", "forever")
+	t.Setenv("DB_CONNECT_TIMEOUT", "3s")
+
+	config := LoadDBConfig()
+	if config.MaxConns != 20 || config.MinConns != 20 {
+		t.Errorf("conns = %d..%d, want min clamped to the max of 20", config.MinConns, config.MaxConns)
+	}
+	if config.MaxConnLifetime != 0 || config.StartupTimeout != time.Minute {
+		t.Errorf("lifetime %s, startup %s, want unset and the 1m default", config.MaxConnLifetime, config.StartupTimeout)
+	}
+
+	pool, err := pgxpool.ParseConfig("postgres://localhost/assignments?pool_max_conns=8&pool_max_conn_lifetime=2h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.MaxConns = 0
+	config.apply(pool)
+	if pool.MaxConns != 8 || pool.MinConns != 8 || pool.MaxConnLifetime != 2*time.Hour {
+		t.Errorf("pool = %d..%d conns for %s, want DATABASE_URL's settings kept where unset", pool.MinConns,
+			pool.MaxConns, pool.MaxConnLifetime)
+	}
+	if pool.ConnConfig.ConnectTimeout != 3*time.Second {
+		t.Errorf("ConnectTimeout = %s, want 3s", pool.ConnConfig.ConnectTimeout)
+	}
+}
+
+func TestConnectBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: 250 * time.Millisecond, 2: 500 * time.Millisecond,
+		4: 2 * time.Second, 9: 8 * time.Second} {
+		if got := connectBackoff(attempts); got != want {
+			t.Errorf("backoff after %d attempts = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+type flakyPinger struct{ failures int }
+
+func (p *flakyPinger) Ping(context.Context) error {
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestWaitForDB(t *testing.T) {
+	pinger := &flakyPinger{failures: 2}
+	if err := waitForDB(context.Background(), pinger); err != nil || pinger.failures != 0 {
+		t.Errorf("waitForDB = %v with %d failures left, want it to retry until the database answers", err, pinger.failures)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := waitForDB(ctx, &flakyPinger{failures: 1000}); err == nil || err.Error() != "connection refused" {
+		t.Errorf("waitForDB = %v, want the last ping's error once the startup timeout passes", err)
+	}
+}
+
+func TestRepositoryWithContext(t *testing.T) {
+	repo := NewPgxAssignmentRepository(nil).(*pgxAssignmentRepository)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bound := repo.WithContext(ctx).(*pgxAssignmentRepository)
+	if bound.ctx != ctx || repo.ctx != context.Background() {
+		t.Error("WithContext should bind a copy, leaving the shared repository's context alone")
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Degraded mode settings, from DEGRADED_MODE
+const (
+	DegradedAuto = "auto" // follow the dependency checks
+	DegradedOn   = "on"   // always degraded, e.g. while an upstream is known to be struggling
+	DegradedOff  = "off"  // never degraded
+)
+
+// degradedRecoveryChecks is how many clean checks in a row end degraded mode,
+// so a flapping dependency doesn't toggle it on every check
+const degradedRecoveryChecks = 3
+
+// DegradedStatus reports whether expensive work is being shed
+type DegradedStatus struct {
+	Active  bool       `json:"active"`
+	Mode    string     `json:"mode"`
+	Reasons []string   `json:"reasons,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+// DegradedMode sheds enrichment and analytics endpoints while a dependency is
+// unhealthy, so that assignment CRUD keeps working. In auto mode it follows
+// the readiness checks: any non-critical dependency down, or a critical one
+// slower than the latency limit, degrades the service.
+type DegradedMode struct {
+	mu           sync.RWMutex
+	status       DegradedStatus
+	latencyLimit time.Duration
+	cleanChecks  int
+}
+
+var degradedMode = &DegradedMode{status: DegradedStatus{Mode: DegradedAuto}, latencyLimit: time.Second}
+
+// LoadDegradedMode reads DEGRADED_MODE (auto, on or off; default auto) and
+// DEGRADED_LATENCY_LIMIT (default 1s)
+func LoadDegradedMode() *DegradedMode {
+	mode := os.Getenv("DEGRADED_MODE")
+	switch mode {
+	case DegradedAuto, DegradedOn, DegradedOff:
+	case "":
+		mode = DegradedAuto
+	default:
+		log.Printf("Invalid DEGRADED_MODE %q, using %s", mode, DegradedAuto)
+		mode = DegradedAuto
+	}
+
+	d := &DegradedMode{
+		status:       DegradedStatus{Mode: mode},
+		latencyLimit: durationFromEnv("DEGRADED_LATENCY_LIMIT", time.Second),
+	}
+	if mode == DegradedOn {
+		now := time.Now()
+		d.status = DegradedStatus{Active: true, Mode: mode, Reasons: []string{"DEGRADED_MODE=on"}, Since: &now}
+		log.Println("Degraded mode forced on; enrichment and analytics endpoints are disabled")
+	}
+	return d
+}
+
+// Active reports whether expensive work should be skipped
+func (d *DegradedMode) Active() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.status.Active
+}
+
+// Status returns a copy of the current state
+func (d *DegradedMode) Status() DegradedStatus {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	status := d.status
+	status.Reasons = append([]string(nil), d.status.Reasons...)
+	return status
+}
+
+// degradedReasons lists what is wrong in a round of dependency checks
+func degradedReasons(checks []DependencyCheck, statuses map[string]DependencyStatus, latencyLimit time.Duration) []string {
+	var reasons []string
+	for _, check := range checks {
+		status, checked := statuses[check.Name]
+		switch {
+		case !checked:
+		case status.Status != "up":
+			reasons = append(reasons, check.Name+" down")
+		case check.Critical && time.Duration(status.LatencyMS)*time.Millisecond > latencyLimit:
+			reasons = append(reasons, fmt.Sprintf("%s slow (%dms)", check.Name, status.LatencyMS))
+		}
+	}
+	sort.Strings(reasons)
+	return reasons
+}
+
+// observe updates auto mode from a round of dependency checks. Problems
+// degrade the service at once; it recovers after several clean rounds.
+func (d *DegradedMode) observe(checks []DependencyCheck, statuses map[string]DependencyStatus) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.status.Mode != DegradedAuto {
+		return
+	}
+
+	reasons := degradedReasons(checks, statuses, d.latencyLimit)
+	if len(reasons) > 0 {
+		d.cleanChecks = 0
+		if !d.status.Active {
+			now := time.Now()
+			d.status.Since = &now
+			log.Printf("Entering degraded mode: %s", strings.Join(reasons, ", "))
+		}
+		d.status.Active = true
+		d.status.Reasons = reasons
+		return
+	}
+
+	if !d.status.Active {
+		return
+	}
+	d.cleanChecks++
+	if d.cleanChecks >= degradedRecoveryChecks {
+		log.Printf("Leaving degraded mode after %d healthy checks", d.cleanChecks)
+		d.status = DegradedStatus{Mode: d.status.Mode}
+		d.cleanChecks = 0
+	}
+}
+
+// Run checks the dependencies at the interval until the context is cancelled
+func (d *DegradedMode) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checks := readinessChecks
+			statuses, _ := checkDependencies(ctx, checks)
+			if ctx.Err() == nil {
+				d.observe(checks, statuses)
+			}
+		}
+	}
+}
+
+// annotate marks every response while degraded, so clients can tell why
+// details are missing
+func (d *DegradedMode) annotate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if status := d.Status(); status.Active {
+			c.Header("X-Degraded-Mode", "active")
+			c.Header("X-Degraded-Reasons", strings.Join(status.Reasons, ", "))
+		}
+		c.Next()
+	}
+}
+
+// shed rejects an expensive endpoint with 503 while degraded
+func (d *DegradedMode) shed() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := d.Status()
+		if !status.Active {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", "30")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error":    newAPIError(http.StatusServiceUnavailable, "This endpoint is temporarily disabled while the service is degraded"),
+			"degraded": status,
+		})
+	}
+}
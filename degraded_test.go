@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDegradedMode(t *testing.T) {
+	previous := degradedMode
+	t.Cleanup(func() { degradedMode = previous })
+	degradedMode = &DegradedMode{status: DegradedStatus{Mode: DegradedAuto}, latencyLimit: 500 * time.Millisecond}
+
+	router, repo := newTestRouter(t)
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2030-01-07")})
+
+	checks := []DependencyCheck{{Name: "database", Critical: true}, {Name: "bus_service"}}
+	healthy := map[string]DependencyStatus{"database": {Status: "up", LatencyMS: 3}, "bus_service": {Status: "up"}}
+	degradedMode.observe(checks, healthy)
+	if rec := doRequest(router, http.MethodGet, "/api/activity", nil); rec.Code != http.StatusOK || rec.Header().Get("X-Degraded-Mode") != "" {
+		t.Fatalf("healthy activity = %d with degraded header %q", rec.Code, rec.Header().Get("X-Degraded-Mode"))
+	}
+
+	// A slow database degrades the service even though it is up
+	degradedMode.observe(checks, map[string]DependencyStatus{
+		"database": {Status: "up", LatencyMS: 900}, "bus_service": {Status: "down"},
+	})
+	status := degradedMode.Status()
+	if !status.Active || len(status.Reasons) != 2 || status.Reasons[0] != "bus_service down" || status.Reasons[1] != "database slow (900ms)" {
+		t.Fatalf("degraded status = %+v, want both reasons", status)
+	}
+
+	rec := doRequest(router, http.MethodGet, "/api/activity", nil)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("degraded activity = %d, want 503 with Retry-After", rec.Code)
+	}
+	rec = doRequest(router, http.MethodGet, "/api/assignments", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("degraded list = %d, want CRUD to keep working", rec.Code)
+	}
+	if rec.Header().Get("X-Degraded-Mode") != "active" || rec.Header().Get("X-Degraded-Reasons") == "" {
+		t.Errorf("degraded list headers = %v", rec.Header())
+	}
+	list := decode[struct {
+		Assignments []AssignmentWithDetails `json:"assignments"`
+	}](t, rec)
+	if len(list.Assignments) != 1 || list.Assignments[0].StaffName != "" {
+		t.Errorf("degraded list = %+v, want the assignment without staff details", list.Assignments)
+	}
+
+	// Recovery waits for several clean checks in a row
+	for i := 1; i < degradedRecoveryChecks; i++ {
+		degradedMode.observe(checks, healthy)
+	}
+	if !degradedMode.Active() {
+		t.Fatalf("left degraded mode after %d clean checks, want %d", degradedRecoveryChecks-1, degradedRecoveryChecks)
+	}
+	degradedMode.observe(checks, healthy)
+	if degradedMode.Active() {
+		t.Error("still degraded after enough clean checks")
+	}
+}
+
+func TestLoadDegradedMode(t *testing.T) {
+	t.Setenv("DEGRADED_MODE", "on")
+	forced := LoadDegradedMode()
+	forced.observe([]DependencyCheck{{Name: "database", Critical: true}},
+		map[string]DependencyStatus{"database": {Status: "up"}})
+	if !forced.Active() {
+		t.Error("DEGRADED_MODE=on should stay degraded whatever the checks say")
+	}
+
+	t.Setenv("DEGRADED_MODE", "off")
+	off := LoadDegradedMode()
+	off.observe([]DependencyCheck{{Name: "bus_service"}}, map[string]DependencyStatus{"bus_service": {Status: "down"}})
+	if off.Active() {
+		t.Error("DEGRADED_MODE=off should never degrade")
+	}
+
+	t.Setenv("DEGRADED_MODE", "sometimes")
+	if mode := LoadDegradedMode().Status().Mode; mode != DegradedAuto {
+		t.Errorf("invalid DEGRADED_MODE gave mode %q, want %q", mode, DegradedAuto)
+	}
+}
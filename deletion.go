@@ -0,0 +1,495 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// Resources the staff and bus services can delete through a deletion hold
+const (
+	DeletionResourceStaff = "staff"
+	DeletionResourceBus   = "bus"
+)
+
+// Deletion hold statuses. Expired is never stored: it is reported for a
+// prepared hold whose time ran out without a confirm or abort.
+const (
+	DeletionPrepared  = "prepared"
+	DeletionConfirmed = "confirmed"
+	DeletionAborted   = "aborted"
+	DeletionExpired   = "expired"
+)
+
+// Advisory lock classes serialising deletion holds with assignment writes for
+// the same staff member or bus
+const (
+	deletionLockStaff = 80820002
+	deletionLockBus   = 80820003
+)
+
+// defaultDeletionTTL and maxDeletionTTL bound how long a prepared hold blocks
+// new assignments while the caller finishes its side of the delete
+const (
+	defaultDeletionTTL = 15 * time.Minute
+	maxDeletionTTL     = 24 * time.Hour
+)
+
+// DeletionHold is the first phase of deleting a staff member or bus in its
+// owning service. While prepared, and for good once confirmed, no new active
+// assignment may reference the resource.
+type DeletionHold struct {
+	ID          string    `json:"id"` // ULID
+	Resource    string    `json:"resource"`
+	ResourceID  int       `json:"resource_id"`
+	Cascade     bool      `json:"cascade"` // cancel remaining assignments on confirm
+	Status      string    `json:"status"`
+	RequestedBy string    `json:"requested_by"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Expired reports whether a prepared hold ran out before being confirmed or aborted
+func (d *DeletionHold) Expired(now time.Time) bool {
+	return d.Status == DeletionPrepared && !now.Before(d.ExpiresAt)
+}
+
+// Blocks reports whether the hold stops new assignments for its resource
+func (d *DeletionHold) Blocks(now time.Time) bool {
+	return d.Status == DeletionConfirmed || (d.Status == DeletionPrepared && !d.Expired(now))
+}
+
+// settle reports a prepared hold that ran out as expired
+func (d *DeletionHold) settle(now time.Time) {
+	if d.Expired(now) {
+		d.Status = DeletionExpired
+	}
+}
+
+// references reports whether the assignment is for the hold's resource
+func (d *DeletionHold) references(assignment *Assignment) bool {
+	if d.Resource == DeletionResourceBus {
+		return assignment.BusID == d.ResourceID
+	}
+	return assignment.StaffID == d.ResourceID
+}
+
+// DeletionHoldError rejects a write that would give a staff member or bus
+// being deleted a new active assignment, or a second deletion hold
+type DeletionHoldError struct {
+	Hold DeletionHold
+}
+
+func (e *DeletionHoldError) Error() string {
+	label := "staff member"
+	if e.Hold.Resource == DeletionResourceBus {
+		label = "bus"
+	}
+	if e.Hold.Status == DeletionConfirmed {
+		return fmt.Sprintf("%s %d has been deleted", label, e.Hold.ResourceID)
+	}
+	return fmt.Sprintf("%s %d is being deleted", label, e.Hold.ResourceID)
+}
+
+// DeletionBlockedError rejects a delete without cascade while active
+// assignments remain
+type DeletionBlockedError struct {
+	Active []Assignment
+}
+
+func (e *DeletionBlockedError) Error() string {
+	return fmt.Sprintf("%d active assignment(s) remain", len(e.Active))
+}
+
+// errDeletionClosed is returned when confirming or aborting a hold that has
+// already been settled
+var errDeletionClosed = errors.New("deletion is no longer prepared")
+
+// DeletionCheck answers whether a staff member or bus can be deleted now
+type DeletionCheck struct {
+	Resource   string        `json:"resource"`
+	ResourceID int           `json:"resource_id"`
+	CanDelete  bool          `json:"can_delete"`
+	Active     []Assignment  `json:"active_assignments"` // running or upcoming, which a delete would orphan
+	Hold       *DeletionHold `json:"hold,omitempty"`     // a deletion already prepared or confirmed
+}
+
+// PrepareDeletionRequest starts a two-phase delete
+type PrepareDeletionRequest struct {
+	Cascade    bool `json:"cascade"`               // cancel remaining assignments on confirm instead of refusing
+	TTLSeconds int  `json:"ttl_seconds,omitempty"` // how long the hold lasts; default 15 minutes, at most 24 hours
+}
+
+// DeletionResult describes a confirmed delete and the assignments it settled
+type DeletionResult struct {
+	Deletion  DeletionHold `json:"deletion"`
+	Cancelled []Assignment `json:"cancelled"` // had not started yet
+	Ended     []Assignment `json:"ended"`     // already running, now ending the day before the delete
+}
+
+// blocksDeletion reports whether an assignment would be orphaned by deleting
+// its staff member or bus today: it is active and still running or upcoming
+func blocksDeletion(assignment *Assignment, today time.Time) bool {
+	return assignment.Status == "active" && (assignment.EndDate == nil || !assignment.EndDate.Before(today))
+}
+
+// settleForDeletion cancels an assignment that hasn't started by today, or
+// ends a running one the day before. It reports whether it was cancelled.
+func settleForDeletion(assignment *Assignment, today time.Time) (cancelled bool) {
+	if !assignment.StartDate.Before(today) {
+		assignment.Status = "cancelled"
+		return true
+	}
+	dayBefore := today.AddDate(0, 0, -1)
+	assignment.EndDate = &dayBefore
+	return false
+}
+
+// newlyReferenced returns the resources an assignment write would give a new
+// active reference to: both for a new or reactivated assignment, otherwise
+// only a staff member or bus it was moved to
+func newlyReferenced(before, after *Assignment) (staffID, busID int) {
+	if after.Status != "active" {
+		return 0, 0
+	}
+	if before == nil || before.Status != "active" {
+		return after.StaffID, after.BusID
+	}
+	if after.StaffID != before.StaffID {
+		staffID = after.StaffID
+	}
+	if after.BusID != before.BusID {
+		busID = after.BusID
+	}
+	return staffID, busID
+}
+
+// deletionLockClass returns the advisory lock class for a resource
+func deletionLockClass(resource string) int {
+	if resource == DeletionResourceBus {
+		return deletionLockBus
+	}
+	return deletionLockStaff
+}
+
+// deletionHoldColumns are selected by every deletion hold query, in scanDeletionHold order
+const deletionHoldColumns = `id, resource, resource_id, cascade_cancel, status, requested_by, expires_at, created_at, updated_at`
+
+func scanDeletionHold(row pgx.Row, hold *DeletionHold) error {
+	return row.Scan(&hold.ID, &hold.Resource, &hold.ResourceID, &hold.Cascade, &hold.Status, &hold.RequestedBy,
+		&hold.ExpiresAt, &hold.CreatedAt, &hold.UpdatedAt)
+}
+
+// blockingDeletionTx returns the hold stopping new assignments for the
+// resource, or nil
+func blockingDeletionTx(ctx context.Context, q querier, resource string, resourceID int) (*DeletionHold, error) {
+	hold := &DeletionHold{}
+	query := `
+		SELECT ` + deletionHoldColumns + `
+		FROM deletion_holds
+		WHERE resource = $1 AND resource_id = $2
+		  AND (status = 'confirmed' OR (status = 'prepared' AND expires_at > $3))
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+	err := scanDeletionHold(q.QueryRow(ctx, query, resource, resourceID, clock.Now()), hold)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// checkDeletionHoldsTx fails with a DeletionHoldError when the write would
+// give a staff member or bus being deleted a new active assignment. The shared
+// advisory locks make a concurrent prepare wait for this transaction.
+func checkDeletionHoldsTx(ctx context.Context, tx pgx.Tx, before, after *Assignment) error {
+	staffID, busID := newlyReferenced(before, after)
+	for _, ref := range []struct {
+		resource string
+		id       int
+	}{{DeletionResourceStaff, staffID}, {DeletionResourceBus, busID}} {
+		if ref.id == 0 {
+			continue
+		}
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock_shared($1, $2)`,
+			deletionLockClass(ref.resource), ref.id); err != nil {
+			return err
+		}
+		hold, err := blockingDeletionTx(ctx, tx, ref.resource, ref.id)
+		if err != nil {
+			return err
+		}
+		if hold != nil {
+			return &DeletionHoldError{Hold: *hold}
+		}
+	}
+	return nil
+}
+
+// lockDeletionResourceTx takes the resource's advisory lock exclusively for
+// the rest of the transaction
+func lockDeletionResourceTx(ctx context.Context, tx pgx.Tx, resource string, resourceID int) error {
+	_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1, $2)`,
+		deletionLockClass(resource), resourceID)
+	return err
+}
+
+// activeForDeletionTx returns the resource's running and upcoming active
+// assignments, optionally locking them
+func activeForDeletionTx(ctx context.Context, q querier, resource string, resourceID int, today time.Time,
+	lock bool) ([]Assignment, error) {
+	column := "staff_id"
+	if resource == DeletionResourceBus {
+		column = "bus_id"
+	}
+	query := `
+		SELECT ` + assignmentColumns + `
+		FROM assignments
+		WHERE ` + column + ` = $1
+		  AND status = 'active'
+		  AND deleted_at IS NULL
+		  AND COALESCE(end_date, 'infinity'::date) >= $2::date
+		ORDER BY start_date
+	`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+	return queryAssignments(ctx, q, query, resourceID, today)
+}
+
+// deletionHeld returns the hold, if any, that stops the assignment being
+// created, without locking. Batch writers use it to skip such assignments
+// up front; checkDeletionHoldsTx still guards the write itself.
+func deletionHeld(ctx context.Context, q querier, assignment *Assignment) (*DeletionHold, error) {
+	hold, err := blockingDeletionTx(ctx, q, DeletionResourceStaff, assignment.StaffID)
+	if hold != nil || err != nil {
+		return hold, err
+	}
+	return blockingDeletionTx(ctx, q, DeletionResourceBus, assignment.BusID)
+}
+
+// respondDeletionHold writes 409 when err is a DeletionHoldError, returning
+// false once a response has been written
+func respondDeletionHold(c *gin.Context, err error) bool {
+	var holdErr *DeletionHoldError
+	if !errors.As(err, &holdErr) {
+		return true
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": newAPIError(http.StatusConflict, "Cannot assign: "+holdErr.Error()), "deletion": holdErr.Hold})
+	return false
+}
+
+// deletionResource reads the staff or bus ID from the route. It returns false
+// once a 400 has been written.
+func deletionResource(c *gin.Context) (resource string, id int, ok bool) {
+	resource, param := DeletionResourceStaff, "staffId"
+	if c.Param("busId") != "" {
+		resource, param = DeletionResourceBus, "busId"
+	}
+	id, err := strconv.Atoi(c.Param(param))
+	if err != nil || id <= 0 {
+		respondError(c, http.StatusBadRequest, "Invalid "+resource+" ID")
+		return "", 0, false
+	}
+	return resource, id, true
+}
+
+// activeFor returns the running and upcoming assignments a delete of the
+// resource would orphan
+func (h *AssignmentHandler) activeFor(resource string, id int, today time.Time) ([]Assignment, error) {
+	filter := AssignmentFilter{Status: "active", Sort: "start_date", StaffID: id}
+	if resource == DeletionResourceBus {
+		filter = AssignmentFilter{Status: "active", Sort: "start_date", BusID: id}
+	}
+	assignments, err := h.repo.List(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	active := []Assignment{}
+	for _, assignment := range assignments {
+		if blocksDeletion(&assignment, today) {
+			active = append(active, assignment)
+		}
+	}
+	return active, nil
+}
+
+func (h *AssignmentHandler) handleCheckDeletion(c *gin.Context) {
+	h = h.forRequest(c)
+	resource, id, ok := deletionResource(c)
+	if !ok {
+		return
+	}
+
+	now := clock.Now()
+	active, err := h.activeFor(resource, id, truncateDate(now))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to check assignments")
+		return
+	}
+	hold, err := h.repo.BlockingDeletion(resource, id)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to check deletion holds")
+		return
+	}
+
+	c.JSON(http.StatusOK, DeletionCheck{
+		Resource:   resource,
+		ResourceID: id,
+		CanDelete:  len(active) == 0 && hold == nil,
+		Active:     active,
+		Hold:       hold,
+	})
+}
+
+func (h *AssignmentHandler) handlePrepareDeletion(c *gin.Context) {
+	h = h.forRequest(c)
+	resource, id, ok := deletionResource(c)
+	if !ok {
+		return
+	}
+
+	// The body is optional; an empty one prepares a delete without cascade
+	var req PrepareDeletionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBindError(c, &req, err)
+		return
+	}
+	ttl := defaultDeletionTTL
+	if req.TTLSeconds != 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+		if ttl < time.Second || ttl > maxDeletionTTL {
+			respondInvalidField(c, "ttl_seconds", "ttl_seconds must be between 1 and 86400")
+			return
+		}
+	}
+
+	now := clock.Now()
+	holdID, err := newULID(now)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to prepare deletion")
+		return
+	}
+	hold := DeletionHold{
+		ID:          holdID,
+		Resource:    resource,
+		ResourceID:  id,
+		Cascade:     req.Cascade,
+		Status:      DeletionPrepared,
+		RequestedBy: actorFromContext(c),
+		ExpiresAt:   now.Add(ttl),
+	}
+
+	if err := h.repo.PrepareDeletion(&hold, now); err != nil {
+		var blocked *DeletionBlockedError
+		if errors.As(err, &blocked) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":              newAPIError(http.StatusConflict, "Active assignments remain; cancel them first or prepare with cascade"),
+				"active_assignments": blocked.Active,
+			})
+			return
+		}
+		var held *DeletionHoldError
+		if errors.As(err, &held) {
+			c.JSON(http.StatusConflict, gin.H{"error": newAPIError(http.StatusConflict, "Cannot prepare: "+held.Error()), "deletion": held.Hold})
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Failed to prepare deletion")
+		return
+	}
+
+	log.Printf("Deletion of %s %d prepared by %s (cascade %v)", resource, id, hold.RequestedBy, hold.Cascade)
+	c.JSON(http.StatusCreated, hold)
+}
+
+// deletionFromParam loads the hold named in the route. It returns false once a
+// response has been written.
+func (h *AssignmentHandler) deletionFromParam(c *gin.Context) (*DeletionHold, bool) {
+	id, valid := normalizeULID(c.Param("id"))
+	if !valid {
+		respondError(c, http.StatusBadRequest, "Invalid deletion ID")
+		return nil, false
+	}
+	hold, err := h.repo.GetDeletion(id)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve deletion")
+		return nil, false
+	}
+	if hold == nil {
+		respondError(c, http.StatusNotFound, "Deletion not found")
+		return nil, false
+	}
+	hold.settle(clock.Now())
+	return hold, true
+}
+
+func (h *AssignmentHandler) handleGetDeletion(c *gin.Context) {
+	h = h.forRequest(c)
+	if hold, ok := h.deletionFromParam(c); ok {
+		c.JSON(http.StatusOK, hold)
+	}
+}
+
+func (h *AssignmentHandler) handleConfirmDeletion(c *gin.Context) {
+	h = h.forRequest(c)
+	hold, ok := h.deletionFromParam(c)
+	if !ok {
+		return
+	}
+
+	actor := actorFromContext(c)
+	result, err := h.repo.ConfirmDeletion(hold.ID, actor, clock.Now())
+	if err != nil {
+		var blocked *DeletionBlockedError
+		switch {
+		case errors.Is(err, errDeletionClosed):
+			c.JSON(http.StatusConflict, gin.H{"error": newAPIError(http.StatusConflict, "Deletion is no longer prepared and cannot be confirmed"), "deletion": hold})
+		case errors.As(err, &blocked):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":              newAPIError(http.StatusConflict, "Active assignments remain; cancel them first or prepare with cascade"),
+				"active_assignments": blocked.Active,
+			})
+		default:
+			respondError(c, http.StatusInternalServerError, "Failed to confirm deletion")
+		}
+		return
+	}
+
+	log.Printf("Deletion of %s %d confirmed by %s: %d cancelled, %d ended",
+		hold.Resource, hold.ResourceID, actor, len(result.Cancelled), len(result.Ended))
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *AssignmentHandler) handleAbortDeletion(c *gin.Context) {
+	h = h.forRequest(c)
+	hold, ok := h.deletionFromParam(c)
+	if !ok {
+		return
+	}
+
+	aborted, err := h.repo.AbortDeletion(hold.ID)
+	if err != nil {
+		if errors.Is(err, errDeletionClosed) {
+			c.JSON(http.StatusConflict, gin.H{"error": newAPIError(http.StatusConflict, "Deletion has been confirmed and can no longer be aborted"), "deletion": hold})
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Failed to abort deletion")
+		return
+	}
+
+	log.Printf("Deletion of %s %d aborted by %s", hold.Resource, hold.ResourceID, actorFromContext(c))
+	c.JSON(http.StatusOK, aborted)
+}
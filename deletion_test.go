@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStaffDeletionWithCascade(t *testing.T) {
+	router, repo := newTestRouter(t)
+	today := truncateDate(time.Now())
+	running := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 7, Role: "driver", StartDate: today.AddDate(0, 0, -10)})
+	upcoming := mustCreate(t, repo, Assignment{BusID: 2, StaffID: 7, Role: "driver", StartDate: today.AddDate(0, 0, 10)})
+	ended := today.AddDate(0, 0, -20)
+	mustCreate(t, repo, Assignment{BusID: 3, StaffID: 7, Role: "driver", StartDate: today.AddDate(0, 0, -30), EndDate: &ended})
+
+	rec := doRequest(router, http.MethodGet, "/api/staff/7/deletion-check", nil)
+	check := decode[DeletionCheck](t, rec)
+	if rec.Code != http.StatusOK || check.CanDelete || len(check.Active) != 2 {
+		t.Fatalf("check = %d %+v, want the running and upcoming assignments blocking", rec.Code, check)
+	}
+
+	if rec := doRequest(router, http.MethodPost, "/api/staff/7/deletion/prepare", nil); rec.Code != http.StatusConflict {
+		t.Fatalf("prepare without cascade status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	rec = doRequest(router, http.MethodPost, "/api/staff/7/deletion/prepare", gin.H{"cascade": true})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("prepare status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	hold := decode[DeletionHold](t, rec)
+
+	// While prepared, the staff member can't be given new work or a second hold
+	body := gin.H{"bus_id": 4, "staff_id": 7, "role": "driver", "start_date": today.AddDate(0, 0, 5).Format("2006-01-02")}
+	if rec := doRequest(router, http.MethodPost, "/api/assignments", body); rec.Code != http.StatusConflict {
+		t.Errorf("create during hold status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if rec := doRequest(router, http.MethodPost, "/api/staff/7/deletion/prepare", gin.H{"cascade": true}); rec.Code != http.StatusConflict {
+		t.Errorf("second prepare status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	rec = doRequest(router, http.MethodPost, "/api/deletions/"+hold.ID+"/confirm", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("confirm status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	result := decode[DeletionResult](t, rec)
+	if result.Deletion.Status != DeletionConfirmed || len(result.Cancelled) != 1 || len(result.Ended) != 1 {
+		t.Fatalf("result = %+v, want one cancelled and one ended", result)
+	}
+
+	stored, _ := repo.Get(upcoming.ID)
+	if stored.Status != "cancelled" {
+		t.Errorf("upcoming status = %s, want cancelled", stored.Status)
+	}
+	stored, _ = repo.Get(running.ID)
+	if stored.Status != "active" || stored.EndDate == nil || !stored.EndDate.Equal(today.AddDate(0, 0, -1)) {
+		t.Errorf("running assignment = %s ending %v, want active ending yesterday", stored.Status, stored.EndDate)
+	}
+
+	// A confirmed delete keeps blocking and can't be undone
+	if rec := doRequest(router, http.MethodPost, "/api/assignments", body); rec.Code != http.StatusConflict {
+		t.Errorf("create after delete status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if rec := doRequest(router, http.MethodPost, "/api/deletions/"+hold.ID+"/abort", nil); rec.Code != http.StatusConflict {
+		t.Errorf("abort after confirm status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestBusDeletionAbort(t *testing.T) {
+	router, _ := newTestRouter(t)
+	body := gin.H{"bus_id": 9, "staff_id": 1, "role": "driver", "start_date": truncateDate(time.Now()).Format("2006-01-02")}
+
+	rec := doRequest(router, http.MethodPost, "/api/buses/9/deletion/prepare", nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("prepare status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	hold := decode[DeletionHold](t, rec)
+	if hold.Resource != DeletionResourceBus || hold.ResourceID != 9 {
+		t.Errorf("hold = %+v, want bus 9", hold)
+	}
+	if rec := doRequest(router, http.MethodPost, "/api/assignments", body); rec.Code != http.StatusConflict {
+		t.Errorf("create during hold status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	rec = doRequest(router, http.MethodPost, "/api/deletions/"+hold.ID+"/abort", nil)
+	if got := decode[DeletionHold](t, rec); rec.Code != http.StatusOK || got.Status != DeletionAborted {
+		t.Fatalf("abort = %d %+v, want aborted", rec.Code, got)
+	}
+	if rec := doRequest(router, http.MethodPost, "/api/assignments", body); rec.Code != http.StatusCreated {
+		t.Errorf("create after abort status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	if rec := doRequest(router, http.MethodPost, "/api/deletions/"+hold.ID+"/confirm", nil); rec.Code != http.StatusConflict {
+		t.Errorf("confirm after abort status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestExpiredDeletionHold(t *testing.T) {
+	repo := NewMemoryAssignmentRepository()
+	now := time.Now()
+	hold := DeletionHold{
+		ID:         unknownAssignmentID,
+		Resource:   DeletionResourceStaff,
+		ResourceID: 3,
+		Status:     DeletionPrepared,
+		ExpiresAt:  now.Add(-time.Minute),
+	}
+	if err := repo.PrepareDeletion(&hold, now.Add(-time.Hour)); err != nil {
+		t.Fatalf("PrepareDeletion: %v", err)
+	}
+
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 3, Role: "driver", StartDate: truncateDate(now)})
+	if _, err := repo.ConfirmDeletion(hold.ID, "test", now); !errors.Is(err, errDeletionClosed) {
+		t.Errorf("confirming an expired hold = %v, want errDeletionClosed", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// depotToken signs an Authorization header value for a caller at the depot
+func depotToken(t *testing.T, secret []byte, role, depot string) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		Role:             role,
+		DepotID:          depot,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "user-" + role + "-" + depot},
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + signed
+}
+
+func TestDepotScopeHidesOtherDepots(t *testing.T) {
+	router, repo, secret := newClearanceRouter(t)
+	north := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03")})
+	south := mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-03-03")})
+	if north.DepotID != "north" || south.DepotID != "south" {
+		t.Fatalf("depots = %q, %q, want them taken from the buses", north.DepotID, south.DepotID)
+	}
+
+	list := func(headers ...string) []Assignment {
+		rec := doRequest(router, http.MethodGet, "/api/assignments", nil, headers...)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("list status = %d: %s", rec.Code, rec.Body.String())
+		}
+		return decode[struct{ Assignments []Assignment }](t, rec).Assignments
+	}
+
+	viewer := depotToken(t, secret, RoleViewer, "north")
+	if got := list("Authorization", viewer); len(got) != 1 || got[0].PublicID != north.PublicID {
+		t.Errorf("north viewer lists %+v, want only the north assignment", got)
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/assignments/"+south.PublicID, nil, "Authorization", viewer); rec.Code != http.StatusNotFound {
+		t.Errorf("south assignment status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/assignments", nil, "Authorization", viewer, depotHeader, "south"); rec.Code != http.StatusForbidden {
+		t.Errorf("switching depot status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	// Admins see every depot unless they pick one
+	admin := depotToken(t, secret, RoleAdmin, "north")
+	if got := list("Authorization", admin); len(got) != 2 {
+		t.Errorf("admin lists %d assignments, want both depots", len(got))
+	}
+	if got := list("Authorization", admin, depotHeader, "south"); len(got) != 1 || got[0].PublicID != south.PublicID {
+		t.Errorf("admin at south lists %+v, want only the south assignment", got)
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/assignments", nil, "Authorization", admin, depotHeader, "east"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown depot status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	// Tokens without a depot are refused, with or without picking one
+	unscoped := depotToken(t, secret, RoleViewer, "")
+	for _, headers := range [][]string{{"Authorization", unscoped}, {"Authorization", unscoped, depotHeader, "south"}} {
+		if rec := doRequest(router, http.MethodGet, "/api/assignments", nil, headers...); rec.Code != http.StatusForbidden {
+			t.Errorf("unscoped viewer status = %d, want %d", rec.Code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestDepotScopeWrites(t *testing.T) {
+	router, _, secret := newClearanceRouter(t)
+	dispatcher := depotToken(t, secret, RoleDispatcher, "north")
+	body := gin.H{"bus_id": 3, "staff_id": 3, "role": "driver", "start_date": date("2025-03-03").Format("2006-01-02")}
+
+	if rec := doRequest(router, http.MethodPost, "/api/assignments", body, "Authorization", dispatcher); rec.Code != http.StatusForbidden {
+		t.Errorf("create at another depot status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	body["bus_id"] = 1
+	if rec := doRequest(router, http.MethodPost, "/api/assignments", body, "Authorization", dispatcher); rec.Code != http.StatusCreated {
+		t.Errorf("create at own depot status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := doRequest(router, http.MethodPost, "/api/buses/1/reassign?to=3", nil, "Authorization", dispatcher); rec.Code != http.StatusForbidden {
+		t.Errorf("reassign to another depot status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	transfer := gin.H{"to_depot": "south", "transfer_date": "2025-04-01"}
+	if rec := doRequest(router, http.MethodPost, "/api/staff/1/transfer", transfer, "Authorization", dispatcher); rec.Code != http.StatusForbidden {
+		t.Errorf("transfer status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/reports/staff-utilization?from=2025-03-01&to=2025-03-31&depot=south",
+		nil, "Authorization", dispatcher); rec.Code != http.StatusForbidden {
+		t.Errorf("report on another depot status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
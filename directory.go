@@ -0,0 +1,260 @@
+package main
+
+import (
+	"container/list"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Directory looks up bus and staff details from the services that own them.
+// Unknown IDs return nil without an error.
+type Directory interface {
+	Bus(id int) (map[string]string, error)
+	Staff(id int) (map[string]string, error)
+}
+
+// mockDirectory serves the mock buses and staff until the real services land
+type mockDirectory struct{}
+
+func (mockDirectory) Bus(id int) (map[string]string, error)   { return mockBuses[id], nil }
+func (mockDirectory) Staff(id int) (map[string]string, error) { return mockStaff[id], nil }
+
+// directory enriches assignments with bus and staff details; main replaces it
+// with the configured cache from LoadDirectory
+var directory = NewCachedDirectory(mockDirectory{}, NewMemoryDirectoryCache(1000, 5*time.Minute))
+
+// lookupBus returns a bus's details, or nil when it is unknown or the
+// directory failed, so enrichment falls back to bare IDs
+func lookupBus(id int) map[string]string {
+	bus, err := directory.Bus(id)
+	if err != nil {
+		log.Printf("Failed to look up bus %d: %v", id, err)
+		return nil
+	}
+	return bus
+}
+
+// lookupStaff returns a staff member's details, or nil when they are unknown
+// or the directory failed
+func lookupStaff(id int) map[string]string {
+	staff, err := directory.Staff(id)
+	if err != nil {
+		log.Printf("Failed to look up staff %d: %v", id, err)
+		return nil
+	}
+	return staff
+}
+
+// DirectoryCache keeps directory entries for a limited time. Entries are
+// shared with callers and must not be modified.
+type DirectoryCache interface {
+	// Get returns the entry stored under the key; found is false once it has
+	// expired or been evicted
+	Get(key string) (entry map[string]string, found bool, err error)
+	Set(key string, entry map[string]string) error
+	Delete(keys []string) error
+	// Flush drops every entry
+	Flush() error
+}
+
+// CachedDirectory answers lookups from the cache, going to the upstream
+// directory only on a miss. Unknown IDs are cached too, so they don't fan out
+// on every request either. A failing cache is skipped rather than failing the
+// lookup.
+type CachedDirectory struct {
+	upstream Directory
+	cache    DirectoryCache
+}
+
+// NewCachedDirectory puts the cache in front of the directory
+func NewCachedDirectory(upstream Directory, cache DirectoryCache) *CachedDirectory {
+	return &CachedDirectory{upstream: upstream, cache: cache}
+}
+
+func busCacheKey(id int) string   { return "bus:" + strconv.Itoa(id) }
+func staffCacheKey(id int) string { return "staff:" + strconv.Itoa(id) }
+
+func (d *CachedDirectory) Bus(id int) (map[string]string, error) {
+	return d.lookup(busCacheKey(id), func() (map[string]string, error) { return d.upstream.Bus(id) })
+}
+
+func (d *CachedDirectory) Staff(id int) (map[string]string, error) {
+	return d.lookup(staffCacheKey(id), func() (map[string]string, error) { return d.upstream.Staff(id) })
+}
+
+func (d *CachedDirectory) lookup(key string, fetch func() (map[string]string, error)) (map[string]string, error) {
+	entry, found, err := d.cache.Get(key)
+	if err != nil {
+		log.Printf("Directory cache lookup of %s failed: %v", key, err)
+	} else if found {
+		if len(entry) == 0 {
+			return nil, nil // cached as unknown
+		}
+		return entry, nil
+	}
+
+	entry, err = fetch()
+	if err != nil {
+		return nil, err // failures aren't cached, so the next lookup retries
+	}
+	stored := entry
+	if stored == nil {
+		stored = map[string]string{}
+	}
+	if err := d.cache.Set(key, stored); err != nil {
+		log.Printf("Directory cache store of %s failed: %v", key, err)
+	}
+	return entry, nil
+}
+
+// Invalidate drops the cached details of the buses and staff, or of everything
+// when both are empty
+func (d *CachedDirectory) Invalidate(busIDs, staffIDs []int) error {
+	if len(busIDs) == 0 && len(staffIDs) == 0 {
+		return d.cache.Flush()
+	}
+	keys := make([]string, 0, len(busIDs)+len(staffIDs))
+	for _, id := range busIDs {
+		keys = append(keys, busCacheKey(id))
+	}
+	for _, id := range staffIDs {
+		keys = append(keys, staffCacheKey(id))
+	}
+	return d.cache.Delete(keys)
+}
+
+// LoadDirectory builds the directory cache from the environment: Redis when
+// DIRECTORY_CACHE_REDIS_URL is set, so every replica shares the cache and its
+// invalidation, otherwise an in-memory LRU of DIRECTORY_CACHE_SIZE entries.
+// Entries live for DIRECTORY_CACHE_TTL.
+func LoadDirectory() (*CachedDirectory, error) {
+	ttl := durationFromEnv("DIRECTORY_CACHE_TTL", 5*time.Minute)
+	if url := os.Getenv("DIRECTORY_CACHE_REDIS_URL"); url != "" {
+		cache, err := newRedisDirectoryCache(url, ttl)
+		if err != nil {
+			return nil, err
+		}
+		return NewCachedDirectory(mockDirectory{}, cache), nil
+	}
+
+	size := 1000
+	if value := os.Getenv("DIRECTORY_CACHE_SIZE"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			size = parsed
+		} else {
+			log.Printf("Invalid DIRECTORY_CACHE_SIZE %q, using %d", value, size)
+		}
+	}
+	return NewCachedDirectory(mockDirectory{}, NewMemoryDirectoryCache(size, ttl)), nil
+}
+
+// memoryDirectoryCache is a fixed-size LRU whose entries also expire
+type memoryDirectoryCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	now     func() time.Time
+	order   *list.List // of *memoryCacheEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type memoryCacheEntry struct {
+	key     string
+	value   map[string]string
+	expires time.Time
+}
+
+// NewMemoryDirectoryCache holds up to size entries, each for the TTL
+func NewMemoryDirectoryCache(size int, ttl time.Duration) *memoryDirectoryCache {
+	return &memoryDirectoryCache{size: size, ttl: ttl, now: time.Now, order: list.New(),
+		entries: map[string]*list.Element{}}
+}
+
+func (m *memoryDirectoryCache) Get(key string) (map[string]string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	element, exists := m.entries[key]
+	if !exists {
+		return nil, false, nil
+	}
+	entry := element.Value.(*memoryCacheEntry)
+	if !m.now().Before(entry.expires) {
+		m.order.Remove(element)
+		delete(m.entries, key)
+		return nil, false, nil
+	}
+	m.order.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+func (m *memoryDirectoryCache) Set(key string, value map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry := &memoryCacheEntry{key: key, value: value, expires: m.now().Add(m.ttl)}
+	if element, exists := m.entries[key]; exists {
+		element.Value = entry
+		m.order.MoveToFront(element)
+		return nil
+	}
+	m.entries[key] = m.order.PushFront(entry)
+	for m.order.Len() > m.size {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+	return nil
+}
+
+func (m *memoryDirectoryCache) Delete(keys []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		if element, exists := m.entries[key]; exists {
+			m.order.Remove(element)
+			delete(m.entries, key)
+		}
+	}
+	return nil
+}
+
+func (m *memoryDirectoryCache) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.order.Init()
+	m.entries = map[string]*list.Element{}
+	return nil
+}
+
+// InvalidateCacheRequest names the buses and staff whose details changed
+// upstream; an empty body flushes the whole cache
+type InvalidateCacheRequest struct {
+	BusIDs   []int `json:"bus_ids"`
+	StaffIDs []int `json:"staff_ids"`
+}
+
+// handleInvalidateDirectoryCache busts cached directory entries, for the bus
+// and staff services to call when their data changes
+func handleInvalidateDirectoryCache(c *gin.Context) {
+	var req InvalidateCacheRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBindError(c, &req, err)
+		return
+	}
+
+	if err := directory.Invalidate(req.BusIDs, req.StaffIDs); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to invalidate the directory cache")
+		return
+	}
+	if len(req.BusIDs) == 0 && len(req.StaffIDs) == 0 {
+		log.Printf("Directory cache flushed by %s", actorFromContext(c))
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// countingDirectory counts the lookups that reach it
+type countingDirectory struct {
+	calls int
+	err   error
+}
+
+func (d *countingDirectory) Bus(id int) (map[string]string, error) {
+	d.calls++
+	if d.err != nil {
+		return nil, d.err
+	}
+	return mockBuses[id], nil
+}
+
+func (d *countingDirectory) Staff(id int) (map[string]string, error) {
+	d.calls++
+	return mockStaff[id], d.err
+}
+
+func TestMemoryDirectoryCache(t *testing.T) {
+	cache := NewMemoryDirectoryCache(2, time.Minute)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.Set("bus:1", mockBuses[1])
+	cache.Set("bus:2", mockBuses[2])
+	cache.Get("bus:1")
+	cache.Set("bus:3", mockBuses[3])
+	if _, found, _ := cache.Get("bus:2"); found {
+		t.Error("least recently used entry wasn't evicted")
+	}
+	if _, found, _ := cache.Get("bus:1"); !found {
+		t.Error("recently used entry was evicted")
+	}
+
+	now = now.Add(time.Minute)
+	if _, found, _ := cache.Get("bus:3"); found {
+		t.Error("expired entry still found")
+	}
+}
+
+func TestCachedDirectory(t *testing.T) {
+	upstream := &countingDirectory{}
+	cached := NewCachedDirectory(upstream, NewMemoryDirectoryCache(10, time.Minute))
+
+	for range 3 {
+		if bus, _ := cached.Bus(1); bus["plate_number"] != "ABC-1234" {
+			t.Fatalf("bus = %v", bus)
+		}
+		if bus, _ := cached.Bus(99); bus != nil {
+			t.Fatalf("unknown bus = %v", bus)
+		}
+	}
+	if upstream.calls != 2 {
+		t.Errorf("%d upstream calls, want one per ID", upstream.calls)
+	}
+
+	cached.Invalidate([]int{1}, nil)
+	cached.Bus(1)
+	cached.Bus(99)
+	if upstream.calls != 3 {
+		t.Errorf("%d upstream calls, want only the invalidated bus fetched again", upstream.calls)
+	}
+
+	upstream.err = errors.New("bus service down")
+	cached.Invalidate(nil, nil)
+	if _, err := cached.Bus(1); err == nil {
+		t.Error("upstream failure was hidden")
+	}
+	upstream.err = nil
+	if bus, _ := cached.Bus(1); bus == nil {
+		t.Error("failed lookup was cached")
+	}
+}
+
+func TestInvalidateDirectoryCacheEndpoint(t *testing.T) {
+	upstream := &countingDirectory{}
+	saved := directory
+	directory = NewCachedDirectory(upstream, NewMemoryDirectoryCache(10, time.Minute))
+	defer func() { directory = saved }()
+	router, repo := newTestRouter(t)
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03")})
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 2, Role: "conductor", StartDate: date("2025-03-03")})
+
+	list := func() {
+		if rec := doRequest(router, http.MethodGet, "/api/assignments", nil); rec.Code != http.StatusOK {
+			t.Fatalf("list status = %d", rec.Code)
+		}
+	}
+	list()
+	list()
+	if upstream.calls != 3 {
+		t.Errorf("%d directory calls for two lists, want one per bus and staff member", upstream.calls)
+	}
+
+	if rec := doRequest(router, http.MethodPost, "/api/cache/invalidate", gin.H{"staff_ids": []int{2}}); rec.Code != http.StatusNoContent {
+		t.Fatalf("invalidate status = %d: %s", rec.Code, rec.Body.String())
+	}
+	list()
+	if upstream.calls != 4 {
+		t.Errorf("%d directory calls, want staff 2 fetched again", upstream.calls)
+	}
+	if rec := doRequest(router, http.MethodPost, "/api/cache/invalidate", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("flush status = %d", rec.Code)
+	}
+	list()
+	if upstream.calls != 7 {
+		t.Errorf("%d directory calls, want everything fetched after a flush", upstream.calls)
+	}
+}
+
+// fakeRedis serves GET, SET, DEL and SCAN from a map, enough for the cache,
+// refusing anything else, the client's handshake included, as an old Redis would
+func fakeRedis(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("can't listen:", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	data := map[string]string{"other:key": "kept"}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					var args []string
+					header, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					n, _ := strconv.Atoi(strings.TrimSpace(header[1:]))
+					for range n {
+						reader.ReadString('\n')
+						arg, _ := reader.ReadString('\n')
+						args = append(args, strings.TrimSuffix(arg, "\r\n"))
+					}
+					switch strings.ToUpper(args[0]) {
+					case "GET":
+						if value, ok := data[args[1]]; ok {
+							fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(value), value)
+						} else {
+							io.WriteString(conn, "$-1\r\n")
+						}
+					case "SET":
+						data[args[1]] = args[2]
+						io.WriteString(conn, "+OK\r\n")
+					case "DEL":
+						for _, key := range args[1:] {
+							delete(data, key)
+						}
+						fmt.Fprintf(conn, ":%d\r\n", len(args)-1)
+					case "SCAN":
+						var keys []string
+						for key := range data {
+							if strings.HasPrefix(key, redisKeyPrefix) {
+								keys = append(keys, key)
+							}
+						}
+						fmt.Fprintf(conn, "*2\r\n$1\r\n0\r\n*%d\r\n", len(keys))
+						for _, key := range keys {
+							fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(key), key)
+						}
+					default:
+						io.WriteString(conn, "-ERR unknown command\r\n")
+					}
+				}
+			}()
+		}
+	}()
+	return "redis://" + listener.Addr().String()
+}
+
+func TestRedisDirectoryCache(t *testing.T) {
+	cache, err := newRedisDirectoryCache(fakeRedis(t), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, found, err := cache.Get("bus:1"); found || err != nil {
+		t.Fatalf("empty cache found = %v, err = %v", found, err)
+	}
+	cache.Set("bus:1", mockBuses[1])
+	cache.Set("bus:99", map[string]string{})
+	if entry, found, err := cache.Get("bus:1"); !found || err != nil || entry["plate_number"] != "ABC-1234" {
+		t.Errorf("cached bus = %v %v %v", entry, found, err)
+	}
+	if entry, found, _ := cache.Get("bus:99"); !found || len(entry) != 0 {
+		t.Errorf("cached unknown bus = %v %v", entry, found)
+	}
+
+	cache.Delete([]string{"bus:1"})
+	if _, found, _ := cache.Get("bus:1"); found {
+		t.Error("deleted entry still found")
+	}
+	if err := cache.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := cache.Get("bus:99"); found {
+		t.Error("flushed entry still found")
+	}
+	if err := cache.client.Ping(context.Background()).Err(); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("error reply = %v", err)
+	}
+	if reply, _ := cache.client.Get(context.Background(), "other:key").Result(); reply != "kept" {
+		t.Errorf("flush touched other keys: %v", reply)
+	}
+}
+
+func TestRedisDirectoryCacheURL(t *testing.T) {
+	cache, err := newRedisDirectoryCache("rediss://:secret@redis.example.com:6380/2", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := cache.client.Options()
+	if options.TLSConfig == nil || options.Addr != "redis.example.com:6380" || options.Password != "secret" || options.DB != 2 {
+		t.Errorf("rediss:// options = %+v, want TLS to the host with its password and database", options)
+	}
+	if _, err := newRedisDirectoryCache("http://redis:6379", time.Minute); err == nil {
+		t.Error("non-Redis URL accepted")
+	}
+}
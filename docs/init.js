@@ -0,0 +1,12 @@
+// Renders the service's own spec. "Try it out" calls go to the server picked
+// from the spec's servers list, with the bearer token entered under Authorize.
+"use strict";
+
+window.addEventListener("DOMContentLoaded", () => {
+  window.ui = SwaggerUIBundle({
+    url: "/api/openapi.json",
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    persistAuthorization: false,
+  });
+});
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DuplicateStaff is a pair of overlapping active assignments giving one staff
+// member two roles on the same bus, usually a data entry error
+type DuplicateStaff struct {
+	StaffID        int          `json:"staff_id"`
+	StaffName      string       `json:"staff_name,omitempty"`
+	BusID          int          `json:"bus_id"`
+	BusPlateNumber string       `json:"bus_plate_number,omitempty"`
+	Assignments    []Assignment `json:"assignments"`
+}
+
+// findDuplicateStaff pairs up the active assignments that hold the same staff
+// member on the same bus in different roles on a shared working day and
+// shift, skipping pairs where either assignment allows dual roles
+func findDuplicateStaff(assignments []Assignment) []DuplicateStaff {
+	type staffOnBus struct{ staffID, busID int }
+	groups := map[staffOnBus][]Assignment{}
+	for _, assignment := range assignments {
+		if assignment.Status == "active" && !assignment.DualRoleAllowed {
+			key := staffOnBus{assignment.StaffID, assignment.BusID}
+			groups[key] = append(groups[key], assignment)
+		}
+	}
+
+	duplicates := []DuplicateStaff{}
+	for key, group := range groups {
+		for i := range group {
+			for j := i + 1; j < len(group); j++ {
+				a, b := group[i], group[j]
+				if a.Role == b.Role || !a.SharesWorkingDay(&b) || !a.SharesShiftTime(&b) {
+					continue
+				}
+
+				duplicate := DuplicateStaff{StaffID: key.staffID, BusID: key.busID, Assignments: []Assignment{a, b}}
+				if staff := lookupStaff(key.staffID); staff != nil {
+					duplicate.StaffName = staff["name"]
+				}
+				if bus := lookupBus(key.busID); bus != nil {
+					duplicate.BusPlateNumber = bus["plate_number"]
+				}
+				duplicates = append(duplicates, duplicate)
+			}
+		}
+	}
+
+	sort.Slice(duplicates, func(i, j int) bool {
+		if duplicates[i].StaffID != duplicates[j].StaffID {
+			return duplicates[i].StaffID < duplicates[j].StaffID
+		}
+		return duplicates[i].Assignments[0].ID < duplicates[j].Assignments[0].ID
+	})
+	return duplicates
+}
+
+func (h *AssignmentHandler) handleGetDuplicateStaff(c *gin.Context) {
+	h = h.forRequest(c)
+	assignments, err := h.repo.List(AssignmentFilter{Status: "active", Depot: c.Query("depot"), Sort: "created_at",
+		Clearance: callerClearance(c)})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve assignments")
+		return
+	}
+
+	duplicates := findDuplicateStaff(assignments)
+	c.JSON(http.StatusOK, gin.H{"duplicates": duplicates, "count": len(duplicates)})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCreateAssignmentSameStaffOtherRoleOnBus(t *testing.T) {
+	router, repo := newTestRouter(t)
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+
+	body := gin.H{"bus_id": 1, "staff_id": 1, "role": "conductor", "start_date": "2025-02-01"}
+	if rec := doRequest(router, http.MethodPost, "/api/assignments", body); rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body.String())
+	}
+
+	body["dual_role_allowed"] = true
+	rec := doRequest(router, http.MethodPost, "/api/assignments", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("allowed status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	if created := decode[Assignment](t, rec); !created.DualRoleAllowed {
+		t.Error("dual_role_allowed was not saved")
+	}
+}
+
+func TestGetDuplicateStaff(t *testing.T) {
+	router, repo := newTestRouter(t)
+	// Written straight to the repository, as older data entry did
+	driver := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+	conductor := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "conductor", StartDate: date("2025-03-01")})
+	mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-01-01")})
+	mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "conductor", StartDate: date("2025-01-01"), DualRoleAllowed: true})
+
+	rec := doRequest(router, http.MethodGet, "/api/assignments/duplicate-staff", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	body := decode[struct{ Duplicates []DuplicateStaff }](t, rec)
+	if len(body.Duplicates) != 1 {
+		t.Fatalf("duplicates = %+v, want one", body.Duplicates)
+	}
+	got := body.Duplicates[0]
+	if got.StaffID != 1 || got.BusID != 1 || got.Assignments[0].PublicID != driver.PublicID ||
+		got.Assignments[1].PublicID != conductor.PublicID {
+		t.Errorf("duplicate = %+v, want assignments %s and %s", got, driver.PublicID, conductor.PublicID)
+	}
+
+	rec = doRequest(router, http.MethodGet, "/api/assignments/duplicate-staff?depot=south", nil)
+	if body := decode[struct{ Count int }](t, rec); body.Count != 0 {
+		t.Errorf("south depot count = %d, want 0", body.Count)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"bus-staff-assignment/apierror"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError and APIError are the envelope's, as Go clients read it back
+type (
+	FieldError = apierror.FieldError
+	APIError   = apierror.Error
+)
+
+// newAPIError builds the envelope for a status; naming fields makes it a
+// validation failure
+func newAPIError(status int, message string, fields ...FieldError) APIError {
+	code := apierror.CodeFor(status)
+	if len(fields) > 0 {
+		code = apierror.CodeValidationFailed
+	}
+	return APIError{Code: code, Message: message, Fields: fields}
+}
+
+// newRuleViolation builds the envelope for a change a business rule refused.
+// The rule's detail goes beside it under the name apierror documents.
+func newRuleViolation(rule, message string, fields ...FieldError) APIError {
+	return APIError{Code: apierror.CodeRuleViolation, Message: message, Rule: rule, Fields: fields}
+}
+
+// respondError writes an error response with nothing beside the envelope
+func respondError(c *gin.Context, status int, message string) {
+	c.JSON(status, gin.H{"error": newAPIError(status, message)})
+}
+
+// abortWithError is respondError for middleware, stopping the chain
+func abortWithError(c *gin.Context, status int, message string) {
+	c.AbortWithStatusJSON(status, gin.H{"error": newAPIError(status, message)})
+}
+
+// respondInvalid rejects a request with a 400 naming the fields at fault. The
+// message repeats the first field's, for clients that only show one line.
+func respondInvalid(c *gin.Context, fields ...FieldError) {
+	message := "Invalid request"
+	if len(fields) > 0 {
+		message = fields[0].Message
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": newAPIError(http.StatusBadRequest, message, fields...)})
+}
+
+// respondInvalidField rejects a request over a single field
+func respondInvalidField(c *gin.Context, field, message string) {
+	respondInvalid(c, FieldError{Field: field, Message: message})
+}
+
+// respondBindError rejects a body that ShouldBindJSON couldn't bind into req,
+// naming the JSON fields at fault instead of the Go ones
+func respondBindError(c *gin.Context, req any, err error) {
+	var invalid validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &invalid):
+		fields := make([]FieldError, 0, len(invalid))
+		for _, fieldErr := range invalid {
+			name := jsonFieldPath(reflect.TypeOf(req), fieldErr.StructNamespace())
+			fields = append(fields, FieldError{Field: name, Message: validationMessage(name, fieldErr)})
+		}
+		respondInvalid(c, fields...)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		respondInvalidField(c, typeErr.Field, fmt.Sprintf("%s must be %s", typeErr.Field, jsonKind(typeErr.Type)))
+	case errors.Is(err, io.EOF):
+		respondError(c, http.StatusBadRequest, "Request body is required")
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		respondError(c, http.StatusBadRequest, "Request body is not valid JSON")
+	default:
+		// Custom unmarshalers, such as for shift times, explain themselves
+		respondError(c, http.StatusBadRequest, err.Error())
+	}
+}
+
+// validationMessage explains a failed binding tag
+func validationMessage(field string, fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return field + " is required"
+	default:
+		return fmt.Sprintf("%s failed the %s check", field, fieldErr.Tag())
+	}
+}
+
+// jsonFieldPath turns a validator struct namespace such as
+// "ScenarioEditRequest.Edits[0].Assignment.Role" into the JSON path
+// "edits[0].assignment.role". Embedded structs add no segment, as in JSON.
+func jsonFieldPath(t reflect.Type, namespace string) string {
+	segments := strings.Split(namespace, ".")[1:] // the first is the request type
+	path := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		name, index, _ := strings.Cut(segment, "[")
+		if index != "" {
+			index = "[" + index
+		}
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			path = append(path, segment)
+			continue
+		}
+		field, ok := t.FieldByName(name)
+		if !ok {
+			path = append(path, segment)
+			continue
+		}
+		t = field.Type
+		if field.Anonymous {
+			continue
+		}
+		if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag != "" && tag != "-" {
+			name = tag
+		}
+		path = append(path, name+index)
+	}
+	return strings.Join(path, ".")
+}
+
+// jsonKind names the JSON a Go type is decoded from
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"bus-staff-assignment/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+// errorOf decodes the error envelope of a response
+func errorOf(t *testing.T, rec *httptest.ResponseRecorder) APIError {
+	t.Helper()
+	return decode[struct{ Error APIError }](t, rec).Error
+}
+
+// fieldNames lists the fields an error names, in order
+func fieldNames(apiErr APIError) []string {
+	names := make([]string, 0, len(apiErr.Fields))
+	for _, field := range apiErr.Fields {
+		names = append(names, field.Field)
+	}
+	return names
+}
+
+func TestValidationErrorsNameFields(t *testing.T) {
+	router, repo := newTestRouter(t)
+	existing := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03")})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		fields []string
+	}{
+		{"missing fields", http.MethodPost, "/api/assignments", gin.H{"role": "driver"},
+			[]string{"bus_id", "staff_id", "start_date"}},
+		{"embedded request", http.MethodPut, "/api/assignments/" + existing.PublicID, gin.H{"bus_id": 1},
+			[]string{"staff_id", "role", "start_date"}},
+		{"wrong type", http.MethodPost, "/api/assignments",
+			gin.H{"bus_id": "one", "staff_id": 1, "role": "driver", "start_date": "2025-03-03"}, []string{"bus_id"}},
+		{"date format", http.MethodPost, "/api/assignments",
+			gin.H{"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": "03/03/2025"}, []string{"start_date"}},
+		{"role", http.MethodPost, "/api/assignments",
+			gin.H{"bus_id": 1, "staff_id": 1, "role": "pilot", "start_date": "2025-03-03"}, []string{"role"}},
+		{"patch date", http.MethodPatch, "/api/assignments/" + existing.PublicID, gin.H{"end_date": "soon", "version": existing.Version},
+			[]string{"end_date"}},
+		{"query parameter", http.MethodGet, "/api/assignments?role=pilot", nil, []string{"role"}},
+		{"view filter", http.MethodPut, "/api/views/mine", gin.H{"filter": gin.H{"sort": "name"}},
+			[]string{"filter.sort"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(router, tt.method, tt.path, tt.body)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+			}
+			got := errorOf(t, rec)
+			if got.Code != apierror.CodeValidationFailed || !slices.Equal(fieldNames(got), tt.fields) {
+				t.Errorf("error = %+v, want %s on %v", got, apierror.CodeValidationFailed, tt.fields)
+			}
+			if got.Message == "" || got.Message != got.Fields[0].Message {
+				t.Errorf("message = %q, want the first field's", got.Message)
+			}
+		})
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	rec := doRequest(router, http.MethodGet, "/api/assignments/01HZX3M8Q4V6N2B7C9D1E5F0GA", nil)
+	if got := errorOf(t, rec); rec.Code != http.StatusNotFound || got.Code != apierror.CodeNotFound || got.Fields != nil {
+		t.Errorf("missing assignment = %d %+v, want %d %s without fields", rec.Code, got, http.StatusNotFound, apierror.CodeNotFound)
+	}
+
+	rec = doRequest(router, http.MethodPost, "/api/assignments", nil)
+	if got := errorOf(t, rec); got.Code != apierror.CodeInvalidRequest || got.Message != "Request body is required" {
+		t.Errorf("empty body = %+v, want %s saying the body is required", got, apierror.CodeInvalidRequest)
+	}
+}
+
+func TestRuleViolationsReachClients(t *testing.T) {
+	router, _ := newTestRouter(t)
+	rec := doRequest(router, http.MethodPost, "/api/availability", gin.H{
+		"staff_id": 1, "type": "leave", "start_date": "2025-02-04", "end_date": "2025-02-06",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create availability status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(router, http.MethodPost, "/api/assignments",
+		gin.H{"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": "2025-02-01"})
+	err := apierror.FromResponse(rec.Result())
+	var apiErr *apierror.Error
+	if !errors.Is(err, apierror.ErrRuleViolation) || !errors.As(err, &apiErr) || apiErr.Rule != apierror.RuleStaffAvailability {
+		t.Fatalf("error = %v, want the staff availability rule", err)
+	}
+	var unavailable []AvailabilityPeriod
+	if ok, err := apiErr.Detail("unavailable", &unavailable); !ok || err != nil || len(unavailable) != 1 {
+		t.Errorf("unavailable = %+v (%v), want the leave period", unavailable, err)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+)
+
+// Assignment event types published to other services
+const (
+	EventAssignmentCreated   = "assignment.created"
+	EventAssignmentUpdated   = "assignment.updated"
+	EventAssignmentCancelled = "assignment.cancelled"
+)
+
+// AssignmentEvent is the envelope published for every assignment change
+type AssignmentEvent struct {
+	ID         int64      `json:"id"`
+	Type       string     `json:"type"`
+	OccurredAt time.Time  `json:"occurred_at"`
+	Actor      string     `json:"actor"`
+	Assignment Assignment `json:"assignment"`
+}
+
+// notifyOutboxEvents sends a NOTIFY as each event commits, which every
+// replica's assignment stream listens for. A storage backend whose database
+// has no NOTIFY, such as CockroachDB, turns it off when it registers, and the
+// stream polls the outbox instead.
+var notifyOutboxEvents = true
+
+// enqueueEvent stores an event in the outbox inside the transaction making the
+// change, so it is published if and only if the change commits. The NOTIFY is
+// also delivered on commit, telling every replica's assignment stream, and the
+// staff member's notifications are queued alongside.
+func enqueueEvent(ctx context.Context, tx pgx.Tx, eventType, actor string, assignment *Assignment) error {
+	payload, err := json.Marshal(assignment)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO assignment_outbox (event_type, assignment_id, actor, payload)
+		VALUES ($1, $2, $3, $4)
+	`
+	if notifyOutboxEvents {
+		query = `
+			WITH event AS (
+				INSERT INTO assignment_outbox (event_type, assignment_id, actor, payload)
+				VALUES ($1, $2, $3, $4)
+				RETURNING id
+			)
+			SELECT pg_notify('` + assignmentEventsChannel + `', id::text) FROM event
+		`
+	}
+	if _, err := tx.Exec(ctx, query, eventType, assignment.ID, actor, string(payload)); err != nil {
+		return err
+	}
+	return queueNotificationsTx(ctx, tx, eventType, assignment)
+}
+
+// updateEventType picks the event for an update, treating a move to
+// cancelled as a cancellation rather than a plain update
+func updateEventType(before, after *Assignment) string {
+	if after.Status == "cancelled" && before.Status != "cancelled" {
+		return EventAssignmentCancelled
+	}
+	return EventAssignmentUpdated
+}
+
+// EventPublisher delivers serialized events to a message broker
+type EventPublisher interface {
+	Publish(ctx context.Context, event *AssignmentEvent, payload []byte) error
+	Close() error
+}
+
+// NewEventPublisher builds the publisher selected by EVENT_BROKER
+// (nats, kafka, or none). With none, events are drained from the outbox
+// without being sent anywhere.
+func NewEventPublisher() (EventPublisher, error) {
+	broker := strings.ToLower(os.Getenv("EVENT_BROKER"))
+	switch broker {
+	case "", "none":
+		log.Println("EVENT_BROKER not set, assignment events will not be published")
+		return noopPublisher{}, nil
+	case "nats":
+		return newNATSPublisher()
+	case "kafka":
+		return newKafkaPublisher()
+	default:
+		return nil, fmt.Errorf("unsupported EVENT_BROKER %q (use nats, kafka or none)", broker)
+	}
+}
+
+type noopPublisher struct{}
+
+func (noopPublisher) Publish(context.Context, *AssignmentEvent, []byte) error { return nil }
+func (noopPublisher) Close() error                                            { return nil }
+
+// natsPublisher publishes each event to a subject named after its type,
+// optionally prefixed with NATS_SUBJECT_PREFIX
+type natsPublisher struct {
+	conn   *nats.Conn
+	prefix string
+}
+
+func newNATSPublisher() (*natsPublisher, error) {
+	url := os.Getenv("NATS_URL")
+	if url == "" {
+		url = nats.DefaultURL
+	}
+
+	conn, err := nats.Connect(url, nats.Name("bus-staff-assignment"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to NATS: %w", err)
+	}
+
+	log.Printf("Publishing assignment events to NATS at %s", url)
+	return &natsPublisher{conn: conn, prefix: os.Getenv("NATS_SUBJECT_PREFIX")}, nil
+}
+
+func (p *natsPublisher) Publish(ctx context.Context, event *AssignmentEvent, payload []byte) error {
+	msg := nats.NewMsg(p.prefix + event.Type)
+	msg.Data = payload
+	msg.Header.Set(nats.MsgIdHdr, strconv.FormatInt(event.ID, 10))
+	if err := p.conn.PublishMsg(msg); err != nil {
+		return err
+	}
+	return p.conn.FlushWithContext(ctx)
+}
+
+func (p *natsPublisher) Close() error {
+	return p.conn.Drain()
+}
+
+// kafkaPublisher writes events to KAFKA_TOPIC keyed by assignment ID, so all
+// events for one assignment land on the same partition in order
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func newKafkaPublisher() (*kafkaPublisher, error) {
+	brokers := os.Getenv("KAFKA_BROKERS")
+	if brokers == "" {
+		return nil, fmt.Errorf("KAFKA_BROKERS is required when EVENT_BROKER=kafka")
+	}
+	topic := os.Getenv("KAFKA_TOPIC")
+	if topic == "" {
+		topic = "assignment-events"
+	}
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(strings.Split(brokers, ",")...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}
+
+	log.Printf("Publishing assignment events to Kafka topic %s", topic)
+	return &kafkaPublisher{writer: writer}, nil
+}
+
+func (p *kafkaPublisher) Publish(ctx context.Context, event *AssignmentEvent, payload []byte) error {
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(event.Assignment.PublicID),
+		Value: payload,
+		Headers: []kafka.Header{
+			{Key: "event-type", Value: []byte(event.Type)},
+			{Key: "event-id", Value: []byte(strconv.FormatInt(event.ID, 10))},
+		},
+	})
+}
+
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// expiryActor is recorded in the audit trail for assignments completed
+// because their end date passed
+const expiryActor = "auto-complete"
+
+// expiryLockID keeps replicas from completing the same assignments at once
+const expiryLockID = 80820005
+
+// expiryBatchSize caps the assignments completed per run; the rest wait for
+// the next tick
+const expiryBatchSize = 500
+
+// AssignmentExpirer completes active assignments whose end date has passed,
+// so they drop out of current-crew views
+type AssignmentExpirer struct {
+	repo     AssignmentRepository
+	interval time.Duration
+}
+
+// NewAssignmentExpirer creates an expirer checking every
+// ASSIGNMENT_EXPIRY_INTERVAL (default 15m)
+func NewAssignmentExpirer(repo AssignmentRepository) *AssignmentExpirer {
+	return &AssignmentExpirer{repo: repo, interval: durationFromEnv("ASSIGNMENT_EXPIRY_INTERVAL", 15*time.Minute)}
+}
+
+// Run completes expired assignments until the context is cancelled
+func (e *AssignmentExpirer) Run(ctx context.Context) {
+	monitor := backgroundWorkers.Register("assignment_expirer", tickerStallAfter(e.interval),
+		countDueQueue(`SELECT count(*) FROM assignments WHERE status = 'active' AND deleted_at IS NULL AND end_date < $1::date`))
+	defer backgroundWorkers.Unregister("assignment_expirer")
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := e.completeExpired(ctx, clock.Now())
+			monitor.Record(err)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Assignment expiry error: %v", err)
+			}
+		}
+	}
+}
+
+// completeExpired completes the assignments that ended before now's date,
+// logging each one. The audit entries and assignment.updated events are
+// written with the change.
+func (e *AssignmentExpirer) completeExpired(ctx context.Context, now time.Time) ([]Assignment, error) {
+	completed, err := e.repo.WithContext(ctx).CompleteExpired(truncateDate(now), expiryActor)
+	for _, assignment := range completed {
+		log.Printf("Completed assignment %s (bus %d, staff %d), which ended %s", assignment.PublicID,
+			assignment.BusID, assignment.StaffID, assignment.EndDate.Format("2006-01-02"))
+	}
+	return completed, err
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestExpirerCompletesEndedAssignments(t *testing.T) {
+	repo := NewMemoryAssignmentRepository()
+	ended := date("2025-03-09")
+	endsToday := date("2025-03-10")
+	expired := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03"), EndDate: &ended})
+	current := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 2, Role: "conductor", StartDate: date("2025-03-03"), EndDate: &endsToday})
+	openEnded := mustCreate(t, repo, Assignment{BusID: 2, StaffID: 3, Role: "driver", StartDate: date("2025-01-01")})
+	cancelled := mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-03-03"), EndDate: &ended, Status: "cancelled"})
+
+	completed, err := NewAssignmentExpirer(repo).completeExpired(context.Background(), date("2025-03-10").Add(9*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(completed) != 1 || completed[0].ID != expired.ID || completed[0].Status != "completed" {
+		t.Fatalf("completed = %+v, want only the assignment that ended yesterday", completed)
+	}
+
+	for _, tt := range []struct {
+		assignment Assignment
+		want       string
+	}{{expired, "completed"}, {current, "active"}, {openEnded, "active"}, {cancelled, "cancelled"}} {
+		got, err := repo.Get(tt.assignment.ID)
+		if err != nil || got.Status != tt.want {
+			t.Errorf("assignment %d status = %+v, %v; want %s", tt.assignment.ID, got, err, tt.want)
+		}
+	}
+
+	history, err := repo.History(expired.PublicID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := history[len(history)-1]; last.Action != AuditActionStatusChange || last.Actor != expiryActor {
+		t.Errorf("last audit entry = %+v, want a status change by %s", last, expiryActor)
+	}
+
+	// A second run finds nothing left to do
+	again, err := NewAssignmentExpirer(repo).completeExpired(context.Background(), date("2025-03-10"))
+	if err != nil || len(again) != 0 {
+		t.Errorf("second run = %+v, %v; want nothing completed", again, err)
+	}
+}
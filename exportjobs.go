@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Export job statuses
+const (
+	ExportQueued    = "queued"
+	ExportRunning   = "running"
+	ExportSucceeded = "succeeded"
+	ExportFailed    = "failed"
+	ExportExpired   = "expired" // the artifact has been deleted
+)
+
+// maxExportCallbackAttempts bounds how often a completion webhook is retried
+const maxExportCallbackAttempts = 5
+
+// exportLinkTTL is how long a download link stays valid; main reads it from
+// EXPORT_LINK_TTL. Every read of a finished job issues a fresh link.
+var exportLinkTTL = 15 * time.Minute
+
+// ExportJob is an export too large to stream from a request, run in the
+// background and kept in the artifact store until it expires
+type ExportJob struct {
+	ID                string           `json:"id"`
+	Format            string           `json:"format"` // csv or anonymized
+	Filter            AssignmentFilter `json:"filter"`
+	IncludeDeleted    bool             `json:"include_deleted,omitempty"`
+	Status            string           `json:"status"`
+	RequestedBy       string           `json:"requested_by"`
+	CallbackURL       string           `json:"callback_url,omitempty"`
+	Rows              int              `json:"rows,omitempty"`
+	Size              int64            `json:"size,omitempty"` // bytes
+	Error             string           `json:"error,omitempty"`
+	SnapshotAt        *time.Time       `json:"snapshot_at,omitempty"` // the export has every change committed before it
+	DownloadURL       string           `json:"download_url,omitempty"`
+	DownloadExpiresAt *time.Time       `json:"download_expires_at,omitempty"`
+	CreatedAt         time.Time        `json:"created_at"`
+	StartedAt         *time.Time       `json:"started_at,omitempty"`
+	FinishedAt        *time.Time       `json:"finished_at,omitempty"`
+	ExpiresAt         *time.Time       `json:"expires_at,omitempty"` // when the artifact is deleted
+	CallbackSentAt    *time.Time       `json:"callback_sent_at,omitempty"`
+
+	Clearance        *Clearance `json:"-"` // the requester's, applied when the job runs
+	ArtifactKey      string     `json:"-"`
+	CallbackAttempts int        `json:"-"`
+}
+
+// CreateExportJobRequest describes the export to run. The filter is the
+// list's, as in saved views.
+type CreateExportJobRequest struct {
+	Format         string           `json:"format"`
+	Filter         AssignmentFilter `json:"filter"`
+	IncludeDeleted bool             `json:"include_deleted"`
+	CallbackURL    string           `json:"callback_url"`
+}
+
+// ExportJobRepository stores export jobs
+type ExportJobRepository interface {
+	Create(job *ExportJob) error
+	Get(id string) (*ExportJob, error)            // nil, nil when not found
+	List(requestedBy string) ([]ExportJob, error) // newest first
+	// Claim marks the oldest queued job running and returns it. A job left
+	// running since before staleBefore is claimed again, since its runner
+	// has presumably died. It returns nil, nil when nothing is waiting.
+	Claim(now, staleBefore time.Time) (*ExportJob, error)
+	Finish(job *ExportJob) error                    // stores the outcome of a claimed job
+	DueCallbacks(limit int) ([]ExportJob, error)    // finished jobs whose webhook hasn't been delivered
+	RecordCallback(id string, delivered bool) error // counts an attempt
+	DueExpiry(now time.Time) ([]ExportJob, error)   // succeeded jobs whose artifact has expired
+	MarkExpired(id string) error
+
+	WithContext(ctx context.Context) ExportJobRepository
+}
+
+// ExportJobHandler serves the export job endpoints
+type ExportJobHandler struct {
+	jobs ExportJobRepository
+}
+
+// NewExportJobHandler creates a handler backed by the given repository
+func NewExportJobHandler(jobs ExportJobRepository) *ExportJobHandler {
+	return &ExportJobHandler{jobs: jobs}
+}
+
+// forRequest returns the handler with its repositories bound to the request's context
+func (h *ExportJobHandler) forRequest(c *gin.Context) *ExportJobHandler {
+	ctx := c.Request.Context()
+	return &ExportJobHandler{jobs: h.jobs.WithContext(ctx)}
+}
+
+// withDownloadLink signs a fresh link to a finished job's artifact, lasting
+// exportLinkTTL but never past the artifact's own expiry
+func withDownloadLink(job *ExportJob, now time.Time) error {
+	if job.Status != ExportSucceeded || job.ArtifactKey == "" {
+		return nil
+	}
+	expires := now.Add(exportLinkTTL)
+	if job.ExpiresAt != nil && job.ExpiresAt.Before(expires) {
+		expires = *job.ExpiresAt
+	}
+	link, err := exportArtifacts.DownloadURL(job.ArtifactKey, expires)
+	if err != nil {
+		return err
+	}
+	job.DownloadURL, job.DownloadExpiresAt = link, &expires
+	return nil
+}
+
+// exportCallbackHosts are the callback hosts trusted on private addresses,
+// such as a service inside the cluster; main reads them from
+// EXPORT_CALLBACK_ALLOWED_HOSTS. Every other callback must reach a public
+// address, so a caller can't have the service post to its own network.
+var exportCallbackHosts = map[string]bool{}
+
+// errPrivateCallbackAddress refuses a callback connection to an address that
+// isn't public
+var errPrivateCallbackAddress = errors.New("callback address is not public")
+
+// LoadExportCallbackHosts reads EXPORT_CALLBACK_ALLOWED_HOSTS, comma-separated
+// host names or IP addresses
+func LoadExportCallbackHosts() map[string]bool {
+	hosts := map[string]bool{}
+	for _, host := range strings.Split(os.Getenv("EXPORT_CALLBACK_ALLOWED_HOSTS"), ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts[host] = true
+		}
+	}
+	return hosts
+}
+
+// publicAddress reports whether the address is routable on the internet:
+// not loopback, private, link-local (which has the cloud metadata endpoints),
+// carrier-grade NAT, multicast or unspecified
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() && addr.IsGlobalUnicast() && !addr.IsPrivate() &&
+		!netip.MustParsePrefix("100.64.0.0/10").Contains(addr)
+}
+
+// refusePrivateAddress is a net.Dialer Control refusing connections to
+// addresses that aren't public. It runs on the address about to be
+// connected to, after the host name is resolved, so a name can't resolve to
+// a public address when checked and a private one when dialled.
+func refusePrivateAddress(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil || !publicAddress(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", errPrivateCallbackAddress, address)
+	}
+	return nil
+}
+
+// newCallbackClient returns the client export callbacks are posted with. It
+// only connects to public addresses, following redirects included, unless
+// the host is in exportCallbackHosts. Proxies aren't used, since the proxy's
+// own address would be what the check sees.
+func newCallbackClient(timeout time.Duration) *http.Client {
+	public := &net.Dialer{Timeout: timeout, Control: refusePrivateAddress}
+	trusted := &net.Dialer{Timeout: timeout}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err == nil && exportCallbackHosts[strings.TrimSuffix(strings.ToLower(host), ".")] {
+			return trusted.DialContext(ctx, network, address)
+		}
+		return public.DialContext(ctx, network, address)
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// validateCallbackURL returns a client-facing message, or "" when the URL can
+// be posted to. Hosts given as addresses are checked here too, for a clear
+// 400 rather than failed deliveries; names are checked when they're dialled.
+func validateCallbackURL(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "callback_url must be an absolute http or https URL"
+	}
+	if len(raw) > 2048 {
+		return "callback_url must be at most 2048 characters"
+	}
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	if exportCallbackHosts[host] {
+		return ""
+	}
+	if addr, err := netip.ParseAddr(host); (err == nil && !publicAddress(addr)) || host == "localhost" ||
+		strings.HasSuffix(host, ".localhost") {
+		return "callback_url must not point at a private, loopback or link-local address"
+	}
+	return ""
+}
+
+// handleCreateExportJob queues an export and returns 202 with the job to poll
+func (h *ExportJobHandler) handleCreateExportJob(c *gin.Context) {
+	h = h.forRequest(c)
+	var req CreateExportJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, &req, err)
+		return
+	}
+	if req.Format == "" {
+		req.Format = "csv"
+	}
+	if req.Format != "csv" && req.Format != "anonymized" {
+		respondInvalidField(c, "format", "Unsupported export format. Use csv or anonymized")
+		return
+	}
+	if fieldErr := validateAssignmentFilter(req.Filter); fieldErr != nil {
+		fieldErr.Field = "filter." + fieldErr.Field
+		respondInvalid(c, *fieldErr)
+		return
+	}
+	if req.IncludeDeleted {
+		if principal := currentPrincipal(c); principal == nil || principal.Role != RoleAdmin {
+			respondError(c, http.StatusForbidden, "Only admins can see deleted assignments")
+			return
+		}
+	}
+	if req.Format == "anonymized" {
+		filter := req.Filter
+		filter.IncludeDeleted = req.IncludeDeleted
+		if msg := anonymizedFilterError(filter); msg != "" {
+			respondError(c, http.StatusBadRequest, msg)
+			return
+		}
+	}
+	req.CallbackURL = strings.TrimSpace(req.CallbackURL)
+	if msg := validateCallbackURL(req.CallbackURL); msg != "" {
+		respondInvalidField(c, "callback_url", msg)
+		return
+	}
+
+	now := time.Now()
+	id, err := newULID(now)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to create export job")
+		return
+	}
+	job := &ExportJob{
+		ID:             id,
+		Format:         req.Format,
+		Filter:         req.Filter,
+		IncludeDeleted: req.IncludeDeleted,
+		Status:         ExportQueued,
+		RequestedBy:    actorFromContext(c),
+		CallbackURL:    req.CallbackURL,
+		Clearance:      callerClearance(c),
+	}
+	if err := h.jobs.Create(job); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to create export job")
+		return
+	}
+
+	c.Header("Location", "/api/v1/exports/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// handleGetExportJob returns a job, with a download link once it has
+// succeeded. Jobs are visible to whoever requested them and to admins.
+func (h *ExportJobHandler) handleGetExportJob(c *gin.Context) {
+	h = h.forRequest(c)
+	id, ok := normalizeULID(c.Param("id"))
+	if !ok {
+		respondError(c, http.StatusNotFound, "Export job not found")
+		return
+	}
+	job, err := h.jobs.Get(id)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve export job")
+		return
+	}
+	principal := currentPrincipal(c)
+	if job == nil || (job.RequestedBy != actorFromContext(c) && (principal == nil || principal.Role != RoleAdmin)) {
+		respondError(c, http.StatusNotFound, "Export job not found")
+		return
+	}
+	if err := withDownloadLink(job, time.Now()); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to sign download link")
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// handleGetExportJobs lists the caller's export jobs, newest first
+func (h *ExportJobHandler) handleGetExportJobs(c *gin.Context) {
+	h = h.forRequest(c)
+	jobs, err := h.jobs.List(actorFromContext(c))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve export jobs")
+		return
+	}
+	if jobs == nil {
+		jobs = []ExportJob{}
+	}
+	c.JSON(http.StatusOK, gin.H{"exports": jobs, "count": len(jobs)})
+}
+
+// ExportRunner runs queued export jobs, stores their artifacts, posts their
+// completion webhooks and deletes artifacts once they expire. One job runs at
+// a time per instance; instances share the queue.
+type ExportRunner struct {
+	jobs        ExportJobRepository
+	assignments AssignmentRepository
+	store       ArtifactStore
+	client      *http.Client
+	interval    time.Duration
+	timeout     time.Duration // how long a job may run before another runner takes it over
+	retention   time.Duration // how long artifacts are kept
+}
+
+// NewExportRunner creates a runner polling every EXPORT_POLL_INTERVAL
+// (default 5s) and keeping artifacts for EXPORT_RETENTION (default 7 days)
+func NewExportRunner(jobs ExportJobRepository, assignments AssignmentRepository, store ArtifactStore) *ExportRunner {
+	return &ExportRunner{
+		jobs:        jobs,
+		assignments: assignments,
+		store:       store,
+		client:      newCallbackClient(durationFromEnv("EXPORT_CALLBACK_TIMEOUT", 10*time.Second)),
+		interval:    durationFromEnv("EXPORT_POLL_INTERVAL", 5*time.Second),
+		timeout:     durationFromEnv("EXPORT_JOB_TIMEOUT", 30*time.Minute),
+		retention:   durationFromEnv("EXPORT_RETENTION", 7*24*time.Hour),
+	}
+}
+
+// Run works through the queue until the context is cancelled
+func (r *ExportRunner) Run(ctx context.Context) {
+	monitor := backgroundWorkers.Register("export_runner", r.timeout+tickerStallAfter(r.interval),
+		countQueue(`SELECT count(*) FROM export_jobs WHERE status = 'queued'`))
+	defer backgroundWorkers.Unregister("export_runner")
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := r.runOnce(ctx)
+			monitor.Record(err)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Export runner error: %v", err)
+			}
+		}
+	}
+}
+
+// runOnce runs every waiting job, then delivers webhooks and expires artifacts
+func (r *ExportRunner) runOnce(ctx context.Context) error {
+	for ctx.Err() == nil {
+		now := time.Now()
+		job, err := r.jobs.WithContext(ctx).Claim(now, now.Add(-r.timeout))
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			break
+		}
+		r.run(ctx, job)
+		if err := r.jobs.WithContext(ctx).Finish(job); err != nil {
+			return err
+		}
+		log.Printf("Export %s %s for %s", job.ID, job.Status, job.RequestedBy)
+	}
+
+	if err := r.deliverCallbacks(ctx); err != nil {
+		return err
+	}
+	return r.expireArtifacts(ctx)
+}
+
+// run produces and stores a claimed job's artifact, recording the outcome on
+// the job
+func (r *ExportRunner) run(ctx context.Context, job *ExportJob) {
+	filter := job.Filter
+	filter.IncludeDeleted = job.IncludeDeleted
+	filter.Clearance = job.Clearance
+
+	fail := func(message string, err error) {
+		log.Printf("Export %s failed: %s: %v", job.ID, message, err)
+		job.Status, job.Error = ExportFailed, message
+		finished := time.Now()
+		job.FinishedAt = &finished
+	}
+
+	var artifact bytes.Buffer
+	var asOf time.Time
+	var err error
+	extension := ".csv"
+	switch job.Format {
+	case "anonymized":
+		extension = ".zip"
+		var assignments []Assignment
+		if asOf, assignments, err = snapshotAssignments(r.assignments.WithContext(ctx), filter); err == nil {
+			job.Rows, err = writeAnonymizedExport(&artifact, assignments, filter, asOf)
+		}
+	default:
+		asOf, job.Rows, err = exportAssignmentsCSV(&artifact, r.assignments.WithContext(ctx), filter, nil)
+	}
+	if err != nil {
+		fail("Failed to write the export", err)
+		return
+	}
+
+	key := job.ID + extension
+	if err := r.store.Put(ctx, key, artifactContentTypes[extension], artifact.Bytes()); err != nil {
+		fail("Failed to store the export", err)
+		return
+	}
+	finished := time.Now()
+	expires := finished.Add(r.retention)
+	job.Status, job.Error = ExportSucceeded, ""
+	job.ArtifactKey, job.Size = key, int64(artifact.Len())
+	job.SnapshotAt = &asOf
+	job.FinishedAt, job.ExpiresAt = &finished, &expires
+}
+
+// deliverCallbacks posts each finished job with a callback_url to it, as the
+// job would be read, so the receiver gets a fresh download link. Failures
+// are retried on later ticks, up to maxExportCallbackAttempts.
+func (r *ExportRunner) deliverCallbacks(ctx context.Context) error {
+	jobs, err := r.jobs.WithContext(ctx).DueCallbacks(20)
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		job := &jobs[i]
+		err := r.postCallback(ctx, job)
+		if err != nil {
+			log.Printf("Export %s callback attempt %d failed: %v", job.ID, job.CallbackAttempts+1, err)
+		}
+		if err := r.jobs.WithContext(ctx).RecordCallback(job.ID, err == nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ExportRunner) postCallback(ctx context.Context, job *ExportJob) error {
+	if err := withDownloadLink(job, time.Now()); err != nil {
+		return err
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.CallbackURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Retries resend the same key, so the receiver can discard repeats
+	req.Header.Set("Idempotency-Key", "export-"+job.ID)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("callback returned %s", resp.Status)
+	}
+	return nil
+}
+
+// expireArtifacts deletes artifacts past their retention, then marks their
+// jobs expired, so a failed delete is retried rather than orphaned
+func (r *ExportRunner) expireArtifacts(ctx context.Context) error {
+	jobs, err := r.jobs.WithContext(ctx).DueExpiry(time.Now())
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, job := range jobs {
+		if err := r.store.Delete(ctx, job.ArtifactKey); err != nil {
+			errs = append(errs, fmt.Errorf("deleting export %s: %w", job.ID, err))
+			continue
+		}
+		if err := r.jobs.WithContext(ctx).MarkExpired(job.ID); err != nil {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newExportRouter serves the API with a local artifact store, returning the
+// repositories a runner needs
+func newExportRouter(t *testing.T) (*gin.Engine, AssignmentRepository, ExportJobRepository) {
+	t.Helper()
+	artifacts, err := newLocalArtifactStore(t.TempDir(), []byte("test-signing-key"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := exportArtifacts
+	exportArtifacts = artifacts
+	t.Cleanup(func() { exportArtifacts = saved })
+
+	store := NewMemoryStorage()
+	router := gin.New()
+	setupRoutes(router, AuthConfig{Disabled: true}, store)
+	return router, store.Assignments, store.ExportJobs
+}
+
+// trustCallbackHosts lets export callbacks reach the hosts, such as a test
+// server on loopback, for the test
+func trustCallbackHosts(t *testing.T, hosts ...string) {
+	t.Helper()
+	saved := exportCallbackHosts
+	exportCallbackHosts = map[string]bool{}
+	for _, host := range hosts {
+		exportCallbackHosts[host] = true
+	}
+	t.Cleanup(func() { exportCallbackHosts = saved })
+}
+
+func TestExportJob(t *testing.T) {
+	router, repo, jobs := newExportRouter(t)
+	trustCallbackHosts(t, "127.0.0.1")
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03")})
+	mustCreate(t, repo, Assignment{BusID: 3, StaffID: 2, Role: "driver", StartDate: date("2025-03-03")})
+
+	var delivered []ExportJob
+	var keys []string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var job ExportJob
+		json.NewDecoder(r.Body).Decode(&job)
+		delivered = append(delivered, job)
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if len(delivered) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable) // retried on the next tick
+		}
+	}))
+	defer hook.Close()
+
+	rec := doRequest(router, http.MethodPost, "/api/v1/exports",
+		gin.H{"filter": gin.H{"depot": "north"}, "callback_url": hook.URL})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("create status = %d: %s", rec.Code, rec.Body.String())
+	}
+	job := decode[ExportJob](t, rec)
+	if job.Status != ExportQueued || job.Format != "csv" || rec.Header().Get("Location") != "/api/v1/exports/"+job.ID {
+		t.Fatalf("queued job = %+v, Location %q", job, rec.Header().Get("Location"))
+	}
+
+	runner := NewExportRunner(jobs, repo, exportArtifacts)
+	for range 2 {
+		if err := runner.runOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec = doRequest(router, http.MethodGet, "/api/v1/exports/"+job.ID, nil)
+	job = decode[ExportJob](t, rec)
+	if job.Status != ExportSucceeded || job.Rows != 1 || job.DownloadURL == "" || job.CallbackSentAt == nil || job.SnapshotAt == nil {
+		t.Fatalf("finished job = %+v", job)
+	}
+	if len(delivered) != 2 || delivered[1].DownloadURL == "" || keys[0] != "export-"+job.ID || keys[1] != keys[0] {
+		t.Errorf("callbacks = %+v with keys %v, want a retry with the same key", delivered, keys)
+	}
+
+	rec = doRequest(router, http.MethodGet, job.DownloadURL, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("download status = %d, type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n"); len(lines) != 2 || !strings.Contains(lines[1], ",1,1,driver,") {
+		t.Errorf("downloaded export = %q", rec.Body.String())
+	}
+
+	link, _ := url.Parse(job.DownloadURL)
+	query := link.Query()
+	query.Set("expires", "9999999999")
+	link.RawQuery = query.Encode()
+	if rec := doRequest(router, http.MethodGet, link.String(), nil); rec.Code != http.StatusForbidden {
+		t.Errorf("tampered link status = %d, want 403", rec.Code)
+	}
+
+	// Once the artifact expires it's deleted and the job no longer links to it
+	stored, _ := jobs.Get(job.ID)
+	past := time.Now().Add(-time.Second)
+	stored.ExpiresAt = &past
+	jobs.(*memoryExportJobRepository).jobs[job.ID] = *stored
+	if err := runner.runOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if rec := doRequest(router, http.MethodGet, job.DownloadURL, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("expired download status = %d, want 404", rec.Code)
+	}
+	if job := decode[ExportJob](t, doRequest(router, http.MethodGet, "/api/v1/exports/"+job.ID, nil)); job.Status != ExportExpired || job.DownloadURL != "" {
+		t.Errorf("expired job = %+v", job)
+	}
+}
+
+func TestCreateExportJobValidation(t *testing.T) {
+	router, _, _ := newExportRouter(t)
+
+	tests := []struct {
+		name string
+		body gin.H
+	}{
+		{"unknown format", gin.H{"format": "pdf"}},
+		{"relative callback", gin.H{"callback_url": "/hooks"}},
+		{"loopback callback", gin.H{"callback_url": "http://127.0.0.1:8082/hooks"}},
+		{"localhost callback", gin.H{"callback_url": "http://localhost./hooks"}},
+		{"metadata callback", gin.H{"callback_url": "http://169.254.169.254/latest/meta-data"}},
+		{"private callback", gin.H{"callback_url": "https://[fd00::1]/hooks"}},
+		{"mapped loopback callback", gin.H{"callback_url": "http://[::ffff:127.0.0.1]/hooks"}},
+		{"anonymized by staff", gin.H{"format": "anonymized", "filter": gin.H{"staff_id": 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := doRequest(router, http.MethodPost, "/api/v1/exports", tt.body); rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400: %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestExportCallbackClient(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer hook.Close()
+
+	// The address is checked as it's dialled, whatever the URL passed
+	trustCallbackHosts(t)
+	if _, err := newCallbackClient(time.Second).Post(hook.URL, "application/json", nil); !errors.Is(err,
+		errPrivateCallbackAddress) {
+		t.Errorf("post to loopback = %v, want errPrivateCallbackAddress", err)
+	}
+
+	trustCallbackHosts(t, "127.0.0.1")
+	resp, err := newCallbackClient(time.Second).Post(hook.URL, "application/json", nil)
+	if err != nil {
+		t.Fatalf("post to a trusted host = %v", err)
+	}
+	resp.Body.Close()
+	if msg := validateCallbackURL(hook.URL); msg != "" {
+		t.Errorf("validateCallbackURL of a trusted host = %q, want it accepted", msg)
+	}
+}
+
+func TestExportJobsAreTheRequesters(t *testing.T) {
+	secret := []byte("test-secret")
+	router := gin.New()
+	setupRoutes(router, AuthConfig{Secret: secret}, NewMemoryStorage())
+	auth := func(subject, role string) string {
+		return bearerToken(t, secret, subject, role)
+	}
+
+	rec := doRequest(router, http.MethodPost, "/api/v1/exports", gin.H{}, "Authorization", auth("bi-tool", "reporting"))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("create status = %d: %s", rec.Code, rec.Body.String())
+	}
+	job := decode[ExportJob](t, rec)
+
+	if rec := doRequest(router, http.MethodGet, "/api/v1/exports/"+job.ID, nil, "Authorization", auth("someone-else", "dispatcher")); rec.Code != http.StatusNotFound {
+		t.Errorf("other caller's status = %d, want 404", rec.Code)
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/v1/exports/"+job.ID, nil, "Authorization", auth("root", "admin")); rec.Code != http.StatusOK {
+		t.Errorf("admin's status = %d, want 200", rec.Code)
+	}
+	list := decode[struct{ Count int }](t, doRequest(router, http.MethodGet, "/api/v1/exports", nil, "Authorization", auth("someone-else", "dispatcher")))
+	if list.Count != 0 {
+		t.Errorf("other caller lists %d jobs", list.Count)
+	}
+	if rec := doRequest(router, http.MethodPost, "/api/v1/exports", gin.H{"include_deleted": true}, "Authorization", auth("bi-tool", "reporting")); rec.Code != http.StatusForbidden {
+		t.Errorf("include_deleted status = %d, want 403", rec.Code)
+	}
+}
+
+// fakeS3 serves path-style object PUTs, GETs and DELETEs from a map,
+// refusing requests that aren't SigV4 signed with the test's access key
+func fakeS3(t *testing.T) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+			http.Error(w, "unsigned request", http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = body
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				w.Header().Set("Content-Type", "application/xml")
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+				return
+			}
+			w.Write(body)
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestS3ArtifactStore(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	t.Setenv("AWS_CONFIG_FILE", missing)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", missing)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY")
+	server := fakeS3(t)
+	t.Setenv("EXPORT_S3_BUCKET", "exports")
+	t.Setenv("EXPORT_S3_REGION", "eu-west-1")
+	t.Setenv("EXPORT_S3_ENDPOINT", server.URL)
+	store, err := newS3ArtifactStore("EXPORT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "01JNB3S7Z8K4Q2M9X6T5V0W1YC.csv", "text/csv", []byte("id\n1\n")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := store.Get(ctx, "01JNB3S7Z8K4Q2M9X6T5V0W1YC.csv"); err != nil || string(data) != "id\n1\n" {
+		t.Errorf("get = %q, %v", data, err)
+	}
+	if err := store.Delete(ctx, "01JNB3S7Z8K4Q2M9X6T5V0W1YC.csv"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "01JNB3S7Z8K4Q2M9X6T5V0W1YC.csv"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("get deleted = %v, want os.ErrNotExist", err)
+	}
+
+	link, err := store.DownloadURL("01JNB3S7Z8K4Q2M9X6T5V0W1YC.csv", time.Now().Add(30*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := url.Parse(link)
+	query := parsed.Query()
+	if parsed.Host != strings.TrimPrefix(server.URL, "http://") || parsed.Path != "/exports/01JNB3S7Z8K4Q2M9X6T5V0W1YC.csv" ||
+		query.Get("X-Amz-Expires") != "604800" || query.Get("X-Amz-Signature") == "" ||
+		!strings.HasPrefix(query.Get("X-Amz-Credential"), "AKIDEXAMPLE/") {
+		t.Errorf("download link = %s, want a path-style link presigned for the longest SigV4 allows", link)
+	}
+
+	t.Setenv("EXPORT_S3_ENDPOINT", "not a url")
+	if _, err := newS3ArtifactStore("EXPORT"); err == nil {
+		t.Error("invalid endpoint accepted")
+	}
+}
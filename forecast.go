@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits on the forecast query parameters
+const (
+	defaultForecastWeeks = 4
+	maxForecastWeeks     = 26
+	defaultHistoryWeeks  = 12
+	maxHistoryWeeks      = 52
+)
+
+// ForecastSlot is the expected shortfall at one depot on one weekday,
+// averaged over the forecast dates falling on it
+type ForecastSlot struct {
+	Depot               string  `json:"depot"`
+	Weekday             string  `json:"weekday"`
+	Days                int     `json:"days"`                  // forecast dates on this weekday with service
+	PlannedStaff        float64 `json:"planned_staff"`         // staff assigned per day
+	KnownAbsences       float64 `json:"known_absences"`        // assigned staff already booked off per day
+	HistoricalStaffDays int     `json:"historical_staff_days"` // sample behind the sick rate
+	SickRate            float64 `json:"sick_rate"`             // share of past staff-days lost to sick leave
+	ExpectedAbsences    float64 `json:"expected_absences"`     // known plus predicted sick absences per day
+	StandbyNeeded       int     `json:"standby_needed"`        // expected absences rounded to whole staff
+}
+
+// forecastTally accumulates staff-days for one depot and weekday
+type forecastTally struct {
+	days, planned, known, pastStaffDays, pastSick int
+}
+
+type forecastKey struct {
+	depot   string
+	weekday time.Weekday
+}
+
+// absenceOn returns the type of the staff member's period covering the
+// date, or "" when they are available
+func absenceOn(periods []AvailabilityPeriod, date time.Time) string {
+	for _, period := range periods {
+		if !date.Before(truncateDate(period.StartDate)) && !date.After(truncateDate(period.EndDate)) {
+			return period.Type
+		}
+	}
+	return ""
+}
+
+// forecastCoverage predicts absences among the staff assigned over the weeks
+// from today. Each depot and weekday's sick rate is the share of its staff-days
+// in the preceding history weeks lost to sick leave; leave already booked for
+// the forecast dates counts in full. Days a depot runs no service are skipped,
+// and depot limits the forecast to one depot when set.
+func forecastCoverage(assignments []Assignment, periods []AvailabilityPeriod, calendars map[string]*DepotCalendar,
+	today time.Time, weeks, historyWeeks int, depot string) []ForecastSlot {
+	historyFrom := today.AddDate(0, 0, -7*historyWeeks)
+	to := today.AddDate(0, 0, 7*weeks-1)
+
+	absences := map[int][]AvailabilityPeriod{}
+	for _, period := range periods {
+		absences[period.StaffID] = append(absences[period.StaffID], period)
+	}
+	depots := map[string]bool{}
+	for busID := range mockBuses {
+		if d := busDepot(busID); d != "" && (depot == "" || d == depot) {
+			depots[d] = true
+		}
+	}
+
+	tallies := map[forecastKey]*forecastTally{}
+	tally := func(key forecastKey) *forecastTally {
+		if tallies[key] == nil {
+			tallies[key] = &forecastTally{}
+		}
+		return tallies[key]
+	}
+
+	for day := historyFrom; !day.After(to); day = day.AddDate(0, 0, 1) {
+		future := !day.Before(today)
+		running := map[string]bool{}
+		for d := range depots {
+			if running[d] = calendars[d].ServiceOn(day).Level != ServiceNone; running[d] && future {
+				tally(forecastKey{d, day.Weekday()}).days++
+			}
+		}
+
+		// A staff member counts once a day, at the depot of their first assignment
+		staffDepots := map[int]string{}
+		for i := range assignments {
+			d := busDepot(assignments[i].BusID)
+			if _, counted := staffDepots[assignments[i].StaffID]; counted || !running[d] || !assignments[i].WorksOn(day) {
+				continue
+			}
+			staffDepots[assignments[i].StaffID] = d
+		}
+
+		for staffID, d := range staffDepots {
+			t := tally(forecastKey{d, day.Weekday()})
+			absence := absenceOn(absences[staffID], day)
+			if future {
+				t.planned++
+				if absence != "" {
+					t.known++
+				}
+				continue
+			}
+			t.pastStaffDays++
+			if absence == AvailabilitySick {
+				t.pastSick++
+			}
+		}
+	}
+
+	slots := []ForecastSlot{}
+	for key, t := range tallies {
+		if t.days == 0 {
+			continue
+		}
+		slot := ForecastSlot{
+			Depot:               key.depot,
+			Weekday:             weekdayNames[key.weekday],
+			Days:                t.days,
+			PlannedStaff:        float64(t.planned) / float64(t.days),
+			KnownAbsences:       float64(t.known) / float64(t.days),
+			HistoricalStaffDays: t.pastStaffDays,
+		}
+		if t.pastStaffDays > 0 {
+			slot.SickRate = float64(t.pastSick) / float64(t.pastStaffDays)
+		}
+		slot.ExpectedAbsences = slot.KnownAbsences + (slot.PlannedStaff-slot.KnownAbsences)*slot.SickRate
+		slot.StandbyNeeded = int(math.Round(slot.ExpectedAbsences))
+
+		slot.PlannedStaff = roundTo(slot.PlannedStaff, 2)
+		slot.KnownAbsences = roundTo(slot.KnownAbsences, 2)
+		slot.SickRate = roundTo(slot.SickRate, 3)
+		slot.ExpectedAbsences = roundTo(slot.ExpectedAbsences, 2)
+		slots = append(slots, slot)
+	}
+	sort.Slice(slots, func(i, j int) bool {
+		if slots[i].Depot != slots[j].Depot {
+			return slots[i].Depot < slots[j].Depot
+		}
+		return weekdayIndex(slots[i].Weekday) < weekdayIndex(slots[j].Weekday)
+	})
+	return slots
+}
+
+func roundTo(value float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
+
+func weekdayIndex(name string) int {
+	for i, wd := range weekdayNames {
+		if wd == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// weeksParam reads an optional whole number of weeks between 1 and limit. It
+// returns false once an error response has been written.
+func weeksParam(c *gin.Context, name string, fallback, limit int) (int, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return fallback, true
+	}
+	weeks, err := strconv.Atoi(value)
+	if err != nil || weeks < 1 || weeks > limit {
+		respondInvalidField(c, name, fmt.Sprintf("%s must be between 1 and %d", name, limit))
+		return 0, false
+	}
+	return weeks, true
+}
+
+// handleGetForecast estimates coverage shortfalls per depot and weekday over
+// the coming weeks, so standby staff can be arranged in advance
+func (h *AssignmentHandler) handleGetForecast(c *gin.Context) {
+	h = h.forRequest(c)
+	weeks, ok := weeksParam(c, "weeks", defaultForecastWeeks, maxForecastWeeks)
+	if !ok {
+		return
+	}
+	historyWeeks, ok := weeksParam(c, "history_weeks", defaultHistoryWeeks, maxHistoryWeeks)
+	if !ok {
+		return
+	}
+	depot, ok := depotQuery(c)
+	if !ok {
+		return
+	}
+
+	today := today()
+	historyFrom := today.AddDate(0, 0, -7*historyWeeks)
+	to := today.AddDate(0, 0, 7*weeks-1)
+
+	assignments, err := h.repo.ListInRange(historyFrom, to, 0, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve assignments")
+		return
+	}
+	periods, err := h.availability.List(AvailabilityFilter{From: &historyFrom, To: &to})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve availability")
+		return
+	}
+	calendars, err := depotCalendars(h.calendars)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve depot calendars")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"weeks":        weeks,
+		"from":         today.Format("2006-01-02"),
+		"to":           to.Format("2006-01-02"),
+		"history_from": historyFrom.Format("2006-01-02"),
+		"history_to":   today.AddDate(0, 0, -1).Format("2006-01-02"),
+		"depot":        depot,
+		"forecast":     forecastCoverage(assignments, periods, calendars, today, weeks, historyWeeks, depot),
+	})
+}
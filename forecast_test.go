@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestForecastCoverage(t *testing.T) {
+	today := date("2025-03-03") // a Monday
+	assignments := []Assignment{
+		{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")},
+		{BusID: 1, StaffID: 2, Role: "conductor", StartDate: date("2025-01-01")},
+		{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-01-01")},
+	}
+	periods := []AvailabilityPeriod{
+		// Staff 1 was off sick on both Mondays in the history window
+		{StaffID: 1, Type: AvailabilitySick, StartDate: date("2025-02-17"), EndDate: date("2025-02-17")},
+		{StaffID: 1, Type: AvailabilitySick, StartDate: date("2025-02-24"), EndDate: date("2025-02-24")},
+		// Planned leave doesn't count towards the sick rate, only as a known absence
+		{StaffID: 2, Type: AvailabilityLeave, StartDate: date("2025-02-18"), EndDate: date("2025-02-18")},
+		{StaffID: 2, Type: AvailabilityLeave, StartDate: date("2025-03-04"), EndDate: date("2025-03-04")},
+	}
+	calendars := map[string]*DepotCalendar{
+		"south": {Depot: "south", Days: map[string]ServiceDay{"sun": {Level: ServiceNone}}},
+	}
+
+	slots := forecastCoverage(assignments, periods, calendars, today, 1, 2, "")
+	got := map[string]ForecastSlot{}
+	for _, slot := range slots {
+		got[slot.Depot+" "+slot.Weekday] = slot
+	}
+	if len(got) != 13 {
+		t.Errorf("got %d slots, want 7 north and 6 south (no Sunday service)", len(got))
+	}
+
+	tests := []struct {
+		slot           string
+		wantSickRate   float64
+		wantExpected   float64
+		wantStandby    int
+		wantHistorical int
+	}{
+		{"north mon", 0.5, 1, 1, 4},
+		{"north tue", 0, 1, 1, 4}, // staff 2 is on leave
+		{"north wed", 0, 0, 0, 4},
+		{"south mon", 0, 0, 0, 2},
+	}
+	for _, tt := range tests {
+		slot, ok := got[tt.slot]
+		if !ok {
+			t.Errorf("%s: no forecast", tt.slot)
+			continue
+		}
+		if slot.SickRate != tt.wantSickRate || slot.ExpectedAbsences != tt.wantExpected ||
+			slot.StandbyNeeded != tt.wantStandby || slot.HistoricalStaffDays != tt.wantHistorical {
+			t.Errorf("%s: got %+v", tt.slot, slot)
+		}
+	}
+	if _, ok := got["south sun"]; ok {
+		t.Error("south has no Sunday service but was forecast")
+	}
+
+	if north := forecastCoverage(assignments, periods, calendars, today, 1, 2, "north"); len(north) != 7 {
+		t.Errorf("depot filter returned %d slots, want 7", len(north))
+	}
+}
+
+func TestGetForecast(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	rec := doRequest(router, http.MethodGet, "/api/analytics/forecast?weeks=4", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body.String())
+	}
+	body := decode[struct {
+		Weeks    int
+		Forecast []ForecastSlot
+	}](t, rec)
+	if body.Weeks != 4 || body.Forecast == nil {
+		t.Errorf("unexpected forecast %+v", body)
+	}
+
+	for _, query := range []string{"?weeks=0", "?weeks=27", "?weeks=four", "?history_weeks=53"} {
+		if rec := doRequest(router, http.MethodGet, "/api/analytics/forecast"+query, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", query, rec.Code)
+		}
+	}
+}
@@ -1,66 +1,227 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"bus-staff-assignment/apierror"
 	"github.com/gin-gonic/gin"
 )
 
 // Assignment represents a bus-staff assignment
 type Assignment struct {
-	ID        int        `json:"id" db:"id"`
-	BusID     int        `json:"bus_id" db:"bus_id"`
-	StaffID   int        `json:"staff_id" db:"staff_id"`
-	Role      string     `json:"role" db:"role"` // driver, conductor
-	StartDate time.Time  `json:"start_date" db:"start_date"`
-	EndDate   *time.Time `json:"end_date,omitempty" db:"end_date"`
-	Status    string     `json:"status" db:"status"` // active, completed, cancelled
-	CreatedAt time.Time  `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+	ID              int        `json:"-" db:"id"`                                // internal; never exposed
+	PublicID        string     `json:"id" db:"public_id"`                        // ULID
+	Reference       string     `json:"reference" db:"reference"`                 // e.g. ASG-2024-000123
+	ExternalRef     string     `json:"external_ref,omitempty" db:"external_ref"` // ID in the legacy system
+	BusID           int        `json:"bus_id" db:"bus_id"`
+	StaffID         int        `json:"staff_id" db:"staff_id"`
+	Role            string     `json:"role" db:"role"` // driver, conductor
+	StartDate       time.Time  `json:"start_date" db:"start_date"`
+	EndDate         *time.Time `json:"end_date,omitempty" db:"end_date"`
+	WorkingDays     DayMask    `json:"working_days,omitempty" db:"working_days"` // empty means every day
+	ShiftStart      *TimeOfDay `json:"shift_start,omitempty" db:"shift_start"`   // empty means the whole day
+	ShiftEnd        *TimeOfDay `json:"shift_end,omitempty" db:"shift_end"`
+	DualRoleAllowed bool       `json:"dual_role_allowed,omitempty" db:"dual_role_allowed"` // may hold another role on the same bus
+	ClearanceLabel  string     `json:"clearance_label,omitempty" db:"clearance_label"`     // only callers with this clearance see it
+	DepotID         string     `json:"depot_id,omitempty" db:"depot_id"`                   // the bus's depot, kept in step with bus_id
+	Notes           string     `json:"notes,omitempty" db:"notes"`                         // dispatchers' context, e.g. why it was made
+	Status          string     `json:"status" db:"status"`                                 // active, completed, cancelled
+	Version         int        `json:"version" db:"version"`                               // incremented on every update
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty" db:"deleted_at"` // set once soft-deleted
+}
+
+// maxExternalRefLength matches the assignments.external_ref column
+const maxExternalRefLength = 100
+
+// maxNotesLength keeps notes to a few paragraphs; longer documents belong in
+// an attachment
+const maxNotesLength = 2000
+
+// assignmentReference formats the reference depot staff read out over the
+// phone instead of the raw ID
+func assignmentReference(id int, createdAt time.Time) string {
+	return fmt.Sprintf("ASG-%d-%06d", createdAt.UTC().Year(), id)
 }
 
 // AssignmentWithDetails includes bus and staff information
 type AssignmentWithDetails struct {
 	Assignment
-	BusPlateNumber string `json:"bus_plate_number,omitempty"`
-	BusModel       string `json:"bus_model,omitempty"`
-	StaffName      string `json:"staff_name,omitempty"`
-	StaffPosition  string `json:"staff_position,omitempty"`
+	BusPlateNumber string   `json:"bus_plate_number,omitempty"`
+	BusModel       string   `json:"bus_model,omitempty"`
+	StaffName      string   `json:"staff_name,omitempty"`
+	StaffPosition  string   `json:"staff_position,omitempty"`
+	PayClass       string   `json:"pay_class"`               // standard, holiday
+	HolidayDates   []string `json:"holiday_dates,omitempty"` // public holidays worked
+}
+
+// newAssignmentDetails wraps an assignment with the fields derived for every
+// enriched response, such as its pay classification
+func newAssignmentDetails(assignment Assignment) AssignmentWithDetails {
+	details := AssignmentWithDetails{Assignment: assignment}
+	details.PayClass, details.HolidayDates = publicHolidays.PayClass(&assignment)
+	return details
 }
 
 // Request structs
 type CreateAssignmentRequest struct {
-	BusID     int    `json:"bus_id" binding:"required"`
-	StaffID   int    `json:"staff_id" binding:"required"`
-	Role      string `json:"role" binding:"required"`
-	StartDate string `json:"start_date" binding:"required"` // YYYY-MM-DD format
-	EndDate   string `json:"end_date,omitempty"`
+	BusID           int        `json:"bus_id" binding:"required"`
+	StaffID         int        `json:"staff_id" binding:"required"`
+	Role            string     `json:"role" binding:"required"`
+	StartDate       string     `json:"start_date" binding:"required"` // YYYY-MM-DD format
+	EndDate         string     `json:"end_date,omitempty"`
+	WorkingDays     DayMask    `json:"working_days,omitempty"` // e.g. ["mon", "wed", "fri"]
+	ShiftStart      *TimeOfDay `json:"shift_start,omitempty"`  // HH:MM, set together with shift_end
+	ShiftEnd        *TimeOfDay `json:"shift_end,omitempty"`
+	DualRoleAllowed bool       `json:"dual_role_allowed,omitempty"` // allow another role on the same bus at the same time
+	ExternalRef     string     `json:"external_ref,omitempty"`      // ID in the legacy system, unique
+	ClearanceLabel  *string    `json:"clearance_label,omitempty"`   // kept by a PUT when omitted; empty removes it
+	Notes           *string    `json:"notes,omitempty"`             // kept by a PUT when omitted; empty removes them
+}
+
+// CloneAssignmentRequest holds optional overrides applied to the copied
+// assignment; omitted fields keep the source assignment's values.
+type CloneAssignmentRequest struct {
+	BusID           *int       `json:"bus_id,omitempty"`
+	StaffID         *int       `json:"staff_id,omitempty"`
+	Role            *string    `json:"role,omitempty"`
+	StartDate       *string    `json:"start_date,omitempty"` // YYYY-MM-DD format
+	EndDate         *string    `json:"end_date,omitempty"`   // empty string clears the end date
+	WorkingDays     *DayMask   `json:"working_days,omitempty"`
+	ShiftStart      *TimeOfDay `json:"shift_start,omitempty"`
+	ShiftEnd        *TimeOfDay `json:"shift_end,omitempty"`
+	DualRoleAllowed *bool      `json:"dual_role_allowed,omitempty"`
+	ExternalRef     *string    `json:"external_ref,omitempty"`    // never copied, since it must be unique
+	ClearanceLabel  *string    `json:"clearance_label,omitempty"` // empty removes it
+	Notes           *string    `json:"notes,omitempty"`           // empty removes them
+}
+
+// apply copies the fields set in the request onto the assignment. It returns
+// the field at fault for an unparseable date, or nil.
+func (req CloneAssignmentRequest) apply(assignment *Assignment) *FieldError {
+	if req.BusID != nil {
+		assignment.BusID = *req.BusID
+	}
+	if req.StaffID != nil {
+		assignment.StaffID = *req.StaffID
+	}
+	if req.Role != nil {
+		assignment.Role = *req.Role
+	}
+	if req.StartDate != nil {
+		startDate, err := time.Parse("2006-01-02", *req.StartDate)
+		if err != nil {
+			return &FieldError{Field: "start_date", Message: "Invalid start_date format. Use YYYY-MM-DD"}
+		}
+		assignment.StartDate = startDate
+	}
+	if req.EndDate != nil {
+		assignment.EndDate = nil
+		if *req.EndDate != "" {
+			ed, err := time.Parse("2006-01-02", *req.EndDate)
+			if err != nil {
+				return &FieldError{Field: "end_date", Message: "Invalid end_date format. Use YYYY-MM-DD"}
+			}
+			assignment.EndDate = &ed
+		}
+	}
+	if req.WorkingDays != nil {
+		assignment.WorkingDays = *req.WorkingDays
+	}
+	if req.ShiftStart != nil || req.ShiftEnd != nil {
+		assignment.ShiftStart, assignment.ShiftEnd = req.ShiftStart, req.ShiftEnd
+	}
+	if req.DualRoleAllowed != nil {
+		assignment.DualRoleAllowed = *req.DualRoleAllowed
+	}
+	if req.ExternalRef != nil {
+		assignment.ExternalRef = strings.TrimSpace(*req.ExternalRef)
+	}
+	if req.ClearanceLabel != nil {
+		assignment.ClearanceLabel = strings.TrimSpace(*req.ClearanceLabel)
+	}
+	if req.Notes != nil {
+		assignment.Notes = strings.TrimSpace(*req.Notes)
+	}
+	return nil
+}
+
+// UpdateAssignmentRequest holds the fields a PATCH changes; omitted fields
+// keep their current values. Unlike PUT it can also change the status.
+type UpdateAssignmentRequest struct {
+	CloneAssignmentRequest
+	Status  *string `json:"status,omitempty"`  // active, completed, cancelled
+	Version int     `json:"version,omitempty"` // expected current version, instead of If-Match
+}
+
+// ReplaceAssignmentRequest is the body of a PUT
+type ReplaceAssignmentRequest struct {
+	CreateAssignmentRequest
+	Version int `json:"version,omitempty"` // expected current version, instead of If-Match
 }
 
 // Mock data for demonstration (would come from other services in production)
 var mockBuses = map[int]map[string]string{
-	1: {"plate_number": "ABC-1234", "model": "Toyota Coaster"},
-	2: {"plate_number": "XYZ-5678", "model": "Isuzu NPR"},
+	1: {"plate_number": "ABC-1234", "model": "Toyota Coaster", "depot": "north"},
+	2: {"plate_number": "XYZ-5678", "model": "Isuzu NPR", "depot": "north"},
+	3: {"plate_number": "DEF-4321", "model": "Toyota Coaster", "depot": "south"},
+	4: {"plate_number": "UVW-8765", "model": "Isuzu NPR", "depot": "south"},
 }
 
 var mockStaff = map[int]map[string]string{
-	1: {"name": "John Driver", "position": "driver"},
-	2: {"name": "Jane Conductor", "position": "conductor"},
+	1: {"name": "John Driver", "position": "driver", "depot": "north", "hire_date": "2015-03-01"},
+	2: {"name": "Jane Conductor", "position": "conductor", "depot": "north", "hire_date": "2018-06-15"},
+	3: {"name": "Sam Relief", "position": "driver", "depot": "south", "hire_date": "2021-01-10"},
+}
+
+// AssignmentHandler serves the assignment endpoints from a repository
+type AssignmentHandler struct {
+	repo           AssignmentRepository
+	availability   AvailabilityRepository
+	calendars      DepotCalendarRepository
+	qualifications QualificationRepository
+	attachments    AttachmentRepository
+}
+
+// NewAssignmentHandler creates a handler backed by the given repositories.
+// Staff availability and qualifications are checked before an assignment is
+// saved, and depot calendars decide when buses need crew.
+func NewAssignmentHandler(repo AssignmentRepository, availability AvailabilityRepository,
+	calendars DepotCalendarRepository, qualifications QualificationRepository,
+	attachments AttachmentRepository) *AssignmentHandler {
+	return &AssignmentHandler{repo: repo, availability: availability, calendars: calendars,
+		qualifications: qualifications, attachments: attachments}
 }
 
-func handleCreateAssignment(c *gin.Context) {
+// forRequest returns the handler with its repositories bound to the request's
+// context, so its queries are cancelled with the request
+func (h *AssignmentHandler) forRequest(c *gin.Context) *AssignmentHandler {
+	ctx := c.Request.Context()
+	return &AssignmentHandler{repo: h.repo.WithContext(ctx), availability: h.availability.WithContext(ctx),
+		calendars: h.calendars.WithContext(ctx), qualifications: h.qualifications.WithContext(ctx),
+		attachments: h.attachments.WithContext(ctx)}
+}
+
+func (h *AssignmentHandler) handleCreateAssignment(c *gin.Context) {
+	h = h.forRequest(c)
 	var req CreateAssignmentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, &req, err)
 		return
 	}
 
 	// Parse start date
 	startDate, err := time.Parse("2006-01-02", req.StartDate)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format. Use YYYY-MM-DD"})
+		respondInvalidField(c, "start_date", "Invalid start_date format. Use YYYY-MM-DD")
 		return
 	}
 
@@ -69,116 +230,333 @@ func handleCreateAssignment(c *gin.Context) {
 	if req.EndDate != "" {
 		ed, err := time.Parse("2006-01-02", req.EndDate)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format. Use YYYY-MM-DD"})
+			respondInvalidField(c, "end_date", "Invalid end_date format. Use YYYY-MM-DD")
 			return
 		}
 		endDate = &ed
 	}
 
-	// Validate role
-	if req.Role != "driver" && req.Role != "conductor" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be 'driver' or 'conductor'"})
+	assignment := Assignment{
+		BusID:           req.BusID,
+		StaffID:         req.StaffID,
+		Role:            req.Role,
+		StartDate:       startDate,
+		EndDate:         endDate,
+		WorkingDays:     req.WorkingDays,
+		ShiftStart:      req.ShiftStart,
+		ShiftEnd:        req.ShiftEnd,
+		DualRoleAllowed: req.DualRoleAllowed,
+		ExternalRef:     strings.TrimSpace(req.ExternalRef),
+		Status:          "active",
+	}
+	if req.ClearanceLabel != nil {
+		assignment.ClearanceLabel = strings.TrimSpace(*req.ClearanceLabel)
+	}
+	if req.Notes != nil {
+		assignment.Notes = strings.TrimSpace(*req.Notes)
+	}
+
+	if fieldErr := validateAssignment(&assignment); fieldErr != nil {
+		respondInvalid(c, *fieldErr)
+		return
+	}
+	if !checkClearance(c, &assignment) || !checkSchedulingHorizon(c, &assignment) {
 		return
 	}
 
-	assignment := Assignment{
-		BusID:     req.BusID,
-		StaffID:   req.StaffID,
-		Role:      req.Role,
-		StartDate: startDate,
-		EndDate:   endDate,
-		Status:    "active",
+	if !h.checkExternalRef(c, &assignment) || !h.checkConflicts(c, &assignment) || !h.checkAvailability(c, &assignment) ||
+		!checkQualifications(c, h.qualifications, &assignment) {
+		return
 	}
 
-	if err := CreateAssignment(&assignment); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create assignment"})
+	if err := h.repo.Create(&assignment, actorFromContext(c)); err != nil {
+		if !respondDeletionHold(c, err) {
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Failed to create assignment")
 		return
 	}
 
+	setAssignmentETag(c, &assignment)
 	c.JSON(http.StatusCreated, assignment)
 }
 
-func handleGetAssignments(c *gin.Context) {
-	assignments, err := GetAllAssignments()
+// validateAssignment checks the fields shared by every write path and returns
+// the field at fault, or nil when the assignment is valid.
+func validateAssignment(assignment *Assignment) *FieldError {
+	if assignment.Role != "driver" && assignment.Role != "conductor" {
+		return &FieldError{Field: "role", Message: "Role must be 'driver' or 'conductor'"}
+	}
+	if assignment.EndDate != nil && assignment.EndDate.Before(assignment.StartDate) {
+		return &FieldError{Field: "end_date", Message: "end_date must not be before start_date"}
+	}
+	if assignment.ShiftStart == nil && assignment.ShiftEnd != nil {
+		return &FieldError{Field: "shift_start", Message: "shift_start and shift_end must be set together"}
+	}
+	if assignment.ShiftStart != nil && assignment.ShiftEnd == nil {
+		return &FieldError{Field: "shift_end", Message: "shift_start and shift_end must be set together"}
+	}
+	if assignment.ShiftStart != nil && *assignment.ShiftEnd <= *assignment.ShiftStart {
+		return &FieldError{Field: "shift_end", Message: "shift_end must be after shift_start"}
+	}
+	if utf8.RuneCountInString(assignment.ExternalRef) > maxExternalRefLength {
+		return &FieldError{Field: "external_ref", Message: "external_ref cannot be longer than 100 characters"}
+	}
+	if assignment.ClearanceLabel != "" && !clearanceLabelPattern.MatchString(assignment.ClearanceLabel) {
+		return &FieldError{Field: "clearance_label",
+			Message: "clearance_label must be up to 50 lowercase letters, digits, hyphens or underscores"}
+	}
+	if utf8.RuneCountInString(assignment.Notes) > maxNotesLength {
+		return &FieldError{Field: "notes", Message: "notes cannot be longer than 2000 characters"}
+	}
+	return nil
+}
+
+// checkConflicts rejects the request with 409 when the assignment clashes with
+// an existing active one. It returns false once a response has been written.
+func (h *AssignmentHandler) checkConflicts(c *gin.Context, assignment *Assignment) bool {
+	conflicts, err := h.repo.FindConflicts(assignment)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve assignments"})
-		return
+		respondError(c, http.StatusInternalServerError, "Failed to check assignment conflicts")
+		return false
+	}
+	if len(conflicts) > 0 {
+		// Restricted assignments still conflict, but only their count is shown
+		clearance := callerClearance(c)
+		visible := []Assignment{}
+		for _, conflict := range conflicts {
+			if clearance.Allows(&conflict) {
+				visible = append(visible, conflict)
+			}
+		}
+		body := gin.H{"error": newAPIError(http.StatusConflict, "Assignment conflicts with existing active assignments"), "conflicts": visible}
+		if hidden := len(conflicts) - len(visible); hidden > 0 {
+			body["hidden_conflicts"] = hidden
+		}
+		c.JSON(http.StatusConflict, body)
+		return false
+	}
+	return true
+}
+
+// checkExternalRef rejects the request with 409 when another assignment
+// already uses the external reference, either as its own external_ref or as
+// its generated reference. It returns false once a response has been written.
+func (h *AssignmentHandler) checkExternalRef(c *gin.Context, assignment *Assignment) bool {
+	if assignment.ExternalRef == "" {
+		return true
+	}
+
+	matches, err := h.repo.List(AssignmentFilter{Ref: assignment.ExternalRef})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to check external_ref")
+		return false
+	}
+	for _, match := range matches {
+		if match.ID != assignment.ID {
+			respondError(c, http.StatusConflict, "external_ref is already used by assignment "+match.Reference)
+			return false
+		}
+	}
+	return true
+}
+
+// checkAvailability rejects the request with 409 when the staff member is on
+// leave, sick or resting on a day the assignment is worked, unless the rule is
+// in shadow mode. It returns false once a response has been written.
+func (h *AssignmentHandler) checkAvailability(c *gin.Context, assignment *Assignment) bool {
+	unavailable, err := unavailableFor(h.availability, assignment)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to check staff availability")
+		return false
+	}
+	if len(unavailable) > 0 &&
+		enforceRule(c, apierror.RuleStaffAvailability, unavailableMessage(assignment.StaffID, unavailable)) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":       newRuleViolation(apierror.RuleStaffAvailability, "Staff member is unavailable during the assignment"),
+			"unavailable": unavailable,
+		})
+		return false
+	}
+	return true
+}
+
+// parseAssignmentFilter reads the list filters shared by the list and export
+// endpoints. It returns false once an error response has been written.
+func parseAssignmentFilter(c *gin.Context) (AssignmentFilter, bool) {
+	filter := AssignmentFilter{
+		Status: c.Query("status"),
+		Role:   c.Query("role"),
+		Depot:  c.Query("depot"),
+		Sort:   c.Query("sort"),
+		Ref:    strings.TrimSpace(c.Query("ref")),
+
+		Clearance: callerClearance(c),
+	}
+	var ok bool
+	if filter.IncludeDeleted, ok = includeDeleted(c); !ok {
+		return filter, false
 	}
 
+	if busIDStr := c.Query("bus_id"); busIDStr != "" {
+		busID, err := strconv.Atoi(busIDStr)
+		if err != nil {
+			respondInvalidField(c, "bus_id", "Invalid bus ID")
+			return filter, false
+		}
+		filter.BusID = busID
+	}
+	if staffIDStr := c.Query("staff_id"); staffIDStr != "" {
+		staffID, err := strconv.Atoi(staffIDStr)
+		if err != nil {
+			respondInvalidField(c, "staff_id", "Invalid staff ID")
+			return filter, false
+		}
+		filter.StaffID = staffID
+	}
+
+	if fieldErr := validateAssignmentFilter(filter); fieldErr != nil {
+		respondInvalid(c, *fieldErr)
+		return filter, false
+	}
+	return filter, true
+}
+
+// validateAssignmentFilter checks filter values from any source and returns
+// the field at fault, or nil when the filter is valid.
+func validateAssignmentFilter(filter AssignmentFilter) *FieldError {
+	if filter.Status != "" && filter.Status != "active" && filter.Status != "completed" && filter.Status != "cancelled" {
+		return &FieldError{Field: "status", Message: "Status must be 'active', 'completed' or 'cancelled'"}
+	}
+	if filter.Role != "" && filter.Role != "driver" && filter.Role != "conductor" {
+		return &FieldError{Field: "role", Message: "Role must be 'driver' or 'conductor'"}
+	}
+	if column, _ := filter.sortColumn(); !assignmentSortColumns[column] {
+		return &FieldError{Field: "sort",
+			Message: "sort must be one of created_at, updated_at, start_date, end_date, bus_id, staff_id, optionally prefixed with '-'"}
+	}
+	return nil
+}
+
+// withDetails enriches assignments with bus and staff directory details,
+// unless degraded mode is shedding enrichment
+func withDetails(assignments []Assignment) []AssignmentWithDetails {
+	enrich := !degradedMode.Active()
 	assignmentList := make([]AssignmentWithDetails, 0, len(assignments))
 	for _, assignment := range assignments {
-		details := AssignmentWithDetails{
-			Assignment: assignment,
+		details := newAssignmentDetails(assignment)
+		if !enrich {
+			assignmentList = append(assignmentList, details)
+			continue
 		}
 
 		// Add bus details if available
-		if bus, exists := mockBuses[assignment.BusID]; exists {
+		if bus := lookupBus(assignment.BusID); bus != nil {
 			details.BusPlateNumber = bus["plate_number"]
 			details.BusModel = bus["model"]
 		}
 
 		// Add staff details if available
-		if staff, exists := mockStaff[assignment.StaffID]; exists {
+		if staff := lookupStaff(assignment.StaffID); staff != nil {
 			details.StaffName = staff["name"]
 			details.StaffPosition = staff["position"]
 		}
 
 		assignmentList = append(assignmentList, details)
 	}
-
-	c.JSON(http.StatusOK, gin.H{"assignments": assignmentList, "count": len(assignmentList)})
+	return assignmentList
 }
 
-func handleGetAssignment(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
+func (h *AssignmentHandler) handleGetAssignments(c *gin.Context) {
+	h = h.forRequest(c)
+	filter, ok := parseAssignmentFilter(c)
+	if !ok {
 		return
 	}
-
-	assignment, err := GetAssignmentByID(id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	asOf, ok := parseAsOf(c)
+	if !ok {
 		return
 	}
-	if assignment == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+
+	var assignments []Assignment
+	var err error
+	if asOf.IsZero() {
+		assignments, err = h.repo.List(filter)
+	} else {
+		// As dispatch saw them at the time, from the audit trail
+		assignments, err = listAsOf(h.repo, filter, nil, nil, asOf)
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve assignments")
 		return
 	}
 
-	c.JSON(http.StatusOK, assignment)
+	assignmentList := withDetails(assignments)
+	response := gin.H{"assignments": assignmentList, "count": len(assignmentList)}
+	if !asOf.IsZero() {
+		response["as_of"] = asOf
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-func handleUpdateAssignment(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
-		return
+// assignmentFromParam loads the assignment named by the public ID in the :id
+// path parameter, treating a soft-deleted one as missing unless includeDeleted
+// is set. It returns false once an error response has been written.
+func (h *AssignmentHandler) assignmentFromParam(c *gin.Context, includeDeleted bool) (*Assignment, bool) {
+	publicID, valid := normalizeULID(c.Param("id"))
+	if !valid {
+		respondError(c, http.StatusBadRequest, "Invalid assignment ID")
+		return nil, false
 	}
 
-	// Check if assignment exists
-	existingAssignment, err := GetAssignmentByID(id)
+	assignment, err := h.repo.GetByPublicID(publicID, includeDeleted)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		respondError(c, http.StatusInternalServerError, "Database error")
+		return nil, false
+	}
+	// A restricted assignment is as good as missing to callers without the clearance
+	if assignment == nil || !callerClearance(c).Allows(assignment) {
+		respondError(c, http.StatusNotFound, "Assignment not found")
+		return nil, false
+	}
+	return assignment, true
+}
+
+func (h *AssignmentHandler) handleGetAssignment(c *gin.Context) {
+	h = h.forRequest(c)
+	deleted, ok := includeDeleted(c)
+	if !ok {
 		return
 	}
-	if existingAssignment == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+	assignment, ok := h.assignmentFromParam(c, deleted)
+	if !ok {
 		return
 	}
 
-	var req CreateAssignmentRequest
+	setAssignmentETag(c, assignment)
+	c.JSON(http.StatusOK, assignment)
+}
+
+func (h *AssignmentHandler) handleUpdateAssignment(c *gin.Context) {
+	h = h.forRequest(c)
+	existingAssignment, ok := h.assignmentFromParam(c, false)
+	if !ok {
+		return
+	}
+
+	var req ReplaceAssignmentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, &req, err)
+		return
+	}
+	if !checkExpectedVersion(c, existingAssignment, req.Version) {
 		return
 	}
 
 	// Parse start date
 	startDate, err := time.Parse("2006-01-02", req.StartDate)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format. Use YYYY-MM-DD"})
+		respondInvalidField(c, "start_date", "Invalid start_date format. Use YYYY-MM-DD")
 		return
 	}
 
@@ -187,79 +565,252 @@ func handleUpdateAssignment(c *gin.Context) {
 	if req.EndDate != "" {
 		ed, err := time.Parse("2006-01-02", req.EndDate)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format. Use YYYY-MM-DD"})
+			respondInvalidField(c, "end_date", "Invalid end_date format. Use YYYY-MM-DD")
 			return
 		}
 		endDate = &ed
 	}
 
 	// Update assignment fields
+	previousStart := existingAssignment.StartDate
 	existingAssignment.BusID = req.BusID
 	existingAssignment.StaffID = req.StaffID
 	existingAssignment.Role = req.Role
 	existingAssignment.StartDate = startDate
 	existingAssignment.EndDate = endDate
+	existingAssignment.WorkingDays = req.WorkingDays
+	existingAssignment.ShiftStart = req.ShiftStart
+	existingAssignment.ShiftEnd = req.ShiftEnd
+	existingAssignment.DualRoleAllowed = req.DualRoleAllowed
+	existingAssignment.ExternalRef = strings.TrimSpace(req.ExternalRef)
+	if req.ClearanceLabel != nil {
+		existingAssignment.ClearanceLabel = strings.TrimSpace(*req.ClearanceLabel)
+	}
+	if req.Notes != nil {
+		existingAssignment.Notes = strings.TrimSpace(*req.Notes)
+	}
+
+	if fieldErr := validateAssignment(existingAssignment); fieldErr != nil {
+		respondInvalid(c, *fieldErr)
+		return
+	}
+	if !checkClearance(c, existingAssignment) {
+		return
+	}
+	// Only a moved start is checked, so assignments scheduled with an admin
+	// override stay editable
+	if !startDate.Equal(previousStart) && !checkSchedulingHorizon(c, existingAssignment) {
+		return
+	}
+
+	if !h.checkExternalRef(c, existingAssignment) {
+		return
+	}
+	if existingAssignment.Status == "active" &&
+		(!h.checkConflicts(c, existingAssignment) || !h.checkAvailability(c, existingAssignment) ||
+			!checkQualifications(c, h.qualifications, existingAssignment)) {
+		return
+	}
 
-	if err := UpdateAssignment(existingAssignment); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update assignment"})
+	if err := h.repo.Update(existingAssignment, actorFromContext(c)); err != nil {
+		if errors.Is(err, errStaleVersion) {
+			respondStaleVersion(c, nil)
+			return
+		}
+		if !respondDeletionHold(c, err) {
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Failed to update assignment")
 		return
 	}
 
+	setAssignmentETag(c, existingAssignment)
 	c.JSON(http.StatusOK, existingAssignment)
 }
 
-func handleDeleteAssignment(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignment ID"})
+func (h *AssignmentHandler) handlePatchAssignment(c *gin.Context) {
+	h = h.forRequest(c)
+	existingAssignment, ok := h.assignmentFromParam(c, false)
+	if !ok {
 		return
 	}
 
-	// Check if assignment exists
-	existingAssignment, err := GetAssignmentByID(id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	var req UpdateAssignmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, &req, err)
+		return
+	}
+	if !checkExpectedVersion(c, existingAssignment, req.Version) {
+		return
+	}
+
+	previousStart := existingAssignment.StartDate
+	if fieldErr := req.apply(existingAssignment); fieldErr != nil {
+		respondInvalid(c, *fieldErr)
+		return
+	}
+	if req.Status != nil {
+		if *req.Status != "active" && *req.Status != "completed" && *req.Status != "cancelled" {
+			respondInvalidField(c, "status", "Status must be 'active', 'completed' or 'cancelled'")
+			return
+		}
+		existingAssignment.Status = *req.Status
+	}
+
+	if fieldErr := validateAssignment(existingAssignment); fieldErr != nil {
+		respondInvalid(c, *fieldErr)
 		return
 	}
-	if existingAssignment == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Assignment not found"})
+	if !checkClearance(c, existingAssignment) {
+		return
+	}
+	if !existingAssignment.StartDate.Equal(previousStart) && !checkSchedulingHorizon(c, existingAssignment) {
 		return
 	}
 
-	if err := DeleteAssignment(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete assignment"})
+	if !h.checkExternalRef(c, existingAssignment) {
+		return
+	}
+	if existingAssignment.Status == "active" &&
+		(!h.checkConflicts(c, existingAssignment) || !h.checkAvailability(c, existingAssignment) ||
+			!checkQualifications(c, h.qualifications, existingAssignment)) {
+		return
+	}
+
+	if err := h.repo.Update(existingAssignment, actorFromContext(c)); err != nil {
+		if errors.Is(err, errStaleVersion) {
+			respondStaleVersion(c, nil)
+			return
+		}
+		if !respondDeletionHold(c, err) {
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Failed to update assignment")
+		return
+	}
+
+	setAssignmentETag(c, existingAssignment)
+	c.JSON(http.StatusOK, existingAssignment)
+}
+
+func (h *AssignmentHandler) handleDeleteAssignment(c *gin.Context) {
+	h = h.forRequest(c)
+	existingAssignment, ok := h.assignmentFromParam(c, false)
+	if !ok {
+		return
+	}
+
+	// A DELETE has no body, so the version field is a query parameter
+	version, ok := versionQuery(c)
+	if !ok || !checkExpectedVersion(c, existingAssignment, version) {
+		return
+	}
+
+	if err := h.repo.Delete(existingAssignment.ID, existingAssignment.Version, actorFromContext(c)); err != nil {
+		if errors.Is(err, errStaleVersion) {
+			respondStaleVersion(c, nil)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Failed to delete assignment")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Assignment deleted successfully"})
 }
 
-func handleGetStaffForBus(c *gin.Context) {
+func (h *AssignmentHandler) handleCloneAssignment(c *gin.Context) {
+	h = h.forRequest(c)
+	source, ok := h.assignmentFromParam(c, false)
+	if !ok {
+		return
+	}
+
+	// The body is optional; an empty one clones an inactive assignment as-is
+	var req CloneAssignmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBindError(c, &req, err)
+		return
+	}
+	// An active assignment's copy on the same dates would only conflict with
+	// the assignment itself
+	if source.Status == "active" && req.StartDate == nil {
+		message := "start_date is required to clone an active assignment"
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": newAPIError(http.StatusUnprocessableEntity, message,
+			FieldError{Field: "start_date", Message: message})})
+		return
+	}
+
+	clone := Assignment{
+		BusID:           source.BusID,
+		StaffID:         source.StaffID,
+		Role:            source.Role,
+		StartDate:       source.StartDate,
+		EndDate:         source.EndDate,
+		WorkingDays:     source.WorkingDays,
+		ShiftStart:      source.ShiftStart,
+		ShiftEnd:        source.ShiftEnd,
+		DualRoleAllowed: source.DualRoleAllowed,
+		ClearanceLabel:  source.ClearanceLabel,
+		Notes:           source.Notes,
+		Status:          "active",
+	}
+
+	if fieldErr := req.apply(&clone); fieldErr != nil {
+		respondInvalid(c, *fieldErr)
+		return
+	}
+	if fieldErr := validateAssignment(&clone); fieldErr != nil {
+		respondInvalid(c, *fieldErr)
+		return
+	}
+	if !checkClearance(c, &clone) || !checkSchedulingHorizon(c, &clone) {
+		return
+	}
+
+	if !h.checkExternalRef(c, &clone) || !h.checkConflicts(c, &clone) || !h.checkAvailability(c, &clone) ||
+		!checkQualifications(c, h.qualifications, &clone) {
+		return
+	}
+
+	if err := h.repo.Create(&clone, actorFromContext(c)); err != nil {
+		if !respondDeletionHold(c, err) {
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Failed to clone assignment")
+		return
+	}
+
+	setAssignmentETag(c, &clone)
+	c.JSON(http.StatusCreated, clone)
+}
+
+func (h *AssignmentHandler) handleGetStaffForBus(c *gin.Context) {
+	h = h.forRequest(c)
 	busIDStr := c.Param("busId")
 	busID, err := strconv.Atoi(busIDStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bus ID"})
+		respondError(c, http.StatusBadRequest, "Invalid bus ID")
 		return
 	}
 
-	assignments, err := GetAssignmentsByBusID(busID)
+	assignments, err := h.repo.ListByBus(busID, callerClearance(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve assignments"})
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve assignments")
 		return
 	}
 
+	enrich := !degradedMode.Active()
 	busAssignments := make([]AssignmentWithDetails, 0)
 	for _, assignment := range assignments {
 		if assignment.Status == "active" {
-			details := AssignmentWithDetails{
-				Assignment: assignment,
-			}
+			details := newAssignmentDetails(assignment)
 
 			// Add staff details if available
-			if staff, exists := mockStaff[assignment.StaffID]; exists {
-				details.StaffName = staff["name"]
-				details.StaffPosition = staff["position"]
+			if enrich {
+				if staff := lookupStaff(assignment.StaffID); staff != nil {
+					details.StaffName = staff["name"]
+					details.StaffPosition = staff["position"]
+				}
 			}
 
 			busAssignments = append(busAssignments, details)
@@ -273,30 +824,32 @@ func handleGetStaffForBus(c *gin.Context) {
 	})
 }
 
-func handleGetAssignmentsForStaff(c *gin.Context) {
+func (h *AssignmentHandler) handleGetAssignmentsForStaff(c *gin.Context) {
+	h = h.forRequest(c)
 	staffIDStr := c.Param("staffId")
 	staffID, err := strconv.Atoi(staffIDStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid staff ID"})
+		respondError(c, http.StatusBadRequest, "Invalid staff ID")
 		return
 	}
 
-	assignments, err := GetAssignmentsByStaffID(staffID)
+	assignments, err := h.repo.ListByStaff(staffID, callerClearance(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve assignments"})
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve assignments")
 		return
 	}
 
+	enrich := !degradedMode.Active()
 	staffAssignments := make([]AssignmentWithDetails, 0)
 	for _, assignment := range assignments {
-		details := AssignmentWithDetails{
-			Assignment: assignment,
-		}
+		details := newAssignmentDetails(assignment)
 
 		// Add bus details if available
-		if bus, exists := mockBuses[assignment.BusID]; exists {
-			details.BusPlateNumber = bus["plate_number"]
-			details.BusModel = bus["model"]
+		if enrich {
+			if bus := lookupBus(assignment.BusID); bus != nil {
+				details.BusPlateNumber = bus["plate_number"]
+				details.BusModel = bus["model"]
+			}
 		}
 
 		staffAssignments = append(staffAssignments, details)
@@ -0,0 +1,630 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestRouter serves the API from an in-memory repository with auth disabled
+func newTestRouter(t *testing.T) (*gin.Engine, AssignmentRepository) {
+	t.Helper()
+	store := NewMemoryStorage()
+	repo := store.Assignments
+	router := gin.New()
+	setupRoutes(router, AuthConfig{Disabled: true}, store)
+	return router, repo
+}
+
+func doRequest(router *gin.Engine, method, path string, body any, headers ...string) *httptest.ResponseRecorder {
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var value T
+	if err := json.Unmarshal(rec.Body.Bytes(), &value); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	return value
+}
+
+// bearerToken signs an Authorization header value for the given caller at
+// the north depot
+func bearerToken(t *testing.T, secret []byte, subject, role string) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		Role:             role,
+		DepotID:          "north",
+		RegisteredClaims: jwt.RegisteredClaims{Subject: subject},
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + signed
+}
+
+func mustCreate(t *testing.T, repo AssignmentRepository, assignment Assignment) Assignment {
+	t.Helper()
+	if assignment.Status == "" {
+		assignment.Status = "active"
+	}
+	if err := repo.Create(&assignment, "test"); err != nil {
+		t.Fatalf("creating assignment: %v", err)
+	}
+	return assignment
+}
+
+// unknownAssignmentID is a well-formed public ID that no assignment has
+const unknownAssignmentID = "01ARZ3NDEKTSV4RRFFQ69G5FAV"
+
+func date(value string) time.Time {
+	parsed, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func TestCreateAssignment(t *testing.T) {
+	router, repo := newTestRouter(t)
+
+	rec := doRequest(router, http.MethodPost, "/api/assignments", gin.H{
+		"bus_id":       1,
+		"staff_id":     1,
+		"role":         "driver",
+		"start_date":   "2025-01-06",
+		"working_days": []string{"mon", "wed"},
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+
+	created := decode[Assignment](t, rec)
+	if _, valid := normalizeULID(created.PublicID); !valid || created.Status != "active" {
+		t.Fatalf("unexpected assignment %+v", created)
+	}
+
+	stored, err := repo.GetByPublicID(created.PublicID, false)
+	if err != nil || stored == nil {
+		t.Fatalf("assignment %s not stored: %v", created.PublicID, err)
+	}
+	if got := formatWorkingDays(stored.WorkingDays); got != "mon;wed" {
+		t.Errorf("working days = %q, want mon;wed", got)
+	}
+}
+
+func TestCreateAssignmentValidation(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	tests := []struct {
+		name string
+		body gin.H
+	}{
+		{"missing staff", gin.H{"bus_id": 1, "role": "driver", "start_date": "2025-01-06"}},
+		{"invalid role", gin.H{"bus_id": 1, "staff_id": 1, "role": "pilot", "start_date": "2025-01-06"}},
+		{"invalid start date", gin.H{"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": "06/01/2025"}},
+		{"end before start", gin.H{"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": "2025-01-06", "end_date": "2025-01-01"}},
+		{"unknown working day", gin.H{"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": "2025-01-06", "working_days": []string{"funday"}}},
+		{"shift start without end", gin.H{"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": "2025-01-06", "shift_start": "06:00"}},
+		{"shift end before start", gin.H{"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": "2025-01-06", "shift_start": "14:00", "shift_end": "06:00"}},
+		{"invalid shift time", gin.H{"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": "2025-01-06", "shift_start": "6am", "shift_end": "14:00"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(router, http.MethodPost, "/api/assignments", tt.body)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestCreateAssignmentConflict(t *testing.T) {
+	router, repo := newTestRouter(t)
+	existing := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+
+	tests := []struct {
+		name     string
+		body     gin.H
+		wantCode int
+	}{
+		{"same bus and role", gin.H{"bus_id": 1, "staff_id": 3, "role": "driver", "start_date": "2025-02-01"}, http.StatusConflict},
+		{"same staff on another bus", gin.H{"bus_id": 2, "staff_id": 1, "role": "driver", "start_date": "2025-02-01"}, http.StatusConflict},
+		{"other role on same bus", gin.H{"bus_id": 1, "staff_id": 2, "role": "conductor", "start_date": "2025-02-01"}, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(router, http.MethodPost, "/api/assignments", tt.body)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			if tt.wantCode == http.StatusConflict {
+				body := decode[struct{ Conflicts []Assignment }](t, rec)
+				if len(body.Conflicts) != 1 || body.Conflicts[0].PublicID != existing.PublicID {
+					t.Errorf("conflicts = %+v, want assignment %s", body.Conflicts, existing.PublicID)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateAssignmentOnDisjointWorkingDays(t *testing.T) {
+	router, repo := newTestRouter(t)
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01"),
+		WorkingDays: DayMask(1<<time.Monday | 1<<time.Wednesday)})
+
+	rec := doRequest(router, http.MethodPost, "/api/assignments", gin.H{
+		"bus_id": 1, "staff_id": 3, "role": "driver", "start_date": "2025-01-01", "working_days": []string{"tue", "thu"},
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+}
+
+func TestCreateAssignmentShiftTimes(t *testing.T) {
+	router, repo := newTestRouter(t)
+	morningStart, morningEnd := TimeOfDay(6*60), TimeOfDay(14*60)
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01"),
+		ShiftStart: &morningStart, ShiftEnd: &morningEnd})
+
+	tests := []struct {
+		name     string
+		body     gin.H
+		wantCode int
+	}{
+		{"overlapping shift", gin.H{"bus_id": 1, "staff_id": 3, "role": "driver", "start_date": "2025-01-01", "shift_start": "13:00", "shift_end": "21:00"}, http.StatusConflict},
+		{"whole day", gin.H{"bus_id": 1, "staff_id": 3, "role": "driver", "start_date": "2025-01-01"}, http.StatusConflict},
+		{"evening shift", gin.H{"bus_id": 1, "staff_id": 3, "role": "driver", "start_date": "2025-01-01", "shift_start": "14:00", "shift_end": "22:00"}, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(router, http.MethodPost, "/api/assignments", tt.body)
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			if tt.wantCode == http.StatusCreated {
+				if created := decode[Assignment](t, rec); created.ShiftStart == nil || created.ShiftStart.String() != "14:00" {
+					t.Errorf("shift start = %v, want 14:00", created.ShiftStart)
+				}
+			}
+		})
+	}
+}
+
+func TestGetAssignment(t *testing.T) {
+	router, repo := newTestRouter(t)
+	existing := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+
+	// IDs are case-insensitive
+	rec := doRequest(router, http.MethodGet, "/api/assignments/"+strings.ToLower(existing.PublicID), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := decode[Assignment](t, rec); got.PublicID != existing.PublicID {
+		t.Errorf("id = %s, want %s", got.PublicID, existing.PublicID)
+	}
+
+	if rec := doRequest(router, http.MethodGet, "/api/assignments/"+unknownAssignmentID, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("missing assignment status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	// Serial IDs are internal
+	if rec := doRequest(router, http.MethodGet, fmt.Sprintf("/api/assignments/%d", existing.ID), nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid id status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestAssignmentReferences(t *testing.T) {
+	router, repo := newTestRouter(t)
+
+	rec := doRequest(router, http.MethodPost, "/api/assignments", gin.H{
+		"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": "2025-01-06", "external_ref": "LEG-42",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	created := decode[Assignment](t, rec)
+	stored, _ := repo.GetByPublicID(created.PublicID, false)
+	if want := fmt.Sprintf("ASG-%d-%06d", created.CreatedAt.UTC().Year(), stored.ID); created.Reference != want {
+		t.Errorf("reference = %q, want %q", created.Reference, want)
+	}
+
+	for _, ref := range []string{strings.ToLower(created.Reference), "LEG-42"} {
+		rec := doRequest(router, http.MethodGet, "/api/assignments?ref="+ref, nil)
+		body := decode[struct{ Assignments []Assignment }](t, rec)
+		if len(body.Assignments) != 1 || body.Assignments[0].PublicID != created.PublicID {
+			t.Errorf("ref %q found %+v, want assignment %s", ref, body.Assignments, created.PublicID)
+		}
+	}
+
+	for _, ref := range []string{"LEG-42", created.Reference} {
+		rec := doRequest(router, http.MethodPost, "/api/assignments", gin.H{
+			"bus_id": 2, "staff_id": 2, "role": "conductor", "start_date": "2025-01-06", "external_ref": ref,
+		})
+		if rec.Code != http.StatusConflict {
+			t.Errorf("duplicate external_ref %q status = %d, want %d", ref, rec.Code, http.StatusConflict)
+		}
+	}
+
+	// Updating keeps the generated reference and may keep its own external_ref
+	rec = doRequest(router, http.MethodPut, "/api/assignments/"+created.PublicID, gin.H{
+		"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": "2025-01-13", "external_ref": "LEG-42",
+		"version": created.Version,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if updated := decode[Assignment](t, rec); updated.Reference != created.Reference {
+		t.Errorf("reference changed to %q", updated.Reference)
+	}
+}
+
+func TestGetAssignmentsFilters(t *testing.T) {
+	router, repo := newTestRouter(t)
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 2, Role: "conductor", StartDate: date("2025-01-01")})
+	mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2024-01-01"), Status: "completed"})
+
+	tests := []struct {
+		query     string
+		wantCount int
+	}{
+		{"", 3},
+		{"?status=active", 2},
+		{"?role=driver", 2},
+		{"?bus_id=1&role=conductor", 1},
+		{"?staff_id=3&status=active", 0},
+	}
+
+	for _, tt := range tests {
+		rec := doRequest(router, http.MethodGet, "/api/assignments"+tt.query, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%q: status = %d, want %d", tt.query, rec.Code, http.StatusOK)
+		}
+		if body := decode[struct{ Count int }](t, rec); body.Count != tt.wantCount {
+			t.Errorf("%q: count = %d, want %d", tt.query, body.Count, tt.wantCount)
+		}
+	}
+
+	if rec := doRequest(router, http.MethodGet, "/api/assignments?status=paused", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid status filter = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestUpdateAssignment(t *testing.T) {
+	router, repo := newTestRouter(t)
+	existing := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+
+	rec := doRequest(router, http.MethodPut, "/api/assignments/"+existing.PublicID, gin.H{
+		"bus_id": 2, "staff_id": 1, "role": "driver", "start_date": "2025-01-01", "end_date": "2025-06-30", "version": 1,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	stored, _ := repo.Get(existing.ID)
+	if stored.BusID != 2 || stored.EndDate == nil {
+		t.Errorf("assignment not updated: %+v", stored)
+	}
+
+	rec = doRequest(router, http.MethodGet, "/api/assignments/"+existing.PublicID+"/history", nil)
+	history := decode[struct{ History []AuditEntry }](t, rec)
+	if len(history.History) != 2 || history.History[1].Action != AuditActionUpdate {
+		t.Errorf("history = %+v, want create then update", history.History)
+	}
+}
+
+func TestUpdateAssignmentConflict(t *testing.T) {
+	router, repo := newTestRouter(t)
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+	other := mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-01-01")})
+
+	rec := doRequest(router, http.MethodPut, "/api/assignments/"+other.PublicID, gin.H{
+		"bus_id": 1, "staff_id": 3, "role": "driver", "start_date": "2025-01-01", "version": 1,
+	})
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body.String())
+	}
+
+	if rec := doRequest(router, http.MethodPut, "/api/assignments/"+unknownAssignmentID, gin.H{
+		"bus_id": 1, "staff_id": 3, "role": "driver", "start_date": "2025-01-01",
+	}); rec.Code != http.StatusNotFound {
+		t.Errorf("missing assignment status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestPatchAssignment(t *testing.T) {
+	router, repo := newTestRouter(t)
+	existing := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+	mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-01-01")})
+	path := "/api/assignments/" + existing.PublicID
+
+	rec := doRequest(router, http.MethodPatch, path, gin.H{"end_date": "2025-06-30"}, "If-Match", `"1"`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	stored, _ := repo.Get(existing.ID)
+	if stored.EndDate == nil || !stored.EndDate.Equal(date("2025-06-30")) {
+		t.Errorf("end_date = %v, want 2025-06-30", stored.EndDate)
+	}
+	if stored.BusID != 1 || stored.StaffID != 1 || stored.Role != "driver" || !stored.StartDate.Equal(existing.StartDate) {
+		t.Errorf("omitted fields changed: %+v", stored)
+	}
+
+	if rec := doRequest(router, http.MethodPatch, path, gin.H{"status": "completed", "version": 2}); rec.Code != http.StatusOK {
+		t.Fatalf("status patch = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if stored, _ := repo.Get(existing.ID); stored.Status != "completed" || stored.EndDate == nil {
+		t.Errorf("after status patch: %+v", stored)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		body     gin.H
+		wantCode int
+	}{
+		{"unknown status", path, gin.H{"status": "paused"}, http.StatusBadRequest},
+		{"end before start", path, gin.H{"end_date": "2024-12-31"}, http.StatusBadRequest},
+		{"bad date", path, gin.H{"start_date": "01/01/2025"}, http.StatusBadRequest},
+		{"conflict", path, gin.H{"status": "active", "staff_id": 3}, http.StatusConflict},
+		{"missing assignment", "/api/assignments/" + unknownAssignmentID, gin.H{"role": "conductor"}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(router, http.MethodPatch, tt.path, tt.body, "If-Match", "*")
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDeleteAssignment(t *testing.T) {
+	router, repo := newTestRouter(t)
+	existing := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+
+	path := "/api/assignments/" + existing.PublicID
+
+	if rec := doRequest(router, http.MethodDelete, path+"?version=1", nil); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := doRequest(router, http.MethodGet, path, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("deleted assignment status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := doRequest(router, http.MethodDelete, path, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("second delete status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	// The audit trail outlives the assignment
+	rec := doRequest(router, http.MethodGet, path+"/history", nil)
+	history := decode[struct{ History []AuditEntry }](t, rec)
+	if len(history.History) != 2 || history.History[1].Action != AuditActionDelete {
+		t.Errorf("history = %+v, want create then delete", history.History)
+	}
+}
+
+func TestCloneAssignment(t *testing.T) {
+	router, repo := newTestRouter(t)
+	source := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01"), Status: "completed"})
+
+	rec := doRequest(router, http.MethodPost, "/api/assignments/"+source.PublicID+"/clone", gin.H{"start_date": "2025-03-01"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+
+	clone := decode[Assignment](t, rec)
+	if clone.PublicID == source.PublicID || clone.BusID != 1 || clone.Status != "active" || !clone.StartDate.Equal(date("2025-03-01")) {
+		t.Errorf("unexpected clone %+v", clone)
+	}
+
+	// Cloning the now-active slot again clashes with the first clone
+	if rec := doRequest(router, http.MethodPost, "/api/assignments/"+source.PublicID+"/clone", nil); rec.Code != http.StatusConflict {
+		t.Errorf("second clone status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestCloneAssignmentEmptyBody(t *testing.T) {
+	router, repo := newTestRouter(t)
+	activeEnd, completedEnd := date("2025-01-31"), date("2024-06-30")
+	active := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01"),
+		EndDate: &activeEnd, Status: "active"})
+	completed := mustCreate(t, repo, Assignment{BusID: 2, StaffID: 2, Role: "driver", StartDate: date("2024-06-01"),
+		EndDate: &completedEnd, Status: "completed"})
+
+	// A copy of an active assignment on its own dates would only clash with it
+	rec := doRequest(router, http.MethodPost, "/api/assignments/"+active.PublicID+"/clone", nil)
+	if rec.Code != http.StatusUnprocessableEntity || len(errorOf(t, rec).Fields) != 1 ||
+		errorOf(t, rec).Fields[0].Field != "start_date" {
+		t.Errorf("empty clone of an active assignment = %d %s, want 422 on start_date", rec.Code, rec.Body.String())
+	}
+	rec = doRequest(router, http.MethodPost, "/api/assignments/"+active.PublicID+"/clone",
+		gin.H{"start_date": "2025-02-01", "end_date": "2025-02-28"})
+	if rec.Code != http.StatusCreated {
+		t.Errorf("clone of an active assignment with new dates = %d %s, want 201", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(router, http.MethodPost, "/api/assignments/"+completed.PublicID+"/clone", nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("empty clone of a completed assignment = %d %s, want 201", rec.Code, rec.Body.String())
+	}
+	if clone := decode[Assignment](t, rec); clone.BusID != 2 || clone.StaffID != 2 || clone.Status != "active" ||
+		!clone.StartDate.Equal(completed.StartDate) || clone.EndDate == nil || !clone.EndDate.Equal(*completed.EndDate) {
+		t.Errorf("clone = %+v, want the completed assignment as-is, active", clone)
+	}
+}
+
+func TestGetStaffForBus(t *testing.T) {
+	router, repo := newTestRouter(t)
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 2, Role: "conductor", StartDate: date("2024-01-01"), Status: "cancelled"})
+
+	rec := doRequest(router, http.MethodGet, "/api/assignments/bus/1", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	body := decode[struct {
+		Assignments []AssignmentWithDetails
+		Count       int
+	}](t, rec)
+	if body.Count != 1 || body.Assignments[0].StaffName != "John Driver" {
+		t.Errorf("unexpected bus assignments %+v", body)
+	}
+}
+
+func TestGetAssignmentsForStaff(t *testing.T) {
+	router, repo := newTestRouter(t)
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+	mustCreate(t, repo, Assignment{BusID: 3, StaffID: 1, Role: "driver", StartDate: date("2024-01-01"), Status: "completed"})
+
+	rec := doRequest(router, http.MethodGet, "/api/assignments/staff/1", nil)
+	body := decode[struct {
+		Assignments []AssignmentWithDetails
+		Count       int
+	}](t, rec)
+	if body.Count != 2 || body.Assignments[0].BusPlateNumber == "" {
+		t.Errorf("unexpected staff assignments %+v", body)
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	secret := []byte("test-secret")
+	router := gin.New()
+	setupRoutes(router, AuthConfig{Secret: secret}, NewMemoryStorage())
+
+	token := func(role string) string { return bearerToken(t, secret, "user-"+role, role) }
+	body := gin.H{"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": "2025-01-06"}
+
+	tests := []struct {
+		name     string
+		method   string
+		auth     string
+		wantCode int
+	}{
+		{"no token", http.MethodGet, "", http.StatusUnauthorized},
+		{"bad token", http.MethodGet, "Bearer not-a-jwt", http.StatusUnauthorized},
+		{"viewer reads", http.MethodGet, token(RoleViewer), http.StatusOK},
+		{"viewer writes", http.MethodPost, token(RoleViewer), http.StatusForbidden},
+		{"dispatcher writes", http.MethodPost, token(RoleDispatcher), http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rec *httptest.ResponseRecorder
+			if tt.method == http.MethodPost {
+				rec = doRequest(router, tt.method, "/api/assignments", body, "Authorization", tt.auth)
+			} else {
+				rec = doRequest(router, tt.method, "/api/assignments", nil, "Authorization", tt.auth)
+			}
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestReportingRoleIsLimitedToReports(t *testing.T) {
+	secret := []byte("test-secret")
+	router := gin.New()
+	setupRoutes(router, AuthConfig{Secret: secret}, NewMemoryStorage())
+	reporting := bearerToken(t, secret, "bi-tool", RoleReporting)
+
+	tests := []struct {
+		method   string
+		path     string
+		wantCode int
+	}{
+		{http.MethodGet, "/api/assignments/export?format=csv", http.StatusOK},
+		{http.MethodGet, "/api/roster/publications?from=2025-03-03&to=2025-03-09", http.StatusOK},
+		{http.MethodGet, "/api/assignments", http.StatusForbidden},
+		{http.MethodGet, "/api/assignments/staff/1", http.StatusForbidden},
+		{http.MethodGet, "/api/activity", http.StatusForbidden},
+		{http.MethodGet, "/api/views", http.StatusForbidden},
+		{http.MethodPost, "/api/assignments", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		rec := doRequest(router, tt.method, tt.path, nil, "Authorization", reporting)
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s %s status = %d, want %d: %s", tt.method, tt.path, rec.Code, tt.wantCode, rec.Body.String())
+		}
+	}
+
+	// Export jobs are the one write a reporting token may make, and its jobs
+	// stay its own
+	rec := doRequest(router, http.MethodPost, "/api/exports", gin.H{"format": "csv",
+		"callback_url": "https://bi.example.com/hooks/exports"}, "Authorization", reporting)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("reporting export job status = %d, want %d: %s", rec.Code, http.StatusAccepted, rec.Body.String())
+	}
+	job := decode[ExportJob](t, rec)
+	if job.RequestedBy != "bi-tool" || job.CallbackURL != "https://bi.example.com/hooks/exports" {
+		t.Errorf("export job = %+v, want it requested by the BI tool with its callback", job)
+	}
+	if rec := doRequest(router, http.MethodPost, "/api/exports", gin.H{"format": "csv",
+		"callback_url": "http://169.254.169.254/latest"}, "Authorization", reporting); rec.Code != http.StatusBadRequest {
+		t.Errorf("reporting export job with an internal callback = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	other := bearerToken(t, secret, "another-bi-tool", RoleReporting)
+	if rec := doRequest(router, http.MethodGet, "/api/exports/"+job.ID, nil, "Authorization", other); rec.Code !=
+		http.StatusNotFound {
+		t.Errorf("another reporting token reading the job = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	// Viewers keep the reports they could always read
+	viewer := bearerToken(t, secret, "viewer-1", RoleViewer)
+	if rec := doRequest(router, http.MethodGet, "/api/assignments/export", nil, "Authorization", viewer); rec.Code != http.StatusOK {
+		t.Errorf("viewer export status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestExportAssignmentsSnapshot(t *testing.T) {
+	router, repo := newTestRouter(t)
+
+	rec := doRequest(router, http.MethodGet, "/api/assignments/export", nil)
+	if _, err := time.Parse(time.RFC3339Nano, rec.Header().Get(snapshotHeader)); rec.Code != http.StatusOK || err != nil {
+		t.Fatalf("empty export status = %d, snapshot %q", rec.Code, rec.Header().Get(snapshotHeader))
+	}
+	if body := strings.TrimSpace(rec.Body.String()); body != strings.Join(csvExportHeader, ",") {
+		t.Errorf("empty export = %q, want just the header", body)
+	}
+
+	before := time.Now()
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03")})
+	rec = doRequest(router, http.MethodGet, "/api/assignments/export", nil)
+	asOf, _ := time.Parse(time.RFC3339Nano, rec.Header().Get(snapshotHeader))
+	if asOf.Before(before) {
+		t.Errorf("snapshot at %v, before the assignment was created", asOf)
+	}
+	if lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n"); len(lines) != 2 {
+		t.Errorf("export = %q, want one row", rec.Body.String())
+	}
+}
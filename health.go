@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DependencyCheck reports whether one dependency the service needs is reachable.
+// Only critical dependencies decide readiness; the others put the service in
+// degraded mode instead.
+type DependencyCheck struct {
+	Name     string
+	Check    func(ctx context.Context) error
+	Critical bool
+}
+
+// DependencyStatus is the outcome of one dependency check
+type DependencyStatus struct {
+	Status    string `json:"status"` // up or down
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// readinessChecks are run by /readyz; main replaces them with the real
+// dependencies once the database pool is open
+var readinessChecks []DependencyCheck
+
+// readinessTimeout bounds each readiness check, so a hung dependency fails
+// the probe instead of outlasting it
+var readinessTimeout = 2 * time.Second
+
+// LoadReadinessChecks checks the database, which is critical, and when
+// configured the bus management and staff services through their /health
+// endpoints. READINESS_TIMEOUT (default 2s) bounds each check.
+func LoadReadinessChecks() []DependencyCheck {
+	readinessTimeout = durationFromEnv("READINESS_TIMEOUT", 2*time.Second)
+
+	checks := []DependencyCheck{{Name: "database", Check: db.Ping, Critical: true}}
+	upstreams := []struct{ name, env string }{
+		{"bus_service", "BUS_MANAGEMENT_SERVICE_URL"},
+		{"staff_service", "STAFF_SERVICE_URL"},
+	}
+	for _, upstream := range upstreams {
+		if url := strings.TrimSuffix(os.Getenv(upstream.env), "/"); url != "" {
+			checks = append(checks, DependencyCheck{Name: upstream.name, Check: upstreamHealthCheck(url + "/health")})
+		}
+	}
+	return checks
+}
+
+// upstreamHealthCheck treats any 2xx response from the URL as healthy
+func upstreamHealthCheck(url string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("GET %s returned %s", url, resp.Status)
+		}
+		return nil
+	}
+}
+
+// checkDependencies runs every check concurrently, each with its own timeout,
+// reporting ready unless a critical dependency is down
+func checkDependencies(ctx context.Context, checks []DependencyCheck) (map[string]DependencyStatus, bool) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	statuses := make(map[string]DependencyStatus, len(checks))
+	ready := true
+
+	for _, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, readinessTimeout)
+			defer cancel()
+
+			started := time.Now()
+			err := check.Check(checkCtx)
+			status := DependencyStatus{Status: "up", LatencyMS: time.Since(started).Milliseconds()}
+			if err != nil {
+				status.Status = "down"
+				status.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			statuses[check.Name] = status
+			if err != nil && check.Critical {
+				ready = false
+			}
+		}()
+	}
+	wg.Wait()
+	return statuses, ready
+}
+
+// handleLiveness reports that the process is serving requests. It checks no
+// dependencies, so an outage elsewhere doesn't get every replica restarted.
+func handleLiveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive"})
+}
+
+// handleReadiness reports whether every critical dependency is reachable and
+// no background worker has stalled, answering 503 otherwise so the instance
+// is taken out of load balancing and the stuck worker shows up in
+// orchestration. It also fails while the instance warms up or drains. Workers
+// whose runs fail are reported without affecting readiness, since they retry
+// on their own, and so are maintenance and degraded mode, since core requests
+// are still served.
+func handleReadiness(c *gin.Context) {
+	// Warming up or draining instances take no traffic, whatever their
+	// dependencies say
+	if state := lifecycle.State(); state != LifecycleServing {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": state})
+		return
+	}
+
+	checks, ready := checkDependencies(c.Request.Context(), readinessChecks)
+	workers, stalled := backgroundWorkers.Statuses(c.Request.Context())
+	status, code := "ready", http.StatusOK
+	if !ready || stalled {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{
+		"status":      status,
+		"checks":      checks,
+		"workers":     workers,
+		"maintenance": maintenanceMode.Status().Enabled,
+		"degraded":    degradedMode.Status(),
+	})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadiness(t *testing.T) {
+	previousChecks, previousTimeout := readinessChecks, readinessTimeout
+	t.Cleanup(func() { readinessChecks, readinessTimeout = previousChecks, previousTimeout })
+	readinessTimeout = 50 * time.Millisecond
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer upstream.Close()
+
+	router, _ := newTestRouter(t)
+	readinessChecks = []DependencyCheck{
+		{Name: "database", Check: func(context.Context) error { return nil }, Critical: true},
+		{Name: "bus_service", Check: upstreamHealthCheck(upstream.URL + "/health")},
+	}
+
+	type readiness struct {
+		Status string                      `json:"status"`
+		Checks map[string]DependencyStatus `json:"checks"`
+	}
+	rec := doRequest(router, http.MethodGet, "/readyz", nil)
+	if got := decode[readiness](t, rec); rec.Code != http.StatusOK || got.Status != "ready" || len(got.Checks) != 2 {
+		t.Fatalf("readyz = %d %s, want 200 with both checks up", rec.Code, rec.Body.String())
+	}
+
+	// An upstream outage degrades the service but leaves it ready
+	readinessChecks = []DependencyCheck{
+		{Name: "database", Check: func(context.Context) error { return nil }, Critical: true},
+		{Name: "bus_service", Check: upstreamHealthCheck(upstream.URL + "/missing")},
+	}
+	rec = doRequest(router, http.MethodGet, "/readyz", nil)
+	if got := decode[readiness](t, rec); rec.Code != http.StatusOK || got.Checks["bus_service"].Status != "down" {
+		t.Fatalf("readyz with an upstream down = %d %s, want 200 reporting it down", rec.Code, rec.Body.String())
+	}
+
+	// A dead pool and a hung upstream both fail within the timeout
+	readinessChecks = []DependencyCheck{
+		{Name: "database", Check: func(context.Context) error { return errors.New("closed pool") }, Critical: true},
+		{Name: "staff_service", Check: func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() }},
+		{Name: "bus_service", Check: upstreamHealthCheck(upstream.URL + "/missing")},
+	}
+	started := time.Now()
+	rec = doRequest(router, http.MethodGet, "/readyz", nil)
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("readyz took %s, want the checks bounded by the timeout", elapsed)
+	}
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz status = %d, want 503", rec.Code)
+	}
+	got := decode[readiness](t, rec)
+	for _, name := range []string{"database", "staff_service", "bus_service"} {
+		if got.Checks[name].Status != "down" || got.Checks[name].Error == "" {
+			t.Errorf("%s check = %+v, want down with an error", name, got.Checks[name])
+		}
+	}
+
+	// Liveness doesn't depend on any of them
+	if rec := doRequest(router, http.MethodGet, "/healthz", nil); rec.Code != http.StatusOK {
+		t.Errorf("healthz status = %d, want 200", rec.Code)
+	}
+}
+
+func TestReadinessReportsWorkers(t *testing.T) {
+	previousChecks, previousWorkers := readinessChecks, backgroundWorkers
+	t.Cleanup(func() { readinessChecks, backgroundWorkers = previousChecks, previousWorkers })
+	readinessChecks = nil
+	backgroundWorkers = &WorkerRegistry{monitors: map[string]*WorkerMonitor{}}
+
+	router, _ := newTestRouter(t)
+	type readiness struct {
+		Status  string                  `json:"status"`
+		Workers map[string]WorkerStatus `json:"workers"`
+	}
+
+	relay := backgroundWorkers.Register("outbox_relay", time.Hour, func(context.Context) (int, error) { return 4, nil })
+	awarder := backgroundWorkers.Register("shift_awarder", 20*time.Millisecond, nil)
+	relay.Record(nil)
+	awarder.Record(nil)
+	rec := doRequest(router, http.MethodGet, "/readyz", nil)
+	got := decode[readiness](t, rec)
+	if rec.Code != http.StatusOK || got.Workers["outbox_relay"].Status != WorkerOK ||
+		got.Workers["outbox_relay"].QueueDepth == nil || *got.Workers["outbox_relay"].QueueDepth != 4 {
+		t.Fatalf("readyz = %d %s, want 200 with the relay's queue depth", rec.Code, rec.Body.String())
+	}
+
+	// A failing run is reported but retried, so the instance stays ready
+	relay.Record(errors.New("broker unavailable"))
+	rec = doRequest(router, http.MethodGet, "/readyz", nil)
+	if got := decode[readiness](t, rec).Workers["outbox_relay"]; rec.Code != http.StatusOK ||
+		got.Status != WorkerFailing || got.LastError != "broker unavailable" || got.LastSuccessAt == nil {
+		t.Errorf("readyz with a failing relay = %d %s, want 200 reporting it failing", rec.Code, rec.Body.String())
+	}
+
+	// A worker that stops finishing runs takes the instance out of rotation
+	time.Sleep(30 * time.Millisecond)
+	rec = doRequest(router, http.MethodGet, "/readyz", nil)
+	if got := decode[readiness](t, rec); rec.Code != http.StatusServiceUnavailable ||
+		got.Workers["shift_awarder"].Status != WorkerStalled {
+		t.Errorf("readyz with a stalled awarder = %d %s, want 503 reporting it stalled", rec.Code, rec.Body.String())
+	}
+}
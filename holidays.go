@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Pay classifications applied to assignments
+const (
+	PayClassStandard = "standard"
+	PayClassHoliday  = "holiday"
+)
+
+// HolidayCalendar holds the configured public holidays keyed by YYYY-MM-DD
+type HolidayCalendar map[string]string
+
+var publicHolidays = HolidayCalendar{}
+
+// LoadHolidayCalendar parses PUBLIC_HOLIDAYS, a comma-separated list of
+// YYYY-MM-DD dates each optionally followed by ":Name". Invalid entries are
+// logged and skipped so a typo doesn't stop the service from starting.
+func LoadHolidayCalendar() HolidayCalendar {
+	calendar := HolidayCalendar{}
+	for _, entry := range strings.Split(os.Getenv("PUBLIC_HOLIDAYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		date, name, _ := strings.Cut(entry, ":")
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			log.Printf("Ignoring invalid PUBLIC_HOLIDAYS entry %q", entry)
+			continue
+		}
+		calendar[date] = strings.TrimSpace(name)
+	}
+
+	if len(calendar) > 0 {
+		log.Printf("Loaded %d public holidays", len(calendar))
+	}
+	return calendar
+}
+
+// HolidaysWorked returns the public holidays, in date order, on which the
+// assignment is actually worked given its date range and working days
+func (h HolidayCalendar) HolidaysWorked(assignment *Assignment) []string {
+	var dates []string
+	for date := range h {
+		day, _ := time.Parse("2006-01-02", date)
+		if assignment.WorksOn(day) {
+			dates = append(dates, date)
+		}
+	}
+	sort.Strings(dates)
+	return dates
+}
+
+// PayClass classifies an assignment as holiday rate when it includes at
+// least one worked public holiday, along with the dates concerned
+func (h HolidayCalendar) PayClass(assignment *Assignment) (string, []string) {
+	dates := h.HolidaysWorked(assignment)
+	if len(dates) > 0 {
+		return PayClassHoliday, dates
+	}
+	return PayClassStandard, nil
+}
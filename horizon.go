@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"bus-staff-assignment/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+// SchedulingHorizon limits how far ahead an assignment may start, so typos
+// like a 2035 start date don't end up in reports and reminders
+type SchedulingHorizon struct {
+	Months int // 0 disables the limit
+}
+
+var schedulingHorizon = SchedulingHorizon{Months: 6}
+
+// LoadSchedulingHorizon reads SCHEDULING_HORIZON_MONTHS (default 6, 0 disables)
+func LoadSchedulingHorizon() SchedulingHorizon {
+	horizon := SchedulingHorizon{Months: 6}
+	if value := os.Getenv("SCHEDULING_HORIZON_MONTHS"); value != "" {
+		if months, err := strconv.Atoi(value); err == nil && months >= 0 {
+			horizon.Months = months
+		} else {
+			log.Printf("Invalid SCHEDULING_HORIZON_MONTHS %q, using %d", value, horizon.Months)
+		}
+	}
+	return horizon
+}
+
+// LatestStart returns the last start date allowed when scheduling on the given day
+func (h SchedulingHorizon) LatestStart(now time.Time) time.Time {
+	return truncateDate(now).AddDate(0, h.Months, 0)
+}
+
+// Allows reports whether an assignment starting on the given date is within the horizon
+func (h SchedulingHorizon) Allows(startDate, now time.Time) bool {
+	return h.Months == 0 || !truncateDate(startDate).After(h.LatestStart(now))
+}
+
+// horizonOverride reports whether the caller passed override_horizon=true.
+// Only admins may override; it returns ok=false once a 403 has been written.
+func horizonOverride(c *gin.Context) (override, ok bool) {
+	if c.Query("override_horizon") != "true" {
+		return false, true
+	}
+	if principal := currentPrincipal(c); principal == nil || principal.Role != RoleAdmin {
+		respondError(c, http.StatusForbidden, "Only admins can override the scheduling horizon")
+		return false, false
+	}
+	return true, true
+}
+
+// checkSchedulingHorizon rejects the request with 400 when the assignment
+// starts beyond the horizon and no admin override was given, unless the rule
+// is in shadow mode. It returns false once a response has been written.
+func checkSchedulingHorizon(c *gin.Context, assignment *Assignment) bool {
+	now := clock.Now()
+	if schedulingHorizon.Allows(assignment.StartDate, now) {
+		return true
+	}
+
+	override, ok := horizonOverride(c)
+	if !ok {
+		return false
+	}
+	if message := schedulingHorizon.message(); !override && enforceRule(c, apierror.RuleSchedulingHorizon, message) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             newRuleViolation(apierror.RuleSchedulingHorizon, message, FieldError{Field: "start_date", Message: message}),
+			"latest_start_date": schedulingHorizon.LatestStart(now).Format("2006-01-02"),
+		})
+		return false
+	}
+	return true
+}
+
+func (h SchedulingHorizon) message() string {
+	return fmt.Sprintf("start_date is more than %d months ahead; admins can pass override_horizon=true", h.Months)
+}
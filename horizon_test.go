@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCreateAssignmentBeyondHorizon(t *testing.T) {
+	router, _ := newTestRouter(t)
+	farAhead := time.Now().AddDate(1, 0, 0).Format("2006-01-02")
+	body := gin.H{"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": farAhead}
+
+	rec := doRequest(router, http.MethodPost, "/api/assignments", body)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+	}
+	if got := decode[struct {
+		LatestStartDate string `json:"latest_start_date"`
+	}](t, rec); got.LatestStartDate == "" {
+		t.Error("response is missing latest_start_date")
+	}
+
+	// Auth is disabled in the test router, so the caller is an admin
+	if rec := doRequest(router, http.MethodPost, "/api/assignments?override_horizon=true", body); rec.Code != http.StatusCreated {
+		t.Fatalf("override status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+}
+
+func TestHorizonOverrideRequiresAdmin(t *testing.T) {
+	secret := []byte("test-secret")
+	router := gin.New()
+	setupRoutes(router, AuthConfig{Secret: secret}, NewMemoryStorage())
+
+	farAhead := time.Now().AddDate(1, 0, 0).Format("2006-01-02")
+	body := gin.H{"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": farAhead}
+
+	tests := []struct {
+		role     string
+		wantCode int
+	}{
+		{RoleDispatcher, http.StatusForbidden},
+		{RoleAdmin, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		token := bearerToken(t, secret, "user-"+tt.role, tt.role)
+		rec := doRequest(router, http.MethodPost, "/api/assignments?override_horizon=true", body, "Authorization", token)
+		if rec.Code != tt.wantCode {
+			t.Errorf("%s: status = %d, want %d: %s", tt.role, rec.Code, tt.wantCode, rec.Body.String())
+		}
+	}
+}
+
+func TestUpdateAssignmentBeyondHorizon(t *testing.T) {
+	router, repo := newTestRouter(t)
+	farAhead := time.Now().AddDate(1, 0, 0)
+	existing := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: truncateDate(farAhead)})
+	path := "/api/assignments/" + existing.PublicID
+
+	// Keeping an overridden start date is allowed
+	body := gin.H{"bus_id": 2, "staff_id": 1, "role": "driver", "start_date": farAhead.Format("2006-01-02"), "version": 1}
+	if rec := doRequest(router, http.MethodPut, path, body); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	body["start_date"] = farAhead.AddDate(0, 1, 0).Format("2006-01-02")
+	body["version"] = 2
+	if rec := doRequest(router, http.MethodPut, path, body); rec.Code != http.StatusBadRequest {
+		t.Errorf("moved start status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+	}
+}
+
+func TestSchedulingHorizonAllows(t *testing.T) {
+	now := date("2025-01-15")
+
+	tests := []struct {
+		horizon SchedulingHorizon
+		start   string
+		want    bool
+	}{
+		{SchedulingHorizon{Months: 6}, "2025-07-15", true},
+		{SchedulingHorizon{Months: 6}, "2025-07-16", false},
+		{SchedulingHorizon{Months: 0}, "2035-01-01", true},
+	}
+	for _, tt := range tests {
+		if got := tt.horizon.Allows(date(tt.start), now); got != tt.want {
+			t.Errorf("%d months, %s: Allows = %v, want %v", tt.horizon.Months, tt.start, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// calendarFeedKey signs the per-staff iCalendar feed links; main reads it
+// from CALENDAR_FEED_KEY. Without one the feeds are off. Changing it
+// revokes every link handed out.
+var calendarFeedKey []byte
+
+// icalLineLimit is the longest content line RFC 5545 allows, in octets,
+// before it has to be folded
+const icalLineLimit = 75
+
+// icalWeekdays are the RRULE BYDAY names, in time.Weekday order
+var icalWeekdays = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// calendarFeedToken signs a staff member's feed link. It doesn't expire, as
+// calendar apps keep polling the same URL.
+func calendarFeedToken(staffID int) string {
+	mac := hmac.New(sha256.New, calendarFeedKey)
+	fmt.Fprintf(mac, "calendar\n%d", staffID)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// calendarFeedURL is where calendar apps subscribe to a staff member's feed,
+// under CALENDAR_PUBLIC_URL or else the host the request came in on
+func calendarFeedURL(c *gin.Context, staffID int) string {
+	base := strings.TrimSuffix(os.Getenv("CALENDAR_PUBLIC_URL"), "/")
+	if base == "" {
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + c.Request.Host
+	}
+	return fmt.Sprintf("%s/api/v1/staff/%d/assignments.ics?token=%s", base, staffID, calendarFeedToken(staffID))
+}
+
+// handleGetCalendarFeed hands out the feed link for a staff member. Staff
+// get their own; dispatchers and above can get anyone's.
+func (h *AssignmentHandler) handleGetCalendarFeed(c *gin.Context) {
+	staffID, ok := staffIDFromParam(c)
+	if !ok {
+		return
+	}
+	if len(calendarFeedKey) == 0 {
+		respondError(c, http.StatusConflict, "Calendar feeds are disabled; set CALENDAR_FEED_KEY to enable them")
+		return
+	}
+	principal := currentPrincipal(c)
+	if roleRank[principal.Role] < roleRank[RoleDispatcher] && principal.StaffID != staffID {
+		respondError(c, http.StatusForbidden, "Staff members can only subscribe to their own calendar")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"staff_id": staffID, "url": calendarFeedURL(c, staffID)})
+}
+
+// handleGetStaffCalendar serves a staff member's active assignments as an
+// iCalendar feed to anyone holding its signed link, without a bearer token
+func (h *AssignmentHandler) handleGetStaffCalendar(c *gin.Context) {
+	h = h.forRequest(c)
+	staffID, err := strconv.Atoi(c.Param("staffId"))
+	if err != nil || len(calendarFeedKey) == 0 ||
+		!hmac.Equal([]byte(c.Query("token")), []byte(calendarFeedToken(staffID))) {
+		respondError(c, http.StatusForbidden, "Invalid calendar link")
+		return
+	}
+
+	assignments, err := h.repo.ListByStaff(staffID, nil)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve assignments")
+		return
+	}
+	active := make([]Assignment, 0, len(assignments))
+	for _, assignment := range assignments {
+		if assignment.Status == "active" {
+			active = append(active, assignment)
+		}
+	}
+
+	c.Header("Content-Disposition", `inline; filename="assignments.ics"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(staffCalendar(staffID, withDetails(active))))
+}
+
+// staffCalendar writes a staff member's assignments as an iCalendar feed,
+// one event per assignment, recurring on its working days. Shift times are
+// floating, so calendars show them as the wall-clock times dispatchers set.
+func staffCalendar(staffID int, assignments []AssignmentWithDetails) string {
+	var b strings.Builder
+	line := func(content string) { writeICalLine(&b, content) }
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//bus-staff-assignment//Staff calendar//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + icalText(fmt.Sprintf("Bus shifts (staff %d)", staffID)))
+	line("REFRESH-INTERVAL;VALUE=DURATION:PT1H")
+	line("X-PUBLISHED-TTL:PT1H")
+	for _, assignment := range assignments {
+		writeICalEvent(line, &assignment)
+	}
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+// writeICalEvent writes one assignment's event, or nothing when none of its
+// days is a working day
+func writeICalEvent(line func(string), assignment *AssignmentWithDetails) {
+	// A weekly rule always counts its first date, so start on a working day
+	start := assignment.StartDate
+	for !assignment.WorkingDays.Includes(start.Weekday()) {
+		start = start.AddDate(0, 0, 1)
+	}
+	if assignment.EndDate != nil && start.After(*assignment.EndDate) {
+		return
+	}
+
+	bus := "bus " + strconv.Itoa(assignment.BusID)
+	if assignment.BusPlateNumber != "" {
+		bus += " (" + assignment.BusPlateNumber + ")"
+	}
+	role := assignment.Role
+	if role != "" {
+		role = strings.ToUpper(role[:1]) + role[1:]
+	}
+	stamp := assignment.UpdatedAt.UTC().Format("20060102T150405Z")
+
+	line("BEGIN:VEVENT")
+	line("UID:" + assignment.PublicID + "@bus-staff-assignment")
+	line("DTSTAMP:" + stamp)
+	line("LAST-MODIFIED:" + stamp)
+	line("SUMMARY:" + icalText(role+" on "+bus))
+	line("DESCRIPTION:" + icalText("Assignment "+assignment.Reference))
+
+	timed := assignment.ShiftStart != nil && assignment.ShiftEnd != nil
+	everyDay := assignment.WorkingDays == 0
+	switch {
+	case timed:
+		line("DTSTART:" + icalDateTime(start, *assignment.ShiftStart))
+		line("DTEND:" + icalDateTime(start, *assignment.ShiftEnd))
+	case everyDay && assignment.EndDate != nil:
+		// One event spanning the whole assignment; the end date is exclusive
+		line("DTSTART;VALUE=DATE:" + start.Format("20060102"))
+		line("DTEND;VALUE=DATE:" + assignment.EndDate.AddDate(0, 0, 1).Format("20060102"))
+	default:
+		line("DTSTART;VALUE=DATE:" + start.Format("20060102"))
+		line("DTEND;VALUE=DATE:" + start.AddDate(0, 0, 1).Format("20060102"))
+	}
+
+	spans := !timed && everyDay && assignment.EndDate != nil
+	if !spans && (assignment.EndDate == nil || assignment.EndDate.After(start)) {
+		rule := "RRULE:FREQ=DAILY"
+		if !everyDay {
+			days := make([]string, 0, 7)
+			for day, name := range icalWeekdays {
+				if assignment.WorkingDays.Includes(time.Weekday(day)) {
+					days = append(days, name)
+				}
+			}
+			rule = "RRULE:FREQ=WEEKLY;BYDAY=" + strings.Join(days, ",")
+		}
+		if assignment.EndDate != nil {
+			// UNTIL takes the form of DTSTART: a date, or a floating date-time
+			until := assignment.EndDate.Format("20060102")
+			if timed {
+				until += "T235959"
+			}
+			rule += ";UNTIL=" + until
+		}
+		line(rule)
+	}
+	line("END:VEVENT")
+}
+
+// icalDateTime is a floating local date-time; 24:00 is midnight the next day
+func icalDateTime(day time.Time, at TimeOfDay) string {
+	return day.Add(time.Duration(at) * time.Minute).Format("20060102T150405")
+}
+
+// icalText escapes a TEXT value
+var icalText = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace
+
+// writeICalLine writes a content line ending in CRLF, folding it at 75
+// octets without splitting a UTF-8 sequence
+func writeICalLine(b *strings.Builder, content string) {
+	limit := icalLineLimit
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && content[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(content[:cut])
+		b.WriteString("\r\n ")
+		content = content[cut:]
+		limit = icalLineLimit - 1 // the leading space counts
+	}
+	b.WriteString(content)
+	b.WriteString("\r\n")
+}
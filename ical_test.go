@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// useCalendarFeedKey sets the calendar feed key for one test
+func useCalendarFeedKey(t *testing.T, key string) {
+	t.Helper()
+	saved := calendarFeedKey
+	calendarFeedKey = []byte(key)
+	t.Cleanup(func() { calendarFeedKey = saved })
+}
+
+// staffToken signs an Authorization header value for a staff member
+func staffToken(t *testing.T, secret []byte, staffID int) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		Role:             RoleViewer,
+		StaffID:          staffID,
+		DepotID:          "north",
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "staff"},
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + signed
+}
+
+func TestStaffCalendarFeed(t *testing.T) {
+	router, repo, secret := newClearanceRouter(t)
+	own := staffToken(t, secret, 4)
+
+	if rec := doRequest(router, http.MethodGet, "/api/staff/4/calendar-feed", nil, "Authorization", own); rec.Code != http.StatusConflict {
+		t.Errorf("feed link without a key status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	useCalendarFeedKey(t, "calendar-key")
+
+	end := date("2025-03-31")
+	morning, afternoon := TimeOfDay(6*60), TimeOfDay(14*60)
+	split := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 4, Role: "driver", StartDate: date("2025-03-04"),
+		EndDate: &end, WorkingDays: 1<<1 | 1<<3 | 1<<5, ShiftStart: &morning, ShiftEnd: &afternoon})
+	cancelled := mustCreate(t, repo, Assignment{BusID: 2, StaffID: 4, Role: "conductor", StartDate: date("2025-03-03")})
+	cancelled.Status = "cancelled"
+	if err := repo.Update(&cancelled, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := doRequest(router, http.MethodGet, "/api/staff/5/calendar-feed", nil, "Authorization", own); rec.Code != http.StatusForbidden {
+		t.Errorf("someone else's feed link status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	rec := doRequest(router, http.MethodGet, "/api/staff/4/calendar-feed", nil, "Authorization", own)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("feed link status = %d: %s", rec.Code, rec.Body.String())
+	}
+	link := decode[struct{ URL string }](t, rec).URL
+	path := link[strings.Index(link, "/api/v1/"):]
+
+	if rec := doRequest(router, http.MethodGet, strings.Replace(path, "/staff/4/", "/staff/5/", 1), nil); rec.Code != http.StatusForbidden {
+		t.Errorf("feed with another staff member's token status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	rec = doRequest(router, http.MethodGet, path, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("feed status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/calendar") {
+		t.Errorf("Content-Type = %q, want text/calendar", got)
+	}
+
+	feed := rec.Body.String()
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"UID:" + split.PublicID + "@bus-staff-assignment\r\n",
+		"SUMMARY:Driver on bus 1 (ABC-1234)\r\n",
+		"DTSTART:20250305T060000\r\n", // the first Monday, Wednesday or Friday
+		"DTEND:20250305T140000\r\n",
+		"RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR;UNTIL=20250331T235959\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(feed, want) {
+			t.Errorf("feed is missing %q:\n%s", want, feed)
+		}
+	}
+	if strings.Contains(feed, cancelled.PublicID) {
+		t.Error("feed includes a cancelled assignment")
+	}
+}
+
+func TestICalEvents(t *testing.T) {
+	end := date("2025-03-07")
+	feed := staffCalendar(1, []AssignmentWithDetails{
+		newAssignmentDetails(Assignment{PublicID: "span", Role: "conductor", BusID: 2, StartDate: date("2025-03-03"), EndDate: &end}),
+		newAssignmentDetails(Assignment{PublicID: "open", Role: "driver", BusID: 3, StartDate: date("2025-03-03")}),
+	})
+	for _, want := range []string{
+		"DTSTART;VALUE=DATE:20250303\r\nDTEND;VALUE=DATE:20250308\r\nEND:VEVENT", // one event, end exclusive
+		"DTSTART;VALUE=DATE:20250303\r\nDTEND;VALUE=DATE:20250304\r\nRRULE:FREQ=DAILY\r\n",
+	} {
+		if !strings.Contains(feed, want) {
+			t.Errorf("feed is missing %q:\n%s", want, feed)
+		}
+	}
+}
+
+func TestWriteICalLineFolds(t *testing.T) {
+	var b strings.Builder
+	writeICalLine(&b, "DESCRIPTION:"+strings.Repeat("é", 80))
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n") {
+		if len(line) > icalLineLimit {
+			t.Errorf("line is %d octets, want at most %d", len(line), icalLineLimit)
+		}
+		if !strings.HasPrefix(line, "DESCRIPTION:") && !strings.HasPrefix(line, " ") {
+			t.Errorf("continuation %q doesn't start with a space", line)
+		}
+	}
+	if unfolded := strings.ReplaceAll(b.String(), "\r\n ", ""); unfolded != "DESCRIPTION:"+strings.Repeat("é", 80)+"\r\n" {
+		t.Errorf("unfolded = %q, want the original line", unfolded)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idempotencyTTL is how long a response is kept for replay; main reads it
+// from IDEMPOTENCY_KEY_TTL
+var idempotencyTTL = 24 * time.Hour
+
+// idempotencyClaimTimeout is how long a key may stay claimed by a request
+// that hasn't finished before it is treated as abandoned, such as by a
+// replica that crashed mid-request. It is well past HTTP_WRITE_TIMEOUT.
+const idempotencyClaimTimeout = 5 * time.Minute
+
+// maxIdempotencyKeyLength matches the key column
+const maxIdempotencyKeyLength = 255
+
+// IdempotentResponse is the outcome of a request sent with an Idempotency-Key,
+// kept so a retry of it gets the same response instead of running again.
+// Keys are per caller, so two clients can't collide or read each other's
+// responses.
+type IdempotentResponse struct {
+	Actor       string
+	Key         string
+	RequestHash string // method, URI and body of the original request
+	Status      int    // 0 while the original request is still in progress
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+// IdempotencyRepository stores idempotent responses until they expire
+type IdempotencyRepository interface {
+	// Claim takes the key for a request about to run. When an unexpired
+	// claim or response already holds the key it is returned instead, and
+	// nothing changes.
+	Claim(claim *IdempotentResponse, now time.Time) (*IdempotentResponse, error)
+	// Complete stores the response to a claimed request
+	Complete(response *IdempotentResponse) error
+	// Release gives up a claim, so the key can be used again
+	Release(actor, key string) error
+
+	WithContext(ctx context.Context) IdempotencyRepository
+}
+
+// idempotencyExpired reports whether a stored claim or response no longer
+// holds its key
+func idempotencyExpired(response *IdempotentResponse, now time.Time) bool {
+	if response.Status == 0 {
+		return !response.CreatedAt.After(now.Add(-idempotencyClaimTimeout))
+	}
+	return !response.CreatedAt.After(now.Add(-idempotencyTTL))
+}
+
+// idempotencyRecorder passes the response through while keeping a copy of the
+// body
+type idempotencyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyRecorder) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// idempotent lets a client retry a create safely by sending the same
+// Idempotency-Key: the first successful response is stored, and repeats of
+// the request get it back with Idempotent-Replayed: true instead of running
+// again. Failed requests change nothing, so they aren't stored and may be
+// retried under the same key. Requests without the header run as usual.
+func idempotent(store IdempotencyRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			abortWithError(c, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+
+		// The body is read up front to fingerprint the request, then handed
+		// on to the handler
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize))
+		if err != nil {
+			abortWithError(c, http.StatusRequestEntityTooLarge, "Request body is too large")
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.RequestURI() + "\n"))
+		hash.Write(body)
+
+		claim := &IdempotentResponse{Actor: actorFromContext(c), Key: key, RequestHash: hex.EncodeToString(hash.Sum(nil))}
+		existing, err := store.WithContext(c.Request.Context()).Claim(claim, time.Now())
+		if err != nil {
+			abortWithError(c, http.StatusInternalServerError, "Failed to check Idempotency-Key")
+			return
+		}
+		if existing != nil {
+			switch {
+			case existing.RequestHash != claim.RequestHash:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity,
+					gin.H{"error": newAPIError(http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")})
+			case existing.Status == 0:
+				c.Header("Retry-After", "1")
+				c.AbortWithStatusJSON(http.StatusConflict,
+					gin.H{"error": newAPIError(http.StatusConflict, "A request with this Idempotency-Key is still in progress")})
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(existing.Status, existing.ContentType, existing.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		recorder := &idempotencyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+		c.Writer = recorder.ResponseWriter
+
+		// Settle the claim even if the request ran out of time, so the key
+		// isn't left held
+		store := store.WithContext(context.WithoutCancel(c.Request.Context()))
+		status := recorder.Status()
+		if status < 200 || status >= 300 {
+			if err := store.Release(claim.Actor, claim.Key); err != nil {
+				c.Error(err)
+			}
+			return
+		}
+		claim.Status = status
+		claim.ContentType = recorder.Header().Get("Content-Type")
+		claim.Body = recorder.body.Bytes()
+		if err := store.Complete(claim); err != nil {
+			// The request succeeded, so its response still goes out; a retry
+			// will wait out the claim timeout and then run again
+			c.Error(err)
+		}
+	}
+}
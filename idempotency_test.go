@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIdempotentCreate(t *testing.T) {
+	secret := []byte("test-secret")
+	store := NewMemoryStorage()
+	repo := store.Assignments
+	router := gin.New()
+	setupRoutes(router, AuthConfig{Secret: secret}, store)
+	mobile := bearerToken(t, secret, "mobile", RoleDispatcher)
+	start := time.Now().AddDate(0, 0, 7).Format("2006-01-02")
+	body := gin.H{"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": start}
+
+	first := doRequest(router, http.MethodPost, "/api/assignments", body, "Authorization", mobile, "Idempotency-Key", "k1")
+	if first.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %s", first.Code, http.StatusCreated, first.Body.String())
+	}
+	replay := doRequest(router, http.MethodPost, "/api/assignments", body, "Authorization", mobile, "Idempotency-Key", "k1")
+	if replay.Code != http.StatusCreated || replay.Body.String() != first.Body.String() ||
+		replay.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("replay = %d %s, want the original response", replay.Code, replay.Body.String())
+	}
+	if assignments, _ := repo.List(AssignmentFilter{}); len(assignments) != 1 {
+		t.Fatalf("%d assignments, want the replay not to insert again", len(assignments))
+	}
+
+	other := gin.H{"bus_id": 2, "staff_id": 2, "role": "conductor", "start_date": start}
+	if rec := doRequest(router, http.MethodPost, "/api/assignments", other, "Authorization", mobile, "Idempotency-Key", "k1"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reused key status = %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	// Keys belong to the caller, and failures release them for a retry
+	if rec := doRequest(router, http.MethodPost, "/api/assignments", other, "Authorization",
+		bearerToken(t, secret, "desk", RoleDispatcher), "Idempotency-Key", "k1"); rec.Code != http.StatusCreated {
+		t.Errorf("other caller status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	south := depotToken(t, secret, RoleDispatcher, "south")
+	invalid := gin.H{"bus_id": 3, "staff_id": 3, "role": "driver", "start_date": "not-a-date"}
+	if rec := doRequest(router, http.MethodPost, "/api/assignments", invalid, "Authorization", south, "Idempotency-Key", "k2"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("invalid status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	invalid["start_date"] = start
+	if rec := doRequest(router, http.MethodPost, "/api/assignments", invalid, "Authorization", south, "Idempotency-Key", "k2"); rec.Code != http.StatusCreated {
+		t.Errorf("retry after failure status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+}
+
+func TestMemoryIdempotencyExpiry(t *testing.T) {
+	store := NewMemoryIdempotencyRepository()
+	now := time.Now()
+	claim := func(at time.Time) *IdempotentResponse {
+		existing, err := store.Claim(&IdempotentResponse{Actor: "mobile", Key: "k1", RequestHash: "abc"}, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return existing
+	}
+
+	if claim(now) != nil {
+		t.Fatal("first claim found an existing response")
+	}
+	if existing := claim(now.Add(time.Second)); existing == nil || existing.Status != 0 {
+		t.Fatalf("second claim = %+v, want the request still in progress", existing)
+	}
+	if claim(now.Add(idempotencyClaimTimeout)) != nil {
+		t.Fatal("abandoned claim still holds the key")
+	}
+
+	later := now.Add(idempotencyClaimTimeout)
+	store.Complete(&IdempotentResponse{Actor: "mobile", Key: "k1", RequestHash: "abc", Status: http.StatusCreated,
+		CreatedAt: later})
+	if existing := claim(later.Add(idempotencyTTL - time.Minute)); existing == nil || existing.Status != http.StatusCreated {
+		t.Errorf("claim within the TTL = %+v, want the stored response", existing)
+	}
+	if claim(later.Add(idempotencyTTL)) != nil {
+		t.Error("expired response still holds the key")
+	}
+}
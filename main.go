@@ -1,35 +1,201 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
+	"net"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
 
 func main() {
+	migrateOnly := flag.Bool("migrate", false, "apply pending database migrations and exit")
+	flag.Parse()
+
 	// Load environment variables
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found")
 	}
 
+	// Set up tracing first so database spans are exported from the start
+	shutdownTracing, err := SetupTracing(context.Background())
+	if err != nil {
+		log.Fatal("Failed to initialize tracing:", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	// Initialize database connection
 	if err := InitDB(); err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 	defer CloseDB()
 
+	// Apply schema migrations, either as a one-off job or on startup
+	if *migrateOnly || os.Getenv("MIGRATE_ON_STARTUP") != "false" {
+		if err := RunMigrations(context.Background()); err != nil {
+			log.Fatal("Failed to apply database migrations:", err)
+		}
+		if filled, err := BackfillAssignmentDepots(context.Background()); err != nil {
+			log.Fatal("Failed to fill in assignment depots:", err)
+		} else if filled > 0 {
+			log.Printf("Filled in the depot of %d assignments", filled)
+		}
+	}
+	if *migrateOnly {
+		return
+	}
+
+	// Start read-only if requested, before the schema check can force it
+	maintenanceMode = LoadMaintenanceMode()
+
+	// Refuse to serve against a schema that doesn't match this build
+	readOnly := false
+	drift, err := CheckSchema(context.Background())
+	if err != nil {
+		log.Fatal("Failed to check database schema:", err)
+	}
+	if len(drift) > 0 {
+		for _, object := range drift {
+			log.Printf("Schema drift: %s", object)
+		}
+		switch LoadSchemaDriftAction() {
+		case DriftReadOnly:
+			log.Printf("Database schema drifted from this build; serving read-only")
+			maintenanceMode.Set(true, schemaDriftMessage, "schema-check")
+			readOnly = true
+		case DriftWarn:
+			log.Printf("Database schema drifted from this build; serving anyway because SCHEMA_DRIFT_ACTION=warn")
+		default:
+			log.Fatalf("Database schema drifted from this build in %d places; refusing to start", len(drift))
+		}
+	}
+
+	// Set up publishing of outbox events to the configured broker
+	publisher, err := NewEventPublisher()
+	if err != nil {
+		log.Fatal("Failed to initialize event publisher:", err)
+	}
+	defer publisher.Close()
+
+	// Put the configured cache in front of the bus and staff directory
+	if directory, err = LoadDirectory(); err != nil {
+		log.Fatal("Failed to initialize directory cache:", err)
+	}
+
+	// Set up the export of assignment facts to the configured warehouse
+	warehouse, err := NewWarehouseSink()
+	if err != nil {
+		log.Fatal("Failed to initialize warehouse export:", err)
+	}
+
+	// Open the store export jobs write their artifacts to
+	if exportArtifacts, err = LoadArtifactStore(); err != nil {
+		log.Fatal("Failed to initialize export storage:", err)
+	}
+
+	// Open the store files attached to assignments are kept in
+	if attachmentFiles, err = LoadAttachmentStore(); err != nil {
+		log.Fatal("Failed to initialize attachment storage:", err)
+	}
+
+	// Check the database and upstream services before reporting ready, and
+	// shed expensive work while they struggle
+	readinessChecks = LoadReadinessChecks()
+	degradedMode = LoadDegradedMode()
+
+	// Read business dates from a movable clock when staging rehearses month-end or DST
+	clock = LoadClock()
+
+	// Open the repositories of the configured storage backend
+	store, err := LoadStorage(db)
+	if err != nil {
+		log.Fatal("Failed to open storage:", err)
+	}
+
+	// Load the export callback hosts trusted on private addresses, before the
+	// export runner starts posting to them
+	exportCallbackHosts = LoadExportCallbackHosts()
+
+	// Background workers stop when main returns
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go degradedMode.Run(workerCtx, durationFromEnv("DEGRADED_CHECK_INTERVAL", 10*time.Second))
+	go NewOutboxRelay(publisher).Run(workerCtx)
+	streamHeartbeat = durationFromEnv("STREAM_HEARTBEAT_INTERVAL", 15*time.Second)
+	streamPollInterval = durationFromEnv("STREAM_POLL_INTERVAL", time.Second)
+	go assignmentStream.Listen(workerCtx)
+	if readOnly {
+		log.Println("Shift awarding, assignment expiry, notification sending, warehouse export, roster publication recovery, export jobs and recurring assignment generation are paused until the schema matches")
+	} else {
+		go NewShiftAwarder(store.Shifts, store.Availability, store.Qualifications).Run(workerCtx)
+		go NewAssignmentExpirer(store.Assignments).Run(workerCtx)
+		go NewNotificationSender(LoadNotifiers()).Run(workerCtx)
+		if warehouse != nil {
+			go NewWarehouseExporter(warehouse).Run(workerCtx)
+		}
+		go NewPublicationRecoverer(NewRosterPublisher(store.Publications, store.Assignments,
+			LoadRosterParticipants())).Run(workerCtx)
+		go NewExportRunner(store.ExportJobs, store.Assignments, exportArtifacts).Run(workerCtx)
+		go NewRecurringGenerator(store.Recurring, store.Assignments, store.Availability,
+			store.Qualifications).Run(workerCtx)
+	}
+
+	// Load the public holiday calendar used for pay classification
+	publicHolidays = LoadHolidayCalendar()
+
+	// Load the limit on how far ahead assignments may start
+	schedulingHorizon = LoadSchedulingHorizon()
+
+	// Load how many assignments a bulk operation may change unconfirmed
+	bulkConfirmThreshold = LoadBulkConfirmThreshold()
+
+	// Load the assignment notification templates
+	notificationTemplates = LoadNotificationTemplates()
+
+	// Load how long a request's queries may run
+	requestTimeout = durationFromEnv("REQUEST_TIMEOUT", 30*time.Second)
+
+	// Load how long idempotent responses are kept for replay
+	idempotencyTTL = durationFromEnv("IDEMPOTENCY_KEY_TTL", 24*time.Hour)
+
+	// Load how far a signed callback's timestamp may be from now
+	callbackTolerance = durationFromEnv("CALLBACK_TIMESTAMP_TOLERANCE", 5*time.Minute)
+
+	// Load the key that keeps anonymized exports' pseudonyms stable
+	anonymizationKey = []byte(os.Getenv("ANONYMIZATION_KEY"))
+
+	// Load the key signing staff calendar feed links
+	calendarFeedKey = []byte(os.Getenv("CALENDAR_FEED_KEY"))
+
+	// Load how long export download links stay valid
+	exportLinkTTL = durationFromEnv("EXPORT_LINK_TTL", 15*time.Minute)
+
+	// Load which license class each role needs and how missing ones are handled
+	qualificationPolicy = LoadQualificationPolicy()
+
+	// Load which blocking rules only log what they would refuse, and until
+	// when, unless a mode is declared through /config/rules
+	shadowRules = LoadShadowRules(store.RuleModes)
+
 	// Set Gin mode
 	if os.Getenv("GIN_MODE") == "release" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	// Fail readiness until warm-up has finished
+	lifecycle.WarmingUp()
+
 	// Initialize router
 	router := gin.Default()
 
 	// Initialize routes
-	setupRoutes(router)
+	setupRoutes(router, LoadAuthConfig(), store)
 
 	// Get port from environment or default to 8082
 	port := os.Getenv("PORT")
@@ -37,45 +203,323 @@ func main() {
 		port = "8082"
 	}
 
-	log.Printf("Bus Staff Assignment Service starting on port %s", port)
-	if err := router.Run(":" + port); err != nil {
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
 		log.Fatal("Failed to start server:", err)
 	}
+
+	// Drain in-flight requests on SIGTERM or SIGINT; the deferred calls then
+	// stop the workers and close the database pool once the server has stopped
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	// Warm up while liveness probes are already answered, then report ready
+	go func() {
+		warmupCtx, cancel := context.WithTimeout(ctx, durationFromEnv("WARMUP_TIMEOUT", 30*time.Second))
+		defer cancel()
+		warmUp(warmupCtx, db, store.Assignments, directory)
+		lifecycle.Serving()
+	}()
+
+	serverConfig := LoadServerConfig()
+	log.Printf("Bus Staff Assignment Service starting on port %s", port)
+	server := newHTTPServer(router, serverConfig)
+	server.RegisterOnShutdown(assignmentStream.Close)
+	if err := serve(ctx, server, listener, serverConfig.DrainDelay, serverConfig.ShutdownTimeout); err != nil {
+		log.Fatal("Server failed:", err)
+	}
+	log.Println("Server stopped")
 }
 
-func setupRoutes(router *gin.Engine) {
-	// Add CORS middleware
-	router.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
+func setupRoutes(router *gin.Engine, authConfig AuthConfig, store Storage) {
+	handlers := &apiHandlers{
+		assignments: NewAssignmentHandler(store.Assignments, store.Availability, store.Calendars,
+			store.Qualifications, store.Attachments),
+		views:         NewViewHandler(store.Views, store.Assignments),
+		availability:  NewAvailabilityHandler(store.Availability, store.Assignments),
+		calendars:     NewDepotCalendarHandler(store.Calendars),
+		scenarios:     NewScenarioHandler(store.Scenarios, store.Assignments, store.Availability, store.Qualifications, store.Calendars),
+		notifications: NewNotificationHandler(store.Notifications),
+		publications: NewPublicationHandler(NewRosterPublisher(store.Publications, store.Assignments,
+			LoadRosterParticipants()), store.Publications),
+		idempotency:    store.Idempotency,
+		exports:        NewExportJobHandler(store.ExportJobs),
+		qualifications: NewQualificationHandler(store.Qualifications),
+		recurring: NewRecurringTemplateHandler(store.Recurring, NewRecurringGenerator(store.Recurring,
+			store.Assignments, store.Availability, store.Qualifications)),
+		callbackKeys: NewCallbackKeyHandler(store.CallbackKeys),
+		shifts:       NewShiftHandler(store.Shifts, store.Assignments, store.Availability, store.Qualifications),
+		ruleModes:    NewRuleModeHandler(store.RuleModes),
+	}
+	maintenance := maintenanceMode
+	degraded := degradedMode
 
-		c.Next()
-	})
+	// Take the caller's address from forwarding headers only behind trusted proxies
+	LoadProxyConfig().apply(router)
+
+	router.Use(traceRequests(), recordClientIP())
+
+	// Cancel the queries of requests that run too long
+	router.Use(limitRequestTime())
+
+	// Let the configured browser origins call the API
+	router.Use(cors(LoadCORSConfig()))
+
+	// Tell clients when enrichment and analytics are being shed
+	router.Use(degraded.annotate())
 
 	// Health check
 	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{"status": "ok", "service": "bus-staff-assignment"})
+		c.JSON(200, gin.H{"status": "ok", "service": "bus-staff-assignment", "maintenance": maintenance.Status().Enabled})
 	})
 
-	// API routes
-	api := router.Group("/api")
+	// Kubernetes probes: liveness only needs the process, readiness needs its dependencies
+	router.GET("/healthz", handleLiveness)
+	router.GET("/readyz", handleReadiness)
+
+	// API specification and Swagger UI, outside the authenticated group
+	router.GET("/api/openapi.json", handleGetOpenAPI)
+	serveAPIDocs(router)
+
+	// Embedded admin UI, calling the API below with the admin's token
+	if adminUIEnabled() {
+		serveAdminUI(router)
+	}
+
+	// Download links for locally stored export artifacts carry their own
+	// signature in place of a token
+	if local, ok := exportArtifacts.(*localArtifactStore); ok {
+		router.GET("/api/v1/export-artifacts/:key", local.handleDownloadArtifact)
+	}
+
+	// Staff calendar feeds carry a signed token in the URL, since calendar
+	// apps can't send one in a header
+	router.GET("/api/v1/staff/:staffId/assignments.ics", handlers.assignments.handleGetStaffCalendar)
+	router.GET("/api/staff/:staffId/assignments.ics", deprecatedAlias("/api/v1"),
+		handlers.assignments.handleGetStaffCalendar)
+
+	// Counterpart systems confirming shift swaps and approvals sign their
+	// callbacks with a key issued to them, in place of a token
+	callbacks := router.Group("/api/v1/callbacks", verifyCallback(store.CallbackKeys), maintenance.rejectWrites())
 	{
-		// Assignment routes
-		api.POST("/assignments", handleCreateAssignment)
-		api.GET("/assignments", handleGetAssignments)
-		api.GET("/assignments/:id", handleGetAssignment)
-		api.PUT("/assignments/:id", handleUpdateAssignment)
-		api.DELETE("/assignments/:id", handleDeleteAssignment)
+		callbacks.POST("/shifts/:id/claim/confirm", handlers.shifts.handleConfirmClaim)
+		callbacks.POST("/shifts/:id/claim/reject", handlers.shifts.handleRejectClaim)
+	}
+
+	// API routes, limited to the caller's depot, with staff names and contact
+	// details masked for callers without pii:read. Each version registers its
+	// routes on its own group.
+	v1 := router.Group("/api/v1", authenticate(authConfig), scopeDepot(), redactPII())
+	registerV1Routes(v1, handlers)
+
+	// The unversioned paths clients used before versioning, kept as aliases of
+	// v1 for one release
+	legacy := router.Group("/api", deprecatedAlias("/api/v1"), authenticate(authConfig), scopeDepot(),
+		redactPII())
+	registerV1Routes(legacy, handlers)
+}
+
+// registerV1Routes registers the v1 API on the group
+func registerV1Routes(api *gin.RouterGroup, h *apiHandlers) {
+	assignments := h.assignments
+	views := h.views
+	maintenance := maintenanceMode
+	degraded := degradedMode
+	stream := assignmentStream
+	availability := h.availability
+	calendars := h.calendars
+	scenarios := h.scenarios
+	notifications := h.notifications
+	publications := h.publications
+	idempotencyRepo := h.idempotency
+	exports := h.exports
+	qualifications := h.qualifications
+	recurring := h.recurring
+	callbackKeys := h.callbackKeys
+	shifts := h.shifts
+	ruleModes := h.ruleModes
+
+	// Reporting routes (reporting and above): exports, roster reads and
+	// analytics, with no per-assignment detail, for BI tools' credentials.
+	// Queuing an export job is the one POST: it writes only the job, which
+	// its requester alone can read.
+	reporting := api.Group("", requireRole(RoleReporting), maintenance.rejectWrites())
+	{
+		reporting.GET("/assignments/export", degraded.shed(), assignments.handleExportAssignments)
+		reporting.POST("/exports", exports.handleCreateExportJob)
+		reporting.GET("/exports", exports.handleGetExportJobs)
+		reporting.GET("/exports/:id", exports.handleGetExportJob)
+		reporting.GET("/roster", degraded.shed(), assignments.handleGetRoster)
+		reporting.GET("/roster/published", publications.handleGetPublishedRoster)
+		reporting.GET("/roster/publications", publications.handleGetPublications)
+		reporting.GET("/roster/publications/:id", publications.handleGetPublication)
+		reporting.GET("/analytics/forecast", degraded.shed(), assignments.handleGetForecast)
+		reporting.GET("/reports/staff-utilization", degraded.shed(), assignments.handleGetStaffUtilization)
+		reporting.GET("/reports/bus-coverage", degraded.shed(), assignments.handleGetBusCoverage)
+	}
+
+	// Read routes (viewer and above)
+	read := api.Group("", requireRole(RoleViewer), maintenance.rejectWrites())
+	{
+		read.GET("/assignments", assignments.handleGetAssignments)
+		read.GET("/assignments/duplicate-staff", degraded.shed(), assignments.handleGetDuplicateStaff)
+		read.GET("/assignments/stream", stream.handleStreamAssignments)
+		read.GET("/assignments/:id", assignments.handleGetAssignment)
+		read.GET("/assignments/:id/history", assignments.handleGetAssignmentHistory)
+		read.GET("/assignments/:id/attachments", assignments.handleGetAttachments)
+		read.GET("/assignments/:id/attachments/:attachmentId", assignments.handleDownloadAttachment)
+		read.GET("/activity", degraded.shed(), assignments.handleGetActivity)
+
+		// Saved views, private to the caller
+		read.GET("/views", views.handleGetViews)
+		read.GET("/views/:name", views.handleGetView)
+		read.PUT("/views/:name", views.handleSaveView)
+		read.DELETE("/views/:name", views.handleDeleteView)
+		read.GET("/views/:name/assignments", views.handleGetViewAssignments)
 
 		// Query routes
-		api.GET("/assignments/bus/:busId", handleGetStaffForBus)
-		api.GET("/assignments/staff/:staffId", handleGetAssignmentsForStaff)
+		read.GET("/assignments/bus/:busId", assignments.handleGetStaffForBus)
+		read.GET("/assignments/staff/:staffId", assignments.handleGetAssignmentsForStaff)
+		read.GET("/buses/:busId/crew-status", degraded.shed(), assignments.handleGetBusCrewStatus)
+		read.GET("/crew-status", degraded.shed(), assignments.handleGetCrewStatus)
+
+		// Staff availability
+		read.GET("/availability", availability.handleGetAvailability)
+		read.GET("/availability/:id", availability.handleGetAvailabilityPeriod)
+
+		// Staff license classes
+		read.GET("/staff/:staffId/qualifications", qualifications.handleGetQualifications)
+
+		// Recurring assignment templates
+		read.GET("/recurring-assignments", recurring.handleGetRecurringTemplates)
+		read.GET("/recurring-assignments/:id", recurring.handleGetRecurringTemplate)
+
+		// Calendar feed links, for a staff member's own calendar app
+		read.GET("/staff/:staffId/calendar-feed", assignments.handleGetCalendarFeed)
+
+		// Open shifts
+		read.GET("/shifts", shifts.handleGetShifts)
+		read.GET("/shifts/open", shifts.handleGetClaimableShifts)
+		read.GET("/shifts/:id", shifts.handleGetShift)
+	}
+
+	// Staff-facing routes (viewer and above, acting as the token's staff member)
+	staff := api.Group("", requireRole(RoleViewer), maintenance.rejectWrites())
+	{
+		staff.POST("/shifts/:id/bids", shifts.handlePlaceBid)
+		staff.DELETE("/shifts/:id/bids", shifts.handleWithdrawBid)
+		staff.POST("/shifts/:id/claim", shifts.handleClaimShift)
+	}
+
+	// Write routes (dispatcher and above)
+	write := api.Group("", requireRole(RoleDispatcher), maintenance.rejectWrites())
+	{
+		write.POST("/assignments", idempotent(idempotencyRepo), assignments.handleCreateAssignment)
+		write.POST("/assignments/import", idempotent(idempotencyRepo), assignments.handleImportAssignments)
+		write.PUT("/assignments/:id", assignments.handleUpdateAssignment)
+		write.PATCH("/assignments/:id", assignments.handlePatchAssignment)
+		write.DELETE("/assignments/:id", assignments.handleDeleteAssignment)
+		write.POST("/assignments/:id/clone", assignments.handleCloneAssignment)
+		write.POST("/assignments/:id/restore", requireRole(RoleAdmin), assignments.handleRestoreAssignment)
+		write.POST("/assignments/:id/attachments", assignments.handleUploadAttachment)
+
+		// Bus operations
+		write.POST("/buses/:busId/reassign", assignments.handleReassignBus)
+
+		// Staff operations
+		write.POST("/staff/:staffId/transfer", assignments.handleTransferStaff)
+
+		// Roster publishing to the timetable and notification services
+		write.POST("/roster/publish", publications.handlePublishRoster)
+
+		// Staff availability
+		write.POST("/availability", availability.handleCreateAvailability)
+		write.PUT("/availability/:id", availability.handleUpdateAvailability)
+		write.DELETE("/availability/:id", availability.handleDeleteAvailability)
+
+		// Staff license classes
+		write.PUT("/staff/:staffId/qualifications/:class", qualifications.handlePutQualification)
+		write.DELETE("/staff/:staffId/qualifications/:class", qualifications.handleDeleteQualification)
+
+		// Recurring assignment templates
+		write.POST("/recurring-assignments", recurring.handleCreateRecurringTemplate)
+		write.PUT("/recurring-assignments/:id", recurring.handleUpdateRecurringTemplate)
+		write.DELETE("/recurring-assignments/:id", recurring.handleDeleteRecurringTemplate)
+		write.POST("/recurring-assignments/:id/generate", recurring.handleGenerateRecurringTemplate)
+
+		// Shift bidding
+		write.POST("/shifts", shifts.handleCreateShift)
+		write.GET("/shifts/:id/bids", shifts.handleGetShiftBids)
+		write.POST("/shifts/:id/claim/confirm", shifts.handleConfirmClaim)
+		write.POST("/shifts/:id/claim/reject", shifts.handleRejectClaim)
+
+		// What-if scenarios
+		write.GET("/scenarios", scenarios.handleGetScenarios)
+		write.POST("/scenarios", scenarios.handleCreateScenario)
+		write.GET("/scenarios/:id", scenarios.handleGetScenario)
+		write.POST("/scenarios/:id/edits", scenarios.handleEditScenario)
+		write.POST("/scenarios/:id/autofill", scenarios.handleAutofillScenario)
+		write.GET("/scenarios/:id/compare", scenarios.handleCompareScenario)
+		write.POST("/scenarios/:id/apply", scenarios.handleApplyScenario)
+		write.POST("/scenarios/:id/discard", scenarios.handleDiscardScenario)
+
+		// Assignment change notifications to staff
+		write.GET("/staff/:staffId/notification-channels", notifications.handleGetNotificationChannels)
+		write.PUT("/staff/:staffId/notification-channels", notifications.handlePutNotificationChannels)
+		write.DELETE("/staff/:staffId/notification-channels", notifications.handleDeleteNotificationChannels)
+		write.GET("/notifications", notifications.handleGetNotifications)
+		write.POST("/notifications/:id/retry", notifications.handleRetryNotification)
+	}
+
+	// Two-phase deletes called by the staff and bus services before they delete a record
+	deletions := api.Group("", requireRole(RoleAdmin), maintenance.rejectWrites())
+	{
+		deletions.GET("/staff/:staffId/deletion-check", assignments.handleCheckDeletion)
+		deletions.POST("/staff/:staffId/deletion/prepare", assignments.handlePrepareDeletion)
+		deletions.GET("/buses/:busId/deletion-check", assignments.handleCheckDeletion)
+		deletions.POST("/buses/:busId/deletion/prepare", assignments.handlePrepareDeletion)
+		deletions.GET("/deletions/:id", assignments.handleGetDeletion)
+		deletions.POST("/deletions/:id/confirm", assignments.handleConfirmDeletion)
+		deletions.POST("/deletions/:id/abort", assignments.handleAbortDeletion)
+	}
+
+	// Declarative configuration, applied idempotently by infrastructure tooling
+	config := api.Group("/config", requireRole(RoleAdmin), maintenance.rejectWrites())
+	{
+		config.GET("/shifts", shifts.handleGetDeclaredShifts)
+		config.GET("/shifts/:name", shifts.handleGetDeclaredShift)
+		config.PUT("/shifts/:name", shifts.handlePutDeclaredShift)
+		config.DELETE("/shifts/:name", shifts.handleDeleteDeclaredShift)
+		config.GET("/depot-calendars", calendars.handleGetDepotCalendars)
+		config.GET("/depot-calendars/:name", calendars.handleGetDepotCalendar)
+		config.PUT("/depot-calendars/:name", calendars.handlePutDepotCalendar)
+		config.DELETE("/depot-calendars/:name", calendars.handleDeleteDepotCalendar)
+		config.GET("/rules", ruleModes.handleGetRuleModes)
+		config.GET("/rules/:name", ruleModes.handleGetRuleMode)
+		config.PUT("/rules/:name", ruleModes.handlePutRuleMode)
+		config.DELETE("/rules/:name", ruleModes.handleDeleteRuleMode)
+		config.GET("/notification-channels", notifications.handleGetDeclaredNotificationChannels)
+		config.GET("/notification-channels/:staffId", notifications.handleGetNotificationChannels)
+		config.PUT("/notification-channels/:staffId", notifications.handlePutDeclaredNotificationChannels)
+		config.DELETE("/notification-channels/:staffId", notifications.handleDeleteNotificationChannels)
+	}
+
+	// Admin routes, which stay writable during maintenance so it can be turned off
+	admin := api.Group("/admin", requireRole(RoleAdmin))
+	{
+		admin.GET("/maintenance", maintenance.handleGetMaintenance)
+		admin.PUT("/maintenance", maintenance.handleSetMaintenance)
+		admin.GET("/clock", handleGetClock)
+		admin.PUT("/clock", handleSetClock)
+		admin.GET("/rules", handleGetRules)
+		admin.GET("/callback-keys", callbackKeys.handleGetCallbackKeys)
+		admin.POST("/callback-keys", maintenance.rejectWrites(), callbackKeys.handleCreateCallbackKey)
+		admin.DELETE("/callback-keys/:id", maintenance.rejectWrites(), callbackKeys.handleRevokeCallbackKey)
+	}
+
+	// Called by the bus and staff services when their data changes
+	cache := api.Group("/cache", requireRole(RoleAdmin))
+	{
+		cache.POST("/invalidate", handleInvalidateDirectoryCache)
 	}
 }
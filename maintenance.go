@@ -0,0 +1,116 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultMaintenanceMessage is shown to callers whose writes are rejected
+const defaultMaintenanceMessage = "The service is in maintenance mode for a roster data migration; changes are disabled until it finishes"
+
+// MaintenanceStatus reports whether the API is read-only
+type MaintenanceStatus struct {
+	Enabled bool       `json:"enabled"`
+	Message string     `json:"message,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+	SetBy   string     `json:"set_by,omitempty"` // the admin who last toggled it, or env
+}
+
+// MaintenanceMode makes the API read-only during roster data migrations.
+// Toggling it through the API only affects this instance; set
+// MAINTENANCE_MODE on every instance to cover a whole deployment.
+type MaintenanceMode struct {
+	mu     sync.RWMutex
+	status MaintenanceStatus
+}
+
+var maintenanceMode = &MaintenanceMode{}
+
+// SetMaintenanceRequest turns maintenance mode on or off
+type SetMaintenanceRequest struct {
+	Enabled *bool  `json:"enabled" binding:"required"`
+	Message string `json:"message,omitempty"` // replaces the default message
+}
+
+// LoadMaintenanceMode reads MAINTENANCE_MODE (default false) and the optional
+// MAINTENANCE_MESSAGE
+func LoadMaintenanceMode() *MaintenanceMode {
+	mode := &MaintenanceMode{}
+	if os.Getenv("MAINTENANCE_MODE") == "true" {
+		mode.Set(true, os.Getenv("MAINTENANCE_MESSAGE"), "env")
+	}
+	return mode
+}
+
+// Status returns the current maintenance state
+func (m *MaintenanceMode) Status() MaintenanceStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status
+}
+
+// Set turns maintenance mode on or off and returns the new state
+func (m *MaintenanceMode) Set(enabled bool, message, actor string) MaintenanceStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !enabled {
+		m.status = MaintenanceStatus{SetBy: actor}
+		return m.status
+	}
+
+	message = strings.TrimSpace(message)
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+	since := time.Now()
+	if m.status.Enabled {
+		since = *m.status.Since // changing the message doesn't restart the window
+	}
+	m.status = MaintenanceStatus{Enabled: true, Message: message, Since: &since, SetBy: actor}
+	return m.status
+}
+
+// rejectWrites answers anything but a read with 503 while maintenance mode is
+// on, so reads and health checks stay green
+func (m *MaintenanceMode) rejectWrites() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		if status := m.Status(); status.Enabled {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":       newAPIError(http.StatusServiceUnavailable, status.Message),
+				"maintenance": status,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func (m *MaintenanceMode) handleGetMaintenance(c *gin.Context) {
+	c.JSON(http.StatusOK, m.Status())
+}
+
+func (m *MaintenanceMode) handleSetMaintenance(c *gin.Context) {
+	var req SetMaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, &req, err)
+		return
+	}
+
+	actor := actorFromContext(c)
+	status := m.Set(*req.Enabled, req.Message, actor)
+	log.Printf("Maintenance mode set to %v by %s", status.Enabled, actor)
+	c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"bus-staff-assignment/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	t.Cleanup(func() { maintenanceMode.Set(false, "", "test") })
+	router, _ := newTestRouter(t)
+	body := gin.H{"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": "2025-01-06"}
+
+	rec := doRequest(router, http.MethodPut, "/api/admin/maintenance", gin.H{"enabled": true, "message": "Migrating rosters until 22:00"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("enable status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	rec = doRequest(router, http.MethodPost, "/api/assignments", body)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("write status = %d, want %d: %s", rec.Code, http.StatusServiceUnavailable, rec.Body.String())
+	}
+	if got := decode[struct{ Error APIError }](t, rec).Error; got.Code != apierror.CodeUnavailable || got.Message != "Migrating rosters until 22:00" {
+		t.Errorf("error = %+v, want unavailable with the maintenance message", got)
+	}
+	if rec := doRequest(router, http.MethodPut, "/api/views/mine", gin.H{"filter": gin.H{}}); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("saved view status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	if rec := doRequest(router, http.MethodGet, "/api/assignments", nil); rec.Code != http.StatusOK {
+		t.Errorf("read status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	rec = doRequest(router, http.MethodGet, "/health", nil)
+	if got := decode[struct{ Maintenance bool }](t, rec); rec.Code != http.StatusOK || !got.Maintenance {
+		t.Errorf("health = %d %s, want 200 reporting maintenance", rec.Code, rec.Body.String())
+	}
+
+	if rec := doRequest(router, http.MethodPut, "/api/admin/maintenance", gin.H{"enabled": false}); rec.Code != http.StatusOK {
+		t.Fatalf("disable status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if rec := doRequest(router, http.MethodPost, "/api/assignments", body); rec.Code != http.StatusCreated {
+		t.Errorf("write after maintenance status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+}
+
+func TestMaintenanceModeRequiresAdmin(t *testing.T) {
+	secret := []byte("test-secret")
+	router := gin.New()
+	setupRoutes(router, AuthConfig{Secret: secret}, NewMemoryStorage())
+
+	token := bearerToken(t, secret, "dispatcher-1", RoleDispatcher)
+	rec := doRequest(router, http.MethodPut, "/api/admin/maintenance", gin.H{"enabled": true}, "Authorization", token)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestLoadMaintenanceMode(t *testing.T) {
+	t.Setenv("MAINTENANCE_MODE", "true")
+	t.Setenv("MAINTENANCE_MESSAGE", "")
+
+	status := LoadMaintenanceMode().Status()
+	if !status.Enabled || status.Message != defaultMaintenanceMessage || status.SetBy != "env" {
+		t.Errorf("status = %+v, want enabled from env with the default message", status)
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bus-staff-assignment/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+// ClaimShiftRequest lets a dispatcher claim a shift on a staff member's
+// behalf; staff callers always claim as the staff member in their token
+type ClaimShiftRequest struct {
+	StaffID int `json:"staff_id,omitempty"`
+}
+
+var (
+	errShiftNotClaimable = errors.New("shift is not open for claiming")
+	errNoPendingClaim    = errors.New("shift has no claim awaiting confirmation")
+)
+
+// takeUpCheck refuses a staff member taking up a shift's assignment for
+// breaking a rule kept outside the assignments, such as staff availability,
+// with an UnavailableError or QualificationError; other errors are failures
+// to check. It's called while the take-up's transaction holds the shift
+// locked, but reads outside that transaction, so leave or licenses recorded
+// concurrently may not be seen.
+type takeUpCheck func(assignment *Assignment) error
+
+// shiftRules checks staff taking up shifts against their availability and
+// qualifications, as creating the assignment directly would. Rules in shadow
+// mode let the staff member through, as does QUALIFICATION_CHECK=flag, which
+// only logs them.
+func shiftRules(ctx context.Context, availability AvailabilityRepository, qualifications QualificationRepository,
+	actor string) takeUpCheck {
+	return func(assignment *Assignment) error {
+		unavailable, err := unavailableFor(availability, assignment)
+		if err != nil {
+			return err
+		}
+		if len(unavailable) > 0 && shadowRules.Enforce(ctx, apierror.RuleStaffAvailability, actor,
+			unavailableMessage(assignment.StaffID, unavailable)) {
+			return &UnavailableError{StaffID: assignment.StaffID, Unavailable: unavailable}
+		}
+
+		if qualificationPolicy.Mode == QualificationOff {
+			return nil
+		}
+		problem, err := qualificationProblem(qualifications, assignment)
+		if err != nil || problem == nil {
+			return err
+		}
+		if qualificationPolicy.Mode == QualificationFlag {
+			log.Printf("Unqualified shift taken up by %s: %s", actor, problem.message())
+			return nil
+		}
+		if shadowRules.Enforce(ctx, apierror.RuleStaffQualification, actor, problem.message()) {
+			return &QualificationError{Problem: *problem}
+		}
+		return nil
+	}
+}
+
+// Taking shifts up, shared by the repositories, which lock the shift and
+// save the outcome these leave on it
+
+// checkTakeUp returns why the staff member can't take up the shift's
+// assignment, a ConflictError, DeletionHoldError or the check's refusal, or
+// nil when they can. Other errors are failures to check; refusedTakeUp tells
+// the two apart.
+func checkTakeUp(tx assignmentTx, assignment *Assignment, check takeUpCheck) error {
+	conflicts, err := tx.conflicts(assignment)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		return &ConflictError{Assignment: *assignment, Conflicts: conflicts}
+	}
+	hold, err := tx.deletionHeld(assignment)
+	if err != nil {
+		return err
+	}
+	if hold != nil {
+		return &DeletionHoldError{Hold: *hold}
+	}
+	return check(assignment)
+}
+
+// refusedTakeUp reports whether an error from checkTakeUp is a rule refusing
+// the staff member rather than a failure to check
+func refusedTakeUp(err error) bool {
+	var conflictErr *ConflictError
+	var holdErr *DeletionHoldError
+	var unavailableErr *UnavailableError
+	var qualificationErr *QualificationError
+	return errors.As(err, &conflictErr) || errors.As(err, &holdErr) || errors.As(err, &unavailableErr) ||
+		errors.As(err, &qualificationErr)
+}
+
+// awardShiftTo creates the shift's assignment for the staff member and marks
+// the shift awarded
+func awardShiftTo(tx assignmentTx, shift *OpenShift, staffID int, actor string) (*Assignment, error) {
+	assignment := shift.assignment(staffID)
+	if err := tx.create(&assignment, actor); err != nil {
+		return nil, err
+	}
+	shift.Status = "awarded"
+	shift.AwardedStaffID = &staffID
+	shift.AssignmentID = &assignment.ID
+	shift.AssignmentPublicID = &assignment.PublicID
+	return &assignment, nil
+}
+
+// claimShift gives a claim-mode shift to the first staff member to claim it.
+// Shifts requiring confirmation are held as 'claimed' and no assignment is
+// returned; otherwise the assignment is created straight away.
+func claimShift(tx assignmentTx, shift *OpenShift, staffID int, actor string, now time.Time,
+	check takeUpCheck) (*Assignment, error) {
+	if shift == nil || shift.Mode != ShiftModeClaim || shift.Status != "open" || !now.Before(shift.BiddingClosesAt) {
+		return nil, errShiftNotClaimable
+	}
+
+	// A claim held for confirmation creates nothing yet, so check up front
+	assignment := shift.assignment(staffID)
+	if err := checkTakeUp(tx, &assignment, check); err != nil {
+		return nil, err
+	}
+
+	if shift.RequiresConfirmation {
+		shift.Status = "claimed"
+		shift.AwardedStaffID = &staffID
+		return nil, nil
+	}
+	return awardShiftTo(tx, shift, staffID, actor)
+}
+
+// confirmShiftClaim creates the assignment for a claim awaiting confirmation,
+// re-checking it since the staff member may have been booked or gone on leave
+// meanwhile
+func confirmShiftClaim(tx assignmentTx, shift *OpenShift, actor string, check takeUpCheck) (*Assignment, error) {
+	if shift == nil || shift.Status != "claimed" || shift.AwardedStaffID == nil {
+		return nil, errNoPendingClaim
+	}
+
+	assignment := shift.assignment(*shift.AwardedStaffID)
+	if err := checkTakeUp(tx, &assignment, check); err != nil {
+		return nil, err
+	}
+	return awardShiftTo(tx, shift, *shift.AwardedStaffID, actor)
+}
+
+// Open shift marketplace handlers
+
+func (h *ShiftHandler) handleGetClaimableShifts(c *gin.Context) {
+	h = h.forRequest(c)
+	role := c.Query("role")
+	if role != "" && role != "driver" && role != "conductor" {
+		respondInvalidField(c, "role", "Role must be 'driver' or 'conductor'")
+		return
+	}
+
+	var busID int
+	if busIDStr := c.Query("bus_id"); busIDStr != "" {
+		var err error
+		if busID, err = strconv.Atoi(busIDStr); err != nil {
+			respondInvalidField(c, "bus_id", "Invalid bus ID")
+			return
+		}
+	}
+
+	shifts, err := h.shifts.ListClaimable(role, busID, clock.Now())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve shifts")
+		return
+	}
+
+	// Staff only see shifts their position makes them eligible for
+	claimable := []OpenShift{}
+	principal := currentPrincipal(c)
+	for _, shift := range shifts {
+		if principal.StaffID == 0 || staffEligibleForRole(principal.StaffID, shift.Role) {
+			claimable = append(claimable, shift)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shifts": claimable, "count": len(claimable)})
+}
+
+// respondClaimError writes the response for an error from the claim operations
+func respondClaimError(c *gin.Context, err error) {
+	var conflictErr *ConflictError
+	var holdErr *DeletionHoldError
+	var unavailableErr *UnavailableError
+	var qualificationErr *QualificationError
+	switch {
+	case errors.As(err, &conflictErr):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     newAPIError(http.StatusConflict, "Staff member has conflicting assignments during this shift"),
+			"conflicts": conflictErr.Conflicts,
+		})
+	case errors.As(err, &holdErr):
+		respondDeletionHold(c, err)
+	case errors.As(err, &unavailableErr):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":       newRuleViolation(apierror.RuleStaffAvailability, "Staff member is unavailable during this shift"),
+			"unavailable": unavailableErr.Unavailable,
+		})
+	case errors.As(err, &qualificationErr):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":         newRuleViolation(apierror.RuleStaffQualification, qualificationErr.Error()),
+			"qualification": qualificationErr.Problem,
+		})
+	case errors.Is(err, errShiftNotClaimable), errors.Is(err, errNoPendingClaim):
+		respondError(c, http.StatusConflict, err.Error())
+	default:
+		respondError(c, http.StatusInternalServerError, "Failed to update shift")
+	}
+}
+
+func (h *ShiftHandler) handleClaimShift(c *gin.Context) {
+	h = h.forRequest(c)
+	shift := h.shiftFromParam(c)
+	if shift == nil {
+		return
+	}
+
+	var req ClaimShiftRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBindError(c, &req, err)
+		return
+	}
+
+	staffID := bidderStaffID(c, req.StaffID)
+	if staffID == 0 {
+		return
+	}
+	if !staffEligibleForRole(staffID, shift.Role) {
+		respondError(c, http.StatusUnprocessableEntity, "Staff member is not eligible for the "+shift.Role+" role")
+		return
+	}
+
+	claimed, assignment, err := h.shifts.Claim(shift.ID, staffID, actorFromContext(c), clock.Now(), h.rules(c))
+	if err != nil {
+		respondClaimError(c, err)
+		return
+	}
+
+	if assignment == nil {
+		c.JSON(http.StatusAccepted, gin.H{"message": "Claim awaiting dispatcher confirmation", "shift": claimed})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"shift": claimed, "assignment": assignment})
+}
+
+func (h *ShiftHandler) handleConfirmClaim(c *gin.Context) {
+	h = h.forRequest(c)
+	shift := h.shiftFromParam(c)
+	if shift == nil {
+		return
+	}
+
+	confirmed, assignment, err := h.shifts.ConfirmClaim(shift.ID, actorFromContext(c), h.rules(c))
+	if err != nil {
+		respondClaimError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"shift": confirmed, "assignment": assignment})
+}
+
+func (h *ShiftHandler) handleRejectClaim(c *gin.Context) {
+	h = h.forRequest(c)
+	shift := h.shiftFromParam(c)
+	if shift == nil {
+		return
+	}
+
+	released, err := h.shifts.RejectClaim(shift.ID)
+	if err != nil {
+		respondClaimError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, released)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"bus-staff-assignment/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+func TestClaimShift(t *testing.T) {
+	useTravelClock(t).Set(date("2031-02-01"), true, "test")
+	router, store := newShiftRouter(t)
+	mustCreate(t, store.Assignments, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2031-03-01")})
+
+	rec := doRequest(router, http.MethodPost, "/api/v1/shifts", gin.H{
+		"bus_id": 2, "role": "driver", "start_date": "2031-03-03", "mode": "claim", "requires_confirmation": true,
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create shift = %d %s", rec.Code, rec.Body.String())
+	}
+	shift := decode[OpenShift](t, rec)
+	path := "/api/v1/shifts/" + strconv.Itoa(shift.ID)
+
+	open := decode[struct{ Shifts []OpenShift }](t, doRequest(router, http.MethodGet, "/api/v1/shifts/open?role=driver", nil))
+	if len(open.Shifts) != 1 || open.Shifts[0].ID != shift.ID {
+		t.Errorf("claimable = %+v, want the shift", open.Shifts)
+	}
+
+	if rec := doRequest(router, http.MethodPost, path+"/claim", gin.H{"staff_id": 1}); rec.Code != http.StatusConflict {
+		t.Errorf("claim by a booked driver = %d %s, want 409", rec.Code, rec.Body.String())
+	}
+	if rec := doRequest(router, http.MethodPost, path+"/claim/confirm", nil); rec.Code != http.StatusConflict {
+		t.Errorf("confirm without a claim = %d, want 409", rec.Code)
+	}
+
+	rec = doRequest(router, http.MethodPost, path+"/claim", gin.H{"staff_id": 3})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("claim = %d %s, want 202", rec.Code, rec.Body.String())
+	}
+	if rec := doRequest(router, http.MethodPost, path+"/claim", gin.H{"staff_id": 3}); rec.Code != http.StatusConflict {
+		t.Errorf("claim of a held shift = %d, want 409", rec.Code)
+	}
+
+	if rec := doRequest(router, http.MethodPost, path+"/claim/reject", nil); rec.Code != http.StatusOK {
+		t.Fatalf("reject = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := doRequest(router, http.MethodPost, path+"/claim", gin.H{"staff_id": 3}); rec.Code != http.StatusAccepted {
+		t.Fatalf("claim after rejection = %d %s", rec.Code, rec.Body.String())
+	}
+	rec = doRequest(router, http.MethodPost, path+"/claim/confirm", nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("confirm = %d %s", rec.Code, rec.Body.String())
+	}
+	confirmed := decode[struct {
+		Shift      OpenShift
+		Assignment Assignment
+	}](t, rec)
+	if confirmed.Shift.Status != "awarded" || confirmed.Assignment.StaffID != 3 || confirmed.Assignment.BusID != 2 {
+		t.Errorf("confirmed = %+v, want staff 3's assignment on bus 2", confirmed)
+	}
+	if live, _ := store.Assignments.List(AssignmentFilter{StaffID: 3}); len(live) != 1 {
+		t.Errorf("staff 3's assignments = %+v, want the confirmed claim", live)
+	}
+}
+
+func TestClaimShiftDirectly(t *testing.T) {
+	useTravelClock(t).Set(date("2031-02-01"), true, "test")
+	router, _ := newShiftRouter(t)
+
+	shift := decode[OpenShift](t, doRequest(router, http.MethodPost, "/api/v1/shifts", gin.H{
+		"bus_id": 1, "role": "conductor", "start_date": "2031-03-03", "mode": "claim",
+	}))
+	path := "/api/v1/shifts/" + strconv.Itoa(shift.ID) + "/claim"
+
+	if rec := doRequest(router, http.MethodPost, path, gin.H{"staff_id": 1}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("driver's claim of a conductor shift = %d, want 422", rec.Code)
+	}
+	rec := doRequest(router, http.MethodPost, path, gin.H{"staff_id": 2})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("claim = %d %s, want 201", rec.Code, rec.Body.String())
+	}
+	if rec := doRequest(router, http.MethodPost, path, gin.H{"staff_id": 2}); rec.Code != http.StatusConflict {
+		t.Errorf("claim of an awarded shift = %d, want 409", rec.Code)
+	}
+}
+
+func TestShiftTakeUpAvailability(t *testing.T) {
+	travel := useTravelClock(t)
+	travel.Set(date("2031-02-01"), true, "test")
+	router, store := newShiftRouter(t)
+	rec := doRequest(router, http.MethodPost, "/api/v1/availability", gin.H{
+		"staff_id": 1, "type": "leave", "start_date": "2031-03-02", "end_date": "2031-03-04",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create availability = %d %s", rec.Code, rec.Body.String())
+	}
+
+	claiming := decode[OpenShift](t, doRequest(router, http.MethodPost, "/api/v1/shifts", gin.H{
+		"bus_id": 1, "role": "driver", "start_date": "2031-03-03", "end_date": "2031-03-03", "mode": "claim",
+	}))
+	path := "/api/v1/shifts/" + strconv.Itoa(claiming.ID) + "/claim"
+	rec = doRequest(router, http.MethodPost, path, gin.H{"staff_id": 1})
+	if rec.Code != http.StatusConflict || errorOf(t, rec).Rule != apierror.RuleStaffAvailability {
+		t.Errorf("claim while on leave = %d %s, want 409 staff_availability", rec.Code, rec.Body.String())
+	}
+
+	// In shadow mode the claim goes ahead
+	useShadowRules(t, map[string]time.Time{apierror.RuleStaffAvailability: {}})
+	if rec := doRequest(router, http.MethodPost, path, gin.H{"staff_id": 1}); rec.Code != http.StatusCreated {
+		t.Errorf("claim with the rule shadowed = %d %s, want 201", rec.Code, rec.Body.String())
+	}
+	useShadowRules(t, nil)
+
+	// The senior bidder is on leave, so the shift goes to the next one
+	bidding := decode[OpenShift](t, doRequest(router, http.MethodPost, "/api/v1/shifts", gin.H{
+		"bus_id": 2, "role": "driver", "start_date": "2031-03-04", "end_date": "2031-03-04",
+		"bidding_closes_at": "2031-02-10T00:00:00Z",
+	}))
+	bids := "/api/v1/shifts/" + strconv.Itoa(bidding.ID) + "/bids"
+	for _, staffID := range []int{1, 3} {
+		if rec := doRequest(router, http.MethodPost, bids, gin.H{"staff_id": staffID}); rec.Code != http.StatusCreated {
+			t.Fatalf("bid for staff %d = %d %s", staffID, rec.Code, rec.Body.String())
+		}
+	}
+	travel.Set(date("2031-02-11"), true, "test")
+	if err := NewShiftAwarder(store.Shifts, store.Availability, store.Qualifications).awardDueShifts(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	awarded, _ := store.Shifts.Get(bidding.ID)
+	if awarded.Status != "awarded" || *awarded.AwardedStaffID != 3 {
+		t.Errorf("shift = %+v, want it awarded to staff 3", awarded)
+	}
+}
+
+func TestShiftTakeUpQualifications(t *testing.T) {
+	useQualificationPolicy(t, QualificationBlock)
+	travel := useTravelClock(t)
+	travel.Set(date("2031-02-01"), true, "test")
+	router, store := newShiftRouter(t)
+	if rec := doRequest(router, http.MethodPut, "/api/v1/staff/3/qualifications/D", gin.H{"license_number": "DL-3"}); rec.Code != http.StatusOK {
+		t.Fatalf("put qualification = %d %s", rec.Code, rec.Body.String())
+	}
+
+	claiming := decode[OpenShift](t, doRequest(router, http.MethodPost, "/api/v1/shifts", gin.H{
+		"bus_id": 1, "role": "driver", "start_date": "2031-03-03", "end_date": "2031-03-03", "mode": "claim",
+		"requires_confirmation": true,
+	}))
+	path := "/api/v1/shifts/" + strconv.Itoa(claiming.ID) + "/claim"
+	rec := doRequest(router, http.MethodPost, path, gin.H{"staff_id": 1})
+	if rec.Code != http.StatusConflict || errorOf(t, rec).Rule != apierror.RuleStaffQualification {
+		t.Errorf("claim without a license = %d %s, want 409 staff_qualification", rec.Code, rec.Body.String())
+	}
+	if got := decode[struct{ Qualification QualificationProblem }](t, rec).Qualification; got.Reason != QualificationMissing {
+		t.Errorf("qualification = %+v, want the missing class", got)
+	}
+
+	// A license lapsing after the claim is held stops its confirmation
+	if rec := doRequest(router, http.MethodPost, path, gin.H{"staff_id": 3}); rec.Code != http.StatusAccepted {
+		t.Fatalf("claim = %d %s, want 202", rec.Code, rec.Body.String())
+	}
+	doRequest(router, http.MethodPut, "/api/v1/staff/3/qualifications/D", gin.H{"license_number": "DL-3", "expires_on": "2031-03-01"})
+	rec = doRequest(router, http.MethodPost, path+"/confirm", nil)
+	if rec.Code != http.StatusConflict || errorOf(t, rec).Rule != apierror.RuleStaffQualification {
+		t.Errorf("confirm after the license lapsed = %d %s, want 409 staff_qualification", rec.Code, rec.Body.String())
+	}
+	doRequest(router, http.MethodPut, "/api/v1/staff/3/qualifications/D", gin.H{"license_number": "DL-3"})
+
+	// The senior bidder is unlicensed, so the shift goes to the next one
+	bidding := decode[OpenShift](t, doRequest(router, http.MethodPost, "/api/v1/shifts", gin.H{
+		"bus_id": 2, "role": "driver", "start_date": "2031-03-04", "end_date": "2031-03-04",
+		"bidding_closes_at": "2031-02-10T00:00:00Z",
+	}))
+	bids := "/api/v1/shifts/" + strconv.Itoa(bidding.ID) + "/bids"
+	for _, staffID := range []int{1, 3} {
+		if rec := doRequest(router, http.MethodPost, bids, gin.H{"staff_id": staffID}); rec.Code != http.StatusCreated {
+			t.Fatalf("bid for staff %d = %d %s", staffID, rec.Code, rec.Body.String())
+		}
+	}
+	travel.Set(date("2031-02-11"), true, "test")
+	if err := NewShiftAwarder(store.Shifts, store.Availability, store.Qualifications).awardDueShifts(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	awarded, _ := store.Shifts.Get(bidding.ID)
+	if awarded.Status != "awarded" || *awarded.AwardedStaffID != 3 {
+		t.Errorf("shift = %+v, want it awarded to staff 3", awarded)
+	}
+}
@@ -0,0 +1,2335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryAssignmentRepository keeps assignments in process memory. It applies
+// the same conflict rules as PostgreSQL but publishes no events, and is meant
+// for tests and local experiments.
+type memoryAssignmentRepository struct {
+	mu          sync.Mutex
+	assignments map[int]Assignment
+	audit       []AuditEntry
+	deletions   map[string]DeletionHold
+	nextID      int
+}
+
+// NewMemoryAssignmentRepository creates an empty in-memory repository
+func NewMemoryAssignmentRepository() AssignmentRepository {
+	return &memoryAssignmentRepository{assignments: map[int]Assignment{}, deletions: map[string]DeletionHold{}, nextID: 1}
+}
+
+// WithContext returns the repository itself, as nothing it does can be cancelled
+func (r *memoryAssignmentRepository) WithContext(context.Context) AssignmentRepository {
+	return r
+}
+
+// Create stores a new assignment and records its audit entry
+func (r *memoryAssignmentRepository) Create(assignment *Assignment, actor string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.create(assignment, actor)
+}
+
+// create stores a new assignment; callers hold the lock
+func (r *memoryAssignmentRepository) create(assignment *Assignment, actor string) error {
+	if err := r.checkDeletionHolds(nil, assignment); err != nil {
+		return err
+	}
+	now := time.Now()
+	publicID, err := newULID(now)
+	if err != nil {
+		return err
+	}
+	assignment.ID = r.nextID
+	assignment.PublicID = publicID
+	assignment.CreatedAt = now
+	assignment.UpdatedAt = now
+	assignment.Reference = assignmentReference(assignment.ID, now)
+	assignment.DepotID = busDepot(assignment.BusID)
+	assignment.Version = 1
+	r.nextID++
+
+	r.assignments[assignment.ID] = *assignment
+	return r.recordAudit(assignment.ID, AuditActionCreate, actor, nil, assignment)
+}
+
+// Get retrieves an assignment by ID
+func (r *memoryAssignmentRepository) Get(id int) (*Assignment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	assignment, exists := r.assignments[id]
+	if !exists || assignment.DeletedAt != nil {
+		return nil, nil // Assignment not found
+	}
+	return &assignment, nil
+}
+
+// GetByPublicID retrieves an assignment by its public ID
+func (r *memoryAssignmentRepository) GetByPublicID(publicID string, includeDeleted bool) (*Assignment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, assignment := range r.assignments {
+		if assignment.PublicID == publicID && (includeDeleted || assignment.DeletedAt == nil) {
+			return &assignment, nil
+		}
+	}
+	return nil, nil // Assignment not found
+}
+
+// Update replaces an existing assignment and records its audit entry
+func (r *memoryAssignmentRepository) Update(assignment *Assignment, actor string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.update(assignment, actor)
+}
+
+// update replaces an assignment; callers hold the lock
+func (r *memoryAssignmentRepository) update(assignment *Assignment, actor string) error {
+	before, exists := r.assignments[assignment.ID]
+	if !exists {
+		return fmt.Errorf("assignment %d not found", assignment.ID)
+	}
+	if before.Version != assignment.Version {
+		return errStaleVersion
+	}
+	if err := r.checkDeletionHolds(&before, assignment); err != nil {
+		return err
+	}
+
+	assignment.PublicID = before.PublicID
+	assignment.Reference = before.Reference
+	assignment.DepotID = busDepot(assignment.BusID)
+	assignment.Version++
+	assignment.CreatedAt = before.CreatedAt
+	assignment.UpdatedAt = time.Now()
+	r.assignments[assignment.ID] = *assignment
+
+	action := AuditActionUpdate
+	if before.Status != assignment.Status {
+		action = AuditActionStatusChange
+	}
+	return r.recordAudit(assignment.ID, action, actor, &before, assignment)
+}
+
+// Delete soft-deletes an assignment by ID and records its audit entry
+func (r *memoryAssignmentRepository) Delete(id, version int, actor string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.remove(id, version, actor)
+}
+
+// remove soft-deletes an assignment; callers hold the lock
+func (r *memoryAssignmentRepository) remove(id, version int, actor string) error {
+	before, exists := r.assignments[id]
+	if !exists {
+		return fmt.Errorf("assignment %d not found", id)
+	}
+	if before.Version != version || before.DeletedAt != nil {
+		return errStaleVersion
+	}
+
+	deleted := before
+	now := time.Now()
+	deleted.DeletedAt = &now
+	deleted.Version++
+	deleted.UpdatedAt = now
+	r.assignments[id] = deleted
+	return r.recordAudit(id, AuditActionDelete, actor, &before, nil)
+}
+
+// Restore undoes a soft delete and records its audit entry
+func (r *memoryAssignmentRepository) Restore(assignment *Assignment, actor string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before, exists := r.assignments[assignment.ID]
+	if !exists {
+		return fmt.Errorf("assignment %d not found", assignment.ID)
+	}
+	if before.Version != assignment.Version || before.DeletedAt == nil {
+		return errStaleVersion
+	}
+	if err := r.checkDeletionHolds(nil, &before); err != nil {
+		return err
+	}
+
+	*assignment = before
+	assignment.DeletedAt = nil
+	assignment.Version++
+	assignment.UpdatedAt = time.Now()
+	r.assignments[assignment.ID] = *assignment
+	return r.recordAudit(assignment.ID, AuditActionRestore, actor, &before, assignment)
+}
+
+// List retrieves assignments matching the filter in the filter's sort order
+func (r *memoryAssignmentRepository) List(filter AssignmentFilter) ([]Assignment, error) {
+	column, descending := filter.sortColumn()
+	if !assignmentSortColumns[column] {
+		return nil, fmt.Errorf("unsupported sort column %q", column)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var assignments []Assignment
+	for _, assignment := range r.assignments {
+		if filter.Matches(&assignment) {
+			assignments = append(assignments, assignment)
+		}
+	}
+	sortAssignments(assignments, column, descending)
+	return assignments, nil
+}
+
+// sortAssignments orders assignments by a sort column as the SQL listing
+// does, breaking ties by ID
+func sortAssignments(assignments []Assignment, column string, descending bool) {
+	sort.Slice(assignments, func(i, j int) bool {
+		a, b := assignments[i], assignments[j]
+		if column == "end_date" && (a.EndDate == nil) != (b.EndDate == nil) {
+			return b.EndDate == nil // open-ended last, as NULLS LAST does in SQL
+		}
+		if cmp := compareAssignments(&a, &b, column); cmp != 0 {
+			if descending {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		if descending {
+			return a.ID > b.ID
+		}
+		return a.ID < b.ID
+	})
+}
+
+// ExportSnapshot lists under one lock, which is the memory repository's snapshot
+func (r *memoryAssignmentRepository) ExportSnapshot(filter AssignmentFilter, fn func(asOf time.Time, page []Assignment) error) error {
+	asOf := time.Now()
+	assignments, err := r.List(filter)
+	if err != nil {
+		return err
+	}
+	for start := 0; start == 0 || start < len(assignments); start += exportPageSize {
+		if err := fn(asOf, assignments[start:min(start+exportPageSize, len(assignments))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compareAssignments orders two assignments by a sort column
+func compareAssignments(a, b *Assignment, column string) int {
+	switch column {
+	case "created_at":
+		return a.CreatedAt.Compare(b.CreatedAt)
+	case "updated_at":
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	case "start_date":
+		return a.StartDate.Compare(b.StartDate)
+	case "end_date":
+		if a.EndDate == nil || b.EndDate == nil {
+			return 0
+		}
+		return a.EndDate.Compare(*b.EndDate)
+	case "bus_id":
+		return a.BusID - b.BusID
+	case "staff_id":
+		return a.StaffID - b.StaffID
+	}
+	return 0
+}
+
+// ListByBus retrieves all assignments for a specific bus visible with the clearance
+func (r *memoryAssignmentRepository) ListByBus(busID int, clearance *Clearance) ([]Assignment, error) {
+	return r.List(AssignmentFilter{BusID: busID, Clearance: clearance})
+}
+
+// ListByStaff retrieves all assignments for a specific staff member visible
+// with the clearance
+func (r *memoryAssignmentRepository) ListByStaff(staffID int, clearance *Clearance) ([]Assignment, error) {
+	return r.List(AssignmentFilter{StaffID: staffID, Clearance: clearance})
+}
+
+// ListInRange retrieves assignments visible with the clearance that are not
+// cancelled and overlap the date range, optionally on one bus, ordered by
+// bus, shift start, role and start date
+func (r *memoryAssignmentRepository) ListInRange(from, to time.Time, busID int, clearance *Clearance) ([]Assignment, error) {
+	candidates, err := r.List(AssignmentFilter{BusID: busID, Clearance: clearance})
+	if err != nil {
+		return nil, err
+	}
+	return inRange(candidates, from, to), nil
+}
+
+// FindConflicts returns active assignments that would clash with the given
+// one, using the same slot and staff rules as the SQL implementation
+func (r *memoryAssignmentRepository) FindConflicts(assignment *Assignment) ([]Assignment, error) {
+	candidates, err := r.List(AssignmentFilter{Status: "active"})
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []Assignment
+	for _, candidate := range candidates {
+		if candidate.ID != assignment.ID && assignment.ConflictsWith(&candidate) {
+			conflicts = append(conflicts, candidate)
+		}
+	}
+
+	sort.SliceStable(conflicts, func(i, j int) bool { return conflicts[i].StartDate.Before(conflicts[j].StartDate) })
+	return conflicts, nil
+}
+
+// ApplyChanges writes the batch in the same order as PostgreSQL, putting
+// everything back if any write is refused
+func (r *memoryAssignmentRepository) ApplyChanges(changes *AssignmentChanges, actor string) error {
+	return r.transact(func(assignmentTx) error {
+		return r.applyChanges(changes, actor)
+	})
+}
+
+// transact runs fn under the lock, putting everything back unless it returns nil
+func (r *memoryAssignmentRepository) transact(fn func(tx assignmentTx) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	assignments, audited, nextID := maps.Clone(r.assignments), len(r.audit), r.nextID
+	if err := fn(r); err != nil {
+		r.assignments, r.audit, r.nextID = assignments, r.audit[:audited], nextID
+		return err
+	}
+	return nil
+}
+
+// ReassignBus moves the bus's crew under one lock
+func (r *memoryAssignmentRepository) ReassignBus(fromBusID, toBusID int, fromDate time.Time, actor string,
+	guard *bulkGuard) (*ReassignResult, error) {
+	var result *ReassignResult
+	err := r.transact(func(tx assignmentTx) error {
+		var err error
+		result, err = reassignBus(tx, fromBusID, toBusID, fromDate, actor, guard)
+		return err
+	})
+	return result, err
+}
+
+// TransferStaff moves the staff member to the depot under one lock
+func (r *memoryAssignmentRepository) TransferStaff(staffID int, toDepot string, transferDate time.Time,
+	copyAssignments bool, actor string, guard *bulkGuard) (*TransferResult, error) {
+	var result *TransferResult
+	err := r.transact(func(tx assignmentTx) error {
+		var err error
+		result, err = transferStaff(tx, staffID, toDepot, transferDate, copyAssignments, actor, guard)
+		return err
+	})
+	return result, err
+}
+
+// Import creates the rows under one lock
+func (r *memoryAssignmentRepository) Import(rows []ImportRow, actor string, check importCheck) ([]Assignment,
+	[]ImportRowError, error) {
+	var created []Assignment
+	err := r.transact(func(tx assignmentTx) error {
+		var err error
+		created, err = importAssignments(tx, rows, actor, check)
+		return err
+	})
+	return importOutcome(created, err)
+}
+
+// runningFrom lists what a bus or staff member is running from the date;
+// callers hold the lock
+func (r *memoryAssignmentRepository) runningFrom(busID, staffID int, from time.Time) ([]Assignment, error) {
+	var running []Assignment
+	for _, assignment := range r.assignments {
+		if assignment.Status == "active" && assignment.DeletedAt == nil &&
+			(busID == 0 || assignment.BusID == busID) && (staffID == 0 || assignment.StaffID == staffID) &&
+			(assignment.EndDate == nil || !assignment.EndDate.Before(from)) {
+			running = append(running, assignment)
+		}
+	}
+	sort.Slice(running, func(i, j int) bool {
+		if !running[i].StartDate.Equal(running[j].StartDate) {
+			return running[i].StartDate.Before(running[j].StartDate)
+		}
+		return running[i].ID < running[j].ID
+	})
+	return running, nil
+}
+
+// conflicts is FindConflicts for callers holding the lock
+func (r *memoryAssignmentRepository) conflicts(assignment *Assignment) ([]Assignment, error) {
+	var conflicts []Assignment
+	for _, candidate := range r.assignments {
+		if candidate.Status == "active" && candidate.DeletedAt == nil && candidate.ID != assignment.ID &&
+			assignment.ConflictsWith(&candidate) {
+			conflicts = append(conflicts, candidate)
+		}
+	}
+	sort.SliceStable(conflicts, func(i, j int) bool { return conflicts[i].StartDate.Before(conflicts[j].StartDate) })
+	return conflicts, nil
+}
+
+// deletionHeld returns the hold stopping the assignment being created;
+// callers hold the lock
+func (r *memoryAssignmentRepository) deletionHeld(assignment *Assignment) (*DeletionHold, error) {
+	now := clock.Now()
+	if hold := r.blockingDeletion(DeletionResourceStaff, assignment.StaffID, now); hold != nil {
+		return hold, nil
+	}
+	return r.blockingDeletion(DeletionResourceBus, assignment.BusID, now), nil
+}
+
+// byRef finds assignments by reference or external_ref; callers hold the lock
+func (r *memoryAssignmentRepository) byRef(ref string) ([]Assignment, error) {
+	filter := AssignmentFilter{Ref: ref}
+	var found []Assignment
+	for _, assignment := range r.assignments {
+		if filter.Matches(&assignment) {
+			found = append(found, assignment)
+		}
+	}
+	return found, nil
+}
+
+// applyChanges writes the batch; callers hold the lock
+func (r *memoryAssignmentRepository) applyChanges(changes *AssignmentChanges, actor string) error {
+	for _, assignment := range changes.Delete {
+		if err := r.remove(assignment.ID, assignment.Version, actor); err != nil {
+			return err
+		}
+	}
+	for i := range changes.Update {
+		if err := r.update(&changes.Update[i], actor); err != nil {
+			return err
+		}
+	}
+	for i := range changes.Create {
+		if err := r.create(&changes.Create[i], actor); err != nil {
+			return err
+		}
+	}
+
+	for _, assignment := range changes.written() {
+		if assignment.Status != "active" {
+			continue
+		}
+		conflicts, err := r.conflicts(assignment)
+		if err != nil {
+			return err
+		}
+		if len(conflicts) > 0 {
+			return &ConflictError{Assignment: *assignment, Conflicts: conflicts}
+		}
+	}
+	return nil
+}
+
+// CompleteExpired marks active assignments that ended before today as
+// completed and records their audit entries
+func (r *memoryAssignmentRepository) CompleteExpired(today time.Time, actor string) ([]Assignment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var expired []Assignment
+	for _, assignment := range r.assignments {
+		if assignment.Status == "active" && assignment.DeletedAt == nil && assignment.EndDate != nil &&
+			assignment.EndDate.Before(today) {
+			expired = append(expired, assignment)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i].ID < expired[j].ID })
+
+	for i := range expired {
+		expired[i].Status = "completed"
+		if err := r.update(&expired[i], actor); err != nil {
+			return nil, err
+		}
+	}
+	return expired, nil
+}
+
+// workedDays calls fn for each date an assignment that isn't cancelled or
+// deleted is worked in the period
+func (r *memoryAssignmentRepository) workedDays(from, to time.Time, fn func(assignment *Assignment, day time.Time)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, assignment := range r.assignments {
+		if assignment.Status == "cancelled" || assignment.DeletedAt != nil {
+			continue
+		}
+		for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+			if assignment.WorksOn(day) {
+				fn(&assignment, day)
+			}
+		}
+	}
+}
+
+// StaffWorkload aggregates each staff member's worked days and hours in the period
+func (r *memoryAssignmentRepository) StaffWorkload(from, to time.Time) ([]StaffWorkload, error) {
+	type tally struct {
+		workload           StaffWorkload
+		assignments, buses map[int]bool
+		days               map[time.Time]bool
+	}
+	tallies := map[int]*tally{}
+	r.workedDays(from, to, func(assignment *Assignment, day time.Time) {
+		t := tallies[assignment.StaffID]
+		if t == nil {
+			t = &tally{workload: StaffWorkload{StaffID: assignment.StaffID}, assignments: map[int]bool{},
+				buses: map[int]bool{}, days: map[time.Time]bool{}}
+			tallies[assignment.StaffID] = t
+		}
+		t.workload.AssignmentDays++
+		t.workload.WorkedHours += assignment.ShiftLength().Hours()
+		t.assignments[assignment.ID] = true
+		t.buses[assignment.BusID] = true
+		t.days[day] = true
+	})
+
+	var workloads []StaffWorkload
+	for _, t := range tallies {
+		t.workload.Assignments = len(t.assignments)
+		t.workload.Buses = len(t.buses)
+		t.workload.WorkedDays = len(t.days)
+		workloads = append(workloads, t.workload)
+	}
+	sort.Slice(workloads, func(i, j int) bool { return workloads[i].StaffID < workloads[j].StaffID })
+	return workloads, nil
+}
+
+// BusDayCrews aggregates the roles assigned on each bus on each date of the period
+func (r *memoryAssignmentRepository) BusDayCrews(from, to time.Time) ([]BusDayCrew, error) {
+	type busDay struct {
+		busID int
+		day   time.Time
+	}
+	roles := map[busDay]map[string]bool{}
+	r.workedDays(from, to, func(assignment *Assignment, day time.Time) {
+		key := busDay{assignment.BusID, day}
+		if roles[key] == nil {
+			roles[key] = map[string]bool{}
+		}
+		roles[key][assignment.Role] = true
+	})
+
+	var crews []BusDayCrew
+	for key, set := range roles {
+		crew := BusDayCrew{BusID: key.busID, Date: key.day}
+		for role := range set {
+			crew.Roles = append(crew.Roles, role)
+		}
+		sort.Strings(crew.Roles)
+		crews = append(crews, crew)
+	}
+	sort.Slice(crews, func(i, j int) bool {
+		if crews[i].BusID != crews[j].BusID {
+			return crews[i].BusID < crews[j].BusID
+		}
+		return crews[i].Date.Before(crews[j].Date)
+	})
+	return crews, nil
+}
+
+// History retrieves the audit trail for an assignment visible with the
+// clearance, oldest first
+func (r *memoryAssignmentRepository) History(publicID string, clearance *Clearance) ([]AuditEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var entries []AuditEntry
+	for _, entry := range r.audit {
+		if entry.PublicID == publicID && r.auditVisible(&entry, clearance) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// ListAsOf rebuilds the assignments matching the filter as their last audit
+// entry at or before the time left them, leaving out ones deleted by then
+func (r *memoryAssignmentRepository) ListAsOf(at time.Time, filter AsOfFilter) ([]Assignment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	latest := map[int]json.RawMessage{}
+	for _, entry := range r.audit {
+		if !entry.ChangedAt.After(at) {
+			latest[entry.AssignmentID] = entry.After
+		}
+	}
+	var assignments []Assignment
+	for _, id := range slices.Sorted(maps.Keys(latest)) {
+		if latest[id] == nil {
+			continue
+		}
+		assignment, err := auditRevision(id, latest[id])
+		if err != nil {
+			return nil, err
+		}
+		if filter.Matches(&assignment) {
+			assignments = append(assignments, assignment)
+		}
+	}
+	return assignments, nil
+}
+
+// auditVisible reports whether an audit entry's assignment, as it is now, is
+// visible with the clearance; callers hold the lock
+func (r *memoryAssignmentRepository) auditVisible(entry *AuditEntry, clearance *Clearance) bool {
+	assignment, exists := r.assignments[entry.AssignmentID]
+	return !exists || clearance.Allows(&assignment)
+}
+
+// Activity retrieves audit entries across all assignments, newest first
+func (r *memoryAssignmentRepository) Activity(filter ActivityFilter) ([]AuditEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var buses map[int]bool
+	if filter.BusIDs != nil {
+		buses = map[int]bool{}
+		for _, id := range filter.BusIDs {
+			buses[id] = true
+		}
+	}
+
+	var entries []AuditEntry
+	for i := len(r.audit) - 1; i >= 0 && len(entries) < filter.Limit; i-- {
+		entry := r.audit[i]
+		if entry.ChangedAt.Before(filter.Since) || !r.auditVisible(&entry, filter.Clearance) {
+			continue
+		}
+		if buses != nil {
+			before, err := decodeSnapshot(entry.Before)
+			if err != nil {
+				return nil, err
+			}
+			after, err := decodeSnapshot(entry.After)
+			if err != nil {
+				return nil, err
+			}
+			if !(before != nil && buses[before.BusID]) && !(after != nil && buses[after.BusID]) {
+				continue
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// PrepareDeletion records a prepared deletion hold
+func (r *memoryAssignmentRepository) PrepareDeletion(hold *DeletionHold, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing := r.blockingDeletion(hold.Resource, hold.ResourceID, now); existing != nil {
+		return &DeletionHoldError{Hold: *existing}
+	}
+	if active := r.activeForDeletion(hold, truncateDate(now)); len(active) > 0 && !hold.Cascade {
+		return &DeletionBlockedError{Active: active}
+	}
+
+	hold.CreatedAt = now
+	hold.UpdatedAt = now
+	r.deletions[hold.ID] = *hold
+	return nil
+}
+
+// GetDeletion retrieves a deletion hold by ID
+func (r *memoryAssignmentRepository) GetDeletion(id string) (*DeletionHold, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hold, exists := r.deletions[id]
+	if !exists {
+		return nil, nil
+	}
+	return &hold, nil
+}
+
+// BlockingDeletion retrieves the hold stopping new assignments for a resource
+func (r *memoryAssignmentRepository) BlockingDeletion(resource string, resourceID int) (*DeletionHold, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.blockingDeletion(resource, resourceID, clock.Now()), nil
+}
+
+// ConfirmDeletion settles the resource's remaining assignments and marks the hold confirmed
+func (r *memoryAssignmentRepository) ConfirmDeletion(id, actor string, now time.Time) (*DeletionResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hold, exists := r.deletions[id]
+	if !exists || hold.Status != DeletionPrepared || hold.Expired(now) {
+		return nil, errDeletionClosed
+	}
+
+	today := truncateDate(now)
+	active := r.activeForDeletion(&hold, today)
+	if len(active) > 0 && !hold.Cascade {
+		return nil, &DeletionBlockedError{Active: active}
+	}
+
+	result := &DeletionResult{Cancelled: []Assignment{}, Ended: []Assignment{}}
+	for _, assignment := range active {
+		cancelled := settleForDeletion(&assignment, today)
+		if err := r.update(&assignment, actor); err != nil {
+			return nil, err
+		}
+		if cancelled {
+			result.Cancelled = append(result.Cancelled, assignment)
+		} else {
+			result.Ended = append(result.Ended, assignment)
+		}
+	}
+
+	hold.Status = DeletionConfirmed
+	hold.UpdatedAt = now
+	r.deletions[id] = hold
+	result.Deletion = hold
+	return result, nil
+}
+
+// AbortDeletion releases a hold that hasn't been confirmed
+func (r *memoryAssignmentRepository) AbortDeletion(id string) (*DeletionHold, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hold, exists := r.deletions[id]
+	if !exists || hold.Status == DeletionConfirmed {
+		return nil, errDeletionClosed
+	}
+	hold.Status = DeletionAborted
+	hold.UpdatedAt = time.Now()
+	r.deletions[id] = hold
+	return &hold, nil
+}
+
+// blockingDeletion returns the hold stopping new assignments for a resource;
+// callers hold the lock
+func (r *memoryAssignmentRepository) blockingDeletion(resource string, resourceID int, now time.Time) *DeletionHold {
+	for _, hold := range r.deletions {
+		if hold.Resource == resource && hold.ResourceID == resourceID && hold.Blocks(now) {
+			return &hold
+		}
+	}
+	return nil
+}
+
+// checkDeletionHolds mirrors checkDeletionHoldsTx; callers hold the lock
+func (r *memoryAssignmentRepository) checkDeletionHolds(before, after *Assignment) error {
+	staffID, busID := newlyReferenced(before, after)
+	now := clock.Now()
+	if hold := r.blockingDeletion(DeletionResourceStaff, staffID, now); hold != nil {
+		return &DeletionHoldError{Hold: *hold}
+	}
+	if hold := r.blockingDeletion(DeletionResourceBus, busID, now); hold != nil {
+		return &DeletionHoldError{Hold: *hold}
+	}
+	return nil
+}
+
+// activeForDeletion returns the running and upcoming assignments for the
+// hold's resource by start date; callers hold the lock
+func (r *memoryAssignmentRepository) activeForDeletion(hold *DeletionHold, today time.Time) []Assignment {
+	var active []Assignment
+	for _, assignment := range r.assignments {
+		if assignment.DeletedAt == nil && hold.references(&assignment) && blocksDeletion(&assignment, today) {
+			active = append(active, assignment)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].StartDate.Before(active[j].StartDate) })
+	return active
+}
+
+// recordAudit appends an audit entry; callers hold the lock
+func (r *memoryAssignmentRepository) recordAudit(assignmentID int, action, actor string, before, after *Assignment) error {
+	entry := AuditEntry{
+		ID:           int64(len(r.audit) + 1),
+		AssignmentID: assignmentID,
+		PublicID:     snapshotPublicID(before, after),
+		Action:       action,
+		Actor:        actor,
+		ChangedAt:    time.Now(),
+	}
+
+	var err error
+	if before != nil {
+		if entry.Before, err = json.Marshal(before); err != nil {
+			return err
+		}
+	}
+	if after != nil {
+		if entry.After, err = json.Marshal(after); err != nil {
+			return err
+		}
+	}
+
+	r.audit = append(r.audit, entry)
+	return nil
+}
+
+// memoryViewRepository keeps saved views in process memory for tests
+type memoryViewRepository struct {
+	mu     sync.Mutex
+	views  map[string]map[string]SavedView // owner, then name
+	nextID int
+}
+
+// NewMemoryViewRepository creates an empty in-memory view repository
+func NewMemoryViewRepository() ViewRepository {
+	return &memoryViewRepository{views: map[string]map[string]SavedView{}, nextID: 1}
+}
+
+// WithContext returns the repository itself, as nothing it does can be cancelled
+func (r *memoryViewRepository) WithContext(context.Context) ViewRepository {
+	return r
+}
+
+// Save creates the view or replaces the filter of the owner's view with the same name
+func (r *memoryViewRepository) Save(view *SavedView) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	owned := r.views[view.Owner]
+	if owned == nil {
+		owned = map[string]SavedView{}
+		r.views[view.Owner] = owned
+	}
+
+	now := time.Now()
+	if existing, exists := owned[view.Name]; exists {
+		view.ID = existing.ID
+		view.CreatedAt = existing.CreatedAt
+	} else {
+		view.ID = r.nextID
+		view.CreatedAt = now
+		r.nextID++
+	}
+	view.UpdatedAt = now
+
+	owned[view.Name] = *view
+	return nil
+}
+
+// Get retrieves one of the owner's views by name
+func (r *memoryViewRepository) Get(owner, name string) (*SavedView, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	view, exists := r.views[owner][name]
+	if !exists {
+		return nil, nil // View not found
+	}
+	return &view, nil
+}
+
+// List retrieves the owner's views ordered by name
+func (r *memoryViewRepository) List(owner string) ([]SavedView, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var views []SavedView
+	for _, view := range r.views[owner] {
+		views = append(views, view)
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+	return views, nil
+}
+
+// Delete removes one of the owner's views, reporting whether it existed
+func (r *memoryViewRepository) Delete(owner, name string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.views[owner][name]; !exists {
+		return false, nil
+	}
+	delete(r.views[owner], name)
+	return true, nil
+}
+
+// memoryAvailabilityRepository keeps availability periods in process memory for tests
+type memoryAvailabilityRepository struct {
+	mu      sync.Mutex
+	periods map[int]AvailabilityPeriod
+	nextID  int
+}
+
+// NewMemoryAvailabilityRepository creates an empty in-memory availability repository
+func NewMemoryAvailabilityRepository() AvailabilityRepository {
+	return &memoryAvailabilityRepository{periods: map[int]AvailabilityPeriod{}, nextID: 1}
+}
+
+// WithContext returns the repository itself, as nothing it does can be cancelled
+func (r *memoryAvailabilityRepository) WithContext(context.Context) AvailabilityRepository {
+	return r
+}
+
+// Create inserts a new availability period
+func (r *memoryAvailabilityRepository) Create(period *AvailabilityPeriod) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	period.ID = r.nextID
+	period.CreatedAt = now
+	period.UpdatedAt = now
+	r.nextID++
+
+	r.periods[period.ID] = *period
+	return nil
+}
+
+// Get retrieves an availability period by ID
+func (r *memoryAvailabilityRepository) Get(id int) (*AvailabilityPeriod, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	period, exists := r.periods[id]
+	if !exists {
+		return nil, nil // Period not found
+	}
+	return &period, nil
+}
+
+// Update replaces an availability period's staff member, type, dates and note
+func (r *memoryAvailabilityRepository) Update(period *AvailabilityPeriod) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, exists := r.periods[period.ID]
+	if !exists {
+		return fmt.Errorf("availability period %d not found", period.ID)
+	}
+	period.CreatedBy = existing.CreatedBy
+	period.CreatedAt = existing.CreatedAt
+	period.UpdatedAt = time.Now()
+
+	r.periods[period.ID] = *period
+	return nil
+}
+
+// Delete removes an availability period, reporting whether it existed
+func (r *memoryAvailabilityRepository) Delete(id int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.periods[id]; !exists {
+		return false, nil
+	}
+	delete(r.periods, id)
+	return true, nil
+}
+
+// List retrieves availability periods matching the filter ordered by start date
+func (r *memoryAvailabilityRepository) List(filter AvailabilityFilter) ([]AvailabilityPeriod, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var periods []AvailabilityPeriod
+	for _, period := range r.periods {
+		if filter.Matches(&period) {
+			periods = append(periods, period)
+		}
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		if !periods[i].StartDate.Equal(periods[j].StartDate) {
+			return periods[i].StartDate.Before(periods[j].StartDate)
+		}
+		return periods[i].ID < periods[j].ID
+	})
+	return periods, nil
+}
+
+// memoryQualificationRepository keeps staff qualifications in process memory for tests
+type memoryQualificationRepository struct {
+	mu             sync.Mutex
+	qualifications map[int]map[string]StaffQualification // staff ID → class → qualification
+}
+
+// NewMemoryQualificationRepository creates an empty in-memory qualification repository
+func NewMemoryQualificationRepository() QualificationRepository {
+	return &memoryQualificationRepository{qualifications: map[int]map[string]StaffQualification{}}
+}
+
+// WithContext returns the repository itself, as nothing it does can be cancelled
+func (r *memoryQualificationRepository) WithContext(context.Context) QualificationRepository {
+	return r
+}
+
+// Put creates or replaces a staff member's qualification in its class
+func (r *memoryQualificationRepository) Put(qualification *StaffQualification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.qualifications[qualification.StaffID] == nil {
+		r.qualifications[qualification.StaffID] = map[string]StaffQualification{}
+	}
+	qualification.UpdatedAt = time.Now()
+	r.qualifications[qualification.StaffID][qualification.Class] = *qualification
+	return nil
+}
+
+// Delete removes a staff member's qualification, reporting whether it existed
+func (r *memoryQualificationRepository) Delete(staffID int, class string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, exists := r.qualifications[staffID][class]
+	delete(r.qualifications[staffID], class)
+	return exists, nil
+}
+
+// List retrieves a staff member's qualifications ordered by class
+func (r *memoryQualificationRepository) List(staffID int) ([]StaffQualification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var qualifications []StaffQualification
+	for _, qualification := range r.qualifications[staffID] {
+		qualifications = append(qualifications, qualification)
+	}
+	sort.Slice(qualifications, func(i, j int) bool { return qualifications[i].Class < qualifications[j].Class })
+	return qualifications, nil
+}
+
+// memoryPublicationRepository keeps roster publications in process memory for tests
+type memoryPublicationRepository struct {
+	mu           sync.Mutex
+	publications map[string]RosterPublication
+}
+
+// NewMemoryPublicationRepository creates an empty in-memory publication repository
+func NewMemoryPublicationRepository() PublicationRepository {
+	return &memoryPublicationRepository{publications: map[string]RosterPublication{}}
+}
+
+// WithContext returns the repository itself, as nothing it does can be cancelled
+func (r *memoryPublicationRepository) WithContext(context.Context) PublicationRepository {
+	return r
+}
+
+// unfinished reports whether a publication's saga is still running or being compensated
+func unfinished(status string) bool {
+	return status == PublicationPublishing || status == PublicationCompensating ||
+		status == PublicationCompensationFailed
+}
+
+// copyPublication detaches the steps so callers can't change stored state
+func copyPublication(publication RosterPublication) *RosterPublication {
+	publication.Steps = append([]SagaStep{}, publication.Steps...)
+	return &publication
+}
+
+// Create stores a new publication unless the period has an unfinished one
+func (r *memoryPublicationRepository) Create(publication *RosterPublication) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.publications {
+		if existing.From.Equal(publication.From) && existing.To.Equal(publication.To) && unfinished(existing.Status) {
+			return errPublicationInProgress
+		}
+	}
+	now := time.Now()
+	publication.CreatedAt = now
+	publication.UpdatedAt = now
+	r.publications[publication.ID] = *copyPublication(*publication)
+	return nil
+}
+
+// Get retrieves a publication by ID
+func (r *memoryPublicationRepository) Get(id string) (*RosterPublication, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	publication, exists := r.publications[id]
+	if !exists {
+		return nil, nil // Publication not found
+	}
+	return copyPublication(publication), nil
+}
+
+// Current retrieves the published roster for the period
+func (r *memoryPublicationRepository) Current(from, to time.Time) (*RosterPublication, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, publication := range r.publications {
+		if publication.From.Equal(from) && publication.To.Equal(to) && publication.Status == PublicationPublished {
+			return copyPublication(publication), nil
+		}
+	}
+	return nil, nil // Nothing published for the period
+}
+
+// List retrieves every publication for the period, newest first
+func (r *memoryPublicationRepository) List(from, to time.Time) ([]RosterPublication, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	publications := []RosterPublication{}
+	for _, publication := range r.publications {
+		if publication.From.Equal(from) && publication.To.Equal(to) {
+			publications = append(publications, *copyPublication(publication))
+		}
+	}
+	// ULIDs made in the same millisecond don't sort by creation, so order by time first
+	sort.Slice(publications, func(i, j int) bool {
+		if !publications[i].CreatedAt.Equal(publications[j].CreatedAt) {
+			return publications[i].CreatedAt.After(publications[j].CreatedAt)
+		}
+		return publications[i].ID > publications[j].ID
+	})
+	return publications, nil
+}
+
+// Save stores the publication's status and steps
+func (r *memoryPublicationRepository) Save(publication *RosterPublication) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, exists := r.publications[publication.ID]
+	if !exists {
+		return fmt.Errorf("roster publication %s not found", publication.ID)
+	}
+	publication.UpdatedAt = time.Now()
+	stored.Status = publication.Status
+	stored.Steps = publication.Steps
+	stored.UpdatedAt = publication.UpdatedAt
+	r.publications[publication.ID] = *copyPublication(stored)
+	return nil
+}
+
+// Complete marks the publication published and the one it replaces superseded
+func (r *memoryPublicationRepository) Complete(publication *RosterPublication) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for id, existing := range r.publications {
+		if existing.From.Equal(publication.From) && existing.To.Equal(publication.To) &&
+			existing.Status == PublicationPublished {
+			existing.Status = PublicationSuperseded
+			existing.UpdatedAt = now
+			r.publications[id] = existing
+		}
+	}
+
+	stored := r.publications[publication.ID]
+	publication.Status = PublicationPublished
+	publication.UpdatedAt = now
+	stored.Status = publication.Status
+	stored.Steps = publication.Steps
+	stored.UpdatedAt = now
+	r.publications[publication.ID] = *copyPublication(stored)
+	return nil
+}
+
+// Stuck retrieves unfinished publications last touched before the given time
+func (r *memoryPublicationRepository) Stuck(before time.Time) ([]RosterPublication, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	publications := []RosterPublication{}
+	for _, publication := range r.publications {
+		if unfinished(publication.Status) && publication.UpdatedAt.Before(before) {
+			publications = append(publications, *copyPublication(publication))
+		}
+	}
+	sort.Slice(publications, func(i, j int) bool { return publications[i].ID < publications[j].ID })
+	return publications, nil
+}
+
+// Claim moves the publication to compensating only if nobody has touched it
+// since it was read
+func (r *memoryPublicationRepository) Claim(publication *RosterPublication) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, exists := r.publications[publication.ID]
+	if !exists || !stored.UpdatedAt.Equal(publication.UpdatedAt) {
+		return false, nil
+	}
+	publication.Status = PublicationCompensating
+	publication.UpdatedAt = time.Now()
+	stored.Status = publication.Status
+	stored.UpdatedAt = publication.UpdatedAt
+	r.publications[publication.ID] = stored
+	return true, nil
+}
+
+// memoryDepotCalendarRepository keeps depot calendars in process memory for tests
+type memoryDepotCalendarRepository struct {
+	mu        sync.Mutex
+	calendars map[string]DepotCalendar
+}
+
+// NewMemoryDepotCalendarRepository creates an empty in-memory depot calendar repository
+func NewMemoryDepotCalendarRepository() DepotCalendarRepository {
+	return &memoryDepotCalendarRepository{calendars: map[string]DepotCalendar{}}
+}
+
+// WithContext returns the repository itself, as nothing it does can be cancelled
+func (r *memoryDepotCalendarRepository) WithContext(context.Context) DepotCalendarRepository {
+	return r
+}
+
+// Get retrieves a depot's calendar
+func (r *memoryDepotCalendarRepository) Get(depot string) (*DepotCalendar, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cal, exists := r.calendars[depot]
+	if !exists {
+		return nil, nil // Depot runs full service
+	}
+	return &cal, nil
+}
+
+// List retrieves every depot calendar ordered by depot
+func (r *memoryDepotCalendarRepository) List() ([]DepotCalendar, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var calendars []DepotCalendar
+	for _, cal := range r.calendars {
+		calendars = append(calendars, cal)
+	}
+	sort.Slice(calendars, func(i, j int) bool { return calendars[i].Depot < calendars[j].Depot })
+	return calendars, nil
+}
+
+// Put creates or replaces the depot's calendar, leaving it untouched when
+// nothing differs
+func (r *memoryDepotCalendarRepository) Put(cal *DepotCalendar) (created, changed bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, exists := r.calendars[cal.Depot]
+	if exists {
+		before, _ := json.Marshal([]any{existing.Days, existing.Holidays})
+		after, _ := json.Marshal([]any{cal.Days, cal.Holidays})
+		if string(before) == string(after) {
+			*cal = existing
+			return false, false, nil
+		}
+	}
+	cal.UpdatedAt = time.Now()
+	r.calendars[cal.Depot] = *cal
+	return !exists, true, nil
+}
+
+// Delete removes a depot's calendar, reporting whether it existed
+func (r *memoryDepotCalendarRepository) Delete(depot string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.calendars[depot]; !exists {
+		return false, nil
+	}
+	delete(r.calendars, depot)
+	return true, nil
+}
+
+// memoryRuleModeRepository keeps declared rule modes in process memory for tests
+type memoryRuleModeRepository struct {
+	mu    sync.Mutex
+	modes map[string]RuleMode
+}
+
+// NewMemoryRuleModeRepository creates an empty in-memory rule mode repository
+func NewMemoryRuleModeRepository() RuleModeRepository {
+	return &memoryRuleModeRepository{modes: map[string]RuleMode{}}
+}
+
+// WithContext returns the repository itself, as nothing it does can be cancelled
+func (r *memoryRuleModeRepository) WithContext(context.Context) RuleModeRepository {
+	return r
+}
+
+// Get retrieves a rule's declared mode
+func (r *memoryRuleModeRepository) Get(rule string) (*RuleMode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	mode, exists := r.modes[rule]
+	if !exists {
+		return nil, nil // RULE_SHADOW applies
+	}
+	return &mode, nil
+}
+
+// List retrieves every declared rule mode ordered by rule
+func (r *memoryRuleModeRepository) List() ([]RuleMode, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var modes []RuleMode
+	for _, mode := range r.modes {
+		modes = append(modes, mode)
+	}
+	sort.Slice(modes, func(i, j int) bool { return modes[i].Rule < modes[j].Rule })
+	return modes, nil
+}
+
+// Put creates or replaces the rule's mode, leaving it untouched when nothing
+// differs
+func (r *memoryRuleModeRepository) Put(mode *RuleMode) (created, changed bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, exists := r.modes[mode.Rule]
+	sameUntil := (existing.ShadowUntil == nil && mode.ShadowUntil == nil) ||
+		(existing.ShadowUntil != nil && mode.ShadowUntil != nil && existing.ShadowUntil.Equal(*mode.ShadowUntil))
+	if exists && existing.Mode == mode.Mode && sameUntil {
+		*mode = existing
+		return false, false, nil
+	}
+	mode.UpdatedAt = time.Now()
+	r.modes[mode.Rule] = *mode
+	return !exists, true, nil
+}
+
+// Delete removes a rule's declared mode, reporting whether it existed
+func (r *memoryRuleModeRepository) Delete(rule string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.modes[rule]; !exists {
+		return false, nil
+	}
+	delete(r.modes, rule)
+	return true, nil
+}
+
+// memoryScenarioRepository keeps scenarios in process memory for tests
+type memoryScenarioRepository struct {
+	mu        sync.Mutex
+	scenarios map[string]Scenario
+}
+
+// NewMemoryScenarioRepository creates an empty in-memory scenario repository
+func NewMemoryScenarioRepository() ScenarioRepository {
+	return &memoryScenarioRepository{scenarios: map[string]Scenario{}}
+}
+
+// WithContext returns the repository itself, as nothing it does can be cancelled
+func (r *memoryScenarioRepository) WithContext(context.Context) ScenarioRepository {
+	return r
+}
+
+// copyScenario detaches the assignment lists so callers can't change stored state
+func copyScenario(scenario Scenario) *Scenario {
+	scenario.Assignments = append([]ScenarioAssignment{}, scenario.Assignments...)
+	scenario.Removed = append([]ScenarioAssignment{}, scenario.Removed...)
+	return &scenario
+}
+
+// Create stores a new scenario
+func (r *memoryScenarioRepository) Create(scenario *Scenario) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	scenario.Version = 1
+	scenario.CreatedAt = now
+	scenario.UpdatedAt = now
+	r.scenarios[scenario.ID] = *copyScenario(*scenario)
+	return nil
+}
+
+// Get retrieves a scenario by ID
+func (r *memoryScenarioRepository) Get(id string) (*Scenario, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	scenario, exists := r.scenarios[id]
+	if !exists {
+		return nil, nil // Scenario not found
+	}
+	return copyScenario(scenario), nil
+}
+
+// List retrieves every scenario, newest first
+func (r *memoryScenarioRepository) List() ([]Scenario, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	scenarios := []Scenario{}
+	for _, scenario := range r.scenarios {
+		scenarios = append(scenarios, *copyScenario(scenario))
+	}
+	sort.Slice(scenarios, func(i, j int) bool {
+		if !scenarios[i].CreatedAt.Equal(scenarios[j].CreatedAt) {
+			return scenarios[i].CreatedAt.After(scenarios[j].CreatedAt)
+		}
+		return scenarios[i].ID > scenarios[j].ID
+	})
+	return scenarios, nil
+}
+
+// Save stores the scenario if nobody has saved it since it was read
+func (r *memoryScenarioRepository) Save(scenario *Scenario) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, exists := r.scenarios[scenario.ID]
+	if !exists || stored.Version != scenario.Version {
+		return errScenarioModified
+	}
+	scenario.Version++
+	scenario.UpdatedAt = time.Now()
+	r.scenarios[scenario.ID] = *copyScenario(*scenario)
+	return nil
+}
+
+// memoryNotificationRepository keeps notification channels in process memory
+// for tests. The memory assignment repository queues no notifications, so
+// this queue only holds what tests put there.
+type memoryNotificationRepository struct {
+	mu            sync.Mutex
+	channels      map[int]NotificationChannels
+	notifications []Notification
+}
+
+// NewMemoryNotificationRepository creates an empty in-memory notification repository
+func NewMemoryNotificationRepository() NotificationRepository {
+	return &memoryNotificationRepository{channels: map[int]NotificationChannels{}}
+}
+
+// WithContext returns the repository itself, as nothing it does can be cancelled
+func (r *memoryNotificationRepository) WithContext(context.Context) NotificationRepository {
+	return r
+}
+
+// GetChannels retrieves a staff member's notification channels
+func (r *memoryNotificationRepository) GetChannels(staffID int) (*NotificationChannels, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	channels, exists := r.channels[staffID]
+	if !exists {
+		return nil, nil // No channels set
+	}
+	return &channels, nil
+}
+
+// ListChannels retrieves every staff member's notification channels
+func (r *memoryNotificationRepository) ListChannels() ([]NotificationChannels, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var channels []NotificationChannels
+	for _, staffID := range slices.Sorted(maps.Keys(r.channels)) {
+		channels = append(channels, r.channels[staffID])
+	}
+	return channels, nil
+}
+
+// PutChannels creates or replaces a staff member's notification channels,
+// leaving them untouched when nothing differs
+func (r *memoryNotificationRepository) PutChannels(channels *NotificationChannels) (created, changed bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, exists := r.channels[channels.StaffID]
+	if exists && stored.Email == channels.Email && stored.WebhookURL == channels.WebhookURL {
+		*channels = stored
+		return false, false, nil
+	}
+	channels.UpdatedAt = time.Now()
+	r.channels[channels.StaffID] = *channels
+	return !exists, true, nil
+}
+
+// DeleteChannels removes a staff member's notification channels, reporting
+// whether they had any
+func (r *memoryNotificationRepository) DeleteChannels(staffID int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, exists := r.channels[staffID]
+	delete(r.channels, staffID)
+	return exists, nil
+}
+
+// List retrieves notifications matching the filter, newest first
+func (r *memoryNotificationRepository) List(filter NotificationFilter) ([]Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var notifications []Notification
+	for i := len(r.notifications) - 1; i >= 0; i-- {
+		notification := r.notifications[i]
+		if (filter.StaffID == 0 || notification.StaffID == filter.StaffID) &&
+			(filter.Status == "" || notification.Status == filter.Status) {
+			notifications = append(notifications, notification)
+		}
+	}
+	return notifications, nil
+}
+
+// Retry requeues a failed notification to be sent straight away
+func (r *memoryNotificationRepository) Retry(id int64) (*Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.notifications {
+		notification := &r.notifications[i]
+		if notification.ID != id {
+			continue
+		}
+		if notification.Status != NotificationFailed {
+			return nil, errNotificationNotFailed
+		}
+		notification.Status = NotificationPending
+		notification.Attempts = 0
+		notification.NextAttemptAt = time.Now()
+		retried := *notification
+		return &retried, nil
+	}
+	return nil, nil // Notification not found
+}
+
+// memoryIdempotencyRepository keeps idempotent responses in process memory
+// for tests
+type memoryIdempotencyRepository struct {
+	mu        sync.Mutex
+	responses map[[2]string]IdempotentResponse // by actor and key
+}
+
+// NewMemoryIdempotencyRepository creates an empty in-memory idempotency repository
+func NewMemoryIdempotencyRepository() IdempotencyRepository {
+	return &memoryIdempotencyRepository{responses: map[[2]string]IdempotentResponse{}}
+}
+
+// WithContext returns the repository itself, as nothing it does can be cancelled
+func (r *memoryIdempotencyRepository) WithContext(context.Context) IdempotencyRepository {
+	return r
+}
+
+// Claim takes the key for a request about to run, or returns whatever holds it
+func (r *memoryIdempotencyRepository) Claim(claim *IdempotentResponse, now time.Time) (*IdempotentResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, response := range r.responses {
+		if idempotencyExpired(&response, now) {
+			delete(r.responses, id)
+		}
+	}
+	id := [2]string{claim.Actor, claim.Key}
+	if existing, held := r.responses[id]; held {
+		return &existing, nil
+	}
+	claim.CreatedAt = now
+	r.responses[id] = *claim
+	return nil, nil
+}
+
+// Complete stores the response to a claimed request until it expires
+func (r *memoryIdempotencyRepository) Complete(response *IdempotentResponse) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := [2]string{response.Actor, response.Key}
+	if claim, held := r.responses[id]; held && claim.Status == 0 {
+		stored := *response
+		stored.Body = bytes.Clone(response.Body)
+		r.responses[id] = stored
+	}
+	return nil
+}
+
+// Release gives up a claim that didn't produce a response worth keeping
+func (r *memoryIdempotencyRepository) Release(actor, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := [2]string{actor, key}
+	if claim, held := r.responses[id]; held && claim.Status == 0 {
+		delete(r.responses, id)
+	}
+	return nil
+}
+
+// memoryExportJobRepository keeps export jobs in process memory for tests
+type memoryExportJobRepository struct {
+	mu   sync.Mutex
+	jobs map[string]ExportJob
+}
+
+// NewMemoryExportJobRepository creates an empty in-memory export job repository
+func NewMemoryExportJobRepository() ExportJobRepository {
+	return &memoryExportJobRepository{jobs: map[string]ExportJob{}}
+}
+
+// WithContext returns the repository itself, as nothing it does can be cancelled
+func (r *memoryExportJobRepository) WithContext(context.Context) ExportJobRepository {
+	return r
+}
+
+// sorted returns the jobs matching keep, oldest first by ULID
+func (r *memoryExportJobRepository) sorted(keep func(*ExportJob) bool) []ExportJob {
+	var jobs []ExportJob
+	for _, job := range r.jobs {
+		if keep(&job) {
+			jobs = append(jobs, job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs
+}
+
+// Create queues a job
+func (r *memoryExportJobRepository) Create(job *ExportJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job.CreatedAt = time.Now()
+	r.jobs[job.ID] = *job
+	return nil
+}
+
+// Get retrieves a job by ID
+func (r *memoryExportJobRepository) Get(id string) (*ExportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if job, exists := r.jobs[id]; exists {
+		return &job, nil
+	}
+	return nil, nil // Job not found
+}
+
+// List retrieves a requester's jobs, newest first
+func (r *memoryExportJobRepository) List(requestedBy string) ([]ExportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	jobs := r.sorted(func(job *ExportJob) bool { return job.RequestedBy == requestedBy })
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].ID > jobs[j].ID })
+	return jobs, nil
+}
+
+// Claim marks the oldest waiting job running
+func (r *memoryExportJobRepository) Claim(now, staleBefore time.Time) (*ExportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	waiting := r.sorted(func(job *ExportJob) bool {
+		return job.Status == ExportQueued || (job.Status == ExportRunning && job.StartedAt.Before(staleBefore))
+	})
+	if len(waiting) == 0 {
+		return nil, nil
+	}
+	job := waiting[0]
+	job.Status, job.StartedAt = ExportRunning, &now
+	r.jobs[job.ID] = job
+	return &job, nil
+}
+
+// Finish stores the outcome of a running job
+func (r *memoryExportJobRepository) Finish(job *ExportJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if stored, exists := r.jobs[job.ID]; exists && stored.Status == ExportRunning {
+		r.jobs[job.ID] = *job
+	}
+	return nil
+}
+
+// DueCallbacks lists finished jobs whose webhook is still to be delivered
+func (r *memoryExportJobRepository) DueCallbacks(limit int) ([]ExportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	jobs := r.sorted(func(job *ExportJob) bool {
+		return job.CallbackURL != "" && job.CallbackSentAt == nil && job.CallbackAttempts < maxExportCallbackAttempts &&
+			(job.Status == ExportSucceeded || job.Status == ExportFailed)
+	})
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+	return jobs, nil
+}
+
+// RecordCallback counts a webhook attempt; a delivered webhook isn't sent again
+func (r *memoryExportJobRepository) RecordCallback(id string, delivered bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if job, exists := r.jobs[id]; exists {
+		job.CallbackAttempts++
+		if delivered {
+			now := time.Now()
+			job.CallbackSentAt = &now
+		}
+		r.jobs[id] = job
+	}
+	return nil
+}
+
+// DueExpiry lists succeeded jobs whose artifact is past its retention
+func (r *memoryExportJobRepository) DueExpiry(now time.Time) ([]ExportJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.sorted(func(job *ExportJob) bool {
+		return job.Status == ExportSucceeded && job.ExpiresAt != nil && !job.ExpiresAt.After(now)
+	}), nil
+}
+
+// MarkExpired records that a job's artifact has been deleted
+func (r *memoryExportJobRepository) MarkExpired(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if job, exists := r.jobs[id]; exists {
+		job.Status = ExportExpired
+		r.jobs[id] = job
+	}
+	return nil
+}
+
+// memoryAttachmentRepository keeps attachment records in process memory for tests
+type memoryAttachmentRepository struct {
+	mu          sync.Mutex
+	attachments map[string]Attachment
+}
+
+// NewMemoryAttachmentRepository creates an empty in-memory attachment repository
+func NewMemoryAttachmentRepository() AttachmentRepository {
+	return &memoryAttachmentRepository{attachments: map[string]Attachment{}}
+}
+
+// WithContext returns the repository itself, as nothing it does can be cancelled
+func (r *memoryAttachmentRepository) WithContext(context.Context) AttachmentRepository {
+	return r
+}
+
+// Create records an attachment whose file has been stored
+func (r *memoryAttachmentRepository) Create(attachment *Attachment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attachment.CreatedAt = time.Now()
+	r.attachments[attachment.ID] = *attachment
+	return nil
+}
+
+// Get retrieves one of an assignment's attachments
+func (r *memoryAttachmentRepository) Get(assignmentID int, id string) (*Attachment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if attachment, exists := r.attachments[id]; exists && attachment.AssignmentID == assignmentID {
+		return &attachment, nil
+	}
+	return nil, nil
+}
+
+// List retrieves an assignment's attachments, oldest first by ULID
+func (r *memoryAttachmentRepository) List(assignmentID int) ([]Attachment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var attachments []Attachment
+	for _, attachment := range r.attachments {
+		if attachment.AssignmentID == assignmentID {
+			attachments = append(attachments, attachment)
+		}
+	}
+	sort.Slice(attachments, func(i, j int) bool { return attachments[i].ID < attachments[j].ID })
+	return attachments, nil
+}
+
+// memoryRecurringTemplateRepository keeps recurring templates in process memory for tests
+type memoryRecurringTemplateRepository struct {
+	mu        sync.Mutex
+	templates map[int]RecurringTemplate
+	nextID    int
+}
+
+// NewMemoryRecurringTemplateRepository creates an empty in-memory recurring template repository
+func NewMemoryRecurringTemplateRepository() RecurringTemplateRepository {
+	return &memoryRecurringTemplateRepository{templates: map[int]RecurringTemplate{}, nextID: 1}
+}
+
+// WithContext returns the repository itself, as nothing it does can be cancelled
+func (r *memoryRecurringTemplateRepository) WithContext(context.Context) RecurringTemplateRepository {
+	return r
+}
+
+// Create inserts a new recurring template
+func (r *memoryRecurringTemplateRepository) Create(template *RecurringTemplate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	template.ID = r.nextID
+	template.GeneratedThrough = nil
+	template.CreatedAt = now
+	template.UpdatedAt = now
+	r.nextID++
+
+	r.templates[template.ID] = *template
+	return nil
+}
+
+// Get retrieves a recurring template by ID
+func (r *memoryRecurringTemplateRepository) Get(id int) (*RecurringTemplate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	template, exists := r.templates[id]
+	if !exists {
+		return nil, nil // Template not found
+	}
+	return &template, nil
+}
+
+// Update replaces a recurring template's definition, keeping how far it has
+// been generated
+func (r *memoryRecurringTemplateRepository) Update(template *RecurringTemplate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, exists := r.templates[template.ID]
+	if !exists {
+		return fmt.Errorf("recurring template %d not found", template.ID)
+	}
+	template.GeneratedThrough = existing.GeneratedThrough
+	template.CreatedBy = existing.CreatedBy
+	template.CreatedAt = existing.CreatedAt
+	template.UpdatedAt = time.Now()
+
+	r.templates[template.ID] = *template
+	return nil
+}
+
+// Delete removes a recurring template, reporting whether it existed
+func (r *memoryRecurringTemplateRepository) Delete(id int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.templates[id]; !exists {
+		return false, nil
+	}
+	delete(r.templates, id)
+	return true, nil
+}
+
+// List retrieves every recurring template ordered by ID
+func (r *memoryRecurringTemplateRepository) List() ([]RecurringTemplate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var templates []RecurringTemplate
+	for _, template := range r.templates {
+		templates = append(templates, template)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].ID < templates[j].ID })
+	return templates, nil
+}
+
+// Advance moves generated_through on, only while it still is previous
+func (r *memoryRecurringTemplateRepository) Advance(id int, previous *time.Time, through time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	template, exists := r.templates[id]
+	current := template.GeneratedThrough
+	if !exists || (current == nil) != (previous == nil) || (current != nil && !current.Equal(*previous)) {
+		return false, nil
+	}
+	template.GeneratedThrough = &through
+	r.templates[id] = template
+	return true, nil
+}
+
+// memoryCallbackKeyRepository keeps callback keys and accepted nonces in
+// process memory for tests
+type memoryCallbackKeyRepository struct {
+	mu     sync.Mutex
+	keys   map[string]CallbackKey
+	nonces map[[2]string]time.Time // expiry by key ID and nonce
+}
+
+// NewMemoryCallbackKeyRepository creates an empty in-memory callback key repository
+func NewMemoryCallbackKeyRepository() CallbackKeyRepository {
+	return &memoryCallbackKeyRepository{keys: map[string]CallbackKey{}, nonces: map[[2]string]time.Time{}}
+}
+
+// WithContext returns the repository itself, as nothing it does can be cancelled
+func (r *memoryCallbackKeyRepository) WithContext(context.Context) CallbackKeyRepository {
+	return r
+}
+
+// Create stores a new callback key
+func (r *memoryCallbackKeyRepository) Create(key *CallbackKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.keys[key.ID]; exists {
+		return fmt.Errorf("callback key %s already exists", key.ID)
+	}
+	key.CreatedAt = time.Now()
+	r.keys[key.ID] = *key
+	return nil
+}
+
+// Get retrieves a callback key by ID, revoked or not
+func (r *memoryCallbackKeyRepository) Get(id string) (*CallbackKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, exists := r.keys[id]
+	if !exists {
+		return nil, nil // Key not found
+	}
+	return &key, nil
+}
+
+// List retrieves every callback key, oldest first
+func (r *memoryCallbackKeyRepository) List() ([]CallbackKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := make([]CallbackKey, 0, len(r.keys))
+	for _, key := range r.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+// Revoke stops a key verifying callbacks, keeping the first revocation time
+func (r *memoryCallbackKeyRepository) Revoke(id string, at time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, exists := r.keys[id]
+	if !exists {
+		return false, nil
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &at
+		r.keys[id] = key
+	}
+	return true, nil
+}
+
+// Use records a verified callback's nonce, reporting false if the key already
+// accepted it
+func (r *memoryCallbackKeyRepository) Use(keyID, nonce string, expiresAt, now time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, expiry := range r.nonces {
+		if !expiry.After(now) {
+			delete(r.nonces, id)
+		}
+	}
+	id := [2]string{keyID, nonce}
+	if _, seen := r.nonces[id]; seen {
+		return false, nil
+	}
+	r.nonces[id] = expiresAt
+	if key, exists := r.keys[keyID]; exists {
+		key.LastUsedAt = &now
+		r.keys[keyID] = key
+	}
+	return true, nil
+}
+
+// memoryShiftRepository keeps open shifts and bids in process memory for
+// tests. Shifts are taken up within a transact of the assignment repository,
+// and only saved once it succeeds.
+type memoryShiftRepository struct {
+	mu          sync.Mutex
+	assignments AssignmentRepository
+	shifts      map[int]OpenShift
+	bids        map[int]ShiftBid
+	nextID      int
+	nextBidID   int
+}
+
+// NewMemoryShiftRepository creates an empty in-memory shift repository
+// awarding assignments in the given repository
+func NewMemoryShiftRepository(assignments AssignmentRepository) ShiftRepository {
+	return &memoryShiftRepository{assignments: assignments, shifts: map[int]OpenShift{}, bids: map[int]ShiftBid{},
+		nextID: 1, nextBidID: 1}
+}
+
+// WithContext returns the repository itself, as nothing it does can be cancelled
+func (r *memoryShiftRepository) WithContext(context.Context) ShiftRepository {
+	return r
+}
+
+// Create stores a new open shift
+func (r *memoryShiftRepository) Create(shift *OpenShift) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	shift.ID = r.nextID
+	shift.Status = "open"
+	shift.CreatedAt = now
+	shift.UpdatedAt = now
+	r.nextID++
+	r.shifts[shift.ID] = *shift
+	return nil
+}
+
+// Get retrieves a shift by ID
+func (r *memoryShiftRepository) Get(id int) (*OpenShift, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	shift, exists := r.shifts[id]
+	if !exists {
+		return nil, nil // Shift not found
+	}
+	return &shift, nil
+}
+
+// list returns the shifts passing keep in ID order; callers hold the lock
+func (r *memoryShiftRepository) list(keep func(shift *OpenShift) bool) []OpenShift {
+	var shifts []OpenShift
+	for _, shift := range r.shifts {
+		if keep(&shift) {
+			shifts = append(shifts, shift)
+		}
+	}
+	sort.Slice(shifts, func(i, j int) bool { return shifts[i].ID < shifts[j].ID })
+	return shifts
+}
+
+// List retrieves shifts, optionally filtered by status, soonest closing first
+func (r *memoryShiftRepository) List(status string) ([]OpenShift, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	shifts := r.list(func(shift *OpenShift) bool { return status == "" || shift.Status == status })
+	sort.SliceStable(shifts, func(i, j int) bool { return shifts[i].BiddingClosesAt.Before(shifts[j].BiddingClosesAt) })
+	return shifts, nil
+}
+
+// ListClaimable retrieves claim-mode shifts still open for claiming,
+// optionally filtered by role and bus, soonest starting first
+func (r *memoryShiftRepository) ListClaimable(role string, busID int, now time.Time) ([]OpenShift, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	shifts := r.list(func(shift *OpenShift) bool {
+		return shift.Mode == ShiftModeClaim && shift.Status == "open" && shift.BiddingClosesAt.After(now) &&
+			(role == "" || shift.Role == role) && (busID == 0 || shift.BusID == busID)
+	})
+	sort.SliceStable(shifts, func(i, j int) bool { return shifts[i].StartDate.Before(shifts[j].StartDate) })
+	return shifts, nil
+}
+
+// PlaceBid records a bid. A withdrawn bid is reinstated and goes to the back
+// of the queue.
+func (r *memoryShiftRepository) PlaceBid(shiftID, staffID int) (*ShiftBid, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.shifts[shiftID]; !exists {
+		return nil, fmt.Errorf("shift %d not found", shiftID)
+	}
+	for id, bid := range r.bids {
+		if bid.ShiftID != shiftID || bid.StaffID != staffID {
+			continue
+		}
+		if bid.Status != "withdrawn" {
+			return nil, errDuplicateBid
+		}
+		bid.Status = "pending"
+		bid.CreatedAt = time.Now()
+		r.bids[id] = bid
+		return &bid, nil
+	}
+
+	bid := ShiftBid{ID: r.nextBidID, ShiftID: shiftID, StaffID: staffID, Status: "pending", CreatedAt: time.Now()}
+	r.nextBidID++
+	r.bids[bid.ID] = bid
+	return &bid, nil
+}
+
+// WithdrawBid withdraws a pending bid, reporting whether one existed
+func (r *memoryShiftRepository) WithdrawBid(shiftID, staffID int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, bid := range r.bids {
+		if bid.ShiftID == shiftID && bid.StaffID == staffID && bid.Status == "pending" {
+			bid.Status = "withdrawn"
+			r.bids[id] = bid
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ListBids retrieves the bids on a shift in the order they were placed
+func (r *memoryShiftRepository) ListBids(shiftID int) ([]ShiftBid, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.listBids(shiftID), nil
+}
+
+// listBids is ListBids for callers holding the lock
+func (r *memoryShiftRepository) listBids(shiftID int) []ShiftBid {
+	var bids []ShiftBid
+	for _, bid := range r.bids {
+		if bid.ShiftID == shiftID {
+			bids = append(bids, bid)
+		}
+	}
+	sort.Slice(bids, func(i, j int) bool {
+		if !bids[i].CreatedAt.Equal(bids[j].CreatedAt) {
+			return bids[i].CreatedAt.Before(bids[j].CreatedAt)
+		}
+		return bids[i].ID < bids[j].ID
+	})
+	return bids
+}
+
+// takeUp runs fn on a copy of the shift inside a transact of the assignment
+// repository, saving the outcome fn leaves on the shift if it succeeds;
+// callers hold the lock
+func (r *memoryShiftRepository) takeUp(shiftID int, fn func(tx assignmentTx, shift *OpenShift) error) (*OpenShift, error) {
+	var shift *OpenShift
+	if stored, exists := r.shifts[shiftID]; exists {
+		shift = &stored
+	}
+	if err := r.assignments.transact(func(tx assignmentTx) error { return fn(tx, shift) }); err != nil {
+		return nil, err
+	}
+
+	shift.UpdatedAt = time.Now()
+	r.shifts[shift.ID] = *shift
+	if shift.Status != "claimed" {
+		for id, bid := range r.bids {
+			if bid.ShiftID != shift.ID || bid.Status != "pending" {
+				continue
+			}
+			bid.Status = "lost"
+			if shift.AwardedStaffID != nil && bid.StaffID == *shift.AwardedStaffID {
+				bid.Status = "won"
+			}
+			r.bids[id] = bid
+		}
+	}
+	return shift, nil
+}
+
+// Claim takes up a claim-mode shift together with its assignment
+func (r *memoryShiftRepository) Claim(shiftID, staffID int, actor string, now time.Time,
+	check takeUpCheck) (*OpenShift, *Assignment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var created *Assignment
+	shift, err := r.takeUp(shiftID, func(tx assignmentTx, shift *OpenShift) error {
+		var err error
+		created, err = claimShift(tx, shift, staffID, actor, now, check)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return shift, created, nil
+}
+
+// ConfirmClaim creates the assignment of a held claim
+func (r *memoryShiftRepository) ConfirmClaim(shiftID int, actor string, check takeUpCheck) (*OpenShift, *Assignment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var created *Assignment
+	shift, err := r.takeUp(shiftID, func(tx assignmentTx, shift *OpenShift) error {
+		var err error
+		created, err = confirmShiftClaim(tx, shift, actor, check)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return shift, created, nil
+}
+
+// RejectClaim releases a claim awaiting confirmation so the shift can be claimed again
+func (r *memoryShiftRepository) RejectClaim(shiftID int) (*OpenShift, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	shift, exists := r.shifts[shiftID]
+	if !exists || shift.Status != "claimed" {
+		return nil, errNoPendingClaim
+	}
+	shift.Status = "open"
+	shift.AwardedStaffID = nil
+	shift.UpdatedAt = time.Now()
+	r.shifts[shiftID] = shift
+	return &shift, nil
+}
+
+// DueForAward lists the open shifts whose bidding has closed
+func (r *memoryShiftRepository) DueForAward(now time.Time) ([]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	due := r.list(func(shift *OpenShift) bool { return shift.Status == "open" && !shift.BiddingClosesAt.After(now) })
+	sort.SliceStable(due, func(i, j int) bool { return due[i].BiddingClosesAt.Before(due[j].BiddingClosesAt) })
+	ids := make([]int, len(due))
+	for i, shift := range due {
+		ids[i] = shift.ID
+	}
+	return ids, nil
+}
+
+// Award closes bidding on a shift together with the assignment it creates
+func (r *memoryShiftRepository) Award(shiftID int, check takeUpCheck) (*OpenShift, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	shift, exists := r.shifts[shiftID]
+	if !exists || shift.Status != "open" {
+		return nil, nil
+	}
+	pending := pendingBids(r.listBids(shiftID))
+	recentAwards := map[int]int{}
+	since := time.Now().Add(-fairnessWindow)
+	for _, other := range r.shifts {
+		if other.Status == "awarded" && other.AwardedStaffID != nil && !other.UpdatedAt.Before(since) {
+			recentAwards[*other.AwardedStaffID]++
+		}
+	}
+
+	ranked := rankBids(shift.AwardPolicy, pending, recentAwards)
+	return r.takeUp(shiftID, func(tx assignmentTx, shift *OpenShift) error {
+		_, err := awardToBidder(tx, shift, ranked, check)
+		return err
+	})
+}
+
+// declared finds the shift declared under a name; callers hold the lock
+func (r *memoryShiftRepository) declared(name string) (OpenShift, bool) {
+	for _, shift := range r.shifts {
+		if shift.Name != nil && *shift.Name == name {
+			return shift, true
+		}
+	}
+	return OpenShift{}, false
+}
+
+// GetDeclared retrieves the shift declared under a name
+func (r *memoryShiftRepository) GetDeclared(name string) (*OpenShift, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	shift, exists := r.declared(name)
+	if !exists {
+		return nil, nil // Nothing declared under the name
+	}
+	return &shift, nil
+}
+
+// ListDeclared retrieves every shift declared by name
+func (r *memoryShiftRepository) ListDeclared() ([]OpenShift, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	shifts := r.list(func(shift *OpenShift) bool { return shift.Name != nil })
+	sort.Slice(shifts, func(i, j int) bool { return *shifts[i].Name < *shifts[j].Name })
+	return shifts, nil
+}
+
+// PutDeclared creates or updates the shift declared under the given name
+func (r *memoryShiftRepository) PutDeclared(name string, shift *OpenShift, now time.Time) (created, changed bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, exists := r.declared(name)
+	if exists && sameShiftSpec(&existing, shift) {
+		*shift = existing
+		return false, false, nil
+	}
+	if !shift.BiddingClosesAt.After(now) {
+		return false, false, errBiddingClosed
+	}
+
+	if !exists {
+		shift.ID = r.nextID
+		shift.Name = &name
+		shift.Status = "open"
+		shift.CreatedAt = time.Now()
+		shift.UpdatedAt = shift.CreatedAt
+		r.nextID++
+		r.shifts[shift.ID] = *shift
+		return true, true, nil
+	}
+
+	pending := len(pendingBids(r.listBids(existing.ID))) > 0
+	if existing.Status != "open" || pending {
+		*shift = existing
+		return false, false, errShiftSpecLocked
+	}
+	updated := existing
+	updated.BusID, updated.Role = shift.BusID, shift.Role
+	updated.StartDate, updated.EndDate, updated.WorkingDays = shift.StartDate, shift.EndDate, shift.WorkingDays
+	updated.Mode, updated.RequiresConfirmation = shift.Mode, shift.RequiresConfirmation
+	updated.AwardPolicy, updated.BiddingClosesAt = shift.AwardPolicy, shift.BiddingClosesAt
+	updated.UpdatedAt = time.Now()
+	r.shifts[updated.ID] = updated
+	*shift = updated
+	return false, true, nil
+}
+
+// DeleteDeclared cancels the shift declared under the name and frees the name
+func (r *memoryShiftRepository) DeleteDeclared(name string) (*OpenShift, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	shift, exists := r.declared(name)
+	if !exists {
+		return nil, nil
+	}
+	if shift.Status != "open" && shift.Status != "cancelled" && shift.Status != "unfilled" {
+		return nil, errShiftSpecLocked
+	}
+	if shift.Status == "open" {
+		shift.Status = "cancelled"
+	}
+	shift.Name = nil
+	shift.UpdatedAt = time.Now()
+	r.shifts[shift.ID] = shift
+	for id, bid := range r.bids {
+		if bid.ShiftID == shift.ID && bid.Status == "pending" {
+			bid.Status = "lost"
+			r.bids[id] = bid
+		}
+	}
+	return &shift, nil
+}
@@ -0,0 +1,19 @@
+-- Baseline schema. IF NOT EXISTS lets databases created by the old
+-- createTables bootstrap adopt the migration history unchanged.
+CREATE TABLE IF NOT EXISTS assignments (
+    id SERIAL PRIMARY KEY,
+    bus_id INTEGER NOT NULL,
+    staff_id INTEGER NOT NULL,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('driver', 'conductor')),
+    start_date DATE NOT NULL,
+    end_date DATE,
+    status VARCHAR(20) DEFAULT 'active' CHECK (status IN ('active', 'completed', 'cancelled')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(bus_id, staff_id, role, start_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_assignments_bus_id ON assignments(bus_id);
+CREATE INDEX IF NOT EXISTS idx_assignments_staff_id ON assignments(staff_id);
+CREATE INDEX IF NOT EXISTS idx_assignments_status ON assignments(status);
+CREATE INDEX IF NOT EXISTS idx_assignments_start_date ON assignments(start_date);
@@ -0,0 +1,2 @@
+-- Working day mask (bit n = time.Weekday(n), 0 = every day)
+ALTER TABLE assignments ADD COLUMN IF NOT EXISTS working_days SMALLINT NOT NULL DEFAULT 0;
@@ -0,0 +1,12 @@
+-- Audit trail of assignment mutations. No foreign key so history outlives deletes.
+CREATE TABLE IF NOT EXISTS assignment_audit (
+    id BIGSERIAL PRIMARY KEY,
+    assignment_id INTEGER NOT NULL,
+    action VARCHAR(20) NOT NULL CHECK (action IN ('create', 'update', 'delete', 'status_change')),
+    actor VARCHAR(255) NOT NULL,
+    changed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    before JSONB,
+    after JSONB
+);
+
+CREATE INDEX IF NOT EXISTS idx_assignment_audit_assignment_id ON assignment_audit(assignment_id, changed_at);
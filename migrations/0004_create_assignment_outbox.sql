@@ -0,0 +1,14 @@
+-- Transactional outbox of events awaiting publication to the broker
+CREATE TABLE IF NOT EXISTS assignment_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL,
+    assignment_id INTEGER NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP WITH TIME ZONE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_assignment_outbox_pending ON assignment_outbox(id) WHERE published_at IS NULL;
@@ -0,0 +1,29 @@
+-- Unassigned shifts opened to staff for bidding
+CREATE TABLE IF NOT EXISTS open_shifts (
+    id SERIAL PRIMARY KEY,
+    bus_id INTEGER NOT NULL,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('driver', 'conductor')),
+    start_date DATE NOT NULL,
+    end_date DATE,
+    working_days SMALLINT NOT NULL DEFAULT 0,
+    award_policy VARCHAR(20) NOT NULL CHECK (award_policy IN ('seniority', 'fairness')),
+    bidding_closes_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'awarded', 'unfilled', 'cancelled')),
+    awarded_staff_id INTEGER,
+    assignment_id INTEGER,
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_open_shifts_closing ON open_shifts(bidding_closes_at) WHERE status = 'open';
+CREATE INDEX IF NOT EXISTS idx_open_shifts_awarded_staff ON open_shifts(awarded_staff_id);
+
+CREATE TABLE IF NOT EXISTS shift_bids (
+    id SERIAL PRIMARY KEY,
+    shift_id INTEGER NOT NULL REFERENCES open_shifts(id) ON DELETE CASCADE,
+    staff_id INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'won', 'lost', 'withdrawn')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(shift_id, staff_id)
+);
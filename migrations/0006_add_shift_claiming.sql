@@ -0,0 +1,11 @@
+-- Open shifts can be claimed first-come-first-served instead of bid on,
+-- optionally held for dispatcher confirmation in the 'claimed' status
+ALTER TABLE open_shifts
+    ADD COLUMN IF NOT EXISTS mode VARCHAR(10) NOT NULL DEFAULT 'bid' CHECK (mode IN ('bid', 'claim')),
+    ADD COLUMN IF NOT EXISTS requires_confirmation BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE open_shifts DROP CONSTRAINT IF EXISTS open_shifts_status_check;
+ALTER TABLE open_shifts ADD CONSTRAINT open_shifts_status_check
+    CHECK (status IN ('open', 'claimed', 'awarded', 'unfilled', 'cancelled'));
+
+CREATE INDEX IF NOT EXISTS idx_open_shifts_claimable ON open_shifts(mode, status);
@@ -0,0 +1,2 @@
+-- Supports the reverse-chronological activity feed across all assignments
+CREATE INDEX IF NOT EXISTS idx_assignment_audit_changed_at ON assignment_audit(changed_at DESC, id DESC);
@@ -0,0 +1,14 @@
+-- Optional shift times so one bus can run morning and evening crews on the
+-- same dates. NULL times mean the assignment covers the whole day.
+ALTER TABLE assignments
+    ADD COLUMN IF NOT EXISTS shift_start TIME,
+    ADD COLUMN IF NOT EXISTS shift_end TIME;
+
+ALTER TABLE assignments DROP CONSTRAINT IF EXISTS assignments_shift_times_check;
+ALTER TABLE assignments ADD CONSTRAINT assignments_shift_times_check
+    CHECK ((shift_start IS NULL) = (shift_end IS NULL) AND (shift_start IS NULL OR shift_end > shift_start));
+
+-- The same crew may now work two shifts on one bus starting the same day
+ALTER TABLE assignments DROP CONSTRAINT IF EXISTS assignments_bus_id_staff_id_role_start_date_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_assignments_unique_slot
+    ON assignments(bus_id, staff_id, role, start_date, COALESCE(shift_start, '00:00'::time));
@@ -0,0 +1,16 @@
+-- Leave, sick days and rest periods during which a staff member cannot be assigned
+CREATE TABLE IF NOT EXISTS staff_availability (
+    id SERIAL PRIMARY KEY,
+    staff_id INTEGER NOT NULL,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('leave', 'sick', 'rest')),
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (end_date >= start_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_staff_availability_staff_dates
+    ON staff_availability (staff_id, start_date, end_date);
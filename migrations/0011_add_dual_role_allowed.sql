@@ -0,0 +1,5 @@
+-- Marks an assignment whose staff member may hold another role on the same
+-- bus at the same time, so deliberate dual-role crews aren't flagged as
+-- duplicate data entry
+ALTER TABLE assignments
+    ADD COLUMN IF NOT EXISTS dual_role_allowed BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,14 @@
+-- Human-friendly references such as ASG-2024-000123 for depot staff, and the
+-- IDs assignments had in the legacy system. New references are set by the
+-- service when the assignment is created.
+ALTER TABLE assignments
+    ADD COLUMN IF NOT EXISTS reference VARCHAR(32),
+    ADD COLUMN IF NOT EXISTS external_ref VARCHAR(100);
+
+UPDATE assignments
+SET reference = 'ASG-' || to_char(created_at AT TIME ZONE 'UTC', 'YYYY') || '-'
+    || lpad(id::text, GREATEST(6, length(id::text)), '0')
+WHERE reference IS NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_assignments_reference ON assignments(reference);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_assignments_external_ref ON assignments(external_ref);
@@ -0,0 +1,4 @@
+-- Incremented on every update so clients can detect that an assignment
+-- changed since they read it
+ALTER TABLE assignments
+    ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,58 @@
+-- Non-enumerable public IDs (ULIDs) for assignments, so external links and
+-- webhooks don't expose the serial IDs. The service generates them for new
+-- assignments; existing ones are backfilled from their creation time.
+CREATE FUNCTION pg_temp.ulid(ts TIMESTAMP WITH TIME ZONE) RETURNS CHAR(26) AS $$
+DECLARE
+    alphabet CONSTANT TEXT := '0123456789ABCDEFGHJKMNPQRSTVWXYZ';
+    ms BIGINT := floor(extract(epoch FROM ts) * 1000);
+    result TEXT := '';
+BEGIN
+    FOR i IN 1..10 LOOP
+        result := substr(alphabet, (ms % 32)::INTEGER + 1, 1) || result;
+        ms := ms / 32;
+    END LOOP;
+    FOR i IN 1..16 LOOP
+        result := result || substr(alphabet, floor(random() * 32)::INTEGER + 1, 1);
+    END LOOP;
+    RETURN result;
+END
+$$ LANGUAGE plpgsql VOLATILE;
+
+ALTER TABLE assignments ADD COLUMN IF NOT EXISTS public_id CHAR(26);
+UPDATE assignments SET public_id = pg_temp.ulid(created_at) WHERE public_id IS NULL;
+ALTER TABLE assignments ALTER COLUMN public_id SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_assignments_public_id ON assignments(public_id);
+
+-- History outlives deletes, so the audit trail keeps the public ID itself.
+-- Assignments deleted before this migration get one made up for them.
+ALTER TABLE assignment_audit ADD COLUMN IF NOT EXISTS assignment_public_id CHAR(26);
+
+UPDATE assignment_audit au
+SET assignment_public_id = a.public_id
+FROM assignments a
+WHERE a.id = au.assignment_id AND au.assignment_public_id IS NULL;
+
+WITH deleted AS (
+    SELECT assignment_id, pg_temp.ulid(min(changed_at)) AS public_id
+    FROM assignment_audit
+    WHERE assignment_public_id IS NULL
+    GROUP BY assignment_id
+)
+UPDATE assignment_audit au
+SET assignment_public_id = deleted.public_id
+FROM deleted
+WHERE deleted.assignment_id = au.assignment_id AND au.assignment_public_id IS NULL;
+
+ALTER TABLE assignment_audit ALTER COLUMN assignment_public_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_assignment_audit_public_id ON assignment_audit(assignment_public_id, changed_at);
+
+-- Snapshots and queued events carried the serial ID as "id"
+UPDATE assignment_audit
+SET before = CASE WHEN before IS NULL THEN NULL ELSE jsonb_set(before, '{id}', to_jsonb(assignment_public_id)) END,
+    after = CASE WHEN after IS NULL THEN NULL ELSE jsonb_set(after, '{id}', to_jsonb(assignment_public_id)) END
+WHERE jsonb_typeof(COALESCE(before, after)->'id') = 'number';
+
+UPDATE assignment_outbox o
+SET payload = jsonb_set(o.payload, '{id}', to_jsonb(ids.assignment_public_id))
+FROM (SELECT DISTINCT assignment_id, assignment_public_id FROM assignment_audit) ids
+WHERE ids.assignment_id = o.assignment_id AND jsonb_typeof(o.payload->'id') = 'number';
@@ -0,0 +1,18 @@
+-- Two-phase deletes of staff members and buses requested by the services that
+-- own them. A prepared hold stops new assignments for the resource until it
+-- is confirmed, aborted or expires; a confirmed one keeps blocking, since the
+-- record no longer exists upstream.
+CREATE TABLE IF NOT EXISTS deletion_holds (
+    id CHAR(26) PRIMARY KEY,
+    resource VARCHAR(10) NOT NULL CHECK (resource IN ('staff', 'bus')),
+    resource_id INTEGER NOT NULL,
+    cascade_cancel BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(20) NOT NULL DEFAULT 'prepared' CHECK (status IN ('prepared', 'confirmed', 'aborted')),
+    requested_by VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_deletion_holds_resource
+    ON deletion_holds(resource, resource_id) WHERE status <> 'aborted';
@@ -0,0 +1,27 @@
+-- Rosters published to this service and the services that consume them. A
+-- publication runs as a saga; days is the snapshot sent to participants and
+-- steps records each participant's progress so a failed or interrupted saga
+-- can be compensated back to the previous publication.
+CREATE TABLE IF NOT EXISTS roster_publications (
+    id CHAR(26) PRIMARY KEY,
+    period_from DATE NOT NULL,
+    period_to DATE NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'publishing'
+        CHECK (status IN ('publishing', 'published', 'superseded', 'compensating', 'failed', 'compensation_failed')),
+    previous_id CHAR(26) REFERENCES roster_publications(id),
+    days JSONB NOT NULL,
+    steps JSONB NOT NULL DEFAULT '[]',
+    published_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One unfinished saga per period, so two publications can't interleave
+-- their calls to participants
+CREATE UNIQUE INDEX IF NOT EXISTS idx_roster_publications_in_flight
+    ON roster_publications(period_from, period_to)
+    WHERE status IN ('publishing', 'compensating', 'compensation_failed');
+
+-- At most one current roster per period
+CREATE UNIQUE INDEX IF NOT EXISTS idx_roster_publications_published
+    ON roster_publications(period_from, period_to) WHERE status = 'published';
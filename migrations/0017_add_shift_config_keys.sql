@@ -0,0 +1,6 @@
+-- Shifts declared through the configuration API are keyed by a stable name,
+-- so tools such as Terraform can apply the same definition repeatedly
+ALTER TABLE open_shifts ADD COLUMN IF NOT EXISTS config_key VARCHAR(100);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_open_shifts_config_key
+    ON open_shifts(config_key) WHERE config_key IS NOT NULL;
@@ -0,0 +1,8 @@
+-- Per-depot operating calendars, for depots that run reduced or no service on
+-- some days. Depots without a row run full service every day.
+CREATE TABLE IF NOT EXISTS depot_calendars (
+    depot VARCHAR(100) PRIMARY KEY,
+    days JSONB NOT NULL DEFAULT '{}',
+    holidays JSONB,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
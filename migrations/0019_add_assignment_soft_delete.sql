@@ -0,0 +1,17 @@
+-- Deleted assignments are kept for payroll reconciliation and can be
+-- restored. The unique indexes only cover live rows, so a deleted assignment
+-- doesn't stop its slot or legacy ID being used again.
+ALTER TABLE assignments ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+
+DROP INDEX IF EXISTS idx_assignments_unique_slot;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_assignments_unique_slot
+    ON assignments(bus_id, staff_id, role, start_date, COALESCE(shift_start, '00:00'::time))
+    WHERE deleted_at IS NULL;
+
+DROP INDEX IF EXISTS idx_assignments_external_ref;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_assignments_external_ref ON assignments(external_ref)
+    WHERE deleted_at IS NULL;
+
+ALTER TABLE assignment_audit DROP CONSTRAINT IF EXISTS assignment_audit_action_check;
+ALTER TABLE assignment_audit ADD CONSTRAINT assignment_audit_action_check
+    CHECK (action IN ('create', 'update', 'delete', 'status_change', 'restore'));
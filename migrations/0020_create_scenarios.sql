@@ -0,0 +1,17 @@
+-- What-if scenarios: a planner's sandboxed copy of a period's assignments.
+-- assignments holds the scenario's version of each one and removed the live
+-- assignments it deletes, until the scenario is applied or discarded.
+CREATE TABLE IF NOT EXISTS scenarios (
+    id CHAR(26) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    period_from DATE NOT NULL,
+    period_to DATE NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'draft'
+        CHECK (status IN ('draft', 'applying', 'applied', 'discarded')),
+    assignments JSONB NOT NULL DEFAULT '[]',
+    removed JSONB NOT NULL DEFAULT '[]',
+    version INTEGER NOT NULL DEFAULT 1,
+    created_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,33 @@
+-- Where each staff member is told about changes to their assignments
+CREATE TABLE IF NOT EXISTS staff_notification_channels (
+    staff_id INTEGER PRIMARY KEY,
+    email VARCHAR(255),
+    webhook_url VARCHAR(2048),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (email IS NOT NULL OR webhook_url IS NOT NULL)
+);
+
+-- Notifications queued by assignment writes in the same transaction, and
+-- sent by a background worker that retries failures with backoff
+CREATE TABLE IF NOT EXISTS notifications (
+    id BIGSERIAL PRIMARY KEY,
+    staff_id INTEGER NOT NULL,
+    channel VARCHAR(20) NOT NULL CHECK (channel IN ('email', 'webhook')),
+    recipient VARCHAR(2048) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    assignment_id CHAR(26) NOT NULL,
+    subject TEXT NOT NULL,
+    body TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP WITH TIME ZONE
+);
+
+-- The sender only looks at notifications still to send
+CREATE INDEX IF NOT EXISTS idx_notifications_due
+    ON notifications (next_attempt_at) WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_notifications_staff ON notifications (staff_id);
@@ -0,0 +1,11 @@
+-- How far each warehouse export stream has got. Assignment facts are
+-- exported in (updated_at, id) order, so the watermark is the last row sent.
+CREATE TABLE IF NOT EXISTS warehouse_watermarks (
+    stream VARCHAR(50) PRIMARY KEY,
+    watermark_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    watermark_id INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- The exporter reads changed assignments in this order
+CREATE INDEX IF NOT EXISTS idx_assignments_updated_at ON assignments (updated_at, id);
@@ -0,0 +1,16 @@
+-- Responses to requests sent with an Idempotency-Key, replayed when a client
+-- retries. A row without a status is a claim by a request still running.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    actor VARCHAR(255) NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status INTEGER,
+    content_type VARCHAR(255),
+    body BYTEA,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (actor, idempotency_key)
+);
+
+-- Expired rows are purged as new keys are claimed
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires ON idempotency_keys (expires_at);
@@ -0,0 +1,4 @@
+-- Restricts an assignment, such as a VIP charter duty, to callers holding
+-- the clearance label; NULL means anyone may see it
+ALTER TABLE assignments
+    ADD COLUMN IF NOT EXISTS clearance_label VARCHAR(50);
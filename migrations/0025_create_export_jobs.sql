@@ -0,0 +1,29 @@
+-- Exports too large to stream from a request, queued by the API and run by a
+-- background worker that stores the artifact in object storage
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id CHAR(26) PRIMARY KEY,
+    format VARCHAR(20) NOT NULL CHECK (format IN ('csv', 'anonymized')),
+    filter JSONB NOT NULL,
+    include_deleted BOOLEAN NOT NULL DEFAULT FALSE,
+    clearances TEXT[], -- the requester's clearance labels; NULL sees every assignment
+    requested_by VARCHAR(255) NOT NULL,
+    callback_url VARCHAR(2048),
+    status VARCHAR(20) NOT NULL DEFAULT 'queued'
+        CHECK (status IN ('queued', 'running', 'succeeded', 'failed', 'expired')),
+    error TEXT,
+    artifact_key VARCHAR(255),
+    rows INTEGER NOT NULL DEFAULT 0,
+    size BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP WITH TIME ZONE,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    callback_attempts INTEGER NOT NULL DEFAULT 0,
+    callback_sent_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Runners only look at jobs still to run
+CREATE INDEX IF NOT EXISTS idx_export_jobs_waiting
+    ON export_jobs (created_at) WHERE status IN ('queued', 'running');
+
+CREATE INDEX IF NOT EXISTS idx_export_jobs_requester ON export_jobs (requested_by, created_at);
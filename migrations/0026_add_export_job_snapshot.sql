@@ -0,0 +1,3 @@
+-- The time each export's snapshot was taken, so consumers know exactly which
+-- changes the file reflects
+ALTER TABLE export_jobs ADD COLUMN IF NOT EXISTS snapshot_at TIMESTAMP WITH TIME ZONE;
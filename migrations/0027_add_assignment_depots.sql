@@ -0,0 +1,10 @@
+-- The depot of each assignment's bus, so callers scoped to a depot only see
+-- and change its assignments. Existing rows are filled in at startup from the
+-- bus directory.
+ALTER TABLE assignments
+    ADD COLUMN IF NOT EXISTS depot_id VARCHAR(50);
+
+CREATE INDEX IF NOT EXISTS idx_assignments_depot_id ON assignments (depot_id);
+
+-- The depot an export job's requester was scoped to, applied when it runs
+ALTER TABLE export_jobs ADD COLUMN IF NOT EXISTS depot_id VARCHAR(50);
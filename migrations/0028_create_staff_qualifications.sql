@@ -0,0 +1,11 @@
+-- License classes staff hold, checked before they're assigned a role that
+-- needs one; expires_on is the last valid day, NULL when it doesn't expire
+CREATE TABLE IF NOT EXISTS staff_qualifications (
+    staff_id INTEGER NOT NULL,
+    class VARCHAR(20) NOT NULL,
+    license_number VARCHAR(50) NOT NULL DEFAULT '',
+    expires_on DATE,
+    updated_by VARCHAR(255) NOT NULL DEFAULT '',
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (staff_id, class)
+);
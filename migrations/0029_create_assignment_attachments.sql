@@ -0,0 +1,17 @@
+-- Free-text context dispatchers record on an assignment, e.g. why it was made
+ALTER TABLE assignments ADD COLUMN IF NOT EXISTS notes TEXT;
+
+-- Small files kept with an assignment, such as a signed duty sheet. The
+-- content lives in the attachment store under the attachment's ID.
+CREATE TABLE IF NOT EXISTS assignment_attachments (
+    id CHAR(26) PRIMARY KEY,
+    assignment_id INTEGER NOT NULL REFERENCES assignments(id),
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    uploaded_by VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_assignment_attachments_assignment_id
+    ON assignment_attachments (assignment_id, created_at);
@@ -0,0 +1,3 @@
+-- The address of the caller behind each change, as resolved through the
+-- trusted proxies. Entries written before this column existed have none.
+ALTER TABLE assignment_audit ADD COLUMN IF NOT EXISTS client_ip INET;
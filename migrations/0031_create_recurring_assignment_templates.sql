@@ -0,0 +1,21 @@
+-- Crews working the same bus on the same weekdays every week. The generator
+-- turns each week into an assignment ahead of time; generated_through is the
+-- last day it has covered.
+CREATE TABLE IF NOT EXISTS recurring_assignment_templates (
+    id SERIAL PRIMARY KEY,
+    bus_id INTEGER NOT NULL,
+    staff_id INTEGER NOT NULL,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('driver', 'conductor')),
+    working_days SMALLINT NOT NULL DEFAULT 0,
+    shift_start TIME,
+    shift_end TIME,
+    valid_from DATE NOT NULL,
+    valid_until DATE,
+    generated_through DATE,
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (valid_until IS NULL OR valid_until >= valid_from),
+    CONSTRAINT recurring_assignment_templates_shift_times_check
+        CHECK ((shift_start IS NULL) = (shift_end IS NULL) AND (shift_start IS NULL OR shift_end > shift_start))
+);
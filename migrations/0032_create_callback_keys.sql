@@ -0,0 +1,23 @@
+-- Shared secrets counterpart systems sign their callbacks with. Revoked keys
+-- are kept so the actors they name in assignment history stay explained.
+CREATE TABLE IF NOT EXISTS callback_keys (
+    id CHAR(26) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    created_by VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Nonces of accepted callbacks, kept until their timestamp leaves the allowed
+-- window so a replay within it is refused
+CREATE TABLE IF NOT EXISTS callback_nonces (
+    key_id CHAR(26) NOT NULL REFERENCES callback_keys (id),
+    nonce VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (key_id, nonce)
+);
+
+-- Expired nonces are purged as new ones are recorded
+CREATE INDEX IF NOT EXISTS idx_callback_nonces_expires ON callback_nonces (expires_at);
@@ -0,0 +1,4 @@
+-- The depot a scenario's creator was scoped to, so callers scoped to another
+-- depot can't see or apply it. Scenarios created before this column existed
+-- have none, and are only visible to callers working across depots.
+ALTER TABLE scenarios ADD COLUMN IF NOT EXISTS depot_id VARCHAR(50);
@@ -0,0 +1,4 @@
+-- Supports rebuilding the assignments on a bus, or of a staff member, as the
+-- audit trail had them at a past time
+CREATE INDEX IF NOT EXISTS idx_assignment_audit_bus_id ON assignment_audit(((after->>'bus_id')::int));
+CREATE INDEX IF NOT EXISTS idx_assignment_audit_staff_id ON assignment_audit(((after->>'staff_id')::int));
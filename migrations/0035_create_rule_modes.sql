@@ -0,0 +1,8 @@
+-- Blocking rule modes declared through /config/rules, which every instance
+-- applies in place of RULE_SHADOW. Rules without a row follow RULE_SHADOW.
+CREATE TABLE IF NOT EXISTS rule_modes (
+    rule VARCHAR(100) PRIMARY KEY,
+    mode VARCHAR(20) NOT NULL CHECK (mode IN ('enforced', 'shadow')),
+    shadow_until TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
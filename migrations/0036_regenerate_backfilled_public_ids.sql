@@ -0,0 +1,91 @@
+-- Migration 0014 backfilled the public IDs of existing assignments with
+-- random(), which isn't cryptographically secure, so those IDs could be
+-- guessed from one another. Regenerate every ID it made up, keeping the
+-- creation time, with the random part from pgcrypto's secure generator.
+-- IDs the service generated after 0014 are left alone.
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+CREATE OR REPLACE FUNCTION pg_temp.secure_ulid(ts TIMESTAMP WITH TIME ZONE) RETURNS CHAR(26) AS $$
+DECLARE
+    alphabet CONSTANT TEXT := '0123456789ABCDEFGHJKMNPQRSTVWXYZ';
+    ms BIGINT := floor(extract(epoch FROM ts) * 1000);
+    randomness CONSTANT BYTEA := gen_random_bytes(10);
+    chunk BIGINT;
+    part TEXT;
+    result TEXT := '';
+BEGIN
+    FOR i IN 1..10 LOOP
+        result := substr(alphabet, (ms % 32)::INTEGER + 1, 1) || result;
+        ms := ms / 32;
+    END LOOP;
+    -- 80 random bits, encoded 40 at a time
+    FOR half IN 0..1 LOOP
+        chunk := 0;
+        FOR b IN 0..4 LOOP
+            chunk := chunk * 256 + get_byte(randomness, half * 5 + b);
+        END LOOP;
+        part := '';
+        FOR i IN 1..8 LOOP
+            part := substr(alphabet, (chunk % 32)::INTEGER + 1, 1) || part;
+            chunk := chunk / 32;
+        END LOOP;
+        result := result || part;
+    END LOOP;
+    RETURN result;
+END
+$$ LANGUAGE plpgsql VOLATILE;
+
+-- 0014 backfilled the assignments that existed when it ran, and made up IDs
+-- in the audit trail for assignments deleted before then
+CREATE TEMPORARY TABLE weak_public_ids ON COMMIT DROP AS
+SELECT a.public_id AS old_id, pg_temp.secure_ulid(a.created_at) AS new_id
+FROM assignments a, schema_migrations m
+WHERE m.version = 14 AND a.created_at < m.applied_at;
+
+INSERT INTO weak_public_ids (old_id, new_id)
+SELECT au.assignment_public_id, pg_temp.secure_ulid(min(au.changed_at))
+FROM assignment_audit au, schema_migrations m
+WHERE m.version = 14
+    AND NOT EXISTS (SELECT 1 FROM assignments a WHERE a.id = au.assignment_id)
+GROUP BY au.assignment_public_id, m.applied_at
+HAVING min(au.changed_at) < m.applied_at;
+
+CREATE UNIQUE INDEX ON weak_public_ids (old_id);
+
+UPDATE assignments a
+SET public_id = w.new_id
+FROM weak_public_ids w
+WHERE a.public_id = w.old_id;
+
+UPDATE assignment_audit au
+SET assignment_public_id = w.new_id,
+    before = CASE WHEN before IS NULL THEN NULL ELSE jsonb_set(before, '{id}', to_jsonb(w.new_id)) END,
+    after = CASE WHEN after IS NULL THEN NULL ELSE jsonb_set(after, '{id}', to_jsonb(w.new_id)) END
+FROM weak_public_ids w
+WHERE au.assignment_public_id = w.old_id;
+
+UPDATE assignment_outbox o
+SET payload = jsonb_set(o.payload, '{id}', to_jsonb(w.new_id))
+FROM weak_public_ids w
+WHERE o.payload->>'id' = w.old_id;
+
+UPDATE notifications n
+SET assignment_id = w.new_id
+FROM weak_public_ids w
+WHERE n.assignment_id = w.old_id;
+
+-- Scenarios still to be applied find their live copies by public ID
+UPDATE scenarios s
+SET assignments = (
+        SELECT COALESCE(jsonb_agg(CASE WHEN w.new_id IS NULL THEN e
+            ELSE jsonb_set(e, '{id}', to_jsonb(w.new_id)) END ORDER BY ord), '[]'::jsonb)
+        FROM jsonb_array_elements(s.assignments) WITH ORDINALITY AS x(e, ord)
+        LEFT JOIN weak_public_ids w ON w.old_id = e->>'id'
+    ),
+    removed = (
+        SELECT COALESCE(jsonb_agg(CASE WHEN w.new_id IS NULL THEN e
+            ELSE jsonb_set(e, '{id}', to_jsonb(w.new_id)) END ORDER BY ord), '[]'::jsonb)
+        FROM jsonb_array_elements(s.removed) WITH ORDINALITY AS x(e, ord)
+        LEFT JOIN weak_public_ids w ON w.old_id = e->>'id'
+    )
+WHERE s.status IN ('draft', 'applying');
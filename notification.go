@@ -0,0 +1,723 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+)
+
+// Notification channels
+const (
+	NotificationEmail   = "email"
+	NotificationWebhook = "webhook"
+)
+
+// Notification statuses
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed" // gave up after maxNotificationAttempts
+)
+
+// maxNotificationAttempts is how many times a notification is sent before it
+// is left failed
+const maxNotificationAttempts = 8
+
+const notificationBatchSize = 50
+
+// errNotificationNotFailed is returned when retrying a notification that
+// hasn't been given up on
+var errNotificationNotFailed = errors.New("notification has not failed")
+
+// NotificationChannels are where a staff member is told about changes to
+// their assignments. Either may be left empty.
+type NotificationChannels struct {
+	StaffID    int       `json:"staff_id"`
+	Email      string    `json:"email,omitempty"`
+	WebhookURL string    `json:"webhook_url,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// normalize trims and validates the channels, returning a client-facing error
+func (n *NotificationChannels) normalize() error {
+	n.Email = strings.TrimSpace(n.Email)
+	n.WebhookURL = strings.TrimSpace(n.WebhookURL)
+	if n.Email == "" && n.WebhookURL == "" {
+		return fmt.Errorf("set email, webhook_url or both")
+	}
+	if n.Email != "" {
+		address, err := mail.ParseAddress(n.Email)
+		if err != nil || address.Address != n.Email {
+			return fmt.Errorf("email must be a plain address such as driver@example.com")
+		}
+	}
+	if n.WebhookURL != "" {
+		parsed, err := url.Parse(n.WebhookURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("webhook_url must be an absolute http or https URL")
+		}
+	}
+	return nil
+}
+
+// Notification is one message queued for a staff member about an assignment
+// change. Failed sends are retried with a growing delay.
+type Notification struct {
+	ID            int64      `json:"id"`
+	StaffID       int        `json:"staff_id"`
+	Channel       string     `json:"channel"`
+	Recipient     string     `json:"recipient"` // email address or webhook URL
+	EventType     string     `json:"event_type"`
+	AssignmentID  string     `json:"assignment_id"` // public ID
+	Subject       string     `json:"subject"`
+	Body          string     `json:"body"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+// NotificationFilter narrows the notification queue listing; zero values
+// match everything
+type NotificationFilter struct {
+	StaffID int
+	Status  string
+}
+
+// NotificationRepository stores staff members' notification channels and the
+// notification queue. Notifications are queued by the assignment writes
+// themselves, inside their transactions.
+type NotificationRepository interface {
+	GetChannels(staffID int) (*NotificationChannels, error) // nil, nil when the staff member has none
+	ListChannels() ([]NotificationChannels, error)          // ordered by staff ID
+	// PutChannels creates or replaces a staff member's channels, leaving them
+	// untouched when nothing differs
+	PutChannels(channels *NotificationChannels) (created, changed bool, err error)
+	DeleteChannels(staffID int) (bool, error)
+	List(filter NotificationFilter) ([]Notification, error) // newest first
+	Retry(id int64) (*Notification, error)                  // nil, nil when not found; errNotificationNotFailed unless failed
+
+	WithContext(ctx context.Context) NotificationRepository
+}
+
+// notificationTemplate renders one event's subject and body
+type notificationTemplate struct {
+	subject, body *template.Template
+}
+
+// defaultNotificationTemplates are used for events without a template in
+// NOTIFICATION_TEMPLATE_DIR
+var defaultNotificationTemplates = map[string]string{
+	EventAssignmentCreated: `New assignment: {{.Role}} on bus {{.Bus}} from {{.StartDate}}
+Hello {{.StaffName}},
+
+You have been assigned as {{.Role}} on bus {{.Bus}} from {{.StartDate}}{{if .EndDate}} to {{.EndDate}}{{end}}.
+{{- if .Shift}}
+Shift: {{.Shift}}{{end}}
+{{- if .WorkingDays}}
+Working days: {{.WorkingDays}}{{end}}
+
+Reference: {{.Reference}}
+`,
+	EventAssignmentUpdated: `Assignment changed: {{.Role}} on bus {{.Bus}}
+Hello {{.StaffName}},
+
+Your assignment {{.Reference}} has changed. You are now {{.Role}} on bus {{.Bus}} from {{.StartDate}}{{if .EndDate}} to {{.EndDate}}{{end}}.
+{{- if .Shift}}
+Shift: {{.Shift}}{{end}}
+{{- if .WorkingDays}}
+Working days: {{.WorkingDays}}{{end}}
+Status: {{.Status}}
+`,
+	EventAssignmentCancelled: `Assignment cancelled: {{.Role}} on bus {{.Bus}}
+Hello {{.StaffName}},
+
+Your assignment {{.Reference}} as {{.Role}} on bus {{.Bus}} from {{.StartDate}}{{if .EndDate}} to {{.EndDate}}{{end}} has been cancelled.
+`,
+}
+
+// notificationTemplates holds the parsed templates by event; main loads them
+// with LoadNotificationTemplates
+var notificationTemplates = mustParseNotificationTemplates(defaultNotificationTemplates)
+
+// parseNotificationTemplate splits a template into its first line, the
+// subject, and the rest, the body
+func parseNotificationTemplate(eventType, text string) (*notificationTemplate, error) {
+	subject, body, _ := strings.Cut(text, "\n")
+	subjectTemplate, err := template.New(eventType + " subject").Option("missingkey=error").Parse(subject)
+	if err != nil {
+		return nil, err
+	}
+	bodyTemplate, err := template.New(eventType).Option("missingkey=error").Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	return &notificationTemplate{subject: subjectTemplate, body: bodyTemplate}, nil
+}
+
+func mustParseNotificationTemplates(texts map[string]string) map[string]*notificationTemplate {
+	templates := map[string]*notificationTemplate{}
+	for eventType, text := range texts {
+		parsed, err := parseNotificationTemplate(eventType, text)
+		if err != nil {
+			panic(err)
+		}
+		templates[eventType] = parsed
+	}
+	return templates
+}
+
+// LoadNotificationTemplates reads <event type>.tmpl files, such as
+// assignment.created.tmpl, from NOTIFICATION_TEMPLATE_DIR over the defaults.
+// A template that doesn't parse is logged and the default kept.
+func LoadNotificationTemplates() map[string]*notificationTemplate {
+	templates := mustParseNotificationTemplates(defaultNotificationTemplates)
+	dir := os.Getenv("NOTIFICATION_TEMPLATE_DIR")
+	if dir == "" {
+		return templates
+	}
+	for eventType := range defaultNotificationTemplates {
+		path := filepath.Join(dir, eventType+".tmpl")
+		text, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err == nil {
+			var parsed *notificationTemplate
+			if parsed, err = parseNotificationTemplate(eventType, string(text)); err == nil {
+				templates[eventType] = parsed
+				continue
+			}
+		}
+		log.Printf("Ignoring notification template %s: %v", path, err)
+	}
+	return templates
+}
+
+// notificationData is what templates can refer to
+type notificationData struct {
+	Event       string
+	StaffName   string
+	Bus         string // plate number, or the bus ID when unknown
+	Role        string
+	StartDate   string // YYYY-MM-DD
+	EndDate     string // empty when open-ended
+	Shift       string // HH:MM-HH:MM, empty for the whole day
+	WorkingDays string // empty when every day
+	Status      string
+	Reference   string
+}
+
+func newNotificationData(eventType string, assignment *Assignment) notificationData {
+	data := notificationData{
+		Event:     eventType,
+		StaffName: fmt.Sprintf("staff member %d", assignment.StaffID),
+		Bus:       strconv.Itoa(assignment.BusID),
+		Role:      assignment.Role,
+		StartDate: assignment.StartDate.Format("2006-01-02"),
+		Status:    assignment.Status,
+		Reference: assignment.Reference,
+	}
+	if staff := lookupStaff(assignment.StaffID); staff != nil {
+		data.StaffName = staff["name"]
+	}
+	if bus := lookupBus(assignment.BusID); bus != nil {
+		data.Bus = bus["plate_number"]
+	}
+	if assignment.EndDate != nil {
+		data.EndDate = assignment.EndDate.Format("2006-01-02")
+	}
+	if assignment.ShiftStart != nil && assignment.ShiftEnd != nil {
+		data.Shift = assignment.ShiftStart.String() + "-" + assignment.ShiftEnd.String()
+	}
+	data.WorkingDays = strings.Join(assignment.WorkingDays.Days(), ", ")
+	return data
+}
+
+// renderNotification fills in the event's template for the assignment
+func renderNotification(eventType string, assignment *Assignment) (subject, body string, err error) {
+	tmpl, exists := notificationTemplates[eventType]
+	if !exists {
+		return "", "", fmt.Errorf("no notification template for %s", eventType)
+	}
+	data := newNotificationData(eventType, assignment)
+	var subjectBuf, bodyBuf bytes.Buffer
+	if err := tmpl.subject.Execute(&subjectBuf, data); err != nil {
+		return "", "", err
+	}
+	if err := tmpl.body.Execute(&bodyBuf, data); err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(subjectBuf.String()), bodyBuf.String(), nil
+}
+
+// queueNotificationsTx queues a notification on each of the staff member's
+// channels within the transaction making the change, so staff are told about
+// exactly the changes that commit
+func queueNotificationsTx(ctx context.Context, tx pgx.Tx, eventType string, assignment *Assignment) error {
+	var email, webhookURL string
+	err := tx.QueryRow(ctx,
+		`SELECT COALESCE(email, ''), COALESCE(webhook_url, '') FROM staff_notification_channels WHERE staff_id = $1`,
+		assignment.StaffID).Scan(&email, &webhookURL)
+	if err == pgx.ErrNoRows {
+		return nil // Nowhere to send it
+	}
+	if err != nil {
+		return err
+	}
+
+	subject, body, err := renderNotification(eventType, assignment)
+	if err != nil {
+		return err
+	}
+	for _, channel := range []struct{ name, recipient string }{{NotificationEmail, email}, {NotificationWebhook, webhookURL}} {
+		if channel.recipient == "" {
+			continue
+		}
+		_, err := tx.Exec(ctx, `
+			INSERT INTO notifications (staff_id, channel, recipient, event_type, assignment_id, subject, body)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, assignment.StaffID, channel.name, channel.recipient, eventType, assignment.PublicID, subject, body)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Notifier delivers notifications over one channel
+type Notifier interface {
+	Send(ctx context.Context, notification *Notification) error
+}
+
+// smtpNotifier sends notifications as plain-text email
+type smtpNotifier struct {
+	addr string // host:port
+	from string
+	auth smtp.Auth
+}
+
+func (n *smtpNotifier) Send(_ context.Context, notification *Notification) error {
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", n.from)
+	fmt.Fprintf(&message, "To: %s\r\n", notification.Recipient)
+	fmt.Fprintf(&message, "Subject: %s\r\n", mimeHeader(notification.Subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "Message-ID: <notification-%d@%s>\r\n", notification.ID, serviceName)
+	message.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	message.WriteString(strings.ReplaceAll(notification.Body, "\n", "\r\n"))
+	return smtp.SendMail(n.addr, n.auth, n.from, []string{notification.Recipient}, message.Bytes())
+}
+
+// mimeHeader encodes a header value that isn't plain ASCII
+func mimeHeader(value string) string {
+	for i := 0; i < len(value); i++ {
+		if value[i] >= 0x80 {
+			return mime.QEncoding.Encode("UTF-8", value)
+		}
+	}
+	return value
+}
+
+// webhookNotifier posts notifications as JSON to the staff member's URL
+type webhookNotifier struct {
+	client *http.Client
+}
+
+// webhookPayload is the body posted to a staff member's webhook
+type webhookPayload struct {
+	ID           int64  `json:"id"`
+	StaffID      int    `json:"staff_id"`
+	EventType    string `json:"event_type"`
+	AssignmentID string `json:"assignment_id"`
+	Subject      string `json:"subject"`
+	Body         string `json:"body"`
+}
+
+func (n *webhookNotifier) Send(ctx context.Context, notification *Notification) error {
+	data, err := json.Marshal(webhookPayload{
+		ID:           notification.ID,
+		StaffID:      notification.StaffID,
+		EventType:    notification.EventType,
+		AssignmentID: notification.AssignmentID,
+		Subject:      notification.Subject,
+		Body:         notification.Body,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, notification.Recipient, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// Retries resend the same key, so the receiver can discard repeats
+	req.Header.Set("Idempotency-Key", fmt.Sprintf("notification-%d", notification.ID))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// LoadNotifiers builds a notifier for each configured channel. Email needs
+// SMTP_ADDR (host:port) and SMTP_FROM, with SMTP_USERNAME and SMTP_PASSWORD
+// when the server requires them. Webhooks time out after
+// NOTIFICATION_WEBHOOK_TIMEOUT (default 10s).
+func LoadNotifiers() map[string]Notifier {
+	notifiers := map[string]Notifier{
+		NotificationWebhook: &webhookNotifier{
+			client: &http.Client{Timeout: durationFromEnv("NOTIFICATION_WEBHOOK_TIMEOUT", 10*time.Second)},
+		},
+	}
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		notifier := &smtpNotifier{addr: addr, from: os.Getenv("SMTP_FROM")}
+		if username := os.Getenv("SMTP_USERNAME"); username != "" {
+			host, _, _ := strings.Cut(addr, ":")
+			notifier.auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		notifiers[NotificationEmail] = notifier
+	}
+	return notifiers
+}
+
+// notificationBackoff is how long to wait before another attempt after the
+// given number of failures: a minute, doubling up to an hour
+func notificationBackoff(attempts int) time.Duration {
+	delay := time.Minute
+	for i := 1; i < attempts && delay < time.Hour; i++ {
+		delay *= 2
+	}
+	return min(delay, time.Hour)
+}
+
+// NotificationSender delivers queued notifications, retrying failures with
+// backoff until maxNotificationAttempts
+type NotificationSender struct {
+	notifiers map[string]Notifier
+	interval  time.Duration
+}
+
+// NewNotificationSender creates a sender polling every
+// NOTIFICATION_POLL_INTERVAL (default 10s)
+func NewNotificationSender(notifiers map[string]Notifier) *NotificationSender {
+	return &NotificationSender{notifiers: notifiers, interval: durationFromEnv("NOTIFICATION_POLL_INTERVAL", 10*time.Second)}
+}
+
+// Run sends due notifications until the context is cancelled
+func (s *NotificationSender) Run(ctx context.Context) {
+	monitor := backgroundWorkers.Register("notification_sender", tickerStallAfter(s.interval),
+		countQueue(`SELECT count(*) FROM notifications WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP`))
+	defer backgroundWorkers.Unregister("notification_sender")
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.sendBatch(ctx)
+			monitor.Record(err)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Notification sender error: %v", err)
+			}
+		}
+	}
+}
+
+// notificationColumns are selected by every notification query, in scanNotification order
+const notificationColumns = `id, staff_id, channel, recipient, event_type, assignment_id, subject, body, status,
+	attempts, next_attempt_at, COALESCE(last_error, ''), created_at, sent_at`
+
+func scanNotification(row pgx.Row, n *Notification) error {
+	return row.Scan(&n.ID, &n.StaffID, &n.Channel, &n.Recipient, &n.EventType, &n.AssignmentID, &n.Subject, &n.Body,
+		&n.Status, &n.Attempts, &n.NextAttemptAt, &n.LastError, &n.CreatedAt, &n.SentAt)
+}
+
+// sendBatch sends the notifications that are due. Rows are locked while they
+// are sent, so replicas share the queue without sending anything twice.
+func (s *NotificationSender) sendBatch(ctx context.Context) error {
+	return pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		query := `
+			SELECT ` + notificationColumns + `
+			FROM notifications
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		`
+		rows, err := tx.Query(ctx, query, notificationBatchSize)
+		if err != nil {
+			return err
+		}
+		var due []Notification
+		for rows.Next() {
+			var notification Notification
+			if err := scanNotification(rows, &notification); err != nil {
+				rows.Close()
+				return err
+			}
+			due = append(due, notification)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for i := range due {
+			if err := s.send(ctx, tx, &due[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// send delivers one notification and records the outcome
+func (s *NotificationSender) send(ctx context.Context, tx pgx.Tx, notification *Notification) error {
+	var sendErr error
+	if notifier, exists := s.notifiers[notification.Channel]; exists {
+		sendErr = notifier.Send(ctx, notification)
+	} else {
+		sendErr = fmt.Errorf("no %s notifier is configured", notification.Channel)
+	}
+
+	if sendErr == nil {
+		_, err := tx.Exec(ctx, `
+			UPDATE notifications
+			SET status = 'sent', attempts = attempts + 1, last_error = NULL, sent_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+		`, notification.ID)
+		return err
+	}
+
+	attempts := notification.Attempts + 1
+	status := NotificationPending
+	if attempts >= maxNotificationAttempts {
+		status = NotificationFailed
+		log.Printf("Giving up on notification %d to staff member %d after %d attempts: %v", notification.ID,
+			notification.StaffID, attempts, sendErr)
+	} else {
+		log.Printf("Failed to send notification %d (%s), will retry: %v", notification.ID, notification.Channel, sendErr)
+	}
+	_, err := tx.Exec(ctx, `
+		UPDATE notifications
+		SET status = $2, attempts = $3, last_error = $4,
+			next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $5)
+		WHERE id = $1
+	`, notification.ID, status, attempts, sendErr.Error(), notificationBackoff(attempts).Seconds())
+	return err
+}
+
+// NotificationHandler serves the notification endpoints
+type NotificationHandler struct {
+	notifications NotificationRepository
+}
+
+// NewNotificationHandler creates a handler backed by the given repository
+func NewNotificationHandler(notifications NotificationRepository) *NotificationHandler {
+	return &NotificationHandler{notifications: notifications}
+}
+
+// forRequest returns the handler with its repositories bound to the request's context
+func (h *NotificationHandler) forRequest(c *gin.Context) *NotificationHandler {
+	ctx := c.Request.Context()
+	return &NotificationHandler{notifications: h.notifications.WithContext(ctx)}
+}
+
+// staffIDFromParam parses the :staffId path parameter, returning false once a
+// 400 has been written
+func staffIDFromParam(c *gin.Context) (int, bool) {
+	staffID, err := strconv.Atoi(c.Param("staffId"))
+	if err != nil || staffID <= 0 {
+		respondError(c, http.StatusBadRequest, "Invalid staff ID")
+		return 0, false
+	}
+	return staffID, true
+}
+
+func (h *NotificationHandler) handleGetNotificationChannels(c *gin.Context) {
+	h = h.forRequest(c)
+	staffID, ok := staffIDFromParam(c)
+	if !ok {
+		return
+	}
+	channels, err := h.notifications.GetChannels(staffID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve notification channels")
+		return
+	}
+	if channels == nil {
+		respondError(c, http.StatusNotFound, "Staff member has no notification channels")
+		return
+	}
+	c.JSON(http.StatusOK, channels)
+}
+
+// handlePutNotificationChannels sets where a staff member is notified,
+// replacing any channels set before
+func (h *NotificationHandler) handlePutNotificationChannels(c *gin.Context) {
+	h = h.forRequest(c)
+	staffID, ok := staffIDFromParam(c)
+	if !ok {
+		return
+	}
+	var channels NotificationChannels
+	if err := c.ShouldBindJSON(&channels); err != nil {
+		respondBindError(c, &channels, err)
+		return
+	}
+	if err := channels.normalize(); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	channels.StaffID = staffID
+
+	if _, _, err := h.notifications.PutChannels(&channels); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to save notification channels")
+		return
+	}
+	c.JSON(http.StatusOK, channels)
+}
+
+// handleGetDeclaredNotificationChannels lists every staff member's channels
+func (h *NotificationHandler) handleGetDeclaredNotificationChannels(c *gin.Context) {
+	h = h.forRequest(c)
+	channels, err := h.notifications.ListChannels()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve notification channels")
+		return
+	}
+	if channels == nil {
+		channels = []NotificationChannels{}
+	}
+	c.JSON(http.StatusOK, gin.H{"channels": channels, "count": len(channels)})
+}
+
+// handlePutDeclaredNotificationChannels declares where a staff member is
+// notified: 201 when they had no channels, 200 when they are replaced or
+// already match
+func (h *NotificationHandler) handlePutDeclaredNotificationChannels(c *gin.Context) {
+	h = h.forRequest(c)
+	staffID, ok := staffIDFromParam(c)
+	if !ok {
+		return
+	}
+	var channels NotificationChannels
+	if err := c.ShouldBindJSON(&channels); err != nil {
+		respondBindError(c, &channels, err)
+		return
+	}
+	if err := channels.normalize(); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	channels.StaffID = staffID
+
+	created, changed, err := h.notifications.PutChannels(&channels)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to save notification channels")
+		return
+	}
+
+	c.Header("X-Config-Changed", strconv.FormatBool(changed))
+	if created {
+		c.JSON(http.StatusCreated, channels)
+		return
+	}
+	c.JSON(http.StatusOK, channels)
+}
+
+// handleDeleteNotificationChannels stops notifications to a staff member.
+// Notifications already queued are still sent.
+func (h *NotificationHandler) handleDeleteNotificationChannels(c *gin.Context) {
+	h = h.forRequest(c)
+	staffID, ok := staffIDFromParam(c)
+	if !ok {
+		return
+	}
+	if _, err := h.notifications.DeleteChannels(staffID); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to delete notification channels")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *NotificationHandler) handleGetNotifications(c *gin.Context) {
+	h = h.forRequest(c)
+	var filter NotificationFilter
+	if value := c.Query("staff_id"); value != "" {
+		staffID, err := strconv.Atoi(value)
+		if err != nil {
+			respondInvalidField(c, "staff_id", "Invalid staff_id")
+			return
+		}
+		filter.StaffID = staffID
+	}
+	switch filter.Status = c.Query("status"); filter.Status {
+	case "", NotificationPending, NotificationSent, NotificationFailed:
+	default:
+		respondInvalidField(c, "status", "status must be 'pending', 'sent' or 'failed'")
+		return
+	}
+
+	notifications, err := h.notifications.List(filter)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve notifications")
+		return
+	}
+	if notifications == nil {
+		notifications = []Notification{}
+	}
+	c.JSON(http.StatusOK, gin.H{"notifications": notifications, "count": len(notifications)})
+}
+
+// handleRetryNotification queues a failed notification to be sent again
+// straight away, with a fresh set of attempts
+func (h *NotificationHandler) handleRetryNotification(c *gin.Context) {
+	h = h.forRequest(c)
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid notification ID")
+		return
+	}
+	notification, err := h.notifications.Retry(id)
+	if err != nil {
+		if errors.Is(err, errNotificationNotFailed) {
+			respondError(c, http.StatusConflict, "Only failed notifications can be retried")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Failed to retry notification")
+		return
+	}
+	if notification == nil {
+		respondError(c, http.StatusNotFound, "Notification not found")
+		return
+	}
+	c.JSON(http.StatusOK, notification)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRenderNotificationUsesTemplates(t *testing.T) {
+	end := date("2025-03-09")
+	assignment := &Assignment{BusID: 1, StaffID: 2, Role: "conductor", StartDate: date("2025-03-03"), EndDate: &end,
+		Status: "active", Reference: "BSA-2025-000042"}
+
+	subject, body, err := renderNotification(EventAssignmentCreated, assignment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "New assignment: conductor on bus ABC-1234 from 2025-03-03" {
+		t.Errorf("subject = %q", subject)
+	}
+	if !strings.Contains(body, "Hello Jane Conductor") || !strings.Contains(body, "to 2025-03-09") {
+		t.Errorf("body = %q, want the staff name and end date", body)
+	}
+
+	// A template in NOTIFICATION_TEMPLATE_DIR replaces the default for its event
+	dir := t.TempDir()
+	custom := "Cancelled: {{.Reference}}\nBus {{.Bus}} is no longer yours.\n"
+	if err := os.WriteFile(filepath.Join(dir, "assignment.cancelled.tmpl"), []byte(custom), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NOTIFICATION_TEMPLATE_DIR", dir)
+	previous := notificationTemplates
+	notificationTemplates = LoadNotificationTemplates()
+	t.Cleanup(func() { notificationTemplates = previous })
+
+	subject, body, err = renderNotification(EventAssignmentCancelled, assignment)
+	if err != nil || subject != "Cancelled: BSA-2025-000042" || body != "Bus ABC-1234 is no longer yours.\n" {
+		t.Errorf("custom template = %q %q %v", subject, body, err)
+	}
+	if subject, _, _ := renderNotification(EventAssignmentCreated, assignment); !strings.HasPrefix(subject, "New assignment") {
+		t.Errorf("created subject = %q, want the default kept", subject)
+	}
+}
+
+func TestWebhookNotifierAndBackoff(t *testing.T) {
+	var payload webhookPayload
+	var key string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key = r.Header.Get("Idempotency-Key")
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		if payload.StaffID == 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	notifier := &webhookNotifier{client: server.Client()}
+	notification := &Notification{ID: 7, StaffID: 2, Recipient: server.URL, EventType: EventAssignmentUpdated,
+		Subject: "Assignment changed"}
+	if err := notifier.Send(context.Background(), notification); err != nil {
+		t.Fatal(err)
+	}
+	if key != "notification-7" || payload.Subject != "Assignment changed" {
+		t.Errorf("webhook got key %q and payload %+v", key, payload)
+	}
+	notification.StaffID = 3
+	if err := notifier.Send(context.Background(), notification); err == nil {
+		t.Error("expected an error for a 502 response")
+	}
+
+	for attempts, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 4: 8 * time.Minute, 7: time.Hour} {
+		if got := notificationBackoff(attempts); got != want {
+			t.Errorf("backoff after %d attempts = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestNotificationChannelEndpoints(t *testing.T) {
+	router, _ := newTestRouter(t)
+	path := "/api/staff/2/notification-channels"
+
+	if rec := doRequest(router, http.MethodGet, path, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("get before put status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	for _, body := range []gin.H{{}, {"email": "Jane <jane@example.com>"}, {"webhook_url": "ftp://example.com"}} {
+		if rec := doRequest(router, http.MethodPut, path, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("put %v status = %d, want %d", body, rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	rec := doRequest(router, http.MethodPut, path, gin.H{"email": " jane@example.com "})
+	if saved := decode[NotificationChannels](t, rec); rec.Code != http.StatusOK || saved.StaffID != 2 || saved.Email != "jane@example.com" {
+		t.Fatalf("put = %d %+v, want the trimmed address saved", rec.Code, saved)
+	}
+	if got := decode[NotificationChannels](t, doRequest(router, http.MethodGet, path, nil)); got.Email != "jane@example.com" {
+		t.Errorf("get = %+v", got)
+	}
+	if rec := doRequest(router, http.MethodDelete, path, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("delete status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if rec := doRequest(router, http.MethodGet, path, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("get after delete status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	if rec := doRequest(router, http.MethodGet, "/api/notifications?status=lost", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("list with bad status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := doRequest(router, http.MethodPost, "/api/notifications/99/retry", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("retry unknown status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestDeclaredNotificationChannels(t *testing.T) {
+	router, _ := newTestRouter(t)
+	path := "/api/v1/config/notification-channels/2"
+
+	rec := doRequest(router, http.MethodPut, path, gin.H{"email": "jane@example.com"})
+	if rec.Code != http.StatusCreated || rec.Header().Get("X-Config-Changed") != "true" {
+		t.Fatalf("first PUT = %d %s, want 201 changed", rec.Code, rec.Body.String())
+	}
+	rec = doRequest(router, http.MethodPut, path, gin.H{"email": " jane@example.com "})
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Config-Changed") != "false" {
+		t.Errorf("repeated PUT = %d, X-Config-Changed %s; want 200 unchanged", rec.Code,
+			rec.Header().Get("X-Config-Changed"))
+	}
+	rec = doRequest(router, http.MethodPut, path, gin.H{"webhook_url": "https://hooks.example.com/staff/2"})
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Config-Changed") != "true" {
+		t.Errorf("replacing PUT = %d %s, want 200 changed", rec.Code, rec.Body.String())
+	}
+	if got := decode[NotificationChannels](t, doRequest(router, http.MethodGet, path, nil)); got.Email != "" ||
+		got.WebhookURL != "https://hooks.example.com/staff/2" {
+		t.Errorf("get = %+v, want the webhook alone", got)
+	}
+
+	doRequest(router, http.MethodPut, "/api/v1/config/notification-channels/1", gin.H{"email": "ana@example.com"})
+	listed := decode[struct {
+		Channels []NotificationChannels `json:"channels"`
+		Count    int                    `json:"count"`
+	}](t, doRequest(router, http.MethodGet, "/api/v1/config/notification-channels", nil))
+	if listed.Count != 2 || listed.Channels[0].StaffID != 1 {
+		t.Errorf("listed = %+v, want both staff members, by ID", listed)
+	}
+
+	for range 2 {
+		if rec := doRequest(router, http.MethodDelete, path, nil); rec.Code != http.StatusNoContent {
+			t.Errorf("DELETE = %d, want 204", rec.Code)
+		}
+	}
+	if rec := doRequest(router, http.MethodPut, "/api/v1/config/notification-channels/ana",
+		gin.H{"email": "ana@example.com"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("PUT with a bad staff ID = %d, want 400", rec.Code)
+	}
+}
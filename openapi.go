@@ -0,0 +1,59 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed openapi.yaml
+var openAPIYAML []byte
+
+//go:embed docs
+var docsFiles embed.FS
+
+// openAPIJSON converts the embedded spec once, on first request
+var openAPIJSON = sync.OnceValues(func() ([]byte, error) {
+	var spec map[string]any
+	if err := yaml.Unmarshal(openAPIYAML, &spec); err != nil {
+		return nil, err
+	}
+	return json.Marshal(spec)
+})
+
+// handleGetOpenAPI serves the OpenAPI spec as JSON. It is public, like the
+// health endpoints: it describes the API but holds no data.
+func handleGetOpenAPI(c *gin.Context) {
+	spec, err := openAPIJSON()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to load the API specification")
+		return
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "application/json", spec)
+}
+
+// serveAPIDocs serves Swagger UI at /docs/, rendering /api/openapi.json.
+// The page and its setup script are embedded from docs/; Swagger UI itself
+// is loaded from a pinned jsDelivr release.
+func serveAPIDocs(router *gin.Engine) {
+	assets, err := fs.Sub(docsFiles, "docs")
+	if err != nil {
+		panic(err) // the directory is embedded at build time
+	}
+
+	docs := router.Group("/docs", func(c *gin.Context) {
+		c.Header("Content-Security-Policy", "default-src 'self'; script-src 'self' https://cdn.jsdelivr.net; "+
+			"style-src 'self' 'unsafe-inline' https://cdn.jsdelivr.net; img-src 'self' data:; frame-ancestors 'none'")
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Referrer-Policy", "no-referrer")
+		c.Header("Cache-Control", "no-cache")
+		c.Next()
+	})
+	docs.StaticFS("/", http.FS(assets))
+}
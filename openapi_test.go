@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	router := gin.New()
+	setupRoutes(router, AuthConfig{Secret: []byte("test-secret")}, NewMemoryStorage())
+
+	rec := doRequest(router, http.MethodGet, "/api/openapi.json", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/openapi.json without a token: status %d", rec.Code)
+	}
+	var spec struct {
+		OpenAPI string                    `json:"openapi"`
+		Paths   map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("spec is not JSON: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("openapi = %q, want a 3.x document", spec.OpenAPI)
+	}
+
+	// Every API route must be documented, so the spec can't drift from the
+	// router. The unversioned aliases must each match a v1 route instead.
+	param := regexp.MustCompile(`:(\w+)`)
+	routes := map[string]bool{}
+	for _, route := range router.Routes() {
+		routes[route.Method+" "+route.Path] = true
+	}
+	for _, route := range router.Routes() {
+		if !strings.HasPrefix(route.Path, "/api/") && !strings.HasPrefix(route.Path, "/health") &&
+			route.Path != "/readyz" {
+			continue
+		}
+		if strings.HasPrefix(route.Path, "/api/") && !strings.HasPrefix(route.Path, "/api/v1/") &&
+			route.Path != "/api/openapi.json" {
+			if !routes[route.Method+" /api/v1"+strings.TrimPrefix(route.Path, "/api")] {
+				t.Errorf("%s %s has no v1 route", route.Method, route.Path)
+			}
+			continue
+		}
+		path := param.ReplaceAllString(route.Path, "{$1}")
+		if _, ok := spec.Paths[path][strings.ToLower(route.Method)]; !ok {
+			t.Errorf("%s %s is not in openapi.yaml", route.Method, path)
+		}
+	}
+}
+
+func TestAPIDocs(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	rec := doRequest(router, http.MethodGet, "/docs/", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /docs/: status %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `<script src="init.js"`) {
+		t.Errorf("GET /docs/ did not return the Swagger UI page: %s", rec.Body.String())
+	}
+	if csp := rec.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "frame-ancestors 'none'") {
+		t.Errorf("Content-Security-Policy = %q, want framing refused", csp)
+	}
+	if rec := doRequest(router, http.MethodGet, "/docs/init.js", nil); rec.Code != http.StatusOK {
+		t.Errorf("GET /docs/init.js: status %d", rec.Code)
+	}
+}
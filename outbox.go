@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const outboxBatchSize = 100
+
+// OutboxRelay forwards committed events from the outbox table to the broker.
+// Events that fail to publish stay in the outbox and are retried on the next
+// tick, so a briefly unavailable broker delays events without losing them.
+type OutboxRelay struct {
+	publisher EventPublisher
+	interval  time.Duration
+}
+
+// NewOutboxRelay creates a relay polling every OUTBOX_POLL_INTERVAL (default 2s)
+func NewOutboxRelay(publisher EventPublisher) *OutboxRelay {
+	interval := 2 * time.Second
+	if value := os.Getenv("OUTBOX_POLL_INTERVAL"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			interval = parsed
+		} else {
+			log.Printf("Invalid OUTBOX_POLL_INTERVAL %q, using %s", value, interval)
+		}
+	}
+	return &OutboxRelay{publisher: publisher, interval: interval}
+}
+
+// Run relays events until the context is cancelled
+func (r *OutboxRelay) Run(ctx context.Context) {
+	monitor := backgroundWorkers.Register("outbox_relay", tickerStallAfter(r.interval),
+		countQueue(`SELECT count(*) FROM assignment_outbox WHERE published_at IS NULL`))
+	defer backgroundWorkers.Unregister("outbox_relay")
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := r.relayBatch(ctx)
+			monitor.Record(err)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Outbox relay error: %v", err)
+			}
+		}
+	}
+}
+
+// relayBatch publishes the oldest pending events in order. It stops at the
+// first failure so consumers never see events out of order.
+func (r *OutboxRelay) relayBatch(ctx context.Context) error {
+	return pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		query := `
+			SELECT id, event_type, actor, payload, created_at
+			FROM assignment_outbox
+			WHERE published_at IS NULL
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		`
+		rows, err := tx.Query(ctx, query, outboxBatchSize)
+		if err != nil {
+			return err
+		}
+
+		var events []AssignmentEvent
+		for rows.Next() {
+			var event AssignmentEvent
+			var payload []byte
+			if err := rows.Scan(&event.ID, &event.Type, &event.Actor, &payload, &event.OccurredAt); err != nil {
+				rows.Close()
+				return err
+			}
+			if err := json.Unmarshal(payload, &event.Assignment); err != nil {
+				rows.Close()
+				return err
+			}
+			events = append(events, event)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			body, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+
+			if err := r.publisher.Publish(ctx, &event, body); err != nil {
+				_, updateErr := tx.Exec(ctx, `
+					UPDATE assignment_outbox
+					SET attempts = attempts + 1, last_error = $2
+					WHERE id = $1
+				`, event.ID, err.Error())
+				if updateErr != nil {
+					return updateErr
+				}
+				log.Printf("Failed to publish event %d (%s), will retry: %v", event.ID, event.Type, err)
+				return nil
+			}
+
+			if _, err := tx.Exec(ctx, `UPDATE assignment_outbox SET published_at = CURRENT_TIMESTAMP WHERE id = $1`, event.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
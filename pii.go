@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// piiFields mask the values of JSON keys and CSV columns holding staff names,
+// contact details and callers' addresses
+var piiFields = map[string]func(string) string{
+	"staff_name":  maskName,
+	"email":       maskEmail,
+	"webhook_url": maskURL,
+	"recipient":   maskContact, // email address or webhook URL
+	"client_ip":   maskIP,
+}
+
+// maskName reduces a name to its initials, e.g. "J. D."
+func maskName(name string) string {
+	words := strings.Fields(name)
+	for i, word := range words {
+		words[i] = string([]rune(word)[:1]) + "."
+	}
+	return strings.Join(words, " ")
+}
+
+// maskEmail keeps the first letter of the mailbox and the domain
+func maskEmail(email string) string {
+	local, domain, found := strings.Cut(email, "@")
+	if !found || local == "" {
+		return "***"
+	}
+	return string([]rune(local)[:1]) + "***@" + domain
+}
+
+// maskURL keeps the scheme and host, hiding the path and any credentials
+func maskURL(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Host == "" {
+		return "***"
+	}
+	return parsed.Scheme + "://" + parsed.Hostname() + "/***"
+}
+
+// maskIP keeps the network of an address, /24 for IPv4 and /48 for IPv6
+func maskIP(value string) string {
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return "***"
+	}
+	bits := 48
+	if addr = addr.Unmap(); addr.Is4() {
+		bits = 24
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix.String()
+}
+
+func maskContact(value string) string {
+	if strings.Contains(value, "://") {
+		return maskURL(value)
+	}
+	return maskEmail(value)
+}
+
+// piiRedactor masks PII in one response. Besides the fields above, staff
+// names from the directory are masked wherever they appear in text, such as
+// activity summaries and notification bodies.
+type piiRedactor struct {
+	names *strings.Replacer
+}
+
+func newPIIRedactor() *piiRedactor {
+	var pairs []string
+	for _, staff := range mockStaff {
+		if name := staff["name"]; name != "" {
+			pairs = append(pairs, name, maskName(name))
+		}
+	}
+	return &piiRedactor{names: strings.NewReplacer(pairs...)}
+}
+
+func (r *piiRedactor) text(field, value string) string {
+	if mask, sensitive := piiFields[field]; sensitive && value != "" {
+		return mask(value)
+	}
+	return r.names.Replace(value)
+}
+
+// redactJSON masks a JSON value, keeping its keys in their original order.
+// field is the key the value was found under, if any.
+func (r *piiRedactor) redactJSON(data []byte, field string) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return data, nil
+	}
+	switch data[0] {
+	case '"':
+		var value string
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		return json.Marshal(r.text(field, value))
+	case '{', '[':
+	default:
+		return data, nil // numbers, booleans and null
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	open, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	out.WriteByte(byte(open.(json.Delim)))
+	for i := 0; dec.More(); i++ {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		childField := field // array items inherit their key
+		if open == json.Delim('{') {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			childField = key.(string)
+			encoded, _ := json.Marshal(childField)
+			out.Write(encoded)
+			out.WriteByte(':')
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		value, err := r.redactJSON(raw, childField)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(value)
+	}
+	if open == json.Delim('{') {
+		out.WriteByte('}')
+	} else {
+		out.WriteByte(']')
+	}
+	return out.Bytes(), nil
+}
+
+// redactCSV masks PII columns by their header, and staff names in any cell
+func (r *piiRedactor) redactCSV(data []byte) ([]byte, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil || len(records) == 0 {
+		return data, err
+	}
+	header := records[0]
+	for _, record := range records[1:] {
+		for i, cell := range record {
+			field := ""
+			if i < len(header) {
+				field = header[i]
+			}
+			record[i] = r.text(field, cell)
+		}
+	}
+	var out bytes.Buffer
+	if err := csv.NewWriter(&out).WriteAll(records); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// redactingWriter holds back JSON and CSV bodies so they can be masked once
+// the handler has finished. Other responses, such as event streams, pass
+// straight through.
+type redactingWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	decided   bool
+	buffering bool
+}
+
+func (w *redactingWriter) decide() {
+	if !w.decided {
+		w.decided = true
+		contentType := w.Header().Get("Content-Type")
+		w.buffering = strings.HasPrefix(contentType, "application/json") || strings.HasPrefix(contentType, "text/csv")
+	}
+}
+
+func (w *redactingWriter) Write(data []byte) (int, error) {
+	if w.decide(); w.buffering {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *redactingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *redactingWriter) Flush() {
+	if !w.buffering {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *redactingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// redactPII masks staff names and contact details in every JSON and CSV
+// response to callers without the pii:read scope, so handlers don't each
+// have to remember to
+func redactPII() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if principal := currentPrincipal(c); principal == nil || principal.HasScope(ScopePIIRead) {
+			c.Next()
+			return
+		}
+
+		writer := &redactingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+		if !writer.buffering {
+			return
+		}
+
+		redactor := newPIIRedactor()
+		var body []byte
+		var err error
+		if strings.HasPrefix(writer.Header().Get("Content-Type"), "text/csv") {
+			body, err = redactor.redactCSV(writer.body.Bytes())
+		} else {
+			body, err = redactor.redactJSON(writer.body.Bytes(), "")
+		}
+		if err != nil {
+			// Never fall back to the unmasked body
+			c.Error(err)
+			writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			writer.Header().Del("Content-Disposition")
+			writer.ResponseWriter.WriteHeader(http.StatusInternalServerError)
+			body, _ = json.Marshal(gin.H{"error": newAPIError(http.StatusInternalServerError, "Failed to prepare response")})
+		}
+		writer.ResponseWriter.Write(body)
+	}
+}
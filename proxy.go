@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// defaultClientIPHeaders are the headers trusted proxies report the client's
+// address in, checked in order
+const defaultClientIPHeaders = "X-Forwarded-For, X-Real-IP"
+
+// ProxyConfig says which proxies in front of the service may report the
+// client's address. Requests from anywhere else are attributed to the address
+// they came from, whatever forwarding headers they carry.
+type ProxyConfig struct {
+	TrustedProxies  []string // CIDRs or addresses of load balancers and proxies
+	ClientIPHeaders []string
+	TrustedPlatform string // header a CDN sets to the client's address, e.g. CF-Connecting-IP
+}
+
+// LoadProxyConfig reads TRUSTED_PROXIES (comma-separated CIDRs or addresses;
+// unset trusts no proxy), CLIENT_IP_HEADERS (default X-Forwarded-For,
+// X-Real-IP) and TRUSTED_PLATFORM_HEADER. Entries that are neither a CIDR nor
+// an address are logged and left out.
+func LoadProxyConfig() ProxyConfig {
+	cfg := ProxyConfig{TrustedPlatform: strings.TrimSpace(os.Getenv("TRUSTED_PLATFORM_HEADER"))}
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy == "" {
+			continue
+		}
+		if _, err := netip.ParsePrefix(proxy); err != nil {
+			if _, err := netip.ParseAddr(proxy); err != nil {
+				log.Printf("Invalid TRUSTED_PROXIES entry %q, ignoring it", proxy)
+				continue
+			}
+		}
+		cfg.TrustedProxies = append(cfg.TrustedProxies, proxy)
+	}
+	for _, header := range strings.Split(envOrDefault("CLIENT_IP_HEADERS", defaultClientIPHeaders), ",") {
+		if header = strings.TrimSpace(header); header != "" {
+			cfg.ClientIPHeaders = append(cfg.ClientIPHeaders, header)
+		}
+	}
+	return cfg
+}
+
+// apply makes the router's ClientIP read the forwarding headers only on
+// requests from a trusted proxy, walking X-Forwarded-For back past the trusted
+// hops. Gin otherwise trusts every peer, letting any caller choose its address.
+func (cfg ProxyConfig) apply(router *gin.Engine) {
+	// Entries were checked when loading, so this can't fail
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Printf("Setting trusted proxies failed: %v", err)
+	}
+	router.ForwardedByClientIP = len(cfg.TrustedProxies) > 0
+	router.RemoteIPHeaders = cfg.ClientIPHeaders
+	router.TrustedPlatform = cfg.TrustedPlatform
+}
+
+type clientIPKey struct{}
+
+// withClientIP returns a copy of ctx carrying the caller's address
+func withClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// clientIPFromContext returns the address of the caller behind the request
+// the context belongs to, or "" outside a request
+func clientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// recordClientIP resolves the caller's address once, for everything that
+// records or acts on it: the request log, audit entries and the request's
+// span, which otherwise takes X-Forwarded-For from any caller
+func recordClientIP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := c.ClientIP()
+		if ip == "" {
+			c.Next()
+			return
+		}
+		c.Request = c.Request.WithContext(withClientIP(c.Request.Context(), ip))
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(semconv.ClientAddress(ip))
+		c.Next()
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"no proxy trusted", nil, "198.51.100.9:4000",
+			map[string]string{"X-Forwarded-For": "203.0.113.7"}, "198.51.100.9"},
+		{"from a trusted proxy", []string{"10.0.0.0/8"}, "10.1.2.3:4000",
+			map[string]string{"X-Forwarded-For": "203.0.113.7"}, "203.0.113.7"},
+		{"past every trusted hop", []string{"10.0.0.0/8"}, "10.1.2.3:4000",
+			map[string]string{"X-Forwarded-For": "192.0.2.66, 203.0.113.7, 10.9.9.9"}, "203.0.113.7"},
+		{"from an untrusted peer", []string{"10.0.0.0/8"}, "198.51.100.9:4000",
+			map[string]string{"X-Forwarded-For": "203.0.113.7"}, "198.51.100.9"},
+		{"from X-Real-IP", []string{"10.1.2.3"}, "10.1.2.3:4000",
+			map[string]string{"X-Real-IP": "2001:db8::7"}, "2001:db8::7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			ProxyConfig{TrustedProxies: tt.proxies, ClientIPHeaders: []string{"X-Forwarded-For", "X-Real-IP"}}.apply(router)
+			router.Use(recordClientIP())
+			router.GET("/ip", func(c *gin.Context) { c.String(http.StatusOK, clientIPFromContext(c.Request.Context())) })
+
+			req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+			req.RemoteAddr = tt.remote
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("client IP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadProxyConfig(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", " 10.0.0.0/8, load-balancer ,fd00::/8,192.0.2.1,")
+	t.Setenv("CLIENT_IP_HEADERS", "")
+	cfg := LoadProxyConfig()
+	if want := []string{"10.0.0.0/8", "fd00::/8", "192.0.2.1"}; !slices.Equal(cfg.TrustedProxies, want) {
+		t.Errorf("trusted proxies = %q, want %q without the hostname", cfg.TrustedProxies, want)
+	}
+	if want := []string{"X-Forwarded-For", "X-Real-IP"}; !slices.Equal(cfg.ClientIPHeaders, want) {
+		t.Errorf("headers = %q, want the defaults", cfg.ClientIPHeaders)
+	}
+}
+
+func TestMaskIP(t *testing.T) {
+	for value, want := range map[string]string{
+		"203.0.113.7":        "203.0.113.0/24",
+		"::ffff:203.0.113.7": "203.0.113.0/24",
+		"2001:db8:1:2::7":    "2001:db8:1::/48",
+		"not an address":     "***",
+	} {
+		if got := maskIP(value); got != want {
+			t.Errorf("maskIP(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,614 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Roster publication statuses
+const (
+	PublicationPublishing         = "publishing"
+	PublicationPublished          = "published"
+	PublicationSuperseded         = "superseded" // replaced by a later publication for the period
+	PublicationCompensating       = "compensating"
+	PublicationFailed             = "failed" // rolled back; the previous publication is still current everywhere
+	PublicationCompensationFailed = "compensation_failed"
+)
+
+// Saga step statuses
+const (
+	StepStarted            = "started"
+	StepDone               = "done"
+	StepFailed             = "failed"  // rejected by the participant, so nothing to undo
+	StepUnknown            = "unknown" // timed out or unreachable; it may have applied
+	StepCompensated        = "compensated"
+	StepCompensationFailed = "compensation_failed"
+)
+
+// compensationAttempts is how often a compensation is tried before the saga is
+// left for the recoverer
+const compensationAttempts = 3
+
+// RosterPublication is a roster for a period published to this service and to
+// the services that consume it. Publishing runs as a saga: each participant
+// applies the roster in turn, and if one fails those already reached are
+// compensated so every service falls back to the previous publication.
+type RosterPublication struct {
+	ID          string      `json:"id"` // ULID
+	From        time.Time   `json:"from"`
+	To          time.Time   `json:"to"`
+	Status      string      `json:"status"`
+	PreviousID  *string     `json:"previous_id,omitempty"` // the publication this one replaces
+	Days        []RosterDay `json:"days"`
+	Steps       []SagaStep  `json:"steps"`
+	PublishedBy string      `json:"published_by"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// SagaStep records what happened to one participant during a publication
+type SagaStep struct {
+	Participant string    `json:"participant"`
+	Status      string    `json:"status"`
+	Error       string    `json:"error,omitempty"`
+	At          time.Time `json:"at"`
+}
+
+// step returns the participant's step, or nil if the saga never reached it
+func (p *RosterPublication) step(participant string) *SagaStep {
+	for i := range p.Steps {
+		if p.Steps[i].Participant == participant {
+			return &p.Steps[i]
+		}
+	}
+	return nil
+}
+
+// record sets the participant's step status, adding the step on first use
+func (p *RosterPublication) record(participant, status string, err error) {
+	step := p.step(participant)
+	if step == nil {
+		p.Steps = append(p.Steps, SagaStep{Participant: participant})
+		step = &p.Steps[len(p.Steps)-1]
+	}
+	step.Status = status
+	step.Error = ""
+	if err != nil {
+		step.Error = err.Error()
+	}
+	step.At = time.Now()
+}
+
+// staffIDs returns every staff member rostered in the publication, ascending
+func (p *RosterPublication) staffIDs() []int {
+	seen := map[int]bool{}
+	ids := []int{}
+	for _, day := range p.Days {
+		for _, bus := range day.Buses {
+			for _, crew := range bus.Crew {
+				if !seen[crew.StaffID] {
+					seen[crew.StaffID] = true
+					ids = append(ids, crew.StaffID)
+				}
+			}
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// errPublicationInProgress is returned when the period already has a
+// publication that hasn't finished or been rolled back
+var errPublicationInProgress = errors.New("a roster publication for this period is already in progress")
+
+// PublicationRepository stores roster publications and their saga state
+type PublicationRepository interface {
+	Create(publication *RosterPublication) error            // errPublicationInProgress while the period has an unfinished one
+	Get(id string) (*RosterPublication, error)              // nil, nil when not found
+	Current(from, to time.Time) (*RosterPublication, error) // the published one for the period; nil, nil when none
+	List(from, to time.Time) ([]RosterPublication, error)   // every publication for the period, newest first
+	Save(publication *RosterPublication) error              // status and steps
+	Complete(publication *RosterPublication) error          // marks it published and supersedes the previous one
+	Stuck(before time.Time) ([]RosterPublication, error)    // unfinished publications last touched before the time
+	Claim(publication *RosterPublication) (bool, error)     // starts compensating unless another recoverer got there first
+	WithContext(ctx context.Context) PublicationRepository  // see AssignmentRepository.WithContext
+}
+
+// RosterParticipant is a service a roster publication is pushed to. Both
+// calls must be idempotent, since the recoverer may repeat them.
+type RosterParticipant interface {
+	Name() string
+	Apply(ctx context.Context, publication *RosterPublication) error
+	// Compensate undoes Apply, restoring the previous publication (nil when
+	// the period had none)
+	Compensate(ctx context.Context, publication, previous *RosterPublication) error
+}
+
+// participantRejectedError is a non-2xx response, meaning the participant
+// refused the call rather than failing partway through it
+type participantRejectedError struct {
+	Participant string
+	Method      string
+	Path        string
+	Status      string
+}
+
+func (e *participantRejectedError) Error() string {
+	return fmt.Sprintf("%s: %s %s returned %s", e.Participant, e.Method, e.Path, e.Status)
+}
+
+// participantClient calls a participant's HTTP API
+type participantClient struct {
+	name    string
+	baseURL string
+	client  *http.Client
+}
+
+// do sends a JSON request, treating anything but a 2xx response as failure.
+// The idempotency key lets the participant discard repeated calls.
+func (p *participantClient) do(ctx context.Context, method, path, idempotencyKey string, body any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.name, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &participantRejectedError{Participant: p.name, Method: method, Path: path, Status: resp.Status}
+	}
+	return nil
+}
+
+// timetableParticipant publishes rosters to the timetable service, which
+// keeps one roster per period
+type timetableParticipant struct {
+	participantClient
+}
+
+// timetableRoster is the body the timetable service stores for a period
+type timetableRoster struct {
+	PublicationID string      `json:"publication_id"`
+	From          string      `json:"from"`
+	To            string      `json:"to"`
+	Days          []RosterDay `json:"days"`
+}
+
+func (t *timetableParticipant) Name() string { return t.name }
+
+func (t *timetableParticipant) path(publication *RosterPublication) string {
+	return "/rosters/" + publication.From.Format("2006-01-02") + "/" + publication.To.Format("2006-01-02")
+}
+
+func (t *timetableParticipant) roster(publication *RosterPublication) timetableRoster {
+	return timetableRoster{
+		PublicationID: publication.ID,
+		From:          publication.From.Format("2006-01-02"),
+		To:            publication.To.Format("2006-01-02"),
+		Days:          publication.Days,
+	}
+}
+
+// Apply replaces the period's roster with this publication
+func (t *timetableParticipant) Apply(ctx context.Context, publication *RosterPublication) error {
+	return t.do(ctx, http.MethodPut, t.path(publication), publication.ID+":apply", t.roster(publication))
+}
+
+// Compensate puts the previous publication back, or removes the period's
+// roster when there was none
+func (t *timetableParticipant) Compensate(ctx context.Context, publication, previous *RosterPublication) error {
+	if previous == nil {
+		return t.do(ctx, http.MethodDelete, t.path(publication), publication.ID+":revert", nil)
+	}
+	return t.do(ctx, http.MethodPut, t.path(publication), publication.ID+":revert", t.roster(previous))
+}
+
+// notificationParticipant tells rostered staff about a publication through
+// the notification service
+type notificationParticipant struct {
+	participantClient
+}
+
+// rosterNotification is the body sent to the notification service
+type rosterNotification struct {
+	Type          string  `json:"type"` // roster.published or roster.retracted
+	PublicationID string  `json:"publication_id"`
+	PreviousID    *string `json:"previous_id,omitempty"`
+	From          string  `json:"from"`
+	To            string  `json:"to"`
+	StaffIDs      []int   `json:"staff_ids"`
+}
+
+func (n *notificationParticipant) Name() string { return n.name }
+
+func (n *notificationParticipant) notification(kind string, publication *RosterPublication) rosterNotification {
+	return rosterNotification{
+		Type:          kind,
+		PublicationID: publication.ID,
+		PreviousID:    publication.PreviousID,
+		From:          publication.From.Format("2006-01-02"),
+		To:            publication.To.Format("2006-01-02"),
+		StaffIDs:      publication.staffIDs(),
+	}
+}
+
+// Apply notifies staff of the new roster
+func (n *notificationParticipant) Apply(ctx context.Context, publication *RosterPublication) error {
+	return n.do(ctx, http.MethodPost, "/notifications", publication.ID+":published",
+		n.notification("roster.published", publication))
+}
+
+// Compensate tells the same staff to disregard it, since a sent
+// notification can't be recalled
+func (n *notificationParticipant) Compensate(ctx context.Context, publication, _ *RosterPublication) error {
+	return n.do(ctx, http.MethodPost, "/notifications", publication.ID+":retracted",
+		n.notification("roster.retracted", publication))
+}
+
+// LoadRosterParticipants reads TIMETABLE_SERVICE_URL and
+// NOTIFICATION_SERVICE_URL, skipping any that are unset, with requests timing
+// out after ROSTER_PARTICIPANT_TIMEOUT (default 10s). The timetable goes
+// first so staff are only notified of a roster it has accepted.
+func LoadRosterParticipants() []RosterParticipant {
+	client := &http.Client{Timeout: durationFromEnv("ROSTER_PARTICIPANT_TIMEOUT", 10*time.Second)}
+
+	var participants []RosterParticipant
+	if url := strings.TrimSuffix(os.Getenv("TIMETABLE_SERVICE_URL"), "/"); url != "" {
+		participants = append(participants, &timetableParticipant{participantClient{"timetable", url, client}})
+	}
+	if url := strings.TrimSuffix(os.Getenv("NOTIFICATION_SERVICE_URL"), "/"); url != "" {
+		participants = append(participants, &notificationParticipant{participantClient{"notifications", url, client}})
+	}
+	return participants
+}
+
+// RosterPublisher coordinates roster publication sagas
+type RosterPublisher struct {
+	publications PublicationRepository
+	assignments  AssignmentRepository
+	participants []RosterParticipant
+	retryDelay   time.Duration // between compensation attempts, growing linearly
+}
+
+// NewRosterPublisher creates a coordinator publishing rosters built from the
+// given assignments to the participants in order
+func NewRosterPublisher(publications PublicationRepository, assignments AssignmentRepository,
+	participants []RosterParticipant) *RosterPublisher {
+	return &RosterPublisher{
+		publications: publications,
+		assignments:  assignments,
+		participants: participants,
+		retryDelay:   500 * time.Millisecond,
+	}
+}
+
+// Publish snapshots the roster for the period and runs the saga. On failure
+// the returned publication is failed or compensation_failed, with the cause
+// in its steps.
+func (p *RosterPublisher) Publish(ctx context.Context, from, to time.Time, actor string) (*RosterPublication, error) {
+	publications := p.publications.WithContext(ctx)
+	assignments, err := p.assignments.WithContext(ctx).ListInRange(from, to, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := publications.Current(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := newULID(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	publication := &RosterPublication{
+		ID:          id,
+		From:        from,
+		To:          to,
+		Status:      PublicationPublishing,
+		Days:        buildRoster(assignments, from, to),
+		Steps:       []SagaStep{},
+		PublishedBy: actor,
+	}
+	if previous != nil {
+		publication.PreviousID = &previous.ID
+	}
+	if err := publications.Create(publication); err != nil {
+		return nil, err
+	}
+
+	for _, participant := range p.participants {
+		// Record the attempt first, so a crash mid-call is still compensated
+		publication.record(participant.Name(), StepStarted, nil)
+		if err := publications.Save(publication); err != nil {
+			return publication, err
+		}
+
+		if err := participant.Apply(ctx, publication); err != nil {
+			log.Printf("Roster publication %s failed at %s: %v", publication.ID, participant.Name(), err)
+			status := StepUnknown
+			var rejected *participantRejectedError
+			if errors.As(err, &rejected) {
+				status = StepFailed
+			}
+			publication.record(participant.Name(), status, err)
+			return publication, p.compensate(ctx, publication, previous)
+		}
+		publication.record(participant.Name(), StepDone, nil)
+		if err := publications.Save(publication); err != nil {
+			return publication, err
+		}
+	}
+
+	if err := publications.Complete(publication); err != nil {
+		// The participants have the new roster but this service doesn't
+		log.Printf("Roster publication %s could not be completed: %v", publication.ID, err)
+		return publication, p.compensate(ctx, publication, previous)
+	}
+	log.Printf("Roster %s to %s published as %s by %s",
+		from.Format("2006-01-02"), to.Format("2006-01-02"), publication.ID, actor)
+	return publication, nil
+}
+
+// errPublicationRolledBack is returned by Publish when a participant failed
+// and every service was reverted to the previous publication
+var errPublicationRolledBack = errors.New("roster publication failed and was rolled back")
+
+// errCompensationFailed is returned when a participant could not be reverted;
+// the recoverer keeps retrying
+var errCompensationFailed = errors.New("roster publication failed and could not be fully rolled back")
+
+// compensate reverts, in reverse order, every participant the saga reached
+// except one that rejected its call. A call that timed out or was interrupted
+// by a crash may still have applied, so it is reverted too.
+func (p *RosterPublisher) compensate(ctx context.Context, publication, previous *RosterPublication) error {
+	publications := p.publications.WithContext(ctx)
+	publication.Status = PublicationCompensating
+	if err := publications.Save(publication); err != nil {
+		return err
+	}
+
+	failed := false
+	for i := len(p.participants) - 1; i >= 0; i-- {
+		participant := p.participants[i]
+		step := publication.step(participant.Name())
+		if step == nil || step.Status == StepFailed || step.Status == StepCompensated {
+			continue
+		}
+
+		var err error
+		for attempt := 1; attempt <= compensationAttempts; attempt++ {
+			if err = participant.Compensate(ctx, publication, previous); err == nil {
+				break
+			}
+			if attempt < compensationAttempts {
+				time.Sleep(time.Duration(attempt) * p.retryDelay)
+			}
+		}
+		if err != nil {
+			log.Printf("Compensating roster publication %s at %s failed: %v", publication.ID, participant.Name(), err)
+			publication.record(participant.Name(), StepCompensationFailed, err)
+			failed = true
+			continue
+		}
+		publication.record(participant.Name(), StepCompensated, nil)
+	}
+
+	publication.Status = PublicationFailed
+	if failed {
+		publication.Status = PublicationCompensationFailed
+	}
+	if err := publications.Save(publication); err != nil {
+		return err
+	}
+	if failed {
+		return errCompensationFailed
+	}
+	return errPublicationRolledBack
+}
+
+// Recover compensates publications left unfinished by a crash or a failed
+// compensation once they haven't been touched for the given age
+func (p *RosterPublisher) Recover(ctx context.Context, age time.Duration) error {
+	publications := p.publications.WithContext(ctx)
+	stuck, err := publications.Stuck(time.Now().Add(-age))
+	if err != nil {
+		return err
+	}
+
+	for i := range stuck {
+		publication := &stuck[i]
+		claimed, err := publications.Claim(publication)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue // Another replica is recovering it
+		}
+
+		var previous *RosterPublication
+		if publication.PreviousID != nil {
+			if previous, err = publications.Get(*publication.PreviousID); err != nil {
+				return err
+			}
+		}
+		log.Printf("Recovering roster publication %s left %s", publication.ID, publication.Status)
+		if err := p.compensate(ctx, publication, previous); err != nil && !errors.Is(err, errPublicationRolledBack) {
+			log.Printf("Recovering roster publication %s: %v", publication.ID, err)
+		}
+	}
+	return nil
+}
+
+// PublicationRecoverer periodically recovers stuck roster publication sagas
+type PublicationRecoverer struct {
+	publisher *RosterPublisher
+	interval  time.Duration
+	age       time.Duration
+}
+
+// NewPublicationRecoverer creates a recoverer checking every minute for sagas
+// untouched for ROSTER_SAGA_TIMEOUT (default 5m)
+func NewPublicationRecoverer(publisher *RosterPublisher) *PublicationRecoverer {
+	return &PublicationRecoverer{
+		publisher: publisher,
+		interval:  time.Minute,
+		age:       durationFromEnv("ROSTER_SAGA_TIMEOUT", 5*time.Minute),
+	}
+}
+
+// Run recovers stuck sagas until the context is cancelled
+func (r *PublicationRecoverer) Run(ctx context.Context) {
+	monitor := backgroundWorkers.Register("publication_recoverer", tickerStallAfter(r.interval), nil)
+	defer backgroundWorkers.Unregister("publication_recoverer")
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := r.publisher.Recover(ctx, r.age)
+			monitor.Record(err)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Roster publication recovery error: %v", err)
+			}
+		}
+	}
+}
+
+// PublishRosterRequest names the period to publish
+type PublishRosterRequest struct {
+	From string `json:"from" binding:"required"` // YYYY-MM-DD
+	To   string `json:"to" binding:"required"`   // YYYY-MM-DD, inclusive
+}
+
+// PublicationHandler serves the roster publication endpoints
+type PublicationHandler struct {
+	publisher    *RosterPublisher
+	publications PublicationRepository
+}
+
+// NewPublicationHandler creates a handler publishing through the given coordinator
+func NewPublicationHandler(publisher *RosterPublisher, publications PublicationRepository) *PublicationHandler {
+	return &PublicationHandler{publisher: publisher, publications: publications}
+}
+
+// forRequest returns the handler with its repositories bound to the request's context
+func (h *PublicationHandler) forRequest(c *gin.Context) *PublicationHandler {
+	ctx := c.Request.Context()
+	return &PublicationHandler{publisher: h.publisher, publications: h.publications.WithContext(ctx)}
+}
+
+func (h *PublicationHandler) handlePublishRoster(c *gin.Context) {
+	h = h.forRequest(c)
+	var req PublishRosterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, &req, err)
+		return
+	}
+	from, to, ok := parseRosterRange(c, req.From, req.To)
+	if !ok {
+		return
+	}
+
+	// A client disconnecting mustn't abandon the saga halfway
+	ctx := context.WithoutCancel(c.Request.Context())
+	publication, err := h.publisher.Publish(ctx, from, to, actorFromContext(c))
+	switch {
+	case err == nil:
+		c.JSON(http.StatusCreated, publication)
+	case errors.Is(err, errPublicationInProgress):
+		respondError(c, http.StatusConflict, "A roster publication for this period is already in progress")
+	case errors.Is(err, errPublicationRolledBack):
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":       newAPIError(http.StatusBadGateway, "Roster publication failed and was rolled back; the previous roster is still published"),
+			"publication": publication,
+		})
+	case errors.Is(err, errCompensationFailed):
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":       newAPIError(http.StatusBadGateway, "Roster publication failed and is still being rolled back"),
+			"publication": publication,
+		})
+	default:
+		respondError(c, http.StatusInternalServerError, "Failed to publish roster")
+	}
+}
+
+func (h *PublicationHandler) handleGetPublications(c *gin.Context) {
+	h = h.forRequest(c)
+	from, to, ok := parseRosterRange(c, c.Query("from"), c.Query("to"))
+	if !ok {
+		return
+	}
+
+	publications, err := h.publications.List(from, to)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve roster publications")
+		return
+	}
+	c.JSON(http.StatusOK, publications)
+}
+
+func (h *PublicationHandler) handleGetPublishedRoster(c *gin.Context) {
+	h = h.forRequest(c)
+	from, to, ok := parseRosterRange(c, c.Query("from"), c.Query("to"))
+	if !ok {
+		return
+	}
+
+	publication, err := h.publications.Current(from, to)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve published roster")
+		return
+	}
+	if publication == nil {
+		respondError(c, http.StatusNotFound, "No roster has been published for this period")
+		return
+	}
+	c.JSON(http.StatusOK, publication)
+}
+
+func (h *PublicationHandler) handleGetPublication(c *gin.Context) {
+	h = h.forRequest(c)
+	id, valid := normalizeULID(c.Param("id"))
+	if !valid {
+		respondError(c, http.StatusBadRequest, "Invalid publication ID")
+		return
+	}
+
+	publication, err := h.publications.Get(id)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve roster publication")
+		return
+	}
+	if publication == nil {
+		respondError(c, http.StatusNotFound, "Roster publication not found")
+		return
+	}
+	c.JSON(http.StatusOK, publication)
+}
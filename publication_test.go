@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// participantCall is one request received by a fake participant service
+type participantCall struct {
+	Method string
+	Path   string
+	Key    string
+	Body   map[string]any
+}
+
+// fakeParticipant records every call and answers with the configured status
+type fakeParticipant struct {
+	mu     sync.Mutex
+	calls  []participantCall
+	status int
+}
+
+func newFakeParticipant(t *testing.T) (*fakeParticipant, string) {
+	t.Helper()
+	fake := &fakeParticipant{status: http.StatusOK}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		call := participantCall{Method: r.Method, Path: r.URL.Path, Key: r.Header.Get("Idempotency-Key")}
+		json.Unmarshal(data, &call.Body)
+
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		fake.calls = append(fake.calls, call)
+		w.WriteHeader(fake.status)
+	}))
+	t.Cleanup(server.Close)
+	return fake, server.URL
+}
+
+func (f *fakeParticipant) fail() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = http.StatusInternalServerError
+}
+
+func (f *fakeParticipant) received() []participantCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]participantCall{}, f.calls...)
+}
+
+func TestPublishRosterCompensatesFailedStep(t *testing.T) {
+	timetable, timetableURL := newFakeParticipant(t)
+	notifications, notificationsURL := newFakeParticipant(t)
+	t.Setenv("TIMETABLE_SERVICE_URL", timetableURL)
+	t.Setenv("NOTIFICATION_SERVICE_URL", notificationsURL)
+
+	router, repo := newTestRouter(t)
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2030-01-07")})
+
+	period := PublishRosterRequest{From: "2030-01-07", To: "2030-01-13"}
+	rec := doRequest(router, http.MethodPost, "/api/roster/publish", period)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("first publish: status %d: %s", rec.Code, rec.Body.String())
+	}
+	first := decode[RosterPublication](t, rec)
+	if first.Status != PublicationPublished || first.PreviousID != nil {
+		t.Fatalf("first publication = %s with previous %v, want published with none", first.Status, first.PreviousID)
+	}
+	if calls := notifications.received(); len(calls) != 1 || calls[0].Body["type"] != "roster.published" {
+		t.Fatalf("notifications received %+v, want one roster.published", calls)
+	}
+
+	// The second publication reaches the timetable, then notifications fail
+	notifications.fail()
+	mustCreate(t, repo, Assignment{BusID: 2, StaffID: 2, Role: "driver", StartDate: date("2030-01-07")})
+	rec = doRequest(router, http.MethodPost, "/api/roster/publish", period)
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("second publish: status %d, want 502: %s", rec.Code, rec.Body.String())
+	}
+	failed := decode[struct {
+		Publication RosterPublication `json:"publication"`
+	}](t, rec).Publication
+	if failed.Status != PublicationFailed {
+		t.Errorf("failed publication status = %s, want %s", failed.Status, PublicationFailed)
+	}
+	if step := failed.step("timetable"); step == nil || step.Status != StepCompensated {
+		t.Errorf("timetable step = %+v, want compensated", step)
+	}
+
+	// The timetable got the new roster and then the first one back
+	calls := timetable.received()
+	if len(calls) != 3 {
+		t.Fatalf("timetable received %d calls, want 3", len(calls))
+	}
+	path := "/rosters/2030-01-07/2030-01-13"
+	if calls[1].Method != http.MethodPut || calls[1].Path != path || calls[1].Body["publication_id"] != failed.ID {
+		t.Errorf("second timetable call = %+v, want the new roster", calls[1])
+	}
+	if calls[2].Method != http.MethodPut || calls[2].Body["publication_id"] != first.ID || calls[2].Key != failed.ID+":revert" {
+		t.Errorf("third timetable call = %+v, want the first roster restored", calls[2])
+	}
+
+	rec = doRequest(router, http.MethodGet, "/api/roster/published?from=2030-01-07&to=2030-01-13", nil)
+	if current := decode[RosterPublication](t, rec); current.ID != first.ID {
+		t.Errorf("published roster = %s, want the first publication %s", current.ID, first.ID)
+	}
+
+	rec = doRequest(router, http.MethodGet, "/api/roster/publications?from=2030-01-07&to=2030-01-13", nil)
+	if history := decode[[]RosterPublication](t, rec); len(history) != 2 || history[0].ID != failed.ID {
+		t.Errorf("publication history = %+v, want the failed one then the first", history)
+	}
+}
+
+func TestPublishRosterSupersedesPrevious(t *testing.T) {
+	timetable, timetableURL := newFakeParticipant(t)
+	t.Setenv("TIMETABLE_SERVICE_URL", timetableURL)
+	t.Setenv("NOTIFICATION_SERVICE_URL", "")
+
+	router, _ := newTestRouter(t)
+	period := PublishRosterRequest{From: "2030-02-04", To: "2030-02-10"}
+	first := decode[RosterPublication](t, doRequest(router, http.MethodPost, "/api/roster/publish", period))
+	second := decode[RosterPublication](t, doRequest(router, http.MethodPost, "/api/roster/publish", period))
+
+	if second.PreviousID == nil || *second.PreviousID != first.ID {
+		t.Errorf("second publication replaces %v, want %s", second.PreviousID, first.ID)
+	}
+	rec := doRequest(router, http.MethodGet, "/api/roster/publications/"+first.ID, nil)
+	if got := decode[RosterPublication](t, rec); got.Status != PublicationSuperseded {
+		t.Errorf("first publication status = %s, want %s", got.Status, PublicationSuperseded)
+	}
+	if calls := timetable.received(); len(calls) != 2 {
+		t.Errorf("timetable received %d calls, want 2", len(calls))
+	}
+
+	rec = doRequest(router, http.MethodPost, "/api/roster/publish", PublishRosterRequest{From: "2030-02-10", To: "2030-02-04"})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("reversed period: status %d, want 400", rec.Code)
+	}
+}
+
+func TestRecoverStuckPublication(t *testing.T) {
+	timetable, timetableURL := newFakeParticipant(t)
+	t.Setenv("TIMETABLE_SERVICE_URL", timetableURL)
+	t.Setenv("NOTIFICATION_SERVICE_URL", "")
+
+	// A saga that crashed while calling the timetable for a period with no
+	// earlier publication
+	publications := NewMemoryPublicationRepository()
+	stuck := &RosterPublication{ID: "01HZX3M8Q4V6N2B7C9D1E5F0GA", From: date("2030-03-04"), To: date("2030-03-10"),
+		Status: PublicationPublishing, Days: []RosterDay{}, PublishedBy: "test"}
+	stuck.record("timetable", StepStarted, nil)
+	if err := publications.Create(stuck); err != nil {
+		t.Fatal(err)
+	}
+
+	publisher := NewRosterPublisher(publications, NewMemoryAssignmentRepository(), LoadRosterParticipants())
+	if _, err := publisher.Publish(context.Background(), stuck.From, stuck.To, "test"); err != errPublicationInProgress {
+		t.Fatalf("publishing over a stuck saga: %v, want errPublicationInProgress", err)
+	}
+
+	if err := publisher.Recover(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	calls := timetable.received()
+	if len(calls) != 1 || calls[0].Method != http.MethodDelete {
+		t.Fatalf("timetable received %+v, want the period's roster deleted", calls)
+	}
+	recovered, _ := publications.Get(stuck.ID)
+	if recovered.Status != PublicationFailed {
+		t.Errorf("recovered status = %s, want %s", recovered.Status, PublicationFailed)
+	}
+
+	if _, err := publisher.Publish(context.Background(), stuck.From, stuck.To, "test"); err != nil {
+		t.Errorf("publishing after recovery: %v", err)
+	}
+}
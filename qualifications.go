@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"bus-staff-assignment/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+// Qualification check modes, from QUALIFICATION_CHECK
+const (
+	QualificationBlock = "block" // refuse assignments the staff member isn't qualified for
+	QualificationFlag  = "flag"  // save them, with a Warning header and a log line
+	QualificationOff   = "off"   // don't check
+)
+
+// Reasons an assignment fails its qualification check
+const (
+	QualificationMissing  = "missing"  // the staff member doesn't hold the class
+	QualificationExpiring = "expiring" // it expires before the assignment ends
+)
+
+// qualificationClassPattern is the form of a license class, e.g. D or D1
+var qualificationClassPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9+_-]{0,19}$`)
+
+// StaffQualification is a license class a staff member holds
+type StaffQualification struct {
+	StaffID       int        `json:"staff_id"`
+	Class         string     `json:"class"` // e.g. D for bus drivers
+	LicenseNumber string     `json:"license_number,omitempty"`
+	ExpiresOn     *time.Time `json:"expires_on,omitempty"` // last valid day; omitted when it doesn't expire
+	UpdatedBy     string     `json:"updated_by"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// Covers reports whether the qualification is valid on every day of the
+// assignment. An assignment without an end date needs one that never expires.
+func (q *StaffQualification) Covers(assignment *Assignment) bool {
+	if q.ExpiresOn == nil {
+		return true
+	}
+	return assignment.EndDate != nil && !q.ExpiresOn.Before(*assignment.EndDate)
+}
+
+// QualificationRepository stores the license classes staff hold, one record
+// per staff member and class
+type QualificationRepository interface {
+	Put(qualification *StaffQualification) error
+	Delete(staffID int, class string) (bool, error)
+	List(staffID int) ([]StaffQualification, error) // ordered by class
+
+	WithContext(ctx context.Context) QualificationRepository
+}
+
+// QualificationPolicy says which license class each role needs and what
+// happens to assignments whose staff member doesn't hold it
+type QualificationPolicy struct {
+	Mode     string
+	Required map[string]string // role → class; roles not listed need none
+}
+
+var qualificationPolicy = QualificationPolicy{Mode: QualificationFlag, Required: map[string]string{"driver": "D"}}
+
+// LoadQualificationPolicy reads QUALIFICATION_CHECK (block, flag or off;
+// default flag) and ROLE_QUALIFICATIONS, comma-separated role=class pairs
+// (default driver=D). Flagging is the default so staff can be given their
+// qualifications before assignments are refused for want of them.
+func LoadQualificationPolicy() QualificationPolicy {
+	policy := QualificationPolicy{Mode: QualificationFlag, Required: map[string]string{"driver": "D"}}
+	switch mode := os.Getenv("QUALIFICATION_CHECK"); mode {
+	case QualificationBlock, QualificationFlag, QualificationOff:
+		policy.Mode = mode
+	case "":
+	default:
+		log.Printf("Invalid QUALIFICATION_CHECK %q, using %s", mode, policy.Mode)
+	}
+
+	if value := os.Getenv("ROLE_QUALIFICATIONS"); value != "" {
+		required := map[string]string{}
+		for _, pair := range strings.Split(value, ",") {
+			role, class, found := strings.Cut(strings.TrimSpace(pair), "=")
+			role, class = strings.TrimSpace(role), strings.TrimSpace(class)
+			if !found || (role != "driver" && role != "conductor") ||
+				(class != "" && !qualificationClassPattern.MatchString(class)) {
+				log.Printf("Invalid ROLE_QUALIFICATIONS %q, using driver=D", value)
+				return policy
+			}
+			if class != "" {
+				required[role] = class
+			}
+		}
+		policy.Required = required
+	}
+	return policy
+}
+
+// QualificationProblem is why a staff member may not work an assignment
+type QualificationProblem struct {
+	StaffID       int        `json:"staff_id"`
+	Role          string     `json:"role"`
+	RequiredClass string     `json:"required_class"`
+	Reason        string     `json:"reason"`               // missing or expiring
+	ExpiresOn     *time.Time `json:"expires_on,omitempty"` // when the class held expires, if it's too soon
+}
+
+func (p *QualificationProblem) message() string {
+	if p.Reason == QualificationExpiring {
+		return fmt.Sprintf("Staff member %d's class %s license expires %s, before the %s assignment ends",
+			p.StaffID, p.RequiredClass, p.ExpiresOn.Format("2006-01-02"), p.Role)
+	}
+	return fmt.Sprintf("Staff member %d doesn't hold the class %s license a %s needs", p.StaffID, p.RequiredClass,
+		p.Role)
+}
+
+// qualificationProblem checks that the assignment's staff member holds the
+// class its role needs for the whole assignment, returning nil when they do
+func qualificationProblem(repo QualificationRepository, assignment *Assignment) (*QualificationProblem, error) {
+	class := qualificationPolicy.Required[assignment.Role]
+	if class == "" {
+		return nil, nil
+	}
+	held, err := repo.List(assignment.StaffID)
+	if err != nil {
+		return nil, err
+	}
+
+	problem := &QualificationProblem{StaffID: assignment.StaffID, Role: assignment.Role, RequiredClass: class,
+		Reason: QualificationMissing}
+	for _, qualification := range held {
+		if !strings.EqualFold(qualification.Class, class) {
+			continue
+		}
+		if qualification.Covers(assignment) {
+			return nil, nil
+		}
+		problem.Reason = QualificationExpiring
+		problem.ExpiresOn = qualification.ExpiresOn
+	}
+	return problem, nil
+}
+
+// QualificationError refuses a staff member work they aren't qualified for
+type QualificationError struct {
+	Problem QualificationProblem
+}
+
+func (e *QualificationError) Error() string {
+	return e.Problem.message()
+}
+
+// checkQualifications checks the staff member holds the license class the
+// assignment's role needs until it ends. In block mode a missing or expiring
+// class is refused with 409, unless the rule is in shadow mode; in flag mode
+// the request goes ahead with a Warning header. It returns false once a
+// response has been written.
+func checkQualifications(c *gin.Context, qualifications QualificationRepository, assignment *Assignment) bool {
+	if qualificationPolicy.Mode == QualificationOff {
+		return true
+	}
+	problem, err := qualificationProblem(qualifications, assignment)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to check staff qualifications")
+		return false
+	}
+	if problem == nil {
+		return true
+	}
+	if qualificationPolicy.Mode == QualificationFlag {
+		log.Printf("Unqualified assignment by %s: %s", actorFromContext(c), problem.message())
+		c.Header("Warning", fmt.Sprintf("299 - %q", problem.message()))
+		return true
+	}
+	if !enforceRule(c, apierror.RuleStaffQualification, problem.message()) {
+		return true
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": newRuleViolation(apierror.RuleStaffQualification, problem.message()), "qualification": problem})
+	return false
+}
+
+// QualificationRequest records the license a staff member holds in a class
+type QualificationRequest struct {
+	LicenseNumber string `json:"license_number,omitempty"`
+	ExpiresOn     string `json:"expires_on,omitempty"` // YYYY-MM-DD, omitted when it doesn't expire
+}
+
+// QualificationHandler serves the staff qualification endpoints
+type QualificationHandler struct {
+	repo QualificationRepository
+}
+
+// NewQualificationHandler creates a handler storing qualifications in the given repository
+func NewQualificationHandler(repo QualificationRepository) *QualificationHandler {
+	return &QualificationHandler{repo: repo}
+}
+
+// forRequest returns the handler with its repositories bound to the request's context
+func (h *QualificationHandler) forRequest(c *gin.Context) *QualificationHandler {
+	ctx := c.Request.Context()
+	return &QualificationHandler{repo: h.repo.WithContext(ctx)}
+}
+
+func (h *QualificationHandler) handleGetQualifications(c *gin.Context) {
+	h = h.forRequest(c)
+	staffID, ok := staffIDFromParam(c)
+	if !ok {
+		return
+	}
+	qualifications, err := h.repo.List(staffID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve qualifications")
+		return
+	}
+	if qualifications == nil {
+		qualifications = []StaffQualification{}
+	}
+	c.JSON(http.StatusOK, gin.H{"qualifications": qualifications, "count": len(qualifications)})
+}
+
+// handlePutQualification records the license a staff member holds in the
+// class, replacing what was recorded before, e.g. on renewal
+func (h *QualificationHandler) handlePutQualification(c *gin.Context) {
+	h = h.forRequest(c)
+	staffID, ok := staffIDFromParam(c)
+	if !ok {
+		return
+	}
+	class := c.Param("class")
+	if !qualificationClassPattern.MatchString(class) {
+		respondError(c, http.StatusBadRequest, "class must be up to 20 letters, digits, '+', '-' or '_'")
+		return
+	}
+	var req QualificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, &req, err)
+		return
+	}
+
+	qualification := StaffQualification{StaffID: staffID, Class: strings.ToUpper(class),
+		LicenseNumber: strings.TrimSpace(req.LicenseNumber), UpdatedBy: actorFromContext(c)}
+	if req.ExpiresOn != "" {
+		expiresOn, err := time.Parse("2006-01-02", req.ExpiresOn)
+		if err != nil {
+			respondInvalidField(c, "expires_on", "Invalid expires_on format. Use YYYY-MM-DD")
+			return
+		}
+		qualification.ExpiresOn = &expiresOn
+	}
+
+	if err := h.repo.Put(&qualification); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to save qualification")
+		return
+	}
+	c.JSON(http.StatusOK, qualification)
+}
+
+func (h *QualificationHandler) handleDeleteQualification(c *gin.Context) {
+	h = h.forRequest(c)
+	staffID, ok := staffIDFromParam(c)
+	if !ok {
+		return
+	}
+	deleted, err := h.repo.Delete(staffID, strings.ToUpper(c.Param("class")))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to delete qualification")
+		return
+	}
+	if !deleted {
+		respondError(c, http.StatusNotFound, "Qualification not found")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
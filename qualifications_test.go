@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useQualificationPolicy sets the qualification policy for one test
+func useQualificationPolicy(t *testing.T, mode string) {
+	t.Helper()
+	saved := qualificationPolicy
+	qualificationPolicy = QualificationPolicy{Mode: mode, Required: map[string]string{"driver": "D"}}
+	t.Cleanup(func() { qualificationPolicy = saved })
+}
+
+func TestQualificationsBlockUnqualifiedDrivers(t *testing.T) {
+	useQualificationPolicy(t, QualificationBlock)
+	router, _ := newTestRouter(t)
+	body := gin.H{"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": "2025-03-03", "end_date": "2025-06-30"}
+
+	rec := doRequest(router, http.MethodPost, "/api/assignments", body)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("create without a license status = %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body.String())
+	}
+	if got := decode[struct{ Qualification QualificationProblem }](t, rec).Qualification; got.Reason != QualificationMissing {
+		t.Errorf("reason = %q, want %q", got.Reason, QualificationMissing)
+	}
+
+	// Conductors need no license
+	conductor := gin.H{"bus_id": 2, "staff_id": 2, "role": "conductor", "start_date": "2025-03-03"}
+	if rec := doRequest(router, http.MethodPost, "/api/assignments", conductor); rec.Code != http.StatusCreated {
+		t.Errorf("conductor status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+
+	rec = doRequest(router, http.MethodPut, "/api/staff/1/qualifications/d", gin.H{"license_number": "DL-1", "expires_on": "2025-05-31"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("put status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	rec = doRequest(router, http.MethodPost, "/api/assignments", body)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("create past expiry status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if got := decode[struct{ Qualification QualificationProblem }](t, rec).Qualification; got.Reason != QualificationExpiring {
+		t.Errorf("reason = %q, want %q", got.Reason, QualificationExpiring)
+	}
+
+	doRequest(router, http.MethodPut, "/api/staff/1/qualifications/D", gin.H{"license_number": "DL-1", "expires_on": "2026-05-31"})
+	if rec := doRequest(router, http.MethodPost, "/api/assignments", body); rec.Code != http.StatusCreated {
+		t.Errorf("create after renewal status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+
+	// An open-ended assignment outlasts any expiring license
+	body["start_date"], body["end_date"] = "2025-07-01", nil
+	if rec := doRequest(router, http.MethodPost, "/api/assignments", body); rec.Code != http.StatusConflict {
+		t.Errorf("open-ended create status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestQualificationsFlagUnqualifiedDrivers(t *testing.T) {
+	useQualificationPolicy(t, QualificationFlag)
+	router, _ := newTestRouter(t)
+
+	rec := doRequest(router, http.MethodPost, "/api/assignments",
+		gin.H{"bus_id": 1, "staff_id": 1, "role": "driver", "start_date": "2025-03-03"})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	if warning := rec.Header().Get("Warning"); !strings.HasPrefix(warning, "299 - ") || !strings.Contains(warning, "class D") {
+		t.Errorf("Warning = %q, want a 299 warning naming class D", warning)
+	}
+}
+
+func TestQualificationEndpoints(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	if rec := doRequest(router, http.MethodPut, "/api/staff/1/qualifications/D!", gin.H{}); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid class status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := doRequest(router, http.MethodPut, "/api/staff/1/qualifications/D", gin.H{"expires_on": "31/05/2026"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid expires_on status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	doRequest(router, http.MethodPut, "/api/staff/1/qualifications/d1", gin.H{"license_number": "DL-1"})
+	doRequest(router, http.MethodPut, "/api/staff/1/qualifications/D", gin.H{"expires_on": "2026-05-31"})
+
+	rec := doRequest(router, http.MethodGet, "/api/staff/1/qualifications", nil)
+	got := decode[struct{ Qualifications []StaffQualification }](t, rec).Qualifications
+	if len(got) != 2 || got[0].Class != "D" || got[1].Class != "D1" || got[0].ExpiresOn == nil {
+		t.Errorf("qualifications = %+v, want D expiring and D1", got)
+	}
+
+	if rec := doRequest(router, http.MethodDelete, "/api/staff/1/qualifications/d1", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("delete status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if rec := doRequest(router, http.MethodDelete, "/api/staff/1/qualifications/D1", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("second delete status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReassignResult describes the outcome of moving a bus's crew to a replacement
+type ReassignResult struct {
+	FromBusID int          `json:"from_bus_id"`
+	ToBusID   int          `json:"to_bus_id"`
+	FromDate  time.Time    `json:"from_date"`
+	Moved     []Assignment `json:"moved"`     // assignments now on the replacement bus
+	Truncated []Assignment `json:"truncated"` // originals ended the day before from_date
+}
+
+// reassignBus moves every active assignment on fromBusID that is still
+// running on or after fromDate to toBusID. Assignments that started earlier
+// are split: the original ends the day before fromDate and a copy on the
+// replacement bus covers the remainder. Every change is audited, and the
+// repository rolls the whole move back if the replacement bus's existing crew
+// would clash with the incoming assignments, or if the guard wants the move
+// confirmed first.
+func reassignBus(tx assignmentTx, fromBusID, toBusID int, fromDate time.Time, actor string,
+	guard *bulkGuard) (*ReassignResult, error) {
+	result := &ReassignResult{
+		FromBusID: fromBusID,
+		ToBusID:   toBusID,
+		FromDate:  fromDate,
+		Moved:     []Assignment{},
+		Truncated: []Assignment{},
+	}
+
+	affected, err := tx.runningFrom(fromBusID, 0, fromDate)
+	if err != nil {
+		return nil, err
+	}
+	if err := guard.check(newBulkImpact("reassign_bus", affected, nil)); err != nil {
+		return nil, err
+	}
+
+	for _, assignment := range affected {
+		if !assignment.StartDate.Before(fromDate) {
+			assignment.BusID = toBusID
+			if err := tx.update(&assignment, actor); err != nil {
+				return nil, err
+			}
+			result.Moved = append(result.Moved, assignment)
+			continue
+		}
+
+		replacement := Assignment{
+			BusID:           toBusID,
+			StaffID:         assignment.StaffID,
+			Role:            assignment.Role,
+			StartDate:       fromDate,
+			EndDate:         assignment.EndDate,
+			WorkingDays:     assignment.WorkingDays,
+			ShiftStart:      assignment.ShiftStart,
+			ShiftEnd:        assignment.ShiftEnd,
+			DualRoleAllowed: assignment.DualRoleAllowed,
+			Status:          "active",
+		}
+
+		dayBefore := fromDate.AddDate(0, 0, -1)
+		assignment.EndDate = &dayBefore
+		if err := tx.update(&assignment, actor); err != nil {
+			return nil, err
+		}
+		result.Truncated = append(result.Truncated, assignment)
+
+		if err := tx.create(&replacement, actor); err != nil {
+			return nil, err
+		}
+		result.Moved = append(result.Moved, replacement)
+	}
+
+	// Check against the replacement bus's crew only once everything has
+	// moved, so split pieces don't clash with their own originals
+	for _, moved := range result.Moved {
+		conflicts, err := tx.conflicts(&moved)
+		if err != nil {
+			return nil, err
+		}
+		if len(conflicts) > 0 {
+			return nil, &ConflictError{Assignment: moved, Conflicts: conflicts}
+		}
+	}
+	return result, nil
+}
+
+func (h *AssignmentHandler) handleReassignBus(c *gin.Context) {
+	h = h.forRequest(c)
+	busIDStr := c.Param("busId")
+	busID, err := strconv.Atoi(busIDStr)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid bus ID")
+		return
+	}
+
+	toBusID, err := strconv.Atoi(c.Query("to"))
+	if err != nil || toBusID <= 0 {
+		respondInvalidField(c, "to", "Query parameter 'to' must be a valid bus ID")
+		return
+	}
+	if toBusID == busID {
+		respondInvalidField(c, "to", "Replacement bus must differ from the original bus")
+		return
+	}
+	if !checkBusDepots(c, busID, toBusID) {
+		return
+	}
+
+	// Default to today when no from_date is given
+	fromDate := today()
+	if fromDateStr := c.Query("from_date"); fromDateStr != "" {
+		fromDate, err = time.Parse("2006-01-02", fromDateStr)
+		if err != nil {
+			respondInvalidField(c, "from_date", "Invalid from_date format. Use YYYY-MM-DD")
+			return
+		}
+	}
+
+	guard := newBulkGuard(c)
+	result, err := h.repo.ReassignBus(busID, toBusID, fromDate, actorFromContext(c), guard)
+	if err != nil {
+		var conflictErr *ConflictError
+		if errors.As(err, &conflictErr) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":      newAPIError(http.StatusConflict, "Replacement bus already has conflicting crew"),
+				"assignment": conflictErr.Assignment,
+				"conflicts":  conflictErr.Conflicts,
+			})
+			return
+		}
+		if !respondDeletionHold(c, err) || !respondBulkConfirmation(c, err) {
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Failed to reassign bus")
+		return
+	}
+
+	guard.report()
+	c.JSON(http.StatusOK, result)
+}
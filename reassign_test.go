@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestReassignBus(t *testing.T) {
+	router, repo := newTestRouter(t)
+	split := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03")})
+	later := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 2, Role: "conductor", StartDate: date("2025-03-17")})
+
+	if rec := doRequest(router, http.MethodPost, "/api/v1/buses/1/reassign?to=1", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("reassign to the same bus = %d, want 400", rec.Code)
+	}
+
+	rec := doRequest(router, http.MethodPost, "/api/v1/buses/1/reassign?to=2&from_date=2025-03-10", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reassign = %d %s", rec.Code, rec.Body.String())
+	}
+	result := decode[ReassignResult](t, rec)
+	if len(result.Truncated) != 1 || result.Truncated[0].PublicID != split.PublicID || len(result.Moved) != 2 {
+		t.Errorf("result = %+v, want the running assignment split and both moved", result)
+	}
+	if got, _ := repo.Get(later.ID); got == nil || got.BusID != 2 {
+		t.Errorf("later assignment = %+v, want it on bus 2", got)
+	}
+
+	// Bus 3 already has a driver, so moving bus 2's crew there is refused whole
+	mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-03-01")})
+	rec = doRequest(router, http.MethodPost, "/api/v1/buses/2/reassign?to=3&from_date=2025-03-20", nil)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("clashing reassign = %d %s, want 409", rec.Code, rec.Body.String())
+	}
+	if got, _ := repo.Get(later.ID); got == nil || got.BusID != 2 || got.EndDate != nil {
+		t.Errorf("after the refused reassign = %+v, want it left on bus 2", got)
+	}
+}
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"bus-staff-assignment/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+// recurringActor is recorded in the audit trail for assignments generated
+// from recurring templates
+const recurringActor = "recurring-generator"
+
+// Reasons the generator leaves out a week of a template
+const (
+	RecurringSkipConflict    = "conflict"         // it would clash with an active assignment
+	RecurringSkipUnavailable = "unavailable"      // the staff member is on leave, sick or resting
+	RecurringSkipUnqualified = "unqualified"      // they lack the license class, with QUALIFICATION_CHECK=block
+	RecurringSkipDeletion    = "deletion_pending" // the bus or staff member is being deleted
+)
+
+// errTemplateBusy is returned when another generator moved a template on
+// while this one was reading it
+var errTemplateBusy = errors.New("recurring template is being generated by another instance")
+
+// RecurringTemplate is a crew working the same bus on the same weekdays every
+// week. The generator turns each week of it into an assignment ahead of time,
+// so dispatchers don't recreate them by hand.
+type RecurringTemplate struct {
+	ID               int        `json:"id"`
+	BusID            int        `json:"bus_id"`
+	StaffID          int        `json:"staff_id"`
+	Role             string     `json:"role"`         // driver, conductor
+	WorkingDays      DayMask    `json:"working_days"` // e.g. ["mon", "tue", "wed", "thu", "fri"]; empty means every day
+	ShiftStart       *TimeOfDay `json:"shift_start,omitempty"`
+	ShiftEnd         *TimeOfDay `json:"shift_end,omitempty"`
+	ValidFrom        time.Time  `json:"valid_from"`
+	ValidUntil       *time.Time `json:"valid_until,omitempty"`       // last day; omitted while it has no end
+	GeneratedThrough *time.Time `json:"generated_through,omitempty"` // last day assignments were generated for
+	CreatedBy        string     `json:"created_by"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// window returns the days still to generate when generating the given number
+// of days ahead of now, rounded out to the end of the last week. ok is false
+// when there are none.
+func (t *RecurringTemplate) window(now time.Time, days int) (from, to time.Time, ok bool) {
+	today := truncateDate(now)
+	from = truncateDate(t.ValidFrom)
+	if today.After(from) {
+		from = today
+	}
+	if t.GeneratedThrough != nil {
+		if next := truncateDate(*t.GeneratedThrough).AddDate(0, 0, 1); next.After(from) {
+			from = next
+		}
+	}
+
+	to = endOfWeek(today.AddDate(0, 0, days-1))
+	if t.ValidUntil != nil && t.ValidUntil.Before(to) {
+		to = truncateDate(*t.ValidUntil)
+	}
+	if schedulingHorizon.Months > 0 {
+		if latest := schedulingHorizon.LatestStart(now); latest.Before(to) {
+			to = latest
+		}
+	}
+	return from, to, !to.Before(from)
+}
+
+// occurrence builds the assignment covering the template's working days
+// between from and to, trimmed to the first and last of them. ok is false
+// when none falls in the range.
+func (t *RecurringTemplate) occurrence(from, to time.Time) (assignment Assignment, ok bool) {
+	for !from.After(to) && !t.WorkingDays.Includes(from.Weekday()) {
+		from = from.AddDate(0, 0, 1)
+	}
+	for !to.Before(from) && !t.WorkingDays.Includes(to.Weekday()) {
+		to = to.AddDate(0, 0, -1)
+	}
+	if to.Before(from) {
+		return Assignment{}, false
+	}
+	return Assignment{
+		BusID:       t.BusID,
+		StaffID:     t.StaffID,
+		Role:        t.Role,
+		StartDate:   from,
+		EndDate:     &to,
+		WorkingDays: t.WorkingDays,
+		ShiftStart:  t.ShiftStart,
+		ShiftEnd:    t.ShiftEnd,
+		Notes:       fmt.Sprintf("Generated from recurring template %d", t.ID),
+		Status:      "active",
+	}, true
+}
+
+// endOfWeek returns the Sunday ending the Monday-to-Sunday week of the date
+func endOfWeek(date time.Time) time.Time {
+	return date.AddDate(0, 0, (7-int(date.Weekday()))%7)
+}
+
+// RecurringTemplateRequest creates or replaces a recurring template
+type RecurringTemplateRequest struct {
+	BusID       int        `json:"bus_id" binding:"required"`
+	StaffID     int        `json:"staff_id" binding:"required"`
+	Role        string     `json:"role" binding:"required"`
+	WorkingDays DayMask    `json:"working_days,omitempty"` // e.g. ["mon", "wed", "fri"]
+	ShiftStart  *TimeOfDay `json:"shift_start,omitempty"`  // HH:MM, set together with shift_end
+	ShiftEnd    *TimeOfDay `json:"shift_end,omitempty"`
+	ValidFrom   string     `json:"valid_from" binding:"required"` // YYYY-MM-DD format
+	ValidUntil  string     `json:"valid_until,omitempty"`         // YYYY-MM-DD format, inclusive
+}
+
+// apply validates the request and copies it onto the given template. It
+// returns the field at fault, or nil when the request is valid.
+func (req RecurringTemplateRequest) apply(template *RecurringTemplate) *FieldError {
+	validFrom, err := time.Parse("2006-01-02", req.ValidFrom)
+	if err != nil {
+		return &FieldError{Field: "valid_from", Message: "Invalid valid_from format. Use YYYY-MM-DD"}
+	}
+	var validUntil *time.Time
+	if req.ValidUntil != "" {
+		until, err := time.Parse("2006-01-02", req.ValidUntil)
+		if err != nil {
+			return &FieldError{Field: "valid_until", Message: "Invalid valid_until format. Use YYYY-MM-DD"}
+		}
+		if until.Before(validFrom) {
+			return &FieldError{Field: "valid_until", Message: "valid_until must not be before valid_from"}
+		}
+		validUntil = &until
+	}
+
+	candidate := Assignment{BusID: req.BusID, StaffID: req.StaffID, Role: req.Role, StartDate: validFrom,
+		ShiftStart: req.ShiftStart, ShiftEnd: req.ShiftEnd}
+	if fieldErr := validateAssignment(&candidate); fieldErr != nil {
+		return fieldErr
+	}
+
+	template.BusID = req.BusID
+	template.StaffID = req.StaffID
+	template.Role = req.Role
+	template.WorkingDays = req.WorkingDays
+	template.ShiftStart = req.ShiftStart
+	template.ShiftEnd = req.ShiftEnd
+	template.ValidFrom = validFrom
+	template.ValidUntil = validUntil
+	return nil
+}
+
+// RecurringTemplateRepository stores recurring templates
+type RecurringTemplateRepository interface {
+	Create(template *RecurringTemplate) error
+	Get(id int) (*RecurringTemplate, error)   // nil, nil when not found
+	Update(template *RecurringTemplate) error // replaces the definition, keeping generated_through
+	Delete(id int) (bool, error)
+	List() ([]RecurringTemplate, error) // ordered by ID
+
+	// Advance moves generated_through from previous to through, reporting
+	// false when it no longer is previous, so two generators never take the
+	// same weeks
+	Advance(id int, previous *time.Time, through time.Time) (bool, error)
+
+	WithContext(ctx context.Context) RecurringTemplateRepository
+}
+
+// RecurringSkip is a week of a template the generator left out, for a
+// dispatcher to cover by hand
+type RecurringSkip struct {
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	Reason    string    `json:"reason"` // conflict, unavailable, unqualified, deletion_pending
+	Message   string    `json:"message"`
+}
+
+// RecurringGeneration is what one run of the generator did for a template
+type RecurringGeneration struct {
+	TemplateID       int             `json:"template_id"`
+	GeneratedThrough *time.Time      `json:"generated_through,omitempty"`
+	Created          []Assignment    `json:"created"`
+	Skipped          []RecurringSkip `json:"skipped"`
+}
+
+// RecurringGenerator turns recurring templates into assignments, one per
+// week, a set number of days ahead. Each week passes the conflict,
+// availability and qualification checks a dispatcher's assignment would, or
+// is skipped; skipped weeks aren't retried.
+type RecurringGenerator struct {
+	templates      RecurringTemplateRepository
+	assignments    AssignmentRepository
+	availability   AvailabilityRepository
+	qualifications QualificationRepository
+	days           int
+	interval       time.Duration
+	ctx            context.Context
+}
+
+// NewRecurringGenerator creates a generator covering the next
+// RECURRING_GENERATE_DAYS days (default 14, rounded out to whole weeks) and
+// running every RECURRING_GENERATE_INTERVAL (default 1h)
+func NewRecurringGenerator(templates RecurringTemplateRepository, assignments AssignmentRepository,
+	availability AvailabilityRepository, qualifications QualificationRepository) *RecurringGenerator {
+	days := 14
+	if value := os.Getenv("RECURRING_GENERATE_DAYS"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			days = parsed
+		} else {
+			log.Printf("Invalid RECURRING_GENERATE_DAYS %q, using %d", value, days)
+		}
+	}
+	return &RecurringGenerator{templates: templates, assignments: assignments, availability: availability,
+		qualifications: qualifications, days: days,
+		interval: durationFromEnv("RECURRING_GENERATE_INTERVAL", time.Hour), ctx: context.Background()}
+}
+
+// withContext returns the generator with its repositories bound to ctx
+func (g *RecurringGenerator) withContext(ctx context.Context) *RecurringGenerator {
+	bound := *g
+	bound.ctx = ctx
+	bound.templates = g.templates.WithContext(ctx)
+	bound.assignments = g.assignments.WithContext(ctx)
+	bound.availability = g.availability.WithContext(ctx)
+	bound.qualifications = g.qualifications.WithContext(ctx)
+	return &bound
+}
+
+// Run generates the assignments of every template until the context is cancelled
+func (g *RecurringGenerator) Run(ctx context.Context) {
+	monitor := backgroundWorkers.Register("recurring_generator", tickerStallAfter(g.interval), nil)
+	defer backgroundWorkers.Unregister("recurring_generator")
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := g.generateAll(ctx, clock.Now())
+			monitor.Record(err)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Recurring assignment generation error: %v", err)
+			}
+		}
+	}
+}
+
+// generateAll generates every template's assignments up to the days ahead of
+// now, logging what was created and skipped. A failing template doesn't stop
+// the others.
+func (g *RecurringGenerator) generateAll(ctx context.Context, now time.Time) ([]RecurringGeneration, error) {
+	g = g.withContext(ctx)
+	templates, err := g.templates.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var generations []RecurringGeneration
+	var errs []error
+	for _, template := range templates {
+		if err := ctx.Err(); err != nil {
+			return generations, err
+		}
+		generation, err := g.generate(&template, now)
+		if errors.Is(err, errTemplateBusy) {
+			continue
+		}
+		if generation != nil {
+			for _, assignment := range generation.Created {
+				log.Printf("Generated assignment %s (bus %d, staff %d) from recurring template %d for %s to %s",
+					assignment.PublicID, assignment.BusID, assignment.StaffID, template.ID,
+					assignment.StartDate.Format("2006-01-02"), assignment.EndDate.Format("2006-01-02"))
+			}
+			for _, skip := range generation.Skipped {
+				log.Printf("Skipped recurring template %d for %s to %s: %s", template.ID,
+					skip.StartDate.Format("2006-01-02"), skip.EndDate.Format("2006-01-02"), skip.Message)
+			}
+			generations = append(generations, *generation)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("recurring template %d: %w", template.ID, err))
+		}
+	}
+	return generations, errors.Join(errs...)
+}
+
+// generate creates the template's assignments for the weeks up to the days
+// ahead of now that haven't been generated yet. The weeks are taken before
+// any is created, so another instance can't generate them too; on failure
+// the weeks not yet reached are handed back. It fails with errTemplateBusy
+// when another instance took them first.
+func (g *RecurringGenerator) generate(template *RecurringTemplate, now time.Time) (*RecurringGeneration, error) {
+	generation := &RecurringGeneration{TemplateID: template.ID, GeneratedThrough: template.GeneratedThrough,
+		Created: []Assignment{}, Skipped: []RecurringSkip{}}
+	from, to, ok := template.window(now, g.days)
+	if !ok {
+		return generation, nil
+	}
+	taken, err := g.templates.Advance(template.ID, template.GeneratedThrough, to)
+	if err != nil {
+		return nil, err
+	}
+	if !taken {
+		return nil, errTemplateBusy
+	}
+
+	for weekStart := from; !weekStart.After(to); {
+		weekEnd := endOfWeek(weekStart)
+		if weekEnd.After(to) {
+			weekEnd = to
+		}
+		if err := g.generateWeek(template, weekStart, weekEnd, generation); err != nil {
+			through := weekStart.AddDate(0, 0, -1)
+			if _, releaseErr := g.templates.Advance(template.ID, &to, through); releaseErr != nil {
+				log.Printf("Recurring template %d: handing back the weeks from %s failed: %v", template.ID,
+					weekStart.Format("2006-01-02"), releaseErr)
+			} else {
+				generation.GeneratedThrough = &through
+			}
+			return generation, err
+		}
+		weekStart = weekEnd.AddDate(0, 0, 1)
+	}
+	generation.GeneratedThrough = &to
+	template.GeneratedThrough = &to
+	return generation, nil
+}
+
+// generateWeek creates the assignment for the template's working days between
+// from and to, or records why it was skipped
+func (g *RecurringGenerator) generateWeek(template *RecurringTemplate, from, to time.Time,
+	generation *RecurringGeneration) error {
+	assignment, ok := template.occurrence(from, to)
+	if !ok {
+		return nil
+	}
+	reason, message, err := g.check(&assignment)
+	if err != nil {
+		return err
+	}
+	if reason == "" {
+		err = g.assignments.Create(&assignment, recurringActor)
+		var holdErr *DeletionHoldError
+		if errors.As(err, &holdErr) {
+			reason, message = RecurringSkipDeletion, holdErr.Error()
+		} else if err != nil {
+			return err
+		}
+	}
+	if reason != "" {
+		generation.Skipped = append(generation.Skipped, RecurringSkip{StartDate: assignment.StartDate,
+			EndDate: *assignment.EndDate, Reason: reason, Message: message})
+		return nil
+	}
+	generation.Created = append(generation.Created, assignment)
+	return nil
+}
+
+// check runs the checks a dispatcher's new assignment must pass, returning
+// the reason and message when the assignment must be skipped
+func (g *RecurringGenerator) check(assignment *Assignment) (reason, message string, err error) {
+	conflicts, err := g.assignments.FindConflicts(assignment)
+	if err != nil {
+		return "", "", err
+	}
+	if len(conflicts) > 0 {
+		references := make([]string, len(conflicts))
+		for i, conflict := range conflicts {
+			references[i] = conflict.Reference
+		}
+		return RecurringSkipConflict, "Conflicts with " + strings.Join(references, ", "), nil
+	}
+
+	unavailable, err := unavailableFor(g.availability, assignment)
+	if err != nil {
+		return "", "", err
+	}
+	if len(unavailable) > 0 {
+		message := unavailableMessage(assignment.StaffID, unavailable)
+		if shadowRules.Enforce(g.ctx, apierror.RuleStaffAvailability, recurringActor, message) {
+			return RecurringSkipUnavailable, message, nil
+		}
+	}
+
+	if qualificationPolicy.Mode == QualificationOff {
+		return "", "", nil
+	}
+	problem, err := qualificationProblem(g.qualifications, assignment)
+	if err != nil || problem == nil {
+		return "", "", err
+	}
+	if qualificationPolicy.Mode != QualificationBlock {
+		log.Printf("Unqualified assignment generated by %s: %s", recurringActor, problem.message())
+	} else if shadowRules.Enforce(g.ctx, apierror.RuleStaffQualification, recurringActor, problem.message()) {
+		return RecurringSkipUnqualified, problem.message(), nil
+	}
+	return "", "", nil
+}
+
+// RecurringTemplateHandler serves the recurring template endpoints
+type RecurringTemplateHandler struct {
+	templates RecurringTemplateRepository
+	generator *RecurringGenerator
+}
+
+// NewRecurringTemplateHandler creates a handler storing templates in the
+// given repository and generating their assignments on request with the
+// given generator
+func NewRecurringTemplateHandler(templates RecurringTemplateRepository,
+	generator *RecurringGenerator) *RecurringTemplateHandler {
+	return &RecurringTemplateHandler{templates: templates, generator: generator}
+}
+
+// forRequest returns the handler with its repositories bound to the request's context
+func (h *RecurringTemplateHandler) forRequest(c *gin.Context) *RecurringTemplateHandler {
+	ctx := c.Request.Context()
+	return &RecurringTemplateHandler{templates: h.templates.WithContext(ctx), generator: h.generator.withContext(ctx)}
+}
+
+// templateFromParam loads the template named by the :id path parameter,
+// treating templates on another depot's buses as missing. It returns nil
+// once an error response has been written.
+func (h *RecurringTemplateHandler) templateFromParam(c *gin.Context) *RecurringTemplate {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid recurring template ID")
+		return nil
+	}
+
+	template, err := h.templates.Get(id)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Database error")
+		return nil
+	}
+	if template == nil || !callerClearance(c).AllowsDepot(busDepot(template.BusID)) {
+		respondError(c, http.StatusNotFound, "Recurring template not found")
+		return nil
+	}
+	return template
+}
+
+func (h *RecurringTemplateHandler) handleGetRecurringTemplates(c *gin.Context) {
+	h = h.forRequest(c)
+	templates, err := h.templates.List()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve recurring templates")
+		return
+	}
+
+	clearance := callerClearance(c)
+	visible := []RecurringTemplate{}
+	for _, template := range templates {
+		if clearance.AllowsDepot(busDepot(template.BusID)) {
+			visible = append(visible, template)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"recurring_assignments": visible, "count": len(visible)})
+}
+
+func (h *RecurringTemplateHandler) handleGetRecurringTemplate(c *gin.Context) {
+	h = h.forRequest(c)
+	if template := h.templateFromParam(c); template != nil {
+		c.JSON(http.StatusOK, template)
+	}
+}
+
+func (h *RecurringTemplateHandler) handleCreateRecurringTemplate(c *gin.Context) {
+	h = h.forRequest(c)
+	var req RecurringTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, &req, err)
+		return
+	}
+
+	template := RecurringTemplate{CreatedBy: actorFromContext(c)}
+	if fieldErr := req.apply(&template); fieldErr != nil {
+		respondInvalid(c, *fieldErr)
+		return
+	}
+	if !checkBusDepots(c, template.BusID) {
+		return
+	}
+
+	if err := h.templates.Create(&template); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to create recurring template")
+		return
+	}
+	c.JSON(http.StatusCreated, template)
+}
+
+// handleUpdateRecurringTemplate replaces a template's definition. Weeks
+// already generated keep their assignments, which are changed like any other.
+func (h *RecurringTemplateHandler) handleUpdateRecurringTemplate(c *gin.Context) {
+	h = h.forRequest(c)
+	template := h.templateFromParam(c)
+	if template == nil {
+		return
+	}
+
+	var req RecurringTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, &req, err)
+		return
+	}
+	if fieldErr := req.apply(template); fieldErr != nil {
+		respondInvalid(c, *fieldErr)
+		return
+	}
+	if !checkBusDepots(c, template.BusID) {
+		return
+	}
+
+	if err := h.templates.Update(template); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to update recurring template")
+		return
+	}
+	c.JSON(http.StatusOK, template)
+}
+
+// handleDeleteRecurringTemplate stops a template generating assignments. The
+// ones already generated are kept.
+func (h *RecurringTemplateHandler) handleDeleteRecurringTemplate(c *gin.Context) {
+	h = h.forRequest(c)
+	template := h.templateFromParam(c)
+	if template == nil {
+		return
+	}
+
+	deleted, err := h.templates.Delete(template.ID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to delete recurring template")
+		return
+	}
+	if !deleted {
+		respondError(c, http.StatusNotFound, "Recurring template not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Recurring template deleted successfully"})
+}
+
+// handleGenerateRecurringTemplate generates the template's assignments now,
+// rather than on the generator's next run, e.g. straight after creating it
+func (h *RecurringTemplateHandler) handleGenerateRecurringTemplate(c *gin.Context) {
+	h = h.forRequest(c)
+	template := h.templateFromParam(c)
+	if template == nil {
+		return
+	}
+
+	generation, err := h.generator.generate(template, clock.Now())
+	if errors.Is(err, errTemplateBusy) {
+		respondError(c, http.StatusConflict, "The template's assignments are being generated; try again shortly")
+		return
+	}
+	if err != nil {
+		log.Printf("Recurring template %d: generating failed: %v", template.ID, err)
+		respondError(c, http.StatusInternalServerError, "Failed to generate assignments")
+		return
+	}
+	c.JSON(http.StatusOK, generation)
+}
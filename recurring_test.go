@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRecurringTemplateWindow(t *testing.T) {
+	until := date("2025-03-28")
+	template := RecurringTemplate{ValidFrom: date("2025-03-03"), ValidUntil: &until}
+	now := time.Date(2025, 3, 5, 9, 0, 0, 0, time.UTC) // a Wednesday
+
+	from, to, ok := template.window(now, 14)
+	if !ok || !from.Equal(date("2025-03-05")) || !to.Equal(date("2025-03-23")) {
+		t.Errorf("window = %s to %s, %v; want today to the Sunday two weeks on", from, to, ok)
+	}
+
+	through := date("2025-03-23")
+	template.GeneratedThrough = &through
+	if from, to, ok := template.window(now.AddDate(0, 0, 14), 14); !ok || !from.Equal(date("2025-03-24")) ||
+		!to.Equal(until) {
+		t.Errorf("later window = %s to %s, %v; want the week after the generated ones, up to valid_until", from, to, ok)
+	}
+	if _, _, ok := template.window(now, 14); ok {
+		t.Error("window with every week generated, want none")
+	}
+}
+
+func TestRecurringTemplateOccurrence(t *testing.T) {
+	weekdays, _ := ParseDayMask([]string{"mon", "tue", "wed", "thu", "fri"})
+	template := RecurringTemplate{ID: 7, BusID: 1, StaffID: 1, Role: "driver", WorkingDays: weekdays}
+
+	assignment, ok := template.occurrence(date("2025-03-08"), date("2025-03-16"))
+	if !ok || !assignment.StartDate.Equal(date("2025-03-10")) || !assignment.EndDate.Equal(date("2025-03-14")) {
+		t.Errorf("occurrence = %s to %v, %v; want trimmed to Monday to Friday", assignment.StartDate, assignment.EndDate, ok)
+	}
+	if _, ok := template.occurrence(date("2025-03-08"), date("2025-03-09")); ok {
+		t.Error("occurrence over a weekend, want none")
+	}
+}
+
+func TestRecurringGenerator(t *testing.T) {
+	store := NewMemoryStorage()
+	generator := NewRecurringGenerator(store.Recurring, store.Assignments, store.Availability, store.Qualifications)
+	generator.days = 14
+
+	weekdays, _ := ParseDayMask([]string{"mon", "tue", "wed", "thu", "fri"})
+	until := date("2025-03-28")
+	template := &RecurringTemplate{BusID: 1, StaffID: 1, Role: "driver", WorkingDays: weekdays,
+		ValidFrom: date("2025-03-03"), ValidUntil: &until}
+	if err := store.Recurring.Create(template); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second week clashes with another driver on the bus; the third with leave
+	clashEnd := date("2025-03-11")
+	clash := mustCreate(t, store.Assignments, Assignment{BusID: 1, StaffID: 2, Role: "driver",
+		StartDate: date("2025-03-11"), EndDate: &clashEnd})
+	leave := &AvailabilityPeriod{StaffID: 1, Type: AvailabilityLeave, StartDate: date("2025-03-19"),
+		EndDate: date("2025-03-20")}
+	if err := store.Availability.Create(leave); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2025, 3, 5, 9, 0, 0, 0, time.UTC)
+	generated, err := generator.generateAll(context.Background(), now)
+	if err != nil || len(generated) != 1 {
+		t.Fatalf("generateAll = %+v, %v", generated, err)
+	}
+	generation := generated[0]
+	if len(generation.Created) != 1 || !generation.Created[0].StartDate.Equal(date("2025-03-05")) ||
+		!generation.Created[0].EndDate.Equal(date("2025-03-07")) {
+		t.Errorf("created = %+v, want the rest of this week", generation.Created)
+	}
+	if len(generation.Skipped) != 2 || generation.Skipped[0].Reason != RecurringSkipConflict ||
+		generation.Skipped[0].Message != "Conflicts with "+clash.Reference ||
+		generation.Skipped[1].Reason != RecurringSkipUnavailable {
+		t.Errorf("skipped = %+v, want the clashing week and the week with leave", generation.Skipped)
+	}
+	if generation.GeneratedThrough == nil || !generation.GeneratedThrough.Equal(date("2025-03-23")) {
+		t.Errorf("generated through %v, want the end of the third week", generation.GeneratedThrough)
+	}
+
+	if again, err := generator.generateAll(context.Background(), now); err != nil || len(again[0].Created) != 0 ||
+		len(again[0].Skipped) != 0 {
+		t.Errorf("second run = %+v, %v; want nothing new", again, err)
+	}
+
+	later, err := generator.generateAll(context.Background(), now.AddDate(0, 0, 19))
+	if err != nil || len(later[0].Created) != 1 || !later[0].Created[0].EndDate.Equal(until) {
+		t.Errorf("run in the last week = %+v, %v; want its assignment ending with the template", later, err)
+	}
+
+	stale := *template
+	if _, err := generator.generate(&stale, now.AddDate(0, 0, 1)); !errors.Is(err, errTemplateBusy) {
+		t.Errorf("generating from a stale copy = %v, want errTemplateBusy", err)
+	}
+}
+
+func TestRecurringTemplateEndpoints(t *testing.T) {
+	useTravelClock(t).Set(time.Date(2025, 3, 5, 9, 0, 0, 0, time.UTC), true, "test")
+	router, _ := newTestRouter(t)
+
+	rec := doRequest(router, http.MethodPost, "/api/v1/recurring-assignments", gin.H{"bus_id": 1, "staff_id": 1,
+		"role": "driver", "working_days": []string{"mon", "wed"}, "valid_from": "2025-03-03",
+		"valid_until": "2025-03-01"})
+	if got := errorOf(t, rec); rec.Code != http.StatusBadRequest || len(got.Fields) != 1 || got.Fields[0].Field != "valid_until" {
+		t.Errorf("valid_until before valid_from = %d %+v, want it rejected", rec.Code, got)
+	}
+
+	rec = doRequest(router, http.MethodPost, "/api/v1/recurring-assignments", gin.H{"bus_id": 1, "staff_id": 1,
+		"role": "driver", "working_days": []string{"mon", "wed"}, "valid_from": "2025-03-03"})
+	created := decode[RecurringTemplate](t, rec)
+	if rec.Code != http.StatusCreated || created.ID == 0 || created.GeneratedThrough != nil {
+		t.Fatalf("create = %d %+v", rec.Code, created)
+	}
+	path := "/api/v1/recurring-assignments/" + strconv.Itoa(created.ID)
+
+	rec = doRequest(router, http.MethodPut, path, gin.H{"bus_id": 1, "staff_id": 1, "role": "driver",
+		"working_days": []string{"mon", "wed", "fri"}, "valid_from": "2025-03-03"})
+	if updated := decode[RecurringTemplate](t, rec); rec.Code != http.StatusOK || len(updated.WorkingDays.Days()) != 3 {
+		t.Errorf("update = %d %+v, want Fridays added", rec.Code, updated)
+	}
+
+	rec = doRequest(router, http.MethodPost, path+"/generate", nil)
+	generation := decode[RecurringGeneration](t, rec)
+	if rec.Code != http.StatusOK || len(generation.Created) != 3 {
+		t.Fatalf("generate = %d %+v, want this week and the next two", rec.Code, generation)
+	}
+	if notes := generation.Created[0].Notes; notes != "Generated from recurring template "+strconv.Itoa(created.ID) {
+		t.Errorf("notes = %q", notes)
+	}
+	rec = doRequest(router, http.MethodPost, path+"/generate", nil)
+	if again := decode[RecurringGeneration](t, rec); rec.Code != http.StatusOK || len(again.Created) != 0 {
+		t.Errorf("generate again = %d %+v, want nothing new", rec.Code, again)
+	}
+
+	list := decode[struct {
+		RecurringAssignments []RecurringTemplate `json:"recurring_assignments"`
+		Count                int
+	}](t, doRequest(router, http.MethodGet, "/api/v1/recurring-assignments", nil))
+	if list.Count != 1 || list.RecurringAssignments[0].GeneratedThrough == nil {
+		t.Errorf("list = %+v, want the template, generated", list)
+	}
+
+	if rec := doRequest(router, http.MethodDelete, path, nil); rec.Code != http.StatusOK {
+		t.Errorf("delete = %d", rec.Code)
+	}
+	if rec := doRequest(router, http.MethodGet, path, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("get deleted = %d, want 404", rec.Code)
+	}
+	assignments := decode[struct{ Count int }](t, doRequest(router, http.MethodGet, "/api/v1/assignments", nil))
+	if assignments.Count != 3 {
+		t.Errorf("%d assignments after deleting the template, want the generated ones kept", assignments.Count)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyPrefix namespaces the directory cache in a shared Redis
+const redisKeyPrefix = "bus-staff-assignment:directory:"
+
+const redisTimeout = 2 * time.Second
+
+// redisFlushBatch is how many keys Flush scans for and deletes at a time
+const redisFlushBatch = 500
+
+// redisDirectoryCache stores directory entries as JSON under expiring keys
+type redisDirectoryCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// newRedisDirectoryCache connects to a URL such as redis://:password@host:6379/0,
+// or rediss:// for TLS. Connections are made on first use.
+func newRedisDirectoryCache(rawURL string, ttl time.Duration) (*redisDirectoryCache, error) {
+	options, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL %q (use redis[s]://[:password@]host:port[/db]): %w", rawURL, err)
+	}
+	options.DialTimeout, options.ReadTimeout, options.WriteTimeout = redisTimeout, redisTimeout, redisTimeout
+	return &redisDirectoryCache{client: redis.NewClient(options), ttl: ttl}, nil
+}
+
+func (r *redisDirectoryCache) Get(key string) (map[string]string, bool, error) {
+	data, err := r.client.Get(context.Background(), redisKeyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var entry map[string]string
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false, err
+	}
+	return entry, true, nil
+}
+
+func (r *redisDirectoryCache) Set(key string, entry map[string]string) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(context.Background(), redisKeyPrefix+key, data, r.ttl).Err()
+}
+
+func (r *redisDirectoryCache) Delete(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = redisKeyPrefix + key
+	}
+	return r.client.Del(context.Background(), names...).Err()
+}
+
+// Flush deletes the cache's keys a page at a time, leaving anything else in
+// the Redis untouched
+func (r *redisDirectoryCache) Flush() error {
+	ctx := context.Background()
+	var cursor uint64
+	for {
+		keys, next, err := r.client.Scan(ctx, cursor, redisKeyPrefix+"*", redisFlushBatch).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := r.client.Del(ctx, keys...).Err(); err != nil {
+				return err
+			}
+		}
+		if cursor = next; cursor == 0 {
+			return nil
+		}
+	}
+}
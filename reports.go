@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/csv"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxReportDays bounds a report period. Reports are aggregated in the
+// database, so they can cover far more than a roster request.
+const maxReportDays = 366
+
+// StaffWorkload is what one staff member worked over a period, aggregated
+// from their assignments that aren't cancelled or deleted
+type StaffWorkload struct {
+	StaffID        int
+	Assignments    int     // assignments worked on at least one day
+	AssignmentDays int     // days worked, summed over those assignments
+	WorkedDays     int     // distinct dates worked
+	Buses          int     // distinct buses worked on
+	WorkedHours    float64 // shift hours on each day worked, summed over those assignments
+}
+
+// BusDayCrew is the roles anyone is assigned to on one bus on one date
+type BusDayCrew struct {
+	BusID int
+	Date  time.Time
+	Roles []string // sorted
+}
+
+// StaffUtilizationRow is one staff member's line in the utilization report
+type StaffUtilizationRow struct {
+	StaffID        int     `json:"staff_id"`
+	StaffName      string  `json:"staff_name,omitempty"`
+	Position       string  `json:"position,omitempty"`
+	Depot          string  `json:"depot,omitempty"`
+	Assignments    int     `json:"assignments"`
+	AssignmentDays int     `json:"assignment_days"`
+	WorkedDays     int     `json:"worked_days"`
+	Buses          int     `json:"buses"`
+	WorkedHours    float64 `json:"worked_hours"` // to two decimal places
+	Utilization    float64 `json:"utilization"`  // worked days over the days in the period
+}
+
+// CoverageGap is a run of consecutive service days on which a bus lacks the
+// same roles
+type CoverageGap struct {
+	From    string   `json:"from"` // YYYY-MM-DD
+	To      string   `json:"to"`
+	Missing []string `json:"missing"`
+}
+
+// BusCoverageRow is one bus's line in the coverage report
+type BusCoverageRow struct {
+	BusID                int           `json:"bus_id"`
+	BusPlateNumber       string        `json:"bus_plate_number,omitempty"`
+	Depot                string        `json:"depot,omitempty"`
+	ServiceDays          int           `json:"service_days"` // days its depot runs service
+	CoveredDays          int           `json:"covered_days"` // service days with every role assigned
+	GapDays              int           `json:"gap_days"`
+	MissingDriverDays    int           `json:"missing_driver_days"`
+	MissingConductorDays int           `json:"missing_conductor_days"`
+	Coverage             float64       `json:"coverage"` // covered days over service days
+	Gaps                 []CoverageGap `json:"gaps"`
+}
+
+// reportRatio rounds a share to three decimal places, treating 0/0 as 0
+func reportRatio(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(whole)*1000) / 1000
+}
+
+// staffUtilization builds a row for every known staff member at the depot, or
+// every depot when it's empty, and for any other staff member who worked
+func staffUtilization(workloads []StaffWorkload, periodDays int, depot string) []StaffUtilizationRow {
+	byStaff := map[int]StaffWorkload{}
+	for _, workload := range workloads {
+		byStaff[workload.StaffID] = workload
+	}
+	ids := sortedKeys(mockStaff)
+	for staffID := range byStaff {
+		if _, known := mockStaff[staffID]; !known {
+			ids = append(ids, staffID)
+		}
+	}
+	sort.Ints(ids)
+
+	rows := []StaffUtilizationRow{}
+	for _, staffID := range ids {
+		staff := mockStaff[staffID]
+		if depot != "" && staff["depot"] != depot {
+			continue
+		}
+		workload := byStaff[staffID]
+		rows = append(rows, StaffUtilizationRow{
+			StaffID:        staffID,
+			StaffName:      staff["name"],
+			Position:       staff["position"],
+			Depot:          staff["depot"],
+			Assignments:    workload.Assignments,
+			AssignmentDays: workload.AssignmentDays,
+			WorkedDays:     workload.WorkedDays,
+			Buses:          workload.Buses,
+			WorkedHours:    math.Round(workload.WorkedHours*100) / 100,
+			Utilization:    reportRatio(workload.WorkedDays, periodDays),
+		})
+	}
+	return rows
+}
+
+// busCoverage checks every known bus at the depot, or every depot when it's
+// empty, on each day of the period its depot runs service. A role counts as
+// covered on a day when anyone holds it on the bus; gaps between shifts
+// within a day are left to the crew status endpoints.
+func busCoverage(crews []BusDayCrew, calendars map[string]*DepotCalendar, from, to time.Time,
+	depot string) []BusCoverageRow {
+	roles := map[int]map[string][]string{}
+	for _, crew := range crews {
+		if roles[crew.BusID] == nil {
+			roles[crew.BusID] = map[string][]string{}
+		}
+		roles[crew.BusID][crew.Date.Format("2006-01-02")] = crew.Roles
+	}
+
+	rows := []BusCoverageRow{}
+	for _, busID := range sortedKeys(mockBuses) {
+		bus := mockBuses[busID]
+		if depot != "" && bus["depot"] != depot {
+			continue
+		}
+		row := BusCoverageRow{BusID: busID, BusPlateNumber: bus["plate_number"], Depot: bus["depot"], Gaps: []CoverageGap{}}
+		var open *CoverageGap // the gap still running on the previous day
+		for date := from; !date.After(to); date = date.AddDate(0, 0, 1) {
+			if calendars[bus["depot"]].ServiceOn(date).Level == ServiceNone {
+				open = nil
+				continue
+			}
+			row.ServiceDays++
+
+			day := date.Format("2006-01-02")
+			var missing []string
+			for _, role := range requiredCrewRoles {
+				if !slices.Contains(roles[busID][day], role) {
+					missing = append(missing, role)
+				}
+			}
+			if len(missing) == 0 {
+				row.CoveredDays++
+				open = nil
+				continue
+			}
+
+			row.GapDays++
+			if slices.Contains(missing, "driver") {
+				row.MissingDriverDays++
+			}
+			if slices.Contains(missing, "conductor") {
+				row.MissingConductorDays++
+			}
+			if open != nil && slices.Equal(open.Missing, missing) {
+				open.To = day
+				continue
+			}
+			row.Gaps = append(row.Gaps, CoverageGap{From: day, To: day, Missing: missing})
+			open = &row.Gaps[len(row.Gaps)-1]
+		}
+		row.Coverage = reportRatio(row.CoveredDays, row.ServiceDays)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// parseReportRequest reads the period, optional depot and format shared by
+// the reports, limited to the caller's depot. It returns false once an error response has been written.
+func parseReportRequest(c *gin.Context) (from, to time.Time, depot, format string, ok bool) {
+	from, to, ok = parseDateRange(c, c.Query("from"), c.Query("to"), "Report", maxReportDays)
+	if !ok {
+		return
+	}
+	format = c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		respondInvalidField(c, "format", "Unsupported report format. Use json or csv")
+		return from, to, "", "", false
+	}
+	depot, ok = depotQuery(c)
+	return from, to, depot, format, ok
+}
+
+// writeReportCSV sends a report as a CSV attachment
+func writeReportCSV(c *gin.Context, filename string, header []string, records [][]string) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write(header)
+	writer.WriteAll(records)
+}
+
+func formatRatio(value float64) string {
+	return strconv.FormatFloat(value, 'f', 3, 64)
+}
+
+// handleGetStaffUtilization reports the days and hours each staff member
+// worked over a period
+func (h *AssignmentHandler) handleGetStaffUtilization(c *gin.Context) {
+	h = h.forRequest(c)
+	from, to, depot, format, ok := parseReportRequest(c)
+	if !ok {
+		return
+	}
+
+	workloads, err := h.repo.StaffWorkload(from, to)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to compute staff utilization")
+		return
+	}
+	periodDays := int(to.Sub(from).Hours()/24) + 1
+	rows := staffUtilization(workloads, periodDays, depot)
+
+	if format == "csv" {
+		records := make([][]string, len(rows))
+		for i, row := range rows {
+			records[i] = []string{strconv.Itoa(row.StaffID), row.StaffName, row.Position, row.Depot,
+				strconv.Itoa(row.Assignments), strconv.Itoa(row.AssignmentDays), strconv.Itoa(row.WorkedDays),
+				strconv.Itoa(row.Buses), strconv.FormatFloat(row.WorkedHours, 'f', 2, 64), formatRatio(row.Utilization)}
+		}
+		writeReportCSV(c, "staff-utilization.csv", []string{"staff_id", "staff_name", "position", "depot",
+			"assignments", "assignment_days", "worked_days", "buses", "worked_hours", "utilization"}, records)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"from":        from.Format("2006-01-02"),
+		"to":          to.Format("2006-01-02"),
+		"period_days": periodDays,
+		"staff":       rows,
+	})
+}
+
+// handleGetBusCoverage reports the service days each bus lacked crew over a
+// period
+func (h *AssignmentHandler) handleGetBusCoverage(c *gin.Context) {
+	h = h.forRequest(c)
+	from, to, depot, format, ok := parseReportRequest(c)
+	if !ok {
+		return
+	}
+
+	crews, err := h.repo.BusDayCrews(from, to)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to compute bus coverage")
+		return
+	}
+	calendars, err := depotCalendars(h.calendars)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve depot calendars")
+		return
+	}
+	rows := busCoverage(crews, calendars, from, to, depot)
+
+	if format == "csv" {
+		records := make([][]string, len(rows))
+		for i, row := range rows {
+			gaps := make([]string, len(row.Gaps))
+			for j, gap := range row.Gaps {
+				gaps[j] = gap.From + ".." + gap.To + " " + strings.Join(gap.Missing, "+")
+			}
+			records[i] = []string{strconv.Itoa(row.BusID), row.BusPlateNumber, row.Depot,
+				strconv.Itoa(row.ServiceDays), strconv.Itoa(row.CoveredDays), strconv.Itoa(row.GapDays),
+				strconv.Itoa(row.MissingDriverDays), strconv.Itoa(row.MissingConductorDays), formatRatio(row.Coverage),
+				strings.Join(gaps, ";")}
+		}
+		writeReportCSV(c, "bus-coverage.csv", []string{"bus_id", "bus_plate_number", "depot", "service_days",
+			"covered_days", "gap_days", "missing_driver_days", "missing_conductor_days", "coverage", "gaps"}, records)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"from":  from.Format("2006-01-02"),
+		"to":    to.Format("2006-01-02"),
+		"buses": rows,
+	})
+}
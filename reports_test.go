@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestStaffUtilizationReport(t *testing.T) {
+	router, repo := newTestRouter(t)
+	end := date("2025-03-09")
+	weekdays, _ := ParseDayMask([]string{"mon", "wed", "fri"})
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03"), EndDate: &end,
+		WorkingDays: weekdays})
+	shiftStart, shiftEnd := TimeOfDay(6*60), TimeOfDay(13*60+30)
+	mustCreate(t, repo, Assignment{BusID: 2, StaffID: 1, Role: "driver", StartDate: date("2025-03-05"), EndDate: &end,
+		WorkingDays: weekdays, ShiftStart: &shiftStart, ShiftEnd: &shiftEnd})
+	cancelled := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 2, Role: "conductor", StartDate: date("2025-03-03")})
+	cancelled.Status = "cancelled"
+	if err := repo.Update(&cancelled, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := doRequest(router, http.MethodGet, "/api/reports/staff-utilization?from=2025-03-03&to=2025-03-09&depot=north", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	report := decode[struct {
+		PeriodDays int `json:"period_days"`
+		Staff      []StaffUtilizationRow
+	}](t, rec)
+	if report.PeriodDays != 7 || len(report.Staff) != 2 {
+		t.Fatalf("report = %+v, want the two north staff over 7 days", report)
+	}
+	// Mon, Wed and Fri on bus 1 as standard days, then Wed and Fri again on
+	// bus 2 for 7.5 hours each
+	want := StaffUtilizationRow{StaffID: 1, StaffName: "John Driver", Position: "driver", Depot: "north",
+		Assignments: 2, AssignmentDays: 5, WorkedDays: 3, Buses: 2, WorkedHours: 39, Utilization: 0.429}
+	if report.Staff[0] != want {
+		t.Errorf("staff 1 = %+v, want %+v", report.Staff[0], want)
+	}
+	if report.Staff[1].StaffID != 2 || report.Staff[1].WorkedDays != 0 {
+		t.Errorf("staff 2 = %+v, want no days from the cancelled assignment", report.Staff[1])
+	}
+
+	if rec := doRequest(router, http.MethodGet, "/api/reports/staff-utilization?from=2025-01-01&to=2026-06-30", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("over-long period status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestBusCoverageReport(t *testing.T) {
+	router, repo := newTestRouter(t)
+	end := date("2025-03-09")
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03"), EndDate: &end})
+	conductorEnd := date("2025-03-05")
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 2, Role: "conductor", StartDate: date("2025-03-03"), EndDate: &conductorEnd})
+
+	// North runs no service on Sundays
+	calendar := map[string]any{"days": map[string]any{"sun": map[string]any{"level": "none"}}}
+	if rec := doRequest(router, http.MethodPut, "/api/config/depot-calendars/north", calendar); rec.Code >= 300 {
+		t.Fatalf("calendar status = %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := doRequest(router, http.MethodGet, "/api/reports/bus-coverage?from=2025-03-03&to=2025-03-09&depot=north", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	report := decode[struct{ Buses []BusCoverageRow }](t, rec)
+	if len(report.Buses) != 2 {
+		t.Fatalf("buses = %+v, want the two north buses", report.Buses)
+	}
+	bus := report.Buses[0]
+	if bus.ServiceDays != 6 || bus.CoveredDays != 3 || bus.MissingConductorDays != 3 || bus.MissingDriverDays != 0 {
+		t.Errorf("bus 1 = %+v, want 3 of 6 service days covered", bus)
+	}
+	if len(bus.Gaps) != 1 || bus.Gaps[0].From != "2025-03-06" || bus.Gaps[0].To != "2025-03-08" {
+		t.Errorf("bus 1 gaps = %+v, want Thursday to Saturday without a conductor", bus.Gaps)
+	}
+	if unstaffed := report.Buses[1]; unstaffed.GapDays != 6 || unstaffed.Coverage != 0 {
+		t.Errorf("bus 2 = %+v, want every service day missing crew", unstaffed)
+	}
+
+	rec = doRequest(router, http.MethodGet, "/api/reports/bus-coverage?from=2025-03-03&to=2025-03-09&depot=north&format=csv", nil)
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if rec.Code != http.StatusOK || len(lines) != 3 || !strings.HasPrefix(lines[1], "1,ABC-1234,north,6,3,3,0,3,0.500,") {
+		t.Errorf("csv = %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,2694 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AssignmentRepository stores assignments and their audit trail. Every
+// mutation is audited under the given actor. Deletes are soft, keeping the
+// row for payroll reconciliation, and reads leave deleted assignments out.
+type AssignmentRepository interface {
+	Create(assignment *Assignment, actor string) error
+	Get(id int) (*Assignment, error)                                         // nil, nil when not found
+	GetByPublicID(publicID string, includeDeleted bool) (*Assignment, error) // nil, nil when not found
+	Update(assignment *Assignment, actor string) error                       // errStaleVersion unless assignment.Version is current
+	Delete(id, version int, actor string) error                              // errStaleVersion unless version is current
+	Restore(assignment *Assignment, actor string) error                      // errStaleVersion unless assignment.Version is current
+	List(filter AssignmentFilter) ([]Assignment, error)
+	// ExportSnapshot passes the assignments matching the filter to fn a page
+	// at a time, all read from one snapshot taken at asOf, so an export
+	// neither misses nor repeats rows changed while it runs. fn is called at
+	// least once, with an empty page when nothing matches.
+	ExportSnapshot(filter AssignmentFilter, fn func(asOf time.Time, page []Assignment) error) error
+	ListByBus(busID int, clearance *Clearance) ([]Assignment, error)
+	ListByStaff(staffID int, clearance *Clearance) ([]Assignment, error)
+	ListInRange(from, to time.Time, busID int, clearance *Clearance) ([]Assignment, error)
+	FindConflicts(assignment *Assignment) ([]Assignment, error)
+	ApplyChanges(changes *AssignmentChanges, actor string) error         // all or nothing; errStaleVersion, ConflictError or DeletionHoldError when refused
+	CompleteExpired(today time.Time, actor string) ([]Assignment, error) // active assignments ending before today; nil while another replica runs it
+	History(publicID string, clearance *Clearance) ([]AuditEntry, error)
+	Activity(filter ActivityFilter) ([]AuditEntry, error)           // newest first
+	ListAsOf(at time.Time, filter AsOfFilter) ([]Assignment, error) // assignments as the audit trail had them at the time, by ID
+
+	// Reporting aggregates over the days assignments are worked in a period
+	StaffWorkload(from, to time.Time) ([]StaffWorkload, error) // staff who worked, by staff ID
+	BusDayCrews(from, to time.Time) ([]BusDayCrew, error)      // bus-days with any crew, by bus then date
+
+	// Two-phase deletes of staff members and buses
+	PrepareDeletion(hold *DeletionHold, now time.Time) error                  // DeletionHoldError or DeletionBlockedError when refused
+	GetDeletion(id string) (*DeletionHold, error)                             // nil, nil when not found
+	BlockingDeletion(resource string, resourceID int) (*DeletionHold, error)  // nil, nil when new assignments are allowed
+	ConfirmDeletion(id, actor string, now time.Time) (*DeletionResult, error) // errDeletionClosed unless prepared
+	AbortDeletion(id string) (*DeletionHold, error)                           // errDeletionClosed once confirmed
+
+	// Moves across many assignments, each all or nothing
+	ReassignBus(fromBusID, toBusID int, fromDate time.Time, actor string, guard *bulkGuard) (*ReassignResult, error)
+	TransferStaff(staffID int, toDepot string, transferDate time.Time, copyAssignments bool, actor string,
+		guard *bulkGuard) (*TransferResult, error)
+	Import(rows []ImportRow, actor string, check importCheck) ([]Assignment, []ImportRowError, error) // rejected rows, creating nothing, when any is refused
+
+	// transact runs fn with the repository's checks and writes all applied or
+	// none: inside a transaction, or under the memory repository's lock.
+	// Open shifts take up their assignments through it.
+	transact(fn func(tx assignmentTx) error) error
+
+	// WithContext returns the repository running its queries under ctx, so
+	// a request's queries stop when it times out or the client goes away
+	WithContext(ctx context.Context) AssignmentRepository
+}
+
+// AssignmentFilter narrows and orders assignment listings; zero values match
+// everything, newest first
+type AssignmentFilter struct {
+	Status  string `json:"status,omitempty"`
+	Role    string `json:"role,omitempty"`
+	BusID   int    `json:"bus_id,omitempty"`
+	StaffID int    `json:"staff_id,omitempty"`
+	Depot   string `json:"depot,omitempty"`
+	Sort    string `json:"sort,omitempty"` // a sortable column, prefixed with "-" for descending
+	Ref     string `json:"ref,omitempty"`  // reference or external_ref, exact
+
+	IncludeDeleted bool       `json:"-"` // admins only, so never saved in a view
+	Clearance      *Clearance `json:"-"` // the caller's, applied whenever a view is run
+}
+
+// AsOfFilter narrows ListAsOf to the assignments whose revision at the time
+// was on the bus, of the staff member and at the depot, and overlapped the
+// dates. Zero fields match any. Revisions recorded before depots were kept
+// match every depot, for the caller to check against the bus.
+type AsOfFilter struct {
+	BusID   int
+	StaffID int
+	Depot   string
+	From    *time.Time
+	To      *time.Time
+}
+
+// Matches reports whether a revision is one ListAsOf returns for the filter
+func (f AsOfFilter) Matches(assignment *Assignment) bool {
+	return (f.BusID == 0 || assignment.BusID == f.BusID) &&
+		(f.StaffID == 0 || assignment.StaffID == f.StaffID) &&
+		(f.Depot == "" || assignment.DepotID == "" || assignment.DepotID == f.Depot) &&
+		(f.To == nil || !assignment.StartDate.After(*f.To)) &&
+		(f.From == nil || assignment.EndDate == nil || !assignment.EndDate.Before(*f.From))
+}
+
+// AssignmentChanges is a batch of writes applied all or nothing. Updates and
+// deletes carry the version they were based on; creates are filled in as
+// they are stored.
+type AssignmentChanges struct {
+	Create []Assignment
+	Update []Assignment
+	Delete []Assignment
+}
+
+// written returns the created and updated assignments, which must not be left
+// conflicting once the batch is applied
+func (ch *AssignmentChanges) written() []*Assignment {
+	var written []*Assignment
+	for i := range ch.Update {
+		written = append(written, &ch.Update[i])
+	}
+	for i := range ch.Create {
+		written = append(written, &ch.Create[i])
+	}
+	return written
+}
+
+// assignmentTx reads and writes assignments inside AssignmentRepository.transact
+type assignmentTx interface {
+	// runningFrom locks the active assignments on the bus, or of the staff
+	// member, that are still running on or after the date, by start date
+	runningFrom(busID, staffID int, from time.Time) ([]Assignment, error)
+	conflicts(assignment *Assignment) ([]Assignment, error)
+	deletionHeld(assignment *Assignment) (*DeletionHold, error) // nil, nil when the assignment may be created
+	byRef(ref string) ([]Assignment, error)                     // by reference or external_ref
+	create(assignment *Assignment, actor string) error
+	update(assignment *Assignment, actor string) error
+}
+
+// assignmentSortColumns are the columns listings can be sorted by
+var assignmentSortColumns = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"start_date": true,
+	"end_date":   true,
+	"bus_id":     true,
+	"staff_id":   true,
+}
+
+// defaultAssignmentSort keeps the original newest-first listing order
+const defaultAssignmentSort = "-created_at"
+
+// sortColumn splits the filter's sort into its column and direction
+func (f AssignmentFilter) sortColumn() (column string, descending bool) {
+	sort := f.Sort
+	if sort == "" {
+		sort = defaultAssignmentSort
+	}
+	column, descending = strings.CutPrefix(sort, "-")
+	return column, descending
+}
+
+// Matches reports whether an assignment passes the filter
+func (f AssignmentFilter) Matches(assignment *Assignment) bool {
+	return (f.IncludeDeleted || assignment.DeletedAt == nil) &&
+		(f.Status == "" || assignment.Status == f.Status) &&
+		(f.Role == "" || assignment.Role == f.Role) &&
+		(f.BusID == 0 || assignment.BusID == f.BusID) &&
+		(f.StaffID == 0 || assignment.StaffID == f.StaffID) &&
+		(f.Depot == "" || assignment.DepotID == f.Depot) &&
+		(f.Ref == "" || strings.EqualFold(assignment.Reference, f.Ref) || assignment.ExternalRef == f.Ref) &&
+		f.Clearance.Allows(assignment)
+}
+
+// pgxAssignmentRepository stores assignments in PostgreSQL. Mutations write
+// their audit entry and outbox event in the same transaction.
+type pgxAssignmentRepository struct {
+	pool *pgxpool.Pool
+	ctx  context.Context
+}
+
+// NewPgxAssignmentRepository creates a repository backed by the given pool
+func NewPgxAssignmentRepository(pool *pgxpool.Pool) AssignmentRepository {
+	return &pgxAssignmentRepository{pool: pool, ctx: context.Background()}
+}
+
+// WithContext returns a copy of the repository running its queries under ctx
+func (r *pgxAssignmentRepository) WithContext(ctx context.Context) AssignmentRepository {
+	bound := *r
+	bound.ctx = ctx
+	return &bound
+}
+
+// Create inserts a new assignment and records its audit entry
+func (r *pgxAssignmentRepository) Create(assignment *Assignment, actor string) error {
+	return pgx.BeginFunc(r.ctx, r.pool, func(tx pgx.Tx) error {
+		return createAssignmentTx(r.ctx, tx, assignment, actor)
+	})
+}
+
+// Get retrieves an assignment by ID
+func (r *pgxAssignmentRepository) Get(id int) (*Assignment, error) {
+	assignment := &Assignment{}
+	query := `
+		SELECT ` + assignmentColumns + `
+		FROM assignments
+		WHERE id = $1 AND deleted_at IS NULL
+	`
+
+	err := scanAssignment(r.pool.QueryRow(r.ctx, query, id), assignment)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Assignment not found
+		}
+		return nil, err
+	}
+
+	return assignment, nil
+}
+
+// GetByPublicID retrieves an assignment by its public ID
+func (r *pgxAssignmentRepository) GetByPublicID(publicID string, includeDeleted bool) (*Assignment, error) {
+	assignment := &Assignment{}
+	query := `
+		SELECT ` + assignmentColumns + `
+		FROM assignments
+		WHERE public_id = $1 AND ($2 OR deleted_at IS NULL)
+	`
+
+	err := scanAssignment(r.pool.QueryRow(r.ctx, query, publicID, includeDeleted), assignment)
+	if err == pgx.ErrNoRows {
+		return nil, nil // Assignment not found
+	}
+	if err != nil {
+		return nil, err
+	}
+	return assignment, nil
+}
+
+// Update updates an existing assignment and records its audit entry
+func (r *pgxAssignmentRepository) Update(assignment *Assignment, actor string) error {
+	return pgx.BeginFunc(r.ctx, r.pool, func(tx pgx.Tx) error {
+		return updateAssignmentTx(r.ctx, tx, assignment, actor)
+	})
+}
+
+// Delete soft-deletes an assignment by ID and records its audit entry
+func (r *pgxAssignmentRepository) Delete(id, version int, actor string) error {
+	return pgx.BeginFunc(r.ctx, r.pool, func(tx pgx.Tx) error {
+		return deleteAssignmentTx(r.ctx, tx, id, version, actor)
+	})
+}
+
+// Restore undoes a soft delete and records its audit entry
+func (r *pgxAssignmentRepository) Restore(assignment *Assignment, actor string) error {
+	return pgx.BeginFunc(r.ctx, r.pool, func(tx pgx.Tx) error {
+		return restoreAssignmentTx(r.ctx, tx, assignment, actor)
+	})
+}
+
+// List retrieves assignments matching the filter in the filter's sort order
+func (r *pgxAssignmentRepository) List(filter AssignmentFilter) ([]Assignment, error) {
+	query, args, err := listQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+	return queryAssignments(r.ctx, r.pool, query, args...)
+}
+
+// exportPageSize is how many rows an export fetches from its cursor at a time
+const exportPageSize = 1000
+
+// ExportSnapshot reads through a cursor in a read-only repeatable read
+// transaction, so every page comes from the snapshot its first statement took
+func (r *pgxAssignmentRepository) ExportSnapshot(filter AssignmentFilter, fn func(asOf time.Time, page []Assignment) error) error {
+	query, args, err := listQuery(filter)
+	if err != nil {
+		return err
+	}
+	ctx := r.ctx
+	options := pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}
+	return pgx.BeginTxFunc(ctx, r.pool, options, func(tx pgx.Tx) error {
+		var asOf time.Time
+		if err := tx.QueryRow(ctx, `SELECT clock_timestamp()`).Scan(&asOf); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DECLARE assignment_export NO SCROLL CURSOR FOR `+query, args...); err != nil {
+			return err
+		}
+		for first := true; ; first = false {
+			page, err := queryAssignments(ctx, tx, fmt.Sprintf(`FETCH %d FROM assignment_export`, exportPageSize))
+			if err != nil {
+				return err
+			}
+			if len(page) == 0 && !first {
+				return nil
+			}
+			if err := fn(asOf, page); err != nil {
+				return err
+			}
+			if len(page) < exportPageSize {
+				return nil
+			}
+		}
+	})
+}
+
+// listQuery builds the query listing the assignments matching the filter
+func listQuery(filter AssignmentFilter) (string, []any, error) {
+	var conditions []string
+	if !filter.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	var args []any
+	addCondition := func(column string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if filter.Status != "" {
+		addCondition("status", filter.Status)
+	}
+	if filter.Role != "" {
+		addCondition("role", filter.Role)
+	}
+	if filter.BusID != 0 {
+		addCondition("bus_id", filter.BusID)
+	}
+	if filter.StaffID != 0 {
+		addCondition("staff_id", filter.StaffID)
+	}
+	if filter.Depot != "" {
+		addCondition("depot_id", filter.Depot)
+	}
+	if filter.Ref != "" {
+		// References are generated in upper case, so they match however they're typed
+		args = append(args, filter.Ref)
+		conditions = append(conditions, fmt.Sprintf("(reference = upper($%d) OR external_ref = $%d)", len(args), len(args)))
+	}
+	if filter.Clearance != nil {
+		args = append(args, filter.Clearance.sqlArgs()...)
+		conditions = append(conditions, clearanceCondition(len(args)-1))
+	}
+
+	query := `SELECT ` + assignmentColumns + ` FROM assignments`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+
+	// The column is checked against assignmentSortColumns before it reaches SQL
+	column, descending := filter.sortColumn()
+	if !assignmentSortColumns[column] {
+		return "", nil, fmt.Errorf("unsupported sort column %q", column)
+	}
+	direction := "ASC"
+	if descending {
+		direction = "DESC"
+	}
+	query += fmt.Sprintf(` ORDER BY %s %s NULLS LAST, id %s`, column, direction, direction)
+	return query, args, nil
+}
+
+// ListByBus retrieves all assignments for a specific bus visible with the clearance
+func (r *pgxAssignmentRepository) ListByBus(busID int, clearance *Clearance) ([]Assignment, error) {
+	query := `
+		SELECT ` + assignmentColumns + `
+		FROM assignments
+		WHERE bus_id = $1 AND deleted_at IS NULL AND ` + clearanceCondition(2) + `
+		ORDER BY created_at DESC
+	`
+
+	return queryAssignments(r.ctx, r.pool, query, append([]any{busID}, clearance.sqlArgs()...)...)
+}
+
+// ListByStaff retrieves all assignments for a specific staff member visible
+// with the clearance
+func (r *pgxAssignmentRepository) ListByStaff(staffID int, clearance *Clearance) ([]Assignment, error) {
+	query := `
+		SELECT ` + assignmentColumns + `
+		FROM assignments
+		WHERE staff_id = $1 AND deleted_at IS NULL AND ` + clearanceCondition(2) + `
+		ORDER BY created_at DESC
+	`
+
+	return queryAssignments(r.ctx, r.pool, query, append([]any{staffID}, clearance.sqlArgs()...)...)
+}
+
+// ListInRange retrieves assignments visible with the clearance that are not
+// cancelled and overlap the date range, optionally on one bus, ordered by
+// bus, shift start, role and start date
+func (r *pgxAssignmentRepository) ListInRange(from, to time.Time, busID int, clearance *Clearance) ([]Assignment, error) {
+	query := `
+		SELECT ` + assignmentColumns + `
+		FROM assignments
+		WHERE status <> 'cancelled'
+		  AND deleted_at IS NULL
+		  AND start_date <= $2::date
+		  AND COALESCE(end_date, 'infinity'::date) >= $1::date
+		  AND ($3::int = 0 OR bus_id = $3::int)
+		  AND ` + clearanceCondition(4) + `
+		ORDER BY bus_id, shift_start NULLS FIRST, role, start_date
+	`
+
+	return queryAssignments(r.ctx, r.pool, query, append([]any{from, to, busID}, clearance.sqlArgs()...)...)
+}
+
+// FindConflicts returns active assignments that would clash with the given one
+func (r *pgxAssignmentRepository) FindConflicts(assignment *Assignment) ([]Assignment, error) {
+	return findConflicts(r.ctx, r.pool, assignment)
+}
+
+// ApplyChanges writes the batch in one transaction: deletes first so their
+// slots are free, then updates and creates. The active assignments written are
+// then checked against the result, so a batch can't leave a conflict behind.
+func (r *pgxAssignmentRepository) ApplyChanges(changes *AssignmentChanges, actor string) error {
+	return pgx.BeginFunc(r.ctx, r.pool, func(tx pgx.Tx) error {
+		for _, assignment := range changes.Delete {
+			if err := deleteAssignmentTx(r.ctx, tx, assignment.ID, assignment.Version, actor); err != nil {
+				return err
+			}
+		}
+		for i := range changes.Update {
+			if err := updateAssignmentTx(r.ctx, tx, &changes.Update[i], actor); err != nil {
+				return err
+			}
+		}
+		for i := range changes.Create {
+			if err := createAssignmentTx(r.ctx, tx, &changes.Create[i], actor); err != nil {
+				return err
+			}
+		}
+
+		for _, assignment := range changes.written() {
+			if assignment.Status != "active" {
+				continue
+			}
+			conflicts, err := findConflicts(r.ctx, tx, assignment)
+			if err != nil {
+				return err
+			}
+			if len(conflicts) > 0 {
+				return &ConflictError{Assignment: *assignment, Conflicts: conflicts}
+			}
+		}
+		return nil
+	})
+}
+
+// transact runs fn in one transaction, committed when fn returns nil
+func (r *pgxAssignmentRepository) transact(fn func(tx assignmentTx) error) error {
+	return pgx.BeginFunc(r.ctx, r.pool, func(tx pgx.Tx) error {
+		return fn(&pgxAssignmentTx{ctx: r.ctx, tx: tx})
+	})
+}
+
+// ReassignBus moves the bus's crew in one transaction
+func (r *pgxAssignmentRepository) ReassignBus(fromBusID, toBusID int, fromDate time.Time, actor string,
+	guard *bulkGuard) (*ReassignResult, error) {
+	var result *ReassignResult
+	err := r.transact(func(tx assignmentTx) error {
+		var err error
+		result, err = reassignBus(tx, fromBusID, toBusID, fromDate, actor, guard)
+		return err
+	})
+	return result, err
+}
+
+// TransferStaff moves the staff member to the depot in one transaction
+func (r *pgxAssignmentRepository) TransferStaff(staffID int, toDepot string, transferDate time.Time,
+	copyAssignments bool, actor string, guard *bulkGuard) (*TransferResult, error) {
+	var result *TransferResult
+	err := r.transact(func(tx assignmentTx) error {
+		var err error
+		result, err = transferStaff(tx, staffID, toDepot, transferDate, copyAssignments, actor, guard)
+		return err
+	})
+	return result, err
+}
+
+// Import creates the rows in one transaction
+func (r *pgxAssignmentRepository) Import(rows []ImportRow, actor string, check importCheck) ([]Assignment,
+	[]ImportRowError, error) {
+	var created []Assignment
+	err := r.transact(func(tx assignmentTx) error {
+		var err error
+		created, err = importAssignments(tx, rows, actor, check)
+		return err
+	})
+	return importOutcome(created, err)
+}
+
+// pgxAssignmentTx is an open transaction of the pgx assignment repository
+type pgxAssignmentTx struct {
+	ctx context.Context
+	tx  pgx.Tx
+}
+
+func (t *pgxAssignmentTx) runningFrom(busID, staffID int, from time.Time) ([]Assignment, error) {
+	query := `
+		SELECT ` + assignmentColumns + `
+		FROM assignments
+		WHERE ($1::int = 0 OR bus_id = $1)
+		  AND ($2::int = 0 OR staff_id = $2)
+		  AND status = 'active'
+		  AND deleted_at IS NULL
+		  AND COALESCE(end_date, 'infinity'::date) >= $3::date
+		ORDER BY start_date, id
+		FOR UPDATE
+	`
+	return queryAssignments(t.ctx, t.tx, query, busID, staffID, from)
+}
+
+func (t *pgxAssignmentTx) conflicts(assignment *Assignment) ([]Assignment, error) {
+	return findConflicts(t.ctx, t.tx, assignment)
+}
+
+func (t *pgxAssignmentTx) deletionHeld(assignment *Assignment) (*DeletionHold, error) {
+	return deletionHeld(t.ctx, t.tx, assignment)
+}
+
+func (t *pgxAssignmentTx) byRef(ref string) ([]Assignment, error) {
+	return assignmentsByRef(t.ctx, t.tx, ref)
+}
+
+func (t *pgxAssignmentTx) create(assignment *Assignment, actor string) error {
+	return createAssignmentTx(t.ctx, t.tx, assignment, actor)
+}
+
+func (t *pgxAssignmentTx) update(assignment *Assignment, actor string) error {
+	return updateAssignmentTx(t.ctx, t.tx, assignment, actor)
+}
+
+// CompleteExpired marks active assignments that ended before today as
+// completed, auditing each and queueing its event. Only the replica holding
+// the expiry advisory lock does any work, and rows locked by an edit in
+// progress are left for the next run.
+func (r *pgxAssignmentRepository) CompleteExpired(today time.Time, actor string) ([]Assignment, error) {
+	var completed []Assignment
+	err := pgx.BeginFunc(r.ctx, r.pool, func(tx pgx.Tx) error {
+		var locked bool
+		if err := tx.QueryRow(r.ctx, `SELECT pg_try_advisory_xact_lock($1)`, expiryLockID).
+			Scan(&locked); err != nil || !locked {
+			return err
+		}
+
+		query := `
+			SELECT ` + assignmentColumns + `
+			FROM assignments
+			WHERE status = 'active' AND deleted_at IS NULL AND end_date < $1
+			ORDER BY end_date, id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		`
+		expired, err := queryAssignments(r.ctx, tx, query, today, expiryBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for i := range expired {
+			expired[i].Status = "completed"
+			if err := updateAssignmentTx(r.ctx, tx, &expired[i], actor); err != nil {
+				return err
+			}
+		}
+		completed = expired
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return completed, nil
+}
+
+// History retrieves the audit trail for an assignment, oldest first
+func (r *pgxAssignmentRepository) History(publicID string, clearance *Clearance) ([]AuditEntry, error) {
+	return auditHistory(r.ctx, r.pool, publicID, clearance)
+}
+
+// ListAsOf rebuilds the assignments matching the filter as their last audit
+// entry at or before the time left them, leaving out ones deleted by then.
+// Assignments written before the audit trail existed are missing. With a bus
+// or staff member, only the assignments that were ever on that bus or of that
+// staff member are rebuilt.
+func (r *pgxAssignmentRepository) ListAsOf(at time.Time, filter AsOfFilter) ([]Assignment, error) {
+	query := `
+		SELECT assignment_id, after
+		FROM (
+			SELECT DISTINCT ON (assignment_id) assignment_id, after
+			FROM assignment_audit
+			WHERE changed_at <= $1
+			  AND ($2::int = 0 OR assignment_id IN (
+			       SELECT assignment_id FROM assignment_audit WHERE (after->>'bus_id')::int = $2::int))
+			  AND ($3::int = 0 OR assignment_id IN (
+			       SELECT assignment_id FROM assignment_audit WHERE (after->>'staff_id')::int = $3::int))
+			ORDER BY assignment_id, changed_at DESC, id DESC
+		) latest
+		WHERE after IS NOT NULL
+		  AND ($2::int = 0 OR (after->>'bus_id')::int = $2::int)
+		  AND ($3::int = 0 OR (after->>'staff_id')::int = $3::int)
+		  AND ($4::text = '' OR COALESCE(after->>'depot_id', '') IN ('', $4::text))
+		  AND ($5::timestamptz IS NULL OR after->>'end_date' IS NULL
+		       OR (after->>'end_date')::timestamptz >= $5::timestamptz)
+		  AND ($6::timestamptz IS NULL OR (after->>'start_date')::timestamptz <= $6::timestamptz)
+		ORDER BY assignment_id
+	`
+	rows, err := r.pool.Query(r.ctx, query, at, filter.BusID, filter.StaffID, filter.Depot, filter.From, filter.To)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var assignments []Assignment
+	for rows.Next() {
+		var id int
+		var after []byte
+		if err := rows.Scan(&id, &after); err != nil {
+			return nil, err
+		}
+		assignment, err := auditRevision(id, after)
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, assignment)
+	}
+	return assignments, rows.Err()
+}
+
+// Activity retrieves audit entries across all assignments, newest first.
+// An entry matches a bus filter if the assignment was on one of the buses
+// before or after the change.
+func (r *pgxAssignmentRepository) Activity(filter ActivityFilter) ([]AuditEntry, error) {
+	query := `
+		SELECT ` + auditColumns + `
+		FROM assignment_audit
+		WHERE changed_at >= $1
+		  AND ($2::int[] IS NULL
+		       OR (after->>'bus_id')::int = ANY($2)
+		       OR (before->>'bus_id')::int = ANY($2))
+		  AND ` + auditClearanceCondition(4) + `
+		ORDER BY changed_at DESC, id DESC
+		LIMIT $3
+	`
+	args := append([]any{filter.Since, filter.BusIDs, filter.Limit}, filter.Clearance.sqlArgs()...)
+	return queryAuditEntries(r.ctx, r.pool, query, args...)
+}
+
+// workedDaysQuery expands each assignment that isn't cancelled or deleted
+// into the dates it is worked between $1 and $2
+const workedDaysQuery = `
+	WITH worked AS (
+		SELECT a.id, a.bus_id, a.staff_id, a.role, a.shift_start, a.shift_end, d::date AS day
+		FROM assignments a
+		CROSS JOIN LATERAL generate_series(GREATEST(a.start_date, $1::date),
+			LEAST(COALESCE(a.end_date, $2::date), $2::date), interval '1 day') AS d
+		WHERE a.status <> 'cancelled'
+		  AND a.deleted_at IS NULL
+		  AND a.start_date <= $2::date
+		  AND COALESCE(a.end_date, 'infinity'::date) >= $1::date
+		  AND (a.working_days = 0 OR a.working_days::int & (1 << EXTRACT(DOW FROM d)::int) <> 0)
+	)
+`
+
+// StaffWorkload aggregates each staff member's worked days and hours in the
+// period. Days without shift times count as a standard shift, passed as $3.
+func (r *pgxAssignmentRepository) StaffWorkload(from, to time.Time) ([]StaffWorkload, error) {
+	query := workedDaysQuery + `
+		SELECT staff_id, COUNT(DISTINCT id), COUNT(*), COUNT(DISTINCT day), COUNT(DISTINCT bus_id),
+			SUM(COALESCE(EXTRACT(EPOCH FROM shift_end - shift_start), $3::float8))::float8 / 3600
+		FROM worked
+		GROUP BY staff_id
+		ORDER BY staff_id
+	`
+	rows, err := r.pool.Query(r.ctx, query, from, to, standardShift.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workloads []StaffWorkload
+	for rows.Next() {
+		var w StaffWorkload
+		if err := rows.Scan(&w.StaffID, &w.Assignments, &w.AssignmentDays, &w.WorkedDays, &w.Buses,
+			&w.WorkedHours); err != nil {
+			return nil, err
+		}
+		workloads = append(workloads, w)
+	}
+	return workloads, rows.Err()
+}
+
+// BusDayCrews aggregates the roles assigned on each bus on each date of the period
+func (r *pgxAssignmentRepository) BusDayCrews(from, to time.Time) ([]BusDayCrew, error) {
+	query := workedDaysQuery + `
+		SELECT bus_id, day, array_agg(DISTINCT role ORDER BY role)
+		FROM worked
+		GROUP BY bus_id, day
+		ORDER BY bus_id, day
+	`
+	rows, err := r.pool.Query(r.ctx, query, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var crews []BusDayCrew
+	for rows.Next() {
+		var crew BusDayCrew
+		if err := rows.Scan(&crew.BusID, &crew.Date, &crew.Roles); err != nil {
+			return nil, err
+		}
+		crews = append(crews, crew)
+	}
+	return crews, rows.Err()
+}
+
+// pgxViewRepository stores saved views in PostgreSQL
+type pgxViewRepository struct {
+	pool *pgxpool.Pool
+	ctx  context.Context
+}
+
+// NewPgxViewRepository creates a view repository backed by the given pool
+func NewPgxViewRepository(pool *pgxpool.Pool) ViewRepository {
+	return &pgxViewRepository{pool: pool, ctx: context.Background()}
+}
+
+// WithContext returns a copy of the repository running its queries under ctx
+func (r *pgxViewRepository) WithContext(ctx context.Context) ViewRepository {
+	bound := *r
+	bound.ctx = ctx
+	return &bound
+}
+
+const savedViewColumns = `id, owner, name, filter, created_at, updated_at`
+
+func scanSavedView(row pgx.Row, view *SavedView) error {
+	return row.Scan(&view.ID, &view.Owner, &view.Name, &view.Filter, &view.CreatedAt, &view.UpdatedAt)
+}
+
+// Save creates the view or replaces the filter of the owner's view with the same name
+func (r *pgxViewRepository) Save(view *SavedView) error {
+	query := `
+		INSERT INTO saved_views (owner, name, filter)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (owner, name) DO UPDATE
+			SET filter = EXCLUDED.filter, updated_at = CURRENT_TIMESTAMP
+		RETURNING ` + savedViewColumns
+
+	return scanSavedView(r.pool.QueryRow(r.ctx, query, view.Owner, view.Name, view.Filter), view)
+}
+
+// Get retrieves one of the owner's views by name
+func (r *pgxViewRepository) Get(owner, name string) (*SavedView, error) {
+	view := &SavedView{}
+	query := `SELECT ` + savedViewColumns + ` FROM saved_views WHERE owner = $1 AND name = $2`
+
+	if err := scanSavedView(r.pool.QueryRow(r.ctx, query, owner, name), view); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // View not found
+		}
+		return nil, err
+	}
+	return view, nil
+}
+
+// List retrieves the owner's views ordered by name
+func (r *pgxViewRepository) List(owner string) ([]SavedView, error) {
+	query := `SELECT ` + savedViewColumns + ` FROM saved_views WHERE owner = $1 ORDER BY name`
+	rows, err := r.pool.Query(r.ctx, query, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var views []SavedView
+	for rows.Next() {
+		var view SavedView
+		if err := scanSavedView(rows, &view); err != nil {
+			return nil, err
+		}
+		views = append(views, view)
+	}
+
+	return views, rows.Err()
+}
+
+// Delete removes one of the owner's views, reporting whether it existed
+func (r *pgxViewRepository) Delete(owner, name string) (bool, error) {
+	tag, err := r.pool.Exec(r.ctx, `DELETE FROM saved_views WHERE owner = $1 AND name = $2`, owner, name)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// pgxAvailabilityRepository stores availability periods in PostgreSQL. It
+// takes a querier so imports can check availability inside their transaction.
+type pgxAvailabilityRepository struct {
+	q   querier
+	ctx context.Context
+}
+
+// NewPgxAvailabilityRepository creates an availability repository backed by the given pool
+func NewPgxAvailabilityRepository(pool *pgxpool.Pool) AvailabilityRepository {
+	return &pgxAvailabilityRepository{q: pool, ctx: context.Background()}
+}
+
+// WithContext returns a copy of the repository running its queries under ctx
+func (r *pgxAvailabilityRepository) WithContext(ctx context.Context) AvailabilityRepository {
+	bound := *r
+	bound.ctx = ctx
+	return &bound
+}
+
+const availabilityColumns = `id, staff_id, type, start_date, end_date, note, created_by, created_at, updated_at`
+
+func scanAvailabilityPeriod(row pgx.Row, period *AvailabilityPeriod) error {
+	return row.Scan(&period.ID, &period.StaffID, &period.Type, &period.StartDate, &period.EndDate,
+		&period.Note, &period.CreatedBy, &period.CreatedAt, &period.UpdatedAt)
+}
+
+// Create inserts a new availability period
+func (r *pgxAvailabilityRepository) Create(period *AvailabilityPeriod) error {
+	query := `
+		INSERT INTO staff_availability (staff_id, type, start_date, end_date, note, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING ` + availabilityColumns
+
+	row := r.q.QueryRow(r.ctx, query, period.StaffID, period.Type, period.StartDate,
+		period.EndDate, period.Note, period.CreatedBy)
+	return scanAvailabilityPeriod(row, period)
+}
+
+// Get retrieves an availability period by ID
+func (r *pgxAvailabilityRepository) Get(id int) (*AvailabilityPeriod, error) {
+	period := &AvailabilityPeriod{}
+	query := `SELECT ` + availabilityColumns + ` FROM staff_availability WHERE id = $1`
+
+	if err := scanAvailabilityPeriod(r.q.QueryRow(r.ctx, query, id), period); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Period not found
+		}
+		return nil, err
+	}
+	return period, nil
+}
+
+// Update replaces an availability period's staff member, type, dates and note
+func (r *pgxAvailabilityRepository) Update(period *AvailabilityPeriod) error {
+	query := `
+		UPDATE staff_availability
+		SET staff_id = $2, type = $3, start_date = $4, end_date = $5, note = $6, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING ` + availabilityColumns
+
+	row := r.q.QueryRow(r.ctx, query, period.ID, period.StaffID, period.Type,
+		period.StartDate, period.EndDate, period.Note)
+	return scanAvailabilityPeriod(row, period)
+}
+
+// Delete removes an availability period, reporting whether it existed
+func (r *pgxAvailabilityRepository) Delete(id int) (bool, error) {
+	tag, err := r.q.Exec(r.ctx, `DELETE FROM staff_availability WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// List retrieves availability periods matching the filter ordered by start date
+func (r *pgxAvailabilityRepository) List(filter AvailabilityFilter) ([]AvailabilityPeriod, error) {
+	query := `
+		SELECT ` + availabilityColumns + `
+		FROM staff_availability
+		WHERE ($1::int = 0 OR staff_id = $1::int)
+		  AND ($2::text = '' OR type = $2::text)
+		  AND ($3::date IS NULL OR end_date >= $3::date)
+		  AND ($4::date IS NULL OR start_date <= $4::date)
+		ORDER BY start_date, id
+	`
+	rows, err := r.q.Query(r.ctx, query, filter.StaffID, filter.Type, filter.From, filter.To)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var periods []AvailabilityPeriod
+	for rows.Next() {
+		var period AvailabilityPeriod
+		if err := scanAvailabilityPeriod(rows, &period); err != nil {
+			return nil, err
+		}
+		periods = append(periods, period)
+	}
+
+	return periods, rows.Err()
+}
+
+// pgxQualificationRepository stores staff qualifications in PostgreSQL. It
+// takes a querier so imports can check qualifications inside their transaction.
+type pgxQualificationRepository struct {
+	q   querier
+	ctx context.Context
+}
+
+// NewPgxQualificationRepository creates a qualification repository backed by the given pool
+func NewPgxQualificationRepository(pool *pgxpool.Pool) QualificationRepository {
+	return &pgxQualificationRepository{q: pool, ctx: context.Background()}
+}
+
+// WithContext returns a copy of the repository running its queries under ctx
+func (r *pgxQualificationRepository) WithContext(ctx context.Context) QualificationRepository {
+	bound := *r
+	bound.ctx = ctx
+	return &bound
+}
+
+// Put creates or replaces a staff member's qualification in its class
+func (r *pgxQualificationRepository) Put(qualification *StaffQualification) error {
+	query := `
+		INSERT INTO staff_qualifications (staff_id, class, license_number, expires_on, updated_by)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (staff_id, class) DO UPDATE
+			SET license_number = EXCLUDED.license_number, expires_on = EXCLUDED.expires_on,
+				updated_by = EXCLUDED.updated_by, updated_at = CURRENT_TIMESTAMP
+		RETURNING updated_at
+	`
+	return r.q.QueryRow(r.ctx, query, qualification.StaffID, qualification.Class,
+		qualification.LicenseNumber, qualification.ExpiresOn, qualification.UpdatedBy).Scan(&qualification.UpdatedAt)
+}
+
+// Delete removes a staff member's qualification, reporting whether it existed
+func (r *pgxQualificationRepository) Delete(staffID int, class string) (bool, error) {
+	tag, err := r.q.Exec(r.ctx, `DELETE FROM staff_qualifications WHERE staff_id = $1 AND class = $2`,
+		staffID, class)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// List retrieves a staff member's qualifications ordered by class
+func (r *pgxQualificationRepository) List(staffID int) ([]StaffQualification, error) {
+	query := `
+		SELECT staff_id, class, license_number, expires_on, updated_by, updated_at
+		FROM staff_qualifications
+		WHERE staff_id = $1
+		ORDER BY class
+	`
+	rows, err := r.q.Query(r.ctx, query, staffID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var qualifications []StaffQualification
+	for rows.Next() {
+		var q StaffQualification
+		if err := rows.Scan(&q.StaffID, &q.Class, &q.LicenseNumber, &q.ExpiresOn, &q.UpdatedBy, &q.UpdatedAt); err != nil {
+			return nil, err
+		}
+		qualifications = append(qualifications, q)
+	}
+	return qualifications, rows.Err()
+}
+
+// PrepareDeletion records a prepared deletion hold. It holds the resource's
+// advisory lock, so assignments created meanwhile either commit first and
+// count as active or wait and see the hold.
+func (r *pgxAssignmentRepository) PrepareDeletion(hold *DeletionHold, now time.Time) error {
+	return pgx.BeginFunc(r.ctx, r.pool, func(tx pgx.Tx) error {
+		if err := lockDeletionResourceTx(r.ctx, tx, hold.Resource, hold.ResourceID); err != nil {
+			return err
+		}
+		existing, err := blockingDeletionTx(r.ctx, tx, hold.Resource, hold.ResourceID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return &DeletionHoldError{Hold: *existing}
+		}
+		if !hold.Cascade {
+			active, err := activeForDeletionTx(r.ctx, tx, hold.Resource, hold.ResourceID, truncateDate(now), false)
+			if err != nil {
+				return err
+			}
+			if len(active) > 0 {
+				return &DeletionBlockedError{Active: active}
+			}
+		}
+
+		query := `
+			INSERT INTO deletion_holds (id, resource, resource_id, cascade_cancel, status, requested_by, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING created_at, updated_at
+		`
+		return tx.QueryRow(r.ctx, query, hold.ID, hold.Resource, hold.ResourceID, hold.Cascade,
+			hold.Status, hold.RequestedBy, hold.ExpiresAt).Scan(&hold.CreatedAt, &hold.UpdatedAt)
+	})
+}
+
+// GetDeletion retrieves a deletion hold by ID
+func (r *pgxAssignmentRepository) GetDeletion(id string) (*DeletionHold, error) {
+	hold := &DeletionHold{}
+	query := `SELECT ` + deletionHoldColumns + ` FROM deletion_holds WHERE id = $1`
+	err := scanDeletionHold(r.pool.QueryRow(r.ctx, query, id), hold)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// BlockingDeletion retrieves the hold stopping new assignments for a resource
+func (r *pgxAssignmentRepository) BlockingDeletion(resource string, resourceID int) (*DeletionHold, error) {
+	return blockingDeletionTx(r.ctx, r.pool, resource, resourceID)
+}
+
+// ConfirmDeletion settles the resource's remaining assignments, cancelling
+// those not yet started and ending running ones the day before, then marks
+// the hold confirmed, all in one transaction
+func (r *pgxAssignmentRepository) ConfirmDeletion(id, actor string, now time.Time) (*DeletionResult, error) {
+	result := &DeletionResult{Cancelled: []Assignment{}, Ended: []Assignment{}}
+	today := truncateDate(now)
+
+	err := pgx.BeginFunc(r.ctx, r.pool, func(tx pgx.Tx) error {
+		hold := &DeletionHold{}
+		query := `SELECT ` + deletionHoldColumns + ` FROM deletion_holds WHERE id = $1 FOR UPDATE`
+		if err := scanDeletionHold(tx.QueryRow(r.ctx, query, id), hold); err != nil {
+			return err
+		}
+		if hold.Status != DeletionPrepared || hold.Expired(now) {
+			return errDeletionClosed
+		}
+		if err := lockDeletionResourceTx(r.ctx, tx, hold.Resource, hold.ResourceID); err != nil {
+			return err
+		}
+
+		active, err := activeForDeletionTx(r.ctx, tx, hold.Resource, hold.ResourceID, today, true)
+		if err != nil {
+			return err
+		}
+		if len(active) > 0 && !hold.Cascade {
+			return &DeletionBlockedError{Active: active}
+		}
+		for _, assignment := range active {
+			cancelled := settleForDeletion(&assignment, today)
+			if err := updateAssignmentTx(r.ctx, tx, &assignment, actor); err != nil {
+				return err
+			}
+			if cancelled {
+				result.Cancelled = append(result.Cancelled, assignment)
+			} else {
+				result.Ended = append(result.Ended, assignment)
+			}
+		}
+
+		hold.Status = DeletionConfirmed
+		err = tx.QueryRow(r.ctx, `
+			UPDATE deletion_holds SET status = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING updated_at
+		`, hold.ID, hold.Status).Scan(&hold.UpdatedAt)
+		result.Deletion = *hold
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// AbortDeletion releases a hold that hasn't been confirmed
+func (r *pgxAssignmentRepository) AbortDeletion(id string) (*DeletionHold, error) {
+	hold := &DeletionHold{}
+	query := `
+		UPDATE deletion_holds SET status = 'aborted', updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status <> 'confirmed'
+		RETURNING ` + deletionHoldColumns
+	err := scanDeletionHold(r.pool.QueryRow(r.ctx, query, id), hold)
+	if err == pgx.ErrNoRows {
+		return nil, errDeletionClosed
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// pgxPublicationRepository stores roster publications in PostgreSQL
+type pgxPublicationRepository struct {
+	pool *pgxpool.Pool
+	ctx  context.Context
+}
+
+// NewPgxPublicationRepository creates a publication repository backed by the given pool
+func NewPgxPublicationRepository(pool *pgxpool.Pool) PublicationRepository {
+	return &pgxPublicationRepository{pool: pool, ctx: context.Background()}
+}
+
+// WithContext returns a copy of the repository running its queries under ctx
+func (r *pgxPublicationRepository) WithContext(ctx context.Context) PublicationRepository {
+	bound := *r
+	bound.ctx = ctx
+	return &bound
+}
+
+const publicationColumns = `id, period_from, period_to, status, previous_id, days, steps, published_by, created_at, updated_at`
+
+func scanPublication(row pgx.Row, publication *RosterPublication) error {
+	return row.Scan(&publication.ID, &publication.From, &publication.To, &publication.Status, &publication.PreviousID,
+		&publication.Days, &publication.Steps, &publication.PublishedBy, &publication.CreatedAt, &publication.UpdatedAt)
+}
+
+func queryPublications(ctx context.Context, pool *pgxpool.Pool, query string, args ...any) ([]RosterPublication, error) {
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	publications := []RosterPublication{}
+	for rows.Next() {
+		var publication RosterPublication
+		if err := scanPublication(rows, &publication); err != nil {
+			return nil, err
+		}
+		publications = append(publications, publication)
+	}
+	return publications, rows.Err()
+}
+
+// Create inserts a new publication. The partial unique index on the period
+// rejects it while another publication for the period is unfinished.
+func (r *pgxPublicationRepository) Create(publication *RosterPublication) error {
+	query := `
+		INSERT INTO roster_publications (id, period_from, period_to, status, previous_id, days, steps, published_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING created_at, updated_at
+	`
+	err := r.pool.QueryRow(r.ctx, query, publication.ID, publication.From, publication.To,
+		publication.Status, publication.PreviousID, publication.Days, publication.Steps, publication.PublishedBy).
+		Scan(&publication.CreatedAt, &publication.UpdatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "idx_roster_publications_in_flight" {
+		return errPublicationInProgress
+	}
+	return err
+}
+
+// Get retrieves a publication by ID
+func (r *pgxPublicationRepository) Get(id string) (*RosterPublication, error) {
+	publication := &RosterPublication{}
+	query := `SELECT ` + publicationColumns + ` FROM roster_publications WHERE id = $1`
+	if err := scanPublication(r.pool.QueryRow(r.ctx, query, id), publication); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Publication not found
+		}
+		return nil, err
+	}
+	return publication, nil
+}
+
+// Current retrieves the published roster for the period
+func (r *pgxPublicationRepository) Current(from, to time.Time) (*RosterPublication, error) {
+	publication := &RosterPublication{}
+	query := `
+		SELECT ` + publicationColumns + ` FROM roster_publications
+		WHERE period_from = $1 AND period_to = $2 AND status = 'published'
+	`
+	if err := scanPublication(r.pool.QueryRow(r.ctx, query, from, to), publication); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Nothing published for the period
+		}
+		return nil, err
+	}
+	return publication, nil
+}
+
+// List retrieves every publication for the period, newest first
+func (r *pgxPublicationRepository) List(from, to time.Time) ([]RosterPublication, error) {
+	query := `
+		SELECT ` + publicationColumns + ` FROM roster_publications
+		WHERE period_from = $1 AND period_to = $2
+		ORDER BY created_at DESC, id DESC
+	`
+	return queryPublications(r.ctx, r.pool, query, from, to)
+}
+
+// Save stores the publication's status and steps
+func (r *pgxPublicationRepository) Save(publication *RosterPublication) error {
+	query := `
+		UPDATE roster_publications SET status = $2, steps = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING updated_at
+	`
+	return r.pool.QueryRow(r.ctx, query, publication.ID, publication.Status, publication.Steps).
+		Scan(&publication.UpdatedAt)
+}
+
+// Complete marks the publication published and the one it replaces
+// superseded in a single transaction
+func (r *pgxPublicationRepository) Complete(publication *RosterPublication) error {
+	return pgx.BeginFunc(r.ctx, r.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(r.ctx, `
+			UPDATE roster_publications SET status = 'superseded', updated_at = CURRENT_TIMESTAMP
+			WHERE period_from = $1 AND period_to = $2 AND status = 'published'
+		`, publication.From, publication.To)
+		if err != nil {
+			return err
+		}
+
+		query := `
+			UPDATE roster_publications SET status = 'published', steps = $2, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+			RETURNING status, updated_at
+		`
+		return tx.QueryRow(r.ctx, query, publication.ID, publication.Steps).
+			Scan(&publication.Status, &publication.UpdatedAt)
+	})
+}
+
+// Stuck retrieves unfinished publications last touched before the given time
+func (r *pgxPublicationRepository) Stuck(before time.Time) ([]RosterPublication, error) {
+	query := `
+		SELECT ` + publicationColumns + ` FROM roster_publications
+		WHERE status IN ('publishing', 'compensating', 'compensation_failed') AND updated_at < $1
+		ORDER BY id
+	`
+	return queryPublications(r.ctx, r.pool, query, before)
+}
+
+// Claim moves the publication to compensating only if nobody has touched it
+// since it was read
+func (r *pgxPublicationRepository) Claim(publication *RosterPublication) (bool, error) {
+	query := `
+		UPDATE roster_publications SET status = 'compensating', updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND updated_at = $2
+		RETURNING status, updated_at
+	`
+	err := r.pool.QueryRow(r.ctx, query, publication.ID, publication.UpdatedAt).
+		Scan(&publication.Status, &publication.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// pgxDepotCalendarRepository stores depot calendars in PostgreSQL
+type pgxDepotCalendarRepository struct {
+	pool *pgxpool.Pool
+	ctx  context.Context
+}
+
+// NewPgxDepotCalendarRepository creates a depot calendar repository backed by the given pool
+func NewPgxDepotCalendarRepository(pool *pgxpool.Pool) DepotCalendarRepository {
+	return &pgxDepotCalendarRepository{pool: pool, ctx: context.Background()}
+}
+
+// WithContext returns a copy of the repository running its queries under ctx
+func (r *pgxDepotCalendarRepository) WithContext(ctx context.Context) DepotCalendarRepository {
+	bound := *r
+	bound.ctx = ctx
+	return &bound
+}
+
+const depotCalendarColumns = `depot, days, holidays, updated_at`
+
+func scanDepotCalendar(row pgx.Row, cal *DepotCalendar) error {
+	return row.Scan(&cal.Depot, &cal.Days, &cal.Holidays, &cal.UpdatedAt)
+}
+
+// Get retrieves a depot's calendar
+func (r *pgxDepotCalendarRepository) Get(depot string) (*DepotCalendar, error) {
+	cal := &DepotCalendar{}
+	query := `SELECT ` + depotCalendarColumns + ` FROM depot_calendars WHERE depot = $1`
+
+	if err := scanDepotCalendar(r.pool.QueryRow(r.ctx, query, depot), cal); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Depot runs full service
+		}
+		return nil, err
+	}
+	return cal, nil
+}
+
+// List retrieves every depot calendar ordered by depot
+func (r *pgxDepotCalendarRepository) List() ([]DepotCalendar, error) {
+	query := `SELECT ` + depotCalendarColumns + ` FROM depot_calendars ORDER BY depot`
+	rows, err := r.pool.Query(r.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var calendars []DepotCalendar
+	for rows.Next() {
+		var cal DepotCalendar
+		if err := scanDepotCalendar(rows, &cal); err != nil {
+			return nil, err
+		}
+		calendars = append(calendars, cal)
+	}
+
+	return calendars, rows.Err()
+}
+
+// Put creates or replaces the depot's calendar, leaving the row untouched
+// when nothing differs
+func (r *pgxDepotCalendarRepository) Put(cal *DepotCalendar) (created, changed bool, err error) {
+	query := `
+		INSERT INTO depot_calendars (depot, days, holidays)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (depot) DO UPDATE
+			SET days = EXCLUDED.days, holidays = EXCLUDED.holidays, updated_at = CURRENT_TIMESTAMP
+			WHERE depot_calendars.days IS DISTINCT FROM EXCLUDED.days
+				OR depot_calendars.holidays IS DISTINCT FROM EXCLUDED.holidays
+		RETURNING updated_at, xmax = 0
+	`
+	err = r.pool.QueryRow(r.ctx, query, cal.Depot, cal.Days, cal.Holidays).
+		Scan(&cal.UpdatedAt, &created)
+	if err == pgx.ErrNoRows {
+		// The conflict update was skipped, so the stored calendar already matches
+		stored, err := r.Get(cal.Depot)
+		if err != nil || stored == nil {
+			return false, false, err
+		}
+		*cal = *stored
+		return false, false, nil
+	}
+	return created, err == nil, err
+}
+
+// Delete removes a depot's calendar, reporting whether it existed
+func (r *pgxDepotCalendarRepository) Delete(depot string) (bool, error) {
+	tag, err := r.pool.Exec(r.ctx, `DELETE FROM depot_calendars WHERE depot = $1`, depot)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// pgxRuleModeRepository stores declared rule modes in PostgreSQL
+type pgxRuleModeRepository struct {
+	pool *pgxpool.Pool
+	ctx  context.Context
+}
+
+// NewPgxRuleModeRepository creates a rule mode repository backed by the given pool
+func NewPgxRuleModeRepository(pool *pgxpool.Pool) RuleModeRepository {
+	return &pgxRuleModeRepository{pool: pool, ctx: context.Background()}
+}
+
+// WithContext returns a copy of the repository running its queries under ctx
+func (r *pgxRuleModeRepository) WithContext(ctx context.Context) RuleModeRepository {
+	bound := *r
+	bound.ctx = ctx
+	return &bound
+}
+
+const ruleModeColumns = `rule, mode, shadow_until, updated_at`
+
+func scanRuleMode(row pgx.Row, mode *RuleMode) error {
+	return row.Scan(&mode.Rule, &mode.Mode, &mode.ShadowUntil, &mode.UpdatedAt)
+}
+
+// Get retrieves a rule's declared mode
+func (r *pgxRuleModeRepository) Get(rule string) (*RuleMode, error) {
+	mode := &RuleMode{}
+	query := `SELECT ` + ruleModeColumns + ` FROM rule_modes WHERE rule = $1`
+
+	if err := scanRuleMode(r.pool.QueryRow(r.ctx, query, rule), mode); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // RULE_SHADOW applies
+		}
+		return nil, err
+	}
+	return mode, nil
+}
+
+// List retrieves every declared rule mode ordered by rule
+func (r *pgxRuleModeRepository) List() ([]RuleMode, error) {
+	query := `SELECT ` + ruleModeColumns + ` FROM rule_modes ORDER BY rule`
+	rows, err := r.pool.Query(r.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var modes []RuleMode
+	for rows.Next() {
+		var mode RuleMode
+		if err := scanRuleMode(rows, &mode); err != nil {
+			return nil, err
+		}
+		modes = append(modes, mode)
+	}
+
+	return modes, rows.Err()
+}
+
+// Put creates or replaces the rule's mode, leaving the row untouched when
+// nothing differs
+func (r *pgxRuleModeRepository) Put(mode *RuleMode) (created, changed bool, err error) {
+	query := `
+		INSERT INTO rule_modes (rule, mode, shadow_until)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (rule) DO UPDATE
+			SET mode = EXCLUDED.mode, shadow_until = EXCLUDED.shadow_until, updated_at = CURRENT_TIMESTAMP
+			WHERE rule_modes.mode IS DISTINCT FROM EXCLUDED.mode
+				OR rule_modes.shadow_until IS DISTINCT FROM EXCLUDED.shadow_until
+		RETURNING updated_at, xmax = 0
+	`
+	err = r.pool.QueryRow(r.ctx, query, mode.Rule, mode.Mode, mode.ShadowUntil).
+		Scan(&mode.UpdatedAt, &created)
+	if err == pgx.ErrNoRows {
+		// The conflict update was skipped, so the stored mode already matches
+		stored, err := r.Get(mode.Rule)
+		if err != nil || stored == nil {
+			return false, false, err
+		}
+		*mode = *stored
+		return false, false, nil
+	}
+	return created, err == nil, err
+}
+
+// Delete removes a rule's declared mode, reporting whether it existed
+func (r *pgxRuleModeRepository) Delete(rule string) (bool, error) {
+	tag, err := r.pool.Exec(r.ctx, `DELETE FROM rule_modes WHERE rule = $1`, rule)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// pgxScenarioRepository stores scenarios in PostgreSQL
+type pgxScenarioRepository struct {
+	pool *pgxpool.Pool
+	ctx  context.Context
+}
+
+// NewPgxScenarioRepository creates a scenario repository backed by the given pool
+func NewPgxScenarioRepository(pool *pgxpool.Pool) ScenarioRepository {
+	return &pgxScenarioRepository{pool: pool, ctx: context.Background()}
+}
+
+// WithContext returns a copy of the repository running its queries under ctx
+func (r *pgxScenarioRepository) WithContext(ctx context.Context) ScenarioRepository {
+	bound := *r
+	bound.ctx = ctx
+	return &bound
+}
+
+const scenarioColumns = `id, name, period_from, period_to, status, assignments, removed, version, created_by, created_at, updated_at,
+	COALESCE(depot_id, '')`
+
+func scanScenario(row pgx.Row, scenario *Scenario) error {
+	return row.Scan(&scenario.ID, &scenario.Name, &scenario.From, &scenario.To, &scenario.Status, &scenario.Assignments,
+		&scenario.Removed, &scenario.Version, &scenario.CreatedBy, &scenario.CreatedAt, &scenario.UpdatedAt,
+		&scenario.DepotID)
+}
+
+// Create inserts a new scenario
+func (r *pgxScenarioRepository) Create(scenario *Scenario) error {
+	query := `
+		INSERT INTO scenarios (id, name, period_from, period_to, status, assignments, removed, created_by, depot_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''))
+		RETURNING version, created_at, updated_at
+	`
+	return r.pool.QueryRow(r.ctx, query, scenario.ID, scenario.Name, scenario.From, scenario.To,
+		scenario.Status, scenario.Assignments, scenario.Removed, scenario.CreatedBy, scenario.DepotID).
+		Scan(&scenario.Version, &scenario.CreatedAt, &scenario.UpdatedAt)
+}
+
+// Get retrieves a scenario by ID
+func (r *pgxScenarioRepository) Get(id string) (*Scenario, error) {
+	scenario := &Scenario{}
+	query := `SELECT ` + scenarioColumns + ` FROM scenarios WHERE id = $1`
+	if err := scanScenario(r.pool.QueryRow(r.ctx, query, id), scenario); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Scenario not found
+		}
+		return nil, err
+	}
+	return scenario, nil
+}
+
+// List retrieves every scenario, newest first
+func (r *pgxScenarioRepository) List() ([]Scenario, error) {
+	rows, err := r.pool.Query(r.ctx, `SELECT `+scenarioColumns+` FROM scenarios ORDER BY created_at DESC, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scenarios := []Scenario{}
+	for rows.Next() {
+		var scenario Scenario
+		if err := scanScenario(rows, &scenario); err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, scenario)
+	}
+	return scenarios, rows.Err()
+}
+
+// Save stores the scenario's status and assignments if nobody has saved it
+// since it was read
+func (r *pgxScenarioRepository) Save(scenario *Scenario) error {
+	query := `
+		UPDATE scenarios
+		SET status = $2, assignments = $3, removed = $4, version = version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND version = $5
+		RETURNING version, updated_at
+	`
+	err := r.pool.QueryRow(r.ctx, query, scenario.ID, scenario.Status, scenario.Assignments,
+		scenario.Removed, scenario.Version).Scan(&scenario.Version, &scenario.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return errScenarioModified
+	}
+	return err
+}
+
+// pgxNotificationRepository stores notification channels and the queue in PostgreSQL
+type pgxNotificationRepository struct {
+	pool *pgxpool.Pool
+	ctx  context.Context
+}
+
+// NewPgxNotificationRepository creates a notification repository backed by the given pool
+func NewPgxNotificationRepository(pool *pgxpool.Pool) NotificationRepository {
+	return &pgxNotificationRepository{pool: pool, ctx: context.Background()}
+}
+
+// WithContext returns a copy of the repository running its queries under ctx
+func (r *pgxNotificationRepository) WithContext(ctx context.Context) NotificationRepository {
+	bound := *r
+	bound.ctx = ctx
+	return &bound
+}
+
+// GetChannels retrieves a staff member's notification channels
+func (r *pgxNotificationRepository) GetChannels(staffID int) (*NotificationChannels, error) {
+	channels := &NotificationChannels{StaffID: staffID}
+	query := `
+		SELECT COALESCE(email, ''), COALESCE(webhook_url, ''), updated_at
+		FROM staff_notification_channels
+		WHERE staff_id = $1
+	`
+	err := r.pool.QueryRow(r.ctx, query, staffID).
+		Scan(&channels.Email, &channels.WebhookURL, &channels.UpdatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // No channels set
+		}
+		return nil, err
+	}
+	return channels, nil
+}
+
+// ListChannels retrieves every staff member's notification channels
+func (r *pgxNotificationRepository) ListChannels() ([]NotificationChannels, error) {
+	query := `
+		SELECT staff_id, COALESCE(email, ''), COALESCE(webhook_url, ''), updated_at
+		FROM staff_notification_channels
+		ORDER BY staff_id
+	`
+	rows, err := r.pool.Query(r.ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var channels []NotificationChannels
+	for rows.Next() {
+		var ch NotificationChannels
+		if err := rows.Scan(&ch.StaffID, &ch.Email, &ch.WebhookURL, &ch.UpdatedAt); err != nil {
+			return nil, err
+		}
+		channels = append(channels, ch)
+	}
+
+	return channels, rows.Err()
+}
+
+// PutChannels creates or replaces a staff member's notification channels,
+// leaving the row untouched when nothing differs
+func (r *pgxNotificationRepository) PutChannels(channels *NotificationChannels) (created, changed bool, err error) {
+	query := `
+		INSERT INTO staff_notification_channels (staff_id, email, webhook_url)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''))
+		ON CONFLICT (staff_id) DO UPDATE
+			SET email = EXCLUDED.email, webhook_url = EXCLUDED.webhook_url, updated_at = CURRENT_TIMESTAMP
+			WHERE staff_notification_channels.email IS DISTINCT FROM EXCLUDED.email
+				OR staff_notification_channels.webhook_url IS DISTINCT FROM EXCLUDED.webhook_url
+		RETURNING updated_at, xmax = 0
+	`
+	err = r.pool.QueryRow(r.ctx, query, channels.StaffID, channels.Email, channels.WebhookURL).
+		Scan(&channels.UpdatedAt, &created)
+	if err == pgx.ErrNoRows {
+		// The conflict update was skipped, so the stored channels already match
+		stored, err := r.GetChannels(channels.StaffID)
+		if err != nil || stored == nil {
+			return false, false, err
+		}
+		*channels = *stored
+		return false, false, nil
+	}
+	return created, err == nil, err
+}
+
+// DeleteChannels removes a staff member's notification channels, reporting
+// whether they had any
+func (r *pgxNotificationRepository) DeleteChannels(staffID int) (bool, error) {
+	tag, err := r.pool.Exec(r.ctx, `DELETE FROM staff_notification_channels WHERE staff_id = $1`, staffID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// List retrieves queued and sent notifications matching the filter, newest first
+func (r *pgxNotificationRepository) List(filter NotificationFilter) ([]Notification, error) {
+	query := `
+		SELECT ` + notificationColumns + `
+		FROM notifications
+		WHERE ($1 = 0 OR staff_id = $1) AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT 500
+	`
+	rows, err := r.pool.Query(r.ctx, query, filter.StaffID, filter.Status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var notification Notification
+		if err := scanNotification(rows, &notification); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, rows.Err()
+}
+
+// Retry requeues a failed notification to be sent straight away
+func (r *pgxNotificationRepository) Retry(id int64) (*Notification, error) {
+	notification := &Notification{}
+	query := `
+		UPDATE notifications
+		SET status = 'pending', attempts = 0, next_attempt_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'failed'
+		RETURNING ` + notificationColumns
+	err := scanNotification(r.pool.QueryRow(r.ctx, query, id), notification)
+	if err == pgx.ErrNoRows {
+		var exists bool
+		if err := r.pool.QueryRow(r.ctx, `SELECT EXISTS (SELECT 1 FROM notifications WHERE id = $1)`, id).
+			Scan(&exists); err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, errNotificationNotFailed
+		}
+		return nil, nil // Notification not found
+	}
+	if err != nil {
+		return nil, err
+	}
+	return notification, nil
+}
+
+// pgxIdempotencyRepository stores idempotent responses in PostgreSQL
+type pgxIdempotencyRepository struct {
+	pool *pgxpool.Pool
+	ctx  context.Context
+}
+
+// NewPgxIdempotencyRepository creates an idempotency repository backed by the given pool
+func NewPgxIdempotencyRepository(pool *pgxpool.Pool) IdempotencyRepository {
+	return &pgxIdempotencyRepository{pool: pool, ctx: context.Background()}
+}
+
+// WithContext returns a copy of the repository running its queries under ctx
+func (r *pgxIdempotencyRepository) WithContext(ctx context.Context) IdempotencyRepository {
+	bound := *r
+	bound.ctx = ctx
+	return &bound
+}
+
+// Claim takes the key for a request about to run, or returns whatever holds it
+func (r *pgxIdempotencyRepository) Claim(claim *IdempotentResponse, now time.Time) (*IdempotentResponse, error) {
+	var existing *IdempotentResponse
+	err := pgx.BeginFunc(r.ctx, r.pool, func(tx pgx.Tx) error {
+		// Expired responses and abandoned claims are purged as keys are claimed
+		if _, err := tx.Exec(r.ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, now); err != nil {
+			return err
+		}
+
+		// A concurrent claim of the same key makes this wait for it to commit
+		query := `
+			INSERT INTO idempotency_keys (actor, idempotency_key, request_hash, created_at, expires_at)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (actor, idempotency_key) DO NOTHING
+		`
+		tag, err := tx.Exec(r.ctx, query, claim.Actor, claim.Key, claim.RequestHash, now,
+			now.Add(idempotencyClaimTimeout))
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 1 {
+			claim.CreatedAt = now
+			return nil
+		}
+
+		existing = &IdempotentResponse{Actor: claim.Actor, Key: claim.Key}
+		query = `
+			SELECT request_hash, COALESCE(status, 0), COALESCE(content_type, ''), body, created_at
+			FROM idempotency_keys
+			WHERE actor = $1 AND idempotency_key = $2
+		`
+		err = tx.QueryRow(r.ctx, query, claim.Actor, claim.Key).
+			Scan(&existing.RequestHash, &existing.Status, &existing.ContentType, &existing.Body, &existing.CreatedAt)
+		if err == pgx.ErrNoRows {
+			// The other claim was released in the meantime; report it as
+			// still in progress so the client retries
+			existing.RequestHash = claim.RequestHash
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// Complete stores the response to a claimed request until it expires
+func (r *pgxIdempotencyRepository) Complete(response *IdempotentResponse) error {
+	query := `
+		UPDATE idempotency_keys
+		SET status = $3, content_type = $4, body = $5, expires_at = $6
+		WHERE actor = $1 AND idempotency_key = $2 AND status IS NULL
+	`
+	_, err := r.pool.Exec(r.ctx, query, response.Actor, response.Key, response.Status,
+		response.ContentType, response.Body, response.CreatedAt.Add(idempotencyTTL))
+	return err
+}
+
+// Release gives up a claim that didn't produce a response worth keeping
+func (r *pgxIdempotencyRepository) Release(actor, key string) error {
+	_, err := r.pool.Exec(r.ctx,
+		`DELETE FROM idempotency_keys WHERE actor = $1 AND idempotency_key = $2 AND status IS NULL`, actor, key)
+	return err
+}
+
+// pgxExportJobRepository stores export jobs in PostgreSQL
+type pgxExportJobRepository struct {
+	pool *pgxpool.Pool
+	ctx  context.Context
+}
+
+// NewPgxExportJobRepository creates an export job repository backed by the given pool
+func NewPgxExportJobRepository(pool *pgxpool.Pool) ExportJobRepository {
+	return &pgxExportJobRepository{pool: pool, ctx: context.Background()}
+}
+
+// WithContext returns a copy of the repository running its queries under ctx
+func (r *pgxExportJobRepository) WithContext(ctx context.Context) ExportJobRepository {
+	bound := *r
+	bound.ctx = ctx
+	return &bound
+}
+
+const exportJobColumns = `id, format, filter, include_deleted, clearances, requested_by, COALESCE(callback_url, ''),
+	status, COALESCE(error, ''), COALESCE(artifact_key, ''), rows, size, created_at, started_at, finished_at,
+	expires_at, callback_attempts, callback_sent_at, snapshot_at, COALESCE(depot_id, '')`
+
+func scanExportJob(row pgx.Row, job *ExportJob) error {
+	var filter []byte
+	var clearances []string
+	var depot string
+	if err := row.Scan(&job.ID, &job.Format, &filter, &job.IncludeDeleted, &clearances, &job.RequestedBy,
+		&job.CallbackURL, &job.Status, &job.Error, &job.ArtifactKey, &job.Rows, &job.Size, &job.CreatedAt,
+		&job.StartedAt, &job.FinishedAt, &job.ExpiresAt, &job.CallbackAttempts, &job.CallbackSentAt,
+		&job.SnapshotAt, &depot); err != nil {
+		return err
+	}
+	if clearances != nil || depot != "" {
+		job.Clearance = &Clearance{Labels: clearances, AllLabels: clearances == nil, Depot: depot}
+	}
+	return json.Unmarshal(filter, &job.Filter)
+}
+
+func (r *pgxExportJobRepository) queryJobs(query string, args ...any) ([]ExportJob, error) {
+	rows, err := r.pool.Query(r.ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []ExportJob
+	for rows.Next() {
+		var job ExportJob
+		if err := scanExportJob(rows, &job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// Create queues a job
+func (r *pgxExportJobRepository) Create(job *ExportJob) error {
+	filter, err := json.Marshal(job.Filter)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO export_jobs (id, format, filter, include_deleted, clearances, requested_by, callback_url, status,
+			depot_id)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9)
+		RETURNING created_at
+	`
+	// NULL for callers who see every label or every depot
+	args := job.Clearance.sqlArgs()
+	return r.pool.QueryRow(r.ctx, query, job.ID, job.Format, filter, job.IncludeDeleted, args[0],
+		job.RequestedBy, job.CallbackURL, job.Status, args[1]).Scan(&job.CreatedAt)
+}
+
+// Get retrieves a job by ID
+func (r *pgxExportJobRepository) Get(id string) (*ExportJob, error) {
+	job := &ExportJob{}
+	err := scanExportJob(r.pool.QueryRow(r.ctx,
+		`SELECT `+exportJobColumns+` FROM export_jobs WHERE id = $1`, id), job)
+	if err == pgx.ErrNoRows {
+		return nil, nil // Job not found
+	}
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// List retrieves a requester's most recent jobs, newest first
+func (r *pgxExportJobRepository) List(requestedBy string) ([]ExportJob, error) {
+	return r.queryJobs(`
+		SELECT `+exportJobColumns+`
+		FROM export_jobs
+		WHERE requested_by = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT 100
+	`, requestedBy)
+}
+
+// Claim marks the oldest waiting job running. SKIP LOCKED lets runners on
+// other replicas claim the next job instead of waiting.
+func (r *pgxExportJobRepository) Claim(now, staleBefore time.Time) (*ExportJob, error) {
+	job := &ExportJob{}
+	query := `
+		UPDATE export_jobs
+		SET status = 'running', started_at = $1
+		WHERE id = (
+			SELECT id FROM export_jobs
+			WHERE status = 'queued' OR (status = 'running' AND started_at < $2)
+			ORDER BY created_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + exportJobColumns
+	err := scanExportJob(r.pool.QueryRow(r.ctx, query, now, staleBefore), job)
+	if err == pgx.ErrNoRows {
+		return nil, nil // Nothing waiting
+	}
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Finish stores the outcome of a running job
+func (r *pgxExportJobRepository) Finish(job *ExportJob) error {
+	query := `
+		UPDATE export_jobs
+		SET status = $2, error = NULLIF($3, ''), artifact_key = NULLIF($4, ''), rows = $5, size = $6,
+			finished_at = $7, expires_at = $8, snapshot_at = $10
+		WHERE id = $1 AND status = 'running' AND started_at = $9
+	`
+	_, err := r.pool.Exec(r.ctx, query, job.ID, job.Status, job.Error, job.ArtifactKey, job.Rows,
+		job.Size, job.FinishedAt, job.ExpiresAt, job.StartedAt, job.SnapshotAt)
+	return err
+}
+
+// DueCallbacks lists finished jobs whose webhook is still to be delivered
+func (r *pgxExportJobRepository) DueCallbacks(limit int) ([]ExportJob, error) {
+	return r.queryJobs(`
+		SELECT `+exportJobColumns+`
+		FROM export_jobs
+		WHERE callback_url IS NOT NULL AND callback_sent_at IS NULL AND callback_attempts < $1
+			AND status IN ('succeeded', 'failed')
+		ORDER BY finished_at, id
+		LIMIT $2
+	`, maxExportCallbackAttempts, limit)
+}
+
+// RecordCallback counts a webhook attempt; a delivered webhook isn't sent again
+func (r *pgxExportJobRepository) RecordCallback(id string, delivered bool) error {
+	query := `
+		UPDATE export_jobs
+		SET callback_attempts = callback_attempts + 1,
+			callback_sent_at = CASE WHEN $2 THEN CURRENT_TIMESTAMP END
+		WHERE id = $1
+	`
+	_, err := r.pool.Exec(r.ctx, query, id, delivered)
+	return err
+}
+
+// DueExpiry lists succeeded jobs whose artifact is past its retention
+func (r *pgxExportJobRepository) DueExpiry(now time.Time) ([]ExportJob, error) {
+	return r.queryJobs(`
+		SELECT `+exportJobColumns+`
+		FROM export_jobs
+		WHERE status = 'succeeded' AND expires_at <= $1
+		ORDER BY expires_at, id
+		LIMIT 100
+	`, now)
+}
+
+// MarkExpired records that a job's artifact has been deleted
+func (r *pgxExportJobRepository) MarkExpired(id string) error {
+	_, err := r.pool.Exec(r.ctx, `UPDATE export_jobs SET status = 'expired' WHERE id = $1`, id)
+	return err
+}
+
+// pgxAttachmentRepository stores attachment records in PostgreSQL
+type pgxAttachmentRepository struct {
+	pool *pgxpool.Pool
+	ctx  context.Context
+}
+
+// NewPgxAttachmentRepository creates an attachment repository backed by the given pool
+func NewPgxAttachmentRepository(pool *pgxpool.Pool) AttachmentRepository {
+	return &pgxAttachmentRepository{pool: pool, ctx: context.Background()}
+}
+
+// WithContext returns a copy of the repository running its queries under ctx
+func (r *pgxAttachmentRepository) WithContext(ctx context.Context) AttachmentRepository {
+	bound := *r
+	bound.ctx = ctx
+	return &bound
+}
+
+const attachmentColumns = `id, assignment_id, filename, content_type, size, uploaded_by, created_at`
+
+func scanAttachment(row pgx.Row, attachment *Attachment) error {
+	return row.Scan(&attachment.ID, &attachment.AssignmentID, &attachment.Filename, &attachment.ContentType,
+		&attachment.Size, &attachment.UploadedBy, &attachment.CreatedAt)
+}
+
+// Create records an attachment whose file has been stored
+func (r *pgxAttachmentRepository) Create(attachment *Attachment) error {
+	query := `
+		INSERT INTO assignment_attachments (id, assignment_id, filename, content_type, size, uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at
+	`
+	return r.pool.QueryRow(r.ctx, query, attachment.ID, attachment.AssignmentID, attachment.Filename,
+		attachment.ContentType, attachment.Size, attachment.UploadedBy).Scan(&attachment.CreatedAt)
+}
+
+// Get retrieves one of an assignment's attachments
+func (r *pgxAttachmentRepository) Get(assignmentID int, id string) (*Attachment, error) {
+	attachment := &Attachment{}
+	err := scanAttachment(r.pool.QueryRow(r.ctx, `SELECT `+attachmentColumns+`
+		FROM assignment_attachments WHERE assignment_id = $1 AND id = $2`, assignmentID, id), attachment)
+	if err == pgx.ErrNoRows {
+		return nil, nil // Attachment not found
+	}
+	if err != nil {
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// List retrieves an assignment's attachments, oldest first
+func (r *pgxAttachmentRepository) List(assignmentID int) ([]Attachment, error) {
+	rows, err := r.pool.Query(r.ctx, `SELECT `+attachmentColumns+`
+		FROM assignment_attachments WHERE assignment_id = $1 ORDER BY created_at, id`, assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []Attachment
+	for rows.Next() {
+		var attachment Attachment
+		if err := scanAttachment(rows, &attachment); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
+
+// pgxRecurringTemplateRepository stores recurring templates in PostgreSQL
+type pgxRecurringTemplateRepository struct {
+	pool *pgxpool.Pool
+	ctx  context.Context
+}
+
+// NewPgxRecurringTemplateRepository creates a recurring template repository backed by the given pool
+func NewPgxRecurringTemplateRepository(pool *pgxpool.Pool) RecurringTemplateRepository {
+	return &pgxRecurringTemplateRepository{pool: pool, ctx: context.Background()}
+}
+
+// WithContext returns a copy of the repository running its queries under ctx
+func (r *pgxRecurringTemplateRepository) WithContext(ctx context.Context) RecurringTemplateRepository {
+	bound := *r
+	bound.ctx = ctx
+	return &bound
+}
+
+const recurringTemplateColumns = `id, bus_id, staff_id, role, working_days, shift_start, shift_end, valid_from,
+	valid_until, generated_through, created_by, created_at, updated_at`
+
+func scanRecurringTemplate(row pgx.Row, template *RecurringTemplate) error {
+	return row.Scan(&template.ID, &template.BusID, &template.StaffID, &template.Role, &template.WorkingDays,
+		&template.ShiftStart, &template.ShiftEnd, &template.ValidFrom, &template.ValidUntil,
+		&template.GeneratedThrough, &template.CreatedBy, &template.CreatedAt, &template.UpdatedAt)
+}
+
+// Create inserts a new recurring template
+func (r *pgxRecurringTemplateRepository) Create(template *RecurringTemplate) error {
+	query := `
+		INSERT INTO recurring_assignment_templates (bus_id, staff_id, role, working_days, shift_start, shift_end,
+			valid_from, valid_until, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING ` + recurringTemplateColumns
+
+	row := r.pool.QueryRow(r.ctx, query, template.BusID, template.StaffID, template.Role, template.WorkingDays,
+		template.ShiftStart, template.ShiftEnd, template.ValidFrom, template.ValidUntil, template.CreatedBy)
+	return scanRecurringTemplate(row, template)
+}
+
+// Get retrieves a recurring template by ID
+func (r *pgxRecurringTemplateRepository) Get(id int) (*RecurringTemplate, error) {
+	template := &RecurringTemplate{}
+	query := `SELECT ` + recurringTemplateColumns + ` FROM recurring_assignment_templates WHERE id = $1`
+
+	if err := scanRecurringTemplate(r.pool.QueryRow(r.ctx, query, id), template); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Template not found
+		}
+		return nil, err
+	}
+	return template, nil
+}
+
+// Update replaces a recurring template's definition, keeping how far it has
+// been generated
+func (r *pgxRecurringTemplateRepository) Update(template *RecurringTemplate) error {
+	query := `
+		UPDATE recurring_assignment_templates
+		SET bus_id = $2, staff_id = $3, role = $4, working_days = $5, shift_start = $6, shift_end = $7,
+			valid_from = $8, valid_until = $9, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING ` + recurringTemplateColumns
+
+	row := r.pool.QueryRow(r.ctx, query, template.ID, template.BusID, template.StaffID, template.Role,
+		template.WorkingDays, template.ShiftStart, template.ShiftEnd, template.ValidFrom, template.ValidUntil)
+	return scanRecurringTemplate(row, template)
+}
+
+// Delete removes a recurring template, reporting whether it existed
+func (r *pgxRecurringTemplateRepository) Delete(id int) (bool, error) {
+	tag, err := r.pool.Exec(r.ctx, `DELETE FROM recurring_assignment_templates WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// List retrieves every recurring template ordered by ID
+func (r *pgxRecurringTemplateRepository) List() ([]RecurringTemplate, error) {
+	rows, err := r.pool.Query(r.ctx, `SELECT `+recurringTemplateColumns+`
+		FROM recurring_assignment_templates ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []RecurringTemplate
+	for rows.Next() {
+		var template RecurringTemplate
+		if err := scanRecurringTemplate(rows, &template); err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	return templates, rows.Err()
+}
+
+// Advance moves generated_through on, only while it still is previous
+func (r *pgxRecurringTemplateRepository) Advance(id int, previous *time.Time, through time.Time) (bool, error) {
+	tag, err := r.pool.Exec(r.ctx, `
+		UPDATE recurring_assignment_templates
+		SET generated_through = $3
+		WHERE id = $1 AND generated_through IS NOT DISTINCT FROM $2::date
+	`, id, previous, through)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// pgxCallbackKeyRepository stores callback keys and accepted nonces in PostgreSQL
+type pgxCallbackKeyRepository struct {
+	pool *pgxpool.Pool
+	ctx  context.Context
+}
+
+// NewPgxCallbackKeyRepository creates a callback key repository backed by the given pool
+func NewPgxCallbackKeyRepository(pool *pgxpool.Pool) CallbackKeyRepository {
+	return &pgxCallbackKeyRepository{pool: pool, ctx: context.Background()}
+}
+
+// WithContext returns a copy of the repository running its queries under ctx
+func (r *pgxCallbackKeyRepository) WithContext(ctx context.Context) CallbackKeyRepository {
+	bound := *r
+	bound.ctx = ctx
+	return &bound
+}
+
+const callbackKeyColumns = `id, name, secret, created_by, created_at, last_used_at, revoked_at`
+
+func scanCallbackKey(row pgx.Row, key *CallbackKey) error {
+	return row.Scan(&key.ID, &key.Name, &key.Secret, &key.CreatedBy, &key.CreatedAt, &key.LastUsedAt,
+		&key.RevokedAt)
+}
+
+// Create inserts a new callback key
+func (r *pgxCallbackKeyRepository) Create(key *CallbackKey) error {
+	query := `
+		INSERT INTO callback_keys (id, name, secret, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + callbackKeyColumns
+
+	return scanCallbackKey(r.pool.QueryRow(r.ctx, query, key.ID, key.Name, key.Secret, key.CreatedBy), key)
+}
+
+// Get retrieves a callback key by ID, revoked or not
+func (r *pgxCallbackKeyRepository) Get(id string) (*CallbackKey, error) {
+	key := &CallbackKey{}
+	query := `SELECT ` + callbackKeyColumns + ` FROM callback_keys WHERE id = $1`
+
+	if err := scanCallbackKey(r.pool.QueryRow(r.ctx, query, id), key); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Key not found
+		}
+		return nil, err
+	}
+	return key, nil
+}
+
+// List retrieves every callback key, oldest first
+func (r *pgxCallbackKeyRepository) List() ([]CallbackKey, error) {
+	rows, err := r.pool.Query(r.ctx, `SELECT `+callbackKeyColumns+` FROM callback_keys ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []CallbackKey
+	for rows.Next() {
+		var key CallbackKey
+		if err := scanCallbackKey(rows, &key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Revoke stops a key verifying callbacks, keeping the first revocation time
+func (r *pgxCallbackKeyRepository) Revoke(id string, at time.Time) (bool, error) {
+	tag, err := r.pool.Exec(r.ctx,
+		`UPDATE callback_keys SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1`, id, at)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// Use records a verified callback's nonce, reporting false if the key already
+// accepted it
+func (r *pgxCallbackKeyRepository) Use(keyID, nonce string, expiresAt, now time.Time) (bool, error) {
+	fresh := false
+	err := pgx.BeginFunc(r.ctx, r.pool, func(tx pgx.Tx) error {
+		// Nonces whose timestamps have left the window are purged as new ones arrive
+		if _, err := tx.Exec(r.ctx, `DELETE FROM callback_nonces WHERE expires_at <= $1`, now); err != nil {
+			return err
+		}
+
+		// A concurrent callback with the same nonce makes this wait for it to commit
+		tag, err := tx.Exec(r.ctx, `
+			INSERT INTO callback_nonces (key_id, nonce, expires_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (key_id, nonce) DO NOTHING
+		`, keyID, nonce, expiresAt)
+		if err != nil || tag.RowsAffected() == 0 {
+			return err
+		}
+		fresh = true
+		_, err = tx.Exec(r.ctx, `UPDATE callback_keys SET last_used_at = $2 WHERE id = $1`, keyID, now)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return fresh, nil
+}
+
+// pgxShiftRepository stores open shifts and bids in PostgreSQL. Shifts are
+// taken up in one transaction with the assignment they create.
+type pgxShiftRepository struct {
+	pool *pgxpool.Pool
+	ctx  context.Context
+}
+
+// NewPgxShiftRepository creates a shift repository backed by the given pool
+func NewPgxShiftRepository(pool *pgxpool.Pool) ShiftRepository {
+	return &pgxShiftRepository{pool: pool, ctx: context.Background()}
+}
+
+// WithContext returns a copy of the repository running its queries under ctx
+func (r *pgxShiftRepository) WithContext(ctx context.Context) ShiftRepository {
+	bound := *r
+	bound.ctx = ctx
+	return &bound
+}
+
+const openShiftColumns = `id, bus_id, role, start_date, end_date, working_days, mode, requires_confirmation,
+	award_policy, bidding_closes_at, status, awarded_staff_id, assignment_id,
+	(SELECT a.public_id FROM assignments a WHERE a.id = open_shifts.assignment_id), created_by, created_at, updated_at,
+	config_key`
+
+func scanOpenShift(row pgx.Row, shift *OpenShift) error {
+	return row.Scan(&shift.ID, &shift.BusID, &shift.Role, &shift.StartDate, &shift.EndDate,
+		&shift.WorkingDays, &shift.Mode, &shift.RequiresConfirmation, &shift.AwardPolicy, &shift.BiddingClosesAt,
+		&shift.Status, &shift.AwardedStaffID, &shift.AssignmentID, &shift.AssignmentPublicID,
+		&shift.CreatedBy, &shift.CreatedAt, &shift.UpdatedAt, &shift.Name)
+}
+
+func queryOpenShifts(ctx context.Context, q querier, query string, args ...any) ([]OpenShift, error) {
+	var shifts []OpenShift
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var shift OpenShift
+		if err := scanOpenShift(rows, &shift); err != nil {
+			return nil, err
+		}
+		shifts = append(shifts, shift)
+	}
+
+	return shifts, rows.Err()
+}
+
+// createOpenShift inserts a new open shift
+func createOpenShift(ctx context.Context, q querier, shift *OpenShift) error {
+	query := `
+		INSERT INTO open_shifts (bus_id, role, start_date, end_date, working_days, mode, requires_confirmation,
+			award_policy, bidding_closes_at, created_by, config_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, status, created_at, updated_at
+	`
+
+	return q.QueryRow(ctx, query, shift.BusID, shift.Role, shift.StartDate, shift.EndDate,
+		shift.WorkingDays, shift.Mode, shift.RequiresConfirmation, shift.AwardPolicy, shift.BiddingClosesAt,
+		shift.CreatedBy, shift.Name).
+		Scan(&shift.ID, &shift.Status, &shift.CreatedAt, &shift.UpdatedAt)
+}
+
+// lockOpenShift reads a shift and locks it for the rest of the transaction
+func lockOpenShift(ctx context.Context, tx pgx.Tx, id int) (*OpenShift, error) {
+	shift := &OpenShift{}
+	query := `SELECT ` + openShiftColumns + ` FROM open_shifts WHERE id = $1 FOR UPDATE`
+
+	if err := scanOpenShift(tx.QueryRow(ctx, query, id), shift); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Shift not found
+		}
+		return nil, err
+	}
+	return shift, nil
+}
+
+// saveShiftOutcome records a shift's new status and awardee, settling every
+// pending bid once the shift has closed
+func saveShiftOutcome(ctx context.Context, tx pgx.Tx, shift *OpenShift) error {
+	err := tx.QueryRow(ctx, `
+		UPDATE open_shifts
+		SET status = $2, awarded_staff_id = $3, assignment_id = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING updated_at
+	`, shift.ID, shift.Status, shift.AwardedStaffID, shift.AssignmentID).Scan(&shift.UpdatedAt)
+	if err != nil || shift.Status == "claimed" {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE shift_bids
+		SET status = CASE WHEN staff_id = $2 THEN 'won' ELSE 'lost' END
+		WHERE shift_id = $1 AND status = 'pending'
+	`, shift.ID, shift.AwardedStaffID)
+	return err
+}
+
+// Create inserts a new open shift
+func (r *pgxShiftRepository) Create(shift *OpenShift) error {
+	return createOpenShift(r.ctx, r.pool, shift)
+}
+
+// Get retrieves a shift by ID
+func (r *pgxShiftRepository) Get(id int) (*OpenShift, error) {
+	shift := &OpenShift{}
+	query := `SELECT ` + openShiftColumns + ` FROM open_shifts WHERE id = $1`
+
+	if err := scanOpenShift(r.pool.QueryRow(r.ctx, query, id), shift); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Shift not found
+		}
+		return nil, err
+	}
+	return shift, nil
+}
+
+// List retrieves shifts, optionally filtered by status, soonest closing first
+func (r *pgxShiftRepository) List(status string) ([]OpenShift, error) {
+	query := `
+		SELECT ` + openShiftColumns + `
+		FROM open_shifts
+		WHERE ($1::text = '' OR status = $1::text)
+		ORDER BY bidding_closes_at, id
+	`
+	return queryOpenShifts(r.ctx, r.pool, query, status)
+}
+
+// ListClaimable retrieves claim-mode shifts still open for claiming,
+// optionally filtered by role and bus, soonest starting first
+func (r *pgxShiftRepository) ListClaimable(role string, busID int, now time.Time) ([]OpenShift, error) {
+	query := `
+		SELECT ` + openShiftColumns + `
+		FROM open_shifts
+		WHERE mode = 'claim' AND status = 'open' AND bidding_closes_at > $3
+		  AND ($1::text = '' OR role = $1::text)
+		  AND ($2::int = 0 OR bus_id = $2::int)
+		ORDER BY start_date, id
+	`
+	return queryOpenShifts(r.ctx, r.pool, query, role, busID, now)
+}
+
+// PlaceBid records a bid. A withdrawn bid is reinstated and goes to the back
+// of the queue.
+func (r *pgxShiftRepository) PlaceBid(shiftID, staffID int) (*ShiftBid, error) {
+	bid := &ShiftBid{ShiftID: shiftID, StaffID: staffID}
+	query := `
+		INSERT INTO shift_bids (shift_id, staff_id)
+		VALUES ($1, $2)
+		ON CONFLICT (shift_id, staff_id) DO UPDATE
+			SET status = 'pending', created_at = CURRENT_TIMESTAMP
+			WHERE shift_bids.status = 'withdrawn'
+		RETURNING id, status, created_at
+	`
+
+	err := r.pool.QueryRow(r.ctx, query, shiftID, staffID).Scan(&bid.ID, &bid.Status, &bid.CreatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errDuplicateBid
+		}
+		return nil, err
+	}
+	return bid, nil
+}
+
+// WithdrawBid withdraws a pending bid, reporting whether one existed
+func (r *pgxShiftRepository) WithdrawBid(shiftID, staffID int) (bool, error) {
+	query := `
+		UPDATE shift_bids SET status = 'withdrawn'
+		WHERE shift_id = $1 AND staff_id = $2 AND status = 'pending'
+	`
+	tag, err := r.pool.Exec(r.ctx, query, shiftID, staffID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ListBids retrieves the bids on a shift in the order they were placed
+func (r *pgxShiftRepository) ListBids(shiftID int) ([]ShiftBid, error) {
+	return listShiftBids(r.ctx, r.pool, shiftID)
+}
+
+func listShiftBids(ctx context.Context, q querier, shiftID int) ([]ShiftBid, error) {
+	var bids []ShiftBid
+	query := `
+		SELECT id, shift_id, staff_id, status, created_at
+		FROM shift_bids
+		WHERE shift_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := q.Query(ctx, query, shiftID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bid ShiftBid
+		if err := rows.Scan(&bid.ID, &bid.ShiftID, &bid.StaffID, &bid.Status, &bid.CreatedAt); err != nil {
+			return nil, err
+		}
+		bids = append(bids, bid)
+	}
+
+	return bids, rows.Err()
+}
+
+// Claim takes up a claim-mode shift in one transaction with its assignment
+func (r *pgxShiftRepository) Claim(shiftID, staffID int, actor string, now time.Time,
+	check takeUpCheck) (*OpenShift, *Assignment, error) {
+	var shift *OpenShift
+	var created *Assignment
+
+	err := pgx.BeginFunc(r.ctx, r.pool, func(tx pgx.Tx) error {
+		var err error
+		if shift, err = lockOpenShift(r.ctx, tx, shiftID); err != nil {
+			return err
+		}
+		if created, err = claimShift(&pgxAssignmentTx{ctx: r.ctx, tx: tx}, shift, staffID, actor, now, check); err != nil {
+			return err
+		}
+		return saveShiftOutcome(r.ctx, tx, shift)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return shift, created, nil
+}
+
+// ConfirmClaim creates the assignment of a held claim in one transaction
+func (r *pgxShiftRepository) ConfirmClaim(shiftID int, actor string, check takeUpCheck) (*OpenShift, *Assignment, error) {
+	var shift *OpenShift
+	var created *Assignment
+
+	err := pgx.BeginFunc(r.ctx, r.pool, func(tx pgx.Tx) error {
+		var err error
+		if shift, err = lockOpenShift(r.ctx, tx, shiftID); err != nil {
+			return err
+		}
+		if created, err = confirmShiftClaim(&pgxAssignmentTx{ctx: r.ctx, tx: tx}, shift, actor, check); err != nil {
+			return err
+		}
+		return saveShiftOutcome(r.ctx, tx, shift)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return shift, created, nil
+}
+
+// RejectClaim releases a claim awaiting confirmation so the shift can be claimed again
+func (r *pgxShiftRepository) RejectClaim(shiftID int) (*OpenShift, error) {
+	shift := &OpenShift{}
+	query := `
+		UPDATE open_shifts
+		SET status = 'open', awarded_staff_id = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'claimed'
+		RETURNING ` + openShiftColumns
+
+	if err := scanOpenShift(r.pool.QueryRow(r.ctx, query, shiftID), shift); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, errNoPendingClaim
+		}
+		return nil, err
+	}
+	return shift, nil
+}
+
+// DueForAward lists the open shifts whose bidding has closed
+func (r *pgxShiftRepository) DueForAward(now time.Time) ([]int, error) {
+	rows, err := r.pool.Query(r.ctx, `
+		SELECT id FROM open_shifts
+		WHERE status = 'open' AND bidding_closes_at <= $1
+		ORDER BY bidding_closes_at
+	`, now)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
+
+// Award closes bidding on a shift in one transaction with the assignment it
+// creates. A shift another replica is awarding is skipped.
+func (r *pgxShiftRepository) Award(shiftID int, check takeUpCheck) (*OpenShift, error) {
+	var shift *OpenShift
+	err := pgx.BeginFunc(r.ctx, r.pool, func(tx pgx.Tx) error {
+		shift = &OpenShift{}
+		query := `SELECT ` + openShiftColumns + ` FROM open_shifts WHERE id = $1 AND status = 'open' FOR UPDATE SKIP LOCKED`
+		if err := scanOpenShift(tx.QueryRow(r.ctx, query, shiftID), shift); err != nil {
+			shift = nil
+			if err == pgx.ErrNoRows {
+				return nil // Already handled by another replica
+			}
+			return err
+		}
+
+		bids, err := listShiftBids(r.ctx, tx, shift.ID)
+		if err != nil {
+			return err
+		}
+		pending := pendingBids(bids)
+		recentAwards, err := recentShiftAwards(r.ctx, tx, pending)
+		if err != nil {
+			return err
+		}
+
+		ranked := rankBids(shift.AwardPolicy, pending, recentAwards)
+		if _, err := awardToBidder(&pgxAssignmentTx{ctx: r.ctx, tx: tx}, shift, ranked, check); err != nil {
+			return err
+		}
+		return saveShiftOutcome(r.ctx, tx, shift)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return shift, nil
+}
+
+// recentShiftAwards counts the shifts each bidder was awarded within the
+// fairness window
+func recentShiftAwards(ctx context.Context, q querier, bids []ShiftBid) (map[int]int, error) {
+	staffIDs := make([]int, len(bids))
+	for i, bid := range bids {
+		staffIDs[i] = bid.StaffID
+	}
+
+	recentAwards := map[int]int{}
+	rows, err := q.Query(ctx, `
+		SELECT awarded_staff_id, COUNT(*)
+		FROM open_shifts
+		WHERE status = 'awarded'
+		  AND awarded_staff_id = ANY($1)
+		  AND updated_at >= $2
+		GROUP BY awarded_staff_id
+	`, staffIDs, time.Now().Add(-fairnessWindow))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var staffID, count int
+		if err := rows.Scan(&staffID, &count); err != nil {
+			return nil, err
+		}
+		recentAwards[staffID] = count
+	}
+	return recentAwards, rows.Err()
+}
+
+// getDeclaredShift retrieves the shift declared under a name, locking it when
+// q is a transaction
+func getDeclaredShift(ctx context.Context, q querier, name string, lock bool) (*OpenShift, error) {
+	shift := &OpenShift{}
+	query := `SELECT ` + openShiftColumns + ` FROM open_shifts WHERE config_key = $1`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+	if err := scanOpenShift(q.QueryRow(ctx, query, name), shift); err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil // Nothing declared under the name
+		}
+		return nil, err
+	}
+	return shift, nil
+}
+
+// hasPendingBids reports whether anyone is bidding on the shift
+func hasPendingBids(ctx context.Context, q querier, shiftID int) (bool, error) {
+	var pending bool
+	err := q.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM shift_bids WHERE shift_id = $1 AND status = 'pending')`, shiftID).Scan(&pending)
+	return pending, err
+}
+
+// GetDeclared retrieves the shift declared under a name
+func (r *pgxShiftRepository) GetDeclared(name string) (*OpenShift, error) {
+	return getDeclaredShift(r.ctx, r.pool, name, false)
+}
+
+// ListDeclared retrieves every shift declared through the config API by name
+func (r *pgxShiftRepository) ListDeclared() ([]OpenShift, error) {
+	query := `SELECT ` + openShiftColumns + ` FROM open_shifts WHERE config_key IS NOT NULL ORDER BY config_key`
+	return queryOpenShifts(r.ctx, r.pool, query)
+}
+
+// PutDeclared creates or updates the shift declared under the given name.
+// An advisory lock serialises writes to the name, and locking the shift row
+// also holds off new bids, whose foreign key needs a share lock on it.
+func (r *pgxShiftRepository) PutDeclared(name string, shift *OpenShift, now time.Time) (created, changed bool, err error) {
+	err = pgx.BeginFunc(r.ctx, r.pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(r.ctx, `SELECT pg_advisory_xact_lock($1, hashtext($2))`,
+			configLockShifts, name); err != nil {
+			return err
+		}
+		existing, err := getDeclaredShift(r.ctx, tx, name, true)
+		if err != nil {
+			return err
+		}
+
+		if existing != nil && sameShiftSpec(existing, shift) {
+			*shift = *existing
+			return nil
+		}
+		if !shift.BiddingClosesAt.After(now) {
+			return errBiddingClosed
+		}
+
+		if existing == nil {
+			shift.Name = &name
+			created, changed = true, true
+			return createOpenShift(r.ctx, tx, shift)
+		}
+
+		pending, err := hasPendingBids(r.ctx, tx, existing.ID)
+		if err != nil {
+			return err
+		}
+		if existing.Status != "open" || pending {
+			*shift = *existing
+			return errShiftSpecLocked
+		}
+
+		query := `
+			UPDATE open_shifts
+			SET bus_id = $2, role = $3, start_date = $4, end_date = $5, working_days = $6, mode = $7,
+				requires_confirmation = $8, award_policy = $9, bidding_closes_at = $10, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+			RETURNING ` + openShiftColumns
+		changed = true
+		return scanOpenShift(tx.QueryRow(r.ctx, query, existing.ID, shift.BusID, shift.Role,
+			shift.StartDate, shift.EndDate, shift.WorkingDays, shift.Mode, shift.RequiresConfirmation,
+			shift.AwardPolicy, shift.BiddingClosesAt), shift)
+	})
+	return created, changed, err
+}
+
+// DeleteDeclared cancels the shift declared under the name and frees the name
+func (r *pgxShiftRepository) DeleteDeclared(name string) (*OpenShift, error) {
+	var shift *OpenShift
+	err := pgx.BeginFunc(r.ctx, r.pool, func(tx pgx.Tx) error {
+		var err error
+		if shift, err = getDeclaredShift(r.ctx, tx, name, true); err != nil || shift == nil {
+			return err
+		}
+		if shift.Status != "open" && shift.Status != "cancelled" && shift.Status != "unfilled" {
+			return errShiftSpecLocked
+		}
+
+		// A withdrawn offer keeps its row for the bid history, without the name
+		query := `
+			UPDATE open_shifts
+			SET status = CASE WHEN status = 'open' THEN 'cancelled' ELSE status END,
+				config_key = NULL, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+			RETURNING ` + openShiftColumns
+		if err := scanOpenShift(tx.QueryRow(r.ctx, query, shift.ID), shift); err != nil {
+			return err
+		}
+		_, err = tx.Exec(r.ctx,
+			`UPDATE shift_bids SET status = 'lost' WHERE shift_id = $1 AND status = 'pending'`, shift.ID)
+		return err
+	})
+	return shift, err
+}
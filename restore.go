@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// includeDeleted reports whether the caller passed include_deleted=true to
+// see soft-deleted assignments. Only admins may; it returns ok=false once a
+// 403 has been written.
+func includeDeleted(c *gin.Context) (include, ok bool) {
+	if c.Query("include_deleted") != "true" {
+		return false, true
+	}
+	if principal := currentPrincipal(c); principal == nil || principal.Role != RoleAdmin {
+		respondError(c, http.StatusForbidden, "Only admins can see deleted assignments")
+		return false, false
+	}
+	return true, true
+}
+
+// handleRestoreAssignment brings back a soft-deleted assignment. It is checked
+// as an update would be, so it can't return over a slot filled since.
+func (h *AssignmentHandler) handleRestoreAssignment(c *gin.Context) {
+	h = h.forRequest(c)
+	assignment, ok := h.assignmentFromParam(c, true)
+	if !ok {
+		return
+	}
+	if assignment.DeletedAt == nil {
+		respondError(c, http.StatusConflict, "Assignment is not deleted")
+		return
+	}
+
+	version, ok := versionQuery(c)
+	if !ok || !checkExpectedVersion(c, assignment, version) {
+		return
+	}
+
+	if !h.checkExternalRef(c, assignment) {
+		return
+	}
+	if assignment.Status == "active" && (!h.checkConflicts(c, assignment) || !h.checkAvailability(c, assignment) ||
+		!checkQualifications(c, h.qualifications, assignment)) {
+		return
+	}
+
+	if err := h.repo.Restore(assignment, actorFromContext(c)); err != nil {
+		if errors.Is(err, errStaleVersion) {
+			respondStaleVersion(c, nil)
+			return
+		}
+		if !respondDeletionHold(c, err) {
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Failed to restore assignment")
+		return
+	}
+
+	setAssignmentETag(c, assignment)
+	c.JSON(http.StatusOK, assignment)
+}
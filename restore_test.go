@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDeleteIsSoftAndRestorable(t *testing.T) {
+	router, repo := newTestRouter(t)
+	existing := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+	path := "/api/assignments/" + existing.PublicID
+
+	if rec := doRequest(router, http.MethodDelete, path+"?version=1", nil); rec.Code != http.StatusOK {
+		t.Fatalf("delete status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	list := decode[struct{ Count int }](t, doRequest(router, http.MethodGet, "/api/assignments", nil))
+	if list.Count != 0 {
+		t.Errorf("list count = %d, want the deleted assignment left out", list.Count)
+	}
+
+	// Auth is disabled in the test router, so the caller is an admin
+	list = decode[struct{ Count int }](t, doRequest(router, http.MethodGet, "/api/assignments?include_deleted=true", nil))
+	if list.Count != 1 {
+		t.Errorf("list count with include_deleted = %d, want 1", list.Count)
+	}
+	rec := doRequest(router, http.MethodGet, path+"?include_deleted=true", nil)
+	if deleted := decode[Assignment](t, rec); rec.Code != http.StatusOK || deleted.DeletedAt == nil || deleted.Version != 2 {
+		t.Fatalf("deleted assignment = %d %+v, want it with deleted_at at version 2", rec.Code, deleted)
+	}
+
+	if rec := doRequest(router, http.MethodPost, path+"/restore?version=1", nil); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale restore status = %d, want %d", rec.Code, http.StatusPreconditionFailed)
+	}
+	rec = doRequest(router, http.MethodPost, path+"/restore?version=2", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("restore status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if restored := decode[Assignment](t, rec); restored.DeletedAt != nil || restored.Version != 3 {
+		t.Errorf("restored assignment = %+v, want it live at version 3", restored)
+	}
+	if rec := doRequest(router, http.MethodPost, path+"/restore?version=3", nil); rec.Code != http.StatusConflict {
+		t.Errorf("restoring a live assignment status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if rec := doRequest(router, http.MethodGet, path, nil); rec.Code != http.StatusOK {
+		t.Errorf("restored assignment status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	history := decode[struct{ History []AuditEntry }](t, doRequest(router, http.MethodGet, path+"/history", nil))
+	if len(history.History) != 3 || history.History[2].Action != AuditActionRestore {
+		t.Errorf("history = %+v, want create, delete then restore", history.History)
+	}
+}
+
+func TestRestoreRejectsFilledSlot(t *testing.T) {
+	router, repo := newTestRouter(t)
+	existing := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+	if err := repo.Delete(existing.ID, 1, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The deleted assignment no longer holds the slot
+	body := gin.H{"bus_id": 1, "staff_id": 2, "role": "driver", "start_date": "2025-01-01"}
+	if rec := doRequest(router, http.MethodPost, "/api/assignments", body); rec.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+
+	rec := doRequest(router, http.MethodPost, "/api/assignments/"+existing.PublicID+"/restore?version=2", nil)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("restore status = %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body.String())
+	}
+}
+
+func TestDeletedAssignmentsAreAdminOnly(t *testing.T) {
+	secret := []byte("test-secret")
+	store := NewMemoryStorage()
+	repo := store.Assignments
+	router := gin.New()
+	setupRoutes(router, AuthConfig{Secret: secret}, store)
+
+	existing := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+	if err := repo.Delete(existing.ID, 1, "test"); err != nil {
+		t.Fatal(err)
+	}
+	path := "/api/assignments/" + existing.PublicID
+
+	dispatcher := bearerToken(t, secret, "dispatcher-1", RoleDispatcher)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{"list", http.MethodGet, "/api/assignments?include_deleted=true"},
+		{"get", http.MethodGet, path + "?include_deleted=true"},
+		{"export", http.MethodGet, "/api/assignments/export?format=csv&include_deleted=true"},
+		{"restore", http.MethodPost, path + "/restore?version=2"},
+	}
+	for _, tt := range tests {
+		if rec := doRequest(router, tt.method, tt.path, nil, "Authorization", dispatcher); rec.Code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, http.StatusForbidden)
+		}
+	}
+
+	admin := bearerToken(t, secret, "admin-1", RoleAdmin)
+	if rec := doRequest(router, http.MethodPost, path+"/restore?version=2", nil, "Authorization", admin); rec.Code != http.StatusOK {
+		t.Errorf("admin restore status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRosterDays bounds a roster request so one call can't expand years of assignments
+const maxRosterDays = 62
+
+// RosterBus is the crew working one bus on one day
+type RosterBus struct {
+	BusID          int                     `json:"bus_id"`
+	BusPlateNumber string                  `json:"bus_plate_number,omitempty"`
+	Crew           []AssignmentWithDetails `json:"crew"`
+}
+
+// RosterDay lists every bus with crew on a date
+type RosterDay struct {
+	Date  string      `json:"date"` // YYYY-MM-DD
+	Buses []RosterBus `json:"buses"`
+}
+
+// inRange keeps the assignments that aren't cancelled and overlap the date
+// range, ordered as ListInRange orders them
+func inRange(candidates []Assignment, from, to time.Time) []Assignment {
+	var assignments []Assignment
+	for _, assignment := range candidates {
+		if assignment.Status == "cancelled" || assignment.StartDate.After(to) {
+			continue
+		}
+		if assignment.EndDate != nil && assignment.EndDate.Before(from) {
+			continue
+		}
+		assignments = append(assignments, assignment)
+	}
+
+	sort.SliceStable(assignments, func(i, j int) bool {
+		a, b := assignments[i], assignments[j]
+		if a.BusID != b.BusID {
+			return a.BusID < b.BusID
+		}
+		if shiftA, shiftB := shiftStartMinute(&a), shiftStartMinute(&b); shiftA != shiftB {
+			return shiftA < shiftB
+		}
+		if a.Role != b.Role {
+			return a.Role < b.Role
+		}
+		return a.StartDate.Before(b.StartDate)
+	})
+	return assignments
+}
+
+// shiftStartMinute orders whole-day assignments before timed shifts, as
+// NULLS FIRST does in SQL
+func shiftStartMinute(assignment *Assignment) int {
+	if assignment.ShiftStart == nil {
+		return -1
+	}
+	return int(*assignment.ShiftStart)
+}
+
+// buildRoster expands assignments into one entry per day of the range, grouping
+// each day's crew by bus. Assignments must be ordered by bus, as ListInRange
+// returns them.
+func buildRoster(assignments []Assignment, from, to time.Time) []RosterDay {
+	days := []RosterDay{}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		rosterDay := RosterDay{Date: day.Format("2006-01-02"), Buses: []RosterBus{}}
+
+		for _, assignment := range assignments {
+			if !assignment.WorksOn(day) {
+				continue
+			}
+
+			if n := len(rosterDay.Buses); n == 0 || rosterDay.Buses[n-1].BusID != assignment.BusID {
+				bus := RosterBus{BusID: assignment.BusID}
+				if details := lookupBus(assignment.BusID); details != nil {
+					bus.BusPlateNumber = details["plate_number"]
+				}
+				rosterDay.Buses = append(rosterDay.Buses, bus)
+			}
+
+			details := newAssignmentDetails(assignment)
+			if staff := lookupStaff(assignment.StaffID); staff != nil {
+				details.StaffName = staff["name"]
+				details.StaffPosition = staff["position"]
+			}
+			bus := &rosterDay.Buses[len(rosterDay.Buses)-1]
+			bus.Crew = append(bus.Crew, details)
+		}
+
+		days = append(days, rosterDay)
+	}
+	return days
+}
+
+// parseRosterRange parses an inclusive YYYY-MM-DD period of at most
+// maxRosterDays. It returns false once a response has been written.
+func parseRosterRange(c *gin.Context, fromStr, toStr string) (time.Time, time.Time, bool) {
+	return parseDateRange(c, fromStr, toStr, "Roster", maxRosterDays)
+}
+
+// parseDateRange parses an inclusive YYYY-MM-DD period of at most maxDays,
+// naming what it is for in the error. It returns false once a response has
+// been written.
+func parseDateRange(c *gin.Context, fromStr, toStr, name string, maxDays int) (time.Time, time.Time, bool) {
+	from, err := time.Parse("2006-01-02", fromStr)
+	if err != nil {
+		respondInvalidField(c, "from", "Invalid or missing from date. Use YYYY-MM-DD")
+		return time.Time{}, time.Time{}, false
+	}
+	to, err := time.Parse("2006-01-02", toStr)
+	if err != nil {
+		respondInvalidField(c, "to", "Invalid or missing to date. Use YYYY-MM-DD")
+		return time.Time{}, time.Time{}, false
+	}
+	if to.Before(from) {
+		respondInvalidField(c, "to", "to must not be before from")
+		return time.Time{}, time.Time{}, false
+	}
+	if to.Sub(from) >= time.Duration(maxDays)*24*time.Hour {
+		respondInvalidField(c, "to", fmt.Sprintf("%s range cannot exceed %d days", name, maxDays))
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+func (h *AssignmentHandler) handleGetRoster(c *gin.Context) {
+	h = h.forRequest(c)
+	from, to, ok := parseRosterRange(c, c.Query("from"), c.Query("to"))
+	if !ok {
+		return
+	}
+
+	var busID int
+	if busIDStr := c.Query("bus_id"); busIDStr != "" {
+		var err error
+		if busID, err = strconv.Atoi(busIDStr); err != nil {
+			respondInvalidField(c, "bus_id", "Invalid bus ID")
+			return
+		}
+	}
+
+	asOf, ok := parseAsOf(c)
+	if !ok {
+		return
+	}
+
+	var assignments []Assignment
+	var err error
+	if asOf.IsZero() {
+		assignments, err = h.repo.ListInRange(from, to, busID, callerClearance(c))
+	} else {
+		// The roster as it stood at the time, from the audit trail
+		assignments, err = listAsOf(h.repo, AssignmentFilter{BusID: busID, Clearance: callerClearance(c)}, &from, &to, asOf)
+		assignments = inRange(assignments, from, to)
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve roster")
+		return
+	}
+
+	response := gin.H{
+		"from": from.Format("2006-01-02"),
+		"to":   to.Format("2006-01-02"),
+		"days": buildRoster(assignments, from, to),
+	}
+	if !asOf.IsZero() {
+		response["as_of"] = asOf
+	}
+	c.JSON(http.StatusOK, response)
+}
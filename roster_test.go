@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGetRoster(t *testing.T) {
+	router, repo := newTestRouter(t)
+	end := date("2025-10-07")
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-10-01"), EndDate: &end})
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 2, Role: "conductor", StartDate: date("2025-10-01"),
+		WorkingDays: DayMask(1 << time.Monday)})
+	mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-10-08")})
+	mustCreate(t, repo, Assignment{BusID: 2, StaffID: 3, Role: "driver", StartDate: date("2025-10-01"), Status: "cancelled"})
+
+	// Monday 6th to Wednesday 8th
+	rec := doRequest(router, http.MethodGet, "/api/roster?from=2025-10-06&to=2025-10-08", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	body := decode[struct{ Days []RosterDay }](t, rec)
+	if len(body.Days) != 3 {
+		t.Fatalf("got %d days, want 3", len(body.Days))
+	}
+
+	crewCount := func(day RosterDay) map[int]int {
+		counts := map[int]int{}
+		for _, bus := range day.Buses {
+			counts[bus.BusID] = len(bus.Crew)
+		}
+		return counts
+	}
+
+	tests := []struct {
+		date string
+		want map[int]int // bus ID to crew size
+	}{
+		{"2025-10-06", map[int]int{1: 2}},
+		{"2025-10-07", map[int]int{1: 1}},
+		{"2025-10-08", map[int]int{3: 1}},
+	}
+	for i, tt := range tests {
+		day := body.Days[i]
+		if day.Date != tt.date {
+			t.Errorf("day %d date = %s, want %s", i, day.Date, tt.date)
+		}
+		got := crewCount(day)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: buses = %v, want %v", tt.date, got, tt.want)
+			continue
+		}
+		for busID, size := range tt.want {
+			if got[busID] != size {
+				t.Errorf("%s: bus %d crew = %d, want %d", tt.date, busID, got[busID], size)
+			}
+		}
+	}
+
+	if name := body.Days[0].Buses[0].Crew[0].StaffName; name == "" {
+		t.Error("crew is missing staff details")
+	}
+}
+
+func TestGetRosterBusFilter(t *testing.T) {
+	router, repo := newTestRouter(t)
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-10-01")})
+	mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-10-01")})
+
+	rec := doRequest(router, http.MethodGet, "/api/roster?from=2025-10-06&to=2025-10-06&bus_id=3", nil)
+	body := decode[struct{ Days []RosterDay }](t, rec)
+	if len(body.Days) != 1 || len(body.Days[0].Buses) != 1 || body.Days[0].Buses[0].BusID != 3 {
+		t.Errorf("unexpected roster %+v", body.Days)
+	}
+}
+
+func TestGetRosterValidation(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	for _, query := range []string{
+		"",
+		"?from=2025-10-06",
+		"?from=2025-10-06&to=2025-10-01",
+		"?from=2025-01-01&to=2025-12-31",
+		"?from=2025-10-06&to=2025-10-07&bus_id=x",
+	} {
+		if rec := doRequest(router, http.MethodGet, "/api/roster"+query, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
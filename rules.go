@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bus-staff-assignment/apierror"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Rule modes reported by GET /admin/rules
+const (
+	RuleEnforced = "enforced"
+	RuleShadow   = "shadow" // violations are logged and counted, not refused
+)
+
+// blockingRules are the rules that refuse changes, which can be put in
+// shadow mode
+var blockingRules = []string{
+	apierror.RuleStaffAvailability,
+	apierror.RuleStaffQualification,
+	apierror.RuleSchedulingHorizon,
+}
+
+// RuleMode is a blocking rule's mode declared through /config/rules. A
+// declared mode takes precedence over RULE_SHADOW on every instance.
+type RuleMode struct {
+	Rule        string     `json:"rule"`
+	Mode        string     `json:"mode" binding:"required"` // enforced or shadow
+	ShadowUntil *time.Time `json:"shadow_until,omitempty"`  // when a shadowed rule starts being enforced
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// normalize checks the mode, returning a client-facing error
+func (m *RuleMode) normalize() error {
+	switch m.Mode {
+	case RuleShadow:
+	case RuleEnforced:
+		if m.ShadowUntil != nil {
+			return fmt.Errorf("shadow_until only applies in %s mode", RuleShadow)
+		}
+	default:
+		return fmt.Errorf("mode must be %s or %s", RuleEnforced, RuleShadow)
+	}
+	return nil
+}
+
+// RuleModeRepository stores the declared rule modes
+type RuleModeRepository interface {
+	Get(rule string) (*RuleMode, error) // nil, nil when the rule has none declared
+	List() ([]RuleMode, error)
+	Put(mode *RuleMode) (created, changed bool, err error) // creates or replaces the rule's mode
+	Delete(rule string) (bool, error)
+
+	WithContext(ctx context.Context) RuleModeRepository
+}
+
+// ShadowRules soft-launches validation rules: while a rule is in shadow mode
+// a change that breaks it goes ahead, and the would-be rejection is logged,
+// counted and noted on the request's span, to measure how much real traffic
+// the rule would refuse before enforcing it. A shadow period may end at a
+// set time on the service's clock, when the rule starts refusing changes
+// without a redeploy, so staging can rehearse the switch by moving its clock.
+type ShadowRules struct {
+	until    map[string]time.Time // rule → when enforcement starts; zero for not until it's taken out
+	declared RuleModeRepository   // modes declared through /config/rules, overriding until; nil for none
+
+	mu      sync.Mutex
+	since   time.Time // when counting began, at startup
+	counts  map[string]int
+	lastAts map[string]time.Time
+}
+
+// shadowRules are main's; tests and tools enforce every rule
+var shadowRules = NewShadowRules(nil)
+
+// NewShadowRules puts the rules in shadow mode, each until the time given or,
+// for a zero time, indefinitely
+func NewShadowRules(until map[string]time.Time) *ShadowRules {
+	if until == nil {
+		until = map[string]time.Time{}
+	}
+	return &ShadowRules{until: until, since: time.Now(), counts: map[string]int{}, lastAts: map[string]time.Time{}}
+}
+
+// LoadShadowRules reads RULE_SHADOW, comma-separated rule names each
+// optionally followed by =YYYY-MM-DD or =RFC 3339 time when enforcement
+// starts, e.g. staff_availability=2025-07-01. Unknown rules and unreadable
+// times are logged and left out. Modes declared in the repository take
+// precedence.
+func LoadShadowRules(declared RuleModeRepository) *ShadowRules {
+	until := map[string]time.Time{}
+	for _, entry := range strings.Split(os.Getenv("RULE_SHADOW"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		rule, end, _ := strings.Cut(entry, "=")
+		rule, end = strings.TrimSpace(rule), strings.TrimSpace(end)
+		if !slices.Contains(blockingRules, rule) {
+			log.Printf("Invalid RULE_SHADOW rule %q, ignoring it (rules are %s)", rule, strings.Join(blockingRules, ", "))
+			continue
+		}
+		var at time.Time
+		if end != "" {
+			var err error
+			if at, err = time.Parse("2006-01-02", end); err != nil {
+				if at, err = time.Parse(time.RFC3339, end); err != nil {
+					log.Printf("Invalid RULE_SHADOW end %q for %s, ignoring it", end, rule)
+					continue
+				}
+			}
+		}
+		until[rule] = at
+	}
+	for rule, at := range until {
+		if at.IsZero() {
+			log.Printf("Rule %s is in shadow mode: violations are logged, not refused", rule)
+		} else {
+			log.Printf("Rule %s is in shadow mode until %s", rule, at.Format(time.RFC3339))
+		}
+	}
+	rules := NewShadowRules(until)
+	rules.declared = declared
+	return rules
+}
+
+// shadowPeriods returns when each shadowed rule's enforcement starts: as
+// declared for rules with a declared mode, otherwise as RULE_SHADOW set it.
+// If the declared modes can't be read, RULE_SHADOW applies until they can.
+func (s *ShadowRules) shadowPeriods(ctx context.Context) map[string]time.Time {
+	periods := maps.Clone(s.until)
+	if s.declared == nil {
+		return periods
+	}
+	declared, err := s.declared.WithContext(ctx).List()
+	if err != nil {
+		log.Printf("Failed to read declared rule modes, using RULE_SHADOW: %v", err)
+		return periods
+	}
+	for _, mode := range declared {
+		switch {
+		case mode.Mode != RuleShadow:
+			delete(periods, mode.Rule)
+		case mode.ShadowUntil != nil:
+			periods[mode.Rule] = *mode.ShadowUntil
+		default:
+			periods[mode.Rule] = time.Time{}
+		}
+	}
+	return periods
+}
+
+// shadowed reports whether the rule is in shadow mode at the given time
+func shadowed(periods map[string]time.Time, rule string, now time.Time) bool {
+	at, ok := periods[rule]
+	return ok && (at.IsZero() || now.Before(at))
+}
+
+// Enforce reports whether a change breaking the rule should be refused. A
+// rule in shadow mode records the violation and lets the change through.
+func (s *ShadowRules) Enforce(ctx context.Context, rule, actor, message string) bool {
+	now := clock.Now()
+	if !shadowed(s.shadowPeriods(ctx), rule, now) {
+		return true
+	}
+	s.mu.Lock()
+	s.counts[rule]++
+	s.lastAts[rule] = now
+	s.mu.Unlock()
+
+	log.Printf("Shadow rule %s would have refused a change by %s: %s", rule, actor, message)
+	trace.SpanFromContext(ctx).AddEvent("rule.shadow_violation",
+		trace.WithAttributes(attribute.String("rule", rule), attribute.String("message", message)))
+	return false
+}
+
+// RuleStatus is how a blocking rule is applied on this instance
+type RuleStatus struct {
+	Rule        string     `json:"rule"`
+	Mode        string     `json:"mode"`                   // enforced or shadow
+	ShadowUntil *time.Time `json:"shadow_until,omitempty"` // when a shadowed rule starts being enforced
+	// Would-be rejections on this instance since it started, while in shadow mode
+	WouldReject     int        `json:"would_reject"`
+	LastWouldReject *time.Time `json:"last_would_reject,omitempty"`
+}
+
+// Statuses reports every blocking rule's mode and would-be rejections
+func (s *ShadowRules) Statuses(ctx context.Context, now time.Time) []RuleStatus {
+	periods := s.shadowPeriods(ctx)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]RuleStatus, 0, len(blockingRules))
+	for _, rule := range blockingRules {
+		status := RuleStatus{Rule: rule, Mode: RuleEnforced, WouldReject: s.counts[rule]}
+		if shadowed(periods, rule, now) {
+			status.Mode = RuleShadow
+		}
+		if at := periods[rule]; !at.IsZero() {
+			status.ShadowUntil = &at
+		}
+		if at, ok := s.lastAts[rule]; ok {
+			status.LastWouldReject = &at
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// enforceRule is Enforce for the request's caller
+func enforceRule(c *gin.Context, rule, message string) bool {
+	return shadowRules.Enforce(c.Request.Context(), rule, actorFromContext(c), message)
+}
+
+// handleGetRules reports which blocking rules are enforced and which are in
+// shadow mode, with how many changes each would have refused
+func handleGetRules(c *gin.Context) {
+	rules := shadowRules.Statuses(c.Request.Context(), clock.Now())
+	c.JSON(http.StatusOK, gin.H{"rules": rules, "count": len(rules), "counting_since": shadowRules.since})
+}
+
+// RuleModeHandler serves the declarative rule mode endpoints
+type RuleModeHandler struct {
+	modes RuleModeRepository
+}
+
+// NewRuleModeHandler creates a handler storing rule modes in the given repository
+func NewRuleModeHandler(modes RuleModeRepository) *RuleModeHandler {
+	return &RuleModeHandler{modes: modes}
+}
+
+// forRequest returns the handler with its repository bound to the request's context
+func (h *RuleModeHandler) forRequest(c *gin.Context) *RuleModeHandler {
+	return &RuleModeHandler{modes: h.modes.WithContext(c.Request.Context())}
+}
+
+// ruleFromParam validates the :name path parameter as a blocking rule. It
+// returns false once an error response has been written.
+func ruleFromParam(c *gin.Context) (string, bool) {
+	rule, ok := configNameFromParam(c)
+	if !ok {
+		return "", false
+	}
+	if !slices.Contains(blockingRules, rule) {
+		respondError(c, http.StatusNotFound, fmt.Sprintf("Unknown rule %s (rules are %s)", rule,
+			strings.Join(blockingRules, ", ")))
+		return "", false
+	}
+	return rule, true
+}
+
+func (h *RuleModeHandler) handleGetRuleModes(c *gin.Context) {
+	h = h.forRequest(c)
+	modes, err := h.modes.List()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve rule modes")
+		return
+	}
+	if modes == nil {
+		modes = []RuleMode{}
+	}
+	c.JSON(http.StatusOK, gin.H{"rules": modes, "count": len(modes)})
+}
+
+func (h *RuleModeHandler) handleGetRuleMode(c *gin.Context) {
+	h = h.forRequest(c)
+	rule, ok := ruleFromParam(c)
+	if !ok {
+		return
+	}
+
+	mode, err := h.modes.Get(rule)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if mode == nil {
+		respondError(c, http.StatusNotFound, "Rule "+rule+" has no declared mode, so RULE_SHADOW applies")
+		return
+	}
+	c.JSON(http.StatusOK, mode)
+}
+
+// handlePutRuleMode declares a rule's mode: 201 when it creates the
+// declaration, 200 when it updates it or the mode already matches. Every
+// instance applies it to the next change the rule checks.
+func (h *RuleModeHandler) handlePutRuleMode(c *gin.Context) {
+	h = h.forRequest(c)
+	rule, ok := ruleFromParam(c)
+	if !ok {
+		return
+	}
+	var mode RuleMode
+	if err := c.ShouldBindJSON(&mode); err != nil {
+		respondBindError(c, &mode, err)
+		return
+	}
+	if err := mode.normalize(); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	mode.Rule = rule
+
+	created, changed, err := h.modes.Put(&mode)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to save rule mode")
+		return
+	}
+	if changed {
+		log.Printf("Rule %s declared %s by %s", rule, mode.Mode, actorFromContext(c))
+	}
+
+	c.Header("X-Config-Changed", strconv.FormatBool(changed))
+	if created {
+		c.JSON(http.StatusCreated, mode)
+		return
+	}
+	c.JSON(http.StatusOK, mode)
+}
+
+// handleDeleteRuleMode returns a rule to the mode RULE_SHADOW gives it.
+// Deleting a declaration that doesn't exist succeeds, so a repeated delete is
+// harmless.
+func (h *RuleModeHandler) handleDeleteRuleMode(c *gin.Context) {
+	h = h.forRequest(c)
+	rule, ok := ruleFromParam(c)
+	if !ok {
+		return
+	}
+	if _, err := h.modes.Delete(rule); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to delete rule mode")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
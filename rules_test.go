@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"bus-staff-assignment/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+// useShadowRules puts rules in shadow mode for the test
+func useShadowRules(t *testing.T, until map[string]time.Time) *ShadowRules {
+	t.Helper()
+	saved := shadowRules
+	shadowRules = NewShadowRules(until)
+	t.Cleanup(func() { shadowRules = saved })
+	return shadowRules
+}
+
+func TestLoadShadowRules(t *testing.T) {
+	t.Setenv("RULE_SHADOW", " staff_availability=2025-07-01, scheduling_horizon,rest_period,staff_qualification=soon")
+	rules := LoadShadowRules(nil)
+	want := map[string]time.Time{
+		apierror.RuleStaffAvailability: date("2025-07-01"),
+		apierror.RuleSchedulingHorizon: {},
+	}
+	if len(rules.until) != len(want) {
+		t.Fatalf("shadowed %v, want %v without the unknown rule and unreadable end", rules.until, want)
+	}
+	for rule, at := range want {
+		if got, ok := rules.until[rule]; !ok || !got.Equal(at) {
+			t.Errorf("%s shadowed until %v, want %v", rule, got, at)
+		}
+	}
+}
+
+func TestShadowRules(t *testing.T) {
+	useTravelClock(t).Set(date("2025-06-30"), true, "test")
+	ends := date("2025-07-01")
+	rules := NewShadowRules(map[string]time.Time{
+		apierror.RuleStaffAvailability: {},
+		apierror.RuleSchedulingHorizon: ends,
+	})
+	ctx := context.Background()
+
+	if rules.Enforce(ctx, apierror.RuleStaffAvailability, "ana", "on leave") {
+		t.Error("indefinitely shadowed rule enforced")
+	}
+	if rules.Enforce(ctx, apierror.RuleSchedulingHorizon, "ana", "too far ahead") {
+		t.Error("rule enforced before its shadow period ends")
+	}
+	if !rules.Enforce(ctx, apierror.RuleStaffQualification, "ana", "no license") {
+		t.Error("rule outside shadow mode not enforced")
+	}
+	if !shadowed(rules.until, apierror.RuleSchedulingHorizon, ends.Add(-time.Second)) ||
+		shadowed(rules.until, apierror.RuleSchedulingHorizon, ends) {
+		t.Error("shadow period doesn't end at its end time")
+	}
+
+	statuses := map[string]RuleStatus{}
+	for _, status := range rules.Statuses(ctx, ends) {
+		statuses[status.Rule] = status
+	}
+	if got := statuses[apierror.RuleStaffAvailability]; got.Mode != RuleShadow || got.WouldReject != 1 ||
+		got.LastWouldReject == nil || got.ShadowUntil != nil {
+		t.Errorf("availability status = %+v, want shadowed indefinitely with one would-be rejection", got)
+	}
+	if got := statuses[apierror.RuleSchedulingHorizon]; got.Mode != RuleEnforced || got.WouldReject != 1 ||
+		got.ShadowUntil == nil {
+		t.Errorf("horizon status after its shadow period = %+v, want enforced, keeping its count", got)
+	}
+	if got := statuses[apierror.RuleStaffQualification]; got.Mode != RuleEnforced || got.WouldReject != 0 {
+		t.Errorf("qualification status = %+v, want enforced with nothing counted", got)
+	}
+}
+
+func TestShadowedAvailabilityRule(t *testing.T) {
+	router, _ := newTestRouter(t)
+	for _, staffID := range []int{1, 2} {
+		rec := doRequest(router, http.MethodPost, "/api/v1/availability", gin.H{
+			"staff_id": staffID, "type": "rest", "start_date": "2025-02-03", "end_date": "2025-02-04",
+		})
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create availability = %d %s", rec.Code, rec.Body.String())
+		}
+	}
+	assignment := func(busID, staffID int) gin.H {
+		return gin.H{"bus_id": busID, "staff_id": staffID, "role": "driver", "start_date": "2025-02-03",
+			"end_date": "2025-02-07"}
+	}
+
+	useShadowRules(t, map[string]time.Time{apierror.RuleStaffAvailability: {}})
+	if rec := doRequest(router, http.MethodPost, "/api/v1/assignments", assignment(1, 1)); rec.Code != http.StatusCreated {
+		t.Fatalf("shadowed rule: create = %d %s, want the assignment saved", rec.Code, rec.Body.String())
+	}
+	rules := decode[struct{ Rules []RuleStatus }](t, doRequest(router, http.MethodGet, "/api/v1/admin/rules", nil))
+	if len(rules.Rules) != len(blockingRules) || rules.Rules[0].Rule != apierror.RuleStaffAvailability ||
+		rules.Rules[0].Mode != RuleShadow || rules.Rules[0].WouldReject != 1 {
+		t.Errorf("rules = %+v, want availability in shadow with one would-be rejection", rules.Rules)
+	}
+
+	// Once the shadow period is over on the service's clock, the rule refuses again
+	useShadowRules(t, map[string]time.Time{apierror.RuleStaffAvailability: date("2025-07-01")})
+	useTravelClock(t).Set(date("2025-07-01"), true, "test")
+	rec := doRequest(router, http.MethodPost, "/api/v1/assignments", assignment(3, 2))
+	if rec.Code != http.StatusConflict || errorOf(t, rec).Rule != apierror.RuleStaffAvailability {
+		t.Errorf("enforced rule: create = %d %s, want 409 staff_availability", rec.Code, rec.Body.String())
+	}
+	rules = decode[struct{ Rules []RuleStatus }](t, doRequest(router, http.MethodGet, "/api/v1/admin/rules", nil))
+	if rules.Rules[0].Mode != RuleEnforced {
+		t.Errorf("availability mode after the clock passed its shadow period = %s, want enforced", rules.Rules[0].Mode)
+	}
+}
+
+func TestDeclaredRuleModes(t *testing.T) {
+	router, store := newShiftRouter(t)
+	useShadowRules(t, map[string]time.Time{apierror.RuleSchedulingHorizon: {}}).declared = store.RuleModes
+	for _, staffID := range []int{1, 2} {
+		rec := doRequest(router, http.MethodPost, "/api/v1/availability", gin.H{
+			"staff_id": staffID, "type": "rest", "start_date": "2025-02-03", "end_date": "2025-02-04",
+		})
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create availability = %d %s", rec.Code, rec.Body.String())
+		}
+	}
+	assignment := func(busID, staffID int) gin.H {
+		return gin.H{"bus_id": busID, "staff_id": staffID, "role": "driver", "start_date": "2025-02-03",
+			"end_date": "2025-02-07"}
+	}
+	modes := func() map[string]string {
+		t.Helper()
+		rules := decode[struct{ Rules []RuleStatus }](t, doRequest(router, http.MethodGet, "/api/v1/admin/rules", nil))
+		modes := map[string]string{}
+		for _, status := range rules.Rules {
+			modes[status.Rule] = status.Mode
+		}
+		return modes
+	}
+
+	path := "/api/v1/config/rules/" + apierror.RuleStaffAvailability
+	rec := doRequest(router, http.MethodPut, path, gin.H{"mode": "shadow"})
+	if rec.Code != http.StatusCreated || rec.Header().Get("X-Config-Changed") != "true" {
+		t.Fatalf("first PUT = %d %s, want 201 changed", rec.Code, rec.Body.String())
+	}
+	rec = doRequest(router, http.MethodPut, path, gin.H{"mode": "shadow"})
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Config-Changed") != "false" {
+		t.Errorf("repeated PUT = %d, X-Config-Changed %s; want 200 unchanged", rec.Code,
+			rec.Header().Get("X-Config-Changed"))
+	}
+	if rec := doRequest(router, http.MethodPost, "/api/v1/assignments", assignment(1, 1)); rec.Code != http.StatusCreated {
+		t.Fatalf("declared shadow: create = %d %s, want the assignment saved", rec.Code, rec.Body.String())
+	}
+
+	// A declared mode takes precedence over RULE_SHADOW
+	if rec := doRequest(router, http.MethodPut, "/api/v1/config/rules/"+apierror.RuleSchedulingHorizon,
+		gin.H{"mode": "enforced"}); rec.Code != http.StatusCreated {
+		t.Fatalf("PUT horizon = %d %s", rec.Code, rec.Body.String())
+	}
+	if got := modes(); got[apierror.RuleStaffAvailability] != RuleShadow || got[apierror.RuleSchedulingHorizon] != RuleEnforced {
+		t.Errorf("modes = %v, want availability shadowed and the horizon enforced as declared", got)
+	}
+
+	rec = doRequest(router, http.MethodPut, path, gin.H{"mode": "enforced"})
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Config-Changed") != "true" {
+		t.Fatalf("PUT enforced = %d %s, want 200 changed", rec.Code, rec.Body.String())
+	}
+	rec = doRequest(router, http.MethodPost, "/api/v1/assignments", assignment(3, 2))
+	if rec.Code != http.StatusConflict || errorOf(t, rec).Rule != apierror.RuleStaffAvailability {
+		t.Errorf("declared enforced: create = %d %s, want 409 staff_availability", rec.Code, rec.Body.String())
+	}
+
+	listed := decode[struct{ Count int }](t, doRequest(router, http.MethodGet, "/api/v1/config/rules", nil))
+	if listed.Count != 2 {
+		t.Errorf("declared rules = %d, want 2", listed.Count)
+	}
+	for range 2 {
+		if rec := doRequest(router, http.MethodDelete, "/api/v1/config/rules/"+apierror.RuleSchedulingHorizon,
+			nil); rec.Code != http.StatusNoContent {
+			t.Errorf("DELETE = %d, want 204", rec.Code)
+		}
+	}
+	if got := modes(); got[apierror.RuleSchedulingHorizon] != RuleShadow {
+		t.Errorf("horizon after deleting its declaration = %s, want back in shadow from RULE_SHADOW", got[apierror.RuleSchedulingHorizon])
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/v1/config/rules/"+apierror.RuleSchedulingHorizon,
+		nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET deleted = %d, want 404", rec.Code)
+	}
+
+	tests := []struct {
+		name string
+		rule string
+		body gin.H
+		want int
+	}{
+		{"unknown rule", "rest_period", gin.H{"mode": "shadow"}, http.StatusNotFound},
+		{"unknown mode", apierror.RuleStaffAvailability, gin.H{"mode": "off"}, http.StatusBadRequest},
+		{"end while enforced", apierror.RuleStaffAvailability, gin.H{"mode": "enforced",
+			"shadow_until": "2025-07-01T00:00:00Z"}, http.StatusBadRequest},
+		{"no mode", apierror.RuleStaffAvailability, gin.H{}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := doRequest(router, http.MethodPut, "/api/v1/config/rules/"+tt.rule, tt.body); rec.Code != tt.want {
+				t.Errorf("PUT = %d %s, want %d", rec.Code, rec.Body.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,833 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"bus-staff-assignment/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+// Scenario statuses
+const (
+	ScenarioDraft     = "draft"    // open for edits
+	ScenarioApplying  = "applying" // being written to the live roster
+	ScenarioApplied   = "applied"
+	ScenarioDiscarded = "discarded"
+)
+
+// maxScenarioNameLength matches the scenarios.name column
+const maxScenarioNameLength = 100
+
+// errScenarioModified is returned when saving a scenario that another request
+// has saved since it was read
+var errScenarioModified = errors.New("scenario has been modified since it was read")
+
+// Scenario is a planner's sandboxed copy of the assignments overlapping a
+// period. Edits stay in the scenario until it is applied to the live roster
+// in one transaction, or discarded.
+type Scenario struct {
+	ID          string               `json:"id"` // ULID
+	Name        string               `json:"name"`
+	From        time.Time            `json:"from"`
+	To          time.Time            `json:"to"`
+	Status      string               `json:"status"`
+	Assignments []ScenarioAssignment `json:"assignments"`
+	Removed     []ScenarioAssignment `json:"removed"`            // live assignments the scenario deletes
+	Version     int                  `json:"version"`            // incremented on every save
+	DepotID     string               `json:"depot_id,omitempty"` // the creator's depot; "" across depots
+	CreatedBy   string               `json:"created_by"`
+	CreatedAt   time.Time            `json:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at"`
+}
+
+// ScenarioAssignment is an assignment as a scenario has it. Copies of live
+// assignments keep the live ID and the version copied; assignments added in
+// the scenario get an ID of their own and no base version.
+type ScenarioAssignment struct {
+	Assignment
+	BaseVersion int  `json:"base_version,omitempty"`
+	Modified    bool `json:"modified,omitempty"` // a live copy that has been edited
+}
+
+func (a *ScenarioAssignment) live() bool { return a.BaseVersion != 0 }
+
+// find returns the index of the scenario's assignment with the public ID, or -1
+func (s *Scenario) find(publicID string) int {
+	for i := range s.Assignments {
+		if s.Assignments[i].PublicID == publicID {
+			return i
+		}
+	}
+	return -1
+}
+
+// pendingWrites returns the scenario's assignments that applying it would
+// write: those added in the scenario and edited copies
+func (s *Scenario) pendingWrites() []*Assignment {
+	var written []*Assignment
+	for i := range s.Assignments {
+		if !s.Assignments[i].live() || s.Assignments[i].Modified {
+			written = append(written, &s.Assignments[i].Assignment)
+		}
+	}
+	return written
+}
+
+// visibleTo reports whether a caller with the clearance may see the scenario:
+// it must be of their depot and hold no assignment labelled with a clearance
+// they don't have
+func (s *Scenario) visibleTo(clearance *Clearance) bool {
+	if !clearance.AllowsDepot(s.DepotID) {
+		return false
+	}
+	for _, copies := range [][]ScenarioAssignment{s.Assignments, s.Removed} {
+		for i := range copies {
+			if !clearance.AllowsLabel(copies[i].ClearanceLabel) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// assignments returns the scenario's assignments ordered by bus, as
+// buildRoster needs them
+func (s *Scenario) assignments() []Assignment {
+	assignments := make([]Assignment, len(s.Assignments))
+	for i := range s.Assignments {
+		assignments[i] = s.Assignments[i].Assignment
+	}
+	sort.SliceStable(assignments, func(i, j int) bool { return assignments[i].BusID < assignments[j].BusID })
+	return assignments
+}
+
+// ScenarioRepository stores scenarios
+type ScenarioRepository interface {
+	Create(scenario *Scenario) error
+	Get(id string) (*Scenario, error) // nil, nil when not found
+	List() ([]Scenario, error)        // newest first
+	Save(scenario *Scenario) error    // errScenarioModified unless scenario.Version is the stored one
+
+	WithContext(ctx context.Context) ScenarioRepository
+}
+
+// ScenarioEdit is one change in a bulk edit. An add needs bus_id, staff_id,
+// role and start_date; an update sets only the fields given.
+type ScenarioEdit struct {
+	Op         string                  `json:"op"`           // add, update or remove
+	ID         string                  `json:"id,omitempty"` // the scenario assignment to update or remove
+	Assignment UpdateAssignmentRequest `json:"assignment"`
+}
+
+// ScenarioEditRequest is a bulk edit, applied to the scenario all or nothing
+type ScenarioEditRequest struct {
+	Edits   []ScenarioEdit `json:"edits" binding:"required"`
+	Version int            `json:"version,omitempty"` // expected scenario version; omitted skips the check
+}
+
+// setAssignmentFields applies an edit's fields and status to the assignment and
+// validates the result, returning a client-facing message or an empty string
+func setAssignmentFields(assignment *Assignment, req UpdateAssignmentRequest) string {
+	if fieldErr := req.apply(assignment); fieldErr != nil {
+		return fieldErr.Message
+	}
+	if req.Status != nil {
+		if *req.Status != "active" && *req.Status != "completed" && *req.Status != "cancelled" {
+			return "Status must be 'active', 'completed' or 'cancelled'"
+		}
+		assignment.Status = *req.Status
+	}
+	if fieldErr := validateAssignment(assignment); fieldErr != nil {
+		return fieldErr.Message
+	}
+	return ""
+}
+
+// applyEdits makes the edits to the scenario in order. It returns a
+// client-facing message naming the first edit that can't be made, after which
+// the scenario must be thrown away.
+func (s *Scenario) applyEdits(edits []ScenarioEdit, now time.Time) string {
+	for n, edit := range edits {
+		if msg := s.applyEdit(edit, now); msg != "" {
+			return fmt.Sprintf("edit %d: %s", n+1, msg)
+		}
+	}
+	return ""
+}
+
+func (s *Scenario) applyEdit(edit ScenarioEdit, now time.Time) string {
+	if edit.Op == "add" {
+		added := ScenarioAssignment{Assignment: Assignment{Status: "active"}}
+		if msg := setAssignmentFields(&added.Assignment, edit.Assignment); msg != "" {
+			return msg
+		}
+		if added.BusID == 0 || added.StaffID == 0 || added.StartDate.IsZero() {
+			return "an added assignment needs bus_id, staff_id, role and start_date"
+		}
+		publicID, err := newULID(now)
+		if err != nil {
+			return "could not allocate an assignment ID"
+		}
+		added.PublicID = publicID
+		s.Assignments = append(s.Assignments, added)
+		return ""
+	}
+
+	publicID, valid := normalizeULID(edit.ID)
+	if !valid {
+		return "invalid assignment ID"
+	}
+	i := s.find(publicID)
+	if i < 0 {
+		return "assignment " + publicID + " is not in the scenario"
+	}
+
+	switch edit.Op {
+	case "update":
+		updated := s.Assignments[i]
+		if msg := setAssignmentFields(&updated.Assignment, edit.Assignment); msg != "" {
+			return msg
+		}
+		updated.Modified = updated.live()
+		s.Assignments[i] = updated
+	case "remove":
+		if s.Assignments[i].live() {
+			s.Removed = append(s.Removed, s.Assignments[i])
+		}
+		s.Assignments = append(s.Assignments[:i], s.Assignments[i+1:]...)
+	default:
+		return "op must be 'add', 'update' or 'remove'"
+	}
+	return ""
+}
+
+// ScenarioGap is a run of days on which a crewed bus has nobody in a role
+type ScenarioGap struct {
+	BusID int    `json:"bus_id"`
+	Role  string `json:"role"`
+	From  string `json:"from"` // YYYY-MM-DD
+	To    string `json:"to"`
+}
+
+// scenarioGaps finds the days on which a bus has crew working but nobody at
+// all in a required role, merging consecutive days. Partial-day gaps between
+// shifts are left to crew-status, as auto-fill only adds whole-day cover.
+func (s *Scenario) scenarioGaps(calendars map[string]*DepotCalendar) []ScenarioGap {
+	type slot struct {
+		busID int
+		role  string
+	}
+	gaps := []ScenarioGap{}
+	open := map[slot]int{} // index of each slot's latest gap
+	yesterday := ""
+	for _, day := range buildRoster(s.assignments(), s.From, s.To) {
+		date, _ := time.Parse("2006-01-02", day.Date)
+		for _, bus := range day.Buses {
+			if calendars[busDepot(bus.BusID)].ServiceOn(date).Level == ServiceNone {
+				continue
+			}
+			working := map[string]bool{}
+			for _, member := range bus.Crew {
+				if member.Status == "active" {
+					working[member.Role] = true
+				}
+			}
+			if len(working) == 0 {
+				continue
+			}
+			for _, role := range requiredCrewRoles {
+				if working[role] {
+					continue
+				}
+				key := slot{bus.BusID, role}
+				if i, exists := open[key]; exists && gaps[i].To == yesterday {
+					gaps[i].To = day.Date
+					continue
+				}
+				open[key] = len(gaps)
+				gaps = append(gaps, ScenarioGap{BusID: bus.BusID, Role: role, From: day.Date, To: day.Date})
+			}
+		}
+		yesterday = day.Date
+	}
+	return gaps
+}
+
+// autofill covers each gap with a whole-day assignment for a staff member
+// whose position is the missing role, preferring the bus's depot, who is free
+// in the scenario and not booked off. It returns the assignments added and the
+// gaps nobody could cover.
+func (s *Scenario) autofill(periods []AvailabilityPeriod, calendars map[string]*DepotCalendar,
+	now time.Time) ([]ScenarioAssignment, []ScenarioGap, error) {
+	staffIDs := make([]int, 0, len(mockStaff))
+	for id := range mockStaff {
+		staffIDs = append(staffIDs, id)
+	}
+	sort.Ints(staffIDs)
+
+	filled := []ScenarioAssignment{}
+	unfilled := []ScenarioGap{}
+	for _, gap := range s.scenarioGaps(calendars) {
+		from, _ := time.Parse("2006-01-02", gap.From)
+		to, _ := time.Parse("2006-01-02", gap.To)
+		candidate := Assignment{BusID: gap.BusID, Role: gap.Role, StartDate: from, EndDate: &to, Status: "active"}
+
+		depot := busDepot(gap.BusID)
+		order := append([]int{}, staffIDs...)
+		sort.SliceStable(order, func(i, j int) bool {
+			return mockStaff[order[i]]["depot"] == depot && mockStaff[order[j]]["depot"] != depot
+		})
+
+		found := false
+		for _, staffID := range order {
+			if mockStaff[staffID]["position"] != gap.Role {
+				continue
+			}
+			candidate.StaffID = staffID
+			if s.free(&candidate, periods) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unfilled = append(unfilled, gap)
+			continue
+		}
+
+		publicID, err := newULID(now)
+		if err != nil {
+			return nil, nil, err
+		}
+		candidate.PublicID = publicID
+		added := ScenarioAssignment{Assignment: candidate}
+		s.Assignments = append(s.Assignments, added)
+		filled = append(filled, added)
+	}
+	return filled, unfilled, nil
+}
+
+// free reports whether the assignment clashes with nothing active in the
+// scenario and the staff member isn't booked off during it
+func (s *Scenario) free(assignment *Assignment, periods []AvailabilityPeriod) bool {
+	for i := range s.Assignments {
+		if s.Assignments[i].Status == "active" && assignment.ConflictsWith(&s.Assignments[i].Assignment) {
+			return false
+		}
+	}
+	for i := range periods {
+		if periods[i].StaffID == assignment.StaffID && periods[i].Affects(assignment) {
+			return false
+		}
+	}
+	return true
+}
+
+// RosterMetrics summarises a roster over a period, for comparing a scenario
+// with the live roster
+type RosterMetrics struct {
+	Assignments      int `json:"assignments"`       // assignments worked in the period, excluding cancelled ones
+	StaffDays        int `json:"staff_days"`        // days worked by each staff member, summed
+	IncompleteCrews  int `json:"incomplete_crews"`  // bus-days missing a role during service
+	Conflicts        int `json:"conflicts"`         // pairs of clashing active assignments
+	UnavailableStaff int `json:"unavailable_staff"` // staff-days rostered on leave, sick or resting
+}
+
+func (m RosterMetrics) minus(other RosterMetrics) RosterMetrics {
+	return RosterMetrics{
+		Assignments:      m.Assignments - other.Assignments,
+		StaffDays:        m.StaffDays - other.StaffDays,
+		IncompleteCrews:  m.IncompleteCrews - other.IncompleteCrews,
+		Conflicts:        m.Conflicts - other.Conflicts,
+		UnavailableStaff: m.UnavailableStaff - other.UnavailableStaff,
+	}
+}
+
+// rosterMetrics measures the assignments over the period. They must be
+// ordered by bus, as ListInRange returns them.
+func rosterMetrics(assignments []Assignment, periods []AvailabilityPeriod, calendars map[string]*DepotCalendar,
+	from, to time.Time) RosterMetrics {
+	var worked []Assignment
+	for _, assignment := range assignments {
+		if assignment.Status != "cancelled" {
+			worked = append(worked, assignment)
+		}
+	}
+	absences := map[int][]AvailabilityPeriod{}
+	for _, period := range periods {
+		absences[period.StaffID] = append(absences[period.StaffID], period)
+	}
+
+	var metrics RosterMetrics
+	counted := map[string]bool{}
+	for _, day := range buildRoster(worked, from, to) {
+		date, _ := time.Parse("2006-01-02", day.Date)
+		staff := map[int]bool{}
+		for _, bus := range day.Buses {
+			status := newCrewStatus(bus, day.Date, calendars[busDepot(bus.BusID)].ServiceOn(date))
+			if status.Status == CrewIncomplete {
+				metrics.IncompleteCrews++
+			}
+			for _, member := range bus.Crew {
+				counted[member.PublicID] = true
+				if !staff[member.StaffID] {
+					staff[member.StaffID] = true
+					if absenceOn(absences[member.StaffID], date) != "" {
+						metrics.UnavailableStaff++
+					}
+				}
+			}
+		}
+		metrics.StaffDays += len(staff)
+	}
+	metrics.Assignments = len(counted)
+
+	for i := range worked {
+		for j := i + 1; j < len(worked); j++ {
+			if worked[i].Status == "active" && worked[j].Status == "active" && worked[i].ConflictsWith(&worked[j]) {
+				metrics.Conflicts++
+			}
+		}
+	}
+	return metrics
+}
+
+// CreateScenarioRequest names a scenario and the period it copies
+type CreateScenarioRequest struct {
+	Name string `json:"name" binding:"required"`
+	From string `json:"from" binding:"required"` // YYYY-MM-DD
+	To   string `json:"to" binding:"required"`   // YYYY-MM-DD, inclusive
+}
+
+// ScenarioHandler serves the scenario endpoints
+type ScenarioHandler struct {
+	scenarios      ScenarioRepository
+	assignments    AssignmentRepository
+	availability   AvailabilityRepository
+	qualifications QualificationRepository
+	calendars      DepotCalendarRepository
+}
+
+// NewScenarioHandler creates a handler storing scenarios in the given
+// repository and copying from and applying to the live assignments
+func NewScenarioHandler(scenarios ScenarioRepository, assignments AssignmentRepository,
+	availability AvailabilityRepository, qualifications QualificationRepository,
+	calendars DepotCalendarRepository) *ScenarioHandler {
+	return &ScenarioHandler{scenarios: scenarios, assignments: assignments, availability: availability,
+		qualifications: qualifications, calendars: calendars}
+}
+
+// forRequest returns the handler with its repositories bound to the request's context
+func (h *ScenarioHandler) forRequest(c *gin.Context) *ScenarioHandler {
+	ctx := c.Request.Context()
+	return &ScenarioHandler{scenarios: h.scenarios.WithContext(ctx), assignments: h.assignments.WithContext(ctx),
+		availability: h.availability.WithContext(ctx), qualifications: h.qualifications.WithContext(ctx),
+		calendars: h.calendars.WithContext(ctx)}
+}
+
+func (h *ScenarioHandler) handleCreateScenario(c *gin.Context) {
+	h = h.forRequest(c)
+	var req CreateScenarioRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, &req, err)
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxScenarioNameLength {
+		respondInvalidField(c, "name", "name must be between 1 and 100 characters")
+		return
+	}
+	from, to, ok := parseRosterRange(c, req.From, req.To)
+	if !ok {
+		return
+	}
+
+	// A scenario copies only what its creator can see, and belongs to their depot
+	clearance := callerClearance(c)
+	live, err := h.assignments.ListInRange(from, to, 0, clearance)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve assignments")
+		return
+	}
+	now := time.Now()
+	id, err := newULID(now)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to create scenario")
+		return
+	}
+
+	scenario := Scenario{
+		ID:          id,
+		Name:        name,
+		From:        from,
+		To:          to,
+		Status:      ScenarioDraft,
+		Assignments: make([]ScenarioAssignment, len(live)),
+		Removed:     []ScenarioAssignment{},
+		CreatedBy:   actorFromContext(c),
+	}
+	if clearance != nil {
+		scenario.DepotID = clearance.Depot
+	}
+	for i, assignment := range live {
+		scenario.Assignments[i] = ScenarioAssignment{Assignment: assignment, BaseVersion: assignment.Version}
+	}
+	if err := h.scenarios.Create(&scenario); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to create scenario")
+		return
+	}
+	c.JSON(http.StatusCreated, scenario)
+}
+
+// handleGetScenarios lists the scenarios the caller may see
+func (h *ScenarioHandler) handleGetScenarios(c *gin.Context) {
+	h = h.forRequest(c)
+	all, err := h.scenarios.List()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve scenarios")
+		return
+	}
+	clearance := callerClearance(c)
+	scenarios := []Scenario{}
+	for _, scenario := range all {
+		if scenario.visibleTo(clearance) {
+			scenarios = append(scenarios, scenario)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"scenarios": scenarios, "count": len(scenarios)})
+}
+
+// scenarioFromParam loads the scenario named in the :id path parameter,
+// requiring it to be a draft when draftOnly is set. Scenarios the caller
+// may not see are not found. It returns false once an error response has been written.
+func (h *ScenarioHandler) scenarioFromParam(c *gin.Context, draftOnly bool) (*Scenario, bool) {
+	id, valid := normalizeULID(c.Param("id"))
+	if !valid {
+		respondError(c, http.StatusBadRequest, "Invalid scenario ID")
+		return nil, false
+	}
+	scenario, err := h.scenarios.Get(id)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve scenario")
+		return nil, false
+	}
+	if scenario == nil || !scenario.visibleTo(callerClearance(c)) {
+		respondError(c, http.StatusNotFound, "Scenario not found")
+		return nil, false
+	}
+	if draftOnly && scenario.Status != ScenarioDraft {
+		respondError(c, http.StatusConflict, "Scenario is "+scenario.Status+" and can no longer be changed")
+		return nil, false
+	}
+	return scenario, true
+}
+
+// saveScenario stores the scenario, answering 409 if another request saved it
+// first. It returns false once an error response has been written.
+func (h *ScenarioHandler) saveScenario(c *gin.Context, scenario *Scenario) bool {
+	if err := h.scenarios.Save(scenario); err != nil {
+		if errors.Is(err, errScenarioModified) {
+			respondError(c, http.StatusConflict, "Scenario has been modified since you loaded it; reload and try again")
+			return false
+		}
+		respondError(c, http.StatusInternalServerError, "Failed to save scenario")
+		return false
+	}
+	return true
+}
+
+func (h *ScenarioHandler) handleGetScenario(c *gin.Context) {
+	h = h.forRequest(c)
+	if scenario, ok := h.scenarioFromParam(c, false); ok {
+		c.JSON(http.StatusOK, scenario)
+	}
+}
+
+// handleEditScenario makes a bulk edit to a draft scenario. Edits are checked
+// as they would be on the live roster, except that conflicts and unavailable
+// staff are allowed until the scenario is applied, so planners can work
+// through them. Buses at other depots and clearance labels the caller doesn't
+// hold are refused straight away.
+func (h *ScenarioHandler) handleEditScenario(c *gin.Context) {
+	h = h.forRequest(c)
+	var req ScenarioEditRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, &req, err)
+		return
+	}
+	scenario, ok := h.scenarioFromParam(c, true)
+	if !ok {
+		return
+	}
+	if req.Version != 0 && req.Version != scenario.Version {
+		respondError(c, http.StatusConflict, "Scenario has been modified since you loaded it; reload and try again")
+		return
+	}
+
+	if msg := scenario.applyEdits(req.Edits, time.Now()); msg != "" {
+		respondError(c, http.StatusBadRequest, msg)
+		return
+	}
+	for _, assignment := range scenario.pendingWrites() {
+		if !checkClearance(c, assignment) {
+			return
+		}
+	}
+	if h.saveScenario(c, scenario) {
+		c.JSON(http.StatusOK, scenario)
+	}
+}
+
+// handleAutofillScenario covers the scenario's crew gaps where it can
+func (h *ScenarioHandler) handleAutofillScenario(c *gin.Context) {
+	h = h.forRequest(c)
+	scenario, ok := h.scenarioFromParam(c, true)
+	if !ok {
+		return
+	}
+	periods, err := h.availability.List(AvailabilityFilter{From: &scenario.From, To: &scenario.To})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve availability")
+		return
+	}
+	calendars, err := depotCalendars(h.calendars)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve depot calendars")
+		return
+	}
+
+	filled, unfilled, err := scenario.autofill(periods, calendars, time.Now())
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to fill scenario")
+		return
+	}
+	if len(filled) > 0 && !h.saveScenario(c, scenario) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"scenario": scenario, "filled": filled, "unfilled": unfilled})
+}
+
+// handleCompareScenario measures the scenario against the live roster for
+// the same period
+func (h *ScenarioHandler) handleCompareScenario(c *gin.Context) {
+	h = h.forRequest(c)
+	scenario, ok := h.scenarioFromParam(c, false)
+	if !ok {
+		return
+	}
+	live, err := h.assignments.ListInRange(scenario.From, scenario.To, 0, callerClearance(c))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve assignments")
+		return
+	}
+	periods, err := h.availability.List(AvailabilityFilter{From: &scenario.From, To: &scenario.To})
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve availability")
+		return
+	}
+	calendars, err := depotCalendars(h.calendars)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve depot calendars")
+		return
+	}
+
+	liveMetrics := rosterMetrics(live, periods, calendars, scenario.From, scenario.To)
+	scenarioMetrics := rosterMetrics(scenario.assignments(), periods, calendars, scenario.From, scenario.To)
+	added, modified := 0, 0
+	for i := range scenario.Assignments {
+		switch {
+		case !scenario.Assignments[i].live():
+			added++
+		case scenario.Assignments[i].Modified:
+			modified++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"scenario_id": scenario.ID,
+		"from":        scenario.From.Format("2006-01-02"),
+		"to":          scenario.To.Format("2006-01-02"),
+		"live":        liveMetrics,
+		"scenario":    scenarioMetrics,
+		"difference":  scenarioMetrics.minus(liveMetrics),
+		"added":       added,
+		"modified":    modified,
+		"removed":     len(scenario.Removed),
+	})
+}
+
+// scenarioChanges turns the scenario's edits into writes against the live
+// assignments they were copied from. It returns false once an error response
+// has been written, including a 409 when a copied assignment has since been
+// changed or deleted on the live roster.
+func (h *ScenarioHandler) scenarioChanges(c *gin.Context, scenario *Scenario) (*AssignmentChanges, bool) {
+	changes := &AssignmentChanges{}
+
+	// Copies carry the live ID for lookup; the internal ID isn't stored in the scenario
+	resolve := func(copied *ScenarioAssignment) (*Assignment, bool) {
+		current, err := h.assignments.GetByPublicID(copied.PublicID, false)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to retrieve assignment")
+			return nil, false
+		}
+		if current == nil || current.Version != copied.BaseVersion {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":         newAPIError(http.StatusConflict, "The live roster has changed since the scenario was created; create a new scenario"),
+				"assignment_id": copied.PublicID,
+			})
+			return nil, false
+		}
+		assignment := copied.Assignment
+		assignment.ID = current.ID
+		assignment.Version = copied.BaseVersion
+		return &assignment, true
+	}
+
+	for i := range scenario.Removed {
+		assignment, ok := resolve(&scenario.Removed[i])
+		if !ok {
+			return nil, false
+		}
+		changes.Delete = append(changes.Delete, *assignment)
+	}
+	for i := range scenario.Assignments {
+		copied := &scenario.Assignments[i]
+		switch {
+		case !copied.live():
+			assignment := copied.Assignment
+			assignment.PublicID = ""
+			changes.Create = append(changes.Create, assignment)
+		case copied.Modified:
+			assignment, ok := resolve(copied)
+			if !ok {
+				return nil, false
+			}
+			changes.Update = append(changes.Update, *assignment)
+		}
+	}
+	return changes, true
+}
+
+// handleApplyScenario writes the scenario to the live roster in one
+// transaction. It is refused if the live roster has changed under the
+// scenario, or if the result would leave conflicts, unavailable staff or,
+// with QUALIFICATION_CHECK=block, unqualified staff.
+func (h *ScenarioHandler) handleApplyScenario(c *gin.Context) {
+	h = h.forRequest(c)
+	scenario, ok := h.scenarioFromParam(c, true)
+	if !ok {
+		return
+	}
+	changes, ok := h.scenarioChanges(c, scenario)
+	if !ok {
+		return
+	}
+	for _, assignment := range changes.written() {
+		if !checkClearance(c, assignment) {
+			return
+		}
+	}
+	for _, assignment := range changes.Delete {
+		if !checkBusDepots(c, assignment.BusID) {
+			return
+		}
+	}
+	for _, assignment := range changes.written() {
+		if assignment.Status != "active" {
+			continue
+		}
+		unavailable, err := unavailableFor(h.availability, assignment)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to check staff availability")
+			return
+		}
+		if len(unavailable) > 0 &&
+			enforceRule(c, apierror.RuleStaffAvailability, unavailableMessage(assignment.StaffID, unavailable)) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": newRuleViolation(apierror.RuleStaffAvailability,
+					fmt.Sprintf("Staff member %d is unavailable during a scenario assignment", assignment.StaffID)),
+				"unavailable": unavailable,
+			})
+			return
+		}
+		if !checkQualifications(c, h.qualifications, assignment) {
+			return
+		}
+	}
+
+	guard := newBulkGuard(c)
+	written := append(append([]Assignment{}, changes.Create...), changes.Update...)
+	if err := guard.check(newBulkImpact("apply_scenario", written, changes.Delete)); err != nil {
+		respondBulkConfirmation(c, err)
+		return
+	}
+
+	// Claiming the scenario first stops two requests applying it twice
+	scenario.Status = ScenarioApplying
+	if !h.saveScenario(c, scenario) {
+		return
+	}
+
+	if err := h.assignments.ApplyChanges(changes, actorFromContext(c)); err != nil {
+		scenario.Status = ScenarioDraft
+		if saveErr := h.scenarios.Save(scenario); saveErr != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to apply scenario")
+			return
+		}
+		var conflict *ConflictError
+		switch {
+		case errors.Is(err, errStaleVersion):
+			respondError(c, http.StatusConflict, "The live roster has changed since the scenario was created; create a new scenario")
+		case errors.As(err, &conflict):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":      newAPIError(http.StatusConflict, "Applying the scenario would leave conflicting assignments"),
+				"assignment": conflict.Assignment,
+				"conflicts":  conflict.Conflicts,
+			})
+		default:
+			if respondDeletionHold(c, err) {
+				respondError(c, http.StatusInternalServerError, "Failed to apply scenario")
+			}
+		}
+		return
+	}
+
+	scenario.Status = ScenarioApplied
+	guard.report()
+	if !h.saveScenario(c, scenario) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"scenario": scenario,
+		"created":  nonNil(changes.Create),
+		"updated":  nonNil(changes.Update),
+		"deleted":  nonNil(changes.Delete),
+	})
+}
+
+// nonNil keeps empty lists as [] rather than null in responses
+func nonNil(assignments []Assignment) []Assignment {
+	if assignments == nil {
+		return []Assignment{}
+	}
+	return assignments
+}
+
+// handleDiscardScenario abandons a draft scenario, leaving the live roster untouched
+func (h *ScenarioHandler) handleDiscardScenario(c *gin.Context) {
+	h = h.forRequest(c)
+	scenario, ok := h.scenarioFromParam(c, true)
+	if !ok {
+		return
+	}
+	scenario.Status = ScenarioDiscarded
+	if h.saveScenario(c, scenario) {
+		c.JSON(http.StatusOK, scenario)
+	}
+}
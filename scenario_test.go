@@ -0,0 +1,232 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"bus-staff-assignment/apierror"
+	"github.com/gin-gonic/gin"
+)
+
+func createScenario(t *testing.T, router *gin.Engine, from, to string) Scenario {
+	t.Helper()
+	rec := doRequest(router, http.MethodPost, "/api/scenarios", gin.H{"name": "Spring timetable", "from": from, "to": to})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create scenario status = %d, want %d: %s", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	return decode[Scenario](t, rec)
+}
+
+func TestScenarioEditAutofillCompareAndApply(t *testing.T) {
+	router, repo := newTestRouter(t)
+	end := date("2025-03-09")
+	north := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03"), EndDate: &end})
+	south := mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-03-03"), EndDate: &end})
+
+	scenario := createScenario(t, router, "2025-03-03", "2025-03-09")
+	if len(scenario.Assignments) != 2 || scenario.Assignments[0].BaseVersion != 1 {
+		t.Fatalf("scenario assignments = %+v, want copies of both live assignments", scenario.Assignments)
+	}
+	path := "/api/scenarios/" + scenario.ID
+
+	// A bad edit leaves the whole batch unapplied
+	bad := gin.H{"edits": []gin.H{
+		{"op": "remove", "id": south.PublicID},
+		{"op": "update", "id": north.PublicID, "assignment": gin.H{"role": "pilot"}},
+	}}
+	if rec := doRequest(router, http.MethodPost, path+"/edits", bad); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad edit status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if got := decode[Scenario](t, doRequest(router, http.MethodGet, path, nil)); len(got.Assignments) != 2 || got.Version != 1 {
+		t.Errorf("scenario after bad edit = %+v, want it unchanged", got)
+	}
+
+	edits := gin.H{"version": 1, "edits": []gin.H{
+		{"op": "remove", "id": south.PublicID},
+		{"op": "add", "assignment": gin.H{"bus_id": 4, "staff_id": 3, "role": "driver", "start_date": "2025-03-03", "end_date": "2025-03-09"}},
+	}}
+	rec := doRequest(router, http.MethodPost, path+"/edits", edits)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("edit status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if edited := decode[Scenario](t, rec); len(edited.Assignments) != 2 || len(edited.Removed) != 1 {
+		t.Errorf("edited scenario = %+v, want bus 3 removed and bus 4 added", edited)
+	}
+	if live := decode[struct{ Count int }](t, doRequest(router, http.MethodGet, "/api/assignments", nil)); live.Count != 2 {
+		t.Errorf("live count = %d, want the live roster untouched", live.Count)
+	}
+
+	// Jane Conductor is the only conductor, so she covers bus 1 and bus 4 stays short
+	rec = doRequest(router, http.MethodPost, path+"/autofill", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("autofill status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	filled := decode[struct {
+		Filled   []ScenarioAssignment
+		Unfilled []ScenarioGap
+	}](t, rec)
+	if len(filled.Filled) != 1 || filled.Filled[0].BusID != 1 || filled.Filled[0].StaffID != 2 {
+		t.Errorf("filled = %+v, want staff 2 as bus 1's conductor", filled.Filled)
+	}
+	if len(filled.Unfilled) != 1 || filled.Unfilled[0] != (ScenarioGap{BusID: 4, Role: "conductor", From: "2025-03-03", To: "2025-03-09"}) {
+		t.Errorf("unfilled = %+v, want bus 4's conductor for the week", filled.Unfilled)
+	}
+
+	compare := decode[struct {
+		Live, Scenario, Difference RosterMetrics
+		Added, Modified, Removed   int
+	}](t, doRequest(router, http.MethodGet, path+"/compare", nil))
+	if compare.Live.IncompleteCrews != 14 || compare.Scenario.IncompleteCrews != 7 || compare.Difference.IncompleteCrews != -7 {
+		t.Errorf("incomplete crews = %+v, want 14 live and 7 in the scenario", compare)
+	}
+	if compare.Difference.StaffDays != 7 || compare.Added != 2 || compare.Removed != 1 {
+		t.Errorf("comparison = %+v, want 7 more staff-days from 2 added and 1 removed", compare)
+	}
+
+	rec = doRequest(router, http.MethodPost, path+"/apply", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("apply status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	applied := decode[struct {
+		Scenario                  Scenario
+		Created, Updated, Deleted []Assignment
+	}](t, rec)
+	if applied.Scenario.Status != ScenarioApplied || len(applied.Created) != 2 || len(applied.Deleted) != 1 {
+		t.Errorf("applied = %+v, want 2 created and 1 deleted", applied)
+	}
+	if live := decode[struct{ Count int }](t, doRequest(router, http.MethodGet, "/api/assignments", nil)); live.Count != 3 {
+		t.Errorf("live count = %d, want 3", live.Count)
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/assignments/"+south.PublicID, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("removed assignment status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	if rec := doRequest(router, http.MethodPost, path+"/apply", nil); rec.Code != http.StatusConflict {
+		t.Errorf("second apply status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestScenarioApplyRejectsChangedLiveRoster(t *testing.T) {
+	router, repo := newTestRouter(t)
+	existing := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03")})
+
+	scenario := createScenario(t, router, "2025-03-03", "2025-03-09")
+	path := "/api/scenarios/" + scenario.ID
+	edits := gin.H{"edits": []gin.H{{"op": "update", "id": existing.PublicID, "assignment": gin.H{"staff_id": 3}}}}
+	if rec := doRequest(router, http.MethodPost, path+"/edits", edits); rec.Code != http.StatusOK {
+		t.Fatalf("edit status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	// Someone edits the live assignment after the scenario copied it
+	patch := gin.H{"role": "conductor", "version": 1}
+	if rec := doRequest(router, http.MethodPatch, "/api/assignments/"+existing.PublicID, patch); rec.Code != http.StatusOK {
+		t.Fatalf("patch status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	if rec := doRequest(router, http.MethodPost, path+"/apply", nil); rec.Code != http.StatusConflict {
+		t.Errorf("apply status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	current, err := repo.GetByPublicID(existing.PublicID, false)
+	if err != nil || current.StaffID != 1 || current.Role != "conductor" {
+		t.Errorf("live assignment = %+v, %v; want the live edit kept", current, err)
+	}
+
+	rec := doRequest(router, http.MethodPost, path+"/discard", nil)
+	if discarded := decode[Scenario](t, rec); rec.Code != http.StatusOK || discarded.Status != ScenarioDiscarded {
+		t.Errorf("discard = %d %+v, want the scenario discarded", rec.Code, discarded)
+	}
+	if rec := doRequest(router, http.MethodPost, path+"/edits", edits); rec.Code != http.StatusConflict {
+		t.Errorf("editing a discarded scenario status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestScenarioApplyChecksQualifications(t *testing.T) {
+	useQualificationPolicy(t, QualificationBlock)
+	router, _ := newTestRouter(t)
+	scenario := createScenario(t, router, "2025-03-03", "2025-03-09")
+	path := "/api/scenarios/" + scenario.ID
+	edits := gin.H{"edits": []gin.H{{"op": "add", "assignment": gin.H{"bus_id": 1, "staff_id": 1, "role": "driver",
+		"start_date": "2025-03-04", "end_date": "2025-03-08"}}}}
+	if rec := doRequest(router, http.MethodPost, path+"/edits", edits); rec.Code != http.StatusOK {
+		t.Fatalf("edit status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	rec := doRequest(router, http.MethodPost, path+"/apply", nil)
+	if rec.Code != http.StatusConflict || errorOf(t, rec).Rule != apierror.RuleStaffQualification {
+		t.Fatalf("apply with an unlicensed driver = %d %s, want 409 staff_qualification", rec.Code, rec.Body.String())
+	}
+	if got := decode[Scenario](t, doRequest(router, http.MethodGet, path, nil)); got.Status != ScenarioDraft {
+		t.Errorf("scenario status after refused apply = %s, want %s", got.Status, ScenarioDraft)
+	}
+
+	doRequest(router, http.MethodPut, "/api/staff/1/qualifications/D", gin.H{"license_number": "DL-1"})
+	if rec := doRequest(router, http.MethodPost, path+"/apply", nil); rec.Code != http.StatusOK {
+		t.Errorf("apply once licensed = %d %s, want %d", rec.Code, rec.Body.String(), http.StatusOK)
+	}
+}
+
+func TestScenarioDepotScope(t *testing.T) {
+	router, repo, secret := newClearanceRouter(t)
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03")})
+	mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-03-03")})
+	north := depotToken(t, secret, RoleDispatcher, "north")
+	south := depotToken(t, secret, RoleDispatcher, "south")
+
+	rec := doRequest(router, http.MethodPost, "/api/scenarios",
+		gin.H{"name": "North spring", "from": "2025-03-03", "to": "2025-03-09"}, "Authorization", north)
+	scenario := decode[Scenario](t, rec)
+	if rec.Code != http.StatusCreated || scenario.DepotID != "north" || len(scenario.Assignments) != 1 ||
+		scenario.Assignments[0].BusID != 1 {
+		t.Fatalf("create = %d %s, want a north scenario copying only the north assignment", rec.Code, rec.Body.String())
+	}
+	path := "/api/scenarios/" + scenario.ID
+
+	if rec := doRequest(router, http.MethodGet, path, nil, "Authorization", south); rec.Code != http.StatusNotFound {
+		t.Errorf("south get = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	listed := decode[struct{ Scenarios []Scenario }](t, doRequest(router, http.MethodGet, "/api/scenarios", nil,
+		"Authorization", south))
+	if len(listed.Scenarios) != 0 {
+		t.Errorf("south lists %+v, want the north scenario left out", listed.Scenarios)
+	}
+	if rec := doRequest(router, http.MethodPost, path+"/apply", nil, "Authorization", south); rec.Code != http.StatusNotFound {
+		t.Errorf("south apply = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	edits := gin.H{"edits": []gin.H{{"op": "add", "assignment": gin.H{"bus_id": 4, "staff_id": 2, "role": "conductor",
+		"start_date": "2025-03-04"}}}}
+	if rec := doRequest(router, http.MethodPost, path+"/edits", edits, "Authorization", north); rec.Code != http.StatusForbidden {
+		t.Errorf("adding a south bus = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if got := decode[Scenario](t, doRequest(router, http.MethodGet, path, nil, "Authorization", north)); len(got.Assignments) != 1 {
+		t.Errorf("scenario after refused edit = %+v, want it unchanged", got.Assignments)
+	}
+}
+
+func TestScenarioClearanceLabels(t *testing.T) {
+	router, repo, secret := newClearanceRouter(t)
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03"),
+		ClearanceLabel: "vip-charter"})
+	cleared := clearedToken(t, secret, RoleDispatcher, "vip-charter")
+	uncleared := clearedToken(t, secret, RoleDispatcher)
+
+	rec := doRequest(router, http.MethodPost, "/api/scenarios",
+		gin.H{"name": "Charter week", "from": "2025-03-03", "to": "2025-03-09"}, "Authorization", cleared)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", rec.Code, rec.Body.String())
+	}
+	path := "/api/scenarios/" + decode[Scenario](t, rec).ID
+	if rec := doRequest(router, http.MethodGet, path, nil, "Authorization", uncleared); rec.Code != http.StatusNotFound {
+		t.Errorf("uncleared get of a scenario holding a restricted assignment = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	// Scenarios can't restrict assignments out of their planner's reach
+	rec = doRequest(router, http.MethodPost, "/api/scenarios",
+		gin.H{"name": "Open week", "from": "2025-04-07", "to": "2025-04-13"}, "Authorization", uncleared)
+	path = "/api/scenarios/" + decode[Scenario](t, rec).ID
+	edits := gin.H{"edits": []gin.H{{"op": "add", "assignment": gin.H{"bus_id": 2, "staff_id": 2, "role": "conductor",
+		"start_date": "2025-04-07", "clearance_label": "vip-charter"}}}}
+	if rec := doRequest(router, http.MethodPost, path+"/edits", edits, "Authorization", uncleared); rec.Code != http.StatusForbidden {
+		t.Errorf("uncleared labelled add = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// DayMask is the set of weekdays an assignment is worked on within its
+// start/end range. Bit n corresponds to time.Weekday(n). The zero value
+// means every day, which keeps existing assignments unchanged.
+type DayMask uint8
+
+const allDays DayMask = 1<<7 - 1
+
+var weekdayNames = [...]string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseDayMask builds a mask from day names such as "mon" or "Monday",
+// either the three-letter abbreviation or the full name. An empty list
+// yields the every-day mask.
+func ParseDayMask(days []string) (DayMask, error) {
+	var mask DayMask
+	for _, day := range days {
+		name := strings.ToLower(strings.TrimSpace(day))
+		found := false
+		for i, wd := range weekdayNames {
+			if wd == name || strings.ToLower(time.Weekday(i).String()) == name {
+				mask |= 1 << i
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("invalid working day %q", day)
+		}
+	}
+	return mask.normalize(), nil
+}
+
+// normalize collapses a mask covering the whole week to the zero value so
+// both forms compare equal.
+func (m DayMask) normalize() DayMask {
+	if m&allDays == allDays {
+		return 0
+	}
+	return m & allDays
+}
+
+// Includes reports whether the given weekday is a working day.
+func (m DayMask) Includes(day time.Weekday) bool {
+	return m == 0 || m&(1<<day) != 0
+}
+
+// Days returns the working day names in week order, or nil for every day.
+func (m DayMask) Days() []string {
+	if m == 0 {
+		return nil
+	}
+	var days []string
+	for i, name := range weekdayNames {
+		if m&(1<<i) != 0 {
+			days = append(days, name)
+		}
+	}
+	return days
+}
+
+func (m DayMask) MarshalJSON() ([]byte, error) {
+	days := m.Days()
+	if days == nil {
+		days = []string{}
+	}
+	return json.Marshal(days)
+}
+
+func (m *DayMask) UnmarshalJSON(data []byte) error {
+	var days []string
+	if err := json.Unmarshal(data, &days); err != nil {
+		return err
+	}
+	mask, err := ParseDayMask(days)
+	if err != nil {
+		return err
+	}
+	*m = mask
+	return nil
+}
+
+// TimeOfDay is a wall-clock time in whole minutes after midnight, written
+// as "HH:MM" in JSON and stored in PostgreSQL TIME columns.
+type TimeOfDay int
+
+// endOfDay is midnight at the end of the day, written as "24:00".
+const endOfDay = TimeOfDay(24 * 60)
+
+// ParseTimeOfDay reads a 24-hour "HH:MM" time such as "06:30". "24:00" is
+// accepted as the end of the day.
+func ParseTimeOfDay(value string) (TimeOfDay, error) {
+	value = strings.TrimSpace(value)
+	if value == "24:00" {
+		return endOfDay, nil
+	}
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, use HH:MM", value)
+	}
+	return TimeOfDay(parsed.Hour()*60 + parsed.Minute()), nil
+}
+
+func (t TimeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d", int(t)/60, int(t)%60)
+}
+
+func (t TimeOfDay) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+func (t *TimeOfDay) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	parsed, err := ParseTimeOfDay(value)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// ScanTime implements pgtype.TimeScanner.
+func (t *TimeOfDay) ScanTime(v pgtype.Time) error {
+	if !v.Valid {
+		return fmt.Errorf("cannot scan NULL into TimeOfDay")
+	}
+	*t = TimeOfDay(v.Microseconds / int64(time.Minute/time.Microsecond))
+	return nil
+}
+
+// TimeValue implements pgtype.TimeValuer.
+func (t TimeOfDay) TimeValue() (pgtype.Time, error) {
+	return pgtype.Time{Microseconds: int64(t) * int64(time.Minute/time.Microsecond), Valid: true}, nil
+}
+
+// WorksOn reports whether the assignment covers the given calendar date,
+// taking both the date range and the working day mask into account.
+func (a *Assignment) WorksOn(date time.Time) bool {
+	date = truncateDate(date)
+	if date.Before(truncateDate(a.StartDate)) {
+		return false
+	}
+	if a.EndDate != nil && date.After(truncateDate(*a.EndDate)) {
+		return false
+	}
+	return a.WorkingDays.Includes(date.Weekday())
+}
+
+// standardShift is how long a working day counts for on an assignment
+// without shift times
+const standardShift = 8 * time.Hour
+
+// ShiftLength returns how long the assignment is worked on each of its
+// working days
+func (a *Assignment) ShiftLength() time.Duration {
+	if a.ShiftStart == nil || a.ShiftEnd == nil {
+		return standardShift
+	}
+	return time.Duration(*a.ShiftEnd-*a.ShiftStart) * time.Minute
+}
+
+// SharesWorkingDay reports whether two assignments have at least one
+// calendar date in common on which both are worked.
+func (a *Assignment) SharesWorkingDay(other *Assignment) bool {
+	from := truncateDate(a.StartDate)
+	if s := truncateDate(other.StartDate); s.After(from) {
+		from = s
+	}
+
+	var to *time.Time
+	for _, end := range []*time.Time{a.EndDate, other.EndDate} {
+		if end == nil {
+			continue
+		}
+		e := truncateDate(*end)
+		if to == nil || e.Before(*to) {
+			to = &e
+		}
+	}
+	if to != nil && to.Before(from) {
+		return false
+	}
+
+	// A full week of overlap covers every weekday, so only the masks matter.
+	if to == nil || to.Sub(from) >= 6*24*time.Hour {
+		return a.WorkingDays.bits()&other.WorkingDays.bits() != 0
+	}
+	for d := from; !d.After(*to); d = d.AddDate(0, 0, 1) {
+		if a.WorkingDays.Includes(d.Weekday()) && other.WorkingDays.Includes(d.Weekday()) {
+			return true
+		}
+	}
+	return false
+}
+
+// SharesShiftTime reports whether two assignments' shift times overlap. An
+// assignment without shift times covers the whole day. Shifts are half-open,
+// so one ending at 14:00 does not clash with one starting at 14:00.
+func (a *Assignment) SharesShiftTime(other *Assignment) bool {
+	if a.ShiftStart == nil || a.ShiftEnd == nil || other.ShiftStart == nil || other.ShiftEnd == nil {
+		return true
+	}
+	return *a.ShiftStart < *other.ShiftEnd && *other.ShiftStart < *a.ShiftEnd
+}
+
+// ConflictsWith applies the conflict rules findConflicts runs in SQL to two
+// assignments, ignoring their status: they clash when they hold the same
+// bus/role slot, put one staff member on two buses, or give one staff member
+// two roles on a bus without dual roles, on a shared working day and shift.
+func (a *Assignment) ConflictsWith(other *Assignment) bool {
+	sameSlot := a.BusID == other.BusID && a.Role == other.Role
+	staffElsewhere := a.StaffID == other.StaffID && a.BusID != other.BusID
+	dualRole := a.StaffID == other.StaffID && a.BusID == other.BusID && !(a.DualRoleAllowed || other.DualRoleAllowed)
+	return (sameSlot || staffElsewhere || dualRole) && a.SharesWorkingDay(other) && a.SharesShiftTime(other)
+}
+
+// bits expands the every-day zero value into explicit weekday bits.
+func (m DayMask) bits() DayMask {
+	if m == 0 {
+		return allDays
+	}
+	return m
+}
+
+func truncateDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
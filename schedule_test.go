@@ -0,0 +1,117 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseDayMask(t *testing.T) {
+	tests := []struct {
+		days    []string
+		want    []string
+		wantErr bool
+	}{
+		{[]string{"mon", "Wednesday", " FRI "}, []string{"mon", "wed", "fri"}, false},
+		{[]string{"sun", "saturday"}, []string{"sun", "sat"}, false},
+		{nil, nil, false},
+		{[]string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}, nil, false}, // the whole week is every day
+		{[]string{"monkey"}, nil, true},
+		{[]string{"sunshine"}, nil, true},
+		{[]string{"wedge"}, nil, true},
+		{[]string{"mo"}, nil, true},
+		{[]string{"tues"}, nil, true},
+	}
+	for _, tt := range tests {
+		mask, err := ParseDayMask(tt.days)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDayMask(%q) error = %v, want error %v", tt.days, err, tt.wantErr)
+			continue
+		}
+		if got := mask.Days(); !slices.Equal(got, tt.want) {
+			t.Errorf("ParseDayMask(%q) = %v, want %v", tt.days, got, tt.want)
+		}
+	}
+}
+
+func TestWorksOn(t *testing.T) {
+	weekdays, _ := ParseDayMask([]string{"mon", "wed", "fri"})
+	end := date("2025-03-14")
+	split := Assignment{StartDate: date("2025-03-05"), EndDate: &end, WorkingDays: weekdays}
+	tests := []struct {
+		day  string
+		want bool
+	}{
+		{"2025-03-03", false}, // a Monday before the start
+		{"2025-03-05", true},  // the first Wednesday
+		{"2025-03-06", false}, // Thursday isn't a working day
+		{"2025-03-14", true},  // the last Friday
+		{"2025-03-17", false}, // a Monday after the end
+	}
+	for _, tt := range tests {
+		if got := split.WorksOn(date(tt.day)); got != tt.want {
+			t.Errorf("WorksOn(%s) = %v, want %v", tt.day, got, tt.want)
+		}
+	}
+
+	everyDay := Assignment{StartDate: date("2025-03-05")}
+	if !everyDay.WorksOn(date("2025-03-08").Add(15 * time.Hour)) {
+		t.Error("open-ended assignment without a mask isn't worked on a Saturday afternoon")
+	}
+}
+
+func TestSharesWorkingDay(t *testing.T) {
+	mask := func(days ...string) DayMask {
+		t.Helper()
+		m, err := ParseDayMask(days)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	endOn := func(day string) *time.Time {
+		end := date(day)
+		return &end
+	}
+	tests := []struct {
+		name string
+		a, b Assignment
+		want bool
+	}{
+		{"disjoint masks over months", Assignment{StartDate: date("2025-01-01"), WorkingDays: mask("mon", "wed", "fri")},
+			Assignment{StartDate: date("2025-02-01"), WorkingDays: mask("tue", "thu")}, false},
+		{"shared day over months", Assignment{StartDate: date("2025-01-01"), WorkingDays: mask("mon", "wed")},
+			Assignment{StartDate: date("2025-02-01"), WorkingDays: mask("wed")}, true},
+		{"every day against a mask", Assignment{StartDate: date("2025-01-01")},
+			Assignment{StartDate: date("2025-01-01"), WorkingDays: mask("sat")}, true},
+		// The ranges overlap on Tue 4 to Thu 6 March only, which holds no Monday
+		{"short overlap missing the shared weekday",
+			Assignment{StartDate: date("2025-03-01"), EndDate: endOn("2025-03-06"), WorkingDays: mask("mon", "thu")},
+			Assignment{StartDate: date("2025-03-04"), EndDate: endOn("2025-03-09"), WorkingDays: mask("mon")}, false},
+		{"short overlap on the shared weekday",
+			Assignment{StartDate: date("2025-03-01"), EndDate: endOn("2025-03-06"), WorkingDays: mask("mon", "thu")},
+			Assignment{StartDate: date("2025-03-04"), EndDate: endOn("2025-03-09"), WorkingDays: mask("thu")}, true},
+		{"ranges apart", Assignment{StartDate: date("2025-03-01"), EndDate: endOn("2025-03-02")},
+			Assignment{StartDate: date("2025-03-03")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.SharesWorkingDay(&tt.b); got != tt.want {
+				t.Errorf("a.SharesWorkingDay(b) = %v, want %v", got, tt.want)
+			}
+			if got := tt.b.SharesWorkingDay(&tt.a); got != tt.want {
+				t.Errorf("b.SharesWorkingDay(a) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShiftLength(t *testing.T) {
+	start, end := TimeOfDay(6*60), TimeOfDay(13*60+30)
+	if got := (&Assignment{ShiftStart: &start, ShiftEnd: &end}).ShiftLength(); got != 7*time.Hour+30*time.Minute {
+		t.Errorf("ShiftLength = %v, want 7h30m", got)
+	}
+	if got := (&Assignment{}).ShiftLength(); got != standardShift {
+		t.Errorf("ShiftLength without shift times = %v, want the standard %v", got, standardShift)
+	}
+}
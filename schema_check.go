@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// SchemaDriftAction is what startup does when the live schema doesn't match
+// the migrations embedded in this build
+type SchemaDriftAction string
+
+const (
+	DriftFail     SchemaDriftAction = "fail"      // refuse to start
+	DriftReadOnly SchemaDriftAction = "read-only" // serve reads with maintenance mode on
+	DriftWarn     SchemaDriftAction = "warn"      // log the drift and serve normally
+)
+
+// schemaDriftMessage is returned with 503 responses while serving read-only
+// because of drift
+const schemaDriftMessage = "The database schema does not match this release; changes are disabled until it is repaired"
+
+// expectedTable lists the columns the service reads or writes in one table
+type expectedTable struct {
+	Name    string
+	Columns []string
+}
+
+// expectedSchema is the schema the embedded migrations produce. Keep it in
+// step with new migrations; TestExpectedSchemaCoversMigrations catches
+// indexes and columns that were added without updating it.
+var expectedSchema = []expectedTable{
+	{"assignments", []string{"id", "public_id", "reference", "external_ref", "bus_id", "staff_id", "role",
+		"start_date", "end_date", "shift_start", "shift_end", "working_days", "dual_role_allowed", "clearance_label",
+		"status", "version", "created_at", "updated_at", "deleted_at", "depot_id", "notes"}},
+	{"assignment_audit", []string{"id", "assignment_id", "assignment_public_id", "action", "actor", "changed_at",
+		"before", "after", "client_ip"}},
+	{"assignment_outbox", []string{"id", "event_type", "assignment_id", "actor", "payload", "created_at",
+		"published_at", "attempts", "last_error"}},
+	{"open_shifts", []string{"id", "bus_id", "role", "start_date", "end_date", "working_days", "award_policy",
+		"bidding_closes_at", "status", "awarded_staff_id", "assignment_id", "created_by", "created_at",
+		"updated_at", "mode", "requires_confirmation", "config_key"}},
+	{"shift_bids", []string{"id", "shift_id", "staff_id", "status", "created_at"}},
+	{"saved_views", []string{"id", "owner", "name", "filter", "created_at", "updated_at"}},
+	{"staff_availability", []string{"id", "staff_id", "type", "start_date", "end_date", "note", "created_by",
+		"created_at", "updated_at"}},
+	{"deletion_holds", []string{"id", "resource", "resource_id", "cascade_cancel", "status", "requested_by",
+		"expires_at", "created_at", "updated_at"}},
+	{"roster_publications", []string{"id", "period_from", "period_to", "status", "previous_id", "days", "steps",
+		"published_by", "created_at", "updated_at"}},
+	{"depot_calendars", []string{"depot", "days", "holidays", "updated_at"}},
+	{"scenarios", []string{"id", "name", "period_from", "period_to", "status", "assignments", "removed", "version",
+		"created_by", "created_at", "updated_at", "depot_id"}},
+	{"staff_qualifications", []string{"staff_id", "class", "license_number", "expires_on", "updated_by",
+		"updated_at"}},
+	{"staff_notification_channels", []string{"staff_id", "email", "webhook_url", "updated_at"}},
+	{"notifications", []string{"id", "staff_id", "channel", "recipient", "event_type", "assignment_id", "subject",
+		"body", "status", "attempts", "next_attempt_at", "last_error", "created_at", "sent_at"}},
+	{"warehouse_watermarks", []string{"stream", "watermark_at", "watermark_id", "updated_at"}},
+	{"idempotency_keys", []string{"actor", "idempotency_key", "request_hash", "status", "content_type", "body",
+		"created_at", "expires_at"}},
+	{"export_jobs", []string{"id", "format", "filter", "include_deleted", "clearances", "requested_by", "callback_url",
+		"status", "error", "artifact_key", "rows", "size", "created_at", "started_at", "finished_at", "expires_at",
+		"callback_attempts", "callback_sent_at", "snapshot_at", "depot_id"}},
+	{"assignment_attachments", []string{"id", "assignment_id", "filename", "content_type", "size", "uploaded_by",
+		"created_at"}},
+	{"recurring_assignment_templates", []string{"id", "bus_id", "staff_id", "role", "working_days", "shift_start",
+		"shift_end", "valid_from", "valid_until", "generated_through", "created_by", "created_at", "updated_at"}},
+	{"callback_keys", []string{"id", "name", "secret", "created_by", "created_at", "last_used_at", "revoked_at"}},
+	{"callback_nonces", []string{"key_id", "nonce", "expires_at"}},
+	{"rule_modes", []string{"rule", "mode", "shadow_until", "updated_at"}},
+}
+
+// expectedIndexes are the named indexes the migrations create, including the
+// unique ones that keep duplicate rosters and references out
+var expectedIndexes = []string{
+	"idx_assignments_bus_id",
+	"idx_assignments_staff_id",
+	"idx_assignments_status",
+	"idx_assignments_start_date",
+	"idx_assignments_unique_slot",
+	"idx_assignments_reference",
+	"idx_assignments_external_ref",
+	"idx_assignments_public_id",
+	"idx_assignment_audit_assignment_id",
+	"idx_assignment_audit_changed_at",
+	"idx_assignment_audit_public_id",
+	"idx_assignment_outbox_pending",
+	"idx_open_shifts_closing",
+	"idx_open_shifts_awarded_staff",
+	"idx_open_shifts_claimable",
+	"idx_open_shifts_config_key",
+	"idx_staff_availability_staff_dates",
+	"idx_deletion_holds_resource",
+	"idx_roster_publications_in_flight",
+	"idx_roster_publications_published",
+	"idx_notifications_due",
+	"idx_notifications_staff",
+	"idx_assignments_updated_at",
+	"idx_idempotency_keys_expires",
+	"idx_export_jobs_waiting",
+	"idx_export_jobs_requester",
+	"idx_assignments_depot_id",
+	"idx_assignment_attachments_assignment_id",
+	"idx_callback_nonces_expires",
+	"idx_assignment_audit_bus_id",
+	"idx_assignment_audit_staff_id",
+}
+
+// expectedConstraints are the named check constraints the migrations add
+var expectedConstraints = []string{
+	"assignments_shift_times_check",
+	"open_shifts_status_check",
+	"assignment_audit_action_check",
+	"recurring_assignment_templates_shift_times_check",
+}
+
+// liveSchema is what the connected database actually contains
+type liveSchema struct {
+	Migrations  map[int]string             // applied version → name
+	Columns     map[string]map[string]bool // table → columns
+	Indexes     map[string]bool
+	Constraints map[string]bool
+}
+
+// LoadSchemaDriftAction reads SCHEMA_DRIFT_ACTION (fail, read-only or warn;
+// default fail)
+func LoadSchemaDriftAction() SchemaDriftAction {
+	value := os.Getenv("SCHEMA_DRIFT_ACTION")
+	switch action := SchemaDriftAction(value); action {
+	case DriftFail, DriftReadOnly, DriftWarn:
+		return action
+	case "":
+		return DriftFail
+	default:
+		log.Printf("Invalid SCHEMA_DRIFT_ACTION %q, using %s", value, DriftFail)
+		return DriftFail
+	}
+}
+
+// CheckSchema compares the connected database with the embedded migrations
+// and the objects they create. It returns one line per drifted object, or
+// none when the schema matches.
+func CheckSchema(ctx context.Context) ([]string, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	live, err := inspectSchema(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("inspecting database schema: %w", err)
+	}
+	return diffSchema(migrations, live), nil
+}
+
+// inspectSchema reads the applied migrations, columns, indexes and
+// constraints of the current schema
+func inspectSchema(ctx context.Context) (liveSchema, error) {
+	live := liveSchema{
+		Migrations:  map[int]string{},
+		Columns:     map[string]map[string]bool{},
+		Indexes:     map[string]bool{},
+		Constraints: map[string]bool{},
+	}
+
+	var hasMigrations bool
+	if err := db.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&hasMigrations); err != nil {
+		return live, err
+	}
+	if hasMigrations {
+		rows, err := db.Query(ctx, `SELECT version, name FROM schema_migrations`)
+		if err != nil {
+			return live, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var version int
+			var name string
+			if err := rows.Scan(&version, &name); err != nil {
+				return live, err
+			}
+			live.Migrations[version] = name
+		}
+		if err := rows.Err(); err != nil {
+			return live, err
+		}
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT table_name, column_name FROM information_schema.columns
+		WHERE table_schema = current_schema()
+	`)
+	if err != nil {
+		return live, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, column string
+		if err := rows.Scan(&table, &column); err != nil {
+			return live, err
+		}
+		if live.Columns[table] == nil {
+			live.Columns[table] = map[string]bool{}
+		}
+		live.Columns[table][column] = true
+	}
+	if err := rows.Err(); err != nil {
+		return live, err
+	}
+
+	if err := collectNames(ctx, live.Indexes,
+		`SELECT indexname FROM pg_indexes WHERE schemaname = current_schema()`); err != nil {
+		return live, err
+	}
+	err = collectNames(ctx, live.Constraints, `
+		SELECT c.conname FROM pg_constraint c
+		JOIN pg_namespace n ON n.oid = c.connamespace
+		WHERE n.nspname = current_schema()
+	`)
+	return live, err
+}
+
+// collectNames adds every name returned by a single-column query to names
+func collectNames(ctx context.Context, names map[string]bool, query string) error {
+	rows, err := db.Query(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		names[name] = true
+	}
+	return rows.Err()
+}
+
+// diffSchema lists what differs between the embedded migrations and the live
+// schema. A missing table is reported once rather than column by column.
+func diffSchema(migrations []Migration, live liveSchema) []string {
+	var drift []string
+
+	known := map[int]bool{}
+	for _, migration := range migrations {
+		known[migration.Version] = true
+		name, applied := live.Migrations[migration.Version]
+		switch {
+		case !applied:
+			drift = append(drift, fmt.Sprintf("migration %04d_%s has not been applied", migration.Version, migration.Name))
+		case name != migration.Name:
+			drift = append(drift, fmt.Sprintf("migration %04d was applied as %q, expected %q", migration.Version, name, migration.Name))
+		}
+	}
+	var unknown []int
+	for version := range live.Migrations {
+		if !known[version] {
+			unknown = append(unknown, version)
+		}
+	}
+	sort.Ints(unknown)
+	for _, version := range unknown {
+		drift = append(drift, fmt.Sprintf("migration %04d_%s is applied but unknown to this build", version, live.Migrations[version]))
+	}
+
+	for _, table := range expectedSchema {
+		columns, exists := live.Columns[table.Name]
+		if !exists {
+			drift = append(drift, fmt.Sprintf("table %s is missing", table.Name))
+			continue
+		}
+		for _, column := range table.Columns {
+			if !columns[column] {
+				drift = append(drift, fmt.Sprintf("column %s.%s is missing", table.Name, column))
+			}
+		}
+	}
+	for _, index := range expectedIndexes {
+		if !live.Indexes[index] {
+			drift = append(drift, fmt.Sprintf("index %s is missing", index))
+		}
+	}
+	for _, constraint := range expectedConstraints {
+		if !live.Constraints[constraint] {
+			drift = append(drift, fmt.Sprintf("constraint %s is missing", constraint))
+		}
+	}
+	return drift
+}
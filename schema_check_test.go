@@ -0,0 +1,122 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+// matchingSchema returns a live schema that exactly matches the embedded migrations
+func matchingSchema(t *testing.T, migrations []Migration) liveSchema {
+	t.Helper()
+	live := liveSchema{
+		Migrations:  map[int]string{},
+		Columns:     map[string]map[string]bool{},
+		Indexes:     map[string]bool{},
+		Constraints: map[string]bool{},
+	}
+	for _, migration := range migrations {
+		live.Migrations[migration.Version] = migration.Name
+	}
+	for _, table := range expectedSchema {
+		live.Columns[table.Name] = map[string]bool{}
+		for _, column := range table.Columns {
+			live.Columns[table.Name][column] = true
+		}
+	}
+	for _, index := range expectedIndexes {
+		live.Indexes[index] = true
+	}
+	for _, constraint := range expectedConstraints {
+		live.Constraints[constraint] = true
+	}
+	return live
+}
+
+func TestDiffSchema(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+
+	if drift := diffSchema(migrations, matchingSchema(t, migrations)); len(drift) != 0 {
+		t.Errorf("drift = %v, want none for a matching schema", drift)
+	}
+
+	// A half-applied 0014: recorded as applied under another name, with its
+	// column and index missing and a later migration from a newer build
+	live := matchingSchema(t, migrations)
+	live.Migrations[14] = "add_public_ids"
+	live.Migrations[99] = "from_the_future"
+	delete(live.Migrations, 13)
+	delete(live.Columns["assignments"], "public_id")
+	delete(live.Columns, "saved_views")
+	delete(live.Indexes, "idx_assignments_public_id")
+	delete(live.Constraints, "open_shifts_status_check")
+
+	want := []string{
+		"migration 0013_add_assignment_version has not been applied",
+		`migration 0014 was applied as "add_public_ids", expected "add_assignment_public_ids"`,
+		"migration 0099_from_the_future is applied but unknown to this build",
+		"column assignments.public_id is missing",
+		"table saved_views is missing",
+		"index idx_assignments_public_id is missing",
+		"constraint open_shifts_status_check is missing",
+	}
+	if drift := diffSchema(migrations, live); !slices.Equal(drift, want) {
+		t.Errorf("drift =\n%q\nwant\n%q", drift, want)
+	}
+}
+
+func TestExpectedSchemaCoversMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+
+	columns := map[string]bool{}
+	for _, table := range expectedSchema {
+		for _, column := range table.Columns {
+			columns[table.Name+"."+column] = true
+		}
+	}
+
+	createIndex := regexp.MustCompile(`(?i)CREATE (?:UNIQUE )?INDEX IF NOT EXISTS (\w+)`)
+	addConstraint := regexp.MustCompile(`(?i)ADD CONSTRAINT (\w+)`)
+	alterTable := regexp.MustCompile(`(?is)ALTER TABLE (\w+)((?:\s+ADD COLUMN IF NOT EXISTS \w+[^,;]*,?)+);`)
+	addColumn := regexp.MustCompile(`(?i)ADD COLUMN IF NOT EXISTS (\w+)`)
+	for _, migration := range migrations {
+		for _, match := range createIndex.FindAllStringSubmatch(migration.SQL, -1) {
+			if !slices.Contains(expectedIndexes, match[1]) {
+				t.Errorf("migration %04d creates index %s missing from expectedIndexes", migration.Version, match[1])
+			}
+		}
+		for _, match := range addConstraint.FindAllStringSubmatch(migration.SQL, -1) {
+			if !slices.Contains(expectedConstraints, match[1]) {
+				t.Errorf("migration %04d adds constraint %s missing from expectedConstraints", migration.Version, match[1])
+			}
+		}
+		for _, alter := range alterTable.FindAllStringSubmatch(migration.SQL, -1) {
+			for _, match := range addColumn.FindAllStringSubmatch(alter[2], -1) {
+				if !columns[alter[1]+"."+match[1]] {
+					t.Errorf("migration %04d adds column %s.%s missing from expectedSchema", migration.Version, alter[1], match[1])
+				}
+			}
+		}
+	}
+}
+
+func TestLoadSchemaDriftAction(t *testing.T) {
+	tests := map[string]SchemaDriftAction{
+		"":          DriftFail,
+		"read-only": DriftReadOnly,
+		"warn":      DriftWarn,
+		"ignore":    DriftFail,
+	}
+	for value, want := range tests {
+		t.Setenv("SCHEMA_DRIFT_ACTION", value)
+		if got := LoadSchemaDriftAction(); got != want {
+			t.Errorf("LoadSchemaDriftAction() with %q = %s, want %s", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServerConfig holds the HTTP server's timeouts
+type ServerConfig struct {
+	ReadTimeout       time.Duration // whole request, including uploads
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration // from the end of the request headers to the end of the response
+	IdleTimeout       time.Duration // keep-alive connections between requests
+	ShutdownTimeout   time.Duration // how long in-flight requests may take to drain
+	DrainDelay        time.Duration // how long to keep serving after readiness starts failing
+}
+
+// LoadServerConfig reads HTTP_READ_TIMEOUT (default 30s),
+// HTTP_READ_HEADER_TIMEOUT (10s), HTTP_WRITE_TIMEOUT (60s), HTTP_IDLE_TIMEOUT
+// (120s), SHUTDOWN_TIMEOUT (25s, inside Kubernetes' default 30s grace period)
+// and DRAIN_DELAY (none)
+func LoadServerConfig() ServerConfig {
+	return ServerConfig{
+		ReadTimeout:       durationFromEnv("HTTP_READ_TIMEOUT", 30*time.Second),
+		ReadHeaderTimeout: durationFromEnv("HTTP_READ_HEADER_TIMEOUT", 10*time.Second),
+		WriteTimeout:      durationFromEnv("HTTP_WRITE_TIMEOUT", 60*time.Second),
+		IdleTimeout:       durationFromEnv("HTTP_IDLE_TIMEOUT", 120*time.Second),
+		ShutdownTimeout:   durationFromEnv("SHUTDOWN_TIMEOUT", 25*time.Second),
+		DrainDelay:        durationFromEnv("DRAIN_DELAY", 0),
+	}
+}
+
+// durationFromEnv parses a positive duration such as 30s, falling back to the
+// default when the variable is unset or invalid
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		log.Printf("Invalid %s %q, using %s", key, value, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// newHTTPServer wraps the handler in a server with the configured timeouts
+func newHTTPServer(handler http.Handler, config ServerConfig) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadTimeout:       config.ReadTimeout,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+}
+
+// serve accepts requests on the listener until ctx is cancelled. It then
+// fails readiness and keeps serving for drainDelay, while load balancers stop
+// sending it requests, before it stops accepting new connections and waits up
+// to shutdownTimeout for in-flight requests to finish and closes the rest. It
+// returns once the server has stopped, with an error only if serving failed.
+func serve(ctx context.Context, server *http.Server, listener net.Listener,
+	drainDelay, shutdownTimeout time.Duration) error {
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	lifecycle.Draining()
+	if drainDelay > 0 {
+		// Clients on kept-alive connections are told to reconnect, which
+		// takes them to another instance
+		log.Printf("Shutting down, serving for %s more while load balancers stop routing here", drainDelay)
+		server.SetKeepAlivesEnabled(false)
+		select {
+		case err := <-served:
+			return err
+		case <-time.After(drainDelay):
+		}
+	}
+
+	log.Printf("Shutting down, draining in-flight requests for up to %s", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Requests still running after %s were cut off: %v", shutdownTimeout, err)
+		server.Close()
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// requestTimeout is how long a request may run before its database queries are
+// cancelled; main reads it from REQUEST_TIMEOUT
+var requestTimeout = 30 * time.Second
+
+// limitRequestTime puts a deadline on each request's context, which the
+// handlers' queries run under, so a slow query stops once the client would
+// have given up. Event streams are meant to stay open and are left alone.
+func limitRequestTime() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasSuffix(c.FullPath(), "/stream") {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), requestTimeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
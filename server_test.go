@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	useTestLifecycle(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- serve(ctx, newHTTPServer(handler, LoadServerConfig()), listener, 0, 5*time.Second)
+	}()
+
+	type response struct {
+		body string
+		err  error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			responses <- response{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- response{string(body), err}
+	}()
+
+	<-started
+	cancel()
+	select {
+	case err := <-stopped:
+		t.Fatalf("serve returned %v before the in-flight request finished", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if got := <-responses; got.err != nil || got.body != "done" {
+		t.Errorf("in-flight response = %q, %v, want it to complete", got.body, got.err)
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("serve = %v, want nil after a clean drain", err)
+	}
+	if _, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+		t.Error("server still accepts connections after shutdown")
+	}
+}
+
+func TestServeKeepsServingThroughDrainDelay(t *testing.T) {
+	states := useTestLifecycle(t)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "ok") })
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- serve(ctx, newHTTPServer(handler, LoadServerConfig()), listener, 200*time.Millisecond, time.Second)
+	}()
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for states.State() != LifecycleDraining && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if state := states.State(); state != LifecycleDraining {
+		t.Fatalf("state = %s after the signal, want draining", state)
+	}
+
+	resp, err := http.Get("http://" + listener.Addr().String())
+	if err != nil {
+		t.Fatalf("request during the drain delay failed: %v", err)
+	}
+	resp.Body.Close()
+	if !resp.Close {
+		t.Error("keep-alive still offered while draining")
+	}
+
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("serve = %v, want nil", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("serve didn't stop after the drain delay")
+	}
+}
+
+func TestLoadServerConfig(t *testing.T) {
+	t.Setenv("HTTP_WRITE_TIMEOUT", "2m")
+	t.Setenv("SHUTDOWN_TIMEOUT", "soon")
+
+	config := LoadServerConfig()
+	if config.WriteTimeout != 2*time.Minute {
+		t.Errorf("WriteTimeout = %s, want 2m", config.WriteTimeout)
+	}
+	if config.ShutdownTimeout != 25*time.Second {
+		t.Errorf("ShutdownTimeout = %s, want the 25s default for an invalid value", config.ShutdownTimeout)
+	}
+	if config.DrainDelay != 0 {
+		t.Errorf("DrainDelay = %s, want none by default", config.DrainDelay)
+	}
+	if config.ReadTimeout != 30*time.Second {
+		t.Errorf("ReadTimeout = %s, want the 30s default", config.ReadTimeout)
+	}
+}
+
+func TestLimitRequestTime(t *testing.T) {
+	router := gin.New()
+	router.Use(limitRequestTime())
+	deadlines := map[string]bool{}
+	record := func(c *gin.Context) {
+		_, ok := c.Request.Context().Deadline()
+		deadlines[c.FullPath()] = ok
+	}
+	router.GET("/api/v1/assignments", record)
+	router.GET("/api/v1/assignments/stream", record)
+
+	for _, path := range []string{"/api/v1/assignments", "/api/v1/assignments/stream"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	if !deadlines["/api/v1/assignments"] {
+		t.Error("listing ran without a deadline")
+	}
+	if deadlines["/api/v1/assignments/stream"] {
+		t.Error("stream was given a deadline")
+	}
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Award policies deciding which bidder wins a shift
+const (
+	AwardPolicySeniority = "seniority" // longest-serving eligible bidder
+	AwardPolicyFairness  = "fairness"  // bidder awarded the fewest shifts recently
+)
+
+// How staff take up an open shift
+const (
+	ShiftModeBid   = "bid"   // bids are collected and awarded when bidding closes
+	ShiftModeClaim = "claim" // the first eligible staff member to claim it gets it
+)
+
+// OpenShift is an unassigned bus/role slot offered to staff
+type OpenShift struct {
+	ID                   int        `json:"id"`
+	BusID                int        `json:"bus_id"`
+	Role                 string     `json:"role"`
+	StartDate            time.Time  `json:"start_date"`
+	EndDate              *time.Time `json:"end_date,omitempty"`
+	WorkingDays          DayMask    `json:"working_days,omitempty"`
+	Mode                 string     `json:"mode"`
+	RequiresConfirmation bool       `json:"requires_confirmation"`
+	AwardPolicy          string     `json:"award_policy"`
+	BiddingClosesAt      time.Time  `json:"bidding_closes_at"`
+	Status               string     `json:"status"`                     // open, claimed, awarded, unfilled, cancelled
+	AwardedStaffID       *int       `json:"awarded_staff_id,omitempty"` // the claimant while a claim awaits confirmation
+	AssignmentID         *int       `json:"-"`
+	AssignmentPublicID   *string    `json:"assignment_id,omitempty"` // public ID of the awarded assignment
+	Name                 *string    `json:"name,omitempty"`          // stable key of a shift declared through /api/config
+	CreatedBy            string     `json:"created_by"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
+
+// ShiftBid is a staff member's bid for an open shift
+type ShiftBid struct {
+	ID        int       `json:"id"`
+	ShiftID   int       `json:"shift_id"`
+	StaffID   int       `json:"staff_id"`
+	Status    string    `json:"status"` // pending, won, lost, withdrawn
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateShiftRequest opens a shift for bidding or claiming
+type CreateShiftRequest struct {
+	BusID                int        `json:"bus_id" binding:"required"`
+	Role                 string     `json:"role" binding:"required"`
+	StartDate            string     `json:"start_date" binding:"required"` // YYYY-MM-DD format
+	EndDate              string     `json:"end_date,omitempty"`
+	WorkingDays          DayMask    `json:"working_days,omitempty"`
+	Mode                 string     `json:"mode,omitempty"`         // bid (default) or claim
+	AwardPolicy          string     `json:"award_policy,omitempty"` // defaults to SHIFT_AWARD_POLICY
+	RequiresConfirmation bool       `json:"requires_confirmation,omitempty"`
+	BiddingClosesAt      *time.Time `json:"bidding_closes_at,omitempty"` // required for bid mode; claims default to closing at the shift start
+}
+
+// PlaceBidRequest lets a dispatcher bid on a staff member's behalf; staff
+// callers always bid as the staff member in their token
+type PlaceBidRequest struct {
+	StaffID int `json:"staff_id,omitempty"`
+}
+
+var errDuplicateBid = errors.New("staff member has already bid on this shift")
+
+// assignment builds the assignment a shift becomes once awarded
+func (s *OpenShift) assignment(staffID int) Assignment {
+	return Assignment{
+		BusID:       s.BusID,
+		StaffID:     staffID,
+		Role:        s.Role,
+		StartDate:   s.StartDate,
+		EndDate:     s.EndDate,
+		WorkingDays: s.WorkingDays,
+		Status:      "active",
+	}
+}
+
+// defaultAwardPolicy reads SHIFT_AWARD_POLICY, falling back to seniority
+func defaultAwardPolicy() string {
+	if policy := os.Getenv("SHIFT_AWARD_POLICY"); policy == AwardPolicyFairness {
+		return policy
+	}
+	return AwardPolicySeniority
+}
+
+// staffEligibleForRole checks the staff directory position against the role.
+// Staff missing from the directory are not rejected.
+func staffEligibleForRole(staffID int, role string) bool {
+	if staff, exists := mockStaff[staffID]; exists {
+		return staff["position"] == role
+	}
+	return true
+}
+
+// ShiftRepository stores open shifts and the bids on them. Taking a shift up
+// creates its assignment through the assignment repository the shifts are
+// stored with, all or nothing with the shift's own change.
+type ShiftRepository interface {
+	Create(shift *OpenShift) error
+	Get(id int) (*OpenShift, error)                                           // nil, nil when not found
+	List(status string) ([]OpenShift, error)                                  // every status for "", soonest closing first
+	ListClaimable(role string, busID int, now time.Time) ([]OpenShift, error) // claim-mode shifts open at now, soonest starting first
+	PlaceBid(shiftID, staffID int) (*ShiftBid, error)                         // errDuplicateBid unless new or withdrawn
+	WithdrawBid(shiftID, staffID int) (bool, error)                           // false when no bid is pending
+	ListBids(shiftID int) ([]ShiftBid, error)                                 // in the order they were placed
+
+	// Taking shifts up. Claims held for confirmation return no assignment;
+	// refusals are errShiftNotClaimable, errNoPendingClaim, ConflictError,
+	// DeletionHoldError or the check's. Awarding skips bidders the check
+	// refuses.
+	Claim(shiftID, staffID int, actor string, now time.Time, check takeUpCheck) (*OpenShift, *Assignment, error)
+	ConfirmClaim(shiftID int, actor string, check takeUpCheck) (*OpenShift, *Assignment, error)
+	RejectClaim(shiftID int) (*OpenShift, error)
+	DueForAward(now time.Time) ([]int, error)                 // open shifts whose bidding has closed, soonest closed first
+	Award(shiftID int, check takeUpCheck) (*OpenShift, error) // nil, nil when the shift is no longer open
+
+	// Shifts declared by name through /config. PutDeclared creates or updates
+	// the shift, reporting whether anything was written; a definition that
+	// already matches changes nothing, even once bidding has closed. Changes
+	// are refused with errBiddingClosed, or errShiftSpecLocked once staff have
+	// bid on, claimed or been awarded the shift. DeleteDeclared cancels an open
+	// shift, marks its pending bids lost and frees the name, returning nil,
+	// nil when nothing was declared under it.
+	GetDeclared(name string) (*OpenShift, error) // nil, nil when nothing is declared under the name
+	ListDeclared() ([]OpenShift, error)          // ordered by name
+	PutDeclared(name string, shift *OpenShift, now time.Time) (created, changed bool, err error)
+	DeleteDeclared(name string) (*OpenShift, error)
+
+	// WithContext returns the repository running its queries under ctx
+	WithContext(ctx context.Context) ShiftRepository
+}
+
+// Open shift handlers
+
+// ShiftHandler serves the open shift, bidding and marketplace endpoints
+type ShiftHandler struct {
+	shifts         ShiftRepository
+	assignments    AssignmentRepository
+	availability   AvailabilityRepository
+	qualifications QualificationRepository
+}
+
+// NewShiftHandler creates a handler storing shifts in the given repository.
+// Bidders are checked for conflicts against the assignments, and claimants
+// against their availability and qualifications too.
+func NewShiftHandler(shifts ShiftRepository, assignments AssignmentRepository,
+	availability AvailabilityRepository, qualifications QualificationRepository) *ShiftHandler {
+	return &ShiftHandler{shifts: shifts, assignments: assignments, availability: availability,
+		qualifications: qualifications}
+}
+
+// forRequest returns the handler with its repositories bound to the request's context
+func (h *ShiftHandler) forRequest(c *gin.Context) *ShiftHandler {
+	ctx := c.Request.Context()
+	return &ShiftHandler{shifts: h.shifts.WithContext(ctx), assignments: h.assignments.WithContext(ctx),
+		availability: h.availability.WithContext(ctx), qualifications: h.qualifications.WithContext(ctx)}
+}
+
+// rules checks the request's caller taking up a shift
+func (h *ShiftHandler) rules(c *gin.Context) takeUpCheck {
+	return shiftRules(c.Request.Context(), h.availability, h.qualifications, actorFromContext(c))
+}
+
+// shiftFromParam loads the shift named by the :id path parameter. It returns
+// nil once an error response has been written.
+func (h *ShiftHandler) shiftFromParam(c *gin.Context) *OpenShift {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid shift ID")
+		return nil
+	}
+
+	shift, err := h.shifts.Get(id)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Database error")
+		return nil
+	}
+	if shift == nil {
+		respondError(c, http.StatusNotFound, "Shift not found")
+		return nil
+	}
+	return shift
+}
+
+// bidderStaffID resolves whose bid a request concerns: staff callers act for
+// themselves, dispatchers may name a staff member. Returns 0 after writing an
+// error response.
+func bidderStaffID(c *gin.Context, requested int) int {
+	principal := currentPrincipal(c)
+	if roleRank[principal.Role] >= roleRank[RoleDispatcher] && requested != 0 {
+		return requested
+	}
+	if principal.StaffID == 0 {
+		respondError(c, http.StatusForbidden, "Token does not identify a staff member")
+		return 0
+	}
+	if requested != 0 && requested != principal.StaffID {
+		respondError(c, http.StatusForbidden, "Staff members can only bid for themselves")
+		return 0
+	}
+	return principal.StaffID
+}
+
+// parseShiftRequest validates a shift definition and builds the shift it
+// describes, applying the default mode and award policy. It doesn't check
+// that bidding closes in the future, which only matters when the shift is
+// created or changed. It returns nil once an error response has been written.
+func parseShiftRequest(c *gin.Context, req CreateShiftRequest) *OpenShift {
+	startDate, err := time.Parse("2006-01-02", req.StartDate)
+	if err != nil {
+		respondInvalidField(c, "start_date", "Invalid start_date format. Use YYYY-MM-DD")
+		return nil
+	}
+
+	var endDate *time.Time
+	if req.EndDate != "" {
+		ed, err := time.Parse("2006-01-02", req.EndDate)
+		if err != nil {
+			respondInvalidField(c, "end_date", "Invalid end_date format. Use YYYY-MM-DD")
+			return nil
+		}
+		endDate = &ed
+	}
+
+	mode := req.Mode
+	if mode == "" {
+		mode = ShiftModeBid
+	}
+	if mode != ShiftModeBid && mode != ShiftModeClaim {
+		respondInvalidField(c, "mode", "mode must be 'bid' or 'claim'")
+		return nil
+	}
+
+	policy := req.AwardPolicy
+	if policy == "" {
+		policy = defaultAwardPolicy()
+	}
+	if policy != AwardPolicySeniority && policy != AwardPolicyFairness {
+		respondInvalidField(c, "award_policy", "award_policy must be 'seniority' or 'fairness'")
+		return nil
+	}
+
+	closesAt := startDate
+	if req.BiddingClosesAt != nil {
+		closesAt = *req.BiddingClosesAt
+	} else if mode == ShiftModeBid {
+		respondInvalidField(c, "bidding_closes_at", "bidding_closes_at is required for bid mode")
+		return nil
+	}
+
+	shift := &OpenShift{
+		BusID:                req.BusID,
+		Role:                 req.Role,
+		StartDate:            startDate,
+		EndDate:              endDate,
+		WorkingDays:          req.WorkingDays,
+		Mode:                 mode,
+		RequiresConfirmation: req.RequiresConfirmation,
+		AwardPolicy:          policy,
+		BiddingClosesAt:      closesAt,
+		CreatedBy:            actorFromContext(c),
+	}
+
+	candidate := shift.assignment(0)
+	if fieldErr := validateAssignment(&candidate); fieldErr != nil {
+		respondInvalid(c, *fieldErr)
+		return nil
+	}
+	return shift
+}
+
+func (h *ShiftHandler) handleCreateShift(c *gin.Context) {
+	h = h.forRequest(c)
+	var req CreateShiftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, &req, err)
+		return
+	}
+
+	shift := parseShiftRequest(c, req)
+	if shift == nil || !checkBusDepots(c, shift.BusID) {
+		return
+	}
+	if !shift.BiddingClosesAt.After(clock.Now()) {
+		respondInvalidField(c, "bidding_closes_at", "bidding_closes_at must be in the future")
+		return
+	}
+
+	if err := h.shifts.Create(shift); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to create shift")
+		return
+	}
+
+	c.JSON(http.StatusCreated, shift)
+}
+
+func (h *ShiftHandler) handleGetShifts(c *gin.Context) {
+	h = h.forRequest(c)
+	shifts, err := h.shifts.List(c.Query("status"))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve shifts")
+		return
+	}
+	if shifts == nil {
+		shifts = []OpenShift{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shifts": shifts, "count": len(shifts)})
+}
+
+func (h *ShiftHandler) handleGetShift(c *gin.Context) {
+	h = h.forRequest(c)
+	if shift := h.shiftFromParam(c); shift != nil {
+		c.JSON(http.StatusOK, shift)
+	}
+}
+
+func (h *ShiftHandler) handleGetShiftBids(c *gin.Context) {
+	h = h.forRequest(c)
+	shift := h.shiftFromParam(c)
+	if shift == nil {
+		return
+	}
+
+	bids, err := h.shifts.ListBids(shift.ID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve bids")
+		return
+	}
+	if bids == nil {
+		bids = []ShiftBid{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shift_id": shift.ID, "bids": bids, "count": len(bids)})
+}
+
+func (h *ShiftHandler) handlePlaceBid(c *gin.Context) {
+	h = h.forRequest(c)
+	shift := h.shiftFromParam(c)
+	if shift == nil {
+		return
+	}
+
+	var req PlaceBidRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBindError(c, &req, err)
+		return
+	}
+
+	staffID := bidderStaffID(c, req.StaffID)
+	if staffID == 0 {
+		return
+	}
+
+	if shift.Mode != ShiftModeBid {
+		respondError(c, http.StatusConflict, "This shift is claimed directly, not bid on")
+		return
+	}
+	if shift.Status != "open" || !clock.Now().Before(shift.BiddingClosesAt) {
+		respondError(c, http.StatusConflict, "Bidding for this shift is closed")
+		return
+	}
+	if !staffEligibleForRole(staffID, shift.Role) {
+		respondError(c, http.StatusUnprocessableEntity, "Staff member is not eligible for the "+shift.Role+" role")
+		return
+	}
+
+	// Bidders who are already booked during the shift could never be awarded it
+	candidate := shift.assignment(staffID)
+	conflicts, err := h.assignments.FindConflicts(&candidate)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to check assignment conflicts")
+		return
+	}
+	if len(conflicts) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     newAPIError(http.StatusConflict, "Staff member has conflicting assignments during this shift"),
+			"conflicts": conflicts,
+		})
+		return
+	}
+
+	bid, err := h.shifts.PlaceBid(shift.ID, staffID)
+	if err != nil {
+		if errors.Is(err, errDuplicateBid) {
+			respondError(c, http.StatusConflict, err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Failed to place bid")
+		return
+	}
+
+	c.JSON(http.StatusCreated, bid)
+}
+
+func (h *ShiftHandler) handleWithdrawBid(c *gin.Context) {
+	h = h.forRequest(c)
+	shift := h.shiftFromParam(c)
+	if shift == nil {
+		return
+	}
+
+	var requested int
+	if staffIDStr := c.Query("staff_id"); staffIDStr != "" {
+		var err error
+		if requested, err = strconv.Atoi(staffIDStr); err != nil {
+			respondInvalidField(c, "staff_id", "Invalid staff ID")
+			return
+		}
+	}
+
+	staffID := bidderStaffID(c, requested)
+	if staffID == 0 {
+		return
+	}
+
+	withdrawn, err := h.shifts.WithdrawBid(shift.ID, staffID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to withdraw bid")
+		return
+	}
+	if !withdrawn {
+		respondError(c, http.StatusNotFound, "No pending bid found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Bid withdrawn successfully"})
+}
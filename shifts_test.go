@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newShiftRouter returns a router without authentication over memory
+// storage, with the storage for running the awarder
+func newShiftRouter(t *testing.T) (*gin.Engine, Storage) {
+	t.Helper()
+	store := NewMemoryStorage()
+	router := gin.New()
+	setupRoutes(router, AuthConfig{Disabled: true}, store)
+	return router, store
+}
+
+func TestShiftBidding(t *testing.T) {
+	travel := useTravelClock(t)
+	travel.Set(date("2031-02-01"), true, "test")
+	router, store := newShiftRouter(t)
+
+	rec := doRequest(router, http.MethodPost, "/api/v1/shifts", gin.H{
+		"bus_id": 1, "role": "driver", "start_date": "2031-03-03", "bidding_closes_at": "2031-02-10T00:00:00Z",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create shift = %d %s", rec.Code, rec.Body.String())
+	}
+	shift := decode[OpenShift](t, rec)
+	path := "/api/v1/shifts/" + strconv.Itoa(shift.ID)
+
+	for _, staffID := range []int{3, 1} {
+		if rec := doRequest(router, http.MethodPost, path+"/bids", gin.H{"staff_id": staffID}); rec.Code != http.StatusCreated {
+			t.Fatalf("bid for staff %d = %d %s", staffID, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := doRequest(router, http.MethodPost, path+"/bids", gin.H{"staff_id": 1}); rec.Code != http.StatusConflict {
+		t.Errorf("second bid = %d, want 409", rec.Code)
+	}
+	if rec := doRequest(router, http.MethodPost, path+"/bids", gin.H{"staff_id": 2}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("conductor's bid for a driver shift = %d, want 422", rec.Code)
+	}
+
+	// Staff 1 is senior but booked by the time bidding closes, so staff 3 wins
+	mustCreate(t, store.Assignments, Assignment{BusID: 2, StaffID: 1, Role: "driver", StartDate: date("2031-03-01")})
+	travel.Set(date("2031-02-11"), true, "test")
+	if err := NewShiftAwarder(store.Shifts, store.Availability, store.Qualifications).awardDueShifts(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	awarded := decode[OpenShift](t, doRequest(router, http.MethodGet, path, nil))
+	if awarded.Status != "awarded" || awarded.AwardedStaffID == nil || *awarded.AwardedStaffID != 3 ||
+		awarded.AssignmentPublicID == nil {
+		t.Fatalf("shift = %+v, want it awarded to staff 3", awarded)
+	}
+	bids := decode[struct{ Bids []ShiftBid }](t, doRequest(router, http.MethodGet, path+"/bids", nil)).Bids
+	if len(bids) != 2 || bids[0].Status != "won" || bids[1].Status != "lost" {
+		t.Errorf("bids = %+v, want staff 3's won and staff 1's lost", bids)
+	}
+	if rec := doRequest(router, http.MethodPost, path+"/bids", gin.H{"staff_id": 1}); rec.Code != http.StatusConflict {
+		t.Errorf("bid after closing = %d, want 409", rec.Code)
+	}
+}
+
+func TestShiftBiddingUnfilled(t *testing.T) {
+	travel := useTravelClock(t)
+	travel.Set(date("2031-02-01"), true, "test")
+	router, store := newShiftRouter(t)
+
+	closesAt := date("2031-02-10").Format(time.RFC3339)
+	rec := doRequest(router, http.MethodPost, "/api/v1/shifts", gin.H{
+		"bus_id": 1, "role": "driver", "start_date": "2031-03-03", "bidding_closes_at": closesAt,
+	})
+	shift := decode[OpenShift](t, rec)
+
+	travel.Set(date("2031-02-11"), true, "test")
+	if err := NewShiftAwarder(store.Shifts, store.Availability, store.Qualifications).awardDueShifts(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	got := decode[OpenShift](t, doRequest(router, http.MethodGet, "/api/v1/shifts/"+strconv.Itoa(shift.ID), nil))
+	if got.Status != "unfilled" || got.AwardedStaffID != nil {
+		t.Errorf("shift = %+v, want it unfilled", got)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Storage is every repository the service keeps its data in. A backend
+// provides all of them, and each must pass the conformance suite in
+// storage_conformance_test.go.
+type Storage struct {
+	Assignments    AssignmentRepository
+	Views          ViewRepository
+	Availability   AvailabilityRepository
+	Qualifications QualificationRepository
+	Publications   PublicationRepository
+	Calendars      DepotCalendarRepository
+	Scenarios      ScenarioRepository
+	Notifications  NotificationRepository
+	Idempotency    IdempotencyRepository
+	ExportJobs     ExportJobRepository
+	Attachments    AttachmentRepository
+	Recurring      RecurringTemplateRepository
+	CallbackKeys   CallbackKeyRepository
+	Shifts         ShiftRepository
+	RuleModes      RuleModeRepository
+}
+
+// NewPgxStorage stores everything in PostgreSQL through the given pool
+func NewPgxStorage(pool *pgxpool.Pool) Storage {
+	return Storage{
+		Assignments:    NewPgxAssignmentRepository(pool),
+		Views:          NewPgxViewRepository(pool),
+		Availability:   NewPgxAvailabilityRepository(pool),
+		Qualifications: NewPgxQualificationRepository(pool),
+		Publications:   NewPgxPublicationRepository(pool),
+		Calendars:      NewPgxDepotCalendarRepository(pool),
+		Scenarios:      NewPgxScenarioRepository(pool),
+		Notifications:  NewPgxNotificationRepository(pool),
+		Idempotency:    NewPgxIdempotencyRepository(pool),
+		ExportJobs:     NewPgxExportJobRepository(pool),
+		Attachments:    NewPgxAttachmentRepository(pool),
+		Recurring:      NewPgxRecurringTemplateRepository(pool),
+		CallbackKeys:   NewPgxCallbackKeyRepository(pool),
+		Shifts:         NewPgxShiftRepository(pool),
+		RuleModes:      NewPgxRuleModeRepository(pool),
+	}
+}
+
+// NewMemoryStorage keeps everything in process memory, for tests
+func NewMemoryStorage() Storage {
+	assignments := NewMemoryAssignmentRepository()
+	return Storage{
+		Assignments:    assignments,
+		Views:          NewMemoryViewRepository(),
+		Availability:   NewMemoryAvailabilityRepository(),
+		Qualifications: NewMemoryQualificationRepository(),
+		Publications:   NewMemoryPublicationRepository(),
+		Calendars:      NewMemoryDepotCalendarRepository(),
+		Scenarios:      NewMemoryScenarioRepository(),
+		Notifications:  NewMemoryNotificationRepository(),
+		Idempotency:    NewMemoryIdempotencyRepository(),
+		ExportJobs:     NewMemoryExportJobRepository(),
+		Attachments:    NewMemoryAttachmentRepository(),
+		Recurring:      NewMemoryRecurringTemplateRepository(),
+		CallbackKeys:   NewMemoryCallbackKeyRepository(),
+		Shifts:         NewMemoryShiftRepository(assignments),
+		RuleModes:      NewMemoryRuleModeRepository(),
+	}
+}
+
+// StorageBackend opens a backend's repositories over the connection pool.
+// Backends speak the PostgreSQL wire protocol, as CockroachDB and YugabyteDB
+// do, and differ in the SQL their repositories issue.
+type StorageBackend func(pool *pgxpool.Pool) (Storage, error)
+
+// storageBackends are the backends in this build, by name
+var storageBackends = map[string]StorageBackend{
+	"postgres": func(pool *pgxpool.Pool) (Storage, error) { return NewPgxStorage(pool), nil },
+}
+
+// registerStorageBackend makes a backend selectable by name with
+// STORAGE_BACKEND. Backends outside the default build register themselves
+// from an init function in a file behind their build tag.
+func registerStorageBackend(name string, backend StorageBackend) {
+	if _, ok := storageBackends[name]; ok {
+		panic("storage backend " + name + " registered twice")
+	}
+	storageBackends[name] = backend
+}
+
+// LoadStorage opens the backend selected by STORAGE_BACKEND (default
+// postgres) over the pool
+func LoadStorage(pool *pgxpool.Pool) (Storage, error) {
+	name := strings.ToLower(os.Getenv("STORAGE_BACKEND"))
+	if name == "" {
+		name = "postgres"
+	}
+	backend, ok := storageBackends[name]
+	if !ok {
+		return Storage{}, fmt.Errorf("unsupported STORAGE_BACKEND %q (this build has %s)", name,
+			strings.Join(slices.Sorted(maps.Keys(storageBackends)), ", "))
+	}
+	return backend(pool)
+}
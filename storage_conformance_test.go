@@ -0,0 +1,817 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"bus-staff-assignment/apierror"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// storageConformance checks the contract every storage backend must meet,
+// as the repository interfaces document it. open returns empty storage.
+func storageConformance(t *testing.T, open func(t *testing.T) Storage) {
+	t.Run("assignments", func(t *testing.T) { assignmentConformance(t, open(t).Assignments) })
+	t.Run("assignment moves", func(t *testing.T) { assignmentMoveConformance(t, open(t).Assignments) })
+	t.Run("assignments as of", func(t *testing.T) { asOfConformance(t, open(t).Assignments) })
+	t.Run("views", func(t *testing.T) { viewConformance(t, open(t).Views) })
+	t.Run("availability", func(t *testing.T) { availabilityConformance(t, open(t).Availability) })
+	t.Run("qualifications", func(t *testing.T) { qualificationConformance(t, open(t).Qualifications) })
+	t.Run("calendars", func(t *testing.T) { calendarConformance(t, open(t).Calendars) })
+	t.Run("rule modes", func(t *testing.T) { ruleModeConformance(t, open(t).RuleModes) })
+	t.Run("notification channels", func(t *testing.T) { channelConformance(t, open(t).Notifications) })
+	t.Run("scenarios", func(t *testing.T) { scenarioConformance(t, open(t).Scenarios) })
+	t.Run("publications", func(t *testing.T) { publicationConformance(t, open(t).Publications) })
+	t.Run("idempotency", func(t *testing.T) { idempotencyConformance(t, open(t).Idempotency) })
+	t.Run("export jobs", func(t *testing.T) { exportJobConformance(t, open(t).ExportJobs) })
+	t.Run("attachments", func(t *testing.T) { attachmentConformance(t, open(t)) })
+	t.Run("recurring templates", func(t *testing.T) { recurringConformance(t, open(t).Recurring) })
+	t.Run("callback keys", func(t *testing.T) { callbackKeyConformance(t, open(t).CallbackKeys) })
+	t.Run("shifts", func(t *testing.T) { shiftConformance(t, open(t)) })
+}
+
+func TestMemoryStorageConformance(t *testing.T) {
+	storageConformance(t, func(*testing.T) Storage { return NewMemoryStorage() })
+}
+
+// TestStorageBackendConformance runs the suite against a real database: the
+// one at STORAGE_TEST_DATABASE_URL, through the backend STORAGE_BACKEND names.
+// Every table is emptied first, so never point it at a database in use.
+func TestStorageBackendConformance(t *testing.T) {
+	url := os.Getenv("STORAGE_TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("STORAGE_TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	saved := db
+	db = pool
+	t.Cleanup(func() { db = saved })
+	if err := RunMigrations(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	storageConformance(t, func(t *testing.T) Storage {
+		t.Helper()
+		_, err := pool.Exec(ctx, `TRUNCATE assignments, assignment_audit, assignment_outbox, deletion_holds,
+			saved_views, staff_availability, staff_qualifications, depot_calendars, scenarios, roster_publications,
+			notifications, staff_notification_channels, idempotency_keys, export_jobs, assignment_attachments,
+			recurring_assignment_templates, callback_keys, callback_nonces, open_shifts, shift_bids, rule_modes
+			RESTART IDENTITY CASCADE`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store, err := LoadStorage(pool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
+
+func assignmentConformance(t *testing.T, repo AssignmentRepository) {
+	if missing, err := repo.GetByPublicID("01HZX3M8Q4V6N2B7C9D1E5F0GA", true); missing != nil || err != nil {
+		t.Errorf("missing assignment = %+v, %v; want nil, nil", missing, err)
+	}
+
+	first := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03")})
+	if first.ID == 0 || first.PublicID == "" || first.Reference == "" || first.Version != 1 {
+		t.Errorf("created = %+v, want an ID, public ID, reference and version 1", first)
+	}
+	second := mustCreate(t, repo, Assignment{BusID: 2, StaffID: 2, Role: "driver", StartDate: date("2025-03-04")})
+
+	got, err := repo.Get(first.ID)
+	if err != nil || got == nil || got.PublicID != first.PublicID || !got.StartDate.Equal(first.StartDate) {
+		t.Fatalf("Get = %+v, %v; want the created assignment", got, err)
+	}
+
+	stale := *got
+	got.Role, got.Notes = "conductor", "Covering route 12"
+	if err := repo.Update(got, "tester"); err != nil || got.Version != 2 {
+		t.Fatalf("Update = %v at version %d, want version 2", err, got.Version)
+	}
+	if updated, err := repo.Get(first.ID); err != nil || updated == nil || updated.Notes != "Covering route 12" {
+		t.Errorf("updated Get = %+v, %v; want the notes kept", updated, err)
+	}
+	if err := repo.Update(&stale, "tester"); !errors.Is(err, errStaleVersion) {
+		t.Errorf("Update from version 1 = %v, want errStaleVersion", err)
+	}
+
+	clash := Assignment{BusID: 3, StaffID: 2, Role: "driver", StartDate: date("2025-03-10"), Status: "active"}
+	if conflicts, err := repo.FindConflicts(&clash); err != nil || len(conflicts) != 1 || conflicts[0].ID != second.ID {
+		t.Errorf("FindConflicts = %+v, %v; want the staff member's other assignment", conflicts, err)
+	}
+
+	listed, err := repo.List(AssignmentFilter{Sort: "bus_id"})
+	if err != nil || len(listed) != 2 || listed[0].ID != first.ID {
+		t.Errorf("List by bus = %+v, %v; want both, bus 1 first", listed, err)
+	}
+	if listed, err := repo.List(AssignmentFilter{Role: "conductor"}); err != nil || len(listed) != 1 {
+		t.Errorf("List conductors = %+v, %v; want the updated one", listed, err)
+	}
+
+	if err := repo.Delete(first.ID, 1, "tester"); !errors.Is(err, errStaleVersion) {
+		t.Errorf("Delete at version 1 = %v, want errStaleVersion", err)
+	}
+	if err := repo.Delete(first.ID, 2, "tester"); err != nil {
+		t.Fatal(err)
+	}
+	if gone, err := repo.Get(first.ID); gone != nil || err != nil {
+		t.Errorf("deleted Get = %+v, %v; want nil, nil", gone, err)
+	}
+	deleted, err := repo.GetByPublicID(first.PublicID, true)
+	if err != nil || deleted == nil || deleted.DeletedAt == nil || deleted.Version != 3 {
+		t.Fatalf("deleted GetByPublicID = %+v, %v; want it kept at version 3", deleted, err)
+	}
+	if err := repo.Restore(deleted, "tester"); err != nil || deleted.DeletedAt != nil || deleted.Version != 4 {
+		t.Errorf("Restore = %v, deleted at %v, version %d; want it back at version 4", err, deleted.DeletedAt, deleted.Version)
+	}
+
+	history, err := repo.History(first.PublicID, nil)
+	want := []string{AuditActionCreate, AuditActionUpdate, AuditActionDelete, AuditActionRestore}
+	if err != nil || len(history) != len(want) {
+		t.Fatalf("History = %+v, %v; want %v", history, err, want)
+	}
+	for i, entry := range history {
+		if entry.Action != want[i] {
+			t.Errorf("history[%d] = %s, want %s", i, entry.Action, want[i])
+		}
+	}
+}
+
+func asOfConformance(t *testing.T, repo AssignmentRepository) {
+	end := date("2025-03-09")
+	moved := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03"),
+		EndDate: &end})
+	moved.BusID = 2
+	if err := repo.Update(&moved, "test"); err != nil {
+		t.Fatal(err)
+	}
+	later := mustCreate(t, repo, Assignment{BusID: 2, StaffID: 3, Role: "driver", StartDate: date("2025-04-07")})
+
+	from, to := date("2025-03-01"), date("2025-03-31")
+	tests := []struct {
+		name   string
+		filter AsOfFilter
+		want   []int
+	}{
+		{"every assignment", AsOfFilter{}, []int{moved.ID, later.ID}},
+		{"bus it left", AsOfFilter{BusID: 1}, nil},
+		{"bus it moved to", AsOfFilter{BusID: 2}, []int{moved.ID, later.ID}},
+		{"staff member", AsOfFilter{StaffID: 3}, []int{later.ID}},
+		{"dates", AsOfFilter{BusID: 2, From: &from, To: &to}, []int{moved.ID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assignments, err := repo.ListAsOf(time.Now(), tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int
+			for _, assignment := range assignments {
+				ids = append(ids, assignment.ID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("listed %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func viewConformance(t *testing.T, repo ViewRepository) {
+	view := &SavedView{Owner: "ana", Name: "mine", Filter: AssignmentFilter{StaffID: 4}}
+	if err := repo.Save(view); err != nil || view.ID == 0 {
+		t.Fatalf("Save = %v with ID %d, want an ID", err, view.ID)
+	}
+	replaced := &SavedView{Owner: "ana", Name: "mine", Filter: AssignmentFilter{StaffID: 5}}
+	if err := repo.Save(replaced); err != nil || replaced.ID != view.ID {
+		t.Errorf("Save again = %v with ID %d, want the filter replaced in view %d", err, replaced.ID, view.ID)
+	}
+	if got, err := repo.Get("ana", "mine"); err != nil || got == nil || got.Filter.StaffID != 5 {
+		t.Errorf("Get = %+v, %v; want the replaced filter", got, err)
+	}
+	if got, err := repo.Get("ben", "mine"); got != nil || err != nil {
+		t.Errorf("another owner's Get = %+v, %v; want nil, nil", got, err)
+	}
+	if deleted, err := repo.Delete("ana", "mine"); !deleted || err != nil {
+		t.Errorf("Delete = %v, %v; want true", deleted, err)
+	}
+	if deleted, err := repo.Delete("ana", "mine"); deleted || err != nil {
+		t.Errorf("second Delete = %v, %v; want false", deleted, err)
+	}
+}
+
+func availabilityConformance(t *testing.T, repo AvailabilityRepository) {
+	later := &AvailabilityPeriod{StaffID: 1, Type: "leave", StartDate: date("2025-04-01"), EndDate: date("2025-04-05")}
+	earlier := &AvailabilityPeriod{StaffID: 1, Type: "sick", StartDate: date("2025-03-01"), EndDate: date("2025-03-02")}
+	other := &AvailabilityPeriod{StaffID: 2, Type: "leave", StartDate: date("2025-03-01"), EndDate: date("2025-03-09")}
+	for _, period := range []*AvailabilityPeriod{later, earlier, other} {
+		if err := repo.Create(period); err != nil || period.ID == 0 {
+			t.Fatalf("Create = %v with ID %d, want an ID", err, period.ID)
+		}
+	}
+
+	periods, err := repo.List(AvailabilityFilter{StaffID: 1})
+	if err != nil || len(periods) != 2 || periods[0].ID != earlier.ID {
+		t.Errorf("List = %+v, %v; want staff 1's two periods by start date", periods, err)
+	}
+	from, to := date("2025-03-05"), date("2025-03-31")
+	if periods, err := repo.List(AvailabilityFilter{From: &from, To: &to}); err != nil || len(periods) != 1 ||
+		periods[0].ID != other.ID {
+		t.Errorf("List overlapping = %+v, %v; want only the period spanning the range", periods, err)
+	}
+
+	later.EndDate = date("2025-04-10")
+	if err := repo.Update(later); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := repo.Get(later.ID); err != nil || got == nil || !got.EndDate.Equal(later.EndDate) {
+		t.Errorf("Get = %+v, %v; want the new end date", got, err)
+	}
+	if deleted, err := repo.Delete(later.ID); !deleted || err != nil {
+		t.Errorf("Delete = %v, %v; want true", deleted, err)
+	}
+	if got, err := repo.Get(later.ID); got != nil || err != nil {
+		t.Errorf("deleted Get = %+v, %v; want nil, nil", got, err)
+	}
+}
+
+func qualificationConformance(t *testing.T, repo QualificationRepository) {
+	expires := date("2026-01-31")
+	for _, class := range []string{"D", "C"} {
+		if err := repo.Put(&StaffQualification{StaffID: 1, Class: class, ExpiresOn: &expires, UpdatedBy: "tester"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.Put(&StaffQualification{StaffID: 1, Class: "D", UpdatedBy: "tester"}); err != nil {
+		t.Fatal(err)
+	}
+
+	qualifications, err := repo.List(1)
+	if err != nil || len(qualifications) != 2 || qualifications[0].Class != "C" || qualifications[1].ExpiresOn != nil {
+		t.Errorf("List = %+v, %v; want C then D, with D no longer expiring", qualifications, err)
+	}
+	if deleted, err := repo.Delete(1, "C"); !deleted || err != nil {
+		t.Errorf("Delete = %v, %v; want true", deleted, err)
+	}
+	if deleted, err := repo.Delete(1, "C"); deleted || err != nil {
+		t.Errorf("second Delete = %v, %v; want false", deleted, err)
+	}
+}
+
+func calendarConformance(t *testing.T, repo DepotCalendarRepository) {
+	cal := &DepotCalendar{Depot: "north", Days: map[string]ServiceDay{"sun": {Level: ServiceNone}}}
+	if created, changed, err := repo.Put(cal); !created || !changed || err != nil {
+		t.Errorf("first Put = %v, %v, %v; want created", created, changed, err)
+	}
+	same := &DepotCalendar{Depot: "north", Days: map[string]ServiceDay{"sun": {Level: ServiceNone}}}
+	if created, changed, err := repo.Put(same); created || changed || err != nil {
+		t.Errorf("identical Put = %v, %v, %v; want nothing changed", created, changed, err)
+	}
+	weekend := &DepotCalendar{Depot: "north", Days: map[string]ServiceDay{"sat": {Level: ServiceNone},
+		"sun": {Level: ServiceNone}}}
+	if created, changed, err := repo.Put(weekend); created || !changed || err != nil {
+		t.Errorf("new Put = %v, %v, %v; want changed", created, changed, err)
+	}
+	if got, err := repo.Get("north"); err != nil || got == nil || len(got.Days) != 2 {
+		t.Errorf("Get = %+v, %v; want both days", got, err)
+	}
+	if got, err := repo.Get("south"); got != nil || err != nil {
+		t.Errorf("missing Get = %+v, %v; want nil, nil", got, err)
+	}
+}
+
+func ruleModeConformance(t *testing.T, repo RuleModeRepository) {
+	until := date("2025-07-01")
+	mode := &RuleMode{Rule: apierror.RuleStaffAvailability, Mode: RuleShadow, ShadowUntil: &until}
+	if created, changed, err := repo.Put(mode); !created || !changed || err != nil {
+		t.Errorf("first Put = %v, %v, %v; want created", created, changed, err)
+	}
+	same := date("2025-07-01")
+	if created, changed, err := repo.Put(&RuleMode{Rule: apierror.RuleStaffAvailability, Mode: RuleShadow,
+		ShadowUntil: &same}); created || changed || err != nil {
+		t.Errorf("identical Put = %v, %v, %v; want nothing changed", created, changed, err)
+	}
+	if created, changed, err := repo.Put(&RuleMode{Rule: apierror.RuleStaffAvailability,
+		Mode: RuleShadow}); created || !changed || err != nil {
+		t.Errorf("Put without an end = %v, %v, %v; want changed", created, changed, err)
+	}
+	repo.Put(&RuleMode{Rule: apierror.RuleSchedulingHorizon, Mode: RuleEnforced})
+	if got, err := repo.Get(apierror.RuleStaffAvailability); err != nil || got == nil || got.ShadowUntil != nil {
+		t.Errorf("Get = %+v, %v; want shadowed indefinitely", got, err)
+	}
+	if modes, err := repo.List(); err != nil || len(modes) != 2 || modes[0].Rule != apierror.RuleSchedulingHorizon {
+		t.Errorf("List = %+v, %v; want both, by rule", modes, err)
+	}
+	if deleted, err := repo.Delete(apierror.RuleStaffAvailability); !deleted || err != nil {
+		t.Errorf("Delete = %v, %v; want true", deleted, err)
+	}
+	if got, err := repo.Get(apierror.RuleStaffAvailability); got != nil || err != nil {
+		t.Errorf("deleted Get = %+v, %v; want nil, nil", got, err)
+	}
+}
+
+func channelConformance(t *testing.T, repo NotificationRepository) {
+	if created, changed, err := repo.PutChannels(&NotificationChannels{StaffID: 2,
+		Email: "jane@example.com"}); !created || !changed || err != nil {
+		t.Errorf("first PutChannels = %v, %v, %v; want created", created, changed, err)
+	}
+	same := &NotificationChannels{StaffID: 2, Email: "jane@example.com"}
+	if created, changed, err := repo.PutChannels(same); created || changed || err != nil || same.UpdatedAt.IsZero() {
+		t.Errorf("identical PutChannels = %v, %v, %v, %+v; want nothing changed and the stored channels", created,
+			changed, err, same)
+	}
+	if created, changed, err := repo.PutChannels(&NotificationChannels{StaffID: 2,
+		WebhookURL: "https://hooks.example.com/2"}); created || !changed || err != nil {
+		t.Errorf("new PutChannels = %v, %v, %v; want changed", created, changed, err)
+	}
+	repo.PutChannels(&NotificationChannels{StaffID: 1, Email: "ana@example.com"})
+	if got, err := repo.GetChannels(2); err != nil || got == nil || got.Email != "" ||
+		got.WebhookURL != "https://hooks.example.com/2" {
+		t.Errorf("GetChannels = %+v, %v; want the webhook alone", got, err)
+	}
+	if channels, err := repo.ListChannels(); err != nil || len(channels) != 2 || channels[0].StaffID != 1 {
+		t.Errorf("ListChannels = %+v, %v; want both, by staff ID", channels, err)
+	}
+}
+
+func scenarioConformance(t *testing.T, repo ScenarioRepository) {
+	id, err := newULID(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	scenario := &Scenario{ID: id, Name: "summer", From: date("2025-07-01"), To: date("2025-07-31"),
+		Status: ScenarioDraft, Assignments: []ScenarioAssignment{}, Removed: []ScenarioAssignment{}, CreatedBy: "tester",
+		DepotID: "north"}
+	if err := repo.Create(scenario); err != nil || scenario.Version != 1 {
+		t.Fatalf("Create = %v at version %d, want version 1", err, scenario.Version)
+	}
+
+	stale := *scenario
+	scenario.Name = "summer timetable"
+	if err := repo.Save(scenario); err != nil || scenario.Version != 2 {
+		t.Fatalf("Save = %v at version %d, want version 2", err, scenario.Version)
+	}
+	if err := repo.Save(&stale); !errors.Is(err, errScenarioModified) {
+		t.Errorf("Save from version 1 = %v, want errScenarioModified", err)
+	}
+	if got, err := repo.Get(id); err != nil || got == nil || got.Name != "summer timetable" || got.DepotID != "north" {
+		t.Errorf("Get = %+v, %v; want the saved name and the depot", got, err)
+	}
+}
+
+func publicationConformance(t *testing.T, repo PublicationRepository) {
+	from, to := date("2025-03-03"), date("2025-03-09")
+	newPublication := func() *RosterPublication {
+		id, err := newULID(time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &RosterPublication{ID: id, From: from, To: to, Status: PublicationPublishing, Days: []RosterDay{},
+			Steps: []SagaStep{}, PublishedBy: "tester"}
+	}
+
+	first := newPublication()
+	if err := repo.Create(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Create(newPublication()); !errors.Is(err, errPublicationInProgress) {
+		t.Errorf("Create while publishing = %v, want errPublicationInProgress", err)
+	}
+	if err := repo.Complete(first); err != nil {
+		t.Fatal(err)
+	}
+	if current, err := repo.Current(from, to); err != nil || current == nil || current.ID != first.ID {
+		t.Errorf("Current = %+v, %v; want the completed publication", current, err)
+	}
+	if err := repo.Create(newPublication()); err != nil {
+		t.Errorf("Create after completing = %v, want it allowed", err)
+	}
+}
+
+func idempotencyConformance(t *testing.T, repo IdempotencyRepository) {
+	now := time.Now()
+	claim := &IdempotentResponse{Actor: "ana", Key: "k1", RequestHash: "h1"}
+	if existing, err := repo.Claim(claim, now); existing != nil || err != nil {
+		t.Fatalf("first Claim = %+v, %v; want the key taken", existing, err)
+	}
+	if existing, err := repo.Claim(&IdempotentResponse{Actor: "ana", Key: "k1", RequestHash: "h1"}, now); err != nil ||
+		existing == nil || existing.Status != 0 {
+		t.Errorf("Claim in progress = %+v, %v; want the unfinished claim", existing, err)
+	}
+	if existing, err := repo.Claim(&IdempotentResponse{Actor: "ben", Key: "k1", RequestHash: "h1"}, now); existing != nil ||
+		err != nil {
+		t.Errorf("another actor's Claim = %+v, %v; want keys kept apart by actor", existing, err)
+	}
+
+	claim.Status, claim.ContentType, claim.Body = 201, "application/json", []byte(`{"id":1}`)
+	if err := repo.Complete(claim); err != nil {
+		t.Fatal(err)
+	}
+	existing, err := repo.Claim(&IdempotentResponse{Actor: "ana", Key: "k1", RequestHash: "h1"}, now)
+	if err != nil || existing == nil || existing.Status != 201 || string(existing.Body) != `{"id":1}` {
+		t.Errorf("Claim after Complete = %+v, %v; want the stored response", existing, err)
+	}
+
+	if err := repo.Release("ben", "k1"); err != nil {
+		t.Fatal(err)
+	}
+	if existing, err := repo.Claim(&IdempotentResponse{Actor: "ben", Key: "k1", RequestHash: "h2"}, now); existing != nil ||
+		err != nil {
+		t.Errorf("Claim after Release = %+v, %v; want the key free again", existing, err)
+	}
+}
+
+func exportJobConformance(t *testing.T, repo ExportJobRepository) {
+	var ids []string
+	for range 2 {
+		id, err := newULID(time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		job := &ExportJob{ID: id, Format: "csv", Status: ExportQueued, RequestedBy: "ana"}
+		if err := repo.Create(job); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		time.Sleep(time.Millisecond) // distinct creation times
+	}
+
+	now := time.Now()
+	job, err := repo.Claim(now, now.Add(-time.Hour))
+	if err != nil || job == nil || job.ID != ids[0] || job.Status != ExportRunning {
+		t.Fatalf("Claim = %+v, %v; want the oldest job running", job, err)
+	}
+	job.Status, job.Rows = ExportSucceeded, 3
+	if err := repo.Finish(job); err != nil {
+		t.Fatal(err)
+	}
+	if next, err := repo.Claim(now, now.Add(-time.Hour)); err != nil || next == nil || next.ID != ids[1] {
+		t.Errorf("second Claim = %+v, %v; want the other job", next, err)
+	}
+	if none, err := repo.Claim(now, now.Add(-time.Hour)); none != nil || err != nil {
+		t.Errorf("Claim with nothing queued = %+v, %v; want nil, nil", none, err)
+	}
+	if stale, err := repo.Claim(now, now.Add(time.Hour)); err != nil || stale == nil || stale.ID != ids[1] {
+		t.Errorf("Claim past the timeout = %+v, %v; want the stale running job again", stale, err)
+	}
+
+	jobs, err := repo.List("ana")
+	if err != nil || len(jobs) != 2 || jobs[0].ID != ids[1] {
+		t.Errorf("List = %+v, %v; want both jobs, newest first", jobs, err)
+	}
+	if got, err := repo.Get(ids[0]); err != nil || got == nil || got.Status != ExportSucceeded || got.Rows != 3 {
+		t.Errorf("Get = %+v, %v; want the finished job", got, err)
+	}
+}
+
+func attachmentConformance(t *testing.T, store Storage) {
+	repo := store.Attachments
+	assignment := mustCreate(t, store.Assignments, Assignment{BusID: 1, StaffID: 1, Role: "driver",
+		StartDate: date("2025-03-03")})
+	other := mustCreate(t, store.Assignments, Assignment{BusID: 2, StaffID: 2, Role: "driver",
+		StartDate: date("2025-03-03")})
+
+	var ids []string
+	for i, assignmentID := range []int{assignment.ID, assignment.ID, other.ID} {
+		id, err := newULID(time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		attachment := &Attachment{ID: id, AssignmentID: assignmentID, Filename: fmt.Sprintf("sheet-%d.pdf", i),
+			ContentType: "application/pdf", Size: 10, UploadedBy: "ana"}
+		if err := repo.Create(attachment); err != nil || attachment.CreatedAt.IsZero() {
+			t.Fatalf("Create = %v at %v, want a creation time", err, attachment.CreatedAt)
+		}
+		ids = append(ids, id)
+		time.Sleep(time.Millisecond) // distinct creation times
+	}
+
+	listed, err := repo.List(assignment.ID)
+	if err != nil || len(listed) != 2 || listed[0].ID != ids[0] || listed[1].Filename != "sheet-1.pdf" {
+		t.Errorf("List = %+v, %v; want the assignment's two, oldest first", listed, err)
+	}
+	if got, err := repo.Get(assignment.ID, ids[1]); err != nil || got == nil || got.Size != 10 || got.UploadedBy != "ana" {
+		t.Errorf("Get = %+v, %v; want the attachment", got, err)
+	}
+	if got, err := repo.Get(assignment.ID, ids[2]); got != nil || err != nil {
+		t.Errorf("Get of another assignment's attachment = %+v, %v; want nil, nil", got, err)
+	}
+}
+
+func recurringConformance(t *testing.T, repo RecurringTemplateRepository) {
+	start, end := TimeOfDay(6*60), TimeOfDay(14*60)
+	weekdays, _ := ParseDayMask([]string{"mon", "tue", "wed", "thu", "fri"})
+	first := &RecurringTemplate{BusID: 1, StaffID: 1, Role: "driver", WorkingDays: weekdays, ShiftStart: &start,
+		ShiftEnd: &end, ValidFrom: date("2025-03-03"), CreatedBy: "ana"}
+	second := &RecurringTemplate{BusID: 2, StaffID: 2, Role: "conductor", ValidFrom: date("2025-03-03")}
+	for _, template := range []*RecurringTemplate{first, second} {
+		if err := repo.Create(template); err != nil || template.ID == 0 {
+			t.Fatalf("Create = %v with ID %d, want an ID", err, template.ID)
+		}
+	}
+
+	got, err := repo.Get(first.ID)
+	if err != nil || got == nil || got.WorkingDays != weekdays || got.ShiftStart == nil || *got.ShiftStart != start ||
+		got.GeneratedThrough != nil {
+		t.Fatalf("Get = %+v, %v; want the template, not yet generated", got, err)
+	}
+
+	through := date("2025-03-16")
+	if taken, err := repo.Advance(first.ID, nil, through); !taken || err != nil {
+		t.Errorf("Advance = %v, %v; want true", taken, err)
+	}
+	if taken, err := repo.Advance(first.ID, nil, date("2025-03-23")); taken || err != nil {
+		t.Errorf("Advance from a stale date = %v, %v; want false", taken, err)
+	}
+
+	until := date("2025-06-27")
+	got.ValidUntil = &until
+	if err := repo.Update(got); err != nil || got.GeneratedThrough == nil || !got.GeneratedThrough.Equal(through) {
+		t.Errorf("Update = %v, generated through %v; want it kept", err, got.GeneratedThrough)
+	}
+
+	listed, err := repo.List()
+	if err != nil || len(listed) != 2 || listed[0].ID != first.ID || listed[0].ValidUntil == nil {
+		t.Errorf("List = %+v, %v; want both by ID, the first updated", listed, err)
+	}
+	if deleted, err := repo.Delete(second.ID); !deleted || err != nil {
+		t.Errorf("Delete = %v, %v; want true", deleted, err)
+	}
+	if got, err := repo.Get(second.ID); got != nil || err != nil {
+		t.Errorf("deleted Get = %+v, %v; want nil, nil", got, err)
+	}
+}
+
+func callbackKeyConformance(t *testing.T, repo CallbackKeyRepository) {
+	id, err := newULID(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &CallbackKey{ID: id, Name: "swap-app", Secret: "s3cret", CreatedBy: "ana"}
+	if err := repo.Create(key); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := repo.Get(id); err != nil || got == nil || got.Secret != "s3cret" || got.LastUsedAt != nil {
+		t.Fatalf("Get = %+v, %v; want the unused key with its secret", got, err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	if fresh, err := repo.Use(id, "nonce-0000000001", now.Add(time.Minute), now); !fresh || err != nil {
+		t.Errorf("first Use = %v, %v; want the nonce accepted", fresh, err)
+	}
+	if fresh, err := repo.Use(id, "nonce-0000000001", now.Add(time.Minute), now); fresh || err != nil {
+		t.Errorf("repeated Use = %v, %v; want the replay refused", fresh, err)
+	}
+	if got, _ := repo.Get(id); got == nil || got.LastUsedAt == nil || !got.LastUsedAt.Equal(now) {
+		t.Errorf("LastUsedAt = %+v, want %s", got, now)
+	}
+	if fresh, err := repo.Use(id, "nonce-0000000001", now.Add(3*time.Minute), now.Add(2*time.Minute)); !fresh ||
+		err != nil {
+		t.Errorf("Use after the nonce expired = %v, %v; want it accepted", fresh, err)
+	}
+
+	if revoked, err := repo.Revoke(id, now); !revoked || err != nil {
+		t.Fatalf("Revoke = %v, %v", revoked, err)
+	}
+	if revoked, err := repo.Revoke(id, now.Add(time.Hour)); !revoked || err != nil {
+		t.Errorf("second Revoke = %v, %v; want the key still found", revoked, err)
+	}
+	keys, err := repo.List()
+	if err != nil || len(keys) != 1 || keys[0].RevokedAt == nil || !keys[0].RevokedAt.Equal(now) {
+		t.Errorf("List = %+v, %v; want the key revoked at the first revocation", keys, err)
+	}
+	if revoked, err := repo.Revoke("01JNB3S7Z8K4Q2M9X6T5V0W1YC", now); revoked || err != nil {
+		t.Errorf("Revoke of an unknown key = %v, %v; want false, nil", revoked, err)
+	}
+}
+
+func assignmentMoveConformance(t *testing.T, repo AssignmentRepository) {
+	guard := &bulkGuard{actor: "tester"}
+	split := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03")})
+	later := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 2, Role: "conductor", StartDate: date("2025-03-17")})
+
+	reassigned, err := repo.ReassignBus(1, 2, date("2025-03-10"), "tester", guard)
+	if err != nil || len(reassigned.Truncated) != 1 || len(reassigned.Moved) != 2 {
+		t.Fatalf("ReassignBus = %+v, %v; want one split and both on the new bus", reassigned, err)
+	}
+	if got, _ := repo.Get(split.ID); got == nil || got.EndDate == nil || !got.EndDate.Equal(date("2025-03-09")) {
+		t.Errorf("split original = %+v, want it ended the day before", got)
+	}
+	if got, _ := repo.Get(later.ID); got == nil || got.BusID != 2 || got.Version != 2 {
+		t.Errorf("later assignment = %+v, want it moved at version 2", got)
+	}
+
+	// A clash on the replacement bus leaves everything as it was
+	mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-03-01")})
+	var conflictErr *ConflictError
+	if _, err := repo.ReassignBus(2, 3, date("2025-03-20"), "tester", guard); !errors.As(err, &conflictErr) {
+		t.Fatalf("clashing ReassignBus = %v, want a ConflictError", err)
+	}
+	if got, _ := repo.Get(later.ID); got == nil || got.BusID != 2 || got.Version != 2 {
+		t.Errorf("after the refused move = %+v, want it untouched", got)
+	}
+
+	transferred, err := repo.TransferStaff(2, "south", date("2025-03-24"), true, "tester", guard)
+	if err != nil || len(transferred.Ended) != 1 || len(transferred.Copied) != 1 || transferred.Copied[0].BusID != 4 {
+		t.Fatalf("TransferStaff = %+v, %v; want the assignment ended and copied to bus 4", transferred, err)
+	}
+
+	rows := []ImportRow{
+		{Row: 2, Assignment: Assignment{BusID: 4, StaffID: 7, Role: "driver", StartDate: date("2025-05-05"), Status: "active"}},
+		{Row: 3, Assignment: Assignment{BusID: 4, StaffID: 8, Role: "driver", StartDate: date("2025-05-05"), Status: "active"}},
+	}
+	allowed := func(*Assignment) (string, error) { return "", nil }
+	created, rowErrors, err := repo.Import(rows, "tester", allowed)
+	if err != nil || created != nil || len(rowErrors) != 1 || rowErrors[0].Row != 3 {
+		t.Fatalf("Import = %+v, %+v, %v; want row 3 refused for clashing with row 2", created, rowErrors, err)
+	}
+	if listed, _ := repo.List(AssignmentFilter{BusID: 4}); len(listed) != 1 {
+		t.Errorf("bus 4 after the refused import = %+v, want only the transfer's copy", listed)
+	}
+	refused := func(*Assignment) (string, error) { return "not today", nil }
+	if _, rowErrors, _ := repo.Import(rows[:1], "tester", refused); len(rowErrors) != 1 ||
+		rowErrors[0].Errors[0] != "not today" {
+		t.Errorf("Import refused by the check = %+v, want the check's reason", rowErrors)
+	}
+	if created, rowErrors, err := repo.Import(rows[:1], "tester", allowed); err != nil || len(created) != 1 ||
+		rowErrors != nil {
+		t.Errorf("Import = %+v, %+v, %v; want the row created", created, rowErrors, err)
+	}
+}
+
+func shiftConformance(t *testing.T, store Storage) {
+	shifts := store.Shifts
+	if missing, err := shifts.Get(1); missing != nil || err != nil {
+		t.Errorf("missing shift = %+v, %v; want nil, nil", missing, err)
+	}
+
+	bidding := &OpenShift{BusID: 1, Role: "driver", StartDate: date("2031-03-03"), Mode: ShiftModeBid,
+		AwardPolicy: AwardPolicySeniority, BiddingClosesAt: time.Now().Add(time.Hour), CreatedBy: "tester"}
+	if err := shifts.Create(bidding); err != nil || bidding.ID == 0 || bidding.Status != "open" {
+		t.Fatalf("Create = %v, %+v; want an open shift with an ID", err, bidding)
+	}
+	for _, staffID := range []int{3, 1} {
+		if _, err := shifts.PlaceBid(bidding.ID, staffID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := shifts.PlaceBid(bidding.ID, 3); !errors.Is(err, errDuplicateBid) {
+		t.Errorf("second bid = %v, want errDuplicateBid", err)
+	}
+	if withdrawn, err := shifts.WithdrawBid(bidding.ID, 3); !withdrawn || err != nil {
+		t.Errorf("WithdrawBid = %v, %v", withdrawn, err)
+	}
+	if withdrawn, err := shifts.WithdrawBid(bidding.ID, 3); withdrawn || err != nil {
+		t.Errorf("repeated WithdrawBid = %v, %v; want false, nil", withdrawn, err)
+	}
+	if _, err := shifts.PlaceBid(bidding.ID, 3); err != nil {
+		t.Errorf("bid after withdrawing = %v, want it reinstated", err)
+	}
+	bids, err := shifts.ListBids(bidding.ID)
+	if err != nil || len(bids) != 2 || bids[0].StaffID != 1 || bids[1].Status != "pending" {
+		t.Errorf("ListBids = %+v, %v; want the reinstated bid last", bids, err)
+	}
+
+	if due, err := shifts.DueForAward(time.Now()); err != nil || len(due) != 0 {
+		t.Errorf("DueForAward before bidding closes = %v, %v; want none", due, err)
+	}
+	due, err := shifts.DueForAward(time.Now().Add(2 * time.Hour))
+	if err != nil || len(due) != 1 || due[0] != bidding.ID {
+		t.Fatalf("DueForAward = %v, %v; want the shift", due, err)
+	}
+	// The senior bidder is passed over while the check refuses them
+	onLeave := &UnavailableError{StaffID: 1}
+	refusing := func(staffID int) takeUpCheck {
+		return func(assignment *Assignment) error {
+			if assignment.StaffID == staffID {
+				return onLeave
+			}
+			return nil
+		}
+	}
+	// A check that fails, rather than refusing, leaves the shift open
+	readFailure := errors.New("availability unreadable")
+	if awarded, err := shifts.Award(bidding.ID, func(*Assignment) error { return readFailure }); !errors.Is(err,
+		readFailure) || awarded != nil {
+		t.Fatalf("Award with a failing check = %+v, %v; want the failure", awarded, err)
+	}
+	awarded, err := shifts.Award(bidding.ID, refusing(1))
+	if err != nil || awarded == nil || awarded.Status != "awarded" || awarded.AwardedStaffID == nil ||
+		*awarded.AwardedStaffID != 3 || awarded.AssignmentPublicID == nil {
+		t.Fatalf("Award = %+v, %v; want it awarded to the bidder the check lets through", awarded, err)
+	}
+	if again, err := shifts.Award(bidding.ID, refusing(0)); again != nil || err != nil {
+		t.Errorf("second Award = %+v, %v; want nil, nil", again, err)
+	}
+	if bids, _ := shifts.ListBids(bidding.ID); len(bids) != 2 || bids[0].Status != "lost" || bids[1].Status != "won" {
+		t.Errorf("bids after the award = %+v, want lost and won", bids)
+	}
+	if got, err := store.Assignments.GetByPublicID(*awarded.AssignmentPublicID, false); err != nil || got == nil ||
+		got.StaffID != 3 || got.BusID != 1 {
+		t.Errorf("awarded assignment = %+v, %v; want staff 3 on bus 1", got, err)
+	}
+
+	claiming := &OpenShift{BusID: 2, Role: "driver", StartDate: date("2031-03-03"), Mode: ShiftModeClaim,
+		RequiresConfirmation: true, AwardPolicy: AwardPolicySeniority, BiddingClosesAt: date("2031-03-03"),
+		CreatedBy: "tester"}
+	if err := shifts.Create(claiming); err != nil {
+		t.Fatal(err)
+	}
+	if claimable, err := shifts.ListClaimable("driver", 0, time.Now()); err != nil || len(claimable) != 1 ||
+		claimable[0].ID != claiming.ID {
+		t.Errorf("ListClaimable = %+v, %v; want the claim-mode shift", claimable, err)
+	}
+	var conflictErr *ConflictError
+	if _, _, err := shifts.Claim(claiming.ID, 3, "tester", time.Now(), refusing(0)); !errors.As(err, &conflictErr) {
+		t.Errorf("Claim by a booked driver = %v, want a ConflictError", err)
+	}
+	if _, _, err := shifts.Claim(claiming.ID, 1, "tester", time.Now(), refusing(1)); !errors.Is(err, onLeave) {
+		t.Errorf("Claim the check refuses = %v, want its refusal", err)
+	}
+	held, created, err := shifts.Claim(claiming.ID, 1, "tester", time.Now(), refusing(0))
+	if err != nil || created != nil || held.Status != "claimed" || *held.AwardedStaffID != 1 {
+		t.Fatalf("Claim = %+v, %+v, %v; want it held for confirmation", held, created, err)
+	}
+	if _, _, err := shifts.Claim(claiming.ID, 1, "tester", time.Now(), refusing(0)); !errors.Is(err, errShiftNotClaimable) {
+		t.Errorf("Claim of a held shift = %v, want errShiftNotClaimable", err)
+	}
+	if _, _, err := shifts.ConfirmClaim(claiming.ID, "tester", refusing(1)); !errors.Is(err, onLeave) {
+		t.Errorf("ConfirmClaim the check refuses = %v, want its refusal", err)
+	}
+	if released, err := shifts.RejectClaim(claiming.ID); err != nil || released.Status != "open" ||
+		released.AwardedStaffID != nil {
+		t.Errorf("RejectClaim = %+v, %v; want the shift reopened, still held after the refused confirmation", released, err)
+	}
+	if _, _, err := shifts.ConfirmClaim(claiming.ID, "tester", refusing(0)); !errors.Is(err, errNoPendingClaim) {
+		t.Errorf("ConfirmClaim without a claim = %v, want errNoPendingClaim", err)
+	}
+	if _, _, err := shifts.Claim(claiming.ID, 1, "tester", time.Now(), refusing(0)); err != nil {
+		t.Fatal(err)
+	}
+	confirmed, created, err := shifts.ConfirmClaim(claiming.ID, "tester", refusing(0))
+	if err != nil || confirmed.Status != "awarded" || created == nil || created.StaffID != 1 || created.BusID != 2 {
+		t.Errorf("ConfirmClaim = %+v, %+v, %v; want staff 1's assignment on bus 2", confirmed, created, err)
+	}
+	if listed, err := shifts.List("awarded"); err != nil || len(listed) != 2 {
+		t.Errorf("List awarded = %+v, %v; want both shifts", listed, err)
+	}
+
+	declared := func() *OpenShift {
+		return &OpenShift{BusID: 3, Role: "driver", StartDate: date("2031-04-07"), Mode: ShiftModeBid,
+			AwardPolicy: AwardPolicySeniority, BiddingClosesAt: date("2031-04-01"), CreatedBy: "tester"}
+	}
+	now := date("2031-03-01")
+	early := declared()
+	if created, changed, err := shifts.PutDeclared("south.early", early, now); !created || !changed || err != nil ||
+		early.ID == 0 || early.Name == nil || *early.Name != "south.early" || early.Status != "open" {
+		t.Fatalf("PutDeclared = %v, %v, %v, %+v; want the shift created under its name", created, changed, err, early)
+	}
+	if created, changed, err := shifts.PutDeclared("south.early", declared(), date("2031-05-01")); created || changed ||
+		err != nil {
+		t.Errorf("repeated PutDeclared after bidding closed = %v, %v, %v; want nothing written", created, changed, err)
+	}
+	moved := declared()
+	moved.BusID = 4
+	if created, changed, err := shifts.PutDeclared("south.early", moved, now); created || !changed || err != nil ||
+		moved.ID != early.ID || moved.BusID != 4 {
+		t.Errorf("changed PutDeclared = %v, %v, %v, %+v; want the shift updated in place", created, changed, err, moved)
+	}
+	if _, _, err := shifts.PutDeclared("south.late", declared(), date("2031-05-01")); !errors.Is(err, errBiddingClosed) {
+		t.Errorf("PutDeclared closed for bidding = %v, want errBiddingClosed", err)
+	}
+	if _, err := shifts.PlaceBid(early.ID, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := shifts.PutDeclared("south.early", declared(), now); !errors.Is(err, errShiftSpecLocked) {
+		t.Errorf("PutDeclared with a bid = %v, want errShiftSpecLocked", err)
+	}
+	if got, err := shifts.GetDeclared("south.early"); err != nil || got == nil || got.ID != early.ID {
+		t.Errorf("GetDeclared = %+v, %v; want the shift", got, err)
+	}
+	if listed, err := shifts.ListDeclared(); err != nil || len(listed) != 1 || listed[0].ID != early.ID {
+		t.Errorf("ListDeclared = %+v, %v; want the declared shift only", listed, err)
+	}
+	withdrawn, err := shifts.DeleteDeclared("south.early")
+	if err != nil || withdrawn == nil || withdrawn.Status != "cancelled" || withdrawn.Name != nil {
+		t.Errorf("DeleteDeclared = %+v, %v; want the shift cancelled without its name", withdrawn, err)
+	}
+	if bids, _ := shifts.ListBids(early.ID); len(bids) != 1 || bids[0].Status != "lost" {
+		t.Errorf("bids after DeleteDeclared = %+v, want the pending bid lost", bids)
+	}
+	if got, err := shifts.GetDeclared("south.early"); got != nil || err != nil {
+		t.Errorf("GetDeclared after delete = %+v, %v; want nil, nil", got, err)
+	}
+	if gone, err := shifts.DeleteDeclared("south.early"); gone != nil || err != nil {
+		t.Errorf("repeated DeleteDeclared = %+v, %v; want nil, nil", gone, err)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestLoadStorage(t *testing.T) {
+	t.Setenv("STORAGE_BACKEND", "Testing")
+	registerStorageBackend("testing", func(*pgxpool.Pool) (Storage, error) { return NewMemoryStorage(), nil })
+	t.Cleanup(func() { delete(storageBackends, "testing") })
+
+	if store, err := LoadStorage(nil); err != nil || store.Assignments == nil {
+		t.Errorf("LoadStorage = %+v, %v; want the registered backend's repositories", store, err)
+	}
+
+	t.Setenv("STORAGE_BACKEND", "mongodb")
+	if _, err := LoadStorage(nil); err == nil || !strings.Contains(err.Error(), "postgres, testing") {
+		t.Errorf("unknown backend error = %v, want it to list the backends in the build", err)
+	}
+}
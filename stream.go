@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// assignmentEventsChannel is the Postgres NOTIFY channel on which the outbox
+// announces each committed event's ID
+const assignmentEventsChannel = "assignment_events"
+
+// streamBuffer is how many events a subscriber may fall behind before it is
+// disconnected. Browsers' EventSource reconnects on its own and resyncs.
+const streamBuffer = 64
+
+// streamHeartbeat is how often an idle stream sends a comment, so proxies
+// don't close it; main reads it from STREAM_HEARTBEAT_INTERVAL
+var streamHeartbeat = 15 * time.Second
+
+// streamPollInterval is how often the stream reads new events from the outbox
+// when the database can't LISTEN; main reads it from STREAM_POLL_INTERVAL
+var streamPollInterval = time.Second
+
+// streamSubscriber is one connected client and its filters
+type streamSubscriber struct {
+	busID, staffID int        // zero matches every bus or staff member
+	clearance      *Clearance // events for assignments it can't see are held back
+	events         chan AssignmentEvent
+}
+
+func (s *streamSubscriber) wants(event *AssignmentEvent) bool {
+	return (s.busID == 0 || event.Assignment.BusID == s.busID) &&
+		(s.staffID == 0 || event.Assignment.StaffID == s.staffID) &&
+		s.clearance.Allows(&event.Assignment)
+}
+
+// AssignmentStream fans committed assignment events out to connected clients
+type AssignmentStream struct {
+	mu          sync.Mutex
+	subscribers map[*streamSubscriber]struct{}
+	closed      bool
+}
+
+var assignmentStream = NewAssignmentStream()
+
+// NewAssignmentStream creates a stream with no subscribers
+func NewAssignmentStream() *AssignmentStream {
+	return &AssignmentStream{subscribers: map[*streamSubscriber]struct{}{}}
+}
+
+// Subscribe registers a client for the events matching its filters and
+// clearance. It returns nil once the stream has been closed for shutdown.
+func (s *AssignmentStream) Subscribe(busID, staffID int, clearance *Clearance) *streamSubscriber {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	sub := &streamSubscriber{busID: busID, staffID: staffID, clearance: clearance,
+		events: make(chan AssignmentEvent, streamBuffer)}
+	s.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe removes a client, closing its channel if still open
+func (s *AssignmentStream) Unsubscribe(sub *streamSubscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, subscribed := s.subscribers[sub]; subscribed {
+		delete(s.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Publish hands the event to every interested client without blocking.
+// Clients too far behind are dropped rather than holding up the rest.
+func (s *AssignmentStream) Publish(event AssignmentEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subscribers {
+		if !sub.wants(&event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			delete(s.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Close ends every stream and refuses new ones, so open streams don't hold
+// up a graceful shutdown
+func (s *AssignmentStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for sub := range s.subscribers {
+		delete(s.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Listen relays the events committed on every replica, which the outbox
+// announces over NOTIFY, until the context is cancelled. A dropped connection
+// is retried after a pause; events committed meanwhile are not replayed.
+// /readyz reports the listener failing while it's disconnected. Where the
+// database has no LISTEN, or NOTIFY is turned off, it polls the outbox.
+func (s *AssignmentStream) Listen(ctx context.Context) {
+	monitor := backgroundWorkers.Register("assignment_stream", 0, nil)
+	defer backgroundWorkers.Unregister("assignment_stream")
+	for {
+		err := s.listen(ctx, monitor)
+		if ctx.Err() != nil {
+			return
+		}
+		monitor.Record(err)
+		log.Printf("Assignment stream listener stopped, retrying in 5s: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (s *AssignmentStream) listen(ctx context.Context, monitor *WorkerMonitor) error {
+	if !notifyOutboxEvents {
+		return s.poll(ctx, monitor)
+	}
+	pooled, err := db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// LISTEN is bound to the session, so the connection is taken out of the pool
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+assignmentEventsChannel); err != nil {
+		var pgErr *pgconn.PgError
+		if !errors.As(err, &pgErr) || pgErr.Code != "0A000" { // feature_not_supported
+			return err
+		}
+		log.Printf("The database doesn't support LISTEN, polling the outbox every %s for stream events",
+			streamPollInterval)
+		conn.Close(ctx)
+		return s.poll(ctx, monitor)
+	}
+	monitor.Record(nil)
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		id, err := strconv.ParseInt(notification.Payload, 10, 64)
+		if err != nil {
+			log.Printf("Ignoring assignment event notification %q", notification.Payload)
+			continue
+		}
+		event, err := loadOutboxEvent(ctx, id)
+		if err != nil {
+			return err
+		}
+		s.Publish(*event)
+	}
+}
+
+// poll relays events by reading the outbox every streamPollInterval, starting
+// from the newest event when it begins. Events are read in ID order, so one
+// whose transaction commits after a later ID's has been read is missed, as a
+// client disconnected meanwhile would miss it.
+func (s *AssignmentStream) poll(ctx context.Context, monitor *WorkerMonitor) error {
+	var last int64
+	if err := db.QueryRow(ctx, `SELECT COALESCE(max(id), 0) FROM assignment_outbox`).Scan(&last); err != nil {
+		return err
+	}
+	monitor.Record(nil)
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		rows, err := db.Query(ctx, `SELECT `+outboxEventColumns+` FROM assignment_outbox WHERE id > $1 ORDER BY id LIMIT $2`,
+			last, streamBuffer)
+		if err != nil {
+			return err
+		}
+		events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (AssignmentEvent, error) {
+			var event AssignmentEvent
+			err := scanOutboxEvent(row, &event)
+			return event, err
+		})
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			s.Publish(event)
+			last = event.ID
+		}
+	}
+}
+
+// outboxEventColumns are read back for the stream, in scanOutboxEvent order
+const outboxEventColumns = `id, event_type, actor, payload, created_at`
+
+func scanOutboxEvent(row pgx.Row, event *AssignmentEvent) error {
+	var payload []byte
+	if err := row.Scan(&event.ID, &event.Type, &event.Actor, &payload, &event.OccurredAt); err != nil {
+		return err
+	}
+	return json.Unmarshal(payload, &event.Assignment)
+}
+
+// loadOutboxEvent reads one event back from the outbox
+func loadOutboxEvent(ctx context.Context, id int64) (*AssignmentEvent, error) {
+	event := &AssignmentEvent{}
+	row := db.QueryRow(ctx, `SELECT `+outboxEventColumns+` FROM assignment_outbox WHERE id = $1`, id)
+	if err := scanOutboxEvent(row, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// handleStreamAssignments pushes assignment events to the client as
+// server-sent events, optionally limited to a bus or staff member. A ready
+// event opens the stream, so clients know to refetch what they may have
+// missed while disconnected.
+func (s *AssignmentStream) handleStreamAssignments(c *gin.Context) {
+	var filters [2]int
+	for i, name := range []string{"bus_id", "staff_id"} {
+		if value := c.Query(name); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				respondInvalidField(c, name, "Invalid "+name)
+				return
+			}
+			filters[i] = id
+		}
+	}
+
+	sub := s.Subscribe(filters[0], filters[1], callerClearance(c))
+	if sub == nil {
+		respondError(c, http.StatusServiceUnavailable, "The service is shutting down")
+		return
+	}
+	defer s.Unsubscribe(sub)
+
+	// Streams outlive the server's write timeout
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no") // stop nginx buffering the stream
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, "retry: 3000\nevent: ready\ndata: {}\n\n")
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+		case event, open := <-sub.events:
+			if !open {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Failed to encode assignment event %d: %v", event.ID, err)
+				continue
+			}
+			fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		}
+		c.Writer.Flush()
+	}
+}
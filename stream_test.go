@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvent reads lines from a stream up to the next blank line
+func readEvent(t *testing.T, lines *bufio.Scanner) string {
+	t.Helper()
+	var event []string
+	for lines.Scan() {
+		if lines.Text() == "" {
+			return strings.Join(event, "\n")
+		}
+		event = append(event, lines.Text())
+	}
+	t.Fatalf("stream ended: %v", lines.Err())
+	return ""
+}
+
+func TestStreamAssignments(t *testing.T) {
+	saved, savedHeartbeat := assignmentStream, streamHeartbeat
+	t.Cleanup(func() { assignmentStream, streamHeartbeat = saved, savedHeartbeat })
+	assignmentStream, streamHeartbeat = NewAssignmentStream(), 50*time.Millisecond
+
+	router, _ := newTestRouter(t)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/assignments/stream?bus_id=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	lines := bufio.NewScanner(resp.Body)
+	if event := readEvent(t, lines); !strings.Contains(event, "event: ready") {
+		t.Fatalf("first event = %q, want ready", event)
+	}
+
+	assignmentStream.Publish(AssignmentEvent{ID: 1, Type: EventAssignmentCreated, Assignment: Assignment{BusID: 2}})
+	assignmentStream.Publish(AssignmentEvent{ID: 2, Type: EventAssignmentUpdated, Assignment: Assignment{BusID: 1}})
+	event := readEvent(t, lines)
+	if !strings.HasPrefix(event, "id: 2\nevent: assignment.updated\ndata: {") {
+		t.Errorf("event = %q, want only bus 1's update", event)
+	}
+
+	if event := readEvent(t, lines); event != ": heartbeat" {
+		t.Errorf("idle stream sent %q, want a heartbeat", event)
+	}
+
+	// Closing for shutdown ends open streams
+	assignmentStream.Close()
+	for lines.Scan() {
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/assignments/stream", nil); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("stream after shutdown: status %d, want 503", rec.Code)
+	}
+}
+
+func TestStreamAssignmentsInvalidFilter(t *testing.T) {
+	router, _ := newTestRouter(t)
+	if rec := doRequest(router, http.MethodGet, "/api/assignments/stream?staff_id=abc", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", rec.Code)
+	}
+}
+
+func TestStreamDropsSlowSubscribers(t *testing.T) {
+	stream := NewAssignmentStream()
+	slow := stream.Subscribe(0, 0, nil)
+	filtered := stream.Subscribe(0, 7, nil)
+
+	for i := 0; i <= streamBuffer; i++ {
+		stream.Publish(AssignmentEvent{ID: int64(i), Assignment: Assignment{StaffID: 1}})
+	}
+	received := 0
+	for range slow.events {
+		received++
+	}
+	if received != streamBuffer {
+		t.Errorf("slow subscriber received %d events before being dropped, want %d", received, streamBuffer)
+	}
+
+	select {
+	case event := <-filtered.events:
+		t.Errorf("staff 7's subscriber received %+v", event)
+	default:
+	}
+	stream.Unsubscribe(filtered)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/exaring/otelpgx"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// serviceName identifies the service in traces unless OTEL_SERVICE_NAME overrides it
+const serviceName = "bus-staff-assignment"
+
+// tracingEnabled reports whether the standard OTEL_ variables ask for traces
+// to be exported. Tracing stays off until an OTLP endpoint is configured, so
+// local runs don't log export failures.
+func tracingEnabled() bool {
+	if os.Getenv("OTEL_SDK_DISABLED") == "true" || strings.EqualFold(os.Getenv("OTEL_TRACES_EXPORTER"), "none") {
+		return false
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// SetupTracing exports spans over OTLP/HTTP, configured by the standard
+// OTEL_EXPORTER_OTLP_* variables, and propagates W3C traceparent and baggage
+// headers. The returned function flushes pending spans and must be called on
+// shutdown.
+func SetupTracing(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !tracingEnabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence over the defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// The sampler follows OTEL_TRACES_SAMPLER and OTEL_TRACES_SAMPLER_ARG
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	log.Printf("Exporting OpenTelemetry traces over OTLP")
+	return provider.Shutdown, nil
+}
+
+// traceRequests starts a server span for every request except health checks,
+// probes and the long-lived assignment stream, continuing the caller's trace
+// when it sends a traceparent header
+func traceRequests() gin.HandlerFunc {
+	return otelgin.Middleware(serviceName, otelgin.WithGinFilter(func(c *gin.Context) bool {
+		path := c.FullPath()
+		return path != "/health" && path != "/healthz" && path != "/readyz" &&
+			path != "/api/v1/assignments/stream" && path != "/api/assignments/stream"
+	}))
+}
+
+// newQueryTracer records a span for every query run through the pool
+func newQueryTracer() *otelpgx.Tracer {
+	return otelpgx.NewTracer(otelpgx.WithTrimSQLInSpanName())
+}
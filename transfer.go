@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TransferRequest describes a staff member moving to another depot
+type TransferRequest struct {
+	ToDepot         string `json:"to_depot" binding:"required"`
+	TransferDate    string `json:"transfer_date" binding:"required"` // YYYY-MM-DD format
+	CopyAssignments bool   `json:"copy_assignments"`
+}
+
+// TransferFlag highlights an assignment affected by a transfer that needs a dispatcher's attention
+type TransferFlag struct {
+	AssignmentID string `json:"assignment_id"` // public ID
+	BusID        int    `json:"bus_id"`
+	Reason       string `json:"reason"`
+}
+
+// TransferResult describes what a depot transfer changed
+type TransferResult struct {
+	StaffID      int            `json:"staff_id"`
+	ToDepot      string         `json:"to_depot"`
+	TransferDate time.Time      `json:"transfer_date"`
+	Ended        []Assignment   `json:"ended"`     // running assignments ended the day before the transfer
+	Cancelled    []Assignment   `json:"cancelled"` // future assignments at the old depot
+	Copied       []Assignment   `json:"copied"`    // copies on equivalent buses at the new depot
+	Flags        []TransferFlag `json:"flags"`
+}
+
+// busDepot returns the depot a bus belongs to, or "" if the bus is unknown
+func busDepot(busID int) string {
+	if bus, exists := mockBuses[busID]; exists {
+		return bus["depot"]
+	}
+	return ""
+}
+
+// equivalentBuses lists buses at the depot with the same model as the given
+// bus, in ID order so copies are placed deterministically
+func equivalentBuses(busID int, depot string) []int {
+	source, exists := mockBuses[busID]
+	if !exists {
+		return nil
+	}
+
+	var ids []int
+	for id, bus := range mockBuses {
+		if bus["depot"] == depot && bus["model"] == source["model"] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// transferStaff ends a staff member's assignments at other depots from the
+// transfer date. Assignments already running are ended the day before; those
+// starting later are cancelled and flagged so the old depot can find cover.
+// When copyAssignments is set, each affected assignment is recreated on the
+// first equivalent bus at the new depot whose slot is free. The repository
+// changes nothing if the guard wants the transfer confirmed first.
+func transferStaff(tx assignmentTx, staffID int, toDepot string, transferDate time.Time, copyAssignments bool,
+	actor string, guard *bulkGuard) (*TransferResult, error) {
+	result := &TransferResult{
+		StaffID:      staffID,
+		ToDepot:      toDepot,
+		TransferDate: transferDate,
+		Ended:        []Assignment{},
+		Cancelled:    []Assignment{},
+		Copied:       []Assignment{},
+		Flags:        []TransferFlag{},
+	}
+
+	affected, err := tx.runningFrom(0, staffID, transferDate)
+	if err != nil {
+		return nil, err
+	}
+
+	var originals, ending, cancelling []Assignment
+	for _, assignment := range affected {
+		if busDepot(assignment.BusID) == toDepot {
+			continue
+		}
+		originals = append(originals, assignment)
+		if assignment.StartDate.Before(transferDate) {
+			ending = append(ending, assignment)
+		} else {
+			cancelling = append(cancelling, assignment)
+		}
+	}
+	if err := guard.check(newBulkImpact("transfer_staff", ending, cancelling)); err != nil {
+		return nil, err
+	}
+
+	for _, assignment := range originals {
+		if assignment.StartDate.Before(transferDate) {
+			dayBefore := transferDate.AddDate(0, 0, -1)
+			assignment.EndDate = &dayBefore
+			if err := tx.update(&assignment, actor); err != nil {
+				return nil, err
+			}
+			result.Ended = append(result.Ended, assignment)
+		} else {
+			assignment.Status = "cancelled"
+			if err := tx.update(&assignment, actor); err != nil {
+				return nil, err
+			}
+			result.Cancelled = append(result.Cancelled, assignment)
+			result.Flags = append(result.Flags, TransferFlag{
+				AssignmentID: assignment.PublicID,
+				BusID:        assignment.BusID,
+				Reason:       fmt.Sprintf("future %s slot left without cover", assignment.Role),
+			})
+		}
+	}
+
+	// Copy only after every old-depot assignment has ended, so the copies
+	// don't clash with the staff member's own outgoing assignments
+	if !copyAssignments {
+		return result, nil
+	}
+	for _, original := range originals {
+		copied, err := copyToDepot(tx, &original, toDepot, transferDate, actor)
+		if err != nil {
+			return nil, err
+		}
+		if copied == nil {
+			result.Flags = append(result.Flags, TransferFlag{
+				AssignmentID: original.PublicID,
+				BusID:        original.BusID,
+				Reason:       fmt.Sprintf("no equivalent bus with a free %s slot at depot %s", original.Role, toDepot),
+			})
+			continue
+		}
+		result.Copied = append(result.Copied, *copied)
+	}
+	return result, nil
+}
+
+// copyToDepot recreates an assignment on the first conflict-free equivalent
+// bus at the depot, starting no earlier than the transfer date. It returns
+// nil when no such bus exists.
+func copyToDepot(tx assignmentTx, original *Assignment, depot string, transferDate time.Time,
+	actor string) (*Assignment, error) {
+	startDate := original.StartDate
+	if startDate.Before(transferDate) {
+		startDate = transferDate
+	}
+
+	for _, busID := range equivalentBuses(original.BusID, depot) {
+		candidate := Assignment{
+			BusID:           busID,
+			StaffID:         original.StaffID,
+			Role:            original.Role,
+			StartDate:       startDate,
+			EndDate:         original.EndDate,
+			WorkingDays:     original.WorkingDays,
+			ShiftStart:      original.ShiftStart,
+			ShiftEnd:        original.ShiftEnd,
+			DualRoleAllowed: original.DualRoleAllowed,
+			Status:          "active",
+		}
+
+		conflicts, err := tx.conflicts(&candidate)
+		if err != nil {
+			return nil, err
+		}
+		if len(conflicts) > 0 {
+			continue
+		}
+
+		if err := tx.create(&candidate, actor); err != nil {
+			return nil, err
+		}
+		return &candidate, nil
+	}
+	return nil, nil
+}
+
+func (h *AssignmentHandler) handleTransferStaff(c *gin.Context) {
+	h = h.forRequest(c)
+	staffIDStr := c.Param("staffId")
+	staffID, err := strconv.Atoi(staffIDStr)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid staff ID")
+		return
+	}
+
+	var req TransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, &req, err)
+		return
+	}
+
+	transferDate, err := time.Parse("2006-01-02", req.TransferDate)
+	if err != nil {
+		respondInvalidField(c, "transfer_date", "Invalid transfer_date format. Use YYYY-MM-DD")
+		return
+	}
+	if !checkCrossDepot(c) {
+		return
+	}
+
+	guard := newBulkGuard(c)
+	result, err := h.repo.TransferStaff(staffID, req.ToDepot, transferDate, req.CopyAssignments,
+		actorFromContext(c), guard)
+	if err != nil {
+		if !respondDeletionHold(c, err) || !respondBulkConfirmation(c, err) {
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Failed to transfer staff member")
+		return
+	}
+
+	guard.report()
+	c.JSON(http.StatusOK, result)
+}
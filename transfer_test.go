@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTransferStaff(t *testing.T) {
+	router, repo := newTestRouter(t)
+	running := mustCreate(t, repo, Assignment{BusID: 2, StaffID: 2, Role: "conductor", StartDate: date("2025-03-03")})
+	end := date("2025-04-13")
+	upcoming := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 2, Role: "conductor", StartDate: date("2025-04-07"),
+		EndDate: &end})
+	// Bus 3's conductor slot is taken, so the bus 1 copy has nowhere to go
+	mustCreate(t, repo, Assignment{BusID: 3, StaffID: 5, Role: "conductor", StartDate: date("2025-03-01")})
+
+	rec := doRequest(router, http.MethodPost, "/api/v1/staff/2/transfer", gin.H{
+		"to_depot": "south", "transfer_date": "2025-03-24", "copy_assignments": true,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("transfer = %d %s", rec.Code, rec.Body.String())
+	}
+	result := decode[TransferResult](t, rec)
+	if len(result.Ended) != 1 || result.Ended[0].PublicID != running.PublicID || len(result.Cancelled) != 1 ||
+		result.Cancelled[0].PublicID != upcoming.PublicID {
+		t.Errorf("result = %+v, want the running assignment ended and the upcoming one cancelled", result)
+	}
+	if len(result.Copied) != 1 || result.Copied[0].BusID != 4 || !result.Copied[0].StartDate.Equal(date("2025-03-24")) {
+		t.Errorf("copied = %+v, want the running assignment copied to bus 4 from the transfer date", result.Copied)
+	}
+	if len(result.Flags) != 2 {
+		t.Errorf("flags = %+v, want the uncovered slot and the copy with no free bus", result.Flags)
+	}
+	if got, _ := repo.Get(upcoming.ID); got == nil || got.Status != "cancelled" {
+		t.Errorf("upcoming assignment = %+v, want it cancelled", got)
+	}
+}
@@ -0,0 +1,249 @@
+// Admin UI for the bus staff assignment API. Every call is made with the
+// admin's bearer token, which is kept in sessionStorage for the tab's lifetime.
+// Data is only ever written to the page as text, never as markup.
+"use strict";
+
+const tokenKey = "bus-staff-assignment-token";
+
+const $ = (id) => document.getElementById(id);
+
+function setStatus(message) {
+  $("status").textContent = message || "";
+}
+
+async function api(path) {
+  const response = await fetch(path, {
+    headers: { Authorization: "Bearer " + sessionStorage.getItem(tokenKey) },
+  });
+  const body = await response.json().catch(() => ({}));
+  if (response.status === 401) {
+    signOut();
+    throw new Error("Your token was rejected; sign in again");
+  }
+  if (!response.ok) {
+    throw new Error((body.error && body.error.message) || response.statusText);
+  }
+  return body;
+}
+
+// query builds a query string from a form, leaving out empty fields
+function query(form) {
+  const params = new URLSearchParams();
+  for (const [name, value] of new FormData(form)) {
+    if (value !== "") {
+      params.set(name, value);
+    }
+  }
+  const encoded = params.toString();
+  return encoded ? "?" + encoded : "";
+}
+
+// fillTable replaces a table's contents; columns are [heading, value(row)] pairs
+function fillTable(table, columns, rows, onSelect) {
+  table.replaceChildren();
+  const head = table.createTHead().insertRow();
+  for (const [heading] of columns) {
+    const th = document.createElement("th");
+    th.textContent = heading;
+    head.appendChild(th);
+  }
+  const body = table.createTBody();
+  for (const row of rows) {
+    const tr = body.insertRow();
+    for (const [, value] of columns) {
+      const cell = tr.insertCell();
+      const content = value(row);
+      if (content instanceof Node) {
+        cell.appendChild(content);
+      } else {
+        cell.textContent = content ?? "";
+      }
+    }
+    if (onSelect) {
+      tr.className = "selectable";
+      tr.addEventListener("click", () => onSelect(row));
+    }
+  }
+  if (rows.length === 0) {
+    body.insertRow().insertCell().textContent = "Nothing found";
+  }
+}
+
+function json(value) {
+  const pre = document.createElement("pre");
+  pre.textContent = value ? JSON.stringify(value, null, 2) : "";
+  return pre;
+}
+
+function day(value) {
+  return value ? value.slice(0, 10) : "";
+}
+
+function time(value) {
+  return value ? new Date(value).toLocaleString() : "";
+}
+
+async function loadAssignments(event) {
+  event?.preventDefault();
+  const body = await api("/api/v1/assignments" + query($("assignments-form")));
+  $("history").hidden = true;
+  fillTable($("assignments-table"), [
+    ["ID", (a) => a.id],
+    ["Reference", (a) => a.reference],
+    ["Bus", (a) => [a.bus_id, a.bus_plate_number].filter(Boolean).join(" ")],
+    ["Staff", (a) => [a.staff_id, a.staff_name].filter(Boolean).join(" ")],
+    ["Role", (a) => a.role],
+    ["Start", (a) => day(a.start_date)],
+    ["End", (a) => day(a.end_date)],
+    ["Status", (a) => a.status],
+  ], body.assignments, loadHistory);
+}
+
+async function loadHistory(assignment) {
+  const body = await api("/api/v1/assignments/" + encodeURIComponent(assignment.id) + "/history");
+  $("history-id").textContent = assignment.reference || assignment.id;
+  fillTable($("history-table"), [
+    ["When", (e) => time(e.changed_at)],
+    ["Action", (e) => e.action],
+    ["Actor", (e) => e.actor],
+    ["Before", (e) => json(e.before)],
+    ["After", (e) => json(e.after)],
+  ], body.history);
+  $("history").hidden = false;
+}
+
+async function loadRoster(event) {
+  event?.preventDefault();
+  const body = await api("/api/v1/roster" + query($("roster-form")));
+  const container = $("roster-days");
+  container.replaceChildren();
+  for (const rosterDay of body.days) {
+    const section = document.createElement("div");
+    section.className = "day";
+    const heading = document.createElement("h2");
+    heading.textContent = rosterDay.date;
+    const table = document.createElement("table");
+    const crew = rosterDay.buses.flatMap((bus) => bus.crew.map((member) => ({ bus, member })));
+    fillTable(table, [
+      ["Bus", ({ bus }) => [bus.bus_id, bus.bus_plate_number].filter(Boolean).join(" ")],
+      ["Role", ({ member }) => member.role],
+      ["Staff", ({ member }) => [member.staff_id, member.staff_name].filter(Boolean).join(" ")],
+      ["Shift", ({ member }) => [member.shift_start, member.shift_end].filter(Boolean).join("–")],
+    ], crew);
+    section.append(heading, table);
+    container.appendChild(section);
+  }
+}
+
+async function loadPublications(event) {
+  event?.preventDefault();
+  const publications = await api("/api/v1/roster/publications" + query($("publications-form")));
+  fillTable($("publications-table"), [
+    ["ID", (p) => p.id],
+    ["Status", (p) => p.status],
+    ["Published by", (p) => p.published_by],
+    ["Created", (p) => time(p.created_at)],
+    ["Steps", (p) => p.steps.map((s) => s.participant + ": " + s.status + (s.error ? " (" + s.error + ")" : "")).join("\n")],
+  ], publications);
+}
+
+async function loadActivity(event) {
+  event?.preventDefault();
+  const body = await api("/api/v1/activity" + query($("activity-form")));
+  fillTable($("activity-table"), [
+    ["When", (a) => time(a.occurred_at)],
+    ["Type", (a) => a.type],
+    ["Depot", (a) => a.depot],
+    ["Actor", (a) => a.actor],
+    ["Summary", (a) => a.summary],
+  ], body.activity);
+}
+
+const loaders = {
+  assignments: loadAssignments,
+  activity: loadActivity,
+};
+
+function showTab(name) {
+  for (const button of document.querySelectorAll("#tabs [data-tab]")) {
+    button.classList.toggle("active", button.dataset.tab === name);
+  }
+  for (const section of document.querySelectorAll(".tab")) {
+    section.hidden = section.id !== name;
+  }
+  setStatus("");
+  loaders[name]?.().catch((err) => setStatus(err.message));
+}
+
+function showSignedIn(signedIn) {
+  $("sign-in").hidden = signedIn;
+  $("tabs").hidden = !signedIn;
+  if (signedIn) {
+    showTab("assignments");
+  } else {
+    for (const section of document.querySelectorAll(".tab")) {
+      section.hidden = true;
+    }
+  }
+}
+
+// signIn checks the token against an admin-only endpoint before using it
+async function signIn(token) {
+  sessionStorage.setItem(tokenKey, token);
+  try {
+    await api("/api/v1/admin/maintenance");
+    showSignedIn(true);
+  } catch (err) {
+    sessionStorage.removeItem(tokenKey);
+    setStatus(err.message);
+    showSignedIn(false);
+  }
+}
+
+function signOut() {
+  sessionStorage.removeItem(tokenKey);
+  showSignedIn(false);
+}
+
+function defaultWeek(form) {
+  const start = new Date();
+  start.setDate(start.getDate() - ((start.getDay() + 6) % 7));
+  const end = new Date(start);
+  end.setDate(start.getDate() + 6);
+  form.elements.from.value = start.toISOString().slice(0, 10);
+  form.elements.to.value = end.toISOString().slice(0, 10);
+}
+
+document.addEventListener("DOMContentLoaded", () => {
+  const forms = {
+    "assignments-form": loadAssignments,
+    "roster-form": loadRoster,
+    "publications-form": loadPublications,
+    "activity-form": loadActivity,
+  };
+  for (const [id, load] of Object.entries(forms)) {
+    $(id).addEventListener("submit", (event) => {
+      setStatus("");
+      load(event).catch((err) => setStatus(err.message));
+    });
+  }
+  defaultWeek($("roster-form"));
+  defaultWeek($("publications-form"));
+
+  for (const button of document.querySelectorAll("#tabs [data-tab]")) {
+    button.addEventListener("click", () => showTab(button.dataset.tab));
+  }
+  $("sign-out").addEventListener("click", signOut);
+  $("sign-in-form").addEventListener("submit", (event) => {
+    event.preventDefault();
+    signIn($("token").value);
+    $("token").value = "";
+  });
+
+  const token = sessionStorage.getItem(tokenKey);
+  if (token) {
+    signIn(token);
+  } else {
+    showSignedIn(false);
+  }
+});
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/rand"
+	"strings"
+	"time"
+)
+
+// crockford is the base32 alphabet ULIDs are written in
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidLength is the length of an encoded ULID
+const ulidLength = 26
+
+// newULID returns a ULID for the given time: 48 bits of milliseconds followed
+// by 80 random bits, so IDs sort by creation time but can't be guessed from
+// one another
+func newULID(t time.Time) (string, error) {
+	var data [16]byte
+	ms := uint64(t.UnixMilli())
+	for i := 5; i >= 0; i-- {
+		data[i] = byte(ms)
+		ms >>= 8
+	}
+	if _, err := rand.Read(data[6:]); err != nil {
+		return "", err
+	}
+
+	// 26 characters hold 130 bits, so the first carries only the top 3 bits
+	out := make([]byte, ulidLength)
+	for i := range out {
+		var value int
+		for bit := 5*i - 2; bit < 5*i+3; bit++ {
+			value <<= 1
+			if bit >= 0 && data[bit/8]&(0x80>>(bit%8)) != 0 {
+				value |= 1
+			}
+		}
+		out[i] = crockford[value]
+	}
+	return string(out), nil
+}
+
+// normalizeULID upper-cases a ULID from a URL, since ULIDs are case-insensitive.
+// It returns false when the value isn't a ULID at all.
+func normalizeULID(value string) (string, bool) {
+	value = strings.ToUpper(value)
+	if len(value) != ulidLength || value[0] > '7' {
+		return "", false
+	}
+	for i := 0; i < len(value); i++ {
+		if strings.IndexByte(crockford, value[i]) < 0 {
+			return "", false
+		}
+	}
+	return value, true
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewULID(t *testing.T) {
+	earlier, err := newULID(date("2025-01-01"))
+	if err != nil {
+		t.Fatalf("newULID: %v", err)
+	}
+	later, err := newULID(date("2025-01-01").Add(time.Millisecond))
+	if err != nil {
+		t.Fatalf("newULID: %v", err)
+	}
+
+	if _, valid := normalizeULID(earlier); !valid {
+		t.Errorf("%q is not a valid ULID", earlier)
+	}
+	if earlier >= later {
+		t.Errorf("%q should sort before %q", earlier, later)
+	}
+	// The timestamp prefix of a known instant, from the ULID spec
+	if got, _ := newULID(time.UnixMilli(1469922850259)); got[:10] != "01ARZ3NDEK" {
+		t.Errorf("timestamp prefix = %q, want 01ARZ3NDEK", got[:10])
+	}
+
+	again, _ := newULID(date("2025-01-01"))
+	if again == earlier {
+		t.Error("two ULIDs from the same millisecond are equal")
+	}
+}
+
+func TestNormalizeULID(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		valid bool
+	}{
+		{"01ARZ3NDEKTSV4RRFFQ69G5FAV", "01ARZ3NDEKTSV4RRFFQ69G5FAV", true},
+		{"01arz3ndektsv4rrffq69g5fav", "01ARZ3NDEKTSV4RRFFQ69G5FAV", true},
+		{"42", "", false},
+		{"01ARZ3NDEKTSV4RRFFQ69G5FAU", "", false}, // U is not in the alphabet
+		{"81ARZ3NDEKTSV4RRFFQ69G5FAV", "", false}, // overflows 128 bits
+	}
+	for _, tt := range tests {
+		got, valid := normalizeULID(tt.value)
+		if got != tt.want || valid != tt.valid {
+			t.Errorf("normalizeULID(%q) = %q, %v, want %q, %v", tt.value, got, valid, tt.want, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errStaleVersion is returned by writes made against an assignment version
+// that is no longer current
+var errStaleVersion = errors.New("assignment has been modified since it was read")
+
+// assignmentETag is the entity tag of an assignment version
+func assignmentETag(version int) string {
+	return fmt.Sprintf("%q", strconv.Itoa(version))
+}
+
+func setAssignmentETag(c *gin.Context, assignment *Assignment) {
+	c.Header("ETag", assignmentETag(assignment.Version))
+}
+
+// checkExpectedVersion requires the caller to say which version of the
+// assignment they are changing, in If-Match or else in the version field, so
+// two dispatchers can't silently overwrite each other. If-Match: * accepts
+// any version. It returns false once a 428 or 412 response has been written.
+func checkExpectedVersion(c *gin.Context, assignment *Assignment, fieldVersion int) bool {
+	ifMatch := strings.TrimSpace(c.GetHeader("If-Match"))
+	switch {
+	case ifMatch == "*":
+		return true
+	case ifMatch != "":
+		if ifMatch != assignmentETag(assignment.Version) && ifMatch != "W/"+assignmentETag(assignment.Version) {
+			respondStaleVersion(c, assignment)
+			return false
+		}
+		return true
+	case fieldVersion != 0:
+		if fieldVersion != assignment.Version {
+			respondStaleVersion(c, assignment)
+			return false
+		}
+		return true
+	}
+
+	respondError(c, http.StatusPreconditionRequired, "Send the version you are changing in If-Match or the version field")
+	return false
+}
+
+// respondStaleVersion writes a 412 for a write made against an old version.
+// current is the stored assignment, or nil when it isn't known.
+func respondStaleVersion(c *gin.Context, current *Assignment) {
+	body := gin.H{"error": newAPIError(http.StatusPreconditionFailed, "Assignment has been modified since you loaded it; reload and try again")}
+	if current != nil {
+		setAssignmentETag(c, current)
+		body["current_version"] = current.Version
+	}
+	c.JSON(http.StatusPreconditionFailed, body)
+}
+
+// versionQuery reads the optional version query parameter that bodiless
+// writes use in place of the version field. It returns false once a 400
+// response has been written.
+func versionQuery(c *gin.Context) (int, bool) {
+	value := c.Query("version")
+	if value == "" {
+		return 0, true
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		respondInvalidField(c, "version", "Invalid version")
+		return 0, false
+	}
+	return version, true
+}
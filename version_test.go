@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAssignmentVersionPreconditions(t *testing.T) {
+	router, repo := newTestRouter(t)
+	existing := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+	path := "/api/assignments/" + existing.PublicID
+
+	rec := doRequest(router, http.MethodGet, path, nil)
+	if etag := rec.Header().Get("ETag"); etag != `"1"` {
+		t.Fatalf("ETag = %q, want %q", etag, `"1"`)
+	}
+
+	body := gin.H{"bus_id": 2, "staff_id": 1, "role": "driver", "start_date": "2025-01-01"}
+	rec = doRequest(router, http.MethodPut, path, body, "If-Match", `"1"`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if etag := rec.Header().Get("ETag"); etag != `"2"` {
+		t.Errorf("ETag after update = %q, want %q", etag, `"2"`)
+	}
+
+	// A second dispatcher still holding version 1 must not overwrite the change
+	rec = doRequest(router, http.MethodPut, path, body, "If-Match", `"1"`)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale status = %d, want %d: %s", rec.Code, http.StatusPreconditionFailed, rec.Body.String())
+	}
+	if got := decode[struct {
+		CurrentVersion int `json:"current_version"`
+	}](t, rec); got.CurrentVersion != 2 {
+		t.Errorf("current_version = %d, want 2", got.CurrentVersion)
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     any
+		headers  []string
+		wantCode int
+	}{
+		{"patch without a version", http.MethodPatch, path, gin.H{"role": "conductor"}, nil, http.StatusPreconditionRequired},
+		{"patch with a stale version field", http.MethodPatch, path, gin.H{"role": "conductor", "version": 1}, nil, http.StatusPreconditionFailed},
+		{"delete without a version", http.MethodDelete, path, nil, nil, http.StatusPreconditionRequired},
+		{"delete with a stale version", http.MethodDelete, path + "?version=1", nil, nil, http.StatusPreconditionFailed},
+		{"delete with a weak tag", http.MethodDelete, path, nil, []string{"If-Match", `W/"2"`}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(router, tt.method, tt.path, tt.body, tt.headers...)
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantCode, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestMemoryRepositoryRejectsStaleVersion(t *testing.T) {
+	repo := NewMemoryAssignmentRepository()
+	first := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+	second := first
+
+	first.BusID = 2
+	if err := repo.Update(&first, "dispatcher-1"); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	second.BusID = 3
+	if err := repo.Update(&second, "dispatcher-2"); !errors.Is(err, errStaleVersion) {
+		t.Errorf("stale Update error = %v, want errStaleVersion", err)
+	}
+	if err := repo.Delete(first.ID, 1, "dispatcher-2"); !errors.Is(err, errStaleVersion) {
+		t.Errorf("stale Delete error = %v, want errStaleVersion", err)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiHandlers are built once and shared by every API version. A version that
+// changes a response shape registers its own handler or serializer for that
+// route and keeps sharing the rest.
+type apiHandlers struct {
+	assignments    *AssignmentHandler
+	views          *ViewHandler
+	availability   *AvailabilityHandler
+	calendars      *DepotCalendarHandler
+	scenarios      *ScenarioHandler
+	notifications  *NotificationHandler
+	publications   *PublicationHandler
+	idempotency    IdempotencyRepository
+	exports        *ExportJobHandler
+	qualifications *QualificationHandler
+	recurring      *RecurringTemplateHandler
+	callbackKeys   *CallbackKeyHandler
+	shifts         *ShiftHandler
+	ruleModes      *RuleModeHandler
+}
+
+// deprecatedAlias marks responses served on an unversioned path as
+// deprecated, linking to the same route under the versioned prefix
+func deprecatedAlias(successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", "<"+successor+strings.TrimPrefix(c.Request.URL.Path, "/api")+`>; rel="successor-version"`)
+		c.Next()
+	}
+}
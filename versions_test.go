@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestVersionedAndLegacyPaths(t *testing.T) {
+	router, repo := newTestRouter(t)
+	created := mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03")})
+
+	v1 := doRequest(router, http.MethodGet, "/api/v1/assignments/"+created.PublicID, nil)
+	if v1.Code != http.StatusOK || v1.Header().Get("Deprecation") != "" {
+		t.Fatalf("v1 status = %d, Deprecation = %q", v1.Code, v1.Header().Get("Deprecation"))
+	}
+
+	legacy := doRequest(router, http.MethodGet, "/api/assignments/"+created.PublicID, nil)
+	if legacy.Code != http.StatusOK || legacy.Body.String() != v1.Body.String() {
+		t.Errorf("legacy = %d %s, want the v1 response", legacy.Code, legacy.Body.String())
+	}
+	if legacy.Header().Get("Deprecation") != "true" ||
+		legacy.Header().Get("Link") != `</api/v1/assignments/`+created.PublicID+`>; rel="successor-version"` {
+		t.Errorf("legacy headers = %v, want deprecation pointing at v1", legacy.Header())
+	}
+}
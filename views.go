@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxViewNameLength matches the saved_views.name column
+const maxViewNameLength = 100
+
+// SavedView is a named assignment filter and sort order saved by a user
+type SavedView struct {
+	ID        int              `json:"id"`
+	Owner     string           `json:"owner"`
+	Name      string           `json:"name"`
+	Filter    AssignmentFilter `json:"filter"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// SaveViewRequest holds the filter stored under a view's name
+type SaveViewRequest struct {
+	Filter AssignmentFilter `json:"filter"`
+}
+
+// ViewRepository stores saved views. Views are scoped to their owner, so
+// names only have to be unique per user.
+type ViewRepository interface {
+	Save(view *SavedView) error                 // creates the view or replaces its filter
+	Get(owner, name string) (*SavedView, error) // nil, nil when not found
+	List(owner string) ([]SavedView, error)
+	Delete(owner, name string) (bool, error)
+
+	WithContext(ctx context.Context) ViewRepository
+}
+
+// ViewHandler serves the saved view endpoints
+type ViewHandler struct {
+	views       ViewRepository
+	assignments AssignmentRepository
+}
+
+// NewViewHandler creates a handler storing views in the given repository and
+// applying them to the given assignments
+func NewViewHandler(views ViewRepository, assignments AssignmentRepository) *ViewHandler {
+	return &ViewHandler{views: views, assignments: assignments}
+}
+
+// forRequest returns the handler with its repositories bound to the request's context
+func (h *ViewHandler) forRequest(c *gin.Context) *ViewHandler {
+	ctx := c.Request.Context()
+	return &ViewHandler{views: h.views.WithContext(ctx), assignments: h.assignments.WithContext(ctx)}
+}
+
+// viewName reads the :name path parameter
+func viewName(c *gin.Context) string {
+	return strings.TrimSpace(c.Param("name"))
+}
+
+// viewFromParam loads the caller's view named by the :name path parameter. It
+// returns nil once an error response has been written.
+func (h *ViewHandler) viewFromParam(c *gin.Context) *SavedView {
+	view, err := h.views.Get(actorFromContext(c), viewName(c))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Database error")
+		return nil
+	}
+	if view == nil {
+		respondError(c, http.StatusNotFound, "View not found")
+		return nil
+	}
+	return view
+}
+
+func (h *ViewHandler) handleGetViews(c *gin.Context) {
+	h = h.forRequest(c)
+	views, err := h.views.List(actorFromContext(c))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve views")
+		return
+	}
+	if views == nil {
+		views = []SavedView{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"views": views, "count": len(views)})
+}
+
+func (h *ViewHandler) handleGetView(c *gin.Context) {
+	h = h.forRequest(c)
+	if view := h.viewFromParam(c); view != nil {
+		c.JSON(http.StatusOK, view)
+	}
+}
+
+func (h *ViewHandler) handleSaveView(c *gin.Context) {
+	h = h.forRequest(c)
+	name := viewName(c)
+	if name == "" || utf8.RuneCountInString(name) > maxViewNameLength {
+		respondError(c, http.StatusBadRequest, "View name must be between 1 and 100 characters")
+		return
+	}
+
+	var req SaveViewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, &req, err)
+		return
+	}
+	if fieldErr := validateAssignmentFilter(req.Filter); fieldErr != nil {
+		fieldErr.Field = "filter." + fieldErr.Field
+		respondInvalid(c, *fieldErr)
+		return
+	}
+
+	view := SavedView{Owner: actorFromContext(c), Name: name, Filter: req.Filter}
+	if err := h.views.Save(&view); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to save view")
+		return
+	}
+
+	c.JSON(http.StatusOK, view)
+}
+
+func (h *ViewHandler) handleDeleteView(c *gin.Context) {
+	h = h.forRequest(c)
+	deleted, err := h.views.Delete(actorFromContext(c), viewName(c))
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to delete view")
+		return
+	}
+	if !deleted {
+		respondError(c, http.StatusNotFound, "View not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "View deleted successfully"})
+}
+
+func (h *ViewHandler) handleGetViewAssignments(c *gin.Context) {
+	h = h.forRequest(c)
+	view := h.viewFromParam(c)
+	if view == nil {
+		return
+	}
+
+	filter := view.Filter
+	filter.Clearance = callerClearance(c)
+	assignments, err := h.assignments.List(filter)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve assignments")
+		return
+	}
+
+	assignmentList := withDetails(assignments)
+	c.JSON(http.StatusOK, gin.H{"view": view, "assignments": assignmentList, "count": len(assignmentList)})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSavedViews(t *testing.T) {
+	router, repo := newTestRouter(t)
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-01-01")})
+	mustCreate(t, repo, Assignment{BusID: 2, StaffID: 2, Role: "conductor", StartDate: date("2025-01-01")})
+	mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-02-01")})
+
+	rec := doRequest(router, http.MethodPut, "/api/views/North%20drivers", gin.H{
+		"filter": gin.H{"depot": "north", "role": "driver", "sort": "start_date"},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("save status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	saved := decode[SavedView](t, rec)
+
+	rec = doRequest(router, http.MethodGet, "/api/views/North%20drivers/assignments", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("apply status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := decode[struct {
+		Assignments []AssignmentWithDetails
+		Count       int
+	}](t, rec)
+	if body.Count != 1 || body.Assignments[0].BusID != 1 {
+		t.Errorf("view matched %+v, want the bus 1 driver", body.Assignments)
+	}
+
+	// Saving under the same name replaces the filter but keeps the view
+	rec = doRequest(router, http.MethodPut, "/api/views/North%20drivers", gin.H{"filter": gin.H{"role": "driver"}})
+	if replaced := decode[SavedView](t, rec); replaced.ID != saved.ID || replaced.Filter.Depot != "" {
+		t.Errorf("replaced view = %+v, want id %d without depot", replaced, saved.ID)
+	}
+
+	rec = doRequest(router, http.MethodGet, "/api/views", nil)
+	if list := decode[struct{ Count int }](t, rec); list.Count != 1 {
+		t.Errorf("view count = %d, want 1", list.Count)
+	}
+
+	if rec := doRequest(router, http.MethodDelete, "/api/views/North%20drivers", nil); rec.Code != http.StatusOK {
+		t.Errorf("delete status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/views/North%20drivers", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("deleted view status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestSaveViewValidation(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	for _, filter := range []gin.H{
+		{"status": "paused"},
+		{"role": "pilot"},
+		{"sort": "plate_number"},
+	} {
+		rec := doRequest(router, http.MethodPut, "/api/views/bad", gin.H{"filter": filter})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%v: status = %d, want %d", filter, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestSavedViewsAreOwnedByCaller(t *testing.T) {
+	secret := []byte("test-secret")
+	router := gin.New()
+	setupRoutes(router, AuthConfig{Secret: secret}, NewMemoryStorage())
+
+	alice := bearerToken(t, secret, "alice", RoleViewer)
+	bob := bearerToken(t, secret, "bob", RoleViewer)
+
+	rec := doRequest(router, http.MethodPut, "/api/views/mine", gin.H{"filter": gin.H{}}, "Authorization", alice)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("save status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if rec := doRequest(router, http.MethodGet, "/api/views/mine", nil, "Authorization", bob); rec.Code != http.StatusNotFound {
+		t.Errorf("other user's view status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := doRequest(router, http.MethodGet, "/api/views/mine", nil, "Authorization", alice); rec.Code != http.StatusOK {
+		t.Errorf("own view status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
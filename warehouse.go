@@ -0,0 +1,557 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// warehouseLockID keeps replicas from exporting the same rows at once
+const warehouseLockID = 80820006
+
+const warehouseBatchSize = 1000
+
+// Watermark streams, one row each in warehouse_watermarks
+const (
+	warehouseFactsStream      = "assignment_facts"
+	warehouseDimensionsStream = "dimensions"
+)
+
+// warehouseTable is a warehouse table and its columns, in load order
+type warehouseTable struct {
+	Name    string
+	Columns []string
+}
+
+var (
+	assignmentFactsTable = warehouseTable{"assignment_facts", []string{"assignment_id", "version", "reference",
+		"bus_id", "staff_id", "role", "start_date", "end_date", "working_days", "shift_start", "shift_end", "status",
+		"pay_class", "holiday_dates", "created_at", "updated_at", "deleted_at", "exported_at"}}
+	busDimensionTable   = warehouseTable{"dim_bus", []string{"snapshot_date", "bus_id", "plate_number", "model", "depot"}}
+	staffDimensionTable = warehouseTable{"dim_staff", []string{"snapshot_date", "staff_id", "name", "position",
+		"depot", "hire_date"}}
+)
+
+// warehouseRow is one row to load. Values follow the table's columns; nil is
+// NULL. InsertID is stable across retries, so a batch loaded twice can be told
+// apart from new rows.
+type warehouseRow struct {
+	InsertID string
+	Values   []any
+}
+
+// WarehouseSink loads rows into a data warehouse
+type WarehouseSink interface {
+	Load(ctx context.Context, table warehouseTable, rows []warehouseRow) error
+}
+
+// NewWarehouseSink builds the sink selected by WAREHOUSE_DRIVER (bigquery,
+// snowflake or none). With none it returns nil and nothing is exported.
+func NewWarehouseSink() (WarehouseSink, error) {
+	driver := strings.ToLower(os.Getenv("WAREHOUSE_DRIVER"))
+	switch driver {
+	case "", "none":
+		return nil, nil
+	case "bigquery":
+		return newBigQuerySink()
+	case "snowflake":
+		return newSnowflakeSink()
+	default:
+		return nil, fmt.Errorf("unsupported WAREHOUSE_DRIVER %q (use bigquery, snowflake or none)", driver)
+	}
+}
+
+// warehouseToken reads the OAuth access token from WAREHOUSE_TOKEN_FILE on
+// every load, so a sidecar can rotate it, or else from WAREHOUSE_TOKEN
+type warehouseToken struct {
+	file, static string
+}
+
+func loadWarehouseToken() (warehouseToken, error) {
+	token := warehouseToken{file: os.Getenv("WAREHOUSE_TOKEN_FILE"), static: os.Getenv("WAREHOUSE_TOKEN")}
+	if token.file == "" && token.static == "" {
+		return token, fmt.Errorf("WAREHOUSE_TOKEN or WAREHOUSE_TOKEN_FILE is required when WAREHOUSE_DRIVER is set")
+	}
+	return token, nil
+}
+
+func (t warehouseToken) get() (string, error) {
+	if t.file == "" {
+		return t.static, nil
+	}
+	data, err := os.ReadFile(t.file)
+	if err != nil {
+		return "", fmt.Errorf("reading warehouse token: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// warehouseClient posts JSON to a warehouse's REST API
+type warehouseClient struct {
+	client *http.Client
+	token  warehouseToken
+}
+
+func newWarehouseClient() (warehouseClient, error) {
+	token, err := loadWarehouseToken()
+	return warehouseClient{
+		client: &http.Client{Timeout: durationFromEnv("WAREHOUSE_TIMEOUT", 60*time.Second)},
+		token:  token,
+	}, err
+}
+
+// post sends the body and decodes a 2xx response into out
+func (w warehouseClient) post(ctx context.Context, url string, headers map[string]string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	token, err := w.token.get()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("warehouse returned %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// bigQuerySink streams rows into BIGQUERY_PROJECT.BIGQUERY_DATASET with
+// tabledata.insertAll, which de-duplicates retried rows by insert ID
+type bigQuerySink struct {
+	warehouseClient
+	baseURL, project, dataset string
+}
+
+func newBigQuerySink() (*bigQuerySink, error) {
+	client, err := newWarehouseClient()
+	if err != nil {
+		return nil, err
+	}
+	sink := &bigQuerySink{
+		warehouseClient: client,
+		baseURL:         "https://bigquery.googleapis.com/bigquery/v2",
+		project:         os.Getenv("BIGQUERY_PROJECT"),
+		dataset:         os.Getenv("BIGQUERY_DATASET"),
+	}
+	if sink.project == "" || sink.dataset == "" {
+		return nil, fmt.Errorf("BIGQUERY_PROJECT and BIGQUERY_DATASET are required when WAREHOUSE_DRIVER=bigquery")
+	}
+	log.Printf("Exporting to BigQuery dataset %s.%s", sink.project, sink.dataset)
+	return sink, nil
+}
+
+func (s *bigQuerySink) Load(ctx context.Context, table warehouseTable, rows []warehouseRow) error {
+	type insertRow struct {
+		InsertID string         `json:"insertId"`
+		JSON     map[string]any `json:"json"`
+	}
+	request := struct {
+		Rows []insertRow `json:"rows"`
+	}{}
+	for _, row := range rows {
+		values := make(map[string]any, len(table.Columns))
+		for i, column := range table.Columns {
+			values[column] = row.Values[i]
+		}
+		request.Rows = append(request.Rows, insertRow{InsertID: row.InsertID, JSON: values})
+	}
+
+	var response struct {
+		InsertErrors []struct {
+			Index  int `json:"index"`
+			Errors []struct {
+				Reason  string `json:"reason"`
+				Message string `json:"message"`
+			} `json:"errors"`
+		} `json:"insertErrors"`
+	}
+	url := fmt.Sprintf("%s/projects/%s/datasets/%s/tables/%s/insertAll", s.baseURL, s.project, s.dataset, table.Name)
+	if err := s.post(ctx, url, nil, request, &response); err != nil {
+		return err
+	}
+	if len(response.InsertErrors) > 0 {
+		first := response.InsertErrors[0]
+		message := "unknown error"
+		if len(first.Errors) > 0 {
+			message = first.Errors[0].Reason + ": " + first.Errors[0].Message
+		}
+		return fmt.Errorf("BigQuery rejected %d rows of %s, the first at index %d: %s", len(response.InsertErrors),
+			table.Name, first.Index, message)
+	}
+	return nil
+}
+
+// snowflakeSink inserts rows through the Snowflake SQL API. Each batch is
+// sent with a request ID derived from its insert IDs, so Snowflake runs a
+// retried batch only once.
+type snowflakeSink struct {
+	warehouseClient
+	baseURL                           string
+	database, schema, warehouse, role string
+	tokenType                         string // OAUTH or KEYPAIR_JWT
+}
+
+func newSnowflakeSink() (*snowflakeSink, error) {
+	client, err := newWarehouseClient()
+	if err != nil {
+		return nil, err
+	}
+	account := os.Getenv("SNOWFLAKE_ACCOUNT")
+	sink := &snowflakeSink{
+		warehouseClient: client,
+		baseURL:         fmt.Sprintf("https://%s.snowflakecomputing.com", account),
+		database:        os.Getenv("SNOWFLAKE_DATABASE"),
+		schema:          os.Getenv("SNOWFLAKE_SCHEMA"),
+		warehouse:       os.Getenv("SNOWFLAKE_WAREHOUSE"),
+		role:            os.Getenv("SNOWFLAKE_ROLE"),
+		tokenType:       strings.ToUpper(os.Getenv("SNOWFLAKE_TOKEN_TYPE")),
+	}
+	if account == "" || sink.database == "" || sink.schema == "" {
+		return nil, fmt.Errorf("SNOWFLAKE_ACCOUNT, SNOWFLAKE_DATABASE and SNOWFLAKE_SCHEMA are required when WAREHOUSE_DRIVER=snowflake")
+	}
+	if sink.tokenType == "" {
+		sink.tokenType = "OAUTH"
+	}
+	log.Printf("Exporting to Snowflake %s.%s", sink.database, sink.schema)
+	return sink, nil
+}
+
+func (s *snowflakeSink) Load(ctx context.Context, table warehouseTable, rows []warehouseRow) error {
+	// Bind each column as an array of text values, one per row, and let
+	// Snowflake cast them to the column types
+	bindings := map[string]any{}
+	placeholders := make([]string, len(table.Columns))
+	for i := range table.Columns {
+		values := make([]*string, len(rows))
+		for j, row := range rows {
+			values[j] = warehouseText(row.Values[i])
+		}
+		bindings[strconv.Itoa(i+1)] = map[string]any{"type": "TEXT", "value": values}
+		placeholders[i] = "?"
+	}
+	request := map[string]any{
+		"statement": fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table.Name, strings.Join(table.Columns, ", "),
+			strings.Join(placeholders, ", ")),
+		"bindings":  bindings,
+		"database":  s.database,
+		"schema":    s.schema,
+		"warehouse": s.warehouse,
+		"role":      s.role,
+	}
+
+	var response struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	url := fmt.Sprintf("%s/api/v2/statements?requestId=%s&retry=true", s.baseURL, warehouseRequestID(table, rows))
+	headers := map[string]string{"X-Snowflake-Authorization-Token-Type": s.tokenType}
+	if err := s.post(ctx, url, headers, request, &response); err != nil {
+		return err
+	}
+	// 090001 is success; anything else, such as a statement still running,
+	// is retried with the same request ID
+	if response.Code != "090001" {
+		return fmt.Errorf("Snowflake statement did not complete (%s): %s", response.Code, response.Message)
+	}
+	return nil
+}
+
+// warehouseText renders a value for a text binding
+func warehouseText(value any) *string {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		text = v
+	case int:
+		text = strconv.Itoa(v)
+	default:
+		text = fmt.Sprint(v)
+	}
+	return &text
+}
+
+// warehouseRequestID derives a UUID from the batch, the same for every retry
+func warehouseRequestID(table warehouseTable, rows []warehouseRow) string {
+	hash := sha256.New()
+	fmt.Fprintln(hash, table.Name)
+	for _, row := range rows {
+		fmt.Fprintln(hash, row.InsertID)
+	}
+	sum := hash.Sum(nil)
+	sum[6] = sum[6]&0x0f | 0x50 // laid out as a name-based UUID
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// assignmentFactRow is the fact row for one version of an assignment
+func assignmentFactRow(assignment *Assignment, exportedAt time.Time) warehouseRow {
+	payClass, holidayDates := publicHolidays.PayClass(assignment)
+	return warehouseRow{
+		InsertID: assignment.PublicID + "@" + strconv.Itoa(assignment.Version),
+		Values: []any{
+			assignment.PublicID,
+			assignment.Version,
+			assignment.Reference,
+			assignment.BusID,
+			assignment.StaffID,
+			assignment.Role,
+			assignment.StartDate.Format("2006-01-02"),
+			warehouseDate(assignment.EndDate),
+			nullIfEmpty(formatWorkingDays(assignment.WorkingDays)),
+			nullIfEmpty(formatTimeOfDay(assignment.ShiftStart)),
+			nullIfEmpty(formatTimeOfDay(assignment.ShiftEnd)),
+			assignment.Status,
+			payClass,
+			nullIfEmpty(strings.Join(holidayDates, ";")),
+			assignment.CreatedAt.UTC().Format(time.RFC3339Nano),
+			assignment.UpdatedAt.UTC().Format(time.RFC3339Nano),
+			warehouseTimestamp(assignment.DeletedAt),
+			exportedAt.UTC().Format(time.RFC3339Nano),
+		},
+	}
+}
+
+// dimensionRows snapshots the buses and staff this service knows about
+func dimensionRows(day string) (buses, staff []warehouseRow) {
+	for _, id := range sortedKeys(mockBuses) {
+		bus := mockBuses[id]
+		buses = append(buses, warehouseRow{
+			InsertID: fmt.Sprintf("bus-%d-%s", id, day),
+			Values:   []any{day, id, bus["plate_number"], bus["model"], bus["depot"]},
+		})
+	}
+	for _, id := range sortedKeys(mockStaff) {
+		member := mockStaff[id]
+		staff = append(staff, warehouseRow{
+			InsertID: fmt.Sprintf("staff-%d-%s", id, day),
+			Values:   []any{day, id, member["name"], member["position"], member["depot"], member["hire_date"]},
+		})
+	}
+	return buses, staff
+}
+
+func sortedKeys(records map[int]map[string]string) []int {
+	ids := make([]int, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func warehouseDate(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.Format("2006-01-02")
+}
+
+func warehouseTimestamp(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func nullIfEmpty(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// WarehouseExporter pushes every assignment version changed since its
+// watermark to the warehouse, and a daily snapshot of the bus and staff
+// dimensions. The watermark only moves once the warehouse has the rows.
+type WarehouseExporter struct {
+	sink     WarehouseSink
+	interval time.Duration
+	lag      time.Duration
+}
+
+// NewWarehouseExporter creates an exporter running every
+// WAREHOUSE_EXPORT_INTERVAL (default 15m). Rows changed in the last
+// WAREHOUSE_EXPORT_LAG (default 1m) wait for the next run, so a transaction
+// that commits late can't slip in behind the watermark.
+func NewWarehouseExporter(sink WarehouseSink) *WarehouseExporter {
+	return &WarehouseExporter{
+		sink:     sink,
+		interval: durationFromEnv("WAREHOUSE_EXPORT_INTERVAL", 15*time.Minute),
+		lag:      durationFromEnv("WAREHOUSE_EXPORT_LAG", time.Minute),
+	}
+}
+
+// Run exports until the context is cancelled
+func (e *WarehouseExporter) Run(ctx context.Context) {
+	monitor := backgroundWorkers.Register("warehouse_exporter", tickerStallAfter(e.interval), nil)
+	defer backgroundWorkers.Unregister("warehouse_exporter")
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := e.export(ctx)
+			monitor.Record(err)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Warehouse export error: %v", err)
+			}
+		}
+	}
+}
+
+// export catches the facts up in batches, then snapshots the dimensions if
+// today's snapshot hasn't been taken
+func (e *WarehouseExporter) export(ctx context.Context) error {
+	for {
+		exported, err := e.exportFacts(ctx)
+		if err != nil {
+			return err
+		}
+		if exported < warehouseBatchSize {
+			break
+		}
+	}
+	return e.exportDimensions(ctx)
+}
+
+// warehouseWatermark is how far a stream has been exported: changes up to
+// this time, and rows with IDs up to this one at exactly that time
+type warehouseWatermark struct {
+	At time.Time
+	ID int
+}
+
+// lockWarehouseTx takes the export lock for the transaction, reporting false
+// when another replica holds it
+func lockWarehouseTx(ctx context.Context, tx pgx.Tx) (bool, error) {
+	var locked bool
+	err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, warehouseLockID).Scan(&locked)
+	return locked, err
+}
+
+func readWatermarkTx(ctx context.Context, tx pgx.Tx, stream string) (warehouseWatermark, error) {
+	var mark warehouseWatermark
+	err := tx.QueryRow(ctx, `SELECT watermark_at, watermark_id FROM warehouse_watermarks WHERE stream = $1`, stream).
+		Scan(&mark.At, &mark.ID)
+	if err == pgx.ErrNoRows {
+		return warehouseWatermark{}, nil // Nothing exported yet
+	}
+	return mark, err
+}
+
+func writeWatermarkTx(ctx context.Context, tx pgx.Tx, stream string, mark warehouseWatermark) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO warehouse_watermarks (stream, watermark_at, watermark_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (stream) DO UPDATE
+			SET watermark_at = EXCLUDED.watermark_at, watermark_id = EXCLUDED.watermark_id, updated_at = CURRENT_TIMESTAMP
+	`, stream, mark.At, mark.ID)
+	return err
+}
+
+// exportFacts loads the next batch of changed assignments, including deleted
+// ones, and returns how many it loaded
+func (e *WarehouseExporter) exportFacts(ctx context.Context) (int, error) {
+	exported := 0
+	err := pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		if locked, err := lockWarehouseTx(ctx, tx); err != nil || !locked {
+			return err
+		}
+		mark, err := readWatermarkTx(ctx, tx, warehouseFactsStream)
+		if err != nil {
+			return err
+		}
+
+		query := `
+			SELECT ` + assignmentColumns + `
+			FROM assignments
+			WHERE (updated_at, id) > ($1, $2) AND updated_at < CURRENT_TIMESTAMP - make_interval(secs => $3)
+			ORDER BY updated_at, id
+			LIMIT $4
+		`
+		assignments, err := queryAssignments(ctx, tx, query, mark.At, mark.ID, e.lag.Seconds(), warehouseBatchSize)
+		if err != nil || len(assignments) == 0 {
+			return err
+		}
+
+		now := time.Now()
+		rows := make([]warehouseRow, len(assignments))
+		for i := range assignments {
+			rows[i] = assignmentFactRow(&assignments[i], now)
+		}
+		if err := e.sink.Load(ctx, assignmentFactsTable, rows); err != nil {
+			return fmt.Errorf("loading %s: %w", assignmentFactsTable.Name, err)
+		}
+
+		last := assignments[len(assignments)-1]
+		if err := writeWatermarkTx(ctx, tx, warehouseFactsStream, warehouseWatermark{At: last.UpdatedAt, ID: last.ID}); err != nil {
+			return err
+		}
+		exported = len(assignments)
+		log.Printf("Exported %d assignment facts to the warehouse, up to %s", exported, last.UpdatedAt.Format(time.RFC3339))
+		return nil
+	})
+	return exported, err
+}
+
+// exportDimensions loads today's bus and staff snapshot, once a day
+func (e *WarehouseExporter) exportDimensions(ctx context.Context) error {
+	return pgx.BeginFunc(ctx, db, func(tx pgx.Tx) error {
+		if locked, err := lockWarehouseTx(ctx, tx); err != nil || !locked {
+			return err
+		}
+		mark, err := readWatermarkTx(ctx, tx, warehouseDimensionsStream)
+		if err != nil {
+			return err
+		}
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		if !mark.At.Before(today) {
+			return nil // Already snapshotted today
+		}
+
+		day := today.Format("2006-01-02")
+		buses, staff := dimensionRows(day)
+		if err := e.sink.Load(ctx, busDimensionTable, buses); err != nil {
+			return fmt.Errorf("loading %s: %w", busDimensionTable.Name, err)
+		}
+		if err := e.sink.Load(ctx, staffDimensionTable, staff); err != nil {
+			return fmt.Errorf("loading %s: %w", staffDimensionTable.Name, err)
+		}
+		return writeWatermarkTx(ctx, tx, warehouseDimensionsStream, warehouseWatermark{At: today})
+	})
+}
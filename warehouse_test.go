@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAssignmentFactRow(t *testing.T) {
+	deleted := time.Date(2025, 3, 4, 9, 30, 0, 0, time.UTC)
+	start := TimeOfDay(6 * 60)
+	end := TimeOfDay(14 * 60)
+	assignment := &Assignment{PublicID: "01JNQ3Z7H5D1F8K2M6P9R4T0VW", Version: 3, BusID: 1, StaffID: 2, Role: "conductor",
+		StartDate: date("2025-03-03"), ShiftStart: &start, ShiftEnd: &end, Status: "active", DeletedAt: &deleted}
+
+	row := assignmentFactRow(assignment, time.Now())
+	if row.InsertID != "01JNQ3Z7H5D1F8K2M6P9R4T0VW@3" {
+		t.Errorf("insert ID = %q, want the assignment at its version", row.InsertID)
+	}
+	if len(row.Values) != len(assignmentFactsTable.Columns) {
+		t.Fatalf("%d values for %d columns", len(row.Values), len(assignmentFactsTable.Columns))
+	}
+	values := map[string]any{}
+	for i, column := range assignmentFactsTable.Columns {
+		values[column] = row.Values[i]
+	}
+	if values["end_date"] != nil || values["working_days"] != nil || values["shift_start"] != "06:00" {
+		t.Errorf("values = %v, want NULL end date and working days, and the shift start", values)
+	}
+	if values["deleted_at"] != "2025-03-04T09:30:00Z" {
+		t.Errorf("deleted_at = %v", values["deleted_at"])
+	}
+}
+
+func TestWarehouseSinks(t *testing.T) {
+	var path, tokenType string
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.RequestURI()
+		tokenType = r.Header.Get("X-Snowflake-Authorization-Token-Type")
+		if r.Header.Get("Authorization") != "Bearer warehouse-token" {
+			t.Errorf("authorization = %q", r.Header.Get("Authorization"))
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if strings.HasPrefix(r.URL.Path, "/api/v2/") {
+			w.Write([]byte(`{"code": "090001", "message": "Statement executed successfully."}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client := warehouseClient{client: server.Client(), token: warehouseToken{static: "warehouse-token"}}
+	buses, _ := dimensionRows("2025-03-03")
+
+	bigQuery := &bigQuerySink{warehouseClient: client, baseURL: server.URL, project: "transit", dataset: "rostering"}
+	if err := bigQuery.Load(context.Background(), busDimensionTable, buses); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/projects/transit/datasets/rostering/tables/dim_bus/insertAll" {
+		t.Errorf("BigQuery path = %q", path)
+	}
+	rows, _ := body["rows"].([]any)
+	if first, _ := rows[0].(map[string]any); len(rows) != len(mockBuses) || first["insertId"] != "bus-1-2025-03-03" {
+		t.Errorf("BigQuery rows = %v", rows)
+	}
+
+	snowflake := &snowflakeSink{warehouseClient: client, baseURL: server.URL, database: "ANALYTICS", schema: "ROSTERING",
+		tokenType: "OAUTH"}
+	if err := snowflake.Load(context.Background(), busDimensionTable, buses); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(path, "requestId="+warehouseRequestID(busDimensionTable, buses)) || tokenType != "OAUTH" {
+		t.Errorf("Snowflake request = %q with token type %q", path, tokenType)
+	}
+	if statement := body["statement"]; statement != "INSERT INTO dim_bus (snapshot_date, bus_id, plate_number, model, depot) VALUES (?, ?, ?, ?, ?)" {
+		t.Errorf("statement = %v", statement)
+	}
+	bindings, _ := body["bindings"].(map[string]any)
+	plates, _ := bindings["3"].(map[string]any)
+	if values, _ := plates["value"].([]any); len(values) != len(mockBuses) || values[0] != "ABC-1234" {
+		t.Errorf("plate number binding = %v", plates)
+	}
+}
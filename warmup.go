@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Lifecycle states of an instance, reported by /readyz while it isn't serving
+const (
+	LifecycleWarmingUp = "warming_up" // started, not yet ready for traffic
+	LifecycleServing   = "serving"
+	LifecycleDraining  = "draining" // shutting down; requests are still served until the drain delay ends
+)
+
+// Lifecycle tracks whether the instance should receive traffic. Readiness
+// fails until warm-up has finished and again once shutdown begins, so a
+// rolling deploy only sends requests to warm instances that aren't leaving.
+type Lifecycle struct {
+	mu    sync.Mutex
+	state string
+}
+
+// lifecycle is the instance's; main starts it warming up. Tests and tools
+// that never warm up are serving from the start.
+var lifecycle = &Lifecycle{state: LifecycleServing}
+
+// State returns the current lifecycle state
+func (l *Lifecycle) State() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state
+}
+
+// WarmingUp holds readiness back until Serving is called
+func (l *Lifecycle) WarmingUp() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.state = LifecycleWarmingUp
+}
+
+// Serving marks warm-up done. An instance already draining stays draining,
+// as a slow warm-up can finish after shutdown has begun.
+func (l *Lifecycle) Serving() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.state == LifecycleWarmingUp {
+		l.state = LifecycleServing
+	}
+}
+
+// Draining fails readiness for the rest of the process's life
+func (l *Lifecycle) Draining() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.state = LifecycleDraining
+}
+
+// warmUp readies the instance for its first requests: it opens the pool's
+// connections and checks each answers a query, fills the directory cache with
+// the buses and staff of active assignments, and converts the API spec.
+// Failures are logged and don't hold readiness back, since the readiness
+// checks still guard the dependencies themselves.
+func warmUp(ctx context.Context, pool *pgxpool.Pool, assignments AssignmentRepository, dir Directory) {
+	started := time.Now()
+	if pool != nil {
+		if opened, err := warmPool(ctx, pool); err != nil {
+			log.Printf("Warm-up: opening database connections failed after %d: %v", opened, err)
+		}
+	}
+	if looked, err := warmDirectory(ctx, assignments, dir); err != nil {
+		log.Printf("Warm-up: filling the directory cache failed after %d lookups: %v", looked, err)
+	}
+	if _, err := openAPIJSON(); err != nil {
+		log.Printf("Warm-up: converting the API spec failed: %v", err)
+	}
+	log.Printf("Warm-up finished in %s", time.Since(started).Round(time.Millisecond))
+}
+
+// warmPool opens the pool's minimum number of connections, at least one, and
+// runs a trivial query on each. They are held together so each is a separate
+// connection, and returned to the pool idle. It returns how many it opened.
+func warmPool(ctx context.Context, pool *pgxpool.Pool) (int, error) {
+	n := max(int(pool.Config().MinConns), 1)
+	conns := make([]*pgxpool.Conn, 0, n)
+	defer func() {
+		for _, conn := range conns {
+			conn.Release()
+		}
+	}()
+	for range n {
+		conn, err := pool.Acquire(ctx)
+		if err != nil {
+			return len(conns), err
+		}
+		conns = append(conns, conn)
+		if _, err := conn.Exec(ctx, "SELECT 1"); err != nil {
+			return len(conns), err
+		}
+	}
+	return len(conns), nil
+}
+
+// warmDirectory looks up the bus and staff member of every active assignment,
+// so their details are cached before requests need them. It returns how many
+// were looked up.
+func warmDirectory(ctx context.Context, assignments AssignmentRepository, dir Directory) (int, error) {
+	active, err := assignments.WithContext(ctx).List(AssignmentFilter{Status: "active"})
+	if err != nil {
+		return 0, err
+	}
+	buses, staff := map[int]bool{}, map[int]bool{}
+	looked := 0
+	for _, assignment := range active {
+		if err := ctx.Err(); err != nil {
+			return looked, err
+		}
+		if !buses[assignment.BusID] {
+			buses[assignment.BusID] = true
+			looked++
+			if _, err := dir.Bus(assignment.BusID); err != nil {
+				return looked, err
+			}
+		}
+		if !staff[assignment.StaffID] {
+			staff[assignment.StaffID] = true
+			looked++
+			if _, err := dir.Staff(assignment.StaffID); err != nil {
+				return looked, err
+			}
+		}
+	}
+	return looked, nil
+}
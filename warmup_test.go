@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// useTestLifecycle gives the test its own lifecycle, since serve drains the
+// shared one
+func useTestLifecycle(t *testing.T) *Lifecycle {
+	t.Helper()
+	saved := lifecycle
+	lifecycle = &Lifecycle{state: LifecycleServing}
+	t.Cleanup(func() { lifecycle = saved })
+	return lifecycle
+}
+
+func TestReadinessFollowsLifecycle(t *testing.T) {
+	previousChecks := readinessChecks
+	t.Cleanup(func() { readinessChecks = previousChecks })
+	readinessChecks = nil
+	states := useTestLifecycle(t)
+	router, _ := newTestRouter(t)
+
+	readyz := func() (int, string) {
+		rec := doRequest(router, http.MethodGet, "/readyz", nil)
+		return rec.Code, decode[struct{ Status string }](t, rec).Status
+	}
+
+	states.WarmingUp()
+	if code, status := readyz(); code != http.StatusServiceUnavailable || status != LifecycleWarmingUp {
+		t.Errorf("warming up readyz = %d %s, want 503 warming_up", code, status)
+	}
+	if rec := doRequest(router, http.MethodGet, "/healthz", nil); rec.Code != http.StatusOK {
+		t.Errorf("warming up healthz = %d, want liveness unaffected", rec.Code)
+	}
+
+	states.Serving()
+	if code, status := readyz(); code != http.StatusOK || status != "ready" {
+		t.Errorf("warmed up readyz = %d %s, want 200 ready", code, status)
+	}
+
+	states.Draining()
+	states.Serving()
+	if code, status := readyz(); code != http.StatusServiceUnavailable || status != LifecycleDraining {
+		t.Errorf("draining readyz = %d %s, want 503 draining even after a late warm-up", code, status)
+	}
+}
+
+func TestWarmDirectory(t *testing.T) {
+	repo := NewMemoryAssignmentRepository()
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 1, Role: "driver", StartDate: date("2025-03-03")})
+	mustCreate(t, repo, Assignment{BusID: 1, StaffID: 2, Role: "conductor", StartDate: date("2025-03-03")})
+	done := mustCreate(t, repo, Assignment{BusID: 3, StaffID: 3, Role: "driver", StartDate: date("2025-03-03")})
+	done.Status = "completed"
+	if err := repo.Update(&done, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	upstream := &countingDirectory{}
+	cached := NewCachedDirectory(upstream, NewMemoryDirectoryCache(10, time.Minute))
+	looked, err := warmDirectory(context.Background(), repo, cached)
+	if err != nil || looked != 3 || upstream.calls != 3 {
+		t.Fatalf("warmDirectory = %d, %v with %d upstream calls; want bus 1 and staff 1 and 2", looked, err,
+			upstream.calls)
+	}
+
+	cached.Bus(1)
+	cached.Staff(2)
+	if upstream.calls != 3 {
+		t.Errorf("%d upstream calls after warm-up, want the active crew served from the cache", upstream.calls)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Background worker statuses reported by /readyz
+const (
+	WorkerOK      = "ok"      // the last run succeeded
+	WorkerFailing = "failing" // the last run failed; it will be retried
+	WorkerStalled = "stalled" // no run has finished for longer than expected
+)
+
+// minWorkerStallAfter keeps fast-polling workers from being reported stalled
+// by one slow batch
+const minWorkerStallAfter = time.Minute
+
+// WorkerStatus is what /readyz reports about one background worker
+type WorkerStatus struct {
+	Status        string     `json:"status"`
+	LastRunAt     *time.Time `json:"last_run_at,omitempty"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	QueueDepth    *int       `json:"queue_depth,omitempty"` // work waiting for the worker, where it has a queue
+	QueueError    string     `json:"queue_error,omitempty"`
+}
+
+// WorkerMonitor records the runs of one background worker
+type WorkerMonitor struct {
+	name       string
+	stallAfter time.Duration // 0 for workers that wait on events rather than ticking
+	queueDepth func(ctx context.Context) (int, error)
+
+	mu          sync.Mutex
+	started     time.Time
+	lastRun     time.Time
+	lastSuccess time.Time
+	lastError   string
+}
+
+// Record notes the end of a run, failed when err is set
+func (m *WorkerMonitor) Record(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastRun = time.Now()
+	if err != nil {
+		m.lastError = err.Error()
+		return
+	}
+	m.lastError = ""
+	m.lastSuccess = m.lastRun
+}
+
+// status reports the worker as of now, without its queue depth
+func (m *WorkerMonitor) status(now time.Time) WorkerStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := WorkerStatus{Status: WorkerOK, LastError: m.lastError}
+	if !m.lastRun.IsZero() {
+		lastRun := m.lastRun
+		status.LastRunAt = &lastRun
+	}
+	if !m.lastSuccess.IsZero() {
+		lastSuccess := m.lastSuccess
+		status.LastSuccessAt = &lastSuccess
+	}
+	// A worker that hasn't run yet is measured from when it started
+	since := m.lastRun
+	if since.IsZero() {
+		since = m.started
+	}
+	switch {
+	case m.stallAfter > 0 && now.Sub(since) > m.stallAfter:
+		status.Status = WorkerStalled
+	case m.lastError != "":
+		status.Status = WorkerFailing
+	}
+	return status
+}
+
+// WorkerRegistry is the set of background workers running in this process
+type WorkerRegistry struct {
+	mu       sync.Mutex
+	monitors map[string]*WorkerMonitor
+}
+
+// backgroundWorkers are the workers main started, reported by /readyz.
+// Workers paused while the schema drifts never register.
+var backgroundWorkers = &WorkerRegistry{monitors: map[string]*WorkerMonitor{}}
+
+// Register starts monitoring a worker. One that ticks every interval is
+// reported stalled after three intervals, or a minute, without finishing a
+// run; stallAfter overrides that for workers whose runs may legitimately
+// take longer, and 0 turns it off. queueDepth, when set, counts the work
+// waiting for the worker.
+func (r *WorkerRegistry) Register(name string, stallAfter time.Duration,
+	queueDepth func(ctx context.Context) (int, error)) *WorkerMonitor {
+	monitor := &WorkerMonitor{name: name, stallAfter: stallAfter, queueDepth: queueDepth, started: time.Now()}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.monitors[name] = monitor
+	return monitor
+}
+
+// Unregister stops monitoring a worker, once it has stopped
+func (r *WorkerRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.monitors, name)
+}
+
+// Statuses reports every worker, with the depth of its queue, and whether
+// any has stalled
+func (r *WorkerRegistry) Statuses(ctx context.Context) (map[string]WorkerStatus, bool) {
+	r.mu.Lock()
+	monitors := make([]*WorkerMonitor, 0, len(r.monitors))
+	for _, monitor := range r.monitors {
+		monitors = append(monitors, monitor)
+	}
+	r.mu.Unlock()
+	sort.Slice(monitors, func(i, j int) bool { return monitors[i].name < monitors[j].name })
+
+	now := time.Now()
+	statuses := make(map[string]WorkerStatus, len(monitors))
+	stalled := false
+	for _, monitor := range monitors {
+		status := monitor.status(now)
+		if monitor.queueDepth != nil {
+			depthCtx, cancel := context.WithTimeout(ctx, readinessTimeout)
+			depth, err := monitor.queueDepth(depthCtx)
+			cancel()
+			if err != nil {
+				status.QueueError = err.Error()
+			} else {
+				status.QueueDepth = &depth
+			}
+		}
+		statuses[monitor.name] = status
+		stalled = stalled || status.Status == WorkerStalled
+	}
+	return statuses, stalled
+}
+
+// tickerStallAfter is how long a worker ticking every interval may go without
+// finishing a run before it's reported stalled
+func tickerStallAfter(interval time.Duration) time.Duration {
+	return max(3*interval, minWorkerStallAfter)
+}
+
+// countQueue returns a queue depth function counting the rows of a query
+func countQueue(query string) func(ctx context.Context) (int, error) {
+	return func(ctx context.Context) (int, error) {
+		var depth int
+		err := db.QueryRow(ctx, query).Scan(&depth)
+		return depth, err
+	}
+}
+
+// countDueQueue is countQueue for work that falls due on the service's
+// clock, passed to the query as $1
+func countDueQueue(query string) func(ctx context.Context) (int, error) {
+	return func(ctx context.Context) (int, error) {
+		var depth int
+		err := db.QueryRow(ctx, query, clock.Now()).Scan(&depth)
+		return depth, err
+	}
+}